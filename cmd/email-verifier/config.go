@@ -0,0 +1,194 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// Every flag is a setting. A setting not given on the command line is
+// taken from its environment variable, else from the -config file, else
+// the flag's default.
+
+// commandFlags say what the process does rather than how the server
+// behaves, so they are only read from the command line.
+var commandFlags = map[string]bool{"config": true, "print-config": true, "health-check": true, "health-check-deep": true}
+
+// envNames are the environment variables of settings whose variable isn't
+// the flag name upper-cased with dashes as underscores (PORT, CAPTURE_DIR).
+var envNames = map[string]string{
+	"retry-secret":    "RETRY_TOKEN_SECRET",
+	"watch-webhook":   "WATCH_WEBHOOK_URL",
+	"history":         "HISTORY_ENABLED",
+	"enable-gravatar": "ENABLE_GRAVATAR",
+	"smtp-check":      "ENABLE_SMTP_CHECK",
+	"smtp-proxy":      "PROXY_URI",
+}
+
+// secretSettings are redacted by -print-config.
+var secretSettings = map[string]bool{"retry-secret": true, "smtp-proxy": true, "api-keys": true, "job-callback-secret": true, "privacy-salt": true}
+
+func envName(setting string) string {
+	if name, ok := envNames[setting]; ok {
+		return name
+	}
+	return strings.ToUpper(strings.ReplaceAll(setting, "-", "_"))
+}
+
+// loadConfigFile reads the settings in a -config file.
+func loadConfigFile(path string) (map[string]string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("config: %w", err)
+	}
+	settings, err := parseConfigFile(data)
+	if err != nil {
+		return nil, fmt.Errorf("config %s: %w", path, err)
+	}
+	return settings, nil
+}
+
+// parseConfigFile parses a flat YAML mapping of setting names to scalar
+// values, e.g. "verify-timeout: 20s". Names may use underscores for
+// dashes. Nested mappings and lists have no setting to go to, so they are
+// rejected rather than ignored.
+func parseConfigFile(data []byte) (map[string]string, error) {
+	settings := make(map[string]string)
+	for i, line := range strings.Split(string(data), "\n") {
+		n := i + 1
+		line = strings.TrimRight(line, " \t\r")
+		trimmed := strings.TrimSpace(line)
+		if trimmed == "" || strings.HasPrefix(trimmed, "#") || trimmed == "---" {
+			continue
+		}
+		if trimmed != line || strings.HasPrefix(trimmed, "- ") {
+			return nil, fmt.Errorf("line %d: only top-level name: value settings are supported", n)
+		}
+		name, rest, ok := strings.Cut(line, ":")
+		if !ok {
+			return nil, fmt.Errorf("line %d: expected name: value", n)
+		}
+		name = strings.ReplaceAll(strings.TrimSpace(name), "_", "-")
+		value, err := parseConfigValue(strings.TrimSpace(rest))
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", n, err)
+		}
+		if _, dup := settings[name]; dup {
+			return nil, fmt.Errorf("line %d: %s is set twice", n, name)
+		}
+		settings[name] = value
+	}
+	return settings, nil
+}
+
+// parseConfigValue reads a plain, single-quoted or double-quoted scalar
+// and drops a trailing comment.
+func parseConfigValue(s string) (string, error) {
+	switch {
+	case strings.HasPrefix(s, `"`):
+		for end := 1; end < len(s); end++ {
+			if s[end] == '\\' {
+				end++
+				continue
+			}
+			if s[end] == '"' {
+				if !isComment(s[end+1:]) {
+					return "", fmt.Errorf("unexpected text after %s", s[:end+1])
+				}
+				return strconv.Unquote(s[:end+1])
+			}
+		}
+		return "", fmt.Errorf("unterminated string %s", s)
+	case strings.HasPrefix(s, "'"):
+		var b strings.Builder
+		for end := 1; end < len(s); end++ {
+			if s[end] != '\'' {
+				b.WriteByte(s[end])
+				continue
+			}
+			if end+1 < len(s) && s[end+1] == '\'' {
+				b.WriteByte('\'')
+				end++
+				continue
+			}
+			if !isComment(s[end+1:]) {
+				return "", fmt.Errorf("unexpected text after %s", s[:end+1])
+			}
+			return b.String(), nil
+		}
+		return "", fmt.Errorf("unterminated string %s", s)
+	case strings.HasPrefix(s, "{") || strings.HasPrefix(s, "["):
+		return "", fmt.Errorf("only scalar values are supported, got %s", s)
+	}
+	if s == "~" || s == "null" {
+		return "", nil
+	}
+	if i := strings.Index(s, " #"); i >= 0 {
+		s = strings.TrimSpace(s[:i])
+	}
+	return s, nil
+}
+
+func isComment(s string) bool {
+	s = strings.TrimSpace(s)
+	return s == "" || strings.HasPrefix(s, "#")
+}
+
+// applySettings sets every flag of fs not given on the command line from
+// its environment variable, else from file. getenv is os.Getenv; empty
+// variables count as unset.
+func applySettings(fs *flag.FlagSet, file map[string]string, getenv func(string) string) error {
+	for name := range file {
+		if fs.Lookup(name) == nil || commandFlags[name] {
+			return fmt.Errorf("config: unknown setting %q", name)
+		}
+	}
+	given := make(map[string]bool)
+	fs.Visit(func(f *flag.Flag) { given[f.Name] = true })
+
+	var err error
+	fs.VisitAll(func(f *flag.Flag) {
+		if err != nil || given[f.Name] || commandFlags[f.Name] {
+			return
+		}
+		value, source := getenv(envName(f.Name)), envName(f.Name)
+		if value == "" {
+			var ok bool
+			if value, ok = file[f.Name]; !ok {
+				return
+			}
+			source = "config " + f.Name
+		}
+		if setErr := f.Value.Set(value); setErr != nil {
+			err = fmt.Errorf("invalid %s %q for -%s: %v", source, value, f.Name, setErr)
+		}
+	})
+	return err
+}
+
+// writeConfig writes the effective settings as a config file, for
+// -print-config. Secrets are redacted.
+func writeConfig(w io.Writer, fs *flag.FlagSet) {
+	fs.VisitAll(func(f *flag.Flag) {
+		if commandFlags[f.Name] {
+			return
+		}
+		value := f.Value.String()
+		if secretSettings[f.Name] && value != "" {
+			value = "<redacted>"
+		}
+		fmt.Fprintf(w, "%s: %s\n", f.Name, configScalar(value))
+	})
+}
+
+// configScalar quotes value where a plain YAML scalar would read
+// differently.
+func configScalar(value string) string {
+	if value == "" || value != strings.TrimSpace(value) || strings.ContainsAny(value, ":#{}[],&*!|>'\"%@`") {
+		return strconv.Quote(value)
+	}
+	return value
+}
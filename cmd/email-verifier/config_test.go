@@ -0,0 +1,106 @@
+package main
+
+import (
+	"bytes"
+	"flag"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+// testFlags is a small flag set shaped like the server's
+func testFlags() *flag.FlagSet {
+	fs := flag.NewFlagSet("test", flag.ContinueOnError)
+	fs.String("port", "8081", "")
+	fs.Duration("verify-timeout", 15*time.Second, "")
+	fs.Bool("history", false, "")
+	fs.String("retry-secret", "", "")
+	fs.String("gauge-bounds", "goroutines=1000", "")
+	fs.Bool("print-config", false, "")
+	return fs
+}
+
+// TestParseConfigFile tests the flat YAML settings files accept and the shapes they reject
+func TestParseConfigFile(t *testing.T) {
+	settings, err := parseConfigFile([]byte(`---
+# Production settings
+port: 9090
+verify_timeout: 20s   # underscores work too
+retry-secret: "s3cr#t \"quoted\""
+gauge-bounds: 'goroutines=5000,it''s'
+history:
+`))
+	expected := map[string]string{
+		"port":           "9090",
+		"verify-timeout": "20s",
+		"retry-secret":   `s3cr#t "quoted"`,
+		"gauge-bounds":   "goroutines=5000,it's",
+		"history":        "",
+	}
+	if err != nil || !reflect.DeepEqual(settings, expected) {
+		t.Errorf("Expected %v, got %v and %v", expected, settings, err)
+	}
+
+	for _, bad := range []string{
+		"smtp:\n  hello: probe.example\n",
+		"- port: 9090\n",
+		"port 9090\n",
+		"port: [9090]\n",
+		"port: \"9090\n",
+		"port: 9090\nport: 9091\n",
+	} {
+		if _, err := parseConfigFile([]byte(bad)); err == nil {
+			t.Errorf("Expected an error for %q", bad)
+		}
+	}
+}
+
+// TestApplySettings tests that flags beat environment variables, which beat the file
+func TestApplySettings(t *testing.T) {
+	fs := testFlags()
+	fs.Parse([]string{"-port", "7000"})
+	env := map[string]string{"PORT": "7500", "VERIFY_TIMEOUT": "30s", "HISTORY_ENABLED": "true"}
+	file := map[string]string{"port": "9090", "verify-timeout": "20s", "retry-secret": "from-file"}
+	if err := applySettings(fs, file, func(name string) string { return env[name] }); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	for name, expected := range map[string]string{"port": "7000", "verify-timeout": "30s", "history": "true", "retry-secret": "from-file", "gauge-bounds": "goroutines=1000"} {
+		if got := fs.Lookup(name).Value.String(); got != expected {
+			t.Errorf("Expected %s=%s, got %s", name, expected, got)
+		}
+	}
+
+	testCases := []struct {
+		file map[string]string
+		env  map[string]string
+	}{
+		{map[string]string{"no-such-setting": "1"}, nil},
+		{map[string]string{"print-config": "true"}, nil},
+		{map[string]string{"verify-timeout": "soon"}, nil},
+		{nil, map[string]string{"HISTORY_ENABLED": "yes please"}},
+	}
+	for _, tc := range testCases {
+		if err := applySettings(testFlags(), tc.file, func(name string) string { return tc.env[name] }); err == nil {
+			t.Errorf("Expected an error for %v %v", tc.file, tc.env)
+		}
+	}
+}
+
+// TestWriteConfig tests that the printed settings read back the same, secrets aside
+func TestWriteConfig(t *testing.T) {
+	fs := testFlags()
+	fs.Parse([]string{"-retry-secret", "hunter2", "-gauge-bounds", "goroutines=1000, verifications_in_flight=200"})
+	var buf bytes.Buffer
+	writeConfig(&buf, fs)
+	if strings.Contains(buf.String(), "hunter2") || strings.Contains(buf.String(), "print-config") {
+		t.Errorf("Expected the secret and command flags left out, got %s", buf.String())
+	}
+	settings, err := parseConfigFile(buf.Bytes())
+	if err != nil {
+		t.Fatalf("Expected the output to parse, got %v:\n%s", err, buf.String())
+	}
+	if settings["gauge-bounds"] != "goroutines=1000, verifications_in_flight=200" || settings["retry-secret"] != "<redacted>" || settings["verify-timeout"] != "15s" {
+		t.Errorf("Expected the settings to read back, got %v", settings)
+	}
+}
@@ -0,0 +1,182 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"time"
+)
+
+// version is set at build time with -ldflags "-X main.version=...".
+var version = "dev"
+
+// serviceRegistration describes this instance to a discovery system.
+type serviceRegistration struct {
+	ID        string
+	Name      string
+	Address   string
+	Port      int
+	Tags      []string
+	HealthURL string
+	TTL       time.Duration // the instance must call Refresh more often than this
+}
+
+// serviceRegistry is a discovery backend. Consul is the only one so far.
+type serviceRegistry interface {
+	Register(ctx context.Context, reg serviceRegistration) error
+	// Refresh tells the registry the instance is still alive. An error
+	// means the registration may have been lost, e.g. the agent restarted.
+	Refresh(ctx context.Context, reg serviceRegistration) error
+	Deregister(ctx context.Context, reg serviceRegistration) error
+}
+
+// consulRegistry registers with a local Consul agent over its HTTP API.
+type consulRegistry struct {
+	addr   string // e.g. http://127.0.0.1:8500
+	client *http.Client
+}
+
+func newConsulRegistry(addr string) *consulRegistry {
+	return &consulRegistry{addr: addr, client: &http.Client{Timeout: 5 * time.Second}}
+}
+
+func ttlCheckID(reg serviceRegistration) string { return "service:" + reg.ID + ":ttl" }
+
+func (c *consulRegistry) Register(ctx context.Context, reg serviceRegistration) error {
+	body := map[string]interface{}{
+		"ID":      reg.ID,
+		"Name":    reg.Name,
+		"Address": reg.Address,
+		"Port":    reg.Port,
+		"Tags":    reg.Tags,
+		"Checks": []map[string]interface{}{
+			{
+				"CheckID":  "service:" + reg.ID + ":readyz",
+				"Name":     "readyz",
+				"HTTP":     reg.HealthURL,
+				"Interval": "10s",
+				"Timeout":  "2s",
+			},
+			{
+				"CheckID": ttlCheckID(reg),
+				"Name":    "heartbeat",
+				"TTL":     reg.TTL.String(),
+				// Lets Consul clean up after instances that died without
+				// deregistering.
+				"DeregisterCriticalServiceAfter": "10m",
+			},
+		},
+	}
+	if err := c.put(ctx, "/v1/agent/service/register", body); err != nil {
+		return err
+	}
+	return c.Refresh(ctx, reg)
+}
+
+func (c *consulRegistry) Refresh(ctx context.Context, reg serviceRegistration) error {
+	return c.put(ctx, "/v1/agent/check/pass/"+url.PathEscape(ttlCheckID(reg)), nil)
+}
+
+func (c *consulRegistry) Deregister(ctx context.Context, reg serviceRegistration) error {
+	return c.put(ctx, "/v1/agent/service/deregister/"+url.PathEscape(reg.ID), nil)
+}
+
+func (c *consulRegistry) put(ctx context.Context, path string, body interface{}) error {
+	var data []byte
+	if body != nil {
+		var err error
+		if data, err = json.Marshal(body); err != nil {
+			return err
+		}
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPut, c.addr+path, bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("consul %s returned status %d", path, resp.StatusCode)
+	}
+	return nil
+}
+
+// runRegistration registers reg and keeps it alive until ctx is cancelled,
+// then deregisters. A failed refresh is taken to mean the agent lost the
+// registration (it restarted, say) and triggers a fresh registration.
+func runRegistration(ctx context.Context, registry serviceRegistry, reg serviceRegistration) {
+	registered := false
+	refresh := reg.TTL / 3
+	ticker := time.NewTicker(refresh)
+	defer ticker.Stop()
+
+	for {
+		if registered {
+			if err := registry.Refresh(ctx, reg); err != nil && ctx.Err() == nil {
+				log.Printf("discovery: refresh failed, re-registering: %v", err)
+				registered = false
+			}
+		}
+		if !registered {
+			if err := registry.Register(ctx, reg); err != nil {
+				if ctx.Err() == nil {
+					log.Printf("discovery: registration failed: %v", err)
+				}
+			} else {
+				registered = true
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			// The parent context is gone, so deregistration gets its own
+			deregisterCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			defer cancel()
+			if err := registry.Deregister(deregisterCtx, reg); err != nil {
+				log.Printf("discovery: deregistration failed: %v", err)
+			}
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// newServiceRegistration describes this instance listening on port, tagged
+// with the SMTP profiles it serves.
+func newServiceRegistration(advertiseAddr, port string, profiles []string) (serviceRegistration, error) {
+	portNum, err := strconv.Atoi(port)
+	if err != nil {
+		return serviceRegistration{}, fmt.Errorf("invalid port %q", port)
+	}
+	hostname, _ := os.Hostname()
+	host := advertiseAddr
+	if host == "" {
+		host = "127.0.0.1"
+	}
+
+	tags := []string{"version=" + version}
+	for _, name := range profiles {
+		tags = append(tags, "profile="+name)
+	}
+
+	return serviceRegistration{
+		ID:        fmt.Sprintf("email-verifier-%s-%d", hostname, portNum),
+		Name:      "email-verifier",
+		Address:   advertiseAddr,
+		Port:      portNum,
+		Tags:      tags,
+		HealthURL: fmt.Sprintf("http://%s:%d/readyz", host, portNum),
+		TTL:       30 * time.Second,
+	}, nil
+}
@@ -0,0 +1,141 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeConsulAgent implements the slice of the Consul agent API we use
+type fakeConsulAgent struct {
+	mu            sync.Mutex
+	services      map[string]map[string]interface{}
+	checks        map[string]bool
+	registrations int
+	passes        int
+}
+
+func newFakeConsulAgent() *fakeConsulAgent {
+	return &fakeConsulAgent{services: map[string]map[string]interface{}{}, checks: map[string]bool{}}
+}
+
+func (a *fakeConsulAgent) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if r.Method != http.MethodPut {
+		http.Error(w, "method", http.StatusMethodNotAllowed)
+		return
+	}
+	switch {
+	case r.URL.Path == "/v1/agent/service/register":
+		var body map[string]interface{}
+		json.NewDecoder(r.Body).Decode(&body)
+		id := body["ID"].(string)
+		a.services[id] = body
+		for _, check := range body["Checks"].([]interface{}) {
+			a.checks[check.(map[string]interface{})["CheckID"].(string)] = true
+		}
+		a.registrations++
+	case strings.HasPrefix(r.URL.Path, "/v1/agent/check/pass/"):
+		if !a.checks[strings.TrimPrefix(r.URL.Path, "/v1/agent/check/pass/")] {
+			http.Error(w, "Unknown check", http.StatusNotFound)
+			return
+		}
+		a.passes++
+	case strings.HasPrefix(r.URL.Path, "/v1/agent/service/deregister/"):
+		delete(a.services, strings.TrimPrefix(r.URL.Path, "/v1/agent/service/deregister/"))
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+// restart forgets every registration, as a restarted agent would
+func (a *fakeConsulAgent) restart() {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.services = map[string]map[string]interface{}{}
+	a.checks = map[string]bool{}
+}
+
+func (a *fakeConsulAgent) snapshot() (services, registrations, passes int) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return len(a.services), a.registrations, a.passes
+}
+
+// waitFor polls cond for up to a second
+func waitFor(t *testing.T, what string, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(time.Second)
+	for time.Now().Before(deadline) {
+		if cond() {
+			return
+		}
+		time.Sleep(time.Millisecond)
+	}
+	t.Fatalf("Timed out waiting for %s", what)
+}
+
+// TestConsulRegistrationLifecycle tests register, re-register after an agent restart, and deregister
+func TestConsulRegistrationLifecycle(t *testing.T) {
+	agent := newFakeConsulAgent()
+	server := httptest.NewServer(agent)
+	defer server.Close()
+
+	reg, err := newServiceRegistration("10.0.0.7", "8081", []string{"default"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	reg.TTL = 30 * time.Millisecond
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		runRegistration(ctx, newConsulRegistry(server.URL), reg)
+		close(done)
+	}()
+
+	waitFor(t, "registration", func() bool { n, _, passes := agent.snapshot(); return n == 1 && passes > 0 })
+
+	agent.mu.Lock()
+	service := agent.services[reg.ID]
+	agent.mu.Unlock()
+	if service["Address"] != "10.0.0.7" || service["Port"].(float64) != 8081 {
+		t.Errorf("Expected 10.0.0.7:8081, got %v:%v", service["Address"], service["Port"])
+	}
+	checks := service["Checks"].([]interface{})
+	if healthURL := checks[0].(map[string]interface{})["HTTP"]; healthURL != "http://10.0.0.7:8081/readyz" {
+		t.Errorf("Expected health check on /readyz, got %v", healthURL)
+	}
+	tags := service["Tags"].([]interface{})
+	if len(tags) < 2 || tags[0] != "version="+version || tags[1] != "profile=default" {
+		t.Errorf("Expected version and profile tags, got %v", tags)
+	}
+
+	agent.restart()
+	waitFor(t, "re-registration", func() bool { n, registrations, _ := agent.snapshot(); return n == 1 && registrations == 2 })
+
+	cancel()
+	<-done
+	if n, _, _ := agent.snapshot(); n != 0 {
+		t.Errorf("Expected service to be deregistered on shutdown, got %d services", n)
+	}
+}
+
+// TestConsulRegisterFailure tests that registration errors surface from the registry
+func TestConsulRegisterFailure(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "boom", http.StatusInternalServerError)
+	}))
+	defer server.Close()
+
+	reg, _ := newServiceRegistration("", "8081", nil)
+	if err := newConsulRegistry(server.URL).Register(context.Background(), reg); err == nil {
+		t.Error("Expected registration error")
+	}
+}
@@ -0,0 +1,41 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"log"
+	"log/slog"
+	"strings"
+	"testing"
+)
+
+// TestNewLogger tests the formats and levels, and that the log package writes through the logger once installed
+func TestNewLogger(t *testing.T) {
+	var buf bytes.Buffer
+	logger, err := newLogger(&buf, "json", "warn")
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	logger.Info("dropped")
+	logger.Warn("kept", "domain", "example.com")
+	var line map[string]interface{}
+	if err := json.Unmarshal(buf.Bytes(), &line); err != nil || line["msg"] != "kept" || line["domain"] != "example.com" {
+		t.Errorf("Expected one JSON warning, got %q", buf.String())
+	}
+
+	buf.Reset()
+	logger, _ = newLogger(&buf, "text", "info")
+	saved := slog.Default()
+	slog.SetDefault(logger)
+	t.Cleanup(func() { slog.SetDefault(saved) })
+	log.Printf("watch: mail records changed")
+	if !strings.Contains(buf.String(), `level=INFO msg="watch: mail records changed"`) {
+		t.Errorf("Expected log output through the text logger, got %q", buf.String())
+	}
+
+	for _, bad := range [][2]string{{"xml", "info"}, {"json", "loud"}} {
+		if _, err := newLogger(&buf, bad[0], bad[1]); err == nil {
+			t.Errorf("Expected an error for %v", bad)
+		}
+	}
+}
@@ -0,0 +1,486 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"log/slog"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
+
+	"email-verifier/internal/httpapi"
+	"email-verifier/pkg/verify"
+)
+
+func main() {
+	// Parse command line flags
+	healthCheck := flag.Bool("health-check", false, "Run health check and exit")
+	healthCheckDeep := flag.Bool("health-check-deep", false, "With -health-check, also fail if none of -smtp-self-test-hosts can be reached on port 25")
+	configFile := flag.String("config", "", "YAML file of settings (flag names as keys); environment variables and flags override it")
+	printConfig := flag.Bool("print-config", false, "Print the effective settings as YAML and exit")
+	logFormat := flag.String("log-format", "text", "Log format: text or json")
+	logLevel := flag.String("log-level", "info", "Lowest level logged: debug, info, warn or error")
+	port := flag.String("port", "8081", "Port to run the server on")
+	readHeaderTimeout := flag.Duration("read-header-timeout", 10*time.Second, "Longest a client may take to send request headers")
+	writeTimeout := flag.Duration("write-timeout", 5*time.Minute, "Longest a request may take from the end of its headers to the end of its response")
+	idleTimeout := flag.Duration("idle-timeout", 2*time.Minute, "How long an idle keep-alive connection is kept open")
+	drainTimeout := flag.Duration("drain-timeout", 30*time.Second, "How long in-flight requests may run after SIGINT or SIGTERM before they are cut off")
+	retrySecret := flag.String("retry-secret", "", "Secret used to sign retry tokens (random per process if empty)")
+	retryWindow := flag.Duration("retry-window", time.Hour, "How long a retry token stays valid after its retry delay")
+	watchWebhook := flag.String("watch-webhook", "", "Webhook or Slack URL notified when watched domains change")
+	maxWatches := flag.Int("max-watches-per-key", 50, "Maximum number of domain watches per API key")
+	watchMinInterval := flag.Duration("watch-min-interval", 5*time.Minute, "Minimum re-check interval for domain watches")
+	gaugeBounds := flag.String("gauge-bounds", "goroutines=1000,verifications_in_flight=200,watch_checks_in_flight=50", "Comma-separated name=max bounds that trigger leak warnings")
+	backgroundConcurrency := flag.Int("background-concurrency", 2, "Maximum background tasks (watch checks, forwarding, sweeps) running at once")
+	leakCheckInterval := flag.Duration("leak-check-interval", time.Minute, "How often gauges are compared against their bounds")
+	alertRules := flag.String("alert-rules", "", "JSON file of alert rules over internal metrics and the webhook or Slack URL they fire to (off if empty)")
+	alertInterval := flag.Duration("alert-interval", 30*time.Second, "How often alert rules are evaluated")
+	forwardConfig := flag.String("forward-config", "", "JSON file mapping API keys to result forwarding URLs and secrets")
+	pseudonymConfig := flag.String("pseudonym-config", "", "JSON file mapping tenants to the secrets pseudonymized exports are keyed with, current first")
+	apiKeys := flag.String("api-keys", "", "Comma-separated name=key API keys (bare keys are named by a fingerprint); /api/ requests need one in X-API-Key if set")
+	apiKeysFile := flag.String("api-keys-file", "", "JSON file mapping API key names to keys, on top of -api-keys")
+	rateLimit := flag.Int("rate-limit", 0, "Requests per minute each client may make to /api/ routes (off if 0)")
+	rateLimitBurst := flag.Int("rate-limit-burst", 0, "Requests a client may make at once under -rate-limit (-rate-limit if 0)")
+	corsOrigins := flag.String("cors-origins", "", "Comma-separated browser origins (or *) allowed to call /api/ routes; no CORS headers if empty")
+	trustedProxies := flag.String("trusted-proxies", "", "Comma-separated proxy addresses and CIDR ranges whose X-Forwarded-For names the client")
+	routeGroups := flag.String("route-groups", "", "Comma-separated route groups to serve (ui, api, admin, metrics, docs); all if empty")
+	brandConfig := flag.String("brand-config", "", "JSON file setting the web UI's product name, logo, colors and footer, server-wide and per tenant")
+	refResolvers := flag.String("ref-resolvers", "", "JSON file mapping address reference schemes (as in crm:12345) to resolvers")
+	suppressionSources := flag.String("suppression-sources", "", "JSON file of ESP suppression lists to pull or take bounce and complaint events from")
+	captureDir := flag.String("capture-dir", "", "Directory /admin/capture writes verification bundles to; captures are off if empty")
+	captureTTL := flag.Duration("capture-ttl", 7*24*time.Hour, "How long capture bundles are kept")
+	janitorInterval := flag.Duration("janitor-interval", time.Minute, "How often in-memory state is swept for expired entries")
+	forwardTTL := flag.Duration("forward-ttl", 24*time.Hour, "How long undelivered forwarded results are kept")
+	watchHistoryTTL := flag.Duration("watch-history-ttl", 30*24*time.Hour, "How long recorded watch changes are kept")
+	noMailVerdict := flag.String("no-mail-service-verdict", verify.VerdictRisky, "Verdict for domains that exist but have no mail service (risky or undeliverable)")
+	legacyAddresses := flag.String("legacy-addresses", verify.LegacyExtract, "How source routes, percent-hack addresses and bang paths are handled (extract or reject)")
+	checksConfig := flag.String("checks-config", "", "JSON file mapping API keys to their default checks")
+	randomnessThreshold := flag.Float64("randomness-threshold", verify.DefaultRandomnessThreshold, "Local part randomness score (0 to 1) above which results carry the random_local_part warning")
+	scoreConfig := flag.String("score-config", "", "JSON file of score weights over the defaults: deliverable, catch_all, unknown, undeliverable and penalties by risk flag")
+	policyConfig := flag.String("policy-config", "", "JSON file of verdict policies for soft signals, globally, per profile and per API key")
+	tenantsConfig := flag.String("tenants-config", "", "JSON file grouping API keys into tenants with their own policy lists")
+	disposableList := flag.String("disposable-list", "", "File of extra disposable domains, one per line")
+	freeList := flag.String("free-list", "", "File of extra free provider domains, one per line")
+	roleList := flag.String("role-list", "", "File of extra role account local parts, one per line")
+	providerRules := flag.String("provider-rules", "", "JSON file of provider rules for normalized_email on top of the built-in ones, mapping domains to {domain, ignore_dots, separator}")
+	mailProviders := flag.String("mail-providers", "", "JSON file of mail provider signatures for mail_provider on top of the built-in ones, mapping provider names to {mx, banner}")
+	smtpAllowlist := flag.String("smtp-allowlist", "", "Comma-separated domains, or wildcards like *.example.com, that are never probed; reachable follows from their MX records")
+	smtpAllowlistFile := flag.String("smtp-allowlist-file", "", "File of domains for -smtp-allowlist, one per line")
+	domainBlocklist := flag.String("domain-blocklist", "", "Comma-separated domains, or wildcards like *.example.com, whose addresses are invalid without any lookup")
+	domainBlocklistFile := flag.String("domain-blocklist-file", "", "File of domains for -domain-blocklist, one per line")
+	listOverrides := flag.String("list-overrides", "", "JSON file /api/admin/lists changes are saved to and loaded from at startup (kept in memory only if empty)")
+	profilesConfig := flag.String("profiles-config", "", "JSON file mapping API keys to SMTP profiles (proxy, hello_name, from_email)")
+	profileDrain := flag.Duration("profile-drain-timeout", 30*time.Second, "How long probes on a replaced profile generation may run before it is closed")
+	profileReloadState := flag.String("profile-reload-state", verify.ReloadStateReset, "What happens to per-profile limiter and breaker state on reload (reset or migrate)")
+	historyEnabled := flag.Bool("history", false, "Keep past API results for GET /api/history")
+	historyTTL := flag.Duration("history-ttl", 90*24*time.Hour, "How long past results are kept in history")
+	historyDB := flag.String("history-db", "", "SQLite file to keep every verification in for /history (off if empty; needs a build with -tags sqlite)")
+	historyDBRetention := flag.Duration("history-db-retention", 90*24*time.Hour, "How long verifications are kept in the history db (0 keeps them)")
+	privacyMode := flag.Bool("privacy-mode", false, "Keep only salted hashes of addresses in history, the history db, cache keys, logs and captures")
+	privacySalt := flag.String("privacy-salt", "", "Salt the -privacy-mode hashes are made with; keep it stable so stored history stays findable")
+	cacheTTL := flag.Duration("cache-ttl", time.Hour, "How long /api/verify answers a repeated verification from its cached result")
+	cacheSize := flag.Int("cache-size", 10000, "Most addresses /api/verify keeps cached results for (off if 0)")
+	smtpCheck := flag.Bool("smtp-check", true, "Probe mail servers over SMTP when a request asks for the smtp check (never if false)")
+	smtpProxy := flag.String("smtp-proxy", "", "SOCKS5 proxy URL SMTP probes go through, unless -profiles-config sets a default profile")
+	smtpHelloName := flag.String("smtp-hello-name", "", "Hostname SMTP probes announce in EHLO, unless -profiles-config sets a default profile (the library's localhost if empty)")
+	smtpFrom := flag.String("smtp-from", "", "Address SMTP probes send as MAIL FROM, unless -profiles-config sets a default profile (the library's user@example.org if empty)")
+	gravatar := flag.Bool("enable-gravatar", false, "Run the gravatar check by default: look up each address's Gravatar and report it in the result's gravatar field")
+	authRecords := flag.Bool("auth-records", false, "Run the auth_records check by default: look up each domain's SPF and DMARC records and report them in the result's dns section (two more DNS queries per domain)")
+	mtaSTS := flag.Bool("mta-sts", false, "Run the mta_sts check by default: look up each domain's MTA-STS policy and TLS-RPT record and report them in the result's dns section (two more DNS queries and an HTTPS fetch per domain)")
+	bimi := flag.Bool("bimi", false, "Run the bimi check by default: look up each domain's BIMI record and report it in the result's dns section (one more DNS query per domain)")
+	dkimProbe := flag.Bool("dkim-probe", false, "Run the dkim check by default: look for DKIM keys under common selectors of each domain and report them in the result's dns section (five more DNS queries per domain)")
+	polite := flag.Bool("polite", true, "Hold SMTP probes to the probing etiquette: one per address per window, a per-minute rate per mail server and a cooldown after a rejected connection")
+	politeAddressWindow := flag.Duration("polite-address-window", verify.DefaultPoliteAddressWindow, "How long an address's SMTP answer is reused instead of probing it again")
+	politeHostRate := flag.Int("polite-host-rate", verify.DefaultPoliteHostRate, "Most SMTP probes per mail server in any minute")
+	politeRejectCooldown := flag.Duration("polite-reject-cooldown", verify.DefaultPoliteRejectCooldown, "How long a mail server that rejected the connection (521 or 554) isn't probed")
+	dnsServers := flag.String("dns-servers", "", "Comma-separated DNS servers (host:port, port 53 if left out) to send lookups to, tried in order, instead of the system resolver")
+	dohURL := flag.String("doh-url", "", "DNS-over-HTTPS (RFC 8484) endpoint to send lookups to instead of the system resolver or -dns-servers, e.g. https://cloudflare-dns.com/dns-query")
+	dohMethod := flag.String("doh-method", "GET", "HTTP method of DNS-over-HTTPS queries: GET or POST")
+	dohFallback := flag.Bool("doh-fallback", false, "Ask the system resolver when a DNS-over-HTTPS lookup fails, though not when it finds the domain doesn't exist")
+	dnsTimeout := flag.Duration("dns-timeout", 0, "Timeout of each DNS lookup, or with -dns-servers of each query to a server (the resolver's own if 0)")
+	dnsCacheMaxTTL := flag.Duration("dns-cache-max-ttl", 5*time.Minute, "Longest a DNS answer is cached; answers are kept for their TTL with -dns-servers and for this long otherwise (off if 0)")
+	smtpSelfTest := flag.Bool("smtp-self-test", true, "Dial well-known mail servers on port 25 at startup and, if none answers, warn in the log, in /health and on results (false for air-gapped deployments)")
+	smtpSelfTestHosts := flag.String("smtp-self-test-hosts", strings.Join(verify.DefaultOutboundProbeHosts, ","), "Comma-separated mail servers (host or host:port) the SMTP self-test dials")
+	smtpSelfTestTimeout := flag.Duration("smtp-self-test-timeout", verify.DefaultOutboundProbeTimeout, "Timeout of each SMTP self-test dial")
+	smtpAttempts := flag.Int("smtp-attempts", 2, "Tries an SMTP probe gets when it fails for a passing reason (refused or reset connection, timeout, 421/450/451), the first included")
+	smtpRetryBackoff := flag.Duration("smtp-retry-backoff", verify.DefaultSMTPRetryBackoff, "Wait before the first SMTP retry, doubled for each later one, with jitter")
+	smtpRetryMaxBackoff := flag.Duration("smtp-retry-max-backoff", verify.DefaultSMTPRetryMaxBackoff, "Longest wait between SMTP retries")
+	smtpMaxMXHosts := flag.Int("smtp-max-mx-hosts", verify.DefaultMaxMXHosts, "Most of a domain's MX hosts a probe tries, in preference order, before giving up")
+	smtpMXHeadStart := flag.Duration("smtp-mx-head-start", 0, "Also dial the second MX host once the first has had this long to connect, keeping whichever answers first (off if 0)")
+	ipPreference := flag.String("ip-preference", verify.IPPreferenceAuto, "Address family of MX hosts dialed first, falling back to the other: auto (alternate), v4 or v6")
+	smtpTLSCheck := flag.Bool("smtp-tls-check", false, "Negotiate STARTTLS during SMTP probes and report it under transport (lengthens each probe)")
+	circuit := flag.Bool("circuit", true, "Stop probing a domain for a cooldown once its SMTP probes keep timing out or failing to connect")
+	circuitFailures := flag.Int("circuit-failures", verify.DefaultCircuitFailures, "Timed out or failed SMTP probes of a domain in a row, within -circuit-window, that open its circuit")
+	circuitWindow := flag.Duration("circuit-window", verify.DefaultCircuitWindow, "How close together a domain's failed SMTP probes must be to open its circuit")
+	circuitCooldown := flag.Duration("circuit-cooldown", verify.DefaultCircuitCooldown, "How long an open circuit keeps a domain from being probed")
+	domainCacheTTL := flag.Duration("domain-cache-ttl", 0, "How long a domain's MX classification and catch-all status are reused by later verifications (off if 0)")
+	mxFallback := flag.Bool("mx-fallback", true, "Probe a domain without MX records at its own address (RFC 5321 implicit MX) before calling it no_mail_service")
+	catchAllCheck := flag.Bool("catch-all-check", true, "Probe each domain for catch-all before its mailboxes (if false, every mailbox is probed and none is marked catch-all)")
+	catchAllProbes := flag.Int("catch-all-probes", verify.DefaultCatchAllProbes, "Random mailboxes the catch-all probe asks about; catch_all_confidence is confirmed when all are accepted and likely when some are")
+	catchAllCacheTTL := flag.Duration("catch-all-cache-ttl", time.Hour, "How long a domain's catch-all status is reused by later verifications (-domain-cache-ttl if 0)")
+	prewarmDomains := flag.Int("prewarm-domains", 0, "Number of the domains most seen in history whose facts are refreshed at startup and on /admin/prewarm (off if 0; needs -history and -domain-cache-ttl)")
+	prewarmWindow := flag.Duration("prewarm-window", 24*time.Hour, "How far back history is counted when picking domains to prewarm")
+	prewarmTimeout := flag.Duration("prewarm-timeout", 30*time.Second, "How long a prewarm run may take before it stops")
+	prewarmProbes := flag.Int("prewarm-probes", 20, "Maximum catch-all probes per prewarm run")
+	prewarmReadyWait := flag.Duration("prewarm-ready-wait", 5*time.Second, "Longest the startup prewarm holds /readyz back")
+	costUnits := flag.String("cost-units", "", "Comma-separated category=units overrides of the cost model, e.g. dns=1,smtp=5")
+	cachedCostPercent := flag.Int("cached-cost-percent", 0, "Percentage of a check's cost charged when its lookup was reused")
+	usageTTL := flag.Duration("usage-ttl", 400*24*time.Hour, "How long per-key daily usage totals are kept")
+	sendCheckMaxStaleness := flag.Duration("send-check-max-staleness", 7*24*time.Hour, "How old a recorded result /api/send-check trusts when the request sets no max_staleness")
+	sendCheckDenyRole := flag.Bool("send-check-deny-role", false, "Deny role accounts (info@, sales@) in /api/send-check")
+	networkDisabled := flag.Bool("network-disabled", false, "Start with the network kill-switch engaged: no DNS, SMTP or outbound HTTP until released via /admin/network")
+	debugErrors := flag.Bool("debug-errors", false, "Log the underlying DNS/SMTP error behind each error code (addresses redacted)")
+	fastLaneSize := flag.Int("fast-lane-size", 64, "Concurrent verifications that need no network")
+	slowLaneSize := flag.Int("slow-lane-size", 32, "Concurrent verifications that query DNS or mail servers")
+	verifyTimeout := flag.Duration("verify-timeout", 15*time.Second, "Longest a single verification may take before answering with what it has (0 for no limit)")
+	maxRequestDeadline := flag.Duration("max-request-deadline", 30*time.Second, "Longest deadline honored from X-Request-Deadline or X-Request-Timeout-Ms")
+	maxSMTPConcurrency := flag.Int("max-smtp-concurrency", 10, "Concurrent verifications that probe mail servers over SMTP")
+	smtpQueueWait := flag.Duration("smtp-queue-wait", 5*time.Second, "How long a request waits for an SMTP slot before getting 429")
+	laneWait := flag.Duration("lane-wait", 10*time.Second, "How long a request waits for a free lane slot before getting 503")
+	consulAddr := flag.String("consul-addr", "", "Consul agent HTTP address to register with, e.g. http://127.0.0.1:8500 (off if empty)")
+	shadowProfile := flag.String("shadow-profile", "", "Profile a sample of live verifications is repeated against for comparison (off if empty)")
+	shadowPercent := flag.Float64("shadow-percent", 1, "Percentage of live verifications repeated against -shadow-profile")
+	shadowBudget := flag.Int("shadow-budget", 60, "Maximum shadow verifications per minute")
+	shadowTTL := flag.Duration("shadow-ttl", 7*24*time.Hour, "How long shadow comparisons are kept")
+	asyncPasteThreshold := flag.Int("ui-async-threshold", 50, "Pasted lists this long or longer are verified as a background job with a progress page")
+	maxPaste := flag.Int("ui-max-paste", 10000, "Maximum number of addresses in one web form paste")
+	maxBulk := flag.Int("max-bulk", 500, "Maximum number of addresses in one /api/verify/bulk request")
+	maxCSVUpload := flag.Int64("max-csv-upload", 10<<20, "Maximum size in bytes of a /api/verify/csv upload")
+	bulkWorkers := flag.Int("bulk-workers", 8, "Addresses of one /api/verify/bulk request verified at once")
+	maxJobEmails := flag.Int("max-job-emails", 100000, "Maximum number of addresses in one /api/jobs submission")
+	jobWorkers := flag.Int("job-workers", 4, "Chunks of one list job verified at once")
+	jobRetryDelay := flag.Duration("job-retry-delay", 0, "Wait before a list job verifies its deferred (4xx) results once more, e.g. 5m; 0 for no retry")
+	jobRetryLimit := flag.Int("job-retry-limit", 1000, "Deferred addresses waiting on a job retry at once, across jobs")
+	domainConcurrency := flag.Int("domain-concurrency", 2, "Most bulk and job verifications probing one destination domain at once (0 for unlimited)")
+	domainRate := flag.Int("domain-rate", 30, "Most bulk and job verifications probing one destination domain started in any minute (0 for unlimited)")
+	domainLimits := flag.String("domain-limits", "", "Comma-separated domain=concurrency/rate overrides of -domain-concurrency and -domain-rate, e.g. yahoo.com=1/20")
+	jobCallbackSecret := flag.String("job-callback-secret", "", "Secret that signs the callbacks of jobs submitted with a callback_url (callbacks refused if empty)")
+	jobCallbackPrivate := flag.Bool("job-callback-private", false, "Let job callbacks reach loopback and private addresses")
+	jobTTL := flag.Duration("job-ttl", time.Hour, "How long finished list jobs stay viewable")
+	planTTL := flag.Duration("plan-ttl", time.Hour, "How long a dry-run batch plan token can be executed")
+	advertiseAddr := flag.String("advertise-addr", "", "Address advertised to service discovery (the agent's address if empty)")
+	flag.Parse()
+
+	var settings map[string]string
+	if *configFile != "" {
+		var err error
+		if settings, err = loadConfigFile(*configFile); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(2)
+		}
+	}
+	if err := applySettings(flag.CommandLine, settings, os.Getenv); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(2)
+	}
+	if *printConfig {
+		writeConfig(os.Stdout, flag.CommandLine)
+		os.Exit(0)
+	}
+
+	logger, err := newLogger(os.Stderr, *logFormat, *logLevel)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(2)
+	}
+	slog.SetDefault(logger)
+
+	// Handle health check
+	if *healthCheck {
+		if err := performHealthCheck(*port); err != nil {
+			fmt.Printf("Health check failed: %v\n", err)
+			os.Exit(1)
+		}
+		if *healthCheckDeep {
+			if err := performSMTPHealthCheck(selfTestHosts(*smtpSelfTestHosts), *smtpSelfTestTimeout); err != nil {
+				fmt.Printf("Health check failed: %v\n", err)
+				os.Exit(1)
+			}
+		}
+		fmt.Println("Health check passed")
+		os.Exit(0)
+	}
+
+	if *noMailVerdict != verify.VerdictRisky && *noMailVerdict != verify.VerdictUndeliverable {
+		log.Fatalf("invalid -no-mail-service-verdict %q: want risky or undeliverable", *noMailVerdict)
+	}
+	if *legacyAddresses != verify.LegacyExtract && *legacyAddresses != verify.LegacyReject {
+		log.Fatalf("invalid -legacy-addresses %q: want extract or reject", *legacyAddresses)
+	}
+
+	keyChecks, err := verify.LoadKeyChecks(*checksConfig)
+	if err != nil {
+		log.Fatal(err)
+	}
+	if *randomnessThreshold <= 0 || *randomnessThreshold > 1 {
+		log.Fatalf("invalid -randomness-threshold %v: want above 0 and at most 1", *randomnessThreshold)
+	}
+	scoreWeights, err := verify.LoadScoreWeights(*scoreConfig)
+	if err != nil {
+		log.Fatal(err)
+	}
+	policies, err := verify.LoadPolicyConfig(*policyConfig)
+	if err != nil {
+		log.Fatal(err)
+	}
+	tenants, err := verify.LoadTenants(*tenantsConfig)
+	if err != nil {
+		log.Fatal(err)
+	}
+	lists, err := verify.LoadCustomLists(map[string]string{
+		verify.ListDisposable: *disposableList,
+		verify.ListFree:       *freeList,
+		verify.ListRole:       *roleList,
+	}, *listOverrides)
+	if err != nil {
+		log.Fatal(err)
+	}
+	rules, err := verify.LoadProviderRules(*providerRules)
+	if err != nil {
+		log.Fatal(err)
+	}
+	signatures, err := verify.LoadMailProviders(*mailProviders)
+	if err != nil {
+		log.Fatal(err)
+	}
+	skipSMTPDomains, err := verify.LoadDomainPatterns(*smtpAllowlist, *smtpAllowlistFile)
+	if err != nil {
+		log.Fatalf("invalid -smtp-allowlist: %v", err)
+	}
+	blockedDomains, err := verify.LoadDomainPatterns(*domainBlocklist, *domainBlocklistFile)
+	if err != nil {
+		log.Fatalf("invalid -domain-blocklist: %v", err)
+	}
+
+	if *profileReloadState != verify.ReloadStateReset && *profileReloadState != verify.ReloadStateMigrate {
+		log.Fatalf("invalid -profile-reload-state %q: want reset or migrate", *profileReloadState)
+	}
+	profileSet, err := verify.LoadProfiles(*profilesConfig)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	defaultSMTP := verify.Profile{Proxy: *smtpProxy, HelloName: *smtpHelloName, FromEmail: *smtpFrom}
+	if err := defaultSMTP.Validate(); err != nil {
+		log.Fatalf("invalid -smtp-hello-name or -smtp-from: %v", err)
+	}
+
+	if *dohURL != "" {
+		if err := verify.ParseDoHURL(*dohURL); err != nil {
+			log.Fatalf("invalid -doh-url: %v", err)
+		}
+	}
+	if *dohMethod != http.MethodGet && *dohMethod != http.MethodPost {
+		log.Fatalf("invalid -doh-method %q: want GET or POST", *dohMethod)
+	}
+	smtpIPPreference, err := verify.ParseIPPreference(*ipPreference)
+	if err != nil {
+		log.Fatalf("invalid -ip-preference: %v", err)
+	}
+
+	units, err := verify.ParseCostUnits(*costUnits)
+	if err != nil {
+		log.Fatal(err)
+	}
+	if *cachedCostPercent < 0 || *cachedCostPercent > 100 {
+		log.Fatalf("invalid -cached-cost-percent %d: want 0 to 100", *cachedCostPercent)
+	}
+
+	service := verify.New(verify.Config{
+		Profiles:             profileSet,
+		ProfileDrain:         *profileDrain,
+		ProfileReloadState:   *profileReloadState,
+		NoMailServiceVerdict: *noMailVerdict,
+		Policies:             policies,
+		ScoreWeights:         &scoreWeights,
+		RandomnessThreshold:  *randomnessThreshold,
+		LegacyAddresses:      *legacyAddresses,
+		KeyChecks:            keyChecks,
+		Tenants:              tenants,
+		Lists:                lists,
+		ProviderRules:        rules,
+		MailProviders:        signatures,
+		SkipSMTPDomains:      skipSMTPDomains,
+		BlockedDomains:       blockedDomains,
+		RetryTokens:          verify.NewRetrySigner([]byte(*retrySecret), *retryWindow),
+		Costs:                verify.CostModel{Units: units, CachedPercent: *cachedCostPercent},
+		DomainCacheTTL:       *domainCacheTTL,
+		CatchAllCacheTTL:     *catchAllCacheTTL,
+		CatchAllDisabled:     !*catchAllCheck,
+		CatchAllProbes:       *catchAllProbes,
+		MXFallbackDisabled:   !*mxFallback,
+		DefaultSMTP:          defaultSMTP,
+		SMTPDisabled:         !*smtpCheck,
+		Polite: verify.PoliteConfig{
+			Off:            !*polite,
+			AddressWindow:  *politeAddressWindow,
+			HostRate:       *politeHostRate,
+			RejectCooldown: *politeRejectCooldown,
+		},
+		Circuit: verify.CircuitConfig{
+			Off:      !*circuit,
+			Failures: *circuitFailures,
+			Window:   *circuitWindow,
+			Cooldown: *circuitCooldown,
+		},
+		Gravatar:    *gravatar,
+		AuthRecords: *authRecords,
+		MTASTS:      *mtaSTS,
+		BIMI:        *bimi,
+		DKIMProbe:   *dkimProbe,
+		SMTPRetry: verify.SMTPRetryConfig{
+			Attempts:   *smtpAttempts,
+			Backoff:    *smtpRetryBackoff,
+			MaxBackoff: *smtpRetryMaxBackoff,
+		},
+		SMTPMaxMXHosts:   *smtpMaxMXHosts,
+		SMTPMXHeadStart:  *smtpMXHeadStart,
+		SMTPIPPreference: smtpIPPreference,
+		TLSCheck:         *smtpTLSCheck,
+		DNS: verify.DNSConfig{
+			Servers:     strings.Split(*dnsServers, ","),
+			DoHURL:      *dohURL,
+			DoHMethod:   *dohMethod,
+			DoHFallback: *dohFallback,
+			Timeout:     *dnsTimeout,
+			CacheMaxTTL: *dnsCacheMaxTTL,
+		},
+		DNSCacheObserver: httpapi.ObserveDNSCache,
+		ProbeObserver:    httpapi.ObserveProbe,
+		RetryObserver:    httpapi.ObserveRetry,
+		VerifyTimeout:    *verifyTimeout,
+		NetworkDisabled:  *networkDisabled,
+		DebugErrors:      *debugErrors,
+	})
+
+	err = httpapi.Start(context.Background(), httpapi.Config{
+		Service:             service,
+		ProfilesConfig:      *profilesConfig,
+		AsyncPasteThreshold: *asyncPasteThreshold,
+		MaxPaste:            *maxPaste,
+		MaxBulk:             *maxBulk,
+		BulkWorkers:         *bulkWorkers,
+		MaxCSVUpload:        *maxCSVUpload,
+		MaxJobEmails:        *maxJobEmails,
+		JobWorkers:          *jobWorkers,
+		JobRetryDelay:       *jobRetryDelay,
+		JobRetryLimit:       *jobRetryLimit,
+		DomainConcurrency:   *domainConcurrency,
+		DomainRate:          *domainRate,
+		DomainLimits:        *domainLimits,
+		JobCallbackSecret:   *jobCallbackSecret,
+		JobCallbackPrivate:  *jobCallbackPrivate,
+		JobTTL:              *jobTTL,
+		PlanTTL:             *planTTL,
+		FastLaneSize:        *fastLaneSize,
+		SlowLaneSize:        *slowLaneSize,
+		LaneWait:            *laneWait,
+		SMTPLaneSize:        *maxSMTPConcurrency,
+		SMTPLaneWait:        *smtpQueueWait,
+		MaxRequestDeadline:  *maxRequestDeadline,
+		WatchWebhook:        *watchWebhook,
+		MaxWatchesPerKey:    *maxWatches,
+		WatchMinInterval:    *watchMinInterval,
+		WatchHistoryTTL:     *watchHistoryTTL,
+		ForwardConfig:       *forwardConfig,
+		ForwardTTL:          *forwardTTL,
+		PseudonymConfig:     *pseudonymConfig,
+		RefResolvers:        *refResolvers,
+		BrandConfig:         *brandConfig,
+		SuppressionSources:  *suppressionSources,
+		CaptureDir:          *captureDir,
+		CaptureTTL:          *captureTTL,
+		History:             *historyEnabled,
+		HistoryTTL:          *historyTTL,
+		HistoryDB:           *historyDB,
+		HistoryDBRetention:  *historyDBRetention,
+		PrivacyMode:         *privacyMode,
+		PrivacySalt:         *privacySalt,
+		CacheSize:           *cacheSize,
+		CacheTTL:            *cacheTTL,
+		PrewarmDomains:      *prewarmDomains,
+		PrewarmWindow:       *prewarmWindow,
+		PrewarmTimeout:      *prewarmTimeout,
+		PrewarmProbes:       *prewarmProbes,
+		PrewarmReadyWait:    *prewarmReadyWait,
+		UsageTTL:            *usageTTL,
+		ShadowProfile:       *shadowProfile,
+		ShadowPercent:       *shadowPercent,
+		ShadowBudget:        *shadowBudget,
+		ShadowTTL:           *shadowTTL,
+		JanitorInterval:     *janitorInterval,
+		GaugeBounds:         *gaugeBounds,
+		LeakCheckInterval:   *leakCheckInterval,
+		AlertRules:          *alertRules,
+		AlertInterval:       *alertInterval,
+
+		SendCheckMaxStaleness: *sendCheckMaxStaleness,
+		SendCheckDenyRole:     *sendCheckDenyRole,
+		BackgroundConcurrency: *backgroundConcurrency,
+		RouteGroups:           *routeGroups,
+		APIKeys:               *apiKeys,
+		APIKeysFile:           *apiKeysFile,
+		RateLimitPerMinute:    *rateLimit,
+		RateLimitBurst:        *rateLimitBurst,
+		TrustedProxies:        *trustedProxies,
+		CORSOrigins:           *corsOrigins,
+	})
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	// Probing through a proxy says nothing about this host's port 25
+	if *smtpSelfTest && *smtpCheck && !*networkDisabled && service.Profiles().Default().Proxy == "" {
+		go runSMTPSelfTest(context.Background(), service, selfTestHosts(*smtpSelfTestHosts), *smtpSelfTestTimeout)
+	}
+
+	// SIGINT and SIGTERM start the drain
+	shutdown, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	registrationDone := make(chan struct{})
+	if *consulAddr != "" {
+		current, _ := service.Profiles().Status()
+		reg, err := newServiceRegistration(*advertiseAddr, *port, current.Profiles)
+		if err != nil {
+			log.Fatal(err)
+		}
+		// Deregistered as the drain starts, so no new traffic is sent
+		go func() {
+			runRegistration(shutdown, newConsulRegistry(*consulAddr), reg)
+			close(registrationDone)
+		}()
+	} else {
+		close(registrationDone)
+	}
+
+	ln, err := net.Listen("tcp", ":"+*port)
+	if err != nil {
+		log.Fatal(err)
+	}
+	srv := newServer(httpapi.Handler(), serverTimeouts{ReadHeader: *readHeaderTimeout, Write: *writeTimeout, Idle: *idleTimeout})
+	slog.Info("🚀 Email Verifier Server starting", "url", "http://localhost:"+*port)
+	if err := serve(shutdown, srv, ln, *drainTimeout); err != nil {
+		log.Fatal(err)
+	}
+	<-registrationDone
+	slog.Info("Server stopped")
+}
+
+func performHealthCheck(port string) error {
+	resp, err := http.Get("http://localhost:" + port + "/health")
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("health check returned status %d", resp.StatusCode)
+	}
+	return nil
+}
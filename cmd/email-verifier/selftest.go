@@ -0,0 +1,47 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"strings"
+	"time"
+
+	"email-verifier/pkg/verify"
+)
+
+// selfTestHosts splits the -smtp-self-test-hosts list.
+func selfTestHosts(list string) []string {
+	var hosts []string
+	for _, host := range strings.Split(list, ",") {
+		if host = strings.TrimSpace(host); host != "" {
+			hosts = append(hosts, host)
+		}
+	}
+	return hosts
+}
+
+// runSMTPSelfTest dials hosts on port 25 and tells service whether none
+// could be reached, warning loudly if so. Most cloud VMs block port 25,
+// and otherwise the only symptom is every result coming back reachable
+// unknown.
+func runSMTPSelfTest(ctx context.Context, service *verify.Service, hosts []string, timeout time.Duration) {
+	report := verify.CheckOutboundSMTP(ctx, hosts, timeout, nil)
+	service.SetSMTPOutboundBlocked(report.Blocked)
+	if !report.Blocked {
+		slog.Debug("SMTP self-test reached a mail server on port 25")
+		return
+	}
+	slog.Warn("⚠️  OUTBOUND PORT 25 LOOKS BLOCKED: no well-known mail server could be reached, so SMTP results will be unknown. "+
+		"Probe through -smtp-proxy or from a host that allows port 25, or start with -smtp-self-test=false if this is expected.",
+		"failures", report.Failures())
+}
+
+// performSMTPHealthCheck is the deep part of -health-check: it fails when
+// none of hosts can be reached on port 25.
+func performSMTPHealthCheck(hosts []string, timeout time.Duration) error {
+	if report := verify.CheckOutboundSMTP(context.Background(), hosts, timeout, nil); report.Blocked {
+		return fmt.Errorf("outbound port 25 blocked (%s)", report.Failures())
+	}
+	return nil
+}
@@ -0,0 +1,56 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/http"
+	"time"
+
+	"email-verifier/internal/httpapi"
+)
+
+// serverTimeouts bound how long a client may take over each part of a
+// request, so a slow client can't hold a connection open indefinitely.
+type serverTimeouts struct {
+	ReadHeader time.Duration
+	Write      time.Duration
+	Idle       time.Duration
+}
+
+func newServer(handler http.Handler, t serverTimeouts) *http.Server {
+	return &http.Server{
+		Handler:           handler,
+		ReadHeaderTimeout: t.ReadHeader,
+		WriteTimeout:      t.Write,
+		IdleTimeout:       t.Idle,
+	}
+}
+
+// serve runs srv on ln until ctx is done, then drains it: /health and
+// /readyz answer 503, no new connections are accepted and in-flight
+// requests get up to drain to finish before their connections are closed.
+func serve(ctx context.Context, srv *http.Server, ln net.Listener, drain time.Duration) error {
+	served := make(chan error, 1)
+	go func() { served <- srv.Serve(ln) }()
+	select {
+	case err := <-served:
+		return err
+	case <-ctx.Done():
+	}
+
+	httpapi.Drain()
+	slog.Info("Shutting down, draining in-flight requests", "drain", drain)
+	drainCtx, cancel := context.WithTimeout(context.Background(), drain)
+	defer cancel()
+	if err := srv.Shutdown(drainCtx); err != nil {
+		srv.Close()
+		return fmt.Errorf("in-flight requests still running after %s: %w", drain, err)
+	}
+	if err := <-served; !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,7 @@
+//go:build sqlite
+
+package main
+
+// modernc.org/sqlite is the history db's driver. It is pure Go but large,
+// so only servers built with -tags sqlite link it in; see -history-db.
+import _ "modernc.org/sqlite"
@@ -0,0 +1,110 @@
+package httpapi
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+
+	"email-verifier/pkg/verify"
+)
+
+func adminVerifierReloadHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if err := service.Reload(); err != nil {
+		http.Error(w, "Reload failed: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func adminProfilesHandler(w http.ResponseWriter, r *http.Request) {
+	profiles := service.Profiles()
+	current, draining := profiles.Status()
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"current":       current,
+		"draining":      draining,
+		"reload_policy": profiles.Policy(),
+		"drain_timeout": profiles.Drain().String(),
+	})
+}
+
+// adminTenantsHandler lists the configured tenants. Keys no tenant lists
+// share the default tenant.
+func adminTenantsHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"default_tenant": verify.DefaultTenant,
+		"tenants":        service.Tenants(),
+	})
+}
+
+func adminProfilesReloadHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	set, err := verify.LoadProfiles(profilesConfigPath)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	generation := service.Profiles().Reload(set)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"generation": generation,
+	})
+}
+
+// adminListsHandler describes the overlay on the disposable, free and role
+// lists.
+func adminListsHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"lists": service.Lists().Summary(),
+	})
+}
+
+// adminListEntryHandler puts a value on a list with PUT, or takes it off
+// with DELETE, overriding the built-in lists and the list files.
+func adminListEntryHandler(w http.ResponseWriter, r *http.Request) {
+	var on bool
+	switch r.Method {
+	case http.MethodPut:
+		on = true
+	case http.MethodDelete:
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	list := r.PathValue("list")
+	entry, err := service.Lists().Set(list, r.PathValue("value"), on)
+	switch {
+	case errors.Is(err, verify.ErrUnknownList):
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	case errors.Is(err, verify.ErrInvalidListEntry):
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	case err != nil:
+		log.Printf("Failed to change the %s list: %v", list, err)
+		http.Error(w, "The change could not be saved", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"list":   list,
+		"entry":  entry,
+		"listed": on,
+	})
+}
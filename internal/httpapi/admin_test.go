@@ -0,0 +1,67 @@
+package httpapi
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"email-verifier/pkg/verify"
+	"email-verifier/pkg/verify/verifytest"
+)
+
+// TestAdminLists tests that list entries changed at runtime apply to verifications and show in the listing
+func TestAdminLists(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "overrides.json")
+	useService(t, verify.Config{Resolver: verifytest.NewResolver(), Lists: verify.NewCustomLists(path)})
+	mux := http.NewServeMux()
+	mux.HandleFunc("/api/admin/lists", adminListsHandler)
+	mux.HandleFunc("/api/admin/lists/{list}/{value}", adminListEntryHandler)
+	send := func(method, target string) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		mux.ServeHTTP(rec, httptest.NewRequest(method, target, nil))
+		return rec
+	}
+
+	testCases := []struct {
+		method, path string
+		status       int
+	}{
+		{http.MethodPut, "/api/admin/lists/disposable/Burner.mock", http.StatusOK},
+		{http.MethodDelete, "/api/admin/lists/disposable/mailinator.com", http.StatusOK},
+		{http.MethodPut, "/api/admin/lists/role/billing", http.StatusOK},
+		{http.MethodPut, "/api/admin/lists/spam/burner.mock", http.StatusNotFound},
+		{http.MethodPut, "/api/admin/lists/role/jane@acme.mock", http.StatusBadRequest},
+		{http.MethodPost, "/api/admin/lists/role/billing", http.StatusMethodNotAllowed},
+	}
+	for _, tc := range testCases {
+		if rec := send(tc.method, tc.path); rec.Code != tc.status {
+			t.Errorf("Expected status %d for %s %s, got %d %s", tc.status, tc.method, tc.path, rec.Code, rec.Body)
+		}
+	}
+
+	opts := verify.Options{Checks: verify.DefaultChecks.WithoutNetwork()}
+	if !service.Verify("billing@burner.mock", opts).Disposable || !service.Verify("billing@burner.mock", opts).RoleAccount {
+		t.Error("Expected the added entries to apply")
+	}
+	if service.Verify("jane@mailinator.com", opts).Disposable {
+		t.Error("Expected mailinator.com to be taken off the disposable list")
+	}
+
+	var body struct {
+		Lists map[string]verify.ListSummary `json:"lists"`
+	}
+	rec := send(http.MethodGet, "/api/admin/lists")
+	json.Unmarshal(rec.Body.Bytes(), &body)
+	if d := body.Lists[verify.ListDisposable]; d.Added != 1 || d.Removed != 1 || d.ModifiedAt == nil {
+		t.Errorf("Expected 1 added and 1 removed disposable domain, got %+v", d)
+	}
+	if !strings.Contains(rec.Body.String(), `"free":{"from_file":0,"added":0,"removed":0}`) {
+		t.Errorf("Expected an untouched free list, got %s", rec.Body)
+	}
+	if reloaded, err := verify.LoadCustomLists(nil, path); err != nil || reloaded.Summary()[verify.ListRole].Added != 1 {
+		t.Errorf("Expected the overrides saved to disk, got %v", err)
+	}
+}
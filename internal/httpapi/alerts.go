@@ -0,0 +1,479 @@
+package httpapi
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"email-verifier/pkg/verify"
+)
+
+// maxAlertWindow is the longest window a rate rule can look back over, and
+// so how long verification outcomes are kept for alerting.
+const maxAlertWindow = time.Hour
+
+// Alert statuses, as reported in /admin/state.
+const (
+	alertFiring   = "firing"
+	alertResolved = "resolved"
+)
+
+// alertSample is one value of an alert metric. Metrics split by provider
+// or budget give one sample per label; Samples is how many verifications a
+// rate was computed from.
+type alertSample struct {
+	Label   string
+	Value   float64
+	Samples int
+}
+
+// alertMetric reads a metric for the rules that name it. Rate metrics are
+// read over the rule's window and need its min_samples verifications.
+type alertMetric struct {
+	rate bool
+	read func(window time.Duration) []alertSample
+}
+
+// builtinAlertMetrics are the metrics rules can name.
+func builtinAlertMetrics() map[string]alertMetric {
+	return map[string]alertMetric{
+		// Percentage of API verifications that failed on DNS, SMTP, the
+		// verifier or their deadline; bad input doesn't count
+		"error_rate": {rate: true, read: func(window time.Duration) []alertSample {
+			var total outcomeCounts
+			for _, c := range outcomes.Counts(window) {
+				total.add(c)
+			}
+			return []alertSample{total.sample("", total.errors)}
+		}},
+		// Percentage of API verifications with an unknown verdict, per
+		// address domain
+		"unknown_rate": {rate: true, read: func(window time.Duration) []alertSample {
+			var samples []alertSample
+			for domain, c := range outcomes.Counts(window) {
+				if domain != "" {
+					samples = append(samples, c.sample(domain, c.unknown))
+				}
+			}
+			return samples
+		}},
+		// Hours since the disposable and free provider lists were loaded
+		"disposable_list_age_hours": {read: func(time.Duration) []alertSample {
+			loadedAt, ok := service.ListsLoadedAt()
+			if !ok {
+				return nil
+			}
+			return []alertSample{{Value: time.Since(loadedAt).Hours(), Samples: 1}}
+		}},
+		// Percentage of this minute's probe budget spent, per budget
+		"probe_budget_used": {read: func(time.Duration) []alertSample {
+			if shadow == nil {
+				return nil
+			}
+			return []alertSample{{Label: "shadow", Value: shadow.BudgetUsed(), Samples: 1}}
+		}},
+	}
+}
+
+// outcomeCounts counts verification outcomes.
+type outcomeCounts struct {
+	total, errors, unknown int
+}
+
+func (c *outcomeCounts) add(o outcomeCounts) {
+	c.total += o.total
+	c.errors += o.errors
+	c.unknown += o.unknown
+}
+
+// sample returns n as a percentage of c's verifications.
+func (c outcomeCounts) sample(label string, n int) alertSample {
+	s := alertSample{Label: label, Samples: c.total}
+	if c.total > 0 {
+		s.Value = 100 * float64(n) / float64(c.total)
+	}
+	return s
+}
+
+// inputErrorCodes are the error codes caused by what the caller sent rather
+// than by the server or the mail servers it asked.
+var inputErrorCodes = map[string]bool{
+	verify.ErrCodeEmailRequired:        true,
+	verify.ErrCodeInvalidSyntax:        true,
+	verify.ErrCodeAmbiguousLegacyRoute: true,
+	verify.ErrCodeLegacyNotAccepted:    true,
+	verify.ErrCodeRefNotFound:          true,
+}
+
+// outcomeTracker counts API verification outcomes per minute and address
+// domain, for the last maxAlertWindow.
+type outcomeTracker struct {
+	mu      sync.Mutex
+	buckets map[int64]map[string]*outcomeCounts // by minute, then domain
+	now     func() time.Time
+}
+
+var outcomes = newOutcomeTracker()
+
+func newOutcomeTracker() *outcomeTracker {
+	return &outcomeTracker{buckets: make(map[int64]map[string]*outcomeCounts), now: time.Now}
+}
+
+// Record counts one verification's outcome.
+func (t *outcomeTracker) Record(result *verify.Result) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	minute := t.now().Unix() / 60
+	for m := range t.buckets {
+		if m <= minute-int64(maxAlertWindow/time.Minute) {
+			delete(t.buckets, m)
+		}
+	}
+	bucket := t.buckets[minute]
+	if bucket == nil {
+		bucket = make(map[string]*outcomeCounts)
+		t.buckets[minute] = bucket
+	}
+	domain := strings.ToLower(result.Domain)
+	c := bucket[domain]
+	if c == nil {
+		c = &outcomeCounts{}
+		bucket[domain] = c
+	}
+	c.total++
+	if result.ErrorCode != "" && !inputErrorCodes[result.ErrorCode] {
+		c.errors++
+	}
+	if result.Verdict == verify.VerdictUnknown {
+		c.unknown++
+	}
+}
+
+// Counts returns the outcomes within window of now, per address domain.
+// Windows are counted in whole minutes, including the current one.
+func (t *outcomeTracker) Counts(window time.Duration) map[string]outcomeCounts {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	minute := t.now().Unix() / 60
+	first := minute - int64((window+time.Minute-1)/time.Minute) + 1
+	counts := make(map[string]outcomeCounts)
+	for m, bucket := range t.buckets {
+		if m < first || m > minute {
+			continue
+		}
+		for domain, c := range bucket {
+			sum := counts[domain]
+			sum.add(*c)
+			counts[domain] = sum
+		}
+	}
+	return counts
+}
+
+// alertConfig is the JSON file of alert rules. Alerts fire to Notify, a
+// webhook or Slack URL, or are only logged if it is empty.
+type alertConfig struct {
+	Notify string       `json:"notify,omitempty"`
+	Rules  []*alertRule `json:"rules"`
+
+	notifier notifier
+}
+
+// alertRule fires while a metric is above a threshold. Label restricts a
+// split metric to one provider or budget; without it every label is
+// alerted on separately.
+type alertRule struct {
+	Name       string  `json:"name"`
+	Metric     string  `json:"metric"`
+	Label      string  `json:"label,omitempty"`
+	Above      float64 `json:"above"`
+	Window     string  `json:"window,omitempty"`      // rate metrics only, 5m by default
+	MinSamples int     `json:"min_samples,omitempty"` // rate metrics only, 1 by default
+
+	window time.Duration
+}
+
+// loadAlertConfig reads and validates an alert rules file.
+func loadAlertConfig(path string, known map[string]alertMetric) (*alertConfig, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var cfg alertConfig
+	if err := json.Unmarshal(data, &cfg); err != nil {
+		return nil, fmt.Errorf("parse alert rules %s: %v", path, err)
+	}
+	if cfg.notifier, err = newNotifier(cfg.Notify); err != nil {
+		return nil, fmt.Errorf("alert rules %s: %v", path, err)
+	}
+	names := make(map[string]bool, len(cfg.Rules))
+	for i, rule := range cfg.Rules {
+		if rule.Name == "" {
+			return nil, fmt.Errorf("alert rules %s: rule %d needs a name", path, i+1)
+		}
+		if names[rule.Name] {
+			return nil, fmt.Errorf("alert rules %s: duplicate rule %q", path, rule.Name)
+		}
+		names[rule.Name] = true
+		metric, ok := known[rule.Metric]
+		if !ok {
+			return nil, fmt.Errorf("alert rules %s: rule %q has unknown metric %q: want %s", path, rule.Name, rule.Metric, strings.Join(sortedKeys(known), ", "))
+		}
+		if rule.Above < 0 {
+			return nil, fmt.Errorf("alert rules %s: rule %q has negative threshold %v", path, rule.Name, rule.Above)
+		}
+		if !metric.rate {
+			if rule.Window != "" || rule.MinSamples != 0 {
+				return nil, fmt.Errorf("alert rules %s: rule %q sets window or min_samples, but %s is not a rate", path, rule.Name, rule.Metric)
+			}
+			continue
+		}
+		rule.window = 5 * time.Minute
+		if rule.Window != "" {
+			rule.window, err = time.ParseDuration(rule.Window)
+			if err != nil || rule.window < time.Minute || rule.window > maxAlertWindow {
+				return nil, fmt.Errorf("alert rules %s: rule %q has invalid window %q: want a duration from 1m to %v", path, rule.Name, rule.Window, maxAlertWindow)
+			}
+		}
+		if rule.MinSamples < 0 {
+			return nil, fmt.Errorf("alert rules %s: rule %q has negative min_samples", path, rule.Name)
+		}
+	}
+	return &cfg, nil
+}
+
+func sortedKeys(m map[string]alertMetric) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// alertState is an alert that is firing, or resolved and not yet
+// announced.
+type alertState struct {
+	Rule      string    `json:"rule"`
+	Metric    string    `json:"metric"`
+	Label     string    `json:"label,omitempty"`
+	Status    string    `json:"status"`
+	Value     float64   `json:"value"`
+	Threshold float64   `json:"threshold"`
+	Since     time.Time `json:"since"`
+	Notified  bool      `json:"notified"` // Status has been announced
+}
+
+// alertEvaluator checks the rules on a ticker and announces each alert
+// once when it starts firing and once when it resolves. An announcement
+// that fails, or is held back by the network kill-switch, is retried on
+// the next evaluation.
+type alertEvaluator struct {
+	path    string
+	metrics map[string]alertMetric
+
+	evalMu sync.Mutex // serializes Evaluate
+	mu     sync.Mutex
+	config *alertConfig
+	states map[string]*alertState // by rule name and label
+	loaded time.Time
+	now    func() time.Time
+}
+
+// alerts is nil unless -alert-rules is set.
+var alerts *alertEvaluator
+
+func newAlertEvaluator(path string, metrics map[string]alertMetric) (*alertEvaluator, error) {
+	a := &alertEvaluator{path: path, metrics: metrics, states: make(map[string]*alertState), now: time.Now}
+	if err := a.Reload(); err != nil {
+		return nil, err
+	}
+	return a, nil
+}
+
+// Reload re-reads the rules file. On error the current rules stay. Alerts
+// of rules that are gone are dropped without a resolve notification.
+func (a *alertEvaluator) Reload() error {
+	cfg, err := loadAlertConfig(a.path, a.metrics)
+	if err != nil {
+		return err
+	}
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	kept := make(map[string]bool, len(cfg.Rules))
+	for _, rule := range cfg.Rules {
+		kept[rule.Name] = true
+	}
+	for key, state := range a.states {
+		if !kept[state.Rule] {
+			log.Printf("alert: dropping %s, its rule was removed", key)
+			delete(a.states, key)
+		}
+	}
+	a.config, a.loaded = cfg, a.now()
+	return nil
+}
+
+// Evaluate checks every rule and sends the announcements due.
+func (a *alertEvaluator) Evaluate(ctx context.Context) error {
+	a.evalMu.Lock()
+	defer a.evalMu.Unlock()
+
+	a.mu.Lock()
+	cfg := a.config
+	a.mu.Unlock()
+
+	// Read the metrics before taking the lock, as they take their own
+	type reading struct {
+		rule    *alertRule
+		samples []alertSample
+	}
+	readings := make([]reading, 0, len(cfg.Rules))
+	for _, rule := range cfg.Rules {
+		var samples []alertSample
+		for _, s := range a.metrics[rule.Metric].read(rule.window) {
+			if rule.Label == "" || s.Label == rule.Label {
+				samples = append(samples, s)
+			}
+		}
+		readings = append(readings, reading{rule, samples})
+	}
+
+	a.mu.Lock()
+	now := a.now().UTC()
+	for _, r := range readings {
+		firing := make(map[string]bool)
+		for _, s := range r.samples {
+			if s.Samples < max(r.rule.MinSamples, 1) || s.Value <= r.rule.Above {
+				continue
+			}
+			key := r.rule.Name + "/" + s.Label
+			firing[key] = true
+			state := a.states[key]
+			if state == nil || state.Status != alertFiring {
+				state = &alertState{Rule: r.rule.Name, Metric: r.rule.Metric, Label: s.Label, Status: alertFiring, Since: now}
+				a.states[key] = state
+			}
+			state.Value, state.Threshold = s.Value, r.rule.Above
+		}
+		// Alerts of this rule that are no longer above the threshold, or
+		// have no data any more, resolve
+		for key, state := range a.states {
+			if state.Rule == r.rule.Name && state.Status == alertFiring && !firing[key] {
+				state.Status, state.Since, state.Notified = alertResolved, now, false
+				state.Value = 0
+				for _, s := range r.samples {
+					if s.Label == state.Label {
+						state.Value = s.Value
+					}
+				}
+			}
+		}
+	}
+	var due []alertState
+	for _, state := range a.states {
+		if !state.Notified {
+			due = append(due, *state)
+		}
+	}
+	a.mu.Unlock()
+
+	sort.Slice(due, func(i, j int) bool { return due[i].Rule+"/"+due[i].Label < due[j].Rule+"/"+due[j].Label })
+	var errs []error
+	for _, state := range due {
+		if err := a.announce(ctx, cfg, state); err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		a.mu.Lock()
+		key := state.Rule + "/" + state.Label
+		if current := a.states[key]; current != nil && current.Status == state.Status && current.Since.Equal(state.Since) {
+			current.Notified = true
+			if current.Status == alertResolved {
+				delete(a.states, key)
+			}
+		}
+		a.mu.Unlock()
+	}
+	return errors.Join(errs...)
+}
+
+// errAlertsHeld is returned while the network kill-switch holds alert
+// notifications back.
+var errAlertsHeld = errors.New("alert notifications held: network disabled")
+
+func (a *alertEvaluator) announce(ctx context.Context, cfg *alertConfig, state alertState) error {
+	subject := fmt.Sprintf("Alert %s %s", state.Rule, state.Status)
+	if state.Label != "" {
+		subject = fmt.Sprintf("Alert %s %s for %s", state.Rule, state.Status, state.Label)
+	}
+	text := fmt.Sprintf("%s is %.4g (threshold %.4g)", state.Metric, state.Value, state.Threshold)
+	log.Printf("alert: %s: %s", subject, text)
+	if cfg.notifier == nil {
+		return nil
+	}
+	if service.NetworkDisabled() {
+		return errAlertsHeld
+	}
+	err := cfg.notifier.Notify(ctx, notification{
+		Event:   "alert." + state.Status,
+		Subject: subject,
+		Text:    text,
+		Data:    state,
+	})
+	if err != nil {
+		return fmt.Errorf("alert %s: notification failed: %v", state.Rule, err)
+	}
+	return nil
+}
+
+// alertStatus is the evaluator's state for /admin/state.
+type alertStatus struct {
+	Rules    int          `json:"rules"`
+	LoadedAt time.Time    `json:"loaded_at"`
+	Alerts   []alertState `json:"alerts"`
+}
+
+// Status returns the loaded rules count and every firing or unannounced
+// alert, or nil if alerting is off.
+func (a *alertEvaluator) Status() *alertStatus {
+	if a == nil {
+		return nil
+	}
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	status := &alertStatus{Rules: len(a.config.Rules), LoadedAt: a.loaded.UTC(), Alerts: make([]alertState, 0, len(a.states))}
+	for _, state := range a.states {
+		status.Alerts = append(status.Alerts, *state)
+	}
+	sort.Slice(status.Alerts, func(i, j int) bool {
+		return status.Alerts[i].Rule+"/"+status.Alerts[i].Label < status.Alerts[j].Rule+"/"+status.Alerts[j].Label
+	})
+	return status
+}
+
+// adminAlertsReloadHandler re-reads the alert rules file.
+func adminAlertsReloadHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if alerts == nil {
+		http.Error(w, "Alerting is not configured (set -alert-rules)", http.StatusNotFound)
+		return
+	}
+	if err := alerts.Reload(); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(alerts.Status())
+}
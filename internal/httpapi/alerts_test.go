@@ -0,0 +1,312 @@
+package httpapi
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"email-verifier/pkg/verify"
+)
+
+// fakeAlertMetrics serves injected values for an error rate and a per-provider unknown rate
+type fakeAlertMetrics struct {
+	mu      sync.Mutex
+	errors  alertSample
+	unknown []alertSample
+}
+
+func (f *fakeAlertMetrics) set(fn func()) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	fn()
+}
+
+func (f *fakeAlertMetrics) metrics() map[string]alertMetric {
+	return map[string]alertMetric{
+		"error_rate": {rate: true, read: func(time.Duration) []alertSample {
+			f.mu.Lock()
+			defer f.mu.Unlock()
+			return []alertSample{f.errors}
+		}},
+		"unknown_rate": {rate: true, read: func(time.Duration) []alertSample {
+			f.mu.Lock()
+			defer f.mu.Unlock()
+			return append([]alertSample(nil), f.unknown...)
+		}},
+		"disposable_list_age_hours": {read: func(time.Duration) []alertSample { return nil }},
+	}
+}
+
+// alertWebhook records the notifications it receives, failing while fail is set
+type alertWebhook struct {
+	*httptest.Server
+	mu     sync.Mutex
+	events []notification
+	fail   bool
+}
+
+func newAlertWebhook(t *testing.T) *alertWebhook {
+	hook := &alertWebhook{}
+	hook.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hook.mu.Lock()
+		defer hook.mu.Unlock()
+		if hook.fail {
+			w.WriteHeader(http.StatusBadGateway)
+			return
+		}
+		var n notification
+		json.NewDecoder(r.Body).Decode(&n)
+		hook.events = append(hook.events, n)
+	}))
+	t.Cleanup(hook.Close)
+	return hook
+}
+
+func (h *alertWebhook) setFail(fail bool) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.fail = fail
+}
+
+func (h *alertWebhook) take() []string {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	var subjects []string
+	for _, n := range h.events {
+		subjects = append(subjects, n.Event+": "+n.Subject)
+	}
+	h.events = nil
+	return subjects
+}
+
+// writeAlertRules writes an alert rules file and returns its path
+func writeAlertRules(t *testing.T, dir, rules string) string {
+	t.Helper()
+	path := filepath.Join(dir, "alerts.json")
+	if err := os.WriteFile(path, []byte(rules), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+// useAlerts installs an evaluator over fake metrics firing to a test webhook
+func useAlerts(t *testing.T, rules string) (*alertEvaluator, *fakeAlertMetrics, *alertWebhook) {
+	t.Helper()
+	useService(t, verify.Config{})
+	hook := newAlertWebhook(t)
+	fake := &fakeAlertMetrics{}
+	path := writeAlertRules(t, t.TempDir(), strings.ReplaceAll(rules, "$NOTIFY", hook.URL))
+	a, err := newAlertEvaluator(path, fake.metrics())
+	if err != nil {
+		t.Fatalf("Failed to load alert rules: %v", err)
+	}
+	saved := alerts
+	alerts = a
+	t.Cleanup(func() { alerts = saved })
+	return a, fake, hook
+}
+
+const testAlertRules = `{"notify": "$NOTIFY", "rules": [
+	{"name": "errors", "metric": "error_rate", "above": 5, "min_samples": 10},
+	{"name": "unknowns", "metric": "unknown_rate", "above": 20},
+	{"name": "gmail_unknowns", "metric": "unknown_rate", "label": "gmail.com", "above": 50}
+]}`
+
+// TestAlertFiresOnceAndResolves tests that an alert is announced when it starts firing and when it resolves, and not in between
+func TestAlertFiresOnceAndResolves(t *testing.T) {
+	a, fake, hook := useAlerts(t, testAlertRules)
+	ctx := context.Background()
+
+	fake.set(func() { fake.errors = alertSample{Value: 12, Samples: 5} })
+	a.Evaluate(ctx)
+	if got := hook.take(); len(got) != 0 {
+		t.Errorf("Expected no alert below min_samples, got %v", got)
+	}
+
+	fake.set(func() { fake.errors = alertSample{Value: 12, Samples: 40} })
+	a.Evaluate(ctx)
+	a.Evaluate(ctx)
+	if got := hook.take(); len(got) != 1 || got[0] != "alert.firing: Alert errors firing" {
+		t.Errorf("Expected one firing notification, got %v", got)
+	}
+	status := a.Status()
+	if len(status.Alerts) != 1 || status.Alerts[0].Status != alertFiring || status.Alerts[0].Value != 12 || !status.Alerts[0].Notified {
+		t.Errorf("Expected the firing alert in the status, got %+v", status.Alerts)
+	}
+
+	fake.set(func() { fake.errors = alertSample{Value: 2, Samples: 40} })
+	a.Evaluate(ctx)
+	a.Evaluate(ctx)
+	if got := hook.take(); len(got) != 1 || got[0] != "alert.resolved: Alert errors resolved" {
+		t.Errorf("Expected one resolve notification, got %v", got)
+	}
+	if status := a.Status(); len(status.Alerts) != 0 {
+		t.Errorf("Expected no alerts once resolved, got %+v", status.Alerts)
+	}
+}
+
+// TestAlertLabels tests that split metrics alert per label and that a label rule only watches its own
+func TestAlertLabels(t *testing.T) {
+	a, fake, hook := useAlerts(t, testAlertRules)
+	fake.set(func() {
+		fake.unknown = []alertSample{{Label: "gmail.com", Value: 30, Samples: 8}, {Label: "yahoo.com", Value: 60, Samples: 3}, {Label: "aol.com", Value: 1, Samples: 50}}
+	})
+	a.Evaluate(context.Background())
+
+	got := hook.take()
+	want := []string{
+		"alert.firing: Alert unknowns firing for gmail.com",
+		"alert.firing: Alert unknowns firing for yahoo.com",
+	}
+	if strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Errorf("Expected %v, got %v", want, got)
+	}
+}
+
+// TestAlertNotificationRetried tests that a failed or held announcement is sent on a later evaluation
+func TestAlertNotificationRetried(t *testing.T) {
+	a, fake, hook := useAlerts(t, testAlertRules)
+	fake.set(func() { fake.errors = alertSample{Value: 50, Samples: 100} })
+
+	hook.setFail(true)
+	if err := a.Evaluate(context.Background()); err == nil {
+		t.Error("Expected the failed notification to be reported")
+	}
+	if status := a.Status(); status.Alerts[0].Notified {
+		t.Error("Expected the alert to stay unannounced")
+	}
+
+	hook.setFail(false)
+	service.SetNetworkDisabled(true)
+	if err := a.Evaluate(context.Background()); !errors.Is(err, errAlertsHeld) {
+		t.Errorf("Expected notifications held by the kill-switch, got %v", err)
+	}
+	service.SetNetworkDisabled(false)
+
+	if err := a.Evaluate(context.Background()); err != nil {
+		t.Fatalf("Expected the notification to go out, got %v", err)
+	}
+	if got := hook.take(); len(got) != 1 {
+		t.Errorf("Expected one firing notification, got %v", got)
+	}
+}
+
+// TestLoadAlertConfig tests that rule files are validated at load
+func TestLoadAlertConfig(t *testing.T) {
+	known := (&fakeAlertMetrics{}).metrics()
+	testCases := []struct {
+		name  string
+		rules string
+		err   string
+	}{
+		{"valid", `{"rules": [{"name": "a", "metric": "error_rate", "above": 5, "window": "15m"}, {"name": "b", "metric": "disposable_list_age_hours", "above": 48}]}`, ""},
+		{"unknown metric", `{"rules": [{"name": "a", "metric": "latency", "above": 5}]}`, `unknown metric "latency"`},
+		{"duplicate", `{"rules": [{"name": "a", "metric": "error_rate"}, {"name": "a", "metric": "error_rate"}]}`, `duplicate rule "a"`},
+		{"unnamed", `{"rules": [{"metric": "error_rate"}]}`, "rule 1 needs a name"},
+		{"window too long", `{"rules": [{"name": "a", "metric": "error_rate", "window": "2h"}]}`, "invalid window"},
+		{"window on a gauge", `{"rules": [{"name": "a", "metric": "disposable_list_age_hours", "window": "5m"}]}`, "is not a rate"},
+		{"negative threshold", `{"rules": [{"name": "a", "metric": "error_rate", "above": -1}]}`, "negative threshold"},
+		{"bad notify URL", `{"notify": "ftp://alerts", "rules": []}`, "invalid notification URL"},
+	}
+	dir := t.TempDir()
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			cfg, err := loadAlertConfig(writeAlertRules(t, dir, tc.rules), known)
+			if tc.err == "" {
+				if err != nil {
+					t.Fatalf("Expected the rules to load, got %v", err)
+				}
+				if cfg.Rules[0].window != 15*time.Minute {
+					t.Errorf("Expected the 15m window, got %v", cfg.Rules[0].window)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tc.err) {
+				t.Errorf("Expected an error containing %q, got %v", tc.err, err)
+			}
+		})
+	}
+}
+
+// TestAdminAlertsReload tests hot reloading the rules, keeping the current ones when the file is invalid
+func TestAdminAlertsReload(t *testing.T) {
+	a, fake, _ := useAlerts(t, testAlertRules)
+	fake.set(func() {
+		fake.errors = alertSample{Value: 50, Samples: 100}
+		fake.unknown = []alertSample{{Label: "gmail.com", Value: 90, Samples: 10}}
+	})
+	a.Evaluate(context.Background())
+
+	reload := func() *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		adminAlertsReloadHandler(rec, httptest.NewRequest(http.MethodPost, "/admin/alerts/reload", nil))
+		return rec
+	}
+
+	writeAlertRules(t, filepath.Dir(a.path), `{"rules": [{"name": "errors", "metric": "error_rat"}]}`)
+	if rec := reload(); rec.Code != http.StatusBadRequest || a.Status().Rules != 3 {
+		t.Errorf("Expected status 400 keeping 3 rules, got %d with %d", rec.Code, a.Status().Rules)
+	}
+
+	writeAlertRules(t, filepath.Dir(a.path), `{"rules": [{"name": "errors", "metric": "error_rate", "above": 5}]}`)
+	rec := reload()
+	var status alertStatus
+	json.NewDecoder(rec.Body).Decode(&status)
+	if rec.Code != http.StatusOK || status.Rules != 1 || len(status.Alerts) != 1 || status.Alerts[0].Rule != "errors" {
+		t.Errorf("Expected one rule with its alert kept, got %d %+v", rec.Code, status)
+	}
+
+	rec = httptest.NewRecorder()
+	adminStateHandler(rec, httptest.NewRequest(http.MethodGet, "/admin/state", nil))
+	var state struct{ Alerts *alertStatus }
+	json.NewDecoder(rec.Body).Decode(&state)
+	if state.Alerts == nil || len(state.Alerts.Alerts) != 1 {
+		t.Errorf("Expected the alerts in /admin/state, got %+v", state.Alerts)
+	}
+
+	alerts = nil
+	if rec := reload(); rec.Code != http.StatusNotFound {
+		t.Errorf("Expected status 404 without -alert-rules, got %d", rec.Code)
+	}
+}
+
+// TestOutcomeTracker tests the windowed error and unknown counts behind the rate metrics
+func TestOutcomeTracker(t *testing.T) {
+	now := time.Date(2024, 5, 1, 12, 0, 30, 0, time.UTC)
+	tracker := newOutcomeTracker()
+	tracker.now = func() time.Time { return now }
+	record := func(domain, verdict, code string) {
+		tracker.Record(&verify.Result{Domain: domain, Verdict: verdict, ErrorCode: code})
+	}
+
+	record("Gmail.com", verify.VerdictUnknown, verify.ErrCodeSMTPTimeout)
+	record("", verify.VerdictInvalid, verify.ErrCodeInvalidSyntax)
+	now = now.Add(4 * time.Minute)
+	record("gmail.com", verify.VerdictDeliverable, "")
+	record("gmail.com", verify.VerdictUnknown, "")
+
+	counts := tracker.Counts(5 * time.Minute)
+	if got := counts["gmail.com"]; got != (outcomeCounts{total: 3, errors: 1, unknown: 2}) {
+		t.Errorf("Expected gmail.com's 3 outcomes over 5m, got %+v", got)
+	}
+	if got := counts[""]; got != (outcomeCounts{total: 1}) {
+		t.Errorf("Expected the syntax error not to count as an error, got %+v", got)
+	}
+	if got := tracker.Counts(time.Minute)["gmail.com"]; got.total != 2 {
+		t.Errorf("Expected 2 outcomes in the last minute, got %+v", got)
+	}
+
+	now = now.Add(maxAlertWindow)
+	record("gmail.com", verify.VerdictDeliverable, "")
+	if got := len(tracker.buckets); got != 1 {
+		t.Errorf("Expected old minutes dropped, got %d buckets", got)
+	}
+}
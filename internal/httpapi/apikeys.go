@@ -0,0 +1,160 @@
+package httpapi
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+)
+
+// apiKeyStore holds the keys the JSON API accepts, each with a name that
+// is logged in its place.
+type apiKeyStore struct {
+	keys  [][]byte
+	names []string
+}
+
+// apiKeys is nil unless keys are configured, in which case every /api/
+// and /admin/ request must carry one of them in X-API-Key. The admin
+// routes are only served with keys. The web UI, metrics and health routes
+// are not gated.
+var apiKeys *apiKeyStore
+
+// loadAPIKeys builds the store from a comma-separated list of name=key or
+// bare keys and a JSON file mapping names to keys. A bare key is named by
+// a fingerprint. It returns nil if neither gives any key.
+func loadAPIKeys(list, path string) (*apiKeyStore, error) {
+	named := make(map[string]string)
+	for _, entry := range strings.Split(list, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		name, key, ok := strings.Cut(entry, "=")
+		if !ok {
+			name, key = keyFingerprint(entry), entry
+		}
+		if err := addAPIKey(named, strings.TrimSpace(name), strings.TrimSpace(key)); err != nil {
+			return nil, fmt.Errorf("api keys: %v", err)
+		}
+	}
+	if path != "" {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+		var file map[string]string
+		if err := json.Unmarshal(data, &file); err != nil {
+			return nil, fmt.Errorf("parse api keys file %s: %v", path, err)
+		}
+		for name, key := range file {
+			if err := addAPIKey(named, name, key); err != nil {
+				return nil, fmt.Errorf("api keys file %s: %v", path, err)
+			}
+		}
+	}
+	if len(named) == 0 {
+		return nil, nil
+	}
+	store := &apiKeyStore{}
+	for key, name := range named {
+		store.keys = append(store.keys, []byte(key))
+		store.names = append(store.names, name)
+	}
+	return store, nil
+}
+
+func addAPIKey(named map[string]string, name, key string) error {
+	if name == "" || key == "" {
+		return fmt.Errorf("key %q has an empty name or key", name)
+	}
+	if other, dup := named[key]; dup {
+		return fmt.Errorf("keys %s and %s are the same", other, name)
+	}
+	named[key] = name
+	return nil
+}
+
+// keyFingerprint names a key without giving it away.
+func keyFingerprint(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return "key-" + hex.EncodeToString(sum[:4])
+}
+
+// name returns the name of key, or false if it isn't accepted. Every key
+// is compared in constant time, so the answer's timing says nothing about
+// how close key came.
+func (s *apiKeyStore) name(key string) (string, bool) {
+	found := -1
+	for i, k := range s.keys {
+		if subtle.ConstantTimeCompare(k, []byte(key)) == 1 {
+			found = i
+		}
+	}
+	if found < 0 {
+		return "", false
+	}
+	return s.names[found], true
+}
+
+// keyNameKey is the context key withAPIKey stores the caller's key name
+// under.
+type keyNameKey struct{}
+
+// requestKey identifies the caller's API key: its name while keys are
+// configured, so the secret itself is never stored, listed or sent on,
+// and the X-API-Key header as sent otherwise. A route outside withAPIKey
+// resolves the header itself, and gets "" for a key that isn't accepted.
+// Usage, forwarding, tenants, checks, profiles, jobs, watches and history
+// are all keyed by it.
+func requestKey(r *http.Request) string {
+	if name, ok := r.Context().Value(keyNameKey{}).(string); ok {
+		return name
+	}
+	key := r.Header.Get("X-API-Key")
+	if apiKeys == nil || key == "" {
+		return key
+	}
+	name, _ := apiKeys.name(key)
+	return name
+}
+
+// withAPIKey answers 401 to requests without an accepted key while keys
+// are configured, logs the name of the key used and hands it on to
+// requestKey.
+func withAPIKey(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if apiKeys == nil {
+			next.ServeHTTP(w, r)
+			return
+		}
+		key := r.Header.Get("X-API-Key")
+		if key == "" {
+			writeUnauthorized(w, "api_key_required", "Send an API key in the X-API-Key header")
+			return
+		}
+		name, ok := apiKeys.name(key)
+		if !ok {
+			writeUnauthorized(w, "invalid_api_key", "The API key is not valid")
+			return
+		}
+		if info, ok := r.Context().Value(requestInfoKey{}).(*requestInfo); ok {
+			info.keyName = name
+		}
+		next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), keyNameKey{}, name)))
+	})
+}
+
+func writeUnauthorized(w http.ResponseWriter, code, detail string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusUnauthorized)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"error":  code,
+		"detail": detail,
+	})
+}
@@ -0,0 +1,167 @@
+package httpapi
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"email-verifier/pkg/verify"
+	"email-verifier/pkg/verify/verifytest"
+)
+
+// useAPIKeys requires the keys in list for the test
+func useAPIKeys(t *testing.T, list string) {
+	t.Helper()
+	store, err := loadAPIKeys(list, "")
+	if err != nil {
+		t.Fatalf("Failed to load keys: %v", err)
+	}
+	saved := apiKeys
+	apiKeys = store
+	t.Cleanup(func() { apiKeys = saved })
+}
+
+// TestAPIKeyAuth tests that /api/ and /admin/ routes need an accepted key while the UI and health probes don't, and that the key is logged by name
+func TestAPIKeyAuth(t *testing.T) {
+	useStreamService(t)
+	useAPIKeys(t, "growth=k-growth-123,k-bare-456")
+	logs := useRequestLog(t)
+	handler := Handler()
+	send := func(method, path, key string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, strings.NewReader(`{"email": "jane@partner.mock"}`))
+		if key != "" {
+			req.Header.Set("X-API-Key", key)
+		}
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		return rec
+	}
+
+	for key, code := range map[string]string{"": "api_key_required", "k-wrong": "invalid_api_key"} {
+		rec := send(http.MethodPost, "/api/verify", key)
+		var body struct{ Error, Detail string }
+		json.NewDecoder(rec.Body).Decode(&body)
+		if rec.Code != http.StatusUnauthorized || body.Error != code || body.Detail == "" {
+			t.Errorf("Expected 401 %s for key %q, got %d %+v", code, key, rec.Code, body)
+		}
+	}
+	for _, key := range []string{"k-growth-123", "k-bare-456"} {
+		if rec := send(http.MethodPost, "/api/verify", key); rec.Code != http.StatusOK {
+			t.Errorf("Expected status 200 for key %q, got %d", key, rec.Code)
+		}
+	}
+	if !strings.Contains(logs.String(), `"key":"growth"`) || !strings.Contains(logs.String(), `"key":"`+keyFingerprint("k-bare-456")+`"`) {
+		t.Errorf("Expected the key names logged, got %s", logs)
+	}
+	if strings.Contains(logs.String(), "k-growth-123") || strings.Contains(logs.String(), "k-bare-456") {
+		t.Errorf("Expected no key in the logs, got %s", logs)
+	}
+	for _, path := range []string{"/admin/network", "/admin/usage", "/admin/tenants", "/admin/capture", "/api/admin/lists"} {
+		if rec := send(http.MethodGet, path, ""); rec.Code != http.StatusUnauthorized {
+			t.Errorf("Expected %s to need a key, got %d", path, rec.Code)
+		}
+	}
+	if rec := send(http.MethodGet, "/admin/network", "k-growth-123"); rec.Code != http.StatusOK {
+		t.Errorf("Expected /admin/network served with a key, got %d", rec.Code)
+	}
+	for _, path := range []string{"/health", "/readyz", "/"} {
+		if rec := send(http.MethodGet, path, ""); rec.Code == http.StatusUnauthorized {
+			t.Errorf("Expected %s served without a key, got %d", path, rec.Code)
+		}
+	}
+}
+
+// TestLoadAPIKeys tests reading keys from the list and the file and the mistakes it rejects
+func TestLoadAPIKeys(t *testing.T) {
+	if store, err := loadAPIKeys(" , ", ""); store != nil || err != nil {
+		t.Errorf("Expected auth off without keys, got %v and %v", store, err)
+	}
+	path := filepath.Join(t.TempDir(), "keys.json")
+	os.WriteFile(path, []byte(`{"support": "k-support"}`), 0o600)
+	store, err := loadAPIKeys("growth=k-growth", path)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if name, ok := store.name("k-support"); !ok || name != "support" {
+		t.Errorf("Expected the file's key named support, got %q", name)
+	}
+	if _, ok := store.name("k-growt"); ok {
+		t.Error("Expected a prefix of a key to be refused")
+	}
+
+	for _, list := range []string{"growth=", "=k-growth", "a=k-same,b=k-same"} {
+		if _, err := loadAPIKeys(list, ""); err == nil {
+			t.Errorf("Expected an error for %q", list)
+		}
+	}
+	os.WriteFile(path, []byte(`["k-support"]`), 0o600)
+	if _, err := loadAPIKeys("", path); err == nil {
+		t.Error("Expected an error for a file that isn't an object")
+	}
+}
+
+// TestAPIKeyNames tests that per-key state is kept under the key's name, so the secret never shows in usage listings, tenants or forwarded batches
+func TestAPIKeyNames(t *testing.T) {
+	fake := verifytest.NewResolver()
+	fake.MX["partner.mock"] = []*net.MX{{Host: "mx.partner.mock.", Pref: 10}}
+	useService(t, verify.Config{
+		Resolver: fake,
+		Tenants:  map[string]verify.Tenant{"acme": {Keys: []string{"growth"}}},
+	})
+	useAPIKeys(t, "growth=k-growth-123")
+	now := time.Now()
+	useUsage(t, &now)
+	var forwarded bytes.Buffer
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) { io.Copy(&forwarded, r.Body) }))
+	defer receiver.Close()
+	saved := forwarder
+	forwarder = newResultForwarder(map[string]forwardTarget{"growth": {URL: receiver.URL, Secret: "shh"}})
+	defer func() { forwarder = saved }()
+
+	savedHistory := history
+	history = newHistoryStore()
+	defer func() { history = savedHistory }()
+
+	handler := Handler()
+	send := func(method, path, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		req.Header.Set("X-API-Key", "k-growth-123")
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		return rec
+	}
+	if rec := send(http.MethodPost, "/api/verify?checks=syntax", `{"email": "jane@partner.mock"}`); rec.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d: %s", rec.Code, rec.Body)
+	}
+	forwarder.Flush(context.Background())
+
+	listing := send(http.MethodGet, "/admin/usage", "").Body.String()
+	if !strings.Contains(listing, `"key":"growth"`) {
+		t.Errorf("Expected usage under the key's name, got %s", listing)
+	}
+	if !strings.Contains(forwarded.String(), `"key":"growth"`) {
+		t.Errorf("Expected the batch forwarded under the key's name, got %s", forwarded.String())
+	}
+	for name, body := range map[string]string{"usage": listing, "forwarding": send(http.MethodGet, "/admin/forwarding", "").Body.String(), "batch": forwarded.String()} {
+		if strings.Contains(body, "k-growth-123") {
+			t.Errorf("Expected no secret in the %s, got %s", name, body)
+		}
+	}
+	if tenant := service.TenantFor(requestKey(httptest.NewRequest(http.MethodGet, "/", nil))); tenant != verify.DefaultTenant {
+		t.Errorf("Expected a request without a key in the default tenant, got %s", tenant)
+	}
+	recorded := 0
+	history.Each("acme", historyFilter{}, func(historyEntry) error { recorded++; return nil })
+	if recorded != 1 {
+		t.Errorf("Expected the result in the history of the tenant the key's name belongs to, got %d entries", recorded)
+	}
+}
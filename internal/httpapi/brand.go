@@ -0,0 +1,154 @@
+package httpapi
+
+import (
+	_ "embed"
+	"encoding/json"
+	"fmt"
+	"html/template"
+	"math"
+	"net"
+	"net/http"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// layoutTemplates are the shared blocks every UI page includes: the brand's
+// head additions, logo and footer. They are built in so a template
+// directory from before branding still renders.
+//
+//go:embed layout.html
+var layoutTemplates string
+
+// brand is how the UI presents itself. Every string is HTML-escaped when
+// rendered except ExtraHead, which is trusted markup from the operator's
+// config.
+type brand struct {
+	ProductName  string `json:"product_name,omitempty"`
+	LogoPath     string `json:"logo_path,omitempty"`
+	PrimaryColor string `json:"primary_color,omitempty"`
+	FooterText   string `json:"footer_text,omitempty"`
+	ExtraHead    string `json:"extra_head,omitempty"`
+
+	// Hosts select a tenant's brand by the request's hostname.
+	Hosts []string `json:"hosts,omitempty"`
+}
+
+// defaultBrand is the theme without a brand config.
+var defaultBrand = brand{
+	ProductName:  "Email Verifier",
+	PrimaryColor: "#667eea",
+	FooterText:   "© 2024 Email Verifier. Built with Go and AfterShip Email Verifier.",
+}
+
+// Head is ExtraHead marked safe, the one block rendered unescaped.
+func (b brand) Head() template.HTML { return template.HTML(b.ExtraHead) }
+
+// over fills b's empty fields from base.
+func (b brand) over(base brand) brand {
+	if b.ProductName == "" {
+		b.ProductName = base.ProductName
+	}
+	if b.LogoPath == "" {
+		b.LogoPath = base.LogoPath
+	}
+	if b.PrimaryColor == "" {
+		b.PrimaryColor = base.PrimaryColor
+	}
+	if b.FooterText == "" {
+		b.FooterText = base.FooterText
+	}
+	if b.ExtraHead == "" {
+		b.ExtraHead = base.ExtraHead
+	}
+	return b
+}
+
+// brandConfig is the server-wide brand and per-tenant overrides.
+type brandConfig struct {
+	Default brand            `json:"default"`
+	Tenants map[string]brand `json:"tenants,omitempty"`
+
+	hosts map[string]string // hostname to tenant
+}
+
+var brands = &brandConfig{Default: defaultBrand}
+
+// colorPattern matches the colors a brand may set: hex or a CSS color name.
+var colorPattern = regexp.MustCompile(`^(#[0-9a-fA-F]{3}|#[0-9a-fA-F]{6}|[a-zA-Z]+)$`)
+
+// loadBrandConfig reads the brand config; fields it leaves empty keep the
+// default theme.
+func loadBrandConfig(path string) (*brandConfig, error) {
+	cfg := &brandConfig{Default: defaultBrand}
+	if path == "" {
+		return cfg, nil
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(data, cfg); err != nil {
+		return nil, fmt.Errorf("parse brand config %s: %v", path, err)
+	}
+	cfg.Default = cfg.Default.over(defaultBrand)
+	if !colorPattern.MatchString(cfg.Default.PrimaryColor) {
+		return nil, fmt.Errorf("brand config %s: invalid primary_color %q: want #rgb, #rrggbb or a color name", path, cfg.Default.PrimaryColor)
+	}
+	cfg.hosts = make(map[string]string)
+	for tenant, b := range cfg.Tenants {
+		b = b.over(cfg.Default)
+		if !colorPattern.MatchString(b.PrimaryColor) {
+			return nil, fmt.Errorf("brand config %s, tenant %q: invalid primary_color %q: want #rgb, #rrggbb or a color name", path, tenant, b.PrimaryColor)
+		}
+		for _, host := range b.Hosts {
+			host = strings.ToLower(host)
+			if other, ok := cfg.hosts[host]; ok {
+				return nil, fmt.Errorf("brand config %s: host %q listed for both %q and %q", path, host, other, tenant)
+			}
+			cfg.hosts[host] = tenant
+		}
+		cfg.Tenants[tenant] = b
+	}
+	return cfg, nil
+}
+
+// For picks the brand for a UI request: the tenant whose hosts include the
+// request's hostname, else the tenant of its X-API-Key, else the default.
+func (c *brandConfig) For(r *http.Request) brand {
+	host := r.Host
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+	if tenant, ok := c.hosts[strings.ToLower(host)]; ok {
+		return c.Tenants[tenant]
+	}
+	if key := requestKey(r); key != "" {
+		if b, ok := c.Tenants[service.TenantFor(key)]; ok {
+			return b
+		}
+	}
+	return c.Default
+}
+
+// pageFuncs are the formatting helpers every UI template may use.
+var pageFuncs = template.FuncMap{
+	"join": strings.Join,
+	// percent formats a fraction such as a deliverable rate
+	"percent": func(f float64) string { return strconv.FormatFloat(math.Round(f*1000)/10, 'f', -1, 64) + "%" },
+	// signedPercent formats a change in a rate, with its sign
+	"signedPercent": func(f float64) string {
+		return strconv.FormatFloat(math.Round(f*1000)/10, 'f', -1, 64) + " pts"
+	},
+}
+
+// renderPage renders a UI template with the request's brand.
+func renderPage(w http.ResponseWriter, r *http.Request, name string, data interface{}) {
+	b := brands.For(r)
+	tmpl := template.Must(template.New(name).Funcs(pageFuncs).Funcs(template.FuncMap{
+		"brand": func() brand { return b },
+	}).Parse(layoutTemplates))
+	tmpl = template.Must(tmpl.ParseFiles(templatePath(name)))
+	tmpl.ExecuteTemplate(w, name, data)
+}
@@ -0,0 +1,134 @@
+package httpapi
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"email-verifier/pkg/verify"
+)
+
+// useBrands loads a brand config for the duration of a test
+func useBrands(t *testing.T, config string) {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "brand.json")
+	if err := os.WriteFile(path, []byte(config), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	cfg, err := loadBrandConfig(path)
+	if err != nil {
+		t.Fatalf("Expected the brand config to load, got %v", err)
+	}
+	saved := brands
+	brands = cfg
+	t.Cleanup(func() { brands = saved })
+}
+
+// getPage fetches a UI page with optional host and key and returns its body
+func getPage(t *testing.T, path, host, key string) string {
+	t.Helper()
+	req := httptest.NewRequest(http.MethodGet, path, nil)
+	if host != "" {
+		req.Host = host
+	}
+	if key != "" {
+		req.Header.Set("X-API-Key", key)
+	}
+	rec := httptest.NewRecorder()
+	Handler().ServeHTTP(rec, req)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Expected 200 for %s, got %d", path, rec.Code)
+	}
+	return rec.Body.String()
+}
+
+// TestDefaultBrand tests that pages render the default theme without a brand config
+func TestDefaultBrand(t *testing.T) {
+	body := getPage(t, "/", "", "")
+	for _, want := range []string{"<h1", "Email Verifier", "--brand-primary: #667eea", "© 2024 Email Verifier", "fa-envelope-open-text"} {
+		if !strings.Contains(body, want) {
+			t.Errorf("Expected the index page to contain %q", want)
+		}
+	}
+}
+
+// TestBrandConfig tests that the configured brand is rendered escaped, apart from the extra head markup
+func TestBrandConfig(t *testing.T) {
+	useBrands(t, `{"default": {
+		"product_name": "Acme <script>alert(1)</script>",
+		"logo_path": "/static/acme.png",
+		"primary_color": "#ff6600",
+		"footer_text": "Acme & Co",
+		"extra_head": "<link rel=\"stylesheet\" href=\"/static/acme.css\">"
+	}}`)
+
+	body := getPage(t, "/", "", "")
+	if strings.Contains(body, "<script>alert(1)</script>") || !strings.Contains(body, "Acme &lt;script&gt;") {
+		t.Error("Expected the product name to be escaped")
+	}
+	if !strings.Contains(body, "Acme &amp; Co") {
+		t.Error("Expected the escaped footer text")
+	}
+	if !strings.Contains(body, `<link rel="stylesheet" href="/static/acme.css">`) {
+		t.Error("Expected the extra head markup unescaped")
+	}
+	if !strings.Contains(body, `src="/static/acme.png"`) || strings.Contains(body, "fa-envelope-open-text") {
+		t.Error("Expected the logo in place of the default icon")
+	}
+	if !strings.Contains(body, "--brand-primary: #ff6600") {
+		t.Error("Expected the primary color")
+	}
+}
+
+// TestTenantBrand tests that a tenant's brand is picked by host, then by API key, with unset fields from the default
+func TestTenantBrand(t *testing.T) {
+	useService(t, verify.Config{Tenants: map[string]verify.Tenant{"acme": {Keys: []string{"acme-key"}}}})
+	useBrands(t, `{
+		"default": {"product_name": "Verifier"},
+		"tenants": {"acme": {"product_name": "Acme Check", "primary_color": "teal", "hosts": ["verify.acme.test"]}}
+	}`)
+
+	tests := []struct {
+		host, key, want string
+	}{
+		{"verify.acme.test:8080", "", "Acme Check"},
+		{"VERIFY.ACME.TEST", "", "Acme Check"},
+		{"", "acme-key", "Acme Check"},
+		{"", "other-key", "Verifier"},
+		{"", "", "Verifier"},
+	}
+	for _, test := range tests {
+		body := getPage(t, "/", test.host, test.key)
+		if !strings.Contains(body, "<h1") || !strings.Contains(body, test.want) {
+			t.Errorf("Expected %q for host %q key %q", test.want, test.host, test.key)
+		}
+	}
+
+	body := getPage(t, "/", "verify.acme.test", "")
+	if !strings.Contains(body, "--brand-primary: teal") || !strings.Contains(body, "© 2024 Email Verifier") {
+		t.Error("Expected the tenant color with the default footer")
+	}
+}
+
+// TestLoadBrandConfigErrors tests that invalid brand configs are rejected at startup
+func TestLoadBrandConfigErrors(t *testing.T) {
+	tests := []string{
+		`{"default": {"primary_color": "red; background: url(x)"}}`,
+		`{"tenants": {"a": {"primary_color": "#12345"}}}`,
+		`{"tenants": {"a": {"hosts": ["x.test"]}, "b": {"hosts": ["X.test"]}}}`,
+		`{"default": []}`,
+	}
+	for _, config := range tests {
+		path := filepath.Join(t.TempDir(), "brand.json")
+		os.WriteFile(path, []byte(config), 0o600)
+		if _, err := loadBrandConfig(path); err == nil {
+			t.Errorf("Expected an error for %s", config)
+		}
+	}
+	if cfg, err := loadBrandConfig(""); err != nil || cfg.Default.ProductName != "Email Verifier" {
+		t.Errorf("Expected the default brand without a config, got %v %v", cfg, err)
+	}
+}
@@ -0,0 +1,55 @@
+package httpapi
+
+import (
+	"sync"
+	"time"
+)
+
+// circuitBreaker stops calls to a failing dependency for a cooldown period
+// after a run of consecutive failures.
+type circuitBreaker struct {
+	mu          sync.Mutex
+	threshold   int
+	cooldown    time.Duration
+	failures    int
+	openedUntil time.Time
+	now         func() time.Time
+}
+
+func newCircuitBreaker(threshold int, cooldown time.Duration) *circuitBreaker {
+	return &circuitBreaker{threshold: threshold, cooldown: cooldown, now: time.Now}
+}
+
+// Allow reports whether a call may proceed. Once the cooldown has elapsed a
+// call is let through to probe whether the dependency has recovered.
+func (b *circuitBreaker) Allow() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return !b.now().Before(b.openedUntil)
+}
+
+// Success closes the breaker.
+func (b *circuitBreaker) Success() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.failures = 0
+	b.openedUntil = time.Time{}
+}
+
+// Failure records a failed call and opens the breaker at the threshold.
+func (b *circuitBreaker) Failure() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.failures++
+	if b.failures >= b.threshold {
+		b.openedUntil = b.now().Add(b.cooldown)
+	}
+}
+
+// State returns "open" or "closed".
+func (b *circuitBreaker) State() string {
+	if b.Allow() {
+		return "closed"
+	}
+	return "open"
+}
@@ -0,0 +1,32 @@
+package httpapi
+
+import (
+	"testing"
+	"time"
+)
+
+// TestCircuitBreaker tests opening after consecutive failures and recovering after the cooldown
+func TestCircuitBreaker(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+	breaker := newCircuitBreaker(2, time.Minute)
+	breaker.now = func() time.Time { return now }
+
+	breaker.Failure()
+	if !breaker.Allow() {
+		t.Fatal("Expected breaker to stay closed below the threshold")
+	}
+	breaker.Failure()
+	if breaker.Allow() || breaker.State() != "open" {
+		t.Fatal("Expected breaker to open at the threshold")
+	}
+
+	now = now.Add(time.Minute)
+	if !breaker.Allow() {
+		t.Fatal("Expected breaker to allow a probe after the cooldown")
+	}
+	breaker.Success()
+	breaker.Failure()
+	if !breaker.Allow() {
+		t.Error("Expected success to reset the failure count")
+	}
+}
@@ -0,0 +1,192 @@
+package httpapi
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"email-verifier/pkg/verify"
+)
+
+// apiVerifyBulkHandler verifies a list of addresses in one request and
+// answers with their results in input order. Addresses that differ only in
+// case are verified once, as the first spelling, and share its result.
+// Verifications run on up to bulkWorkers goroutines, each taking a lane
+// slot like a single API verification, so one slow probe doesn't hold up
+// the rest, and addresses at a domain held back by domainThrottles wait
+// their turn while other domains' go ahead. A failed verification is
+// reported in its own result's error, never as a failed request.
+//
+// A request that accepts application/x-ndjson gets a bulkLine per input
+// instead, written as soon as its verification finishes, and then a
+// bulkSummary line. Once the client has gone no further addresses are
+// started, and results cut short are billed but not recorded.
+func apiVerifyBulkHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var request struct {
+		Emails []string  `json:"emails"`
+		Checks checkList `json:"checks"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		http.Error(w, "Invalid JSON", http.StatusBadRequest)
+		return
+	}
+	if len(request.Emails) == 0 {
+		http.Error(w, "emails is required", http.StatusBadRequest)
+		return
+	}
+	if len(request.Emails) > maxBulk {
+		http.Error(w, fmt.Sprintf("Too many addresses (at most %d per request)", maxBulk), http.StatusRequestEntityTooLarge)
+		return
+	}
+	if err := service.Ready(); err != nil {
+		writeVerifierUnavailable(w, err)
+		return
+	}
+	key := requestKey(r)
+	checks, err := requestChecks(request.Checks, r.URL.Query().Get("checks"), key)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	opts := verify.Options{Checks: checks, Key: key, Context: r.Context()}
+
+	// first maps each input to the index of its first spelling
+	first := make([]int, len(request.Emails))
+	seen := make(map[string]int, len(request.Emails))
+	var unique []int
+	for i, email := range request.Emails {
+		k := verify.AddressKey(email)
+		if j, ok := seen[k]; ok {
+			first[i] = j
+			continue
+		}
+		seen[k] = i
+		first[i] = i
+		unique = append(unique, i)
+	}
+
+	// sharing maps each first spelling to the inputs that share its result
+	sharing := make(map[int][]int, len(unique))
+	for i, j := range first {
+		sharing[j] = append(sharing[j], i)
+	}
+	results := make([]*verify.Result, len(request.Emails))
+	var stream *bulkStream
+	if strings.Contains(r.Header.Get("Accept"), "application/x-ndjson") {
+		stream = newBulkStream(w)
+	}
+
+	ctx := r.Context()
+	queue := newThrottleQueue(domainThrottles, unique, func(i int) string { return throttleDomain(request.Emails[i], checks) }, 1)
+	var wg sync.WaitGroup
+	for n := min(bulkWorkers, len(unique)); n > 0; n-- {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				domain, next, ok := queue.Next(ctx)
+				if !ok {
+					return
+				}
+				i := next[0]
+				email := request.Emails[i]
+				// Slots are waited for as long as the caller does
+				var result *verify.Result
+				var took time.Duration
+				if err := laneFor(checks).Do(ctx, func() {
+					start := time.Now()
+					result = service.Verify(email, opts)
+					took = time.Since(start)
+				}); err != nil {
+					result = verify.ErrorResult(verify.ErrCodeDeadlineExceeded)
+					result.Email, _ = verify.NormalizeInput(email)
+				} else if ctx.Err() != nil {
+					usage.Record(key, result.CostUnits)
+				} else {
+					recordResult(key, result, took)
+				}
+				queue.Done(domain)
+				result = withRequestID(r, result)
+				results[i] = result
+				if stream != nil {
+					stream.Write(sharing[i], result)
+				}
+			}
+		}()
+	}
+	wg.Wait()
+
+	if stream != nil {
+		stream.Finish(len(request.Emails))
+		return
+	}
+	for i, j := range first {
+		results[i] = results[j]
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(results)
+}
+
+// bulkLine is one result of a streamed bulk verification, with the
+// position of its address in the request.
+type bulkLine struct {
+	Index int `json:"index"`
+	*verify.Result
+}
+
+// bulkSummary ends a streamed bulk verification. Cancelled is set if the
+// client went away before every address was verified.
+type bulkSummary struct {
+	Summary struct {
+		Total     int            `json:"total"`
+		Completed int            `json:"completed"`
+		Counts    map[string]int `json:"counts"`
+		Cancelled bool           `json:"cancelled,omitempty"`
+	} `json:"summary"`
+}
+
+// bulkStream writes a bulk verification's results as NDJSON as they
+// finish, flushing after each address. Workers share it.
+type bulkStream struct {
+	mu        sync.Mutex
+	w         http.ResponseWriter
+	enc       *json.Encoder
+	completed int
+	counts    map[string]int
+}
+
+func newBulkStream(w http.ResponseWriter) *bulkStream {
+	w.Header().Set("Content-Type", "application/x-ndjson")
+	return &bulkStream{w: w, enc: json.NewEncoder(w), counts: make(map[string]int)}
+}
+
+// Write sends result once for each input index that shares it.
+func (s *bulkStream) Write(indexes []int, result *verify.Result) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, i := range indexes {
+		s.enc.Encode(bulkLine{Index: i, Result: result})
+		s.completed++
+		s.counts[result.Verdict]++
+	}
+	http.NewResponseController(s.w).Flush()
+}
+
+// Finish sends the summary line.
+func (s *bulkStream) Finish(total int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var summary bulkSummary
+	summary.Summary.Total, summary.Summary.Completed = total, s.completed
+	summary.Summary.Counts, summary.Summary.Cancelled = s.counts, s.completed < total
+	s.enc.Encode(summary)
+	http.NewResponseController(s.w).Flush()
+}
@@ -0,0 +1,176 @@
+package httpapi
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"email-verifier/pkg/verify"
+	"email-verifier/pkg/verify/verifytest"
+)
+
+// postBulk sends body to /api/verify/bulk
+func postBulk(body string) *httptest.ResponseRecorder {
+	rec := httptest.NewRecorder()
+	apiVerifyBulkHandler(rec, httptest.NewRequest(http.MethodPost, "/api/verify/bulk", strings.NewReader(body)))
+	return rec
+}
+
+// TestBulkVerification tests that results come back in input order, duplicates are verified once and bad addresses fail on their own
+func TestBulkVerification(t *testing.T) {
+	smtp := useStreamService(t)
+	rec := postBulk(`{"emails": ["jane@partner.mock", "nobody@partner.mock", "not-an-address", "JANE@partner.mock", ""], "checks": "smtp"}`)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d: %s", rec.Code, rec.Body)
+	}
+	var results []verify.Result
+	if err := json.NewDecoder(rec.Body).Decode(&results); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	expected := []struct{ email, verdict, code string }{
+		{"jane@partner.mock", verify.VerdictDeliverable, ""},
+		{"nobody@partner.mock", verify.VerdictUndeliverable, ""},
+		{"not-an-address", verify.VerdictInvalid, verify.ErrCodeInvalidSyntax},
+		{"jane@partner.mock", verify.VerdictDeliverable, ""},
+		{"", verify.VerdictInvalid, verify.ErrCodeEmailRequired},
+	}
+	if len(results) != len(expected) {
+		t.Fatalf("Expected %d results, got %d", len(expected), len(results))
+	}
+	for i, e := range expected {
+		if r := results[i]; r.Email != e.email || r.Verdict != e.verdict || r.ErrorCode != e.code {
+			t.Errorf("Expected result %d to be %s %s %q, got %s %s %q", i, e.email, e.verdict, e.code, r.Email, r.Verdict, r.ErrorCode)
+		}
+	}
+	if n := smtp.Probes(); n != 2 {
+		t.Errorf("Expected the duplicate spelling to be verified once, got %d probes", n)
+	}
+}
+
+// TestBulkConcurrency tests that slow probes run side by side instead of one after another
+func TestBulkConcurrency(t *testing.T) {
+	fake := verifytest.NewResolver()
+	emails := make([]string, 8)
+	for i := range emails {
+		domain := fmt.Sprintf("d%d.mock", i)
+		fake.MX[domain] = []*net.MX{{Host: "mx." + domain + ".", Pref: 10}}
+		emails[i] = "user@" + domain
+	}
+	smtp := verifytest.NewSMTP()
+	smtp.Delay = 100 * time.Millisecond
+	useService(t, verify.Config{Resolver: fake, Prober: smtp.Probe})
+
+	body, _ := json.Marshal(map[string]interface{}{"emails": emails, "checks": "smtp"})
+	start := time.Now()
+	if rec := postBulk(string(body)); rec.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d", rec.Code)
+	}
+	if elapsed := time.Since(start); elapsed >= 4*smtp.Delay {
+		t.Errorf("Expected 8 probes on %d workers to take well under %v, took %v", bulkWorkers, 8*smtp.Delay, elapsed)
+	}
+}
+
+// TestBulkLimits tests the request checks
+func TestBulkLimits(t *testing.T) {
+	useStreamService(t)
+	saved := maxBulk
+	maxBulk = 2
+	t.Cleanup(func() { maxBulk = saved })
+
+	testCases := []struct {
+		body string
+		code int
+	}{
+		{`{"emails": ["a@partner.mock", "b@partner.mock", "c@partner.mock"]}`, http.StatusRequestEntityTooLarge},
+		{`{"emails": []}`, http.StatusBadRequest},
+		{`{"emails": ["a@partner.mock"], "checks": "bogus"}`, http.StatusBadRequest},
+		{`not json`, http.StatusBadRequest},
+		{`{"emails": ["a@partner.mock", "b@partner.mock"]}`, http.StatusOK},
+	}
+	for _, tc := range testCases {
+		if rec := postBulk(tc.body); rec.Code != tc.code {
+			t.Errorf("Expected status %d for %s, got %d", tc.code, tc.body, rec.Code)
+		}
+	}
+}
+
+// TestBulkNDJSON tests that an NDJSON request gets one line per input tied back by index, ending in a summary
+func TestBulkNDJSON(t *testing.T) {
+	useStreamService(t)
+	req := httptest.NewRequest(http.MethodPost, "/api/verify/bulk", strings.NewReader(`{"emails": ["jane@partner.mock", "nobody@partner.mock", "JANE@partner.mock"], "checks": "smtp"}`))
+	req.Header.Set("Accept", "application/x-ndjson")
+	rec := httptest.NewRecorder()
+	apiVerifyBulkHandler(rec, req)
+	if ct := rec.Header().Get("Content-Type"); ct != "application/x-ndjson" {
+		t.Fatalf("Expected NDJSON, got %s: %s", ct, rec.Body)
+	}
+
+	lines := strings.Split(strings.TrimSpace(rec.Body.String()), "\n")
+	if len(lines) != 4 {
+		t.Fatalf("Expected 3 results and a summary, got %d lines: %s", len(lines), rec.Body)
+	}
+	verdicts := make(map[int]string)
+	for _, line := range lines[:3] {
+		var result struct {
+			Index *int `json:"index"`
+			verify.Result
+		}
+		if err := json.Unmarshal([]byte(line), &result); err != nil || result.Index == nil {
+			t.Fatalf("Expected a result with an index, got %s", line)
+		}
+		verdicts[*result.Index] = result.Verdict
+	}
+	expected := map[int]string{0: verify.VerdictDeliverable, 1: verify.VerdictUndeliverable, 2: verify.VerdictDeliverable}
+	if fmt.Sprint(verdicts) != fmt.Sprint(expected) {
+		t.Errorf("Expected verdicts %v by index, got %v", expected, verdicts)
+	}
+
+	var summary bulkSummary
+	if err := json.Unmarshal([]byte(lines[3]), &summary); err != nil || summary.Summary.Total != 3 || summary.Summary.Completed != 3 || summary.Summary.Cancelled {
+		t.Errorf("Expected a summary of 3 completed, got %s", lines[3])
+	}
+	if summary.Summary.Counts[verify.VerdictDeliverable] != 2 {
+		t.Errorf("Expected 2 deliverable in the summary, got %v", summary.Summary.Counts)
+	}
+}
+
+// TestBulkNDJSONDisconnect tests that addresses not yet started are dropped once the client goes away
+func TestBulkNDJSONDisconnect(t *testing.T) {
+	fake := verifytest.NewResolver()
+	emails := make([]string, 8)
+	for i := range emails {
+		domain := fmt.Sprintf("d%d.mock", i)
+		fake.MX[domain] = []*net.MX{{Host: "mx." + domain + ".", Pref: 10}}
+		emails[i] = "user@" + domain
+	}
+	smtp := verifytest.NewSMTP()
+	smtp.Delay = 50 * time.Millisecond
+	useService(t, verify.Config{Resolver: fake, Prober: smtp.Probe})
+	saved := bulkWorkers
+	bulkWorkers = 1
+	t.Cleanup(func() { bulkWorkers = saved })
+
+	body, _ := json.Marshal(map[string]interface{}{"emails": emails, "checks": "smtp"})
+	ctx, cancel := context.WithTimeout(context.Background(), 75*time.Millisecond)
+	defer cancel()
+	req := httptest.NewRequest(http.MethodPost, "/api/verify/bulk", strings.NewReader(string(body))).WithContext(ctx)
+	req.Header.Set("Accept", "application/x-ndjson")
+	rec := httptest.NewRecorder()
+	apiVerifyBulkHandler(rec, req)
+
+	if n := smtp.Probes(); n >= int64(len(emails)) {
+		t.Errorf("Expected the remaining probes to be cancelled, got %d", n)
+	}
+	lines := strings.Split(strings.TrimSpace(rec.Body.String()), "\n")
+	var summary bulkSummary
+	json.Unmarshal([]byte(lines[len(lines)-1]), &summary)
+	if !summary.Summary.Cancelled || summary.Summary.Completed >= len(emails) {
+		t.Errorf("Expected a cancelled summary, got %s", lines[len(lines)-1])
+	}
+}
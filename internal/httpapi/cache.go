@@ -0,0 +1,59 @@
+package httpapi
+
+import (
+	"fmt"
+	"net/http"
+)
+
+// cacheClass is how a route's responses may be cached. Every route declares
+// one, so a CDN or proxy in front of the server can never store a response
+// holding someone's address.
+type cacheClass int
+
+const (
+	// cacheNoStore responses carry submitted addresses, results or other
+	// server state and must not be stored anywhere.
+	cacheNoStore cacheClass = iota + 1
+	// cacheStatic responses are the same for every caller and safe for
+	// shared caches.
+	cacheStatic
+	// cachePerKey responses depend only on the caller's API key. Browsers
+	// may keep them briefly; shared caches may not, and they vary on the
+	// key.
+	cachePerKey
+)
+
+func (c cacheClass) String() string {
+	switch c {
+	case cacheNoStore:
+		return "no-store"
+	case cacheStatic:
+		return "static"
+	case cachePerKey:
+		return "per-key"
+	}
+	return fmt.Sprintf("cacheClass(%d)", int(c))
+}
+
+// setHeaders applies the class's cache headers.
+func (c cacheClass) setHeaders(h http.Header) {
+	switch c {
+	case cacheStatic:
+		h.Set("Cache-Control", "public, max-age=3600")
+	case cachePerKey:
+		h.Set("Cache-Control", "private, max-age=60")
+		h.Add("Vary", "X-API-Key")
+	default:
+		h.Set("Cache-Control", "no-store")
+		h.Set("Pragma", "no-cache")
+	}
+}
+
+// withCachePolicy sets class's headers before next runs, so error
+// responses carry them too and handlers can't forget them.
+func withCachePolicy(class cacheClass, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		class.setHeaders(w.Header())
+		next.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,87 @@
+package httpapi
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+// cacheableRoutes are the only routes whose responses may be stored; every other route must be no-store
+var cacheableRoutes = map[string]cacheClass{
+	"/static/":          cacheStatic,
+	"/api/usage":        cachePerKey,
+	"/api/openapi.json": cacheStatic,
+	"/api/docs":         cacheStatic,
+}
+
+// routePath fills a route pattern's wildcards with placeholder values
+func routePath(pattern string) string {
+	r := strings.NewReplacer("{id}", "0123456789abcdef", "{key}", "team", "{action}", "pause", "{source}", "ses")
+	return r.Replace(pattern)
+}
+
+// assertCacheHeaders checks a response's cache headers against class
+func assertCacheHeaders(t *testing.T, class cacheClass, h http.Header) {
+	t.Helper()
+	switch class {
+	case cacheNoStore:
+		if h.Get("Cache-Control") != "no-store" || h.Get("Pragma") != "no-cache" {
+			t.Errorf("Expected Cache-Control: no-store and Pragma: no-cache, got %q and %q", h.Get("Cache-Control"), h.Get("Pragma"))
+		}
+	case cacheStatic:
+		if cc := h.Get("Cache-Control"); !strings.HasPrefix(cc, "public") {
+			t.Errorf("Expected a public Cache-Control, got %q", cc)
+		}
+	case cachePerKey:
+		if cc := h.Get("Cache-Control"); !strings.HasPrefix(cc, "private") {
+			t.Errorf("Expected a private Cache-Control, got %q", cc)
+		}
+		if vary := h.Values("Vary"); len(vary) != 1 || vary[0] != "X-API-Key" {
+			t.Errorf("Expected Vary: X-API-Key, got %v", vary)
+		}
+	default:
+		t.Errorf("Unknown cache class %v", class)
+	}
+}
+
+// TestRouteCachePolicies tests that every registered route declares a cache class and that its responses, errors included, carry that class's headers
+func TestRouteCachePolicies(t *testing.T) {
+	handler := Handler()
+
+	for _, rt := range routes() {
+		t.Run(rt.pattern, func(t *testing.T) {
+			if strings.HasPrefix(rt.cache.String(), "cacheClass(") {
+				t.Fatalf("Route declares no cache class")
+			}
+			if want, ok := cacheableRoutes[rt.pattern]; ok != (rt.cache != cacheNoStore) || (ok && want != rt.cache) {
+				t.Fatalf("Expected %v, got %v; responses may hold addresses unless the route is listed in cacheableRoutes", cacheableRoutes[rt.pattern], rt.cache)
+			}
+
+			for _, method := range []string{http.MethodGet, http.MethodPost} {
+				rec := httptest.NewRecorder()
+				handler.ServeHTTP(rec, httptest.NewRequest(method, routePath(rt.pattern), strings.NewReader("{}")))
+				assertCacheHeaders(t, rt.cache, rec.Header())
+			}
+		})
+	}
+}
+
+// TestResultPagesNotCacheable tests that the HTML result pages, which show submitted addresses, are never cacheable
+func TestResultPagesNotCacheable(t *testing.T) {
+	handler := Handler()
+	testCases := []string{"jane@example.com", "a@example.com\nb@example.com"}
+
+	for _, input := range testCases {
+		form := url.Values{"email": {input}}
+		req := httptest.NewRequest(http.MethodPost, "/verify", strings.NewReader(form.Encode()))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		if rec.Code != http.StatusOK || !strings.Contains(rec.Body.String(), "example.com") {
+			t.Fatalf("Expected a result page, got %d", rec.Code)
+		}
+		assertCacheHeaders(t, cacheNoStore, rec.Header())
+	}
+}
@@ -0,0 +1,253 @@
+package httpapi
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"runtime"
+	"runtime/debug"
+	"strings"
+	"time"
+
+	"email-verifier/pkg/verify"
+)
+
+// captureDir is where capture bundles are written; captures are off while
+// it is empty.
+var captureDir string
+
+// captureIDPattern matches the IDs newWatchID gives bundles, so a download
+// can never name a path outside captureDir.
+var captureIDPattern = regexp.MustCompile(`^[0-9a-f]{16}$`)
+
+const redactedAddress = "[redacted]"
+
+// captureBundle is everything known about one verification, written as a
+// single JSON file to attach to a bug report.
+type captureBundle struct {
+	ID         string            `json:"id"`
+	CapturedAt time.Time         `json:"captured_at"`
+	Redacted   bool              `json:"redacted"`
+	Config     captureConfig     `json:"config"`
+	Versions   map[string]string `json:"versions"`
+	DurationMS float64           `json:"duration_ms"`
+	Trace      *verify.Trace     `json:"trace"`
+	Result     *verify.Result    `json:"result"`
+}
+
+// captureConfig is the settings the verification ran under.
+type captureConfig struct {
+	Checks            []string `json:"checks"`
+	Tenant            string   `json:"tenant"`
+	ProfileGeneration int64    `json:"profile_generation"`
+	Profiles          []string `json:"profiles"`
+	NetworkDisabled   bool     `json:"network_disabled"`
+	RouteGroups       []string `json:"route_groups"`
+}
+
+// buildVersions reports the Go and verifier library versions.
+func buildVersions() map[string]string {
+	versions := map[string]string{"go": runtime.Version(), "email-verifier-library": "unknown"}
+	if info, ok := debug.ReadBuildInfo(); ok {
+		for _, dep := range info.Deps {
+			if dep.Path == "github.com/AfterShip/email-verifier" {
+				versions["email-verifier-library"] = dep.Version
+			}
+		}
+	}
+	return versions
+}
+
+// redact replaces the recipient wherever the bundle holds it. Domains,
+// which the DNS queries need, are kept.
+func (b *captureBundle) redact() {
+	b.Redacted = true
+	redactResult(b.Result)
+	for i := range b.Trace.Stages {
+		redactResult(&b.Trace.Stages[i].Result)
+	}
+	for i := range b.Trace.Probes {
+		probe := &b.Trace.Probes[i]
+		if probe.Username != "" {
+			probe.Username = redactedAddress
+		}
+		probe.Error = verify.RedactAddresses(probe.Error)
+		for j := range probe.Transcript {
+			probe.Transcript[j].Line = verify.RedactAddresses(probe.Transcript[j].Line)
+		}
+	}
+	for i := range b.Trace.DNS {
+		b.Trace.DNS[i].Error = verify.RedactAddresses(b.Trace.DNS[i].Error)
+	}
+}
+
+func redactResult(result *verify.Result) {
+	result.Email = redactedAddress
+	if result.Username != "" {
+		result.Username = redactedAddress
+	}
+	if result.NormalizedEmail != "" {
+		result.NormalizedEmail = redactedAddress
+	}
+	if result.DisplayName != "" {
+		result.DisplayName = redactedAddress
+	}
+	result.Error = verify.RedactAddresses(result.Error)
+	if result.Envelope != nil {
+		result.Envelope.OriginalAddress = verify.RedactAddresses(result.Envelope.OriginalAddress)
+		result.Envelope.VerifiedAddress = verify.RedactAddresses(result.Envelope.VerifiedAddress)
+	}
+	if result.Gravatar != nil {
+		result.Gravatar.GravatarURL = ""
+	}
+	if result.SMTPDetails != nil {
+		result.SMTPDetails.Message = verify.RedactAddresses(result.SMTPDetails.Message)
+	}
+	if result.SuggestionResult != nil {
+		redactResult(result.SuggestionResult)
+	}
+}
+
+// adminCaptureHandler runs one verification with full tracing and writes
+// the bundle to captureDir.
+func adminCaptureHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if captureDir == "" {
+		http.Error(w, "Captures are not configured (set -capture-dir)", http.StatusNotFound)
+		return
+	}
+
+	var request struct {
+		Email  string    `json:"email"`
+		Checks checkList `json:"checks"`
+		Key    string    `json:"key"`
+		Redact bool      `json:"redact"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil || request.Email == "" {
+		http.Error(w, `Expected {"email": "...", "checks": [...], "key": "...", "redact": true|false}`, http.StatusBadRequest)
+		return
+	}
+	checks, err := requestChecks(request.Checks, "", request.Key)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err := service.Ready(); err != nil {
+		writeVerifierUnavailable(w, err)
+		return
+	}
+
+	current, _ := service.Profiles().Status()
+	bundle := &captureBundle{
+		ID:         newWatchID(),
+		CapturedAt: time.Now().UTC(),
+		Config: captureConfig{
+			Checks:            checks.Names(),
+			Tenant:            service.TenantFor(request.Key),
+			ProfileGeneration: current.Generation,
+			Profiles:          current.Profiles,
+			NetworkDisabled:   service.NetworkDisabled(),
+		},
+		Versions: buildVersions(),
+		Trace:    verify.NewTrace(),
+	}
+	for _, group := range routeGroups {
+		if enabledGroups[group] {
+			bundle.Config.RouteGroups = append(bundle.Config.RouteGroups, string(group))
+		}
+	}
+
+	l := laneFor(checks)
+	ctx, cancel := context.WithTimeout(r.Context(), waitFor(l))
+	defer cancel()
+	started := time.Now()
+	opts := verify.Options{Checks: checks, Key: request.Key, Trace: bundle.Trace}
+	if err := l.Do(ctx, func() { bundle.Result = service.Verify(request.Email, opts) }); err != nil {
+		writeLaneBusy(w, l)
+		return
+	}
+	bundle.DurationMS = float64(time.Since(started).Microseconds()) / 1000
+	// Privacy mode writes no address to disk
+	if request.Redact || privacySalt != nil {
+		bundle.redact()
+	}
+
+	path, err := writeCapture(bundle)
+	if err != nil {
+		http.Error(w, "Failed to write capture: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Location", "/admin/capture/"+bundle.ID)
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"id":       bundle.ID,
+		"path":     path,
+		"download": "/admin/capture/" + bundle.ID,
+		"redacted": bundle.Redacted,
+	})
+}
+
+// writeCapture writes bundle to captureDir, readable only by the server's
+// user since an unredacted bundle holds the address.
+func writeCapture(bundle *captureBundle) (string, error) {
+	data, err := json.MarshalIndent(bundle, "", "  ")
+	if err != nil {
+		return "", err
+	}
+	if err := os.MkdirAll(captureDir, 0o700); err != nil {
+		return "", err
+	}
+	path := filepath.Join(captureDir, "capture-"+bundle.ID+".json")
+	return path, os.WriteFile(path, data, 0o600)
+}
+
+// adminCaptureDownloadHandler serves a bundle by ID.
+func adminCaptureDownloadHandler(w http.ResponseWriter, r *http.Request) {
+	id := r.PathValue("id")
+	if captureDir == "" || !captureIDPattern.MatchString(id) {
+		http.Error(w, "Capture not found", http.StatusNotFound)
+		return
+	}
+	data, err := os.ReadFile(filepath.Join(captureDir, "capture-"+id+".json"))
+	if err != nil {
+		http.Error(w, "Capture not found", http.StatusNotFound)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="capture-%s.json"`, id))
+	w.Write(data)
+}
+
+// sweepCaptures deletes bundles written more than ttl before now.
+func sweepCaptures(now time.Time, ttl time.Duration) int {
+	if captureDir == "" {
+		return 0
+	}
+	entries, err := os.ReadDir(captureDir)
+	if err != nil {
+		return 0
+	}
+	removed := 0
+	for _, entry := range entries {
+		name := entry.Name()
+		if !strings.HasPrefix(name, "capture-") || !strings.HasSuffix(name, ".json") {
+			continue
+		}
+		info, err := entry.Info()
+		if err != nil || now.Sub(info.ModTime()) < ttl {
+			continue
+		}
+		if os.Remove(filepath.Join(captureDir, name)) == nil {
+			removed++
+		}
+	}
+	return removed
+}
@@ -0,0 +1,146 @@
+package httpapi
+
+import (
+	"encoding/json"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"email-verifier/pkg/verify"
+	"email-verifier/pkg/verify/verifytest"
+)
+
+// useCaptureDir points captures at a temporary directory for the duration of a test
+func useCaptureDir(t *testing.T) string {
+	t.Helper()
+	saved := captureDir
+	captureDir = t.TempDir()
+	t.Cleanup(func() { captureDir = saved })
+	return captureDir
+}
+
+// capture posts body to /admin/capture and downloads the bundle it wrote
+func capture(t *testing.T, body string) map[string]interface{} {
+	t.Helper()
+	handler := Handler()
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/admin/capture", strings.NewReader(body)))
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("Expected status 201, got %d: %s", rec.Code, rec.Body.String())
+	}
+	var created struct {
+		ID       string `json:"id"`
+		Path     string `json:"path"`
+		Download string `json:"download"`
+	}
+	json.NewDecoder(rec.Body).Decode(&created)
+	if filepath.Dir(created.Path) != captureDir {
+		t.Errorf("Expected the bundle in %s, got %s", captureDir, created.Path)
+	}
+
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, created.Download, nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Expected the bundle download, got %d", rec.Code)
+	}
+	var bundle map[string]interface{}
+	if err := json.NewDecoder(rec.Body).Decode(&bundle); err != nil {
+		t.Fatalf("Failed to parse bundle: %v", err)
+	}
+	if bundle["id"] != created.ID {
+		t.Errorf("Expected bundle %s, got %v", created.ID, bundle["id"])
+	}
+	return bundle
+}
+
+// TestCaptureBundle tests that a capture records the queries, probes, stages and versions of one verification
+func TestCaptureBundle(t *testing.T) {
+	useCaptureDir(t)
+	fake := verifytest.NewResolver()
+	fake.MX["partner.mock"] = []*net.MX{{Host: "mx.partner.mock.", Pref: 10}}
+	smtp := verifytest.NewSMTP()
+	smtp.Mailboxes["jane@partner.mock"] = true
+	useService(t, verify.Config{Resolver: fake, Prober: smtp.Probe})
+
+	bundle := capture(t, `{"email": "jane@partner.mock", "checks": "smtp"}`)
+	raw, _ := json.Marshal(bundle)
+	trace := bundle["trace"].(map[string]interface{})
+	if dns := trace["dns"].([]interface{}); len(dns) != 1 || !strings.Contains(string(raw), `"10 mx.partner.mock."`) {
+		t.Errorf("Expected the MX query and its answer, got %v", dns)
+	}
+	if probes := trace["smtp_probes"].([]interface{}); len(probes) != 1 {
+		t.Errorf("Expected one probe, got %v", probes)
+	}
+	if stages := trace["stages"].([]interface{}); len(stages) != 4 {
+		t.Errorf("Expected four stages, got %d", len(stages))
+	}
+	if bundle["result"].(map[string]interface{})["verdict"] != verify.VerdictDeliverable {
+		t.Errorf("Expected the final result, got %v", bundle["result"])
+	}
+	if versions := bundle["versions"].(map[string]interface{}); versions["go"] == "" || versions["email-verifier-library"] == nil {
+		t.Errorf("Expected versions, got %v", versions)
+	}
+
+	redacted := capture(t, `{"email": "Jane Doe <jane@partner.mock>", "checks": "smtp", "redact": true}`)
+	raw, _ = json.Marshal(redacted)
+	if strings.Contains(string(raw), "jane") || strings.Contains(string(raw), "Jane Doe") || !strings.Contains(string(raw), "partner.mock") {
+		t.Errorf("Expected the recipient redacted and the domain kept, got %s", raw)
+	}
+}
+
+// TestCaptureRedactTranscript tests that redaction takes the recipient out of the SMTP transcript, where the RCPT command and the reply hold it
+func TestCaptureRedactTranscript(t *testing.T) {
+	trace := verify.NewTrace()
+	trace.Probes = append(trace.Probes, verify.TraceProbe{Domain: "partner.mock", Username: "jane", Transcript: []verify.TraceSMTP{
+		{Host: "mx.partner.mock", From: "client", Line: "RCPT TO:<jane@partner.mock>"},
+		{Host: "mx.partner.mock", From: "server", Line: "550 5.1.1 <jane@partner.mock>: User unknown"},
+	}})
+	bundle := &captureBundle{Trace: trace, Result: &verify.Result{Email: "jane@partner.mock"}}
+	bundle.redact()
+	raw, _ := json.Marshal(bundle)
+	if strings.Contains(string(raw), "jane") || trace.Probes[0].Transcript[0].Line != "RCPT TO:<[redacted]>" {
+		t.Errorf("Expected the RCPT address redacted, got %s", raw)
+	}
+}
+
+// TestCaptureDisabledAndMissing tests captures without a directory and downloads of unknown or malformed IDs
+func TestCaptureDisabledAndMissing(t *testing.T) {
+	handler := Handler()
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/admin/capture", strings.NewReader(`{"email": "jane@example.com"}`)))
+	if rec.Code != http.StatusNotFound {
+		t.Errorf("Expected 404 with captures off, got %d", rec.Code)
+	}
+
+	useCaptureDir(t)
+	for _, id := range []string{"0123456789abcdef", "..%2F..%2Fetc"} {
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/admin/capture/"+id, nil))
+		if rec.Code != http.StatusNotFound {
+			t.Errorf("Expected 404 for %s, got %d", id, rec.Code)
+		}
+	}
+}
+
+// TestSweepCaptures tests that the janitor deletes only expired bundles
+func TestSweepCaptures(t *testing.T) {
+	dir := useCaptureDir(t)
+	now := time.Now()
+	for name, age := range map[string]time.Duration{"capture-old.json": 48 * time.Hour, "capture-new.json": time.Hour, "notes.txt": 48 * time.Hour} {
+		path := filepath.Join(dir, name)
+		os.WriteFile(path, []byte("{}"), 0o600)
+		os.Chtimes(path, now.Add(-age), now.Add(-age))
+	}
+
+	if n := sweepCaptures(now, 24*time.Hour); n != 1 {
+		t.Errorf("Expected one bundle removed, got %d", n)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "capture-new.json")); err != nil {
+		t.Errorf("Expected the recent bundle kept, got %v", err)
+	}
+}
@@ -0,0 +1,18 @@
+package httpapi
+
+import (
+	"encoding/json"
+	"net/http"
+)
+
+// adminCircuitsHandler lists the domains whose SMTP circuits are open:
+// how many probes failed in a row, when the circuit opened and when the
+// next probe is let through.
+func adminCircuitsHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]any{"circuits": service.OpenCircuits()})
+}
@@ -0,0 +1,47 @@
+package httpapi
+
+import (
+	"encoding/json"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	emailverifier "github.com/AfterShip/email-verifier"
+
+	"email-verifier/pkg/verify"
+	"email-verifier/pkg/verify/verifytest"
+)
+
+// TestAdminCircuitsHandler tests that a domain that keeps timing out is listed and counted once its circuit opens
+func TestAdminCircuitsHandler(t *testing.T) {
+	fake := verifytest.NewResolver()
+	fake.MX["slow.mock"] = []*net.MX{{Host: "mx.slow.mock.", Pref: 10}}
+	smtp := verifytest.NewSMTP()
+	smtp.Errors["slow.mock"] = &emailverifier.LookupError{Message: emailverifier.ErrTimeout}
+	useService(t, verify.Config{Resolver: fake, Prober: smtp.Probe, Circuit: verify.CircuitConfig{Failures: 2}})
+	for _, email := range []string{"a@slow.mock", "b@slow.mock", "c@slow.mock"} {
+		postVerify(t, "", `{"email": "`+email+`", "checks": "smtp"}`)
+	}
+
+	rec := httptest.NewRecorder()
+	adminCircuitsHandler(rec, httptest.NewRequest(http.MethodGet, "/admin/circuits", nil))
+	var body struct {
+		Circuits []verify.OpenCircuit `json:"circuits"`
+	}
+	if err := json.NewDecoder(rec.Body).Decode(&body); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	if len(body.Circuits) != 1 || body.Circuits[0].Domain != "slow.mock" || body.Circuits[0].Failures != 2 || smtp.Probes() != 2 {
+		t.Errorf("Expected slow.mock open after two probes, got %d probes and %+v", smtp.Probes(), body.Circuits)
+	}
+	if open := metrics.Snapshot()["smtp_circuits_open"]; open != 1 {
+		t.Errorf("Expected smtp_circuits_open 1, got %d", open)
+	}
+
+	rec = httptest.NewRecorder()
+	adminCircuitsHandler(rec, httptest.NewRequest(http.MethodPost, "/admin/circuits", nil))
+	if rec.Code != http.StatusMethodNotAllowed {
+		t.Errorf("Expected status 405, got %d", rec.Code)
+	}
+}
@@ -0,0 +1,18 @@
+package httpapi
+
+import (
+	"encoding/json"
+	"net/http"
+)
+
+// adminComplianceHandler reports how the probing etiquette was kept: the
+// addresses probed, by hash, how often their answers were reused, each
+// mail server's probe counts and cooldowns, and the probes deferred.
+func adminComplianceHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(service.PoliteReport())
+}
@@ -0,0 +1,42 @@
+package httpapi
+
+import (
+	"encoding/json"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"email-verifier/pkg/verify"
+	"email-verifier/pkg/verify/verifytest"
+)
+
+// TestAdminComplianceHandler tests that the report shows repeated verifications answered from one probe
+func TestAdminComplianceHandler(t *testing.T) {
+	fake := verifytest.NewResolver()
+	fake.MX["partner.mock"] = []*net.MX{{Host: "mx.partner.mock.", Pref: 10}}
+	smtp := verifytest.NewSMTP()
+	useService(t, verify.Config{Resolver: fake, Prober: smtp.Probe})
+	for i := 0; i < 3; i++ {
+		postVerify(t, "", `{"email": "jane@partner.mock", "checks": "smtp"}`)
+	}
+
+	rec := httptest.NewRecorder()
+	adminComplianceHandler(rec, httptest.NewRequest(http.MethodGet, "/admin/compliance", nil))
+	var report verify.PoliteReport
+	if err := json.NewDecoder(rec.Body).Decode(&report); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	if report.Mode != "polite" || len(report.Addresses) != 1 || report.Addresses[0].Reused != 2 || smtp.Probes() != 1 {
+		t.Errorf("Expected one probe reused twice, got %d probes and %+v", smtp.Probes(), report)
+	}
+	if len(report.Hosts) != 1 || report.Hosts[0].Host != "mx.partner.mock" || report.Hosts[0].InWindow != 1 {
+		t.Errorf("Expected mx.partner.mock probed once, got %+v", report.Hosts)
+	}
+
+	rec = httptest.NewRecorder()
+	adminComplianceHandler(rec, httptest.NewRequest(http.MethodPost, "/admin/compliance", nil))
+	if rec.Code != http.StatusMethodNotAllowed {
+		t.Errorf("Expected status 405, got %d", rec.Code)
+	}
+}
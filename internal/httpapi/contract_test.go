@@ -0,0 +1,121 @@
+package httpapi
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"email-verifier/pkg/verify"
+)
+
+var update = flag.Bool("update", false, "rewrite golden files in testdata/golden")
+
+// goldenFixtures are the canonical shapes of the server's own resources;
+// verification results are covered by package verify's golden files.
+func goldenFixtures() map[string]interface{} {
+	checked := time.Date(2024, 3, 3, 12, 0, 0, 0, time.UTC)
+	result := &verify.Result{
+		Email:           "jane@partner.com",
+		IsValid:         true,
+		Reachable:       verify.ReachableUnknown,
+		ReachableReason: verify.ReachableReasonNotChecked,
+		Verdict:         verify.VerdictUnknown,
+		RiskFlags:       []string{},
+		HasMxRecords:    true,
+		DomainStatus:    verify.DomainHasMail,
+		ChecksPerformed: []string{verify.CheckSyntax, verify.CheckMX},
+		ChecksSkipped:   []string{verify.CheckSMTP},
+	}
+	var summary bulkSummary
+	summary.Summary.Total, summary.Summary.Completed, summary.Summary.Cancelled = 3, 2, true
+	summary.Summary.Counts = map[string]int{verify.VerdictDeliverable: 1, verify.VerdictUnknown: 1}
+
+	return map[string]interface{}{
+		"batch_summary": &summary,
+		"job": &jobView{
+			ID:              "3f4a93302314701b",
+			Status:          jobDone,
+			Total:           3,
+			Completed:       3,
+			ProgressPercent: 100,
+			Counts:          map[string]int{verify.VerdictUnknown: 3},
+			CreatedAt:       checked.Add(-time.Minute),
+			FinishedAt:      &checked,
+			Results:         []*verify.Result{result},
+			NextCursor:      "Mg",
+			RetryPending:    1,
+			Callback:        &callbackDelivery{URL: "https://hooks.partner.com/jobs", Status: callbackDelivered, Attempts: 2, LastError: "status 503", DeliveredAt: &checked},
+		},
+		"job_results": &jobResultsPage{
+			ID:         "3f4a93302314701b",
+			Status:     jobDone,
+			Results:    []*verify.Result{result},
+			NextCursor: "Mg",
+		},
+		"watch": &domainWatch{
+			ID:          "0123456789abcdef",
+			Domain:      "partner.com",
+			Interval:    "6h0m0s",
+			CreatedAt:   checked.Add(-time.Hour),
+			LastChecked: &checked,
+			NextCheck:   checked.Add(6 * time.Hour),
+			LastSeen:    &watchRecords{MX: []string{"mx1.partner.com"}, SPF: "v=spf1 -all"},
+			Changes: []watchChange{{
+				DetectedAt: checked,
+				MXAdded:    []string{"mx1.partner.com"},
+				MXRemoved:  []string{"mx.old-partner.com"},
+			}},
+		},
+	}
+}
+
+// TestGoldenContracts tests that response JSON matches the checked-in golden files byte for byte
+func TestGoldenContracts(t *testing.T) {
+	for name, fixture := range goldenFixtures() {
+		t.Run(name, func(t *testing.T) {
+			got, err := json.MarshalIndent(fixture, "", "  ")
+			if err != nil {
+				t.Fatalf("Failed to marshal fixture: %v", err)
+			}
+			got = append(got, '\n')
+
+			path := filepath.Join("testdata", "golden", name+".json")
+			if *update {
+				if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+					t.Fatal(err)
+				}
+				if err := os.WriteFile(path, got, 0o644); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			want, err := os.ReadFile(path)
+			if err != nil {
+				t.Fatalf("Missing golden file %s (run with -update to create it): %v", path, err)
+			}
+			if !bytes.Equal(got, want) {
+				t.Errorf("JSON shape changed for %s; if intentional, rerun with -update and commit the diff\n--- got\n%s\n--- want\n%s", name, got, want)
+			}
+		})
+	}
+}
+
+// TestGoldenFilesAreUsed tests that every golden file on disk has a fixture
+func TestGoldenFilesAreUsed(t *testing.T) {
+	fixtures := goldenFixtures()
+	files, err := filepath.Glob(filepath.Join("testdata", "golden", "*.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, file := range files {
+		name := filepath.Base(file)
+		name = name[:len(name)-len(".json")]
+		if _, ok := fixtures[name]; !ok {
+			t.Errorf("Golden file %s has no fixture; delete it or add the fixture back", file)
+		}
+	}
+}
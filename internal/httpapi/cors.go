@@ -0,0 +1,100 @@
+package httpapi
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// corsPolicy is the set of browser origins allowed to call the JSON API.
+type corsPolicy struct {
+	any     bool
+	origins map[string]bool
+}
+
+// cors is nil unless -cors-origins is set; without it no CORS headers are
+// sent and browsers keep to the same-origin policy.
+var cors *corsPolicy
+
+// corsMethods and corsHeaders are what a preflight allows: every method
+// the API routes answer and the request headers they read.
+const (
+	corsMethods       = "GET, POST, PATCH, DELETE"
+	corsHeaders       = "Content-Type, X-API-Key, X-Request-ID, X-Request-Deadline, X-Request-Timeout-Ms"
+	corsExposeHeaders = "X-Request-ID, X-Request-Deadline, Retry-After, X-RateLimit-Limit, X-RateLimit-Remaining, X-RateLimit-Reset"
+	corsMaxAge        = "600"
+)
+
+// parseCORSOrigins reads a comma-separated list of origins such as
+// https://app.example.com, or * for any. It returns nil for an empty list.
+func parseCORSOrigins(s string) (*corsPolicy, error) {
+	policy := &corsPolicy{origins: make(map[string]bool)}
+	for _, entry := range strings.Split(s, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		if entry == "*" {
+			policy.any = true
+			continue
+		}
+		u, err := url.Parse(entry)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" || (u.Path != "" && u.Path != "/") || u.RawQuery != "" || u.User != nil {
+			return nil, fmt.Errorf("cors origins: %q is not an origin like https://app.example.com", entry)
+		}
+		policy.origins[strings.ToLower(u.Scheme+"://"+u.Host)] = true
+	}
+	if !policy.any && len(policy.origins) == 0 {
+		return nil, nil
+	}
+	return policy, nil
+}
+
+// allowOrigin returns the Access-Control-Allow-Origin value for origin, or
+// "" if it isn't allowed.
+func (p *corsPolicy) allowOrigin(origin string) string {
+	if p.any {
+		return "*"
+	}
+	if p.origins[strings.ToLower(origin)] {
+		return origin
+	}
+	return ""
+}
+
+// withCORS answers preflights itself, before keys and rate limits are
+// checked, since browsers send them without either. Actual requests get
+// Access-Control-Allow-Origin if their origin is allowed. A disallowed
+// origin gets no CORS headers and the browser refuses the response.
+func withCORS(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if cors == nil {
+			next.ServeHTTP(w, r)
+			return
+		}
+		if !cors.any {
+			w.Header().Add("Vary", "Origin")
+		}
+		origin := r.Header.Get("Origin")
+		allowed := ""
+		if origin != "" {
+			allowed = cors.allowOrigin(origin)
+		}
+		if r.Method == http.MethodOptions && origin != "" && r.Header.Get("Access-Control-Request-Method") != "" {
+			if allowed != "" {
+				w.Header().Set("Access-Control-Allow-Origin", allowed)
+				w.Header().Set("Access-Control-Allow-Methods", corsMethods)
+				w.Header().Set("Access-Control-Allow-Headers", corsHeaders)
+				w.Header().Set("Access-Control-Max-Age", corsMaxAge)
+			}
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+		if allowed != "" {
+			w.Header().Set("Access-Control-Allow-Origin", allowed)
+			w.Header().Set("Access-Control-Expose-Headers", corsExposeHeaders)
+		}
+		next.ServeHTTP(w, r)
+	})
+}
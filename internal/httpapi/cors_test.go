@@ -0,0 +1,82 @@
+package httpapi
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// useCORS allows the origins in list for the test
+func useCORS(t *testing.T, list string) {
+	t.Helper()
+	policy, err := parseCORSOrigins(list)
+	if err != nil {
+		t.Fatalf("Failed to parse origins: %v", err)
+	}
+	saved := cors
+	cors = policy
+	t.Cleanup(func() { cors = saved })
+}
+
+// TestCORS tests preflights and actual requests from allowed and disallowed origins, ahead of the API key check
+func TestCORS(t *testing.T) {
+	useStreamService(t)
+	useCORS(t, "https://app.example.com, http://localhost:3000")
+	useAPIKeys(t, "web=k-web-123")
+	handler := Handler()
+	send := func(method, origin string, header map[string]string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, "/api/verify", strings.NewReader(`{"email": "jane@partner.mock"}`))
+		if origin != "" {
+			req.Header.Set("Origin", origin)
+		}
+		for name, value := range header {
+			req.Header.Set(name, value)
+		}
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		return rec
+	}
+	preflight := map[string]string{"Access-Control-Request-Method": "POST", "Access-Control-Request-Headers": "content-type, x-api-key"}
+
+	rec := send(http.MethodOptions, "https://app.example.com", preflight)
+	if rec.Code != http.StatusNoContent || rec.Header().Get("Access-Control-Allow-Origin") != "https://app.example.com" {
+		t.Errorf("Expected 204 allowing the origin, got %d %v", rec.Code, rec.Header())
+	}
+	if !strings.Contains(rec.Header().Get("Access-Control-Allow-Methods"), "POST") || !strings.Contains(rec.Header().Get("Access-Control-Allow-Headers"), "X-API-Key") {
+		t.Errorf("Expected POST and X-API-Key allowed, got %v", rec.Header())
+	}
+	if rec := send(http.MethodOptions, "https://evil.example", preflight); rec.Code != http.StatusNoContent || rec.Header().Get("Access-Control-Allow-Origin") != "" {
+		t.Errorf("Expected 204 without Allow-Origin for a disallowed origin, got %d %v", rec.Code, rec.Header())
+	}
+
+	rec = send(http.MethodPost, "http://localhost:3000", map[string]string{"X-API-Key": "k-web-123"})
+	if rec.Code != http.StatusOK || rec.Header().Get("Access-Control-Allow-Origin") != "http://localhost:3000" || !strings.Contains(rec.Header().Get("Access-Control-Expose-Headers"), "X-Request-ID") {
+		t.Errorf("Expected the response readable from the origin, got %d %v", rec.Code, rec.Header())
+	}
+	if rec.Header().Values("Vary") == nil || !strings.Contains(strings.Join(rec.Header().Values("Vary"), ","), "Origin") {
+		t.Errorf("Expected Vary: Origin, got %v", rec.Header())
+	}
+	if rec := send(http.MethodPost, "https://app.example.com", nil); rec.Code != http.StatusUnauthorized || rec.Header().Get("Access-Control-Allow-Origin") == "" {
+		t.Errorf("Expected a readable 401 without a key, got %d %v", rec.Code, rec.Header())
+	}
+	if rec := send(http.MethodPost, "https://evil.example", map[string]string{"X-API-Key": "k-web-123"}); rec.Code != http.StatusOK || rec.Header().Get("Access-Control-Allow-Origin") != "" {
+		t.Errorf("Expected no Allow-Origin for a disallowed origin, got %d %v", rec.Code, rec.Header())
+	}
+
+	useCORS(t, "*")
+	if rec := send(http.MethodOptions, "https://anywhere.example", preflight); rec.Header().Get("Access-Control-Allow-Origin") != "*" {
+		t.Errorf("Expected * allowed, got %v", rec.Header())
+	}
+
+	useCORS(t, "")
+	if rec := send(http.MethodPost, "https://app.example.com", map[string]string{"X-API-Key": "k-web-123"}); rec.Header().Get("Access-Control-Allow-Origin") != "" || rec.Header().Get("Vary") == "Origin" {
+		t.Errorf("Expected no CORS headers when off, got %v", rec.Header())
+	}
+
+	for _, bad := range []string{"app.example.com", "https://app.example.com/signup", "ftp://app.example.com"} {
+		if _, err := parseCORSOrigins(bad); err == nil {
+			t.Errorf("Expected an error for %q", bad)
+		}
+	}
+}
@@ -0,0 +1,193 @@
+package httpapi
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"email-verifier/pkg/verify"
+)
+
+// csvUploadColumns are appended to every row of an uploaded CSV.
+var csvUploadColumns = []string{"is_valid", "reachable", "disposable", "free", "role_account", "has_mx_records", "error"}
+
+// emailColumnNames are the header names taken as the email column when
+// the upload doesn't name one.
+var emailColumnNames = map[string]bool{"email": true, "e-mail": true, "email_address": true, "mail": true}
+
+// apiVerifyCSVHandler verifies the addresses in an uploaded CSV and
+// answers with the same CSV, verification columns appended. The first row
+// is the header. The email column is the one named by the column
+// parameter, or else the one headed email, or else the first whose first
+// value looks like an address. Rows are verified in chunks through the
+// lanes, as batch jobs are, and each chunk is written as soon as it is
+// done; a row whose address can't be verified keeps its place with the
+// reason in the error column.
+func apiVerifyCSVHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	header, rows, column, ok := readCSVUpload(w, r, maxPaste)
+	if !ok {
+		return
+	}
+	defer r.MultipartForm.RemoveAll()
+
+	if err := service.Ready(); err != nil {
+		writeVerifierUnavailable(w, err)
+		return
+	}
+	key := requestKey(r)
+	checks, err := requestChecks(nil, r.FormValue("checks"), key)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	opts := verify.Options{Checks: checks, Key: key, Context: r.Context()}
+
+	w.Header().Set("Content-Type", "text/csv; charset=utf-8")
+	w.Header().Set("Content-Disposition", `attachment; filename="verified.csv"`)
+	cw := csv.NewWriter(w)
+	cw.Write(append(header, csvUploadColumns...))
+	flusher, _ := w.(http.Flusher)
+	for start := 0; start < len(rows); start += jobChunkSize {
+		chunk := rows[start:min(start+jobChunkSize, len(rows))]
+		emails := make([]string, len(chunk))
+		for i, row := range chunk {
+			if column < len(row) {
+				emails[i] = row[column]
+			}
+		}
+		var results []*verify.Result
+		if err := laneFor(checks).Do(r.Context(), func() { results, _ = service.VerifyBatch(emails, opts) }); err != nil {
+			// The caller went away; what was written is all they get
+			return
+		}
+		for i, result := range results {
+			recordResult(key, result, 0)
+			// Short rows are padded so the added columns line up
+			row := append(make([]string, 0, max(len(chunk[i]), len(header))+len(csvUploadColumns)), chunk[i]...)
+			for len(row) < len(header) {
+				row = append(row, "")
+			}
+			cw.Write(append(row,
+				strconv.FormatBool(result.IsValid),
+				result.Reachable,
+				strconv.FormatBool(result.Disposable),
+				strconv.FormatBool(result.Free),
+				strconv.FormatBool(result.RoleAccount),
+				strconv.FormatBool(result.HasMxRecords),
+				result.ErrorCode,
+			))
+		}
+		cw.Flush()
+		if flusher != nil {
+			flusher.Flush()
+		}
+	}
+}
+
+// readCSVUpload parses the CSV in a multipart upload's file field and finds
+// its email column, as named by the column field. It answers the request
+// itself if the upload is unusable. Once it succeeds the caller must
+// remove the form's temporary files.
+func readCSVUpload(w http.ResponseWriter, r *http.Request, maxRows int) (header []string, rows [][]string, column int, ok bool) {
+	r.Body = http.MaxBytesReader(w, r.Body, maxCSVUpload)
+	if err := r.ParseMultipartForm(maxCSVUpload); err != nil {
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			writeUploadTooLarge(w)
+			return nil, nil, 0, false
+		}
+		http.Error(w, "Expected a multipart/form-data upload with a file field", http.StatusBadRequest)
+		return nil, nil, 0, false
+	}
+	defer func() {
+		if !ok {
+			r.MultipartForm.RemoveAll()
+		}
+	}()
+	file, _, err := r.FormFile("file")
+	if err != nil {
+		http.Error(w, "file is required", http.StatusBadRequest)
+		return nil, nil, 0, false
+	}
+	defer file.Close()
+	data, err := io.ReadAll(file)
+	if err != nil {
+		http.Error(w, "Failed to read the upload", http.StatusBadRequest)
+		return nil, nil, 0, false
+	}
+
+	cr := csv.NewReader(bytes.NewReader(bytes.TrimPrefix(data, []byte("\xef\xbb\xbf"))))
+	cr.FieldsPerRecord = -1
+	rows, err = cr.ReadAll()
+	if err != nil {
+		http.Error(w, "Invalid CSV: "+err.Error(), http.StatusBadRequest)
+		return nil, nil, 0, false
+	}
+	if len(rows) == 0 {
+		http.Error(w, "The CSV is empty", http.StatusBadRequest)
+		return nil, nil, 0, false
+	}
+	header, rows = rows[0], rows[1:]
+	if len(rows) > maxRows {
+		http.Error(w, fmt.Sprintf("Too many rows (at most %d per upload)", maxRows), http.StatusRequestEntityTooLarge)
+		return nil, nil, 0, false
+	}
+	column, err = emailColumn(header, rows, r.FormValue("column"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return nil, nil, 0, false
+	}
+	return header, rows, column, true
+}
+
+// emailColumn finds the email column: the one named, else one with a
+// known header name, else the first whose first value contains an @.
+func emailColumn(header []string, rows [][]string, named string) (int, error) {
+	names := make([]string, len(header))
+	for i, name := range header {
+		names[i] = strings.ToLower(strings.TrimSpace(name))
+	}
+	if named != "" {
+		for i, name := range names {
+			if name == strings.ToLower(strings.TrimSpace(named)) {
+				return i, nil
+			}
+		}
+		return 0, fmt.Errorf("column %q is not in the header", named)
+	}
+	for i, name := range names {
+		if emailColumnNames[name] {
+			return i, nil
+		}
+	}
+	if len(rows) > 0 {
+		for i, value := range rows[0] {
+			if strings.Contains(value, "@") {
+				return i, nil
+			}
+		}
+	}
+	return 0, errors.New("no email column found; name it with the column parameter")
+}
+
+// writeUploadTooLarge reports an upload over maxCSVUpload.
+func writeUploadTooLarge(w http.ResponseWriter) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusRequestEntityTooLarge)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"error":     "upload_too_large",
+		"detail":    fmt.Sprintf("The upload is larger than the %d byte limit", maxCSVUpload),
+		"max_bytes": maxCSVUpload,
+	})
+}
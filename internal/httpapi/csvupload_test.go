@@ -0,0 +1,100 @@
+package httpapi
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// postCSV uploads content as the file field to /api/verify/csv with query
+// appended
+func postCSV(t *testing.T, query, content string) *httptest.ResponseRecorder {
+	t.Helper()
+	var body bytes.Buffer
+	mw := multipart.NewWriter(&body)
+	part, _ := mw.CreateFormFile("file", "contacts.csv")
+	part.Write([]byte(content))
+	mw.Close()
+	req := httptest.NewRequest(http.MethodPost, "/api/verify/csv"+query, &body)
+	req.Header.Set("Content-Type", mw.FormDataContentType())
+	rec := httptest.NewRecorder()
+	apiVerifyCSVHandler(rec, req)
+	return rec
+}
+
+// TestCSVUpload tests that every row comes back in order with the verification columns appended
+func TestCSVUpload(t *testing.T) {
+	useStreamService(t)
+	rec := postCSV(t, "?checks=smtp", "\xef\xbb\xbfName,Email,Team\nJane,jane@partner.mock,Sales\nBad,not-an-address,Ops\nShort\n")
+	if rec.Code != http.StatusOK || rec.Header().Get("Content-Type") != "text/csv; charset=utf-8" {
+		t.Fatalf("Expected a CSV with status 200, got %d %q: %s", rec.Code, rec.Header().Get("Content-Type"), rec.Body)
+	}
+	rows, err := csv.NewReader(rec.Body).ReadAll()
+	if err != nil {
+		t.Fatalf("Failed to parse response: %v", err)
+	}
+	expected := [][]string{
+		{"Name", "Email", "Team", "is_valid", "reachable", "disposable", "free", "role_account", "has_mx_records", "error"},
+		{"Jane", "jane@partner.mock", "Sales", "true", "yes", "false", "false", "false", "true", ""},
+		{"Bad", "not-an-address", "Ops", "false", "unknown", "false", "false", "false", "false", "invalid_syntax"},
+		{"Short", "", "", "false", "unknown", "false", "false", "false", "false", "email_required"},
+	}
+	if !reflect.DeepEqual(rows, expected) {
+		t.Errorf("Expected %v, got %v", expected, rows)
+	}
+}
+
+// TestCSVUploadColumn tests naming and detecting the email column
+func TestCSVUploadColumn(t *testing.T) {
+	useStreamService(t)
+	testCases := []struct {
+		query, content, email string
+		code                  int
+	}{
+		{"?column=work&checks=smtp", "home,work\nj@home.mock,jane@partner.mock\n", "jane@partner.mock", http.StatusOK},
+		{"?checks=smtp", "contact,notes\njane@partner.mock,vip\n", "jane@partner.mock", http.StatusOK},
+		{"?column=missing", "email\njane@partner.mock\n", "", http.StatusBadRequest},
+		{"", "name,notes\nJane,vip\n", "", http.StatusBadRequest},
+		{"", "", "", http.StatusBadRequest},
+	}
+	for _, tc := range testCases {
+		rec := postCSV(t, tc.query, tc.content)
+		if rec.Code != tc.code {
+			t.Errorf("Expected status %d for %q, got %d", tc.code, tc.content, rec.Code)
+			continue
+		}
+		if tc.code == http.StatusOK && !strings.Contains(rec.Body.String(), tc.email+",true,yes") && !strings.Contains(rec.Body.String(), tc.email+",vip,true,yes") {
+			t.Errorf("Expected %s verified as the email column, got %s", tc.email, rec.Body)
+		}
+	}
+}
+
+// TestCSVUploadLimits tests the errors for oversized uploads and requests that aren't uploads
+func TestCSVUploadLimits(t *testing.T) {
+	useStreamService(t)
+	saved := maxCSVUpload
+	maxCSVUpload = 1024
+	t.Cleanup(func() { maxCSVUpload = saved })
+
+	rec := postCSV(t, "", "email\n"+strings.Repeat("jane@partner.mock\n", 100))
+	var body struct {
+		Error    string `json:"error"`
+		MaxBytes int64  `json:"max_bytes"`
+	}
+	json.NewDecoder(rec.Body).Decode(&body)
+	if rec.Code != http.StatusRequestEntityTooLarge || body.Error != "upload_too_large" || body.MaxBytes != 1024 {
+		t.Errorf("Expected status 413 with upload_too_large, got %d %+v", rec.Code, body)
+	}
+
+	rec = httptest.NewRecorder()
+	apiVerifyCSVHandler(rec, httptest.NewRequest(http.MethodPost, "/api/verify/csv", strings.NewReader(`{"emails": []}`)))
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("Expected status 400 without an upload, got %d", rec.Code)
+	}
+}
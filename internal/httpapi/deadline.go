@@ -0,0 +1,80 @@
+package httpapi
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// Callers pass their deadline in one of these headers, after the internal
+// RPC convention: an absolute RFC 3339 time or a budget in milliseconds.
+const (
+	headerRequestDeadline = "X-Request-Deadline"
+	headerRequestTimeout  = "X-Request-Timeout-Ms"
+)
+
+// maxRequestDeadline caps how far ahead a caller's deadline is honored.
+var maxRequestDeadline = 30 * time.Second
+
+// maxDeadlineMargin caps the part of a budget set aside for writing the
+// response, so it arrives before the caller gives up.
+const maxDeadlineMargin = 250 * time.Millisecond
+
+// requestDeadline returns the deadline a request's headers ask for, at most
+// maxRequestDeadline from now. If both headers are sent the earlier wins.
+func requestDeadline(r *http.Request, now time.Time) (deadline time.Time, ok bool, err error) {
+	if value := r.Header.Get(headerRequestDeadline); value != "" {
+		deadline, err = time.Parse(time.RFC3339Nano, value)
+		if err != nil {
+			return time.Time{}, false, fmt.Errorf("Invalid %s (use an RFC 3339 time)", headerRequestDeadline)
+		}
+		if !deadline.After(now) {
+			return time.Time{}, false, fmt.Errorf("%s has already passed", headerRequestDeadline)
+		}
+		ok = true
+	}
+	if value := r.Header.Get(headerRequestTimeout); value != "" {
+		ms, err := strconv.ParseInt(value, 10, 64)
+		if err != nil || ms <= 0 {
+			return time.Time{}, false, fmt.Errorf("Invalid %s (use a positive number of milliseconds)", headerRequestTimeout)
+		}
+		budget := time.Duration(min(ms, int64(maxRequestDeadline/time.Millisecond))) * time.Millisecond
+		if d := now.Add(budget); !ok || d.Before(deadline) {
+			deadline = d
+		}
+		ok = true
+	}
+	if !ok {
+		return time.Time{}, false, nil
+	}
+	if limit := now.Add(maxRequestDeadline); deadline.After(limit) {
+		deadline = limit
+	}
+	return deadline, true, nil
+}
+
+// withDeadline bounds an API request's context by the caller's deadline,
+// less a margin of a tenth of the budget for the response, and echoes the
+// deadline the server works to in X-Request-Deadline. Verifications that
+// run out of time answer with what they have.
+func withDeadline(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		now := time.Now()
+		deadline, ok, err := requestDeadline(r, now)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if !ok {
+			next.ServeHTTP(w, r)
+			return
+		}
+		deadline = deadline.Add(-min(deadline.Sub(now)/10, maxDeadlineMargin))
+		ctx, cancel := context.WithDeadline(r.Context(), deadline)
+		defer cancel()
+		w.Header().Set(headerRequestDeadline, deadline.UTC().Format(time.RFC3339Nano))
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
@@ -0,0 +1,118 @@
+package httpapi
+
+import (
+	"encoding/json"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"email-verifier/pkg/verify"
+	"email-verifier/pkg/verify/verifytest"
+)
+
+// TestRequestDeadline tests parsing and clamping of the deadline headers
+func TestRequestDeadline(t *testing.T) {
+	now := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name     string
+		deadline string
+		timeout  string
+		want     time.Duration // from now; 0 for no deadline
+		invalid  bool
+	}{
+		{"none", "", "", 0, false},
+		{"timeout", "", "1500", 1500 * time.Millisecond, false},
+		{"deadline", "2024-05-01T12:00:02Z", "", 2 * time.Second, false},
+		{"fractional deadline", "2024-05-01T14:00:00.5+02:00", "", 500 * time.Millisecond, false},
+		{"earlier wins", "2024-05-01T12:00:02Z", "800", 800 * time.Millisecond, false},
+		{"timeout clamped", "", "3600000", maxRequestDeadline, false},
+		{"huge timeout clamped", "", "9223372036854775807", maxRequestDeadline, false},
+		{"deadline clamped", "2024-05-02T12:00:00Z", "", maxRequestDeadline, false},
+		{"zero timeout", "", "0", 0, true},
+		{"negative timeout", "", "-5", 0, true},
+		{"non-numeric timeout", "", "2s", 0, true},
+		{"malformed deadline", "tomorrow", "", 0, true},
+		{"unix deadline", "1714564800", "", 0, true},
+		{"past deadline", "2024-05-01T11:59:59Z", "", 0, true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPost, "/api/verify", nil)
+			if test.deadline != "" {
+				req.Header.Set(headerRequestDeadline, test.deadline)
+			}
+			if test.timeout != "" {
+				req.Header.Set(headerRequestTimeout, test.timeout)
+			}
+			deadline, ok, err := requestDeadline(req, now)
+			switch {
+			case test.invalid:
+				if err == nil {
+					t.Errorf("Expected an error, got %v", deadline)
+				}
+			case err != nil:
+				t.Errorf("Expected no error, got %v", err)
+			case ok != (test.want != 0) || ok && !deadline.Equal(now.Add(test.want)):
+				t.Errorf("Expected %v from now, got %v (%v)", test.want, deadline.Sub(now), ok)
+			}
+		})
+	}
+}
+
+// TestDeadlinePropagation tests that a slow mail server can't hold an API response past the caller's deadline
+func TestDeadlinePropagation(t *testing.T) {
+	fake := verifytest.NewResolver()
+	fake.MX["partner.mock"] = []*net.MX{{Host: "mx.partner.mock.", Pref: 10}}
+	smtp := verifytest.NewSMTP()
+	smtp.Delay = 3 * time.Second
+	useService(t, verify.Config{Resolver: fake, Prober: smtp.Probe})
+
+	req := httptest.NewRequest(http.MethodPost, "/api/verify", strings.NewReader(`{"email": "jane@partner.mock", "checks": "smtp"}`))
+	req.Header.Set(headerRequestTimeout, "300")
+	rec := httptest.NewRecorder()
+	start := time.Now()
+	Handler().ServeHTTP(rec, req)
+	elapsed := time.Since(start)
+
+	if elapsed >= 300*time.Millisecond {
+		t.Errorf("Expected the response before the 300ms deadline, took %v", elapsed)
+	}
+	var result verify.Result
+	json.NewDecoder(rec.Body).Decode(&result)
+	if rec.Code != http.StatusOK || result.ErrorCode != verify.ErrCodeDeadlineExceeded || result.Reachable != "unknown" || !result.HasMxRecords {
+		t.Errorf("Expected a partial result with %s, got %d %+v", verify.ErrCodeDeadlineExceeded, rec.Code, result)
+	}
+	effective, err := time.Parse(time.RFC3339Nano, rec.Header().Get(headerRequestDeadline))
+	if err != nil || effective.Before(start) || effective.After(start.Add(300*time.Millisecond)) {
+		t.Errorf("Expected the effective deadline echoed, got %q", rec.Header().Get(headerRequestDeadline))
+	}
+
+	// Without a deadline nothing is cut short, and nothing is echoed
+	useService(t, verify.Config{Resolver: fake, Prober: verifytest.NewSMTP().Probe})
+	rec, fields := verifyRef(t, "", "", `{"email": "jane@partner.mock", "checks": "smtp"}`)
+	if fields["error_code"] != nil || rec.Header().Get(headerRequestDeadline) != "" {
+		t.Errorf("Expected a full result without a deadline header, got %v %v", fields, rec.Header())
+	}
+}
+
+// TestDeadlineRejected tests that invalid deadline headers get 400 on API routes and are ignored elsewhere
+func TestDeadlineRejected(t *testing.T) {
+	req := httptest.NewRequest(http.MethodPost, "/api/verify", strings.NewReader(`{"email": "jane@example.com"}`))
+	req.Header.Set(headerRequestTimeout, "soon")
+	rec := httptest.NewRecorder()
+	Handler().ServeHTTP(rec, req)
+	if rec.Code != http.StatusBadRequest || !strings.Contains(rec.Body.String(), headerRequestTimeout) {
+		t.Errorf("Expected 400 naming the header, got %d %s", rec.Code, rec.Body.String())
+	}
+
+	req = httptest.NewRequest(http.MethodGet, "/health", nil)
+	req.Header.Set(headerRequestTimeout, "soon")
+	rec = httptest.NewRecorder()
+	Handler().ServeHTTP(rec, req)
+	if rec.Code != http.StatusOK {
+		t.Errorf("Expected the header ignored outside the API, got %d", rec.Code)
+	}
+}
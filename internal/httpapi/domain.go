@@ -0,0 +1,22 @@
+package httpapi
+
+import (
+	"encoding/json"
+	"net/http"
+)
+
+// apiDomainHandler serves GET /api/domain/{domain}: the mail setup and
+// list facts of a domain, for callers with only a domain to go on.
+func apiDomainHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if err := service.Ready(); err != nil {
+		writeVerifierUnavailable(w, err)
+		return
+	}
+	result := service.InspectDomain(r.Context(), r.PathValue("domain"), requestKey(r))
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(result)
+}
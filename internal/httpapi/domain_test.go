@@ -0,0 +1,38 @@
+package httpapi
+
+import (
+	"encoding/json"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"email-verifier/pkg/verify"
+	"email-verifier/pkg/verify/verifytest"
+)
+
+// TestDomainHandler tests that a domain is inspected without an address and that IDN domains are looked up in punycode
+func TestDomainHandler(t *testing.T) {
+	fake := verifytest.NewResolver()
+	fake.MX["xn--bcher-kva.mock"] = []*net.MX{{Host: "mx.xn--bcher-kva.mock.", Pref: 10}}
+	useService(t, verify.Config{Resolver: fake})
+
+	inspect := func(method, domain string) (int, verify.DomainResult) {
+		rec := httptest.NewRecorder()
+		Handler().ServeHTTP(rec, httptest.NewRequest(method, "/api/domain/"+domain, nil))
+		var result verify.DomainResult
+		json.Unmarshal(rec.Body.Bytes(), &result)
+		return rec.Code, result
+	}
+
+	code, result := inspect(http.MethodGet, "B%C3%BCcher.mock")
+	if code != http.StatusOK || result.Domain != "xn--bcher-kva.mock" || !result.HasMxRecords || len(result.MXRecords) != 1 || result.MXRecords[0].Host != "mx.xn--bcher-kva.mock" {
+		t.Errorf("Expected the IDN domain's MX host, got %d %+v", code, result)
+	}
+	if _, result := inspect(http.MethodGet, "missing.mock"); result.HasMxRecords || result.DomainStatus != verify.DomainNXDomain {
+		t.Errorf("Expected a missing domain, got %+v", result)
+	}
+	if code, _ := inspect(http.MethodPost, "missing.mock"); code != http.StatusMethodNotAllowed {
+		t.Errorf("Expected status 405, got %d", code)
+	}
+}
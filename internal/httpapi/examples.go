@@ -0,0 +1,331 @@
+package httpapi
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"html/template"
+	"log"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	emailverifier "github.com/AfterShip/email-verifier"
+
+	"email-verifier/pkg/verify"
+	"email-verifier/pkg/verify/verifytest"
+)
+
+// The examples are recorded rather than written by hand: the real router
+// answers canned requests against fake DNS and SMTP, so the documented
+// responses can't drift from what the handlers send.
+const (
+	exampleKey    = "example-key"
+	exampleSource = "esp"
+	exampleSecret = "example-secret"
+)
+
+// docExample is one recorded request and its response.
+type docExample struct {
+	ID              string            `json:"id"`
+	Endpoint        string            `json:"endpoint"` // the route pattern
+	Name            string            `json:"name"`
+	Method          string            `json:"method"`
+	Path            string            `json:"path"`
+	RequestHeaders  map[string]string `json:"request_headers,omitempty"`
+	RequestBody     string            `json:"request_body,omitempty"`
+	Status          int               `json:"status"`
+	ResponseHeaders map[string]string `json:"response_headers,omitempty"`
+	ResponseBody    string            `json:"response_body"`
+	// Curl is the request as a curl command against the host serving it.
+	Curl string `json:"curl,omitempty"`
+}
+
+// exampleResponseHeaders are the response headers worth showing.
+var exampleResponseHeaders = []string{"Content-Type", "Location", "Retry-After"}
+
+// docExamples records the examples once. Start calls it before serving,
+// since recording swaps package state; see exampleSandbox. It is set in
+// init because recording goes through the routes that serve it.
+var docExamples func() []docExample
+
+func init() {
+	docExamples = sync.OnceValue(buildExamples)
+}
+
+// exampleService verifies against canned DNS and SMTP: acme.io knows only
+// jane.doe, catchall-corp.io accepts everything and slowmail.io greylists.
+func exampleService() *verify.Service {
+	dns := verifytest.NewResolver()
+	for _, domain := range []string{"acme.io", "catchall-corp.io", "slowmail.io", "mailinator.com"} {
+		dns.MX[domain] = []*net.MX{{Host: "mx1." + domain + ".", Pref: 10}}
+	}
+	smtp := verifytest.NewSMTP()
+	smtp.Mailboxes["jane.doe@acme.io"] = true
+	smtp.CatchAll["catchall-corp.io"] = true
+	smtp.Errors["slowmail.io"] = emailverifier.ParseSMTPError(errors.New("450 4.7.1 Greylisted, please try again later"))
+	return verify.New(verify.Config{Resolver: dns, Prober: smtp.Probe, BuildVerifier: verifytest.NewListVerifier})
+}
+
+// exampleSandbox runs fn with the service replaced by fake and every store
+// the API handlers write to replaced by an empty one, and restores them
+// once fn and the jobs it started are done. It swaps package state, so it
+// must not run while the server takes requests. The process-wide metrics
+// still count the example requests.
+func exampleSandbox(fake *verify.Service, fn func()) {
+	savedService, savedHistory, savedUsage, savedForwarder, savedShadow := service, history, usage, forwarder, shadow
+	savedJobs, savedPlans, savedProjects, savedWatches, savedSync := jobs, plans, projects, watches, suppressionSync
+	savedOutcomes, savedCache, savedKeys, savedLimit, savedLog := outcomes, verifyCache, apiKeys, rateLimit, historyLog
+	defer func() {
+		jobs.Wait()
+		service, history, usage, forwarder, shadow = savedService, savedHistory, savedUsage, savedForwarder, savedShadow
+		jobs, plans, projects, watches, suppressionSync = savedJobs, savedPlans, savedProjects, savedWatches, savedSync
+		outcomes, verifyCache, apiKeys, rateLimit, historyLog = savedOutcomes, savedCache, savedKeys, savedLimit, savedLog
+	}()
+
+	service, history, usage, forwarder, shadow = fake, newHistoryStore(), newUsageMeter(), newResultForwarder(nil), nil
+	jobs, plans, projects, outcomes = newJobRegistry(), newPlanRegistry(time.Hour), newProjectStore(), newOutcomeTracker()
+	verifyCache = newResultCache(time.Hour, 100)
+	apiKeys, rateLimit, historyLog = nil, nil, nil
+	watches = newWatchRegistry(nil, 0, time.Minute)
+	suppressionSync = newSuppressionSyncer(map[string]*suppressionSource{
+		exampleSource: {Tenant: verify.DefaultTenant, Secret: exampleSecret, name: exampleSource},
+	})
+	fn()
+}
+
+// exampleRecorder sends requests through handler and keeps what they got.
+type exampleRecorder struct {
+	handler  http.Handler
+	examples []docExample
+}
+
+// do records one request as the example key. A JSON body is sent as JSON.
+// It returns the decoded response object, if any, for later requests.
+func (er *exampleRecorder) do(endpoint, name, method, path, body string, headers map[string]string) map[string]interface{} {
+	req := httptest.NewRequest(method, path, strings.NewReader(body))
+	shown := map[string]string{"X-API-Key": exampleKey}
+	if body != "" {
+		shown["Content-Type"] = "application/json"
+	}
+	for k, v := range headers {
+		shown[k] = v
+	}
+	for k, v := range shown {
+		req.Header.Set(k, v)
+	}
+	rec := httptest.NewRecorder()
+	er.handler.ServeHTTP(rec, req)
+
+	example := docExample{
+		ID:              fmt.Sprintf("example-%d", len(er.examples)+1),
+		Endpoint:        endpoint,
+		Name:            name,
+		Method:          method,
+		Path:            path,
+		RequestHeaders:  shown,
+		RequestBody:     body,
+		Status:          rec.Code,
+		ResponseHeaders: map[string]string{},
+		ResponseBody:    rec.Body.String(),
+	}
+	for _, k := range exampleResponseHeaders {
+		if v := rec.Header().Get(k); v != "" {
+			example.ResponseHeaders[k] = v
+		}
+	}
+	var decoded map[string]interface{}
+	if strings.HasPrefix(rec.Header().Get("Content-Type"), "application/json") {
+		var indented bytes.Buffer
+		if json.Indent(&indented, rec.Body.Bytes(), "", "  ") == nil {
+			example.ResponseBody = indented.String()
+		}
+		json.Unmarshal(rec.Body.Bytes(), &decoded)
+	}
+	er.examples = append(er.examples, example)
+	return decoded
+}
+
+// buildExamples records a request to every API endpoint, with one per
+// outcome for single verifications.
+func buildExamples() []docExample {
+	var er exampleRecorder
+	exampleSandbox(exampleService(), func() {
+		all, _ := parseRouteGroups("")
+		handler, err := newRouter(all)
+		if err != nil {
+			log.Printf("Failed to record API examples: %v", err)
+			return
+		}
+		er.handler = handler
+		recordExamples(&er)
+	})
+	return er.examples
+}
+
+func recordExamples(er *exampleRecorder) {
+	checks := strings.Join(verify.CheckOrder, ",")
+	verifyBody := func(email string) string {
+		return fmt.Sprintf(`{"email": %q, "checks": %q}`, email, checks)
+	}
+
+	for _, c := range []struct{ name, email string }{
+		{"Deliverable address", "jane.doe@acme.io"},
+		{"Undeliverable address", "no.such.user@acme.io"},
+		{"Disposable address", "temp@mailinator.com"},
+		{"Catch-all domain", "anyone@catchall-corp.io"},
+		{"Syntax error", "jane.doe@@acme.io"},
+	} {
+		er.do("/api/verify", c.name, http.MethodPost, "/api/verify", verifyBody(c.email), nil)
+	}
+	er.do("/api/verify", "Answered from the cache", http.MethodPost, "/api/verify", verifyBody("jane.doe@acme.io"), nil)
+	er.do("/api/cache/{email}", "Evict cached results", http.MethodDelete, "/api/cache/jane.doe@acme.io", "", nil)
+	er.do("/api/verify", "Look up with GET", http.MethodGet, "/api/verify?email=jane.doe%40acme.io&checks=smtp", "", nil)
+	er.do("/api/verify", "Streamed stages", http.MethodPost, "/api/verify?stream=true", verifyBody("jane.doe@acme.io"), nil)
+	greylisted := er.do("/api/verify", "Temporary failure with a retry token", http.MethodPost, "/api/verify", verifyBody("jane@slowmail.io"), nil)
+	token, _ := greylisted["retry_token"].(string)
+	er.do("/api/verify/retry", "Retry before the recommended delay", http.MethodPost, "/api/verify/retry",
+		fmt.Sprintf(`{"email": "jane@slowmail.io", "retry_token": %q}`, token), nil)
+	er.do("/api/domain/{domain}", "Inspect a domain", http.MethodGet, "/api/domain/acme.io", "", nil)
+	er.do("/api/domain/{domain}", "Inspect a mistyped domain", http.MethodGet, "/api/domain/gmaii.com", "", nil)
+	er.do("/api/verify/bulk", "Verify several addresses", http.MethodPost, "/api/verify/bulk",
+		`{"emails": ["jane.doe@acme.io", "no.such.user@acme.io", "Jane.Doe@acme.io", "jane.doe@@acme.io"], "checks": "smtp"}`, nil)
+	er.do("/api/verify/bulk", "Stream results as NDJSON", http.MethodPost, "/api/verify/bulk",
+		`{"emails": ["jane.doe@acme.io", "no.such.user@acme.io", "jane.doe@@acme.io"], "checks": "smtp"}`,
+		map[string]string{"Accept": "application/x-ndjson"})
+
+	upload := "--upload\r\n" +
+		"Content-Disposition: form-data; name=\"file\"; filename=\"contacts.csv\"\r\n" +
+		"Content-Type: text/csv\r\n\r\n" +
+		"name,email\r\nJane Doe,jane.doe@acme.io\r\nNobody,no.such.user@acme.io\r\nTypo,jane.doe@@acme.io\r\n" +
+		"--upload--\r\n"
+	er.do("/api/verify/csv", "Verify an uploaded CSV", http.MethodPost, "/api/verify/csv?checks=smtp", upload,
+		map[string]string{"Content-Type": "multipart/form-data; boundary=upload"})
+
+	job := er.do("/api/jobs", "Submit a list", http.MethodPost, "/api/jobs",
+		`{"emails": ["jane.doe@acme.io", "no.such.user@acme.io", "anyone@catchall-corp.io"], "checks": "smtp"}`, nil)
+	jobs.Wait()
+	jobID, _ := job["id"].(string)
+	er.do("/api/jobs/{id}", "Job progress and results", http.MethodGet, "/api/jobs/"+jobID+"?limit=2", "", nil)
+	er.do("/api/jobs/{id}/results", "Page through a job's results", http.MethodGet, "/api/jobs/"+jobID+"/results?limit=2", "", nil)
+	er.do("/api/jobs/{id}/export", "Export results as CSV", http.MethodGet, "/api/jobs/"+jobID+"/export", "", nil)
+	er.do("/api/jobs/{id}/cancel", "Cancel a job", http.MethodPost, "/api/jobs/"+jobID+"/cancel", "", nil)
+
+	created := er.do("/api/projects", "Create a project", http.MethodPost, "/api/projects", `{"name": "Monthly newsletter cleanup", "checks": "smtp"}`, nil)
+	projectID, _ := created["id"].(string)
+	er.do("/api/jobs", "Run a list under a project", http.MethodPost, "/api/jobs",
+		fmt.Sprintf(`{"emails": ["jane.doe@acme.io", "no.such.user@acme.io"], "project": %q}`, projectID), nil)
+	jobs.Wait()
+	er.do("/api/projects", "List projects", http.MethodGet, "/api/projects", "", nil)
+	er.do("/api/projects/{id}", "Project runs and stats", http.MethodGet, "/api/projects/"+projectID, "", nil)
+
+	er.do("/api/watches", "Watch a domain", http.MethodPost, "/api/watches", `{"domain": "acme.io", "interval": "6h"}`, nil)
+	er.do("/api/watches", "List watches", http.MethodGet, "/api/watches", "", nil)
+	er.do("/api/history", "Verification history", http.MethodGet, "/api/history?email=jane.doe@acme.io", "", nil)
+	er.do("/api/history/export", "Export history as CSV", http.MethodGet, "/api/history/export?format=csv&outcome=deliverable", "", nil)
+	er.do("/api/history", "Erase an address", http.MethodDelete, "/api/history?email=jane.doe@acme.io", "", nil)
+	er.do("/api/usage", "Usage by day", http.MethodGet, "/api/usage", "", nil)
+	er.do("/api/send-check", "Decide whether to send", http.MethodGet, "/api/send-check?email=jane.doe@acme.io", "", nil)
+
+	events := `{"events": [{"type": "bounce", "email": "no.such.user@acme.io", "timestamp": "2024-05-01T12:00:00Z"}]}`
+	er.do("/api/suppressions/events", "Report a hard bounce", http.MethodPost, "/api/suppressions/events?source="+exampleSource, events,
+		map[string]string{"X-Signature": "sha256=" + signBody(exampleSecret, []byte(events))})
+}
+
+// curl renders e as a curl command against base.
+func (e docExample) curl(base string) string {
+	lines := []string{"curl"}
+	if e.Method != http.MethodGet {
+		lines[0] += " -X " + e.Method
+	}
+	lines[0] += " " + shellQuote(base+e.Path)
+	keys := make([]string, 0, len(e.RequestHeaders))
+	for k := range e.RequestHeaders {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		lines = append(lines, "-H "+shellQuote(k+": "+e.RequestHeaders[k]))
+	}
+	if e.RequestBody != "" {
+		lines = append(lines, "--data "+shellQuote(e.RequestBody))
+	}
+	return strings.Join(lines, " \\\n  ")
+}
+
+func shellQuote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
+
+// baseURL is the server's URL as r reached it.
+func baseURL(r *http.Request) string {
+	scheme := "http"
+	if r.TLS != nil || r.Header.Get("X-Forwarded-Proto") == "https" {
+		scheme = "https"
+	}
+	return scheme + "://" + r.Host
+}
+
+// servedExamples returns the examples of enabled routes, with curl
+// commands against the host r reached.
+func servedExamples(r *http.Request) []docExample {
+	groups := make(map[string]routeGroup)
+	for _, rt := range routes() {
+		groups[rt.pattern] = rt.group
+	}
+	served := []docExample{}
+	for _, e := range docExamples() {
+		if enabledGroups[groups[e.Endpoint]] {
+			e.Curl = e.curl(baseURL(r))
+			served = append(served, e)
+		}
+	}
+	return served
+}
+
+var examplesPage = template.Must(template.New("examples").Parse(`<!doctype html>
+<html lang="en">
+<head><meta charset="UTF-8" /><title>Email Verifier API examples</title>
+<style>
+pre { background: #f5f5f5; padding: 0.75em; overflow-x: auto; }
+.copy { float: right; }
+</style>
+</head>
+<body>
+<h1>API examples</h1>
+<p>Recorded from this server's handlers against sample domains; the example key and domains are placeholders. <a href="/docs/examples.json">JSON</a></p>
+{{range .}}<h2 id="{{.ID}}">{{.Name}} <small><code>{{.Method}} {{.Endpoint}}</code></small></h2>
+<button type="button" class="copy" data-target="{{.ID}}-curl">Copy</button>
+<pre id="{{.ID}}-curl"><code>{{.Curl}}</code></pre>
+<p>Response: <code>{{.Status}}</code>{{range $k, $v := .ResponseHeaders}} <code>{{$k}}: {{$v}}</code>{{end}}</p>
+<pre><code>{{.ResponseBody}}</code></pre>
+{{end}}<script>
+document.querySelectorAll("button.copy").forEach(function (button) {
+  button.addEventListener("click", function () {
+    navigator.clipboard.writeText(document.getElementById(button.dataset.target).textContent).then(function () {
+      button.textContent = "Copied";
+      setTimeout(function () { button.textContent = "Copy"; }, 1500);
+    });
+  });
+});
+</script>
+</body>
+</html>
+`))
+
+// docsExamplesHandler renders the examples with copyable curl commands.
+func docsExamplesHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	examplesPage.Execute(w, servedExamples(r))
+}
+
+// docsExamplesJSONHandler serves the examples as JSON.
+func docsExamplesJSONHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{"examples": servedExamples(r)})
+}
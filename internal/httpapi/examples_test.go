@@ -0,0 +1,173 @@
+package httpapi
+
+import (
+	"bufio"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"email-verifier/pkg/verify"
+)
+
+// exampleSchemas are the types each JSON example must decode into with no
+// unknown fields, by method and endpoint.
+var exampleSchemas = map[string]func() interface{}{
+	"POST /api/verify":           func() interface{} { return new(verify.Result) },
+	"GET /api/verify":            func() interface{} { return new(verify.Result) },
+	"POST /api/verify/bulk":      func() interface{} { return new([]*verify.Result) },
+	"DELETE /api/cache/{email}":  func() interface{} { return new(struct{ Evicted int }) },
+	"GET /api/domain/{domain}":   func() interface{} { return new(verify.DomainResult) },
+	"POST /api/jobs":             func() interface{} { return new(jobView) },
+	"GET /api/jobs/{id}":         func() interface{} { return new(jobView) },
+	"POST /api/jobs/{id}/cancel": func() interface{} { return new(jobView) },
+	"GET /api/jobs/{id}/results": func() interface{} { return new(jobResultsPage) },
+	"POST /api/projects":         func() interface{} { return new(project) },
+	"GET /api/projects":          func() interface{} { return new(struct{ Projects []project }) },
+	"GET /api/projects/{id}":     func() interface{} { return new(project) },
+	"POST /api/watches":          func() interface{} { return new(domainWatch) },
+	"GET /api/send-check":        func() interface{} { return new(sendDecision) },
+	"POST /api/verify/retry": func() interface{} {
+		return new(struct {
+			Error      string
+			RetryAfter int `json:"retry_after"`
+		})
+	},
+	"POST /api/suppressions/events": func() interface{} { return new(struct{ Suppressed, Ignored int }) },
+}
+
+// TestExamplesCoverAPI tests that every API route has a recorded example and that none failed
+func TestExamplesCoverAPI(t *testing.T) {
+	examples := docExamples()
+	covered := make(map[string]bool)
+	for _, e := range examples {
+		covered[e.Endpoint] = true
+		if e.Status >= 500 {
+			t.Errorf("Expected %q to succeed, got %d: %s", e.Name, e.Status, e.ResponseBody)
+		}
+	}
+	for _, rt := range routes() {
+		if rt.group == groupAPI && !covered[rt.pattern] {
+			t.Errorf("Expected an example for %s", rt.pattern)
+		}
+	}
+}
+
+// TestExamplesMatchTypes tests that the JSON examples decode strictly into the types the handlers encode
+func TestExamplesMatchTypes(t *testing.T) {
+	for _, e := range docExamples() {
+		contentType := e.ResponseHeaders["Content-Type"]
+		switch {
+		case contentType == "application/x-ndjson":
+			scanner := bufio.NewScanner(strings.NewReader(e.ResponseBody))
+			for scanner.Scan() {
+				switch line := scanner.Text(); {
+				case e.Endpoint != "/api/verify/bulk":
+					decodeStrict(t, e, line, new(stageEvent))
+				case strings.HasPrefix(line, `{"summary"`):
+					decodeStrict(t, e, line, new(bulkSummary))
+				default:
+					decodeStrict(t, e, line, new(bulkLine))
+				}
+			}
+		case strings.HasPrefix(contentType, "application/json"):
+			if schema := exampleSchemas[e.Method+" "+e.Endpoint]; schema != nil {
+				decodeStrict(t, e, e.ResponseBody, schema())
+			} else if !json.Valid([]byte(e.ResponseBody)) {
+				t.Errorf("Expected valid JSON for %q", e.Name)
+			}
+		}
+	}
+}
+
+func decodeStrict(t *testing.T, e docExample, body string, out interface{}) {
+	t.Helper()
+	dec := json.NewDecoder(strings.NewReader(body))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(out); err != nil {
+		t.Errorf("Expected %q to decode as %T, got %v", e.Name, out, err)
+	}
+}
+
+// TestExampleVerdicts tests that the single verification examples show the outcome they are named for
+func TestExampleVerdicts(t *testing.T) {
+	want := map[string]func(verify.Result) bool{
+		"Deliverable address":                  func(r verify.Result) bool { return r.Verdict == verify.VerdictDeliverable },
+		"Undeliverable address":                func(r verify.Result) bool { return r.Verdict == verify.VerdictUndeliverable },
+		"Disposable address":                   func(r verify.Result) bool { return r.Disposable },
+		"Catch-all domain":                     func(r verify.Result) bool { return r.CatchAll },
+		"Syntax error":                         func(r verify.Result) bool { return r.ErrorCode == verify.ErrCodeInvalidSyntax },
+		"Answered from the cache":              func(r verify.Result) bool { return r.Cached && r.VerifiedAt != nil },
+		"Temporary failure with a retry token": func(r verify.Result) bool { return r.RetryToken != "" },
+	}
+	for _, e := range docExamples() {
+		check := want[e.Name]
+		if check == nil {
+			continue
+		}
+		delete(want, e.Name)
+		var result verify.Result
+		json.Unmarshal([]byte(e.ResponseBody), &result)
+		if !check(result) {
+			t.Errorf("Expected %q to show that outcome, got %s", e.Name, e.ResponseBody)
+		}
+	}
+	for name := range want {
+		t.Errorf("Expected an example named %q", name)
+	}
+}
+
+// TestExamplesSandboxed tests that recording the examples leaves the server's own state alone
+func TestExamplesSandboxed(t *testing.T) {
+	docExamples()
+	if len(projects.List(verify.DefaultTenant)) != 0 || len(watches.List(exampleKey)) != 0 {
+		t.Error("Expected the example project and watch to stay in the sandbox")
+	}
+	for _, e := range docExamples() {
+		if location := e.ResponseHeaders["Location"]; strings.HasPrefix(location, "/api/jobs/") {
+			if _, ok := jobs.Get(strings.TrimPrefix(location, "/api/jobs/"), firstPage); ok {
+				t.Errorf("Expected example job %s to stay in the sandbox", location)
+			}
+		}
+	}
+	if history != nil {
+		t.Error("Expected history to stay disabled")
+	}
+	if counts := outcomes.Counts(maxAlertWindow); counts["slowmail.io"].total != 0 {
+		t.Error("Expected example verifications to stay out of the alerting counts")
+	}
+}
+
+// TestDocsExamplesPage tests the examples page and its JSON form, with curl commands for the serving host
+func TestDocsExamplesPage(t *testing.T) {
+	page := getPage(t, "/docs/examples", "verify.example.test", "")
+	for _, want := range []string{"Deliverable address", `curl -X POST &#39;http://verify.example.test/api/verify&#39;`, `class="copy"`, "navigator.clipboard"} {
+		if !strings.Contains(page, want) {
+			t.Errorf("Expected the examples page to contain %q", want)
+		}
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/docs/examples.json", nil)
+	req.Header.Set("X-Forwarded-Proto", "https")
+	rec := httptest.NewRecorder()
+	Handler().ServeHTTP(rec, req)
+	var body struct{ Examples []docExample }
+	if err := json.NewDecoder(rec.Body).Decode(&body); err != nil || len(body.Examples) == 0 {
+		t.Fatalf("Expected JSON examples, got %v", err)
+	}
+	first := body.Examples[0]
+	if !strings.HasPrefix(first.Curl, "curl -X POST 'https://example.com/api/verify'") || !strings.Contains(first.Curl, "-H 'X-API-Key: example-key'") {
+		t.Errorf("Expected a curl command for the https host, got %s", first.Curl)
+	}
+
+	saved := enabledGroups
+	enabledGroups = map[routeGroup]bool{groupDocs: true}
+	defer func() { enabledGroups = saved }()
+	rec = httptest.NewRecorder()
+	Handler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/docs/examples.json", nil))
+	json.NewDecoder(rec.Body).Decode(&body)
+	if len(body.Examples) != 0 {
+		t.Errorf("Expected no examples with the API off, got %d", len(body.Examples))
+	}
+}
@@ -0,0 +1,208 @@
+package httpapi
+
+import (
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"email-verifier/pkg/verify"
+)
+
+// resultFilter selects results for display or export. Zero fields match
+// everything.
+type resultFilter struct {
+	Verdict    string
+	Disposable *bool
+	Domain     string // substring of the address's domain
+}
+
+var (
+	knownVerdicts = map[string]bool{
+		verify.VerdictDeliverable:   true,
+		verify.VerdictRisky:         true,
+		verify.VerdictUndeliverable: true,
+		verify.VerdictUnknown:       true,
+		verify.VerdictInvalid:       true,
+	}
+	domainFilterPattern = regexp.MustCompile(`^[a-z0-9.-]{1,253}$`)
+)
+
+// parseResultFilter reads the verdict, disposable and domain parameters.
+// Values are validated rather than echoed, since the filter is described
+// in the export's header line.
+func parseResultFilter(query url.Values) (resultFilter, error) {
+	var f resultFilter
+
+	if v := strings.ToLower(query.Get("verdict")); v != "" {
+		if !knownVerdicts[v] {
+			return f, errors.New("verdict must be deliverable, risky, undeliverable, unknown or invalid")
+		}
+		f.Verdict = v
+	}
+	if v := query.Get("disposable"); v != "" {
+		disposable, err := strconv.ParseBool(v)
+		if err != nil {
+			return f, errors.New("disposable must be true or false")
+		}
+		f.Disposable = &disposable
+	}
+	if v := strings.ToLower(query.Get("domain")); v != "" {
+		if !domainFilterPattern.MatchString(v) {
+			return f, errors.New("domain may only contain letters, digits, dots and hyphens")
+		}
+		f.Domain = v
+	}
+	return f, nil
+}
+
+// Match reports whether result passes the filter.
+func (f resultFilter) Match(result *verify.Result) bool {
+	if f.Verdict != "" && result.Verdict != f.Verdict {
+		return false
+	}
+	if f.Disposable != nil && result.Disposable != *f.Disposable {
+		return false
+	}
+	if f.Domain != "" && !strings.Contains(strings.ToLower(result.Domain), f.Domain) {
+		return false
+	}
+	return true
+}
+
+// String describes the filter, e.g. "verdict=undeliverable domain=example".
+func (f resultFilter) String() string {
+	var parts []string
+	if f.Verdict != "" {
+		parts = append(parts, "verdict="+f.Verdict)
+	}
+	if f.Disposable != nil {
+		parts = append(parts, "disposable="+strconv.FormatBool(*f.Disposable))
+	}
+	if f.Domain != "" {
+		parts = append(parts, "domain="+f.Domain)
+	}
+	if len(parts) == 0 {
+		return "none"
+	}
+	return strings.Join(parts, " ")
+}
+
+var resultCSVHeader = []string{
+	"email", "is_valid", "verdict", "reachable", "disposable", "role_account",
+	"free", "has_mx_records", "domain_status", "suggestion", "error_code",
+}
+
+// writeResultsCSV writes the results that pass f as CSV, preceded by a
+// comment line recording the filter, how addresses are shown and when the
+// export was generated. With a pseudonymizer, the email column holds
+// tokens, a domain column follows it, and suggestions are only kept when
+// domains are in clear.
+func writeResultsCSV(w io.Writer, results []*verify.Result, f resultFilter, p *pseudonymizer, generatedAt time.Time) error {
+	if _, err := fmt.Fprintf(w, "# filters: %s; addresses: %s; generated_at: %s\n", f, p, generatedAt.UTC().Format(time.RFC3339)); err != nil {
+		return err
+	}
+
+	cw := csv.NewWriter(w)
+	header := resultCSVHeader
+	if p != nil {
+		header = append([]string{"email_token", "domain"}, resultCSVHeader[1:]...)
+	}
+	cw.Write(header)
+	for _, result := range results {
+		if !f.Match(result) {
+			continue
+		}
+		address := []string{result.Email}
+		suggestion := result.Suggestion
+		if p != nil {
+			address = []string{p.Token(result.Email), p.Domain(result)}
+			if p.domains != domainsClear {
+				suggestion = ""
+			}
+		}
+		cw.Write(append(address,
+			strconv.FormatBool(result.IsValid),
+			result.Verdict,
+			result.Reachable,
+			strconv.FormatBool(result.Disposable),
+			strconv.FormatBool(result.RoleAccount),
+			strconv.FormatBool(result.Free),
+			strconv.FormatBool(result.HasMxRecords),
+			result.DomainStatus,
+			suggestion,
+			result.ErrorCode,
+		))
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+var historyCSVHeader = []string{
+	"email", "domain", "reachable", "disposable", "free", "role_account",
+	"has_mx_records", "suggestion", "verified_at",
+}
+
+// historyCSVWriter writes history entries as CSV rows, sending them on
+// every historyCSVFlushRows rows so a long export streams. With p set,
+// addresses are written as tokens, as in writeResultsCSV.
+type historyCSVWriter struct {
+	w    http.ResponseWriter
+	cw   *csv.Writer
+	p    *pseudonymizer
+	rows int
+}
+
+const historyCSVFlushRows = 100
+
+// newHistoryCSVWriter writes the header, so an export with no rows is
+// still a valid CSV.
+func newHistoryCSVWriter(w http.ResponseWriter, p *pseudonymizer) *historyCSVWriter {
+	hw := &historyCSVWriter{w: w, cw: csv.NewWriter(w), p: p}
+	header := historyCSVHeader
+	if p != nil {
+		header = append([]string{"email_token"}, historyCSVHeader[1:]...)
+	}
+	hw.cw.Write(header)
+	return hw
+}
+
+// Write writes entry's row. Its signature suits historyStore.Each and
+// historyDB.Each.
+func (hw *historyCSVWriter) Write(entry historyEntry) error {
+	result := entry.Result
+	email, domain, suggestion := result.Email, result.Domain, result.Suggestion
+	if hw.p != nil {
+		email, domain = hw.p.Token(result.Email), hw.p.Domain(result)
+		if hw.p.domains != domainsClear {
+			suggestion = ""
+		}
+	}
+	hw.cw.Write([]string{
+		email,
+		domain,
+		result.Reachable,
+		strconv.FormatBool(result.Disposable),
+		strconv.FormatBool(result.Free),
+		strconv.FormatBool(result.RoleAccount),
+		strconv.FormatBool(result.HasMxRecords),
+		suggestion,
+		entry.VerifiedAt.UTC().Format(time.RFC3339),
+	})
+	if hw.rows++; hw.rows%historyCSVFlushRows == 0 {
+		hw.Flush()
+	}
+	return hw.cw.Error()
+}
+
+// Flush sends the rows written so far.
+func (hw *historyCSVWriter) Flush() {
+	hw.cw.Flush()
+	http.NewResponseController(hw.w).Flush()
+}
@@ -0,0 +1,108 @@
+package httpapi
+
+import (
+	"bytes"
+	"encoding/csv"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"email-verifier/pkg/verify"
+)
+
+// seededResults are a small mixed batch for export tests
+func seededResults() []*verify.Result {
+	return []*verify.Result{
+		{Email: "jane@example.com", Domain: "example.com", IsValid: true, Verdict: verify.VerdictDeliverable, Reachable: "yes"},
+		{Email: "gone@example.org", Domain: "example.org", IsValid: true, Verdict: verify.VerdictUndeliverable, Reachable: "no"},
+		{Email: "temp@mailinator.com", Domain: "mailinator.com", IsValid: true, Disposable: true, Verdict: verify.VerdictRisky, Reachable: "unknown"},
+		{Email: "typo@exampel.com", Domain: "exampel.com", IsValid: true, Verdict: verify.VerdictUndeliverable, Reachable: "unknown"},
+	}
+}
+
+// TestParseResultFilter tests validation of filter parameters
+func TestParseResultFilter(t *testing.T) {
+	testCases := []struct {
+		query    string
+		expected string
+		err      bool
+	}{
+		{"", "none", false},
+		{"verdict=Undeliverable", "verdict=undeliverable", false},
+		{"disposable=true&domain=Example", "disposable=true domain=example", false},
+		{"verdict=maybe", "", true},
+		{"disposable=sometimes", "", true},
+		{"domain=" + url.QueryEscape("<b>"), "", true},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.query, func(t *testing.T) {
+			query, _ := url.ParseQuery(tc.query)
+			f, err := parseResultFilter(query)
+			if tc.err {
+				if err == nil {
+					t.Errorf("Expected error, got filter %s", f)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Expected no error, got %v", err)
+			}
+			if got := f.String(); got != tc.expected {
+				t.Errorf("Expected %q, got %q", tc.expected, got)
+			}
+		})
+	}
+}
+
+// TestWriteResultsCSV tests filtered and unfiltered exports
+func TestWriteResultsCSV(t *testing.T) {
+	generated := time.Date(2024, 3, 3, 12, 0, 0, 0, time.UTC)
+
+	testCases := []struct {
+		name   string
+		query  string
+		emails []string
+	}{
+		{"unfiltered", "", []string{"jane@example.com", "gone@example.org", "temp@mailinator.com", "typo@exampel.com"}},
+		{"undeliverable", "verdict=undeliverable", []string{"gone@example.org", "typo@exampel.com"}},
+		{"disposable", "disposable=true", []string{"temp@mailinator.com"}},
+		{"domain substring", "domain=example", []string{"jane@example.com", "gone@example.org"}},
+		{"combined", "verdict=undeliverable&domain=.org", []string{"gone@example.org"}},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			query, _ := url.ParseQuery(tc.query)
+			f, err := parseResultFilter(query)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			var buf bytes.Buffer
+			if err := writeResultsCSV(&buf, seededResults(), f, nil, generated); err != nil {
+				t.Fatalf("Failed to write CSV: %v", err)
+			}
+
+			comment, body, _ := strings.Cut(buf.String(), "\n")
+			expectedComment := "# filters: " + f.String() + "; addresses: clear; generated_at: 2024-03-03T12:00:00Z"
+			if comment != expectedComment {
+				t.Errorf("Expected comment %q, got %q", expectedComment, comment)
+			}
+
+			rows, err := csv.NewReader(strings.NewReader(body)).ReadAll()
+			if err != nil {
+				t.Fatalf("Failed to parse CSV: %v", err)
+			}
+			if len(rows) != len(tc.emails)+1 {
+				t.Fatalf("Expected %d rows plus header, got %d", len(tc.emails), len(rows)-1)
+			}
+			for i, email := range tc.emails {
+				if rows[i+1][0] != email {
+					t.Errorf("Expected row %d to be %s, got %s", i+1, email, rows[i+1][0])
+				}
+			}
+		})
+	}
+}
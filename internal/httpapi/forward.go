@@ -0,0 +1,315 @@
+package httpapi
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"sort"
+	"sync"
+	"time"
+
+	"email-verifier/pkg/verify"
+)
+
+// Forwarding limits: results are sent in batches of up to forwardBatchSize,
+// and at most forwardMaxPending are held per key while a destination is
+// paused or failing (oldest results are dropped first).
+const (
+	forwardBatchSize  = 100
+	forwardMaxPending = 10000
+)
+
+// forwardTarget is where an API key's results are mirrored to.
+type forwardTarget struct {
+	URL    string `json:"url"`
+	Secret string `json:"secret"`
+}
+
+// forwardStats are per-key delivery metrics.
+type forwardStats struct {
+	Key          string     `json:"key"`
+	URL          string     `json:"url"`
+	Paused       bool       `json:"paused"`
+	Breaker      string     `json:"breaker"`
+	Pending      int        `json:"pending"`
+	Delivered    int64      `json:"delivered"`
+	Failed       int64      `json:"failed_batches"`
+	Dropped      int64      `json:"dropped"`
+	LastDelivery *time.Time `json:"last_delivery,omitempty"`
+	LastError    string     `json:"last_error,omitempty"`
+}
+
+type forwardItem struct {
+	result   *verify.Result
+	queuedAt time.Time
+}
+
+type forwardQueue struct {
+	target  forwardTarget
+	breaker *circuitBreaker
+	pending []forwardItem
+	stats   forwardStats
+}
+
+// resultForwarder asynchronously mirrors completed verifications to each API
+// key's configured endpoint. Nothing it does can fail or delay the caller.
+type resultForwarder struct {
+	mu     sync.Mutex
+	queues map[string]*forwardQueue
+	client *http.Client
+	now    func() time.Time
+}
+
+var forwarder = newResultForwarder(nil)
+
+func newResultForwarder(targets map[string]forwardTarget) *resultForwarder {
+	f := &resultForwarder{
+		queues: make(map[string]*forwardQueue),
+		client: newHTTPClient(10 * time.Second),
+		now:    time.Now,
+	}
+	for key, target := range targets {
+		f.queues[key] = &forwardQueue{
+			target:  target,
+			breaker: newCircuitBreaker(5, time.Minute),
+			stats:   forwardStats{Key: key, URL: target.URL},
+		}
+	}
+	return f
+}
+
+// loadForwardTargets reads a JSON object mapping API keys to targets.
+func loadForwardTargets(path string) (map[string]forwardTarget, error) {
+	if path == "" {
+		return nil, nil
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var targets map[string]forwardTarget
+	if err := json.Unmarshal(data, &targets); err != nil {
+		return nil, fmt.Errorf("parse forward config %s: %v", path, err)
+	}
+	for key, target := range targets {
+		if target.URL == "" {
+			return nil, fmt.Errorf("forward config %s: key %q has no url", path, key)
+		}
+	}
+	return targets, nil
+}
+
+// Enqueue queues result for forwarding if key has a target.
+func (f *resultForwarder) Enqueue(key string, result *verify.Result) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	q, ok := f.queues[key]
+	if !ok {
+		return
+	}
+	q.pending = append(q.pending, forwardItem{result: result, queuedAt: f.now()})
+	if over := len(q.pending) - forwardMaxPending; over > 0 {
+		q.pending = q.pending[over:]
+		q.stats.Dropped += int64(over)
+	}
+}
+
+// SetPaused pauses or resumes forwarding for key. Results keep queueing
+// while paused. It reports whether the key has a target.
+func (f *resultForwarder) SetPaused(key string, paused bool) bool {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	q, ok := f.queues[key]
+	if ok {
+		q.stats.Paused = paused
+	}
+	return ok
+}
+
+// Stats returns delivery metrics for every key, ordered by key.
+func (f *resultForwarder) Stats() []forwardStats {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	stats := make([]forwardStats, 0, len(f.queues))
+	for _, q := range f.queues {
+		s := q.stats
+		s.Pending = len(q.pending)
+		s.Breaker = q.breaker.State()
+		stats = append(stats, s)
+	}
+	sort.Slice(stats, func(i, j int) bool { return stats[i].Key < stats[j].Key })
+	return stats
+}
+
+// Flush sends one batch per key whose destination is active.
+func (f *resultForwarder) Flush(ctx context.Context) {
+	if service.NetworkDisabled() {
+		// Results stay queued until the network is back
+		return
+	}
+	f.mu.Lock()
+	keys := make([]string, 0, len(f.queues))
+	for key := range f.queues {
+		keys = append(keys, key)
+	}
+	f.mu.Unlock()
+
+	for _, key := range keys {
+		f.flushKey(ctx, key)
+	}
+}
+
+func (f *resultForwarder) flushKey(ctx context.Context, key string) {
+	f.mu.Lock()
+	q := f.queues[key]
+	if q.stats.Paused || len(q.pending) == 0 || !q.breaker.Allow() {
+		f.mu.Unlock()
+		return
+	}
+	n := len(q.pending)
+	if n > forwardBatchSize {
+		n = forwardBatchSize
+	}
+	batch := make([]*verify.Result, n)
+	for i, item := range q.pending[:n] {
+		batch[i] = item.result
+	}
+	target := q.target
+	droppedBefore := q.stats.Dropped
+	f.mu.Unlock()
+
+	err := f.deliver(ctx, key, target, batch)
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if err != nil {
+		q.breaker.Failure()
+		q.stats.Failed++
+		q.stats.LastError = err.Error()
+		log.Printf("forward: delivery for key %s failed: %v", key, err)
+		return
+	}
+	q.breaker.Success()
+	// Enqueue or the janitor may have dropped from the front of the queue
+	// while we were sending; those entries were part of this batch.
+	remaining := n - int(q.stats.Dropped-droppedBefore)
+	if remaining > 0 {
+		q.pending = q.pending[remaining:]
+	}
+	now := f.now()
+	q.stats.Delivered += int64(n)
+	q.stats.LastDelivery = &now
+	q.stats.LastError = ""
+}
+
+// Sweep drops results that have waited longer than ttl, which happens while
+// a destination is paused or its breaker stays open.
+func (f *resultForwarder) Sweep(now time.Time, ttl time.Duration) int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	evicted := 0
+	for _, q := range f.queues {
+		n := 0
+		for n < len(q.pending) && now.Sub(q.pending[n].queuedAt) > ttl {
+			n++
+		}
+		if n > 0 {
+			q.pending = q.pending[n:]
+			q.stats.Dropped += int64(n)
+			evicted += n
+		}
+	}
+	return evicted
+}
+
+// Len returns the number of results queued across all keys.
+func (f *resultForwarder) Len() int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	n := 0
+	for _, q := range f.queues {
+		n += len(q.pending)
+	}
+	return n
+}
+
+// deliver POSTs a batch with an HMAC-SHA256 signature of the body.
+func (f *resultForwarder) deliver(ctx context.Context, key string, target forwardTarget, batch []*verify.Result) error {
+	body, err := json.Marshal(map[string]interface{}{
+		"key":     key,
+		"results": batch,
+	})
+	if err != nil {
+		return err
+	}
+
+	return postSigned(ctx, f.client, target.URL, target.Secret, body)
+}
+
+// postSigned POSTs a JSON body with its HMAC-SHA256 signature under secret
+// in X-Signature.
+func postSigned(ctx context.Context, client *http.Client, target, secret string, body []byte) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, target, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-Signature", "sha256="+signBody(secret, body))
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("destination returned status %d", resp.StatusCode)
+	}
+	return nil
+}
+
+// signBody returns the hex HMAC-SHA256 of body under secret.
+func signBody(secret string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+func adminForwardingHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"forwarding": forwarder.Stats(),
+	})
+}
+
+func adminForwardingActionHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var paused bool
+	switch r.PathValue("action") {
+	case "pause":
+		paused = true
+	case "resume":
+		paused = false
+	default:
+		http.NotFound(w, r)
+		return
+	}
+
+	if !forwarder.SetPaused(r.PathValue("key"), paused) {
+		http.Error(w, "No forwarding configured for key", http.StatusNotFound)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
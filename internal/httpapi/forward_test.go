@@ -0,0 +1,130 @@
+package httpapi
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+
+	"email-verifier/pkg/verify"
+)
+
+// forwardReceiver is a destination endpoint that records signed batches
+type forwardReceiver struct {
+	mu      sync.Mutex
+	status  int
+	batches [][]verify.Result
+	badSig  int
+}
+
+func (fr *forwardReceiver) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	body, _ := io.ReadAll(r.Body)
+
+	fr.mu.Lock()
+	defer fr.mu.Unlock()
+	if r.Header.Get("X-Signature") != "sha256="+signBody("shh", body) {
+		fr.badSig++
+	}
+	if fr.status != http.StatusOK {
+		w.WriteHeader(fr.status)
+		return
+	}
+	var payload struct {
+		Results []verify.Result `json:"results"`
+	}
+	json.Unmarshal(body, &payload)
+	fr.batches = append(fr.batches, payload.Results)
+}
+
+// TestForwarderDelivers tests batched, signed delivery for configured keys only
+func TestForwarderDelivers(t *testing.T) {
+	receiver := &forwardReceiver{status: http.StatusOK}
+	server := httptest.NewServer(receiver)
+	defer server.Close()
+
+	f := newResultForwarder(map[string]forwardTarget{"team": {URL: server.URL, Secret: "shh"}})
+	f.Enqueue("team", &verify.Result{Email: "a@example.com"})
+	f.Enqueue("team", &verify.Result{Email: "b@example.com"})
+	f.Enqueue("other", &verify.Result{Email: "c@example.com"})
+	f.Flush(context.Background())
+
+	if len(receiver.batches) != 1 || len(receiver.batches[0]) != 2 {
+		t.Fatalf("Expected one batch of two results, got %+v", receiver.batches)
+	}
+	if receiver.badSig != 0 {
+		t.Errorf("Expected valid signatures, got %d bad", receiver.badSig)
+	}
+	stats := f.Stats()
+	if len(stats) != 1 || stats[0].Delivered != 2 || stats[0].Pending != 0 {
+		t.Errorf("Expected 2 delivered and none pending, got %+v", stats)
+	}
+}
+
+// TestForwarderBreakerAndPause tests that failing or paused destinations hold results
+func TestForwarderBreakerAndPause(t *testing.T) {
+	receiver := &forwardReceiver{status: http.StatusInternalServerError}
+	server := httptest.NewServer(receiver)
+	defer server.Close()
+
+	f := newResultForwarder(map[string]forwardTarget{"team": {URL: server.URL, Secret: "shh"}})
+	f.Enqueue("team", &verify.Result{Email: "a@example.com"})
+	for i := 0; i < 10; i++ {
+		f.Flush(context.Background())
+	}
+
+	stats := f.Stats()[0]
+	if stats.Failed != 5 || stats.Breaker != "open" || stats.Pending != 1 {
+		t.Errorf("Expected breaker open after 5 failures with the result kept, got %+v", stats)
+	}
+
+	receiver.status = http.StatusOK
+	f.queues["team"].breaker.Success()
+	f.SetPaused("team", true)
+	f.Flush(context.Background())
+	if len(receiver.batches) != 0 {
+		t.Fatalf("Expected no delivery while paused, got %d batches", len(receiver.batches))
+	}
+
+	f.SetPaused("team", false)
+	f.Flush(context.Background())
+	if len(receiver.batches) != 1 {
+		t.Errorf("Expected delivery after resume, got %d batches", len(receiver.batches))
+	}
+}
+
+// TestAdminForwardingActions tests the pause/resume admin endpoint
+func TestAdminForwardingActions(t *testing.T) {
+	original := forwarder
+	forwarder = newResultForwarder(map[string]forwardTarget{"team": {URL: "http://127.0.0.1:1"}})
+	defer func() { forwarder = original }()
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/admin/forwarding/{key}/{action}", adminForwardingActionHandler)
+
+	testCases := []struct {
+		path   string
+		status int
+		paused bool
+	}{
+		{"/admin/forwarding/team/pause", http.StatusNoContent, true},
+		{"/admin/forwarding/team/resume", http.StatusNoContent, false},
+		{"/admin/forwarding/unknown/pause", http.StatusNotFound, false},
+		{"/admin/forwarding/team/explode", http.StatusNotFound, false},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.path, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			mux.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, tc.path, nil))
+			if rec.Code != tc.status {
+				t.Errorf("Expected status %d, got %d", tc.status, rec.Code)
+			}
+			if forwarder.Stats()[0].Paused != tc.paused {
+				t.Errorf("Expected paused=%v", tc.paused)
+			}
+		})
+	}
+}
@@ -0,0 +1,169 @@
+package httpapi
+
+import (
+	"errors"
+	"fmt"
+	"html/template"
+	"net/http"
+	"slices"
+	"strings"
+)
+
+// routeGroup is a set of routes that can be turned off together, e.g. to
+// run one instance as a pure API and another as the web UI.
+type routeGroup string
+
+const (
+	groupUI      routeGroup = "ui"      // the web form, result and job pages
+	groupAPI     routeGroup = "api"     // /api/
+	groupAdmin   routeGroup = "admin"   // /admin/ and /api/admin/
+	groupMetrics routeGroup = "metrics" // /metrics
+	groupDocs    routeGroup = "docs"    // /docs
+
+	// groupCore routes, the health probes, are always served.
+	groupCore routeGroup = ""
+)
+
+// routeGroups are the groups that can be toggled, in display order.
+var routeGroups = []routeGroup{groupUI, groupAPI, groupAdmin, groupMetrics, groupDocs}
+
+// enabledGroups are the groups Handler serves; Start replaces them.
+var enabledGroups = map[routeGroup]bool{groupUI: true, groupAPI: true, groupAdmin: true, groupMetrics: true, groupDocs: true}
+
+// parseRouteGroups reads a comma-separated list of groups to serve. An
+// empty list serves every group.
+func parseRouteGroups(s string) (map[routeGroup]bool, error) {
+	enabled := make(map[routeGroup]bool)
+	if strings.TrimSpace(s) == "" {
+		for _, group := range routeGroups {
+			enabled[group] = true
+		}
+		return enabled, nil
+	}
+	for _, name := range strings.Split(s, ",") {
+		group := routeGroup(strings.TrimSpace(name))
+		if !slices.Contains(routeGroups, group) {
+			return nil, fmt.Errorf("unknown route group %q: want %s", group, groupList(routeGroups))
+		}
+		enabled[group] = true
+	}
+	return enabled, nil
+}
+
+// validateRouteGroups checks that enabled serves something and that no
+// group is on without a group it depends on.
+func validateRouteGroups(enabled map[routeGroup]bool) error {
+	if !slices.ContainsFunc(routeGroups, func(g routeGroup) bool { return enabled[g] }) {
+		return fmt.Errorf("no route groups enabled: enable at least one of %s", groupList(routeGroups))
+	}
+	// The admin routes manage API state: usage, forwarding, tenants and
+	// profiles
+	if enabled[groupAdmin] && !enabled[groupAPI] {
+		return errors.New("route group admin requires api")
+	}
+	return nil
+}
+
+// requireAdminAuth checks that the admin group, which can turn the
+// network off and lists every key's usage, is only served behind API
+// keys. Asking for it without keys is an error; the default list, all
+// groups, drops it instead.
+func requireAdminAuth(enabled map[routeGroup]bool, list string, keys *apiKeyStore) error {
+	if !enabled[groupAdmin] || keys != nil {
+		return nil
+	}
+	if strings.TrimSpace(list) != "" {
+		return errors.New("route group admin requires API keys (-api-keys or -api-keys-file)")
+	}
+	delete(enabled, groupAdmin)
+	return nil
+}
+
+func groupList(groups []routeGroup) string {
+	names := make([]string, len(groups))
+	for i, group := range groups {
+		names[i] = string(group)
+	}
+	return strings.Join(names, ", ")
+}
+
+// newRouter registers the routes of the enabled groups. Routes of disabled
+// groups answer 404, so the UI's catch-all index never stands in for them.
+// With the UI off and docs on, the index redirects to /docs.
+func newRouter(enabled map[routeGroup]bool) (http.Handler, error) {
+	if err := validateRouteGroups(enabled); err != nil {
+		return nil, err
+	}
+	all := routes()
+	if !enabled[groupUI] && enabled[groupDocs] {
+		all = append(all, route{"/{$}", cacheNoStore, groupCore, http.RedirectHandler("/docs", http.StatusFound)})
+	}
+
+	mux := http.NewServeMux()
+	for _, rt := range all {
+		if rt.cache == 0 {
+			return nil, fmt.Errorf("route %s declares no cache class", rt.pattern)
+		}
+		handler := rt.handler
+		if rt.group != groupCore && !enabled[rt.group] {
+			handler = http.NotFoundHandler()
+		} else if rt.group == groupAPI {
+			handler = withCORS(withRateLimit(withAPIKey(withDeadline(handler))))
+		} else if rt.group == groupAdmin {
+			handler = withAPIKey(handler)
+		}
+		if err := register(mux, rt.pattern, withCachePolicy(rt.cache, handler)); err != nil {
+			return nil, err
+		}
+	}
+	return withRequestLog(mux), nil
+}
+
+// register adds pattern to mux, returning the mux's panic over a duplicate
+// or conflicting pattern as an error.
+func register(mux *http.ServeMux, pattern string, handler http.Handler) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("route %s: %v", pattern, r)
+		}
+	}()
+	mux.Handle(pattern, handler)
+	return nil
+}
+
+// docsPage lists the routes this instance serves. It is built in rather
+// than a template file so API-only deployments need no UI assets.
+var docsPage = template.Must(template.New("docs").Parse(`<!doctype html>
+<html lang="en">
+<head><meta charset="UTF-8" /><title>Email Verifier API</title></head>
+<body>
+<h1>Email Verifier</h1>
+<p><a href="/docs/examples">Request and response examples</a> · <a href="/api/docs">API reference</a> (<a href="/api/openapi.json">OpenAPI</a>)</p>
+{{range .}}<h2>{{.Group}}</h2>
+<ul>{{range .Patterns}}<li><code>{{.}}</code></li>{{end}}</ul>
+{{end}}</body>
+</html>
+`))
+
+// docsHandler lists the enabled routes by group.
+func docsHandler(w http.ResponseWriter, r *http.Request) {
+	type section struct {
+		Group    routeGroup
+		Patterns []string
+	}
+	var sections []section
+	for _, group := range routeGroups {
+		if !enabledGroups[group] {
+			continue
+		}
+		s := section{Group: group}
+		for _, rt := range routes() {
+			if rt.group == group {
+				s.Patterns = append(s.Patterns, rt.pattern)
+			}
+		}
+		sections = append(sections, s)
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	docsPage.Execute(w, sections)
+}
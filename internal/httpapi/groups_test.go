@@ -0,0 +1,136 @@
+package httpapi
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// groupProbes are a path from each group, requested to see whether that group is served
+var groupProbes = map[routeGroup]string{
+	groupUI:      "/verify",
+	groupAPI:     "/api/usage",
+	groupAdmin:   "/admin/tenants",
+	groupMetrics: "/metrics",
+	groupDocs:    "/docs",
+	groupCore:    "/health",
+}
+
+// TestRouteGroupCombinations tests every combination of enabled groups: invalid ones fail, and valid ones serve exactly their groups
+func TestRouteGroupCombinations(t *testing.T) {
+	for mask := 0; mask < 1<<len(routeGroups); mask++ {
+		var names []string
+		for i, group := range routeGroups {
+			if mask&(1<<i) != 0 {
+				names = append(names, string(group))
+			}
+		}
+		list := strings.Join(names, ",")
+
+		t.Run("groups="+list, func(t *testing.T) {
+			enabled := map[routeGroup]bool{}
+			for _, name := range names {
+				enabled[routeGroup(name)] = true
+			}
+			handler, err := newRouter(enabled)
+			wantErr := len(names) == 0 || (enabled[groupAdmin] && !enabled[groupAPI])
+			if (err != nil) != wantErr {
+				t.Fatalf("Expected error: %v, got %v", wantErr, err)
+			}
+			if err != nil {
+				return
+			}
+
+			for group, path := range groupProbes {
+				rec := httptest.NewRecorder()
+				handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, path, nil))
+				served := group == groupCore || enabled[group]
+				if (rec.Code != http.StatusNotFound) != served {
+					t.Errorf("Expected %s served: %v, got status %d", path, served, rec.Code)
+				}
+			}
+
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/", nil))
+			switch {
+			case enabled[groupUI]:
+				if rec.Code != http.StatusOK {
+					t.Errorf("Expected the index, got %d", rec.Code)
+				}
+			case enabled[groupDocs]:
+				if rec.Code != http.StatusFound || rec.Header().Get("Location") != "/docs" {
+					t.Errorf("Expected a redirect to /docs, got %d to %q", rec.Code, rec.Header().Get("Location"))
+				}
+			default:
+				if rec.Code != http.StatusNotFound {
+					t.Errorf("Expected 404 for the index, got %d", rec.Code)
+				}
+			}
+		})
+	}
+}
+
+// TestParseRouteGroups tests the -route-groups list
+func TestParseRouteGroups(t *testing.T) {
+	testCases := []struct {
+		list    string
+		enabled int
+		wantErr bool
+	}{
+		{"", len(routeGroups), false},
+		{"api", 1, false},
+		{" api , metrics ", 2, false},
+		{"api,web", 0, true},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.list, func(t *testing.T) {
+			enabled, err := parseRouteGroups(tc.list)
+			if (err != nil) != tc.wantErr {
+				t.Fatalf("Expected error: %v, got %v", tc.wantErr, err)
+			}
+			if len(enabled) != tc.enabled {
+				t.Errorf("Expected %d groups, got %v", tc.enabled, enabled)
+			}
+		})
+	}
+}
+
+// TestRequireAdminAuth tests that asking for the admin group without API keys fails, while the default list drops it
+func TestRequireAdminAuth(t *testing.T) {
+	keys, _ := loadAPIKeys("ops=k-ops", "")
+	testCases := []struct {
+		list    string
+		keys    *apiKeyStore
+		admin   bool
+		wantErr bool
+	}{
+		{"", nil, false, false},
+		{"", keys, true, false},
+		{"api,admin", nil, false, true},
+		{"api,admin", keys, true, false},
+		{"api", nil, false, false},
+	}
+	for _, tc := range testCases {
+		enabled, _ := parseRouteGroups(tc.list)
+		err := requireAdminAuth(enabled, tc.list, tc.keys)
+		if (err != nil) != tc.wantErr {
+			t.Errorf("Expected error: %v for %q with keys %v, got %v", tc.wantErr, tc.list, tc.keys != nil, err)
+		}
+		if err == nil && enabled[groupAdmin] != tc.admin {
+			t.Errorf("Expected admin served: %v for %q with keys %v, got %v", tc.admin, tc.list, tc.keys != nil, enabled[groupAdmin])
+		}
+	}
+}
+
+// TestRegisterDuplicateRoute tests that a route registered twice is an error rather than a panic
+func TestRegisterDuplicateRoute(t *testing.T) {
+	mux := http.NewServeMux()
+	if err := register(mux, "/api/verify", http.NotFoundHandler()); err != nil {
+		t.Fatalf("Expected the first registration to succeed, got %v", err)
+	}
+	if err := register(mux, "/api/verify", http.NotFoundHandler()); err == nil || !strings.Contains(err.Error(), "/api/verify") {
+		t.Errorf("Expected an error naming the route, got %v", err)
+	}
+}
@@ -0,0 +1,551 @@
+package httpapi
+
+import (
+	"context"
+	"crypto/hmac"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"email-verifier/pkg/verify"
+)
+
+// draining is set once shutdown begins, so load balancers stop sending
+// traffic while in-flight verifications finish.
+var draining atomic.Bool
+
+// Drain makes /health and /readyz answer 503 from now on. It is called
+// when the server starts shutting down.
+func Drain() { draining.Store(true) }
+
+// writeDraining answers a health probe during shutdown.
+func writeDraining(w http.ResponseWriter) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusServiceUnavailable)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"status":  "draining",
+		"service": "email-verifier",
+	})
+}
+
+func healthHandler(w http.ResponseWriter, r *http.Request) {
+	if draining.Load() {
+		writeDraining(w)
+		return
+	}
+	body := map[string]interface{}{
+		"status":  "healthy",
+		"service": "email-verifier",
+	}
+	if service != nil {
+		// Shown so a deployment can confirm its probing identity
+		helloName, fromEmail := service.Profiles().Default().Identity()
+		body["smtp"] = map[string]string{"hello_name": helloName, "from_email": fromEmail}
+		body["smtp_outbound_blocked"] = service.SMTPOutboundBlocked()
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(body)
+}
+
+func readyzHandler(w http.ResponseWriter, r *http.Request) {
+	if draining.Load() {
+		writeDraining(w)
+		return
+	}
+	if err := service.Ready(); err != nil {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusServiceUnavailable)
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"status":           "unavailable",
+			"error":            err.Error(),
+			"network_disabled": service.NetworkDisabled(),
+		})
+		return
+	}
+	// A startup prewarm holds readiness back, but only so long
+	if prewarm.holdingReadiness() {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusServiceUnavailable)
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"status":  "prewarming",
+			"prewarm": prewarm.State(),
+		})
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"status":           "ready",
+		"network_disabled": service.NetworkDisabled(),
+	})
+}
+
+func indexHandler(w http.ResponseWriter, r *http.Request) {
+	data := struct {
+		Title string
+	}{
+		Title: brands.For(r).ProductName,
+	}
+	renderPage(w, r, "index.html", data)
+}
+
+func verifyHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Redirect(w, r, "/", http.StatusSeeOther)
+		return
+	}
+
+	emails := pastedEmails(r.FormValue("email"))
+	if len(emails) == 0 {
+		http.Redirect(w, r, "/", http.StatusSeeOther)
+		return
+	}
+	if len(emails) > maxPaste {
+		http.Error(w, fmt.Sprintf("Too many addresses (at most %d per paste)", maxPaste), http.StatusRequestEntityTooLarge)
+		return
+	}
+
+	if err := service.Ready(); err != nil {
+		http.Error(w, "Verifier unavailable, try again shortly", http.StatusServiceUnavailable)
+		return
+	}
+	opts := verify.Options{Checks: service.ChecksFor("")}
+	l := laneFor(opts.Checks)
+	ctx, cancel := context.WithTimeout(r.Context(), waitFor(l))
+	defer cancel()
+
+	switch {
+	case len(emails) == 1:
+		logDomain(r, emails[0])
+		var result *verify.Result
+		start := time.Now()
+		if err := l.Do(ctx, func() { result = service.Verify(emails[0], opts) }); err != nil {
+			writeLaneBusy(w, l)
+			return
+		}
+		verificationDurations.Observe("web", time.Since(start))
+		verificationVerdicts.Add(result.Verdict, 1)
+		renderPage(w, r, "result.html", result)
+	case len(emails) < asyncPasteThreshold:
+		var results []*verify.Result
+		if err := l.Do(ctx, func() { results, _ = service.VerifyBatch(emails, opts) }); err != nil {
+			writeLaneBusy(w, l)
+			return
+		}
+		for _, result := range results {
+			verificationVerdicts.Add(result.Verdict, 1)
+		}
+		renderJob(w, r, jobView{Status: jobDone, Total: len(emails), Completed: len(results), Results: results})
+	default:
+		// Large pastes would outlast proxy timeouts; verify them in the
+		// background and let the progress page fill in.
+		id := jobs.Start(emails, opts)
+		http.Redirect(w, r, "/jobs/"+id, http.StatusSeeOther)
+	}
+}
+
+// pastedEmails splits the web form's input into addresses, one per line or
+// separated by commas or semicolons. Commas and semicolons in a quoted
+// display name or between angle brackets, as in "Doe, Jane" <jane@acme.io>,
+// don't separate.
+func pastedEmails(input string) []string {
+	var emails []string
+	add := func(field string) {
+		if email, _ := verify.NormalizeInput(field); email != "" {
+			emails = append(emails, email)
+		}
+	}
+	quoted, angled, start := false, false, 0
+	for i, r := range input {
+		switch r {
+		case '"':
+			quoted = !quoted
+		case '<':
+			angled = !quoted
+		case '>':
+			angled = false
+		case '\n', '\r', ',', ';':
+			if (quoted || angled) && r != '\n' && r != '\r' {
+				continue
+			}
+			add(input[start:i])
+			quoted, angled, start = false, false, i+1
+		}
+	}
+	add(input[start:])
+	return emails
+}
+
+// getResultMaxAge is how long a browser may reuse a GET /api/verify
+// result.
+const getResultMaxAge = 60
+
+// verifyRequest is the body of POST /api/verify; GET takes the same
+// fields as query parameters.
+type verifyRequest struct {
+	Email    string    `json:"email"`
+	Ref      string    `json:"ref"`
+	Context  string    `json:"context"`
+	Checks   checkList `json:"checks"`
+	Mode     string    `json:"mode"`
+	SkipSMTP bool      `json:"skip_smtp"`
+	// AutoVerifySuggestion also verifies the address a typo suggestion
+	// points at, into suggestion_result.
+	AutoVerifySuggestion bool `json:"auto_verify_suggestion"`
+}
+
+func apiVerifyHandler(w http.ResponseWriter, r *http.Request) {
+	var request verifyRequest
+
+	switch r.Method {
+	case http.MethodPost:
+		if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+			http.Error(w, "Invalid JSON", http.StatusBadRequest)
+			return
+		}
+	case http.MethodGet:
+		// Everything comes from the query, which checks, context and mode
+		// are read from below anyway
+		query := r.URL.Query()
+		request.Email = strings.TrimSpace(query.Get("email"))
+		request.Ref = strings.TrimSpace(query.Get("ref"))
+		if request.Email == "" && request.Ref == "" {
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(map[string]interface{}{
+				"error":  verify.ErrCodeEmailRequired,
+				"detail": "The email query parameter is required",
+			})
+			return
+		}
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if request.Context == "" {
+		request.Context = r.URL.Query().Get("context")
+	}
+	if request.Mode == "" {
+		request.Mode = r.URL.Query().Get("mode")
+	}
+	if r.URL.Query().Get("skip_smtp") == "true" {
+		request.SkipSMTP = true
+	}
+	if r.URL.Query().Get("auto_verify_suggestion") == "true" {
+		request.AutoVerifySuggestion = true
+	}
+
+	if err := service.Ready(); err != nil {
+		writeVerifierUnavailable(w, err)
+		return
+	}
+
+	checks, err := requestChecks(request.Checks, r.URL.Query().Get("checks"), requestKey(r))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	switch request.Mode {
+	case "":
+	case modeFast:
+		checks = checks.WithoutNetwork()
+	default:
+		http.Error(w, "Unknown mode (use fast or leave it out)", http.StatusBadRequest)
+		return
+	}
+	if request.SkipSMTP {
+		// Wins over checks and key defaults; checks_skipped shows it
+		checks = checks.Without(verify.CheckSMTP)
+	}
+
+	var run func(string, verify.Options) *verify.Result
+	switch request.Context {
+	case "", "recipient":
+		run = service.Verify
+	case "envelope_sender":
+		run = service.VerifyEnvelopeSender
+	default:
+		http.Error(w, "Unknown context (use recipient or envelope_sender)", http.StatusBadRequest)
+		return
+	}
+
+	opts := verify.Options{Checks: checks, Key: requestKey(r), Context: r.Context(), VerifySuggestion: request.AutoVerifySuggestion}
+
+	// A ref is resolved here so the caller never handles the address;
+	// results are keyed by the ref unless the key may see the address
+	hide := false
+	if request.Ref != "" {
+		if request.Email != "" {
+			http.Error(w, "Send either email or ref, not both", http.StatusBadRequest)
+			return
+		}
+		resolver, email, code, err := resolveRef(r.Context(), request.Ref)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if r.URL.Query().Get("include_address") == "true" && !resolver.mayReveal(opts.Key) {
+			http.Error(w, "This API key may not see resolved addresses", http.StatusForbidden)
+			return
+		}
+		if code != "" {
+			result := verify.ErrorResult(code)
+			result.Ref = request.Ref
+			w.Header().Set("Content-Type", "application/json")
+			json.NewEncoder(w).Encode(result)
+			return
+		}
+		request.Email = email
+		hide = r.URL.Query().Get("include_address") != "true"
+	}
+
+	logDomain(r, request.Email)
+
+	// Streams are for watching the stages run, so they always verify
+	tenant := service.TenantFor(opts.Key)
+	variant := cacheVariant(request.Email, opts.Key, checks, request.Context, request.AutoVerifySuggestion)
+	if r.URL.Query().Get("stream") != "true" {
+		if cached := verifyCache.Get(tenant, request.Email, variant); cached != nil {
+			if request.Ref != "" {
+				cached.Ref = request.Ref
+				if hide {
+					hideAddress(cached, request.Ref)
+				}
+			}
+			writeVerifyResult(w, r, cached)
+			return
+		}
+	}
+
+	var stages *stageWriter
+	if r.URL.Query().Get("stream") == "true" {
+		stages = newStageWriter(w, r.Context())
+		opts.Progress = stages.Stage
+		if request.Ref != "" {
+			opts.Progress = func(stage string, partial *verify.Result) bool {
+				shown := *partial
+				if hide {
+					hideAddress(&shown, request.Ref)
+				}
+				shown.Ref = request.Ref
+				return stages.Stage(stage, &shown)
+			}
+		}
+	}
+	l := laneFor(checks)
+	ctx, cancel := context.WithTimeout(r.Context(), waitFor(l))
+	defer cancel()
+	var result *verify.Result
+	start := time.Now()
+	if err := l.Do(ctx, func() { result = run(request.Email, opts) }); err != nil {
+		if r.Context().Err() != nil {
+			// The caller's deadline passed while waiting for a slot
+			result = verify.ErrorResult(verify.ErrCodeDeadlineExceeded)
+			result.Email, result.Ref = request.Email, request.Ref
+			if hide {
+				hideAddress(result, request.Ref)
+			}
+			w.Header().Set("Content-Type", "application/json")
+			json.NewEncoder(w).Encode(withRequestID(r, result))
+			return
+		}
+		writeLaneBusy(w, l)
+		return
+	}
+	if stages != nil && stages.Gone() {
+		// The stages that ran are billed, but a partial result is kept
+		// out of forwarding and history
+		usage.Record(opts.Key, result.CostUnits)
+		return
+	}
+	took := time.Since(start)
+	verificationDurations.Observe("api", took)
+	verifyCache.Put(tenant, request.Email, variant, result)
+	if request.Ref != "" {
+		// History keeps the address for send checks; everything that goes
+		// back to the caller's systems is keyed by the ref
+		shown := *result
+		shown.Ref = request.Ref
+		if hide {
+			hideAddress(&shown, request.Ref)
+		}
+		usage.Record(opts.Key, result.CostUnits)
+		outcomes.Record(result)
+		verificationVerdicts.Add(result.Verdict, 1)
+		forwarder.Enqueue(opts.Key, &shown)
+		recordHistory(opts.Key, result, took)
+		result = &shown
+	} else {
+		recordResult(requestKey(r), result, took)
+	}
+	if shadow != nil && request.Context != "envelope_sender" && request.Ref == "" {
+		// The shadow run outlives the request
+		opts.Progress, opts.Context = nil, nil
+		shadow.Maybe(request.Email, opts, result)
+	}
+
+	if stages != nil {
+		stages.Final(withRequestID(r, result))
+		return
+	}
+	writeVerifyResult(w, r, result)
+}
+
+// writeVerifyResult sends an /api/verify result.
+func writeVerifyResult(w http.ResponseWriter, r *http.Request, result *verify.Result) {
+	if r.Method == http.MethodGet && result.ErrorCode == "" {
+		// Repeated lookups from the same browser are common, so it may
+		// keep a complete result briefly. The result holds the address,
+		// so shared caches still may not.
+		w.Header().Set("Cache-Control", fmt.Sprintf("private, max-age=%d", getResultMaxAge))
+		w.Header().Del("Pragma")
+		w.Header().Add("Vary", "X-API-Key")
+	}
+	setRetryAfter(w, result)
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(withRequestID(r, result))
+}
+
+// setRetryAfter tells the client when a result that came back without an
+// answer is worth asking for again.
+func setRetryAfter(w http.ResponseWriter, result *verify.Result) {
+	if result.RetryAfter > 0 {
+		w.Header().Set("Retry-After", strconv.Itoa(result.RetryAfter))
+	}
+}
+
+func apiRetryHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var request struct {
+		Email      string `json:"email"`
+		RetryToken string `json:"retry_token"`
+	}
+
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		http.Error(w, "Invalid JSON", http.StatusBadRequest)
+		return
+	}
+
+	claims, err := service.RetryTokens().Parse(request.RetryToken)
+	switch {
+	case errors.Is(err, verify.ErrTokenExpired):
+		http.Error(w, "Retry token has expired", http.StatusGone)
+		return
+	case errors.Is(err, verify.ErrTokenSignature):
+		http.Error(w, "Invalid retry token", http.StatusForbidden)
+		return
+	case err != nil:
+		http.Error(w, "Malformed retry token", http.StatusBadRequest)
+		return
+	}
+
+	if !hmac.Equal([]byte(claims.AddressHash), []byte(verify.AddressHash(request.Email))) {
+		http.Error(w, "Retry token does not match email", http.StatusBadRequest)
+		return
+	}
+
+	if wait := service.RetryTokens().Wait(claims); wait > 0 {
+		seconds := int(math.Ceil(wait.Seconds()))
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Retry-After", strconv.Itoa(seconds))
+		w.WriteHeader(http.StatusTooManyRequests)
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"error":       "Retry requested before the recommended delay",
+			"retry_after": seconds,
+		})
+		return
+	}
+
+	if err := service.Ready(); err != nil {
+		writeVerifierUnavailable(w, err)
+		return
+	}
+	key := requestKey(r)
+	opts := verify.Options{Checks: service.ChecksFor(key), Key: key, Context: r.Context()}
+	l := laneFor(opts.Checks)
+	ctx, cancel := context.WithTimeout(r.Context(), waitFor(l))
+	defer cancel()
+	var result *verify.Result
+	start := time.Now()
+	if err := l.Do(ctx, func() { result = service.Verify(request.Email, opts) }); err != nil {
+		writeLaneBusy(w, l)
+		return
+	}
+	recordResult(key, result, time.Since(start))
+
+	setRetryAfter(w, result)
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(withRequestID(r, result))
+}
+
+// writeVerifierUnavailable reports a verifier that failed to initialize.
+func writeVerifierUnavailable(w http.ResponseWriter, err error) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusServiceUnavailable)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"error":  "verifier_unavailable",
+		"detail": err.Error(),
+	})
+}
+
+// recordResult hands a completed API verification to usage metering,
+// alerting, forwarding and history. took is how long it ran, or 0 for a
+// result verified as part of a batch.
+func recordResult(key string, result *verify.Result, took time.Duration) {
+	usage.Record(key, result.CostUnits)
+	outcomes.Record(result)
+	verificationVerdicts.Add(result.Verdict, 1)
+	forwarder.Enqueue(key, result)
+	recordHistory(key, result, took)
+}
+
+// recordHistory keeps result in whichever histories are enabled.
+func recordHistory(key string, result *verify.Result, took time.Duration) {
+	tenant := service.TenantFor(key)
+	if history != nil {
+		history.Record(tenant, result)
+	}
+	if historyLog != nil {
+		historyLog.Record(tenant, result, took)
+	}
+}
+
+// checkList accepts either a comma-separated string or a JSON array.
+type checkList []string
+
+func (c *checkList) UnmarshalJSON(data []byte) error {
+	var list []string
+	if err := json.Unmarshal(data, &list); err == nil {
+		*c = list
+		return nil
+	}
+	var joined string
+	if err := json.Unmarshal(data, &joined); err != nil {
+		return fmt.Errorf("checks must be a string or an array of strings")
+	}
+	*c = strings.Split(joined, ",")
+	return nil
+}
+
+// requestChecks resolves the checks for an API request: the body's checks
+// field wins, then the checks query parameter, then the key's defaults.
+func requestChecks(body checkList, query, key string) (verify.CheckSet, error) {
+	switch {
+	case body != nil:
+		return verify.ParseChecks(body...)
+	case query != "":
+		return verify.ParseChecks(strings.Split(query, ",")...)
+	}
+	return service.ChecksFor(key), nil
+}
@@ -0,0 +1,478 @@
+package httpapi
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"reflect"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"email-verifier/pkg/verify"
+	"email-verifier/pkg/verify/verifytest"
+	emailverifier "github.com/AfterShip/email-verifier"
+)
+
+// TestRequestChecks tests precedence between the body, query and per-key defaults
+func TestRequestChecks(t *testing.T) {
+	useService(t, verify.Config{KeyChecks: map[string]verify.CheckSet{"lean": verify.MustParseChecks(verify.CheckSyntax)}})
+
+	testCases := []struct {
+		name     string
+		body     string
+		query    string
+		key      string
+		expected []string
+	}{
+		{"array body", `{"checks":["smtp"]}`, "free", "", []string{"syntax", "mx", "smtp"}},
+		{"string body", `{"checks":"role,free"}`, "", "", []string{"syntax", "free", "role"}},
+		{"query", `{}`, "disposable", "", []string{"syntax", "disposable"}},
+		{"key default", `{}`, "", "lean", []string{"syntax"}},
+		{"server default", `{}`, "", "other", verify.DefaultChecks.Names()},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			var request struct {
+				Checks checkList `json:"checks"`
+			}
+			if err := json.Unmarshal([]byte(tc.body), &request); err != nil {
+				t.Fatalf("Failed to decode body: %v", err)
+			}
+			set, err := requestChecks(request.Checks, tc.query, tc.key)
+			if err != nil {
+				t.Fatalf("Expected no error, got %v", err)
+			}
+			if got := set.Names(); !reflect.DeepEqual(got, tc.expected) {
+				t.Errorf("Expected %v, got %v", tc.expected, got)
+			}
+		})
+	}
+}
+
+// TestUnknownChecksRejected tests that the API lists valid checks when given an unknown one
+func TestUnknownChecksRejected(t *testing.T) {
+	body := strings.NewReader(`{"email":"jane@example.com","checks":["mx","bogus"]}`)
+	req := httptest.NewRequest(http.MethodPost, "/api/verify", body)
+	rec := httptest.NewRecorder()
+	apiVerifyHandler(rec, req)
+
+	if rec.Code != http.StatusBadRequest {
+		t.Fatalf("Expected status 400, got %d", rec.Code)
+	}
+	if msg := rec.Body.String(); !strings.Contains(msg, strings.Join(verify.CheckOrder, ", ")) {
+		t.Errorf("Expected error listing the valid checks, got %q", msg)
+	}
+
+	req = httptest.NewRequest(http.MethodPost, "/api/verify?checks=syntax,nope", bytes.NewReader([]byte(`{"email":"a@b.co"}`)))
+	rec = httptest.NewRecorder()
+	apiVerifyHandler(rec, req)
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("Expected status 400 for unknown query check, got %d", rec.Code)
+	}
+}
+
+// TestMaliciousInputNotReflected tests that hostile input only ever comes back in the email field
+func TestMaliciousInputNotReflected(t *testing.T) {
+	useService(t, verify.Config{Resolver: verifytest.NewResolver()})
+
+	const payload = `"><script>alert(1)</script>`
+	jsonBody := func(v interface{}) *bytes.Reader {
+		data, _ := json.Marshal(v)
+		return bytes.NewReader(data)
+	}
+
+	testCases := []struct {
+		name    string
+		handler http.HandlerFunc
+		req     *http.Request
+	}{
+		{"api email", apiVerifyHandler, httptest.NewRequest(http.MethodPost, "/api/verify", jsonBody(map[string]string{"email": payload + "@example.com"}))},
+		{"api email domain", apiVerifyHandler, httptest.NewRequest(http.MethodPost, "/api/verify", jsonBody(map[string]string{"email": "jane@" + payload}))},
+		{"api checks", apiVerifyHandler, httptest.NewRequest(http.MethodPost, "/api/verify", jsonBody(map[string]interface{}{"email": "jane@example.com", "checks": []string{payload}}))},
+		{"api checks query", apiVerifyHandler, httptest.NewRequest(http.MethodPost, "/api/verify?checks="+url.QueryEscape(payload), jsonBody(map[string]string{"email": "jane@example.com"}))},
+		{"api context", apiVerifyHandler, httptest.NewRequest(http.MethodPost, "/api/verify", jsonBody(map[string]string{"email": "jane@example.com", "context": payload}))},
+		{"envelope sender", apiVerifyHandler, httptest.NewRequest(http.MethodPost, "/api/verify", jsonBody(map[string]string{"email": "SRS0=x=y=" + payload + "=jane@fwd.example", "context": "envelope_sender"}))},
+		{"retry token", apiRetryHandler, httptest.NewRequest(http.MethodPost, "/api/verify/retry", jsonBody(map[string]string{"email": "jane@example.com", "retry_token": payload}))},
+		{"history as_of", historyHandler, httptest.NewRequest(http.MethodGet, "/api/history?email=jane@example.com&as_of="+url.QueryEscape(payload), nil)},
+		{"watch domain", watchesHandler, httptest.NewRequest(http.MethodPost, "/api/watches", jsonBody(map[string]string{"domain": payload}))},
+		{"watch interval", watchesHandler, httptest.NewRequest(http.MethodPost, "/api/watches", jsonBody(map[string]string{"domain": "example.com", "interval": payload}))},
+	}
+
+	savedHistory := history
+	history = newHistoryStore()
+	t.Cleanup(func() { history = savedHistory })
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			tc.handler(rec, tc.req)
+
+			body := rec.Body.Bytes()
+			var result map[string]interface{}
+			if json.Unmarshal(body, &result) == nil {
+				// The email (and the envelope's decoded copies of it) is the
+				// one place the input is expected to be echoed.
+				delete(result, "email")
+				delete(result, "envelope")
+				body, _ = json.Marshal(result)
+			}
+			if strings.Contains(string(body), "script") {
+				t.Errorf("Expected input not to be reflected, got %s", body)
+			}
+		})
+	}
+}
+
+// TestHTMLResultEscapesInput tests that the result page doesn't render hostile input as markup
+func TestHTMLResultEscapesInput(t *testing.T) {
+	useService(t, verify.Config{Resolver: verifytest.NewResolver()})
+
+	form := url.Values{"email": {`"><script>alert(1)</script>@example.com`}}
+	req := httptest.NewRequest(http.MethodPost, "/verify", strings.NewReader(form.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	rec := httptest.NewRecorder()
+	verifyHandler(rec, req)
+
+	if strings.Contains(rec.Body.String(), "<script>alert(1)</script>") {
+		t.Error("Expected hostile input to be escaped on the result page")
+	}
+}
+
+// TestHTMLResultNonRoutable tests that the result page explains literal and non-routable domains
+func TestHTMLResultNonRoutable(t *testing.T) {
+	useService(t, verify.Config{Resolver: verifytest.NewResolver()})
+
+	testCases := map[string]string{
+		"jane@[192.0.2.1]": "names a server by IP address",
+		"jane@intranet":    "has no top-level domain",
+		"jane@build.test":  "reserved top-level domain",
+	}
+	for email, want := range testCases {
+		t.Run(email, func(t *testing.T) {
+			rec := postPaste(email)
+			if !strings.Contains(rec.Body.String(), want) {
+				t.Errorf("Expected the result page to say %q", want)
+			}
+		})
+	}
+}
+
+// TestHTMLResultMX tests that the result page lists the MX hosts
+func TestHTMLResultMX(t *testing.T) {
+	fake := verifytest.NewResolver()
+	fake.MX["mail.mock"] = []*net.MX{{Host: "mx2.mail.mock.", Pref: 20}, {Host: "mx1.mail.mock.", Pref: 10}}
+	useService(t, verify.Config{Resolver: fake})
+
+	body := postPaste("jane@mail.mock").Body.String()
+	first, second := strings.Index(body, "mx1.mail.mock"), strings.Index(body, "mx2.mail.mock")
+	if first < 0 || second < first {
+		t.Errorf("Expected both MX hosts by preference on the result page, got positions %d and %d", first, second)
+	}
+}
+
+// TestDisplayNameInput tests that addresses pasted with display names are verified by their bare address on the form and the API
+func TestDisplayNameInput(t *testing.T) {
+	fake := verifytest.NewResolver()
+	fake.MX["mail.mock"] = []*net.MX{{Host: "mx.mail.mock.", Pref: 10}}
+	useService(t, verify.Config{Resolver: fake})
+
+	if body := postPaste(`"Doe, Jane" <jane@mail.mock>`).Body.String(); !strings.Contains(body, "Doe, Jane") || !strings.Contains(body, "jane@mail.mock") || strings.Contains(body, "Invalid Email Format") {
+		t.Errorf("Expected the result page for jane with her display name, got %s", body)
+	}
+	emails := pastedEmails("Jane Doe <jane@mail.mock>, \"Roe; Bob\" <bob@mail.mock>\nann@mail.mock;<cy@mail.mock>")
+	expected := []string{"Jane Doe <jane@mail.mock>", `"Roe; Bob" <bob@mail.mock>`, "ann@mail.mock", "<cy@mail.mock>"}
+	if strings.Join(emails, "|") != strings.Join(expected, "|") {
+		t.Errorf("Expected %q, got %q", expected, emails)
+	}
+
+	rec := httptest.NewRecorder()
+	apiVerifyHandler(rec, httptest.NewRequest(http.MethodPost, "/api/verify", strings.NewReader(`{"email": "Jane Doe <jane@mail.mock>"}`)))
+	var result verify.Result
+	json.Unmarshal(rec.Body.Bytes(), &result)
+	if result.Email != "jane@mail.mock" || result.DisplayName != "Jane Doe" || !result.IsValid {
+		t.Errorf("Expected the bare address with its display name, got %s", rec.Body.String())
+	}
+}
+
+// TestAutoVerifySuggestion tests that auto_verify_suggestion embeds the suggested address's result, and isn't answered by a cached result without it
+func TestAutoVerifySuggestion(t *testing.T) {
+	fake := verifytest.NewResolver()
+	fake.MX["gmail.com"] = []*net.MX{{Host: "gmail-smtp-in.l.google.com.", Pref: 5}}
+	useService(t, verify.Config{Resolver: fake})
+	now := time.Date(2026, 5, 1, 12, 0, 0, 0, time.UTC)
+	useResultCache(t, 10, &now)
+
+	if result := verifyResult(t, `{"email": "jane@gmaii.com", "checks": "mx,suggest"}`); result.Suggestion != "gmail.com" || result.SuggestionResult != nil {
+		t.Errorf("Expected a suggestion without its result, got %+v", result)
+	}
+	for _, rec := range []*httptest.ResponseRecorder{
+		postVerify(t, "", `{"email": "jane@gmaii.com", "checks": "mx,suggest", "auto_verify_suggestion": true}`),
+		postVerify(t, "?auto_verify_suggestion=true", `{"email": "Jane@gmaii.com", "checks": "mx,suggest"}`),
+	} {
+		var result verify.Result
+		json.Unmarshal(rec.Body.Bytes(), &result)
+		if result.Cached || result.SuggestionResult == nil || !result.SuggestionResult.HasMxRecords || result.SuggestionResult.Email != result.Username+"@gmail.com" {
+			t.Errorf("Expected the suggested address verified afresh, got %s", rec.Body.String())
+		}
+	}
+}
+
+// TestEnvelopeSenderContext tests the context=envelope_sender API parameter
+func TestEnvelopeSenderContext(t *testing.T) {
+	testCases := []struct {
+		name   string
+		body   map[string]string
+		query  string
+		status int
+		class  string
+	}{
+		{"null sender in body", map[string]string{"email": "<>", "context": "envelope_sender"}, "", http.StatusOK, verify.EnvelopeNull},
+		{"srs via query", map[string]string{"email": "SRS0=HHH=TT=example.com=alice@forwarder.net"}, "?context=envelope_sender", http.StatusOK, verify.EnvelopeSRS0},
+		{"unknown context", map[string]string{"email": "a@example.com", "context": "bogus"}, "", http.StatusBadRequest, ""},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			body, _ := json.Marshal(tc.body)
+			req := httptest.NewRequest(http.MethodPost, "/api/verify"+tc.query, bytes.NewReader(body))
+			rec := httptest.NewRecorder()
+			apiVerifyHandler(rec, req)
+
+			if rec.Code != tc.status {
+				t.Fatalf("Expected status %d, got %d", tc.status, rec.Code)
+			}
+			if tc.status != http.StatusOK {
+				return
+			}
+			var result verify.Result
+			if err := json.Unmarshal(rec.Body.Bytes(), &result); err != nil {
+				t.Fatalf("Failed to parse JSON response: %v", err)
+			}
+			if result.Envelope == nil || result.Envelope.Classification != tc.class {
+				t.Errorf("Expected classification %s, got %+v", tc.class, result.Envelope)
+			}
+			if tc.class == verify.EnvelopeNull && (result.Error != "" || !result.IsValid) {
+				t.Errorf("Expected null sender to be valid without error, got %+v", result)
+			}
+		})
+	}
+}
+
+// TestVerifyGet tests that GET /api/verify answers like POST, trims its parameter and lets browsers keep complete results briefly
+func TestVerifyGet(t *testing.T) {
+	useService(t, verify.Config{Resolver: verifytest.NewResolver(), Polite: verify.PoliteConfig{Off: true}})
+	handler := Handler()
+	get := func(query string) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/verify"+query, nil))
+		return rec
+	}
+
+	rec := get("?email=%20jane%40example.com%20&checks=syntax")
+	var viaGet, viaPost map[string]interface{}
+	json.NewDecoder(rec.Body).Decode(&viaGet)
+	json.NewDecoder(postVerify(t, "", `{"email": "jane@example.com", "checks": "syntax"}`).Body).Decode(&viaPost)
+	if rec.Code != http.StatusOK || !reflect.DeepEqual(viaGet, viaPost) {
+		t.Errorf("Expected the POST result, got %d\nget:  %v\npost: %v", rec.Code, viaGet, viaPost)
+	}
+	if cc := rec.Header().Get("Cache-Control"); cc != "private, max-age=60" || rec.Header().Get("Pragma") != "" || rec.Header().Get("Vary") != "X-API-Key" {
+		t.Errorf("Expected a private, briefly cacheable response, got %q %v", cc, rec.Header())
+	}
+
+	if rec := get("?email=not-an-address"); rec.Code != http.StatusOK || rec.Header().Get("Cache-Control") != "no-store" {
+		t.Errorf("Expected a failed result not to be cacheable, got %d %q", rec.Code, rec.Header().Get("Cache-Control"))
+	}
+
+	rec = get("?email=%20")
+	var body struct{ Error string }
+	json.NewDecoder(rec.Body).Decode(&body)
+	if rec.Code != http.StatusBadRequest || body.Error != verify.ErrCodeEmailRequired || rec.Header().Get("Cache-Control") != "no-store" {
+		t.Errorf("Expected status 400 with email_required, got %d %+v", rec.Code, body)
+	}
+}
+
+// TestSkipSMTP tests that skip_smtp drops the probe, whichever checks were asked for, and reports it as skipped
+func TestSkipSMTP(t *testing.T) {
+	smtp := useStreamService(t)
+	testCases := []struct{ query, body string }{
+		{"", `{"email": "jane@partner.mock", "checks": "free,role,disposable,suggest,smtp", "skip_smtp": true}`},
+		{"?skip_smtp=true", `{"email": "jane@partner.mock", "checks": "free,role,disposable,suggest,smtp"}`},
+	}
+	for _, tc := range testCases {
+		var result verify.Result
+		json.NewDecoder(postVerify(t, tc.query, tc.body).Body).Decode(&result)
+		performed := verify.MustParseChecks(verify.CheckFree, verify.CheckRole, verify.CheckDisposable, verify.CheckSuggest, verify.CheckMX).Names()
+		if result.Reachable != "unknown" || !reflect.DeepEqual(result.ChecksPerformed, performed) || !slices.Contains(result.ChecksSkipped, verify.CheckSMTP) || !result.HasMxRecords {
+			t.Errorf("Expected everything but smtp to run for %s%s, got %+v", tc.query, tc.body, result)
+		}
+	}
+	if n := smtp.Probes(); n != 0 {
+		t.Errorf("Expected no probes, got %d", n)
+	}
+	if checks := verify.MustParseChecks(verify.CheckSMTP, verify.CheckFree).Without(verify.CheckMX).Names(); !reflect.DeepEqual(checks, []string{verify.CheckSyntax, verify.CheckFree}) {
+		t.Errorf("Expected dropping mx to drop smtp too, got %v", checks)
+	}
+}
+
+// TestRetryHandler tests the retry endpoint's token checks
+func TestRetryHandler(t *testing.T) {
+	signer := verify.NewRetrySigner([]byte("secret"), time.Hour)
+	useService(t, verify.Config{RetryTokens: signer, Resolver: verifytest.NewResolver()})
+
+	early := signer.Issue("user@example.com", time.Minute)
+	ready := signer.Issue("user@example.com", 0)
+	forged := verify.NewRetrySigner([]byte("forged"), time.Hour).Issue("user@example.com", 0)
+
+	testCases := []struct {
+		name   string
+		email  string
+		token  string
+		status int
+	}{
+		{"too early", "user@example.com", early, http.StatusTooManyRequests},
+		{"wrong email", "other@example.com", ready, http.StatusBadRequest},
+		{"forged", "user@example.com", forged, http.StatusForbidden},
+		{"malformed", "user@example.com", "garbage", http.StatusBadRequest},
+		{"ready", "user@example.com", ready, http.StatusOK},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			body, _ := json.Marshal(map[string]string{"email": tc.email, "retry_token": tc.token})
+			req := httptest.NewRequest(http.MethodPost, "/api/verify/retry", bytes.NewReader(body))
+			rec := httptest.NewRecorder()
+
+			apiRetryHandler(rec, req)
+
+			if rec.Code != tc.status {
+				t.Errorf("Expected status %d, got %d: %s", tc.status, rec.Code, rec.Body.String())
+			}
+			// Tokens carry whole seconds, so a second boundary passing
+			// since Issue can take one off the wait.
+			if retryAfter := rec.Header().Get("Retry-After"); tc.status == http.StatusTooManyRequests && retryAfter != "60" && retryAfter != "59" {
+				t.Errorf("Expected Retry-After 60, got %q", retryAfter)
+			}
+		})
+	}
+}
+
+// TestRetryHandlerKey tests that a retry runs with the caller's per-key checks
+func TestRetryHandlerKey(t *testing.T) {
+	signer := verify.NewRetrySigner([]byte("secret"), time.Hour)
+	useService(t, verify.Config{RetryTokens: signer, Resolver: verifytest.NewResolver(), KeyChecks: map[string]verify.CheckSet{"lean": verify.MustParseChecks(verify.CheckSyntax)}})
+
+	body, _ := json.Marshal(map[string]string{"email": "user@example.com", "retry_token": signer.Issue("user@example.com", 0)})
+	req := httptest.NewRequest(http.MethodPost, "/api/verify/retry", bytes.NewReader(body))
+	req.Header.Set("X-API-Key", "lean")
+	rec := httptest.NewRecorder()
+	apiRetryHandler(rec, req)
+
+	var result verify.Result
+	json.NewDecoder(rec.Body).Decode(&result)
+	if rec.Code != http.StatusOK || !reflect.DeepEqual(result.ChecksPerformed, []string{verify.CheckSyntax}) {
+		t.Errorf("Expected only the key's syntax check, got %d %v", rec.Code, result.ChecksPerformed)
+	}
+}
+
+// TestVerifierUnavailable tests that a failed initialization surfaces as 503s
+func TestVerifierUnavailable(t *testing.T) {
+	useService(t, verify.Config{BuildVerifier: func() (*emailverifier.Verifier, error) {
+		return nil, errors.New("disposable list failed to load")
+	}})
+
+	rec := httptest.NewRecorder()
+	readyzHandler(rec, httptest.NewRequest(http.MethodGet, "/readyz", nil))
+	if rec.Code != http.StatusServiceUnavailable {
+		t.Errorf("Expected /readyz status 503, got %d", rec.Code)
+	}
+
+	rec = httptest.NewRecorder()
+	apiVerifyHandler(rec, httptest.NewRequest(http.MethodPost, "/api/verify", strings.NewReader(`{"email":"jane@example.com"}`)))
+	if rec.Code != http.StatusServiceUnavailable {
+		t.Fatalf("Expected /api/verify status 503, got %d", rec.Code)
+	}
+	var body map[string]string
+	if err := json.NewDecoder(rec.Body).Decode(&body); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	if body["error"] != "verifier_unavailable" {
+		t.Errorf("Expected error verifier_unavailable, got %q", body["error"])
+	}
+}
+
+// TestHealthSMTPIdentity tests that /health shows the EHLO name and MAIL FROM address probes send
+func TestHealthSMTPIdentity(t *testing.T) {
+	identity := func() map[string]string {
+		rec := httptest.NewRecorder()
+		healthHandler(rec, httptest.NewRequest(http.MethodGet, "/health", nil))
+		var body struct{ SMTP map[string]string }
+		json.NewDecoder(rec.Body).Decode(&body)
+		return body.SMTP
+	}
+	useService(t, verify.Config{})
+	if got := identity(); got["hello_name"] != verify.LibraryHelloName || got["from_email"] != verify.LibraryFromEmail {
+		t.Errorf("Expected the library defaults, got %v", got)
+	}
+	useService(t, verify.Config{DefaultSMTP: verify.Profile{HelloName: "probe.example.com", FromEmail: "verify@example.com"}})
+	if got := identity(); got["hello_name"] != "probe.example.com" || got["from_email"] != "verify@example.com" {
+		t.Errorf("Expected the configured identity, got %v", got)
+	}
+}
+
+// TestHealthSMTPOutboundBlocked tests that /health and results say when the self-test found port 25 blocked
+func TestHealthSMTPOutboundBlocked(t *testing.T) {
+	blocked := func() bool {
+		rec := httptest.NewRecorder()
+		healthHandler(rec, httptest.NewRequest(http.MethodGet, "/health", nil))
+		var body struct {
+			Blocked bool `json:"smtp_outbound_blocked"`
+		}
+		json.NewDecoder(rec.Body).Decode(&body)
+		return body.Blocked
+	}
+	useService(t, verify.Config{Resolver: verifytest.NewResolver(), Prober: verifytest.NewSMTP().Probe})
+	if blocked() {
+		t.Error("Expected port 25 not blocked before the self-test says so")
+	}
+	service.SetSMTPOutboundBlocked(true)
+	if !blocked() {
+		t.Error("Expected /health to report port 25 blocked")
+	}
+	var result verify.Result
+	json.Unmarshal(postVerify(t, "", `{"email": "jane@example.mock", "checks": "smtp"}`).Body.Bytes(), &result)
+	if !slices.Contains(result.Warnings, verify.WarningSMTPOutboundBlocked) {
+		t.Errorf("Expected the smtp_outbound_blocked warning, got %v", result.Warnings)
+	}
+	var syntaxOnly verify.Result
+	json.Unmarshal(postVerify(t, "", `{"email": "jane@example.mock", "checks": "syntax"}`).Body.Bytes(), &syntaxOnly)
+	if slices.Contains(syntaxOnly.Warnings, verify.WarningSMTPOutboundBlocked) {
+		t.Errorf("Expected no warning without the smtp check, got %v", syntaxOnly.Warnings)
+	}
+}
+
+// TestRetryAfterHeader tests that a deferred verification tells the client when to ask again
+func TestRetryAfterHeader(t *testing.T) {
+	fake := verifytest.NewResolver()
+	fake.MX["greylist.mock"] = []*net.MX{{Host: "mx.greylist.mock.", Pref: 10}}
+	useService(t, verify.Config{Resolver: fake, Prober: func(ctx context.Context, profile, domain, username string, catchAll bool) (*emailverifier.SMTP, error) {
+		return &emailverifier.SMTP{HostExists: true}, emailverifier.ParseSMTPError(errors.New("451 4.7.1 Greylisted, try again later"))
+	}})
+
+	rec := postVerify(t, "", `{"email": "jane@greylist.mock", "checks": "smtp"}`)
+	var result verify.Result
+	json.Unmarshal(rec.Body.Bytes(), &result)
+	if !result.Deferred || rec.Header().Get("Retry-After") != "300" {
+		t.Errorf("Expected a deferred result with Retry-After 300, got %q and %s", rec.Header().Get("Retry-After"), rec.Body.String())
+	}
+	if rec := postVerify(t, "", `{"email": "jane@greylist.mock", "checks": "mx"}`); rec.Header().Get("Retry-After") != "" {
+		t.Errorf("Expected no Retry-After without a deferral, got %q", rec.Header().Get("Retry-After"))
+	}
+}
@@ -0,0 +1,402 @@
+package httpapi
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"email-verifier/pkg/verify"
+)
+
+// historyEntry is one past verification of an address. DurationMS is only
+// known for entries read from the history db.
+type historyEntry struct {
+	VerifiedAt time.Time      `json:"verified_at"`
+	DurationMS float64        `json:"duration_ms,omitempty"`
+	Result     *verify.Result `json:"result"`
+
+	seq uint64 // breaks ties between entries verified in the same instant
+}
+
+// cursor is the entry's position in its address's history.
+func (e historyEntry) cursor() pageCursor {
+	return pageCursor{Key: e.VerifiedAt.UnixNano(), ID: fmt.Sprintf("%016x", e.seq)}
+}
+
+// historyStore keeps past results indexed by (tenant, addressID,
+// verified_at), so point-in-time lookups are a binary search and one
+// tenant's results are never returned to another. In privacy mode the
+// results themselves are stored without the address; see storedResult.
+type historyStore struct {
+	mu      sync.RWMutex
+	entries map[string][]historyEntry // by historyKey, ordered by VerifiedAt, then seq
+	nextSeq uint64
+	now     func() time.Time
+}
+
+// history is nil unless -history is set.
+var history *historyStore
+
+func newHistoryStore() *historyStore {
+	return &historyStore{entries: make(map[string][]historyEntry), now: time.Now}
+}
+
+// historyKey partitions stored results by tenant. id is the address's
+// addressID.
+func historyKey(tenant, id string) string {
+	return tenant + "/" + id
+}
+
+// Record stores result as verified now for tenant.
+func (h *historyStore) Record(tenant string, result *verify.Result) {
+	if result.Email == "" {
+		return
+	}
+	hash := historyKey(tenant, addressID(result.Email))
+	entry := historyEntry{VerifiedAt: h.now().UTC(), Result: storedResult(result)}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	entry.seq = h.nextSeq
+	h.nextSeq++
+	list := h.entries[hash]
+	i := sort.Search(len(list), func(i int) bool { return list[i].VerifiedAt.After(entry.VerifiedAt) })
+	list = append(list, historyEntry{})
+	copy(list[i+1:], list[i:])
+	list[i] = entry
+	h.entries[hash] = list
+}
+
+// Lookup returns every result tenant stored for the address with
+// addressID id, oldest first.
+func (h *historyStore) Lookup(tenant, id string) []historyEntry {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	list := h.entries[historyKey(tenant, id)]
+	return append([]historyEntry(nil), list...)
+}
+
+// AsOf returns the latest result tenant stored for the address with
+// addressID id verified at or before at, and whether a later result
+// reached a different verdict.
+func (h *historyStore) AsOf(tenant, id string, at time.Time) (entry historyEntry, found, contradicted bool) {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	list := h.entries[historyKey(tenant, id)]
+	i := sort.Search(len(list), func(i int) bool { return list[i].VerifiedAt.After(at) })
+	if i == 0 {
+		return historyEntry{}, false, false
+	}
+	entry = list[i-1]
+	for _, later := range list[i:] {
+		if later.Result.Verdict != entry.Result.Verdict {
+			contradicted = true
+			break
+		}
+	}
+	return entry, true, contradicted
+}
+
+// Delete drops every result tenant stored for the address with addressID
+// id and returns how many there were.
+func (h *historyStore) Delete(tenant, id string) int {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	n := len(h.entries[historyKey(tenant, id)])
+	delete(h.entries, historyKey(tenant, id))
+	return n
+}
+
+// Each calls fn with each of tenant's stored results that match f, oldest
+// first, and stops at the first error fn returns.
+func (h *historyStore) Each(tenant string, f historyFilter, fn func(historyEntry) error) error {
+	id := f.Hash
+	if f.Email != "" {
+		id = addressID(f.Email)
+	}
+	h.mu.RLock()
+	var matched []historyEntry
+	for key, list := range h.entries {
+		// An addressID has no slash, though a tenant might
+		i := strings.LastIndex(key, "/")
+		if key[:i] != tenant || (id != "" && key[i+1:] != id) {
+			continue
+		}
+		for _, entry := range list {
+			if f.match(entry) {
+				matched = append(matched, entry)
+			}
+		}
+	}
+	h.mu.RUnlock()
+
+	sort.Slice(matched, func(i, j int) bool { return matched[i].cursor().less(matched[j].cursor()) })
+	for _, entry := range matched {
+		if err := fn(entry); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// match reports whether entry passes f's domain, verdict and date
+// conditions; the address is matched by key.
+func (f historyFilter) match(entry historyEntry) bool {
+	switch {
+	case f.Domain != "" && strings.ToLower(entry.Result.Domain) != f.Domain:
+		return false
+	case f.Verdict != "" && entry.Result.Verdict != f.Verdict:
+		return false
+	case !f.From.IsZero() && entry.VerifiedAt.Before(f.From):
+		return false
+	case !f.To.IsZero() && !entry.VerifiedAt.Before(f.To):
+		return false
+	}
+	return true
+}
+
+// Sweep drops results older than ttl.
+func (h *historyStore) Sweep(now time.Time, ttl time.Duration) int {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	evicted := 0
+	cutoff := now.Add(-ttl)
+	for hash, list := range h.entries {
+		n := sort.Search(len(list), func(i int) bool { return list[i].VerifiedAt.After(cutoff) })
+		if n == 0 {
+			continue
+		}
+		evicted += n
+		if n == len(list) {
+			delete(h.entries, hash)
+		} else {
+			h.entries[hash] = append([]historyEntry(nil), list[n:]...)
+		}
+	}
+	return evicted
+}
+
+// TopDomains returns up to n domains of the valid addresses verified since
+// since, across tenants, the most verified first.
+func (h *historyStore) TopDomains(since time.Time, n int) []string {
+	h.mu.RLock()
+	counts := make(map[string]int)
+	for _, list := range h.entries {
+		for _, entry := range list {
+			if entry.Result.IsValid && entry.Result.Domain != "" && !entry.VerifiedAt.Before(since) {
+				counts[strings.ToLower(entry.Result.Domain)]++
+			}
+		}
+	}
+	h.mu.RUnlock()
+
+	domains := make([]string, 0, len(counts))
+	for domain := range counts {
+		domains = append(domains, domain)
+	}
+	sort.Slice(domains, func(i, j int) bool {
+		if counts[domains[i]] != counts[domains[j]] {
+			return counts[domains[i]] > counts[domains[j]]
+		}
+		return domains[i] < domains[j]
+	})
+	if len(domains) > n {
+		domains = domains[:n]
+	}
+	return domains
+}
+
+// Len returns the number of stored results.
+func (h *historyStore) Len() int {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	n := 0
+	for _, list := range h.entries {
+		n += len(list)
+	}
+	return n
+}
+
+// historyAddress reads the address a history request is for: email, or in
+// its place hash, the address's addressID. email is "" if it was given by
+// hash.
+func historyAddress(r *http.Request) (id, email string, err error) {
+	if hash := strings.ToLower(r.URL.Query().Get("hash")); hash != "" {
+		if !digestPattern.MatchString(hash) {
+			return "", "", errors.New("hash must be 64 hex digits")
+		}
+		return hash, "", nil
+	}
+	email, _ = verify.NormalizeInput(r.URL.Query().Get("email"))
+	if email == "" {
+		return "", "", errors.New("email or hash is required")
+	}
+	return addressID(email), email, nil
+}
+
+// historyHandler serves GET /api/history, an address's past results, and
+// DELETE /api/history, which erases them.
+func historyHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodDelete {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if history == nil && historyLog == nil {
+		http.Error(w, "History is not enabled", http.StatusNotFound)
+		return
+	}
+	if r.Method == http.MethodDelete {
+		historyDeleteHandler(w, r)
+		return
+	}
+	asOfParam := r.URL.Query().Get("as_of")
+	if historyLog != nil && asOfParam == "" {
+		historyDBHandler(w, r)
+		return
+	}
+	if history == nil {
+		http.Error(w, "as_of needs -history", http.StatusNotFound)
+		return
+	}
+
+	id, email, err := historyAddress(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	tenant := service.TenantFor(requestKey(r))
+	label := email
+	if label == "" {
+		label = id
+	}
+
+	if asOfParam == "" {
+		page, err := parsePageRequest(r.URL.Query())
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		entries := history.Lookup(tenant, id)
+		start, end, next := page.window(len(entries), func(i int) pageCursor {
+			return entries[i].cursor()
+		})
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"email":       label,
+			"entries":     entries[start:end],
+			"next_cursor": next,
+		})
+		return
+	}
+
+	asOf, err := time.Parse(time.RFC3339, asOfParam)
+	if err != nil {
+		http.Error(w, "as_of must be an RFC 3339 timestamp", http.StatusBadRequest)
+		return
+	}
+	entry, found, contradicted := history.AsOf(tenant, id, asOf)
+	if !found {
+		http.Error(w, "No result at or before as_of", http.StatusNotFound)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"email":                      label,
+		"as_of":                      asOf.UTC(),
+		"entry":                      entry,
+		"newer_contradicting_result": contradicted,
+	})
+}
+
+// historyDeleteHandler erases everything the caller's tenant stored for an
+// address, for erasure requests: its history, its rows in the history db
+// and its cached results. Cached results are only found by hash in privacy
+// mode, where the cache is keyed by it.
+func historyDeleteHandler(w http.ResponseWriter, r *http.Request) {
+	id, email, err := historyAddress(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	tenant := service.TenantFor(requestKey(r))
+
+	deleted := 0
+	if history != nil {
+		deleted += history.Delete(tenant, id)
+	}
+	if historyLog != nil {
+		n, err := historyLog.Delete(tenant, id)
+		if err != nil {
+			log.Printf("Failed to erase from the history db: %v", err)
+			http.Error(w, "History could not be erased", http.StatusInternalServerError)
+			return
+		}
+		deleted += n
+	}
+	evicted := 0
+	switch {
+	case email != "":
+		evicted = verifyCache.Evict(tenant, email)
+	case privacySalt != nil:
+		evicted = verifyCache.evictKey(historyKey(tenant, id))
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"deleted": deleted,
+		"evicted": evicted,
+	})
+}
+
+// historyExportHandler serves GET /api/history/export, the caller's
+// tenant's history as CSV with the listing's filters. Rows are read from
+// the history db if there is one, and otherwise from -history, and are
+// written as they are read.
+func historyExportHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if history == nil && historyLog == nil {
+		http.Error(w, "History is not enabled", http.StatusNotFound)
+		return
+	}
+	if format := r.URL.Query().Get("format"); format != "" && format != "csv" {
+		http.Error(w, "format must be csv", http.StatusBadRequest)
+		return
+	}
+	filter, err := parseHistoryFilter(r.URL.Query())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	tenant := service.TenantFor(requestKey(r))
+	p, err := parsePseudonymizer(r.URL.Query(), tenant)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	each := history.Each
+	if historyLog != nil {
+		each = historyLog.Each
+	}
+
+	w.Header().Set("Content-Type", "text/csv; charset=utf-8")
+	w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="history-%s.csv"`, time.Now().UTC().Format(time.DateOnly)))
+	hw := newHistoryCSVWriter(w, p)
+	if err := each(tenant, filter, hw.Write); err != nil {
+		// The header is sent, so all that's left is to end the download
+		// short
+		log.Printf("Failed to export history: %v", err)
+	}
+	hw.Flush()
+}
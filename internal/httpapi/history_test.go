@@ -0,0 +1,312 @@
+package httpapi
+
+import (
+	"encoding/json"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"email-verifier/pkg/verify"
+	"email-verifier/pkg/verify/verifytest"
+)
+
+// newTestHistory returns a store holding three verifications of jane@example.com
+func newTestHistory(t *testing.T) (*historyStore, time.Time) {
+	t.Helper()
+	base := time.Date(2024, 3, 3, 0, 0, 0, 0, time.UTC)
+	h := newHistoryStore()
+	record := func(at time.Time, verdict string) {
+		h.now = func() time.Time { return at }
+		h.Record(verify.DefaultTenant, &verify.Result{Email: "jane@example.com", Verdict: verdict})
+	}
+	// Recorded out of order to exercise the sorted insert
+	record(base.Add(48*time.Hour), verify.VerdictUndeliverable)
+	record(base.Add(-24*time.Hour), verify.VerdictDeliverable)
+	record(base, verify.VerdictDeliverable)
+	return h, base
+}
+
+// TestHistoryAsOf tests point-in-time lookups around boundary timestamps
+func TestHistoryAsOf(t *testing.T) {
+	h, base := newTestHistory(t)
+
+	testCases := []struct {
+		name         string
+		at           time.Time
+		found        bool
+		verifiedAt   time.Time
+		contradicted bool
+	}{
+		{"before any result", base.Add(-25 * time.Hour), false, time.Time{}, false},
+		{"exactly at first result", base.Add(-24 * time.Hour), true, base.Add(-24 * time.Hour), true},
+		{"exactly at second result", base, true, base, true},
+		{"one nanosecond before second", base.Add(-time.Nanosecond), true, base.Add(-24 * time.Hour), true},
+		{"between second and third", base.Add(time.Hour), true, base, true},
+		{"at latest result", base.Add(48 * time.Hour), true, base.Add(48 * time.Hour), false},
+		{"after latest result", base.Add(72 * time.Hour), true, base.Add(48 * time.Hour), false},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			entry, found, contradicted := h.AsOf(verify.DefaultTenant, addressID("Jane@Example.com"), tc.at)
+			if found != tc.found {
+				t.Fatalf("Expected found=%v, got %v", tc.found, found)
+			}
+			if !found {
+				return
+			}
+			if !entry.VerifiedAt.Equal(tc.verifiedAt) {
+				t.Errorf("Expected result from %v, got %v", tc.verifiedAt, entry.VerifiedAt)
+			}
+			if contradicted != tc.contradicted {
+				t.Errorf("Expected contradicted=%v, got %v", tc.contradicted, contradicted)
+			}
+		})
+	}
+}
+
+// TestHistorySweep tests that results older than the TTL are evicted
+func TestHistorySweep(t *testing.T) {
+	h, base := newTestHistory(t)
+
+	if evicted := h.Sweep(base.Add(12*time.Hour), 24*time.Hour); evicted != 1 {
+		t.Errorf("Expected 1 eviction, got %d", evicted)
+	}
+	if n := h.Len(); n != 2 {
+		t.Errorf("Expected 2 entries left, got %d", n)
+	}
+	if evicted := h.Sweep(base.Add(100*time.Hour), time.Hour); evicted != 2 {
+		t.Errorf("Expected 2 evictions, got %d", evicted)
+	}
+	if entries := h.Lookup(verify.DefaultTenant, addressID("jane@example.com")); len(entries) != 0 {
+		t.Errorf("Expected empty history, got %d entries", len(entries))
+	}
+}
+
+// TestHistoryHandler tests the /api/history endpoint and its as_of parameter
+func TestHistoryHandler(t *testing.T) {
+	saved := history
+	t.Cleanup(func() { history = saved })
+
+	history = nil
+	rec := httptest.NewRecorder()
+	historyHandler(rec, httptest.NewRequest(http.MethodGet, "/api/history?email=jane@example.com", nil))
+	if rec.Code != http.StatusNotFound {
+		t.Errorf("Expected 404 when history is disabled, got %d", rec.Code)
+	}
+
+	history, _ = newTestHistory(t)
+	testCases := []struct {
+		name   string
+		query  string
+		status int
+	}{
+		{"missing email", "", http.StatusBadRequest},
+		{"all entries", "email=jane@example.com", http.StatusOK},
+		{"bad as_of", "email=jane@example.com&as_of=March+3rd", http.StatusBadRequest},
+		{"as_of before history", "email=jane@example.com&as_of=2024-01-01T00:00:00Z", http.StatusNotFound},
+		{"as_of", "email=jane@example.com&as_of=" + url.QueryEscape("2024-03-03T00:00:00Z"), http.StatusOK},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			historyHandler(rec, httptest.NewRequest(http.MethodGet, "/api/history?"+tc.query, nil))
+			if rec.Code != tc.status {
+				t.Fatalf("Expected status %d, got %d", tc.status, rec.Code)
+			}
+		})
+	}
+
+	rec = httptest.NewRecorder()
+	historyHandler(rec, httptest.NewRequest(http.MethodGet, "/api/history?email=jane@example.com&as_of=2024-03-03T00:00:00Z", nil))
+	var body struct {
+		Entry        historyEntry `json:"entry"`
+		Contradicted bool         `json:"newer_contradicting_result"`
+	}
+	if err := json.NewDecoder(rec.Body).Decode(&body); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	if body.Entry.Result.Verdict != verify.VerdictDeliverable || !body.Contradicted {
+		t.Errorf("Expected deliverable result with a newer contradiction, got %q contradicted=%v", body.Entry.Result.Verdict, body.Contradicted)
+	}
+}
+
+// TestHistorySpellings tests that every spelling of an address is recorded and looked up under one key
+func TestHistorySpellings(t *testing.T) {
+	fake := verifytest.NewResolver()
+	fake.MX["partner.mock"] = []*net.MX{{Host: "mx.partner.mock.", Pref: 10}}
+	useService(t, verify.Config{Resolver: fake})
+	saved := history
+	history = newHistoryStore()
+	t.Cleanup(func() { history = saved })
+
+	for _, email := range []string{"Jane.Doe@PARTNER.MOCK", "jane.doe@partner.mock"} {
+		req := httptest.NewRequest(http.MethodPost, "/api/verify", strings.NewReader(`{"email": "`+email+`"}`))
+		apiVerifyHandler(httptest.NewRecorder(), req)
+	}
+	rec := httptest.NewRecorder()
+	historyHandler(rec, httptest.NewRequest(http.MethodGet, "/api/history?email=JANE.DOE@Partner.Mock", nil))
+	var body struct{ Entries []historyEntry }
+	json.Unmarshal(rec.Body.Bytes(), &body)
+	if len(body.Entries) != 2 {
+		t.Fatalf("Expected both spellings in one history, got %s", rec.Body.String())
+	}
+	if body.Entries[0].Result.Email != "Jane.Doe@PARTNER.MOCK" || body.Entries[0].Result.Domain != "partner.mock" {
+		t.Errorf("Expected the submitted spelling kept with the domain lowercased, got %+v", body.Entries[0].Result)
+	}
+}
+
+// TestHistoryInbox tests that addresses a provider rule folds into one inbox share its history
+func TestHistoryInbox(t *testing.T) {
+	fake := verifytest.NewResolver()
+	fake.MX["partner.mock"] = []*net.MX{{Host: "mx.partner.mock.", Pref: 10}}
+	useService(t, verify.Config{Resolver: fake, ProviderRules: map[string]verify.ProviderRule{"partner.mock": {IgnoreDots: true, Separator: "+"}}})
+	saved := history
+	history = newHistoryStore()
+	t.Cleanup(func() { history = saved })
+
+	for _, email := range []string{"J.ane+promo@partner.mock", "jane@partner.mock"} {
+		req := httptest.NewRequest(http.MethodPost, "/api/verify", strings.NewReader(`{"email": "`+email+`"}`))
+		apiVerifyHandler(httptest.NewRecorder(), req)
+	}
+	rec := httptest.NewRecorder()
+	historyHandler(rec, httptest.NewRequest(http.MethodGet, "/api/history?email=ja.ne@partner.mock", nil))
+	var body struct{ Entries []historyEntry }
+	json.Unmarshal(rec.Body.Bytes(), &body)
+	if len(body.Entries) != 2 {
+		t.Fatalf("Expected both addresses in the inbox's history, got %s", rec.Body.String())
+	}
+	if first := body.Entries[0].Result; first.NormalizedEmail != "jane@partner.mock" || !first.IsSubaddressed {
+		t.Errorf("Expected the subaddressed address normalized, got %+v", first)
+	}
+}
+
+// TestHistoryTenantIsolation tests that a result recorded for one tenant is never served to another
+func TestHistoryTenantIsolation(t *testing.T) {
+	fake := verifytest.NewResolver()
+	fake.MX["partner.mock"] = []*net.MX{{Host: "mx.partner.mock.", Pref: 10}}
+	useService(t, verify.Config{Resolver: fake, Tenants: map[string]verify.Tenant{
+		"a": {Keys: []string{"ka"}, Suppressed: []string{"@partner.mock"}},
+		"b": {Keys: []string{"kb"}},
+	}})
+	saved := history
+	history = newHistoryStore()
+	t.Cleanup(func() { history = saved })
+
+	verifyAs := func(key string) *verify.Result {
+		req := httptest.NewRequest(http.MethodPost, "/api/verify", strings.NewReader(`{"email":"jane@partner.mock"}`))
+		req.Header.Set("X-API-Key", key)
+		rec := httptest.NewRecorder()
+		apiVerifyHandler(rec, req)
+		var result verify.Result
+		json.Unmarshal(rec.Body.Bytes(), &result)
+		return &result
+	}
+	if result := verifyAs("ka"); !result.Suppressed || result.Verdict != verify.VerdictUndeliverable {
+		t.Fatalf("Expected the address suppressed for tenant a, got %+v", result)
+	}
+
+	testCases := []struct {
+		key     string
+		entries int
+		allow   bool
+	}{
+		{"ka", 1, false},
+		{"kb", 0, true},
+		{"", 0, true},
+	}
+	for _, tc := range testCases {
+		t.Run("key "+tc.key, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/api/history?email=jane@partner.mock", nil)
+			req.Header.Set("X-API-Key", tc.key)
+			rec := httptest.NewRecorder()
+			historyHandler(rec, req)
+			var body struct {
+				Entries []historyEntry `json:"entries"`
+			}
+			json.Unmarshal(rec.Body.Bytes(), &body)
+			if len(body.Entries) != tc.entries {
+				t.Errorf("Expected %d history entries, got %d", tc.entries, len(body.Entries))
+			}
+
+			req = httptest.NewRequest(http.MethodGet, "/api/send-check?email=jane@partner.mock", nil)
+			req.Header.Set("X-API-Key", tc.key)
+			rec = httptest.NewRecorder()
+			sendCheckHandler(rec, req)
+			var decision sendDecision
+			json.Unmarshal(rec.Body.Bytes(), &decision)
+			if decision.Allow != tc.allow || (!tc.allow && decision.Reason != sendReasonSuppressed) {
+				t.Errorf("Expected allow=%v, got %+v", tc.allow, decision)
+			}
+		})
+	}
+
+	if result := verifyAs("kb"); result.Suppressed || result.Verdict == verify.VerdictUndeliverable {
+		t.Errorf("Expected tenant b to verify normally, got %+v", result)
+	}
+}
+
+// TestHistoryExport tests that the CSV export applies the listing's filters and is a header-only CSV when nothing matches
+func TestHistoryExport(t *testing.T) {
+	saved := history
+	t.Cleanup(func() { history = saved })
+	var base time.Time
+	history, base = newTestHistory(t)
+	history.now = func() time.Time { return base.Add(72 * time.Hour) }
+	history.Record(verify.DefaultTenant, &verify.Result{Email: "bob@acme.io", Domain: "acme.io", Verdict: verify.VerdictDeliverable, Free: true})
+
+	export := func(query string) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		Handler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/history/export?"+query, nil))
+		return rec
+	}
+
+	rec := export("format=csv&outcome=deliverable&to=2024-03-03")
+	if rec.Code != http.StatusOK || rec.Header().Get("Content-Type") != "text/csv; charset=utf-8" {
+		t.Fatalf("Expected a CSV, got %d %s", rec.Code, rec.Header().Get("Content-Type"))
+	}
+	if disposition := rec.Header().Get("Content-Disposition"); !strings.HasPrefix(disposition, `attachment; filename="history-`) || !strings.HasSuffix(disposition, `.csv"`) {
+		t.Errorf("Expected a dated attachment, got %q", disposition)
+	}
+	lines := strings.Split(strings.TrimSpace(rec.Body.String()), "\n")
+	expected := []string{
+		"email,domain,reachable,disposable,free,role_account,has_mx_records,suggestion,verified_at",
+		"jane@example.com,,,false,false,false,false,," + base.Add(-24*time.Hour).Format(time.RFC3339),
+		"jane@example.com,,,false,false,false,false,," + base.Format(time.RFC3339),
+	}
+	if strings.Join(lines, "\n") != strings.Join(expected, "\n") {
+		t.Errorf("Expected rows\n%s\ngot\n%s", strings.Join(expected, "\n"), rec.Body)
+	}
+
+	if rec := export("domain=ACME.io"); !strings.Contains(rec.Body.String(), "bob@acme.io,acme.io,,false,true,") || strings.Contains(rec.Body.String(), "jane@") {
+		t.Errorf("Expected only the acme.io row, got %s", rec.Body)
+	}
+	if rec := export("domain=nowhere.example"); rec.Code != http.StatusOK || strings.Count(rec.Body.String(), "\n") != 1 {
+		t.Errorf("Expected a header-only CSV, got %d %q", rec.Code, rec.Body)
+	}
+	usePseudonymKeys(t)
+	p := mustPseudonymizer(t, "pseudonymize=true&domains=hidden", verify.DefaultTenant)
+	rec = export("pseudonymize=true&domains=hidden&domain=acme.io")
+	if lines := strings.Split(strings.TrimSpace(rec.Body.String()), "\n"); len(lines) != 2 || !strings.HasPrefix(lines[0], "email_token,domain,") || !strings.HasPrefix(lines[1], p.Token("bob@acme.io")+",,") || strings.Contains(rec.Body.String(), "bob@") {
+		t.Errorf("Expected bob's row with a token and no domain, got %s", rec.Body)
+	}
+	if rec := export("pseudonymize=true&pseudonym_key=old"); rec.Code != http.StatusBadRequest {
+		t.Errorf("Expected status 400 for an unknown pseudonym key, got %d", rec.Code)
+	}
+	if rec := export("format=xlsx"); rec.Code != http.StatusBadRequest {
+		t.Errorf("Expected status 400 for another format, got %d", rec.Code)
+	}
+	if rec := export("outcome=great"); rec.Code != http.StatusBadRequest {
+		t.Errorf("Expected status 400 for an unknown outcome, got %d", rec.Code)
+	}
+
+	history = nil
+	if rec := export(""); rec.Code != http.StatusNotFound {
+		t.Errorf("Expected status 404 without history, got %d", rec.Code)
+	}
+}
@@ -0,0 +1,341 @@
+package httpapi
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"email-verifier/pkg/verify"
+)
+
+// historyDBDriver is the database/sql driver -history-db opens. The server
+// is built with it by the sqlite build tag; see cmd/email-verifier.
+const historyDBDriver = "sqlite"
+
+// historyDBSchema creates the verifications table. verified_at is in Unix
+// nanoseconds, address is the addressID history is keyed by, and
+// duration_ms is NULL for results verified as part of a batch. In privacy
+// mode email and result hold the address's digest in its place.
+const historyDBSchema = `
+CREATE TABLE IF NOT EXISTS verifications (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	tenant TEXT NOT NULL,
+	email TEXT NOT NULL,
+	address TEXT NOT NULL,
+	domain TEXT NOT NULL,
+	verdict TEXT NOT NULL,
+	reachable TEXT NOT NULL,
+	error_code TEXT NOT NULL,
+	verified_at INTEGER NOT NULL,
+	duration_ms REAL,
+	result TEXT NOT NULL
+);
+CREATE INDEX IF NOT EXISTS verifications_tenant_time ON verifications (tenant, verified_at, id);
+CREATE INDEX IF NOT EXISTS verifications_time ON verifications (verified_at);
+`
+
+// historyDB keeps every recorded verification in SQLite, so history
+// survives restarts and can be browsed by domain, verdict and date.
+type historyDB struct {
+	db  *sql.DB
+	now func() time.Time
+}
+
+// historyLog is nil unless -history-db is set; without it nothing is
+// written to disk.
+var historyLog *historyDB
+
+// openHistoryDB opens or creates the database at path.
+func openHistoryDB(path string) (*historyDB, error) {
+	if !slices.Contains(sql.Drivers(), historyDBDriver) {
+		return nil, fmt.Errorf("-history-db needs a server built with the SQLite driver (go build -tags sqlite)")
+	}
+	db, err := sql.Open(historyDBDriver, path)
+	if err != nil {
+		return nil, fmt.Errorf("history db: %w", err)
+	}
+	// SQLite takes one writer at a time
+	db.SetMaxOpenConns(1)
+	if _, err := db.Exec(historyDBSchema); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("history db %s: %w", path, err)
+	}
+	return &historyDB{db: db, now: time.Now}, nil
+}
+
+// Record stores result as verified now for tenant. took is how long the
+// verification ran, or 0 if it isn't known. A failed write is logged; the
+// verification itself has already been answered.
+func (h *historyDB) Record(tenant string, result *verify.Result, took time.Duration) {
+	if result.Email == "" {
+		return
+	}
+	stored := storedResult(result)
+	data, err := json.Marshal(stored)
+	if err != nil {
+		return
+	}
+	var duration interface{}
+	if took > 0 {
+		duration = float64(took.Microseconds()) / 1000
+	}
+	_, err = h.db.Exec(`INSERT INTO verifications
+		(tenant, email, address, domain, verdict, reachable, error_code, verified_at, duration_ms, result)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		tenant, stored.Email, addressID(result.Email), strings.ToLower(result.Domain),
+		result.Verdict, result.Reachable, result.ErrorCode, h.now().UnixNano(), duration, string(data))
+	if err != nil {
+		log.Printf("Failed to record a verification in the history db: %v", err)
+	}
+}
+
+// historyFilter narrows a history listing. Zero fields match everything;
+// From is inclusive and To exclusive. Hash is an address's addressID, as
+// privacy mode lists it in place of the address.
+type historyFilter struct {
+	Email   string
+	Hash    string
+	Domain  string
+	Verdict string
+	From    time.Time
+	To      time.Time
+}
+
+// parseHistoryFilter reads email or hash, domain, verdict (or outcome),
+// from and to.
+// from and to are RFC 3339 timestamps or dates; a date in to includes that
+// day.
+func parseHistoryFilter(query url.Values) (historyFilter, error) {
+	f := historyFilter{Domain: strings.ToLower(strings.TrimSpace(query.Get("domain"))), Verdict: query.Get("verdict")}
+	if f.Verdict == "" {
+		f.Verdict = query.Get("outcome")
+	}
+	if email := query.Get("email"); email != "" {
+		f.Email, _ = verify.NormalizeInput(email)
+	}
+	if f.Hash = strings.ToLower(query.Get("hash")); f.Hash != "" && !digestPattern.MatchString(f.Hash) {
+		return f, errors.New("hash must be 64 hex digits")
+	}
+	if f.Verdict != "" && !slices.Contains(verify.Verdicts, f.Verdict) {
+		return f, fmt.Errorf("verdict must be one of %s", strings.Join(verify.Verdicts, ", "))
+	}
+	for _, bound := range []struct {
+		name string
+		into *time.Time
+	}{{"from", &f.From}, {"to", &f.To}} {
+		v := query.Get(bound.name)
+		if v == "" {
+			continue
+		}
+		if t, err := time.Parse(time.RFC3339, v); err == nil {
+			*bound.into = t
+		} else if t, err := time.Parse(time.DateOnly, v); err == nil {
+			if bound.name == "to" {
+				t = t.AddDate(0, 0, 1)
+			}
+			*bound.into = t
+		} else {
+			return f, fmt.Errorf("%s must be an RFC 3339 timestamp or a date like 2024-03-01", bound.name)
+		}
+	}
+	return f, nil
+}
+
+// historyQuery builds the SELECT for a page of tenant's verifications that
+// match f, oldest first. It asks for one row past the page to tell whether
+// another page follows; a page without a limit selects every match.
+func historyQuery(tenant string, f historyFilter, page pageRequest) (string, []interface{}) {
+	where := []string{"tenant = ?"}
+	args := []interface{}{tenant}
+	if f.Email != "" {
+		where, args = append(where, "address = ?"), append(args, addressID(f.Email))
+	}
+	if f.Hash != "" {
+		where, args = append(where, "address = ?"), append(args, f.Hash)
+	}
+	if f.Domain != "" {
+		where, args = append(where, "domain = ?"), append(args, f.Domain)
+	}
+	if f.Verdict != "" {
+		where, args = append(where, "verdict = ?"), append(args, f.Verdict)
+	}
+	if !f.From.IsZero() {
+		where, args = append(where, "verified_at >= ?"), append(args, f.From.UnixNano())
+	}
+	if !f.To.IsZero() {
+		where, args = append(where, "verified_at < ?"), append(args, f.To.UnixNano())
+	}
+	if page.after != nil {
+		id, _ := strconv.ParseInt(page.after.ID, 16, 64)
+		where = append(where, "(verified_at > ? OR (verified_at = ? AND id > ?))")
+		args = append(args, page.after.Key, page.after.Key, id)
+	}
+	query := "SELECT id, verified_at, duration_ms, result FROM verifications WHERE " +
+		strings.Join(where, " AND ") + " ORDER BY verified_at, id"
+	if page.limit <= 0 {
+		return query, args
+	}
+	return query + " LIMIT ?", append(args, page.limit+1)
+}
+
+// Query returns a page of tenant's verifications matching f and the cursor
+// of the page after it.
+func (h *historyDB) Query(tenant string, f historyFilter, page pageRequest) ([]historyEntry, string, error) {
+	entries := []historyEntry{}
+	err := h.each(tenant, f, page, func(entry historyEntry) error {
+		entries = append(entries, entry)
+		return nil
+	})
+	if err != nil {
+		return nil, "", err
+	}
+	next := ""
+	if len(entries) > page.limit {
+		entries = entries[:page.limit]
+		next = entries[len(entries)-1].cursor().String()
+	}
+	return entries, next, nil
+}
+
+// Each calls fn with each of tenant's verifications matching f, oldest
+// first, as they are read, and stops at the first error fn returns.
+func (h *historyDB) Each(tenant string, f historyFilter, fn func(historyEntry) error) error {
+	return h.each(tenant, f, pageRequest{}, fn)
+}
+
+func (h *historyDB) each(tenant string, f historyFilter, page pageRequest, fn func(historyEntry) error) error {
+	query, args := historyQuery(tenant, f, page)
+	rows, err := h.db.Query(query, args...)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var id, verifiedAt int64
+		var duration sql.NullFloat64
+		var data string
+		if err := rows.Scan(&id, &verifiedAt, &duration, &data); err != nil {
+			return err
+		}
+		entry := historyEntry{VerifiedAt: time.Unix(0, verifiedAt).UTC(), DurationMS: duration.Float64, seq: uint64(id)}
+		if err := json.Unmarshal([]byte(data), &entry.Result); err != nil {
+			return err
+		}
+		if err := fn(entry); err != nil {
+			return err
+		}
+	}
+	return rows.Err()
+}
+
+// Prune deletes verifications recorded more than ttl before now.
+func (h *historyDB) Prune(now time.Time, ttl time.Duration) int {
+	res, err := h.db.Exec("DELETE FROM verifications WHERE verified_at < ?", now.Add(-ttl).UnixNano())
+	if err != nil {
+		log.Printf("Failed to prune the history db: %v", err)
+		return 0
+	}
+	n, _ := res.RowsAffected()
+	return int(n)
+}
+
+// Delete deletes tenant's verifications of the address with addressID id.
+func (h *historyDB) Delete(tenant, id string) (int, error) {
+	res, err := h.db.Exec("DELETE FROM verifications WHERE tenant = ? AND address = ?", tenant, id)
+	if err != nil {
+		return 0, err
+	}
+	n, _ := res.RowsAffected()
+	return int(n), nil
+}
+
+// Close closes the database.
+func (h *historyDB) Close() error { return h.db.Close() }
+
+// historyDBHandler lists the caller's tenant's verifications from the
+// history db for GET /api/history, filtered by email or hash, domain,
+// verdict, from and to.
+func historyDBHandler(w http.ResponseWriter, r *http.Request) {
+	filter, err := parseHistoryFilter(r.URL.Query())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	page, err := parsePageRequest(r.URL.Query())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	entries, next, err := historyLog.Query(service.TenantFor(requestKey(r)), filter, page)
+	if err != nil {
+		log.Printf("Failed to read the history db: %v", err)
+		http.Error(w, "History could not be read", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"email":       filter.Email,
+		"entries":     entries,
+		"next_cursor": next,
+	})
+}
+
+// historyPage is what history.html renders. Query holds the filters as
+// they were submitted, to fill the form and the next page's link.
+type historyPage struct {
+	Query      url.Values
+	Verdicts   []string
+	Entries    []historyEntry
+	NextCursor string
+	Error      string
+}
+
+// NextURL links the page after this one with the same filters.
+func (p historyPage) NextURL() string {
+	query := url.Values{}
+	for k, v := range p.Query {
+		query[k] = v
+	}
+	query.Set("cursor", p.NextCursor)
+	return "/history?" + query.Encode()
+}
+
+// historyPageHandler renders /history, the caller's tenant's verifications
+// from the history db with filters for domain, verdict and dates.
+func historyPageHandler(w http.ResponseWriter, r *http.Request) {
+	if historyLog == nil {
+		http.Error(w, "History is not enabled", http.StatusNotFound)
+		return
+	}
+	query := r.URL.Query()
+	query.Del("cursor")
+	data := historyPage{Query: query, Verdicts: verify.Verdicts}
+	filter, err := parseHistoryFilter(r.URL.Query())
+	if err != nil {
+		data.Error = err.Error()
+		renderPage(w, r, "history.html", data)
+		return
+	}
+	page, err := parsePageRequest(r.URL.Query())
+	if err != nil {
+		data.Error = err.Error()
+		renderPage(w, r, "history.html", data)
+		return
+	}
+	data.Entries, data.NextCursor, err = historyLog.Query(service.TenantFor(requestKey(r)), filter, page)
+	if err != nil {
+		log.Printf("Failed to read the history db: %v", err)
+		data.Error = "History could not be read"
+	}
+	renderPage(w, r, "history.html", data)
+}
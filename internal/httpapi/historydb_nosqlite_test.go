@@ -0,0 +1,15 @@
+//go:build !sqlite
+
+package httpapi
+
+import (
+	"strings"
+	"testing"
+)
+
+// TestOpenHistoryDBWithoutDriver tests that a build without the SQLite driver refuses -history-db
+func TestOpenHistoryDBWithoutDriver(t *testing.T) {
+	if _, err := openHistoryDB(t.TempDir() + "/history.db"); err == nil || !strings.Contains(err.Error(), "-tags sqlite") {
+		t.Errorf("Expected an error naming the sqlite build tag, got %v", err)
+	}
+}
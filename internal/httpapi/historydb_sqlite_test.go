@@ -0,0 +1,111 @@
+//go:build sqlite
+
+package httpapi
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"email-verifier/pkg/verify"
+
+	_ "modernc.org/sqlite"
+)
+
+// openTestHistoryDB opens a history db in a temp file, with a clock the test can move
+func openTestHistoryDB(t *testing.T, path string, at *time.Time) *historyDB {
+	t.Helper()
+	db, err := openHistoryDB(path)
+	if err != nil {
+		t.Fatalf("Failed to open the history db: %v", err)
+	}
+	db.now = func() time.Time { return *at }
+	t.Cleanup(func() { db.Close() })
+	return db
+}
+
+// TestHistoryDBStore tests recording, querying, paging, pruning and deleting against a database file, and that rows survive reopening it
+func TestHistoryDBStore(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "history.db")
+	start := time.Date(2024, 3, 1, 9, 0, 0, 0, time.UTC)
+	now := start
+	db := openTestHistoryDB(t, path, &now)
+
+	record := func(tenant, email, verdict string, took time.Duration) {
+		result := &verify.Result{Email: email, Domain: email[len("jane@"):], Verdict: verdict, Reachable: verify.ReachableYes}
+		db.Record(tenant, result, took)
+		now = now.Add(time.Hour)
+	}
+	record("acme", "jane@a.mock", verify.VerdictDeliverable, 250*time.Millisecond)
+	record("acme", "john@b.mock", verify.VerdictUndeliverable, 0)
+	record("acme", "jane@a.mock", verify.VerdictRisky, time.Second)
+	record(verify.DefaultTenant, "jane@a.mock", verify.VerdictDeliverable, 0)
+
+	entries, next, err := db.Query("acme", historyFilter{}, pageRequest{limit: 2})
+	if err != nil || len(entries) != 2 || next == "" {
+		t.Fatalf("Expected a first page of two with a cursor, got %d entries, %q, %v", len(entries), next, err)
+	}
+	if entries[0].Result.Email != "jane@a.mock" || entries[0].DurationMS != 250 || entries[1].DurationMS != 0 || !entries[0].VerifiedAt.Equal(start) {
+		t.Errorf("Expected the oldest entries with their durations, got %+v and %+v", entries[0], entries[1])
+	}
+	after, _ := decodeCursor(next)
+	rest, next, err := db.Query("acme", historyFilter{}, pageRequest{after: &after, limit: 2})
+	if err != nil || len(rest) != 1 || next != "" || rest[0].Result.Verdict != verify.VerdictRisky {
+		t.Errorf("Expected the last entry on the second page, got %+v, %q, %v", rest, next, err)
+	}
+
+	filters := map[string]struct {
+		filter historyFilter
+		count  int
+	}{
+		"email":   {historyFilter{Email: "JANE@a.mock"}, 2},
+		"domain":  {historyFilter{Domain: "b.mock"}, 1},
+		"verdict": {historyFilter{Verdict: verify.VerdictRisky}, 1},
+		"dates":   {historyFilter{From: start.Add(time.Hour), To: start.Add(2 * time.Hour)}, 1},
+	}
+	for name, tc := range filters {
+		count := 0
+		if err := db.Each("acme", tc.filter, func(historyEntry) error { count++; return nil }); err != nil || count != tc.count {
+			t.Errorf("Expected %d entries for the %s filter, got %d (%v)", tc.count, name, count, err)
+		}
+	}
+
+	if n, err := db.Delete("acme", addressID("jane@a.mock")); err != nil || n != 2 {
+		t.Errorf("Expected two of acme's rows deleted, got %d (%v)", n, err)
+	}
+	if entries, _, _ := db.Query(verify.DefaultTenant, historyFilter{}, pageRequest{limit: 10}); len(entries) != 1 {
+		t.Errorf("Expected the default tenant's row kept, got %d", len(entries))
+	}
+
+	db.Close()
+	db = openTestHistoryDB(t, path, &now)
+	if n := db.Prune(start.Add(3*time.Hour), 90*time.Minute); n != 1 {
+		t.Errorf("Expected the row older than the retention pruned after reopening, got %d", n)
+	}
+	if entries, _, _ := db.Query(verify.DefaultTenant, historyFilter{}, pageRequest{limit: 10}); len(entries) != 1 {
+		t.Errorf("Expected the recent row to survive, got %d", len(entries))
+	}
+}
+
+// TestHistoryDBHandler tests /api/history reading from the history db
+func TestHistoryDBHandler(t *testing.T) {
+	now := time.Now()
+	db := openTestHistoryDB(t, filepath.Join(t.TempDir(), "history.db"), &now)
+	saved := historyLog
+	historyLog = db
+	t.Cleanup(func() { historyLog = saved })
+	db.Record(verify.DefaultTenant, &verify.Result{Email: "jane@a.mock", Domain: "a.mock", Verdict: verify.VerdictDeliverable}, time.Second)
+
+	rec := httptest.NewRecorder()
+	Handler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/history?domain=a.mock", nil))
+	var body struct {
+		Entries []historyEntry `json:"entries"`
+	}
+	json.Unmarshal(rec.Body.Bytes(), &body)
+	if rec.Code != http.StatusOK || len(body.Entries) != 1 || body.Entries[0].Result.Email != "jane@a.mock" {
+		t.Errorf("Expected the recorded verification, got %d %s", rec.Code, rec.Body)
+	}
+}
@@ -0,0 +1,88 @@
+package httpapi
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"email-verifier/pkg/verify"
+)
+
+// TestHistoryDBOff tests that without -history-db the history page is off and /api/history works as before
+func TestHistoryDBOff(t *testing.T) {
+	if historyLog != nil {
+		t.Fatal("Expected no history db by default")
+	}
+	saved := history
+	t.Cleanup(func() { history = saved })
+
+	history = nil
+	for _, target := range []string{"/history", "/api/history?domain=example.com"} {
+		rec := httptest.NewRecorder()
+		Handler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, target, nil))
+		if rec.Code != http.StatusNotFound {
+			t.Errorf("Expected status 404 for %s, got %d", target, rec.Code)
+		}
+	}
+
+	history = newHistoryStore()
+	rec := httptest.NewRecorder()
+	historyHandler(rec, httptest.NewRequest(http.MethodGet, "/api/history?domain=example.com", nil))
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("Expected status 400 without email, got %d", rec.Code)
+	}
+}
+
+// TestParseHistoryFilter tests the filter parameters
+func TestParseHistoryFilter(t *testing.T) {
+	day := time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC)
+	testCases := []struct {
+		query    string
+		expected historyFilter
+		ok       bool
+	}{
+		{"", historyFilter{}, true},
+		{"domain=ACME.io&verdict=risky", historyFilter{Domain: "acme.io", Verdict: verify.VerdictRisky}, true},
+		{"email=Jane@ACME.io", historyFilter{Email: "Jane@ACME.io"}, true},
+		{"from=2024-03-01&to=2024-03-01", historyFilter{From: day, To: day.AddDate(0, 0, 1)}, true},
+		{"from=2024-03-01T12:00:00Z", historyFilter{From: day.Add(12 * time.Hour)}, true},
+		{"verdict=great", historyFilter{}, false},
+		{"to=last+week", historyFilter{}, false},
+	}
+	for _, tc := range testCases {
+		query, _ := url.ParseQuery(tc.query)
+		f, err := parseHistoryFilter(query)
+		if (err == nil) != tc.ok {
+			t.Errorf("Expected ok %v for %q, got %v", tc.ok, tc.query, err)
+			continue
+		}
+		if tc.ok && !reflect.DeepEqual(f, tc.expected) {
+			t.Errorf("Expected %+v for %q, got %+v", tc.expected, tc.query, f)
+		}
+	}
+}
+
+// TestHistoryQuery tests that filters and the cursor become conditions on the tenant's rows
+func TestHistoryQuery(t *testing.T) {
+	from := time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC)
+	after := historyEntry{VerifiedAt: from.Add(time.Hour), seq: 42}.cursor()
+	query, args := historyQuery("acme", historyFilter{Email: "Jane@acme.io", Domain: "acme.io", Verdict: verify.VerdictRisky, From: from},
+		pageRequest{after: &after, limit: 10})
+
+	for _, condition := range []string{"tenant = ?", "address = ?", "domain = ?", "verdict = ?", "verified_at >= ?", "(verified_at > ? OR (verified_at = ? AND id > ?))"} {
+		if !strings.Contains(query, condition) {
+			t.Errorf("Expected %q in %s", condition, query)
+		}
+	}
+	if strings.Contains(query, "verified_at < ?") {
+		t.Errorf("Expected no upper bound without to, got %s", query)
+	}
+	expected := []interface{}{"acme", addressID("jane@acme.io"), "acme.io", verify.VerdictRisky, from.UnixNano(), after.Key, after.Key, int64(42), 11}
+	if !reflect.DeepEqual(args, expected) {
+		t.Errorf("Expected args %v, got %v", expected, args)
+	}
+}
@@ -0,0 +1,104 @@
+package httpapi
+
+import (
+	"sort"
+	"sync"
+	"time"
+)
+
+var janitorEvictions = metrics.CounterVec("janitor_evictions_total", "Entries evicted from in-memory state by the janitor.", "structure")
+
+// sweepFunc removes expired entries and returns how many it evicted.
+type sweepFunc func(now time.Time) int
+
+type janitorTask struct {
+	name     string
+	sweep    sweepFunc
+	interval time.Duration
+	next     time.Time
+	lastRun  time.Time
+	lastEvic int
+}
+
+// janitor sweeps every registered in-memory structure when the scheduler's
+// housekeeping task calls RunDue. Each structure has its own interval,
+// jittered so sweeps don't line up.
+type janitor struct {
+	mu    sync.Mutex
+	tasks []*janitorTask
+	now   func() time.Time
+}
+
+var housekeeping = newJanitor()
+
+func newJanitor() *janitor {
+	return &janitor{now: time.Now}
+}
+
+// Register adds a structure to be swept every interval.
+func (j *janitor) Register(name string, interval time.Duration, sweep sweepFunc) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	j.tasks = append(j.tasks, &janitorTask{
+		name:     name,
+		sweep:    sweep,
+		interval: interval,
+		next:     j.now().Add(jitter(interval)),
+	})
+}
+
+// RunDue sweeps every structure whose next sweep time has passed.
+func (j *janitor) RunDue() {
+	now := j.now()
+
+	j.mu.Lock()
+	var due []*janitorTask
+	for _, task := range j.tasks {
+		if !now.Before(task.next) {
+			due = append(due, task)
+			task.next = now.Add(task.interval - task.interval/10 + jitter(task.interval/5))
+		}
+	}
+	j.mu.Unlock()
+
+	for _, task := range due {
+		evicted := task.sweep(now)
+		janitorEvictions.Add(task.name, int64(evicted))
+
+		j.mu.Lock()
+		task.lastRun = now
+		task.lastEvic = evicted
+		j.mu.Unlock()
+	}
+}
+
+// janitorStatus is the last sweep of one structure, for /admin/state.
+type janitorStatus struct {
+	Name        string     `json:"name"`
+	Interval    string     `json:"interval"`
+	LastRun     *time.Time `json:"last_run,omitempty"`
+	LastEvicted int        `json:"last_evicted"`
+	NextRun     time.Time  `json:"next_run"`
+}
+
+// Status reports every registered structure ordered by name.
+func (j *janitor) Status() []janitorStatus {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	statuses := make([]janitorStatus, 0, len(j.tasks))
+	for _, task := range j.tasks {
+		status := janitorStatus{
+			Name:        task.name,
+			Interval:    task.interval.String(),
+			LastEvicted: task.lastEvic,
+			NextRun:     task.next,
+		}
+		if !task.lastRun.IsZero() {
+			lastRun := task.lastRun
+			status.LastRun = &lastRun
+		}
+		statuses = append(statuses, status)
+	}
+	sort.Slice(statuses, func(i, k int) bool { return statuses[i].Name < statuses[k].Name })
+	return statuses
+}
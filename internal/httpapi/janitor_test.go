@@ -0,0 +1,117 @@
+package httpapi
+
+import (
+	"fmt"
+	"runtime"
+	"testing"
+	"time"
+
+	"email-verifier/pkg/verify"
+)
+
+// TestJanitorSweepsWithJitter tests that sweeps run per interval and record evictions
+func TestJanitorSweepsWithJitter(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+	j := newJanitor()
+	j.now = func() time.Time { return now }
+
+	runs := 0
+	j.Register("test_structure", time.Minute, func(time.Time) int {
+		runs++
+		return 3
+	})
+
+	before := janitorEvictions.Value("test_structure")
+	for i := 0; i < 60; i++ {
+		now = now.Add(10 * time.Second)
+		j.RunDue()
+	}
+
+	// Ten simulated minutes with a jittered one-minute interval (0.9m-1.1m).
+	if runs < 8 || runs > 11 {
+		t.Errorf("Expected about 10 sweeps, got %d", runs)
+	}
+	if got := janitorEvictions.Value("test_structure") - before; got != int64(3*runs) {
+		t.Errorf("Expected %d evictions counted, got %d", 3*runs, got)
+	}
+	if status := j.Status(); len(status) != 1 || status[0].LastRun == nil || status[0].LastEvicted != 3 {
+		t.Errorf("Expected status with last run, got %+v", status)
+	}
+}
+
+// TestJanitorSoak simulates a day of traffic at compressed time and checks that tracked state stabilizes
+func TestJanitorSoak(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+	clock := func() time.Time { return now }
+
+	f := newResultForwarder(map[string]forwardTarget{"team": {URL: "http://127.0.0.1:1"}})
+	f.now = clock
+	f.SetPaused("team", true)
+
+	wr := newWatchRegistry(nil, 0, time.Minute)
+	wr.now = clock
+	for i := 0; i < 10; i++ {
+		if _, err := wr.Add("team", fmt.Sprintf("partner%d.com", i), time.Hour); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	j := newJanitor()
+	j.now = clock
+	j.Register("forward_queue", 5*time.Minute, func(now time.Time) int { return f.Sweep(now, time.Hour) })
+	j.Register("watch_changes", 5*time.Minute, func(now time.Time) int { return wr.Sweep(now, 3*time.Hour) })
+
+	var heapAtWarmup uint64
+	var maxQueue, maxChanges int
+	for minute := 0; minute < 24*60; minute++ {
+		now = now.Add(time.Minute)
+
+		// Varied traffic: bursts every quarter hour.
+		burst := 5
+		if minute%15 == 0 {
+			burst = 200
+		}
+		for i := 0; i < burst; i++ {
+			f.Enqueue("team", &verify.Result{Email: fmt.Sprintf("user%d@example.com", i)})
+		}
+		if minute%10 == 0 {
+			wr.mu.Lock()
+			for _, w := range wr.watches {
+				w.Changes = append(w.Changes, watchChange{DetectedAt: now, MXAdded: []string{"mx.example"}})
+			}
+			wr.mu.Unlock()
+		}
+		j.RunDue()
+
+		if minute == 6*60 {
+			runtime.GC()
+			var stats runtime.MemStats
+			runtime.ReadMemStats(&stats)
+			heapAtWarmup = stats.HeapAlloc
+		}
+		if minute >= 6*60 {
+			if n := f.Len(); n > maxQueue {
+				maxQueue = n
+			}
+			if n := wr.ChangeCount(); n > maxChanges {
+				maxChanges = n
+			}
+		}
+	}
+
+	// One hour of traffic (plus a sweep interval of slack) at most.
+	if limit := 65*5 + 5*200; maxQueue > limit {
+		t.Errorf("Forward queue did not stabilize: peak %d, limit %d", maxQueue, limit)
+	}
+	// Three hours of changes (plus slack) for ten watches.
+	if limit := 10 * 19; maxChanges > limit {
+		t.Errorf("Watch changes did not stabilize: peak %d, limit %d", maxChanges, limit)
+	}
+
+	runtime.GC()
+	var stats runtime.MemStats
+	runtime.ReadMemStats(&stats)
+	if stats.HeapAlloc > 2*heapAtWarmup+(4<<20) {
+		t.Errorf("Heap kept growing: %d bytes at warmup, %d at end of day", heapAtWarmup, stats.HeapAlloc)
+	}
+}
@@ -0,0 +1,159 @@
+package httpapi
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/netip"
+	"net/url"
+	"time"
+)
+
+// Job callback deliveries are tried jobCallbackAttempts times, waiting
+// jobCallbackBackoff after the first failure and twice as long after each
+// one after it.
+const jobCallbackAttempts = 3
+
+var jobCallbackBackoff = 2 * time.Second
+
+// Callback delivery statuses.
+const (
+	callbackPending   = "pending"
+	callbackDelivered = "delivered"
+	callbackFailed    = "failed"
+)
+
+var (
+	// jobCallbackSecret signs callback bodies; callbacks are refused
+	// without one. Start sets it.
+	jobCallbackSecret string
+	// jobCallbackPrivate lets callbacks reach loopback and private
+	// addresses, which are otherwise refused so a caller can't make the
+	// server POST into its own network.
+	jobCallbackPrivate bool
+
+	jobCallbackClient = newCallbackClient()
+
+	jobCallbacks = metrics.CounterVec("job_callbacks_total", "List job completion callbacks by outcome.", "outcome")
+)
+
+// jobCallback is where a job reports that it finished, and how that went.
+type jobCallback struct {
+	url      string
+	base     string // the server's URL as the submission reached it
+	delivery callbackDelivery
+}
+
+// callbackDelivery is a callback's progress as GET /api/jobs/{id} shows it.
+type callbackDelivery struct {
+	URL         string     `json:"url"`
+	Status      string     `json:"status"`
+	Attempts    int        `json:"attempts"`
+	LastError   string     `json:"last_error,omitempty"`
+	DeliveredAt *time.Time `json:"delivered_at,omitempty"`
+}
+
+// jobFinishedEvent is the body POSTed to a job's callback URL.
+type jobFinishedEvent struct {
+	Event      string         `json:"event"`
+	JobID      string         `json:"job_id"`
+	Status     string         `json:"status"`
+	Total      int            `json:"total"`
+	Completed  int            `json:"completed"`
+	Counts     map[string]int `json:"counts"`
+	CreatedAt  time.Time      `json:"created_at"`
+	FinishedAt time.Time      `json:"finished_at"`
+	ResultsURL string         `json:"results_url"`
+}
+
+// newJobCallback checks a submission's callback_url. base is the URL the
+// submission reached the server at, which the results link is built on.
+func newJobCallback(target, base string) (*jobCallback, error) {
+	if jobCallbackSecret == "" {
+		return nil, errors.New("callback_url needs the server to be started with -job-callback-secret")
+	}
+	u, err := url.Parse(target)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return nil, fmt.Errorf("callback_url %q is not an http or https URL", target)
+	}
+	return &jobCallback{url: target, base: base, delivery: callbackDelivery{URL: target, Status: callbackPending}}, nil
+}
+
+// notify delivers job's callback, retrying with backoff, and records how
+// it went on the job.
+func (jr *jobRegistry) notify(job *listJob) {
+	jr.mu.Lock()
+	body, err := json.Marshal(jobFinishedEvent{
+		Event:      "job.finished",
+		JobID:      job.id,
+		Status:     job.status,
+		Total:      job.total,
+		Completed:  len(job.results),
+		Counts:     job.counts,
+		CreatedAt:  job.createdAt,
+		FinishedAt: job.finishedAt,
+		ResultsURL: job.callback.base + "/api/jobs/" + job.id + "/results",
+	})
+	target := job.callback.url
+	jr.mu.Unlock()
+	if err != nil {
+		return
+	}
+
+	wait := jobCallbackBackoff
+	for attempt := 1; attempt <= jobCallbackAttempts; attempt++ {
+		if attempt > 1 {
+			time.Sleep(wait)
+			wait *= 2
+		}
+		err := postSigned(context.Background(), jobCallbackClient, target, jobCallbackSecret, body)
+
+		jr.mu.Lock()
+		delivery := &job.callback.delivery
+		delivery.Attempts = attempt
+		if err == nil {
+			now := jr.now()
+			delivery.Status, delivery.LastError, delivery.DeliveredAt = callbackDelivered, "", &now
+			jr.mu.Unlock()
+			jobCallbacks.Add(callbackDelivered, 1)
+			return
+		}
+		delivery.LastError = err.Error()
+		if attempt == jobCallbackAttempts {
+			delivery.Status = callbackFailed
+		}
+		jr.mu.Unlock()
+	}
+	jobCallbacks.Add(callbackFailed, 1)
+}
+
+// newCallbackClient returns an outbound client that, unless
+// jobCallbackPrivate is set, refuses to talk to loopback, private and
+// link-local addresses. The address is checked once connected, so a name
+// that resolves differently on the second lookup gains nothing.
+func newCallbackClient() *http.Client {
+	client := newHTTPClient(10 * time.Second)
+	transport := client.Transport.(*http.Transport)
+	dial := transport.DialContext
+	transport.DialContext = func(ctx context.Context, network, addr string) (net.Conn, error) {
+		conn, err := dial(ctx, network, addr)
+		if err != nil || jobCallbackPrivate {
+			return conn, err
+		}
+		remote, err := netip.ParseAddrPort(conn.RemoteAddr().String())
+		if err != nil || !publicAddr(remote.Addr()) {
+			conn.Close()
+			return nil, fmt.Errorf("callback to non-public address %s refused", conn.RemoteAddr())
+		}
+		return conn, nil
+	}
+	return client
+}
+
+func publicAddr(addr netip.Addr) bool {
+	addr = addr.Unmap()
+	return !(addr.IsLoopback() || addr.IsPrivate() || addr.IsLinkLocalUnicast() || addr.IsUnspecified() || addr.IsMulticast())
+}
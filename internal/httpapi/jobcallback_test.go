@@ -0,0 +1,119 @@
+package httpapi
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+)
+
+// useJobCallbacks sets the callback secret and lets callbacks reach test servers on loopback
+func useJobCallbacks(t *testing.T, secret string, private bool) {
+	t.Helper()
+	savedSecret, savedPrivate, savedBackoff := jobCallbackSecret, jobCallbackPrivate, jobCallbackBackoff
+	jobCallbackSecret, jobCallbackPrivate, jobCallbackBackoff = secret, private, time.Millisecond
+	t.Cleanup(func() {
+		jobCallbackSecret, jobCallbackPrivate, jobCallbackBackoff = savedSecret, savedPrivate, savedBackoff
+	})
+}
+
+// getJob reads job id from GET /api/jobs/{id}
+func getJob(id string) jobView {
+	req := httptest.NewRequest(http.MethodGet, "/api/jobs/"+id, nil)
+	req.SetPathValue("id", id)
+	rec := httptest.NewRecorder()
+	jobHandler(rec, req)
+	var view jobView
+	json.Unmarshal(rec.Body.Bytes(), &view)
+	return view
+}
+
+// TestJobCallback tests that a finished job POSTs a signed summary to its callback URL, retrying after a failure
+func TestJobCallback(t *testing.T) {
+	registry := useJobs(t, 50)
+	useJobCallbacks(t, "shh", true)
+
+	var mu sync.Mutex
+	var calls int
+	var event jobFinishedEvent
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		mu.Lock()
+		defer mu.Unlock()
+		calls++
+		if calls == 1 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		if r.Header.Get("X-Signature") != "sha256="+signBody("shh", body) {
+			t.Errorf("Expected a signed body, got %q", r.Header.Get("X-Signature"))
+		}
+		json.Unmarshal(body, &event)
+	}))
+	defer receiver.Close()
+
+	rec := postJob(map[string]interface{}{
+		"emails":       []string{"a@example.com", "b@example.com"},
+		"callback_url": receiver.URL + "/hook",
+	}, "")
+	if rec.Code != http.StatusAccepted {
+		t.Fatalf("Expected status 202, got %d: %s", rec.Code, rec.Body.String())
+	}
+	var view jobView
+	json.Unmarshal(rec.Body.Bytes(), &view)
+	registry.Wait()
+
+	mu.Lock()
+	if calls != 2 {
+		t.Errorf("Expected 2 attempts, got %d", calls)
+	}
+	if event.Event != "job.finished" || event.JobID != view.ID || event.Status != jobDone || event.Completed != 2 {
+		t.Errorf("Expected a job.finished event for %s, got %+v", view.ID, event)
+	}
+	if event.ResultsURL != "http://example.com/api/jobs/"+view.ID+"/results" {
+		t.Errorf("Expected the results URL, got %q", event.ResultsURL)
+	}
+	mu.Unlock()
+
+	delivery := getJob(view.ID).Callback
+	if delivery == nil || delivery.Status != callbackDelivered || delivery.Attempts != 2 || delivery.DeliveredAt == nil {
+		t.Errorf("Expected a delivered callback after 2 attempts, got %+v", delivery)
+	}
+}
+
+// TestJobCallbackRefused tests that callbacks need a secret and don't reach private addresses by default
+func TestJobCallbackRefused(t *testing.T) {
+	registry := useJobs(t, 50)
+	submission := map[string]interface{}{"emails": []string{"a@example.com"}, "callback_url": "http://127.0.0.1:1/hook"}
+
+	useJobCallbacks(t, "", false)
+	if rec := postJob(submission, ""); rec.Code != http.StatusBadRequest {
+		t.Errorf("Expected status 400 without a callback secret, got %d", rec.Code)
+	}
+
+	jobCallbackSecret = "shh"
+	if rec := postJob(map[string]interface{}{"emails": []string{"a@example.com"}, "callback_url": "ftp://example.com/"}, ""); rec.Code != http.StatusBadRequest {
+		t.Errorf("Expected status 400 for a non-HTTP callback, got %d", rec.Code)
+	}
+
+	called := false
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) { called = true }))
+	defer receiver.Close()
+	submission["callback_url"] = receiver.URL
+	rec := postJob(submission, "")
+	if rec.Code != http.StatusAccepted {
+		t.Fatalf("Expected status 202, got %d: %s", rec.Code, rec.Body.String())
+	}
+	var view jobView
+	json.Unmarshal(rec.Body.Bytes(), &view)
+	registry.Wait()
+	if called {
+		t.Error("Expected the loopback callback to be refused")
+	}
+	if delivery := getJob(view.ID).Callback; delivery == nil || delivery.Status != callbackFailed || delivery.Attempts != jobCallbackAttempts {
+		t.Errorf("Expected a failed callback after %d attempts, got %+v", jobCallbackAttempts, delivery)
+	}
+}
@@ -0,0 +1,83 @@
+package httpapi
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// jobEventsHeartbeat is how often an idle event stream sends a comment, so
+// proxies that close quiet connections leave it open.
+var jobEventsHeartbeat = 15 * time.Second
+
+// jobDoneEvent is the data of the terminal done event.
+type jobDoneEvent struct {
+	Status    string         `json:"status"`
+	Total     int            `json:"total"`
+	Completed int            `json:"completed"`
+	Counts    map[string]int `json:"counts"`
+}
+
+// jobEventsHandler streams a job's results as Server-Sent Events for the
+// progress page. Each result is a result event whose id is its position
+// in the list plus one, so a reconnecting EventSource resumes after the
+// last one it got through Last-Event-ID; ?from=N starts after the first N.
+// Once the job has finished and every result is sent, a done event closes
+// the stream.
+func jobEventsHandler(w http.ResponseWriter, r *http.Request) {
+	id := r.PathValue("id")
+	nudges, unsubscribe, ok := jobs.Subscribe(id)
+	if !ok {
+		http.Error(w, "Job not found", http.StatusNotFound)
+		return
+	}
+	defer unsubscribe()
+
+	sent := 0
+	for _, from := range []string{r.URL.Query().Get("from"), r.Header.Get("Last-Event-ID")} {
+		if n, err := strconv.Atoi(from); err == nil && n > 0 {
+			sent = n
+		}
+	}
+
+	rc := http.NewResponseController(w)
+	// The stream lasts as long as the job, past the server's write timeout
+	rc.SetWriteDeadline(time.Time{})
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+	rc.Flush()
+
+	heartbeat := time.NewTicker(jobEventsHeartbeat)
+	defer heartbeat.Stop()
+	for {
+		view, ok := jobs.Since(id, sent)
+		if !ok {
+			return
+		}
+		for _, result := range view.Results {
+			data, _ := json.Marshal(result)
+			sent++
+			fmt.Fprintf(w, "event: result\nid: %d\ndata: %s\n\n", sent, data)
+		}
+		if view.FinishedAt != nil {
+			data, _ := json.Marshal(jobDoneEvent{Status: view.Status, Total: view.Total, Completed: view.Completed, Counts: view.Counts})
+			fmt.Fprintf(w, "event: done\ndata: %s\n\n", data)
+			rc.Flush()
+			return
+		}
+		if rc.Flush() != nil {
+			return
+		}
+
+		select {
+		case <-nudges:
+		case <-heartbeat.C:
+			fmt.Fprint(w, ": heartbeat\n\n")
+		case <-r.Context().Done():
+			return
+		}
+	}
+}
@@ -0,0 +1,158 @@
+package httpapi
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"email-verifier/pkg/verify"
+)
+
+// sseEvent is one event read off a stream; comments have only a comment
+type sseEvent struct {
+	name, id, data, comment string
+}
+
+// readEvents connects to the events of job id from position from and returns each event until the stream ends
+func readEvents(t *testing.T, server *httptest.Server, id string, from int, each func(sseEvent)) {
+	t.Helper()
+	resp, err := http.Get(server.URL + "/events/" + id + "?from=" + strconv.Itoa(from))
+	if err != nil {
+		t.Fatalf("Failed to connect: %v", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK || resp.Header.Get("Content-Type") != "text/event-stream" {
+		t.Fatalf("Expected an event stream, got %d %s", resp.StatusCode, resp.Header.Get("Content-Type"))
+	}
+	scanner := bufio.NewScanner(resp.Body)
+	scanner.Buffer(nil, 1<<20)
+	var event sseEvent
+	for scanner.Scan() {
+		line := scanner.Text()
+		switch {
+		case line == "":
+			each(event)
+			event = sseEvent{}
+		case strings.HasPrefix(line, ":"):
+			event.comment = strings.TrimSpace(line[1:])
+		case strings.HasPrefix(line, "event: "):
+			event.name = line[len("event: "):]
+		case strings.HasPrefix(line, "id: "):
+			event.id = line[len("id: "):]
+		case strings.HasPrefix(line, "data: "):
+			event.data = line[len("data: "):]
+		}
+	}
+}
+
+func eventsServer(t *testing.T) *httptest.Server {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/events/{id}", jobEventsHandler)
+	server := httptest.NewServer(mux)
+	t.Cleanup(server.Close)
+	return server
+}
+
+// TestJobEvents tests that every result is pushed once, in order, before a terminal done event
+func TestJobEvents(t *testing.T) {
+	registry := useJobs(t, 5)
+	server := eventsServer(t)
+	saved := jobEventsHeartbeat
+	jobEventsHeartbeat = 10 * time.Millisecond
+	t.Cleanup(func() { jobEventsHeartbeat = saved })
+
+	// Hold the slow lane so the stream starts before any result is ready,
+	// and let it go on the first heartbeat
+	savedSlow := slowLane
+	slowLane = newLane(laneSlow, 1)
+	t.Cleanup(func() { slowLane = savedSlow })
+	release := make(chan struct{})
+	go slowLane.Do(context.Background(), func() { <-release })
+	for slowLane.InUse() == 0 {
+		time.Sleep(time.Millisecond)
+	}
+	emails := strings.Split(pasteList(2*jobChunkSize+5), "\n")
+	id := registry.Start(emails, verify.Options{Checks: verify.DefaultChecks})
+
+	var results int
+	var done jobDoneEvent
+	released := false
+	readEvents(t, server, id, 0, func(e sseEvent) {
+		switch e.name {
+		case "result":
+			results++
+			var result verify.Result
+			json.Unmarshal([]byte(e.data), &result)
+			if e.id != strconv.Itoa(results) || result.Email != emails[results-1] {
+				t.Errorf("Expected result %d to be %s, got id %s for %s", results, emails[results-1], e.id, result.Email)
+			}
+		case "done":
+			json.Unmarshal([]byte(e.data), &done)
+		}
+		if !released {
+			close(release)
+			released = true
+		}
+	})
+	if results != len(emails) || done.Status != jobDone || done.Completed != len(emails) {
+		t.Errorf("Expected %d results and a done event, got %d and %+v", len(emails), results, done)
+	}
+
+	// A finished job replays results after from, then closes
+	results = 0
+	readEvents(t, server, id, len(emails)-2, func(e sseEvent) {
+		if e.name == "result" {
+			results++
+		}
+	})
+	if results != 2 {
+		t.Errorf("Expected the last 2 results, got %d", results)
+	}
+
+	rec := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodGet, "/events/missing", nil)
+	req.SetPathValue("id", "missing")
+	jobEventsHandler(rec, req)
+	if rec.Code != http.StatusNotFound {
+		t.Errorf("Expected status 404 for an unknown job, got %d", rec.Code)
+	}
+}
+
+// TestJobEventsHeartbeat tests that an idle stream sends heartbeat comments
+func TestJobEventsHeartbeat(t *testing.T) {
+	registry := useJobs(t, 5)
+	server := eventsServer(t)
+	saved := jobEventsHeartbeat
+	jobEventsHeartbeat = 10 * time.Millisecond
+	t.Cleanup(func() { jobEventsHeartbeat = saved })
+
+	savedSlow := slowLane
+	slowLane = newLane(laneSlow, 1)
+	t.Cleanup(func() { slowLane = savedSlow })
+	release := make(chan struct{})
+	go slowLane.Do(context.Background(), func() { <-release })
+	for slowLane.InUse() == 0 {
+		time.Sleep(time.Millisecond)
+	}
+	id := registry.Start(strings.Split(pasteList(5), "\n"), verify.Options{Checks: verify.DefaultChecks})
+
+	var heartbeats int
+	var done bool
+	readEvents(t, server, id, 0, func(e sseEvent) {
+		if e.comment == "heartbeat" {
+			if heartbeats++; heartbeats == 2 {
+				close(release)
+			}
+		}
+		done = done || e.name == "done"
+	})
+	if heartbeats < 2 || !done {
+		t.Errorf("Expected heartbeats while idle and then a done event, got %d heartbeats, done %v", heartbeats, done)
+	}
+}
@@ -0,0 +1,706 @@
+package httpapi
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"maps"
+	"math"
+	"mime"
+	"net/http"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"email-verifier/pkg/verify"
+)
+
+// jobChunkSize is how many addresses a list job verifies per batch. Results
+// become visible a chunk at a time, and cancellation takes effect between
+// chunks.
+const jobChunkSize = 50
+
+// jobWorkers is how many chunks of a job are verified at once; Start
+// replaces it. The lanes still bound how many verifications run across
+// all jobs and API traffic.
+var jobWorkers = 4
+
+// jobRetryDelay is how long a job waits before verifying its deferred
+// results once more; zero turns the retry off. maxPendingRetries caps the
+// deferred addresses waiting on a retry across all jobs, so deferrals
+// past it keep their first result. Start replaces both.
+var (
+	jobRetryDelay     time.Duration
+	maxPendingRetries = 1000
+	pendingRetries    atomic.Int64
+)
+
+// List job statuses.
+const (
+	jobRunning   = "running"
+	jobDone      = "done"
+	jobCancelled = "cancelled"
+)
+
+// listJob verifies a pasted list in the background so the web UI can show
+// results as they arrive instead of holding the request open.
+type listJob struct {
+	id         string
+	tenant     string
+	project    string
+	status     string
+	total      int
+	createdAt  time.Time
+	finishedAt time.Time
+	results    []*verify.Result
+	counts     map[string]int // results by verdict
+	// pending holds results, by index, that finished before an earlier
+	// one; results are only published in paste order.
+	pending  map[int]*verify.Result
+	callback *jobCallback // nil without a callback_url
+	cancel   context.CancelFunc
+	// retryPending is how many deferred results wait on the job's retry.
+	retryPending int
+	// subscribers are nudged whenever results are published or the job
+	// finishes; see Subscribe.
+	subscribers map[chan struct{}]bool
+}
+
+// jobView is a snapshot of a job, as returned by /api/jobs/{id} and rendered
+// by the progress page. Counts are the completed results by verdict.
+// Results holds a page of the completed results, in paste order.
+// NextCursor continues after it; while the job runs it is set even at the
+// end of the results so far, for polling.
+type jobView struct {
+	ID              string           `json:"id"`
+	Status          string           `json:"status"`
+	Total           int              `json:"total"`
+	Completed       int              `json:"completed"`
+	ProgressPercent float64          `json:"progress_percent"`
+	Counts          map[string]int   `json:"counts"`
+	CreatedAt       time.Time        `json:"created_at"`
+	FinishedAt      *time.Time       `json:"finished_at,omitempty"`
+	Results         []*verify.Result `json:"results"`
+	NextCursor      string           `json:"next_cursor,omitempty"`
+	// RetryPending is how many deferred results the job verifies again
+	// before it finishes.
+	RetryPending int `json:"retry_pending,omitempty"`
+	// Callback is set for jobs submitted with a callback_url.
+	Callback *callbackDelivery `json:"callback,omitempty"`
+}
+
+// jobRegistry owns the list jobs started from the web UI.
+type jobRegistry struct {
+	mu   sync.Mutex
+	jobs map[string]*listJob
+	wg   sync.WaitGroup
+	now  func() time.Time
+}
+
+var jobs = newJobRegistry()
+
+func newJobRegistry() *jobRegistry {
+	return &jobRegistry{
+		jobs: make(map[string]*listJob),
+		now:  time.Now,
+	}
+}
+
+// Start verifies emails in chunks on a background goroutine and returns the
+// new job's ID.
+func (jr *jobRegistry) Start(emails []string, opts verify.Options) string {
+	return jr.Submit(jobSubmission{}, emails, opts)
+}
+
+// jobSubmission is what an API submission adds to a job: the project it
+// is a run of, summarized into the project once the job finishes, and the
+// callback told when it does.
+type jobSubmission struct {
+	project  string
+	callback *jobCallback
+}
+
+// Submit starts a job as sub asks.
+func (jr *jobRegistry) Submit(sub jobSubmission, emails []string, opts verify.Options) string {
+	ctx, cancel := context.WithCancel(context.Background())
+	job := &listJob{
+		id:          newWatchID(),
+		tenant:      service.TenantFor(opts.Key),
+		project:     sub.project,
+		status:      jobRunning,
+		total:       len(emails),
+		createdAt:   jr.now(),
+		results:     make([]*verify.Result, 0, len(emails)),
+		counts:      make(map[string]int),
+		pending:     make(map[int]*verify.Result),
+		callback:    sub.callback,
+		cancel:      cancel,
+		subscribers: make(map[chan struct{}]bool),
+	}
+
+	jr.mu.Lock()
+	jr.jobs[job.id] = job
+	jr.mu.Unlock()
+	if sub.project != "" {
+		projects.StartRun(sub.project, job.id, job.total, job.createdAt)
+	}
+
+	jr.wg.Add(1)
+	go func() {
+		defer jr.wg.Done()
+		defer cancel()
+		jr.run(ctx, job, emails, opts)
+	}()
+	return job.id
+}
+
+// run verifies the job's addresses on jobWorkers goroutines.
+func (jr *jobRegistry) run(ctx context.Context, job *listJob, emails []string, opts verify.Options) {
+	indexes := make([]int, len(emails))
+	for i := range indexes {
+		indexes[i] = i
+	}
+	verifyJobChunks(ctx, emails, indexes, opts, func(chunk []int, results []*verify.Result) {
+		for _, result := range results {
+			verificationVerdicts.Add(result.Verdict, 1)
+		}
+		jr.mu.Lock()
+		job.complete(chunk, results)
+		jr.mu.Unlock()
+	})
+	if ctx.Err() == nil {
+		jr.retryDeferred(ctx, job, emails, opts)
+	}
+
+	jr.mu.Lock()
+	job.finishedAt = jr.now()
+	if job.status == jobRunning {
+		job.status = jobDone
+	}
+	job.publish()
+	status, finishedAt, results := job.status, job.finishedAt, job.results
+	jr.mu.Unlock()
+	if job.project != "" {
+		projects.FinishRun(job.project, job.id, status, finishedAt, results)
+	}
+	if job.callback != nil {
+		jr.notify(job)
+	}
+}
+
+// retryDeferred verifies the job's deferred results once more after
+// jobRetryDelay, replacing them in place. The job stays running meanwhile.
+func (jr *jobRegistry) retryDeferred(ctx context.Context, job *listJob, emails []string, opts verify.Options) {
+	if jobRetryDelay <= 0 {
+		return
+	}
+	jr.mu.Lock()
+	var indexes []int
+	for i, result := range job.results {
+		if result.Deferred {
+			indexes = append(indexes, i)
+		}
+	}
+	indexes = indexes[:reserveRetries(len(indexes))]
+	job.retryPending = len(indexes)
+	jr.mu.Unlock()
+	if len(indexes) == 0 {
+		return
+	}
+	defer func() {
+		pendingRetries.Add(-int64(len(indexes)))
+		jr.mu.Lock()
+		job.retryPending = 0
+		jr.mu.Unlock()
+	}()
+
+	timer := time.NewTimer(jobRetryDelay)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+	case <-ctx.Done():
+		return
+	}
+	verifyJobChunks(ctx, emails, indexes, opts, func(chunk []int, results []*verify.Result) {
+		jr.mu.Lock()
+		defer jr.mu.Unlock()
+		for i, index := range chunk {
+			job.counts[job.results[index].Verdict]--
+			if job.counts[job.results[index].Verdict] == 0 {
+				delete(job.counts, job.results[index].Verdict)
+			}
+			job.results[index] = results[i]
+			job.counts[results[i].Verdict]++
+			verificationVerdicts.Add(results[i].Verdict, 1)
+		}
+		job.publish()
+	})
+}
+
+// verifyJobChunks verifies emails at indexes on jobWorkers goroutines, in
+// chunks of up to jobChunkSize addresses at one domain while
+// domainThrottles limits any, and hands each chunk's results to done.
+// Chunks share the lanes with API traffic and wait for a slot for as long
+// as ctx lasts; a domain at its limits waits while other domains' chunks
+// go ahead.
+func verifyJobChunks(ctx context.Context, emails []string, indexes []int, opts verify.Options, done func(chunk []int, results []*verify.Result)) {
+	queue := newThrottleQueue(domainThrottles, indexes, func(i int) string { return throttleDomain(emails[i], opts.Checks) }, jobChunkSize)
+	var wg sync.WaitGroup
+	for range max(1, jobWorkers) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				domain, chunk, ok := queue.Next(ctx)
+				if !ok {
+					return
+				}
+				batch := make([]string, len(chunk))
+				for i, index := range chunk {
+					batch[i] = emails[index]
+				}
+				var results []*verify.Result
+				err := laneFor(opts.Checks).Do(ctx, func() { results, _ = service.VerifyBatch(batch, opts) })
+				queue.Done(domain)
+				if err == nil {
+					done(chunk, results)
+				}
+			}
+		}()
+	}
+	wg.Wait()
+}
+
+// reserveRetries takes up to n of the pending retry slots and returns how
+// many it took.
+func reserveRetries(n int) int {
+	for {
+		pending := pendingRetries.Load()
+		take := min(int64(n), int64(maxPendingRetries)-pending)
+		if take <= 0 {
+			return 0
+		}
+		if pendingRetries.CompareAndSwap(pending, pending+take) {
+			return int(take)
+		}
+	}
+}
+
+// Get returns a snapshot of the job with the requested page of results.
+func (jr *jobRegistry) Get(id string, page pageRequest) (jobView, bool) {
+	jr.mu.Lock()
+	defer jr.mu.Unlock()
+
+	job, ok := jr.jobs[id]
+	if !ok {
+		return jobView{}, false
+	}
+	return job.view(page), true
+}
+
+// Results returns the job's completed results and the tenant that
+// submitted it.
+func (jr *jobRegistry) Results(id string) ([]*verify.Result, string, bool) {
+	jr.mu.Lock()
+	defer jr.mu.Unlock()
+
+	job, ok := jr.jobs[id]
+	if !ok {
+		return nil, "", false
+	}
+	return append([]*verify.Result(nil), job.results...), job.tenant, true
+}
+
+// Since returns a snapshot of the job whose results are all those from
+// position from on.
+func (jr *jobRegistry) Since(id string, from int) (jobView, bool) {
+	jr.mu.Lock()
+	defer jr.mu.Unlock()
+
+	job, ok := jr.jobs[id]
+	if !ok {
+		return jobView{}, false
+	}
+	return job.view(pageRequest{after: &pageCursor{Key: int64(from) - 1}, limit: len(job.results)}), true
+}
+
+// Subscribe returns a channel that receives a value whenever the job
+// publishes results or finishes, and a function that unsubscribes. Nudges
+// are dropped while one is waiting to be received, so a subscriber reads
+// what it missed with Since rather than from the channel.
+func (jr *jobRegistry) Subscribe(id string) (<-chan struct{}, func(), bool) {
+	jr.mu.Lock()
+	defer jr.mu.Unlock()
+
+	job, ok := jr.jobs[id]
+	if !ok {
+		return nil, nil, false
+	}
+	ch := make(chan struct{}, 1)
+	job.subscribers[ch] = true
+	return ch, func() {
+		jr.mu.Lock()
+		delete(job.subscribers, ch)
+		jr.mu.Unlock()
+	}, true
+}
+
+// Cancel stops a running job after its current chunk. Results verified so
+// far are kept.
+func (jr *jobRegistry) Cancel(id string) (jobView, bool) {
+	jr.mu.Lock()
+	defer jr.mu.Unlock()
+
+	job, ok := jr.jobs[id]
+	if !ok {
+		return jobView{}, false
+	}
+	if job.status == jobRunning {
+		job.status = jobCancelled
+		job.cancel()
+	}
+	return job.view(pageRequest{after: &pageCursor{Key: int64(len(job.results)) - 1}}), true
+}
+
+// Wait blocks until every started job has finished.
+func (jr *jobRegistry) Wait() { jr.wg.Wait() }
+
+// Len returns the number of jobs held, running or finished.
+func (jr *jobRegistry) Len() int {
+	jr.mu.Lock()
+	defer jr.mu.Unlock()
+	return len(jr.jobs)
+}
+
+// Sweep drops jobs that finished more than ttl ago.
+func (jr *jobRegistry) Sweep(now time.Time, ttl time.Duration) int {
+	jr.mu.Lock()
+	defer jr.mu.Unlock()
+
+	evicted := 0
+	for id, job := range jr.jobs {
+		if !job.finishedAt.IsZero() && now.Sub(job.finishedAt) > ttl {
+			delete(jr.jobs, id)
+			evicted++
+		}
+	}
+	return evicted
+}
+
+// complete records the results of the addresses at indexes, publishing
+// them and any after them that were waiting once nothing earlier is
+// missing. It must be called with the registry lock held.
+func (j *listJob) complete(indexes []int, results []*verify.Result) {
+	for i, index := range indexes {
+		j.pending[index] = results[i]
+	}
+	published := false
+	for {
+		next, ok := j.pending[len(j.results)]
+		if !ok {
+			break
+		}
+		delete(j.pending, len(j.results))
+		j.results = append(j.results, next)
+		j.counts[next.Verdict]++
+		published = true
+	}
+	if published {
+		j.publish()
+	}
+}
+
+// publish nudges the job's subscribers. It must be called with the
+// registry lock held.
+func (j *listJob) publish() {
+	for ch := range j.subscribers {
+		select {
+		case ch <- struct{}{}:
+		default:
+		}
+	}
+}
+
+// view must be called with the registry lock held. Results are keyed by
+// their position in the paste.
+func (j *listJob) view(page pageRequest) jobView {
+	key := func(i int) pageCursor { return pageCursor{Key: int64(i)} }
+	start, end, next := page.window(len(j.results), key)
+	if next == "" && j.status == jobRunning {
+		next = key(end - 1).String()
+	}
+	v := jobView{
+		ID:              j.id,
+		Status:          j.status,
+		Total:           j.total,
+		Completed:       len(j.results),
+		ProgressPercent: 100,
+		Counts:          maps.Clone(j.counts),
+		CreatedAt:       j.createdAt,
+		Results:         append([]*verify.Result{}, j.results[start:end]...),
+		NextCursor:      next,
+		RetryPending:    j.retryPending,
+	}
+	if j.total > 0 {
+		v.ProgressPercent = math.Floor(1000*float64(len(j.results))/float64(j.total)) / 10
+	}
+	if !j.finishedAt.IsZero() {
+		finished := j.finishedAt
+		v.FinishedAt = &finished
+	}
+	if j.callback != nil {
+		delivery := j.callback.delivery
+		v.Callback = &delivery
+	}
+	return v
+}
+
+// submitJobHandler starts a list job from POST /api/jobs, given a JSON list
+// of emails or a CSV upload as /api/verify/csv takes. With dry_run it only
+// plans the job: the offline phases run, nothing touches the network, and
+// the response carries a plan token that a later submission executes
+// without the list being uploaded again.
+func submitJobHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var request struct {
+		Emails      []string  `json:"emails"`
+		Checks      checkList `json:"checks"`
+		DryRun      bool      `json:"dry_run"`
+		PlanToken   string    `json:"plan_token"`
+		Project     string    `json:"project"`
+		CallbackURL string    `json:"callback_url"`
+	}
+	if mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type")); mediaType == "multipart/form-data" {
+		// A CSV upload: the email column's rows are the list, in file
+		// order, and the other fields come from the form
+		_, rows, column, ok := readCSVUpload(w, r, maxJobEmails)
+		if !ok {
+			return
+		}
+		defer r.MultipartForm.RemoveAll()
+		request.Emails = make([]string, len(rows))
+		for i, row := range rows {
+			if column < len(row) {
+				request.Emails[i] = strings.TrimSpace(row[column])
+			}
+		}
+		if checks := r.FormValue("checks"); checks != "" {
+			request.Checks = strings.Split(checks, ",")
+		}
+		request.Project = r.FormValue("project")
+		request.CallbackURL = r.FormValue("callback_url")
+		request.DryRun = r.FormValue("dry_run") == "true"
+	} else if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		http.Error(w, "Invalid JSON", http.StatusBadRequest)
+		return
+	}
+	if r.URL.Query().Get("dry_run") == "true" {
+		request.DryRun = true
+	}
+	key := requestKey(r)
+
+	// A project's runs use its checks and profile unless the request
+	// sets checks itself
+	var proj project
+	if request.Project != "" {
+		var ok bool
+		if proj, ok = projects.Get(service.TenantFor(key), request.Project); !ok {
+			http.Error(w, "Project not found", http.StatusNotFound)
+			return
+		}
+		if request.Checks == nil && len(proj.Checks) > 0 {
+			request.Checks = proj.Checks
+		}
+	}
+
+	sub := jobSubmission{project: request.Project}
+	if request.CallbackURL != "" {
+		callback, err := newJobCallback(request.CallbackURL, baseURL(r))
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		sub.callback = callback
+	}
+
+	if request.PlanToken != "" {
+		stored, err := plans.Take(request.PlanToken, key)
+		switch {
+		case errors.Is(err, errPlanTampered):
+			http.Error(w, err.Error(), http.StatusForbidden)
+			return
+		case errors.Is(err, errPlanExpired):
+			http.Error(w, err.Error(), http.StatusGone)
+			return
+		}
+		if err := service.Ready(); err != nil {
+			writeVerifierUnavailable(w, err)
+			return
+		}
+		writeJobStarted(w, jobs.Submit(sub, stored.plan.Emails, stored.opts))
+		return
+	}
+
+	if len(request.Emails) == 0 {
+		http.Error(w, "emails or plan_token is required", http.StatusBadRequest)
+		return
+	}
+	if len(request.Emails) > maxJobEmails {
+		http.Error(w, fmt.Sprintf("Too many addresses (at most %d per job)", maxJobEmails), http.StatusRequestEntityTooLarge)
+		return
+	}
+	if err := service.Ready(); err != nil {
+		writeVerifierUnavailable(w, err)
+		return
+	}
+	checks, err := requestChecks(request.Checks, r.URL.Query().Get("checks"), key)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	opts := verify.Options{Checks: checks, Key: key, Profile: proj.Profile}
+
+	if !request.DryRun {
+		writeJobStarted(w, jobs.Submit(sub, request.Emails, opts))
+		return
+	}
+	plan := service.PlanBatch(request.Emails, opts)
+	token, expires := plans.Add(plan, opts)
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"plan":       plan,
+		"plan_token": token,
+		"expires_at": expires,
+	})
+}
+
+// writeJobStarted answers a job submission with the new job's first view.
+func writeJobStarted(w http.ResponseWriter, id string) {
+	view, _ := jobs.Get(id, firstPage)
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Location", "/api/jobs/"+id)
+	w.WriteHeader(http.StatusAccepted)
+	json.NewEncoder(w).Encode(view)
+}
+
+// jobHandler reports a job's progress on GET and cancels it on DELETE, as
+// POST /api/jobs/{id}/cancel does.
+func jobHandler(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+	case http.MethodDelete:
+		jobCancelHandler(w, r)
+		return
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	page, err := parsePageRequest(r.URL.Query())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	view, ok := jobs.Get(r.PathValue("id"), page)
+	if !ok {
+		http.Error(w, "Job not found", http.StatusNotFound)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(view)
+}
+
+// jobResultsPage is a page of a job's results from /api/jobs/{id}/results.
+type jobResultsPage struct {
+	ID         string           `json:"id"`
+	Status     string           `json:"status"`
+	Results    []*verify.Result `json:"results"`
+	NextCursor string           `json:"next_cursor,omitempty"`
+}
+
+// jobResultsHandler pages through a job's results without its progress,
+// by cursor like every list in the API.
+func jobResultsHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	page, err := parsePageRequest(r.URL.Query())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	view, ok := jobs.Get(r.PathValue("id"), page)
+	if !ok {
+		http.Error(w, "Job not found", http.StatusNotFound)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(jobResultsPage{ID: view.ID, Status: view.Status, Results: view.Results, NextCursor: view.NextCursor})
+}
+
+// jobExportHandler downloads a job's results as CSV, filtered like the
+// results table and optionally pseudonymized under the submitting tenant's
+// secret.
+func jobExportHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	results, tenant, ok := jobs.Results(r.PathValue("id"))
+	if !ok {
+		http.Error(w, "Job not found", http.StatusNotFound)
+		return
+	}
+	f, err := parseResultFilter(r.URL.Query())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	p, err := parsePseudonymizer(r.URL.Query(), tenant)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/csv; charset=utf-8")
+	w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="job-%s.csv"`, r.PathValue("id")))
+	writeResultsCSV(w, results, f, p, time.Now())
+}
+
+func jobCancelHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost && r.Method != http.MethodDelete {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	view, ok := jobs.Cancel(r.PathValue("id"))
+	if !ok {
+		http.Error(w, "Job not found", http.StatusNotFound)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(view)
+}
+
+func jobPageHandler(w http.ResponseWriter, r *http.Request) {
+	// The page renders everything verified so far and follows
+	// /events/{id} for the rest
+	view, ok := jobs.Get(r.PathValue("id"), pageRequest{limit: maxPaste})
+	if !ok {
+		http.Error(w, "Job not found", http.StatusNotFound)
+		return
+	}
+	renderJob(w, r, view)
+}
+
+// renderJob renders the list results page. Running jobs stream the rest
+// of their results; finished ones render complete.
+func renderJob(w http.ResponseWriter, r *http.Request, view jobView) {
+	renderPage(w, r, "job.html", view)
+}
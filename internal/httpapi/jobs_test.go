@@ -0,0 +1,346 @@
+package httpapi
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"email-verifier/pkg/verify"
+	"email-verifier/pkg/verify/verifytest"
+	emailverifier "github.com/AfterShip/email-verifier"
+)
+
+// useJobs replaces the job registry and paste threshold for the duration of a test
+func useJobs(t *testing.T, threshold int) *jobRegistry {
+	t.Helper()
+	useService(t, verify.Config{Resolver: verifytest.NewResolver()})
+	savedJobs, savedThreshold := jobs, asyncPasteThreshold
+	jobs, asyncPasteThreshold = newJobRegistry(), threshold
+	t.Cleanup(func() {
+		jobs.Wait()
+		jobs, asyncPasteThreshold = savedJobs, savedThreshold
+	})
+	return jobs
+}
+
+// pasteList returns n addresses, one per line
+func pasteList(n int) string {
+	lines := make([]string, n)
+	for i := range lines {
+		lines[i] = fmt.Sprintf("user%d@example.com", i)
+	}
+	return strings.Join(lines, "\n")
+}
+
+// postPaste submits the web form with input
+func postPaste(input string) *httptest.ResponseRecorder {
+	form := url.Values{"email": {input}}
+	req := httptest.NewRequest(http.MethodPost, "/verify", strings.NewReader(form.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	rec := httptest.NewRecorder()
+	verifyHandler(rec, req)
+	return rec
+}
+
+// TestPasteThreshold tests that only pastes at or above the threshold become background jobs
+func TestPasteThreshold(t *testing.T) {
+	registry := useJobs(t, 5)
+
+	testCases := []struct {
+		name  string
+		input string
+		async bool
+		page  string
+	}{
+		{"single address", "jane@example.com", false, "Verification Results"},
+		{"below threshold", pasteList(4), false, "List Results"},
+		{"comma separated", "a@example.com, b@example.com", false, "List Results"},
+		{"at threshold", pasteList(5), true, ""},
+		{"large paste", pasteList(2000), true, ""},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			before := registry.Len()
+			rec := postPaste(tc.input)
+
+			if tc.async {
+				location := rec.Header().Get("Location")
+				if rec.Code != http.StatusSeeOther || !strings.HasPrefix(location, "/jobs/") {
+					t.Fatalf("Expected redirect to a job page, got %d to %q", rec.Code, location)
+				}
+				if registry.Len() != before+1 {
+					t.Errorf("Expected a new job, got %d jobs", registry.Len())
+				}
+				return
+			}
+			if rec.Code != http.StatusOK {
+				t.Fatalf("Expected status 200, got %d", rec.Code)
+			}
+			if !strings.Contains(rec.Body.String(), tc.page) {
+				t.Errorf("Expected the %q page", tc.page)
+			}
+			if registry.Len() != before {
+				t.Error("Expected no job for a small paste")
+			}
+		})
+	}
+}
+
+// TestPasteTooLarge tests that pastes over the cap are refused
+func TestPasteTooLarge(t *testing.T) {
+	useJobs(t, 5)
+	saved := maxPaste
+	maxPaste = 10
+	t.Cleanup(func() { maxPaste = saved })
+
+	if rec := postPaste(pasteList(11)); rec.Code != http.StatusRequestEntityTooLarge {
+		t.Errorf("Expected status 413, got %d", rec.Code)
+	}
+}
+
+// TestJobResults tests that a job's results can be read incrementally by cursor
+func TestJobResults(t *testing.T) {
+	registry := useJobs(t, 5)
+	emails := strings.Split(pasteList(jobChunkSize+10), "\n")
+	id := registry.Start(emails, verify.Options{Checks: verify.DefaultChecks})
+	registry.Wait()
+
+	get := func(query string) (int, jobView) {
+		req := httptest.NewRequest(http.MethodGet, "/api/jobs/"+id+"?"+query, nil)
+		req.SetPathValue("id", id)
+		rec := httptest.NewRecorder()
+		jobHandler(rec, req)
+		var view jobView
+		json.Unmarshal(rec.Body.Bytes(), &view)
+		return rec.Code, view
+	}
+
+	code, view := get("limit=500")
+	if code != http.StatusOK || view.Status != jobDone || view.Completed != len(emails) || len(view.Results) != len(emails) {
+		t.Fatalf("Expected a finished job with %d results, got %d: %+v", len(emails), code, view)
+	}
+	if view.Results[jobChunkSize].Email != emails[jobChunkSize] {
+		t.Errorf("Expected results in paste order, got %s at %d", view.Results[jobChunkSize].Email, jobChunkSize)
+	}
+	if view.NextCursor != "" {
+		t.Errorf("Expected no next cursor at the end of a finished job, got %q", view.NextCursor)
+	}
+
+	_, first := get("limit=55")
+	_, rest := get("cursor=" + first.NextCursor)
+	if len(first.Results) != 55 || len(rest.Results) != 5 || rest.Results[0].Email != emails[55] {
+		t.Errorf("Expected pages of 55 and 5 results, got %d and %d", len(first.Results), len(rest.Results))
+	}
+	if code, _ := get("offset=55"); code != http.StatusBadRequest {
+		t.Errorf("Expected status 400 for offset pagination, got %d", code)
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/api/jobs/missing", nil)
+	req.SetPathValue("id", "missing")
+	rec := httptest.NewRecorder()
+	jobHandler(rec, req)
+	if rec.Code != http.StatusNotFound {
+		t.Errorf("Expected status 404 for an unknown job, got %d", rec.Code)
+	}
+}
+
+// TestJobCancel tests that cancelling stops a job between chunks and keeps partial results
+func TestJobCancel(t *testing.T) {
+	registry := useJobs(t, 5)
+
+	// Hold the slow lane so the job can't start its first chunk
+	savedSlow := slowLane
+	slowLane = newLane(laneSlow, 1)
+	t.Cleanup(func() { slowLane = savedSlow })
+	release := make(chan struct{})
+	go slowLane.Do(context.Background(), func() { <-release })
+	for slowLane.InUse() == 0 {
+		time.Sleep(time.Millisecond)
+	}
+
+	id := registry.Start(strings.Split(pasteList(3*jobChunkSize), "\n"), verify.Options{Checks: verify.DefaultChecks})
+
+	req := httptest.NewRequest(http.MethodPost, "/api/jobs/"+id+"/cancel", nil)
+	req.SetPathValue("id", id)
+	rec := httptest.NewRecorder()
+	jobCancelHandler(rec, req)
+	close(release)
+	registry.Wait()
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d", rec.Code)
+	}
+	view, _ := registry.Get(id, firstPage)
+	if view.Status != jobCancelled || view.FinishedAt == nil {
+		t.Errorf("Expected a finished cancelled job, got %+v", view)
+	}
+	if view.Completed >= view.Total {
+		t.Errorf("Expected cancelled job to stop early, got %d of %d", view.Completed, view.Total)
+	}
+}
+
+// TestJobSweep tests that finished jobs expire and running ones are kept
+func TestJobSweep(t *testing.T) {
+	registry := newJobRegistry()
+	now := time.Now()
+	registry.jobs["old"] = &listJob{id: "old", status: jobDone, finishedAt: now.Add(-2 * time.Hour)}
+	registry.jobs["recent"] = &listJob{id: "recent", status: jobDone, finishedAt: now.Add(-time.Minute)}
+	registry.jobs["running"] = &listJob{id: "running", status: jobRunning}
+
+	if n := registry.Sweep(now, time.Hour); n != 1 {
+		t.Errorf("Expected 1 eviction, got %d", n)
+	}
+	if _, ok := registry.Get("old", firstPage); ok {
+		t.Error("Expected old job to be swept")
+	}
+	if _, ok := registry.Get("running", firstPage); !ok {
+		t.Error("Expected running job to be kept")
+	}
+}
+
+// TestJobWorkers tests that chunks verified at once are still published in paste order, with counts and progress
+func TestJobWorkers(t *testing.T) {
+	registry := useJobs(t, 5)
+	saved := jobWorkers
+	jobWorkers = 3
+	t.Cleanup(func() { jobWorkers = saved })
+
+	emails := strings.Split(pasteList(4*jobChunkSize+7), "\n")
+	emails[1] = "not-an-address"
+	id := registry.Start(emails, verify.Options{Checks: verify.DefaultChecks})
+	registry.Wait()
+
+	view, _ := registry.Get(id, pageRequest{limit: maxPageLimit})
+	if view.Status != jobDone || view.Completed != len(emails) || view.ProgressPercent != 100 {
+		t.Fatalf("Expected a finished job at 100%%, got %s %d/%d at %v", view.Status, view.Completed, view.Total, view.ProgressPercent)
+	}
+	for i, result := range view.Results {
+		if result.Email != emails[i] {
+			t.Fatalf("Expected %s at %d, got %s", emails[i], i, result.Email)
+		}
+	}
+	total := 0
+	for _, n := range view.Counts {
+		total += n
+	}
+	if total != len(emails) || view.Counts[verify.VerdictInvalid] != 1 {
+		t.Errorf("Expected counts of every result with one invalid, got %v", view.Counts)
+	}
+
+	get := func(method, path string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, nil)
+		req.SetPathValue("id", id)
+		rec := httptest.NewRecorder()
+		if strings.Contains(path, "/results") {
+			jobResultsHandler(rec, req)
+		} else {
+			jobHandler(rec, req)
+		}
+		return rec
+	}
+	var page jobResultsPage
+	rec := get(http.MethodGet, "/api/jobs/"+id+"/results?limit=200")
+	json.Unmarshal(rec.Body.Bytes(), &page)
+	if rec.Code != http.StatusOK || len(page.Results) != 200 || page.NextCursor == "" {
+		t.Fatalf("Expected a page of 200 results, got %d %d %q", rec.Code, len(page.Results), page.NextCursor)
+	}
+	rec = get(http.MethodGet, "/api/jobs/"+id+"/results?cursor="+page.NextCursor)
+	page = jobResultsPage{}
+	json.Unmarshal(rec.Body.Bytes(), &page)
+	if len(page.Results) != 7 || page.Results[0].Email != emails[200] || page.NextCursor != "" {
+		t.Errorf("Expected the last 7 results, got %d starting %s", len(page.Results), page.Results[0].Email)
+	}
+
+	if rec := get(http.MethodDelete, "/api/jobs/"+id); rec.Code != http.StatusOK || !strings.Contains(rec.Body.String(), `"status":"done"`) {
+		t.Errorf("Expected DELETE to leave a finished job done, got %d %s", rec.Code, rec.Body)
+	}
+}
+
+// TestSubmitJobCSV tests that a CSV upload becomes a job over its email column, in file order
+func TestSubmitJobCSV(t *testing.T) {
+	registry := useJobs(t, 5)
+	upload := "--upload\r\nContent-Disposition: form-data; name=\"checks\"\r\n\r\nsyntax\r\n" +
+		"--upload\r\nContent-Disposition: form-data; name=\"file\"; filename=\"list.csv\"\r\nContent-Type: text/csv\r\n\r\n" +
+		"name,email\r\nJane,jane@example.com\r\nShort\r\nBob,bob@example.com\r\n" +
+		"--upload--\r\n"
+	req := httptest.NewRequest(http.MethodPost, "/api/jobs", strings.NewReader(upload))
+	req.Header.Set("Content-Type", "multipart/form-data; boundary=upload")
+	rec := httptest.NewRecorder()
+	submitJobHandler(rec, req)
+	if rec.Code != http.StatusAccepted {
+		t.Fatalf("Expected status 202, got %d: %s", rec.Code, rec.Body)
+	}
+	var started jobView
+	json.Unmarshal(rec.Body.Bytes(), &started)
+	registry.Wait()
+
+	view, _ := registry.Get(started.ID, firstPage)
+	if view.Total != 3 || len(view.Results) != 3 || view.Results[0].Email != "jane@example.com" || view.Results[2].Email != "bob@example.com" {
+		t.Fatalf("Expected the three rows in order, got %+v", view)
+	}
+	if view.Results[1].ErrorCode != verify.ErrCodeEmailRequired {
+		t.Errorf("Expected the row without an address to keep its place, got %+v", view.Results[1])
+	}
+	if got := view.Results[0].ChecksPerformed; len(got) != 1 || got[0] != verify.CheckSyntax {
+		t.Errorf("Expected only the syntax check from the form, got %v", got)
+	}
+}
+
+// TestJobRetriesDeferred tests that a job verifies its deferred results once more before finishing, within the retry cap
+func TestJobRetriesDeferred(t *testing.T) {
+	registry := useJobs(t, 5)
+	fake := verifytest.NewResolver()
+	fake.MX["greylist.mock"] = []*net.MX{{Host: "mx.greylist.mock.", Pref: 10}}
+	var mu sync.Mutex
+	seen := make(map[string]int)
+	useService(t, verify.Config{Resolver: fake, Polite: verify.PoliteConfig{Off: true}, Prober: func(ctx context.Context, profile, domain, username string, catchAll bool) (*emailverifier.SMTP, error) {
+		mu.Lock()
+		defer mu.Unlock()
+		if seen[username]++; username != "" && seen[username] == 1 {
+			return &emailverifier.SMTP{HostExists: true}, emailverifier.ParseSMTPError(errors.New("451 4.7.1 Greylisted, try again later"))
+		}
+		return &emailverifier.SMTP{HostExists: true, Deliverable: true}, nil
+	}})
+	savedDelay, savedLimit := jobRetryDelay, maxPendingRetries
+	jobRetryDelay, maxPendingRetries = 100*time.Millisecond, 2
+	t.Cleanup(func() { jobRetryDelay, maxPendingRetries = savedDelay, savedLimit })
+
+	emails := []string{"a@greylist.mock", "b@greylist.mock", "not-an-address", "c@greylist.mock"}
+	id := registry.Start(emails, verify.Options{Checks: verify.MustParseChecks(verify.CheckSMTP)})
+	for deadline := time.Now().Add(time.Second); ; time.Sleep(time.Millisecond) {
+		view, _ := registry.Get(id, firstPage)
+		if view.RetryPending == 2 && view.Status == jobRunning {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("Expected the job held open for 2 retries, got %s with %d", view.Status, view.RetryPending)
+		}
+	}
+	registry.Wait()
+
+	view, _ := registry.Get(id, pageRequest{limit: maxPageLimit})
+	if view.Status != jobDone || view.RetryPending != 0 || len(view.Results) != len(emails) {
+		t.Fatalf("Expected a finished job, got %+v", view)
+	}
+	for i, deferred := range []bool{false, false, false, true} {
+		if result := view.Results[i]; result.Deferred != deferred || result.Email != emails[i] {
+			t.Errorf("Expected %s deferred=%v, got %+v", emails[i], deferred, result)
+		}
+	}
+	if view.Counts[verify.VerdictDeliverable] != 2 || view.Counts[verify.VerdictUnknown] != 1 {
+		t.Errorf("Expected counts to follow the retried results, got %v", view.Counts)
+	}
+	if n := pendingRetries.Load(); n != 0 {
+		t.Errorf("Expected the retry slots returned, got %d pending", n)
+	}
+}
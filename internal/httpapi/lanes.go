@@ -0,0 +1,115 @@
+package httpapi
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"email-verifier/pkg/verify"
+)
+
+// Lane names, as reported in metrics.
+const (
+	laneFast = "fast"
+	laneSlow = "slow"
+	laneSMTP = "smtp"
+)
+
+// modeFast restricts a request to checks that need no network.
+const modeFast = "fast"
+
+var errLaneBusy = errors.New("lane is at capacity")
+
+var laneLatency = metrics.HistogramVec("lane_latency_seconds", "Verification latency per lane, including time spent waiting for a slot.", "lane")
+
+// lane caps how many verifications of one kind run at once. Requests that
+// need no network go through the fast lane so a backlog of slow SMTP and DNS
+// probes never queues them. Verifications that probe mail servers have a
+// lane of their own, kept small so a burst of them doesn't open more
+// connections than mail providers put up with.
+type lane struct {
+	name  string
+	slots chan struct{}
+}
+
+func newLane(name string, size int) *lane {
+	return &lane{name: name, slots: make(chan struct{}, size)}
+}
+
+var (
+	fastLane = newLane(laneFast, 64)
+	slowLane = newLane(laneSlow, 32)
+	smtpLane = newLane(laneSMTP, 10)
+
+	// laneWait bounds how long a request waits for a slot, and smtpWait
+	// how long it waits for an SMTP lane slot.
+	laneWait = 10 * time.Second
+	smtpWait = 5 * time.Second
+)
+
+// Do runs fn on the caller's goroutine once a slot is free. It gives up with
+// errLaneBusy if ctx ends first.
+func (l *lane) Do(ctx context.Context, fn func()) error {
+	start := time.Now()
+	select {
+	case l.slots <- struct{}{}:
+	case <-ctx.Done():
+		return errLaneBusy
+	}
+	defer func() { <-l.slots }()
+
+	fn()
+	laneLatency.Observe(l.name, time.Since(start))
+	return nil
+}
+
+// InUse returns the number of occupied slots.
+func (l *lane) InUse() int { return len(l.slots) }
+
+// laneFor picks the lane for a resolved set of checks.
+func laneFor(checks verify.CheckSet) *lane {
+	switch {
+	case checks.Has(verify.CheckSMTP):
+		return smtpLane
+	case checks.NeedsNetwork():
+		return slowLane
+	}
+	return fastLane
+}
+
+// waitFor returns how long a request waits for one of l's slots.
+func waitFor(l *lane) time.Duration {
+	if l.name == laneSMTP {
+		return smtpWait
+	}
+	return laneWait
+}
+
+// writeLaneBusy answers a request that got no slot in l within waitFor.
+// A full SMTP lane is the limit on probes doing its job, so the caller is
+// asked to slow down with 429 and to come back once a queue's worth of
+// probes could have finished; the other lanes are only full when the
+// server is.
+func writeLaneBusy(w http.ResponseWriter, l *lane) {
+	if l.name == laneSMTP {
+		w.Header().Set("Retry-After", strconv.Itoa(max(1, int(smtpWait/time.Second))))
+		http.Error(w, "Too many SMTP verifications in progress, try again shortly", http.StatusTooManyRequests)
+		return
+	}
+	w.Header().Set("Retry-After", "1")
+	http.Error(w, "Server busy, try again shortly", http.StatusServiceUnavailable)
+}
+
+func init() {
+	metrics.GaugeFunc("fast_lane_in_use", "Occupied fast lane slots.", func() int64 {
+		return int64(fastLane.InUse())
+	})
+	metrics.GaugeFunc("slow_lane_in_use", "Occupied slow lane slots.", func() int64 {
+		return int64(slowLane.InUse())
+	})
+	metrics.GaugeFunc("smtp_lane_in_use", "Occupied SMTP lane slots.", func() int64 {
+		return int64(smtpLane.InUse())
+	})
+}
@@ -0,0 +1,200 @@
+package httpapi
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"email-verifier/pkg/verify"
+	"email-verifier/pkg/verify/verifytest"
+)
+
+// slowResolver answers like verifytest.Resolver but takes delay for every MX lookup
+type slowResolver struct {
+	*verifytest.Resolver
+	delay time.Duration
+}
+
+func (s *slowResolver) LookupMX(ctx context.Context, name string) ([]*net.MX, error) {
+	time.Sleep(s.delay)
+	return s.Resolver.LookupMX(ctx, name)
+}
+
+// TestLaneFor tests that lanes are picked from the resolved checks
+func TestLaneFor(t *testing.T) {
+	if got := laneFor(verify.MustParseChecks(verify.CheckSMTP)); got != smtpLane {
+		t.Errorf("Expected SMTP checks on the SMTP lane, got %s", got.name)
+	}
+	if got := laneFor(verify.DefaultChecks); got != slowLane {
+		t.Errorf("Expected default checks on the slow lane, got %s", got.name)
+	}
+	if got := laneFor(verify.DefaultChecks.WithoutNetwork()); got != fastLane {
+		t.Errorf("Expected local checks on the fast lane, got %s", got.name)
+	}
+	if got := laneFor(verify.MustParseChecks(verify.CheckFree, verify.CheckRole)); got != fastLane {
+		t.Errorf("Expected list checks on the fast lane, got %s", got.name)
+	}
+}
+
+// TestLaneBusy tests that a full lane gives up when the context ends
+func TestLaneBusy(t *testing.T) {
+	l := newLane("test", 1)
+	release := make(chan struct{})
+	go l.Do(context.Background(), func() { <-release })
+	for l.InUse() == 0 {
+		time.Sleep(time.Millisecond)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if err := l.Do(ctx, func() {}); err != errLaneBusy {
+		t.Errorf("Expected errLaneBusy, got %v", err)
+	}
+	close(release)
+}
+
+// TestSMTPLaneLimit tests that probes beyond the SMTP lane get 429 once the wait is up while MX-only requests carry on
+func TestSMTPLaneLimit(t *testing.T) {
+	smtp := useStreamService(t)
+	smtp.Delay = 300 * time.Millisecond
+	savedLane, savedWait := smtpLane, smtpWait
+	smtpLane, smtpWait = newLane(laneSMTP, 2), 20*time.Millisecond
+	t.Cleanup(func() { smtpLane, smtpWait = savedLane, savedWait })
+
+	codes := make([]int, 6)
+	var wg sync.WaitGroup
+	for i := range codes {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			rec := postVerify(t, "", fmt.Sprintf(`{"email": "user%d@partner.mock", "checks": "smtp"}`, i))
+			codes[i] = rec.Code
+			if rec.Code == http.StatusTooManyRequests && rec.Header().Get("Retry-After") != "1" {
+				t.Errorf("Expected Retry-After with the 429, got %q", rec.Header().Get("Retry-After"))
+			}
+		}(i)
+	}
+	for smtpLane.InUse() < 2 {
+		time.Sleep(time.Millisecond)
+	}
+	start := time.Now()
+	if rec := postVerify(t, "", `{"email": "jane@partner.mock", "checks": "mx"}`); rec.Code != http.StatusOK || time.Since(start) > smtp.Delay/2 {
+		t.Errorf("Expected an MX-only request to skip the SMTP queue, got %d after %v", rec.Code, time.Since(start))
+	}
+	wg.Wait()
+
+	counts := map[int]int{}
+	for _, code := range codes {
+		counts[code]++
+	}
+	if counts[http.StatusOK] != 2 || counts[http.StatusTooManyRequests] != 4 {
+		t.Errorf("Expected 2 probes to run and 4 to get 429, got %v", counts)
+	}
+	if n := smtp.Probes(); n != 2 {
+		t.Errorf("Expected 2 probes, got %d", n)
+	}
+}
+
+// TestFastLaneUnderSlowLaneSaturation tests that syntax-only requests stay fast while probes queue up
+func TestFastLaneUnderSlowLaneSaturation(t *testing.T) {
+	fake := verifytest.NewResolver()
+	fake.MX["example.com"] = []*net.MX{{Host: "mx.example.com.", Pref: 10}}
+	slow := &slowResolver{Resolver: fake, delay: 500 * time.Millisecond}
+	useService(t, verify.Config{Resolver: slow})
+
+	savedFast, savedSlow := fastLane, slowLane
+	fastLane, slowLane = newLane(laneFast, 4), newLane(laneSlow, 2)
+	t.Cleanup(func() { fastLane, slowLane = savedFast, savedSlow })
+
+	post := func(body string) int {
+		rec := httptest.NewRecorder()
+		apiVerifyHandler(rec, httptest.NewRequest(http.MethodPost, "/api/verify", strings.NewReader(body)))
+		return rec.Code
+	}
+
+	// Saturate the slow lane with far more probes than it has slots
+	stop := make(chan struct{})
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				select {
+				case <-stop:
+					return
+				default:
+				}
+				post(`{"email":"jane@example.com"}`)
+			}
+		}()
+	}
+	for slowLane.InUse() < 2 {
+		time.Sleep(time.Millisecond)
+	}
+
+	latencies := make([]time.Duration, 0, 100)
+	for i := 0; i < 100; i++ {
+		start := time.Now()
+		if code := post(`{"email":"jane@example.com","mode":"fast"}`); code != http.StatusOK {
+			t.Fatalf("Expected status 200 on the fast lane, got %d", code)
+		}
+		latencies = append(latencies, time.Since(start))
+	}
+	close(stop)
+	wg.Wait()
+
+	sort.Slice(latencies, func(i, j int) bool { return latencies[i] < latencies[j] })
+	// Anything that waited behind a probe would take at least one full probe
+	p99 := latencies[len(latencies)*99/100]
+	if p99 > slow.delay/2 {
+		t.Errorf("Expected fast lane p99 under %v while the slow lane is saturated, got %v", slow.delay/2, p99)
+	}
+	if laneLatency.Count(laneFast) == 0 || laneLatency.Count(laneSlow) == 0 {
+		t.Error("Expected latency observations for both lanes")
+	}
+}
+
+// useFullLanes swaps in slow and SMTP lanes with their only slot taken and a short wait
+func useFullLanes(t *testing.T) {
+	t.Helper()
+	savedSlow, savedSMTP, savedWait, savedSMTPWait := slowLane, smtpLane, laneWait, smtpWait
+	slowLane, smtpLane = newLane(laneSlow, 1), newLane(laneSMTP, 1)
+	laneWait, smtpWait = 10*time.Millisecond, 10*time.Millisecond
+	release := make(chan struct{})
+	for _, l := range []*lane{slowLane, smtpLane} {
+		go l.Do(context.Background(), func() { <-release })
+		for l.InUse() == 0 {
+			time.Sleep(time.Millisecond)
+		}
+	}
+	t.Cleanup(func() {
+		close(release)
+		slowLane, smtpLane, laneWait, smtpWait = savedSlow, savedSMTP, savedWait, savedSMTPWait
+	})
+}
+
+// TestWebFormLanes tests that single and pasted web form verifications wait for a lane slot
+func TestWebFormLanes(t *testing.T) {
+	useService(t, verify.Config{Resolver: verifytest.NewResolver()})
+	useFullLanes(t)
+
+	for _, input := range []string{"jane@example.com", "jane@example.com\njohn@example.com"} {
+		form := url.Values{"email": {input}}
+		req := httptest.NewRequest(http.MethodPost, "/verify", strings.NewReader(form.Encode()))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		rec := httptest.NewRecorder()
+		verifyHandler(rec, req)
+		if rec.Code != http.StatusServiceUnavailable {
+			t.Errorf("Expected 503 for %q with the slow lane full, got %d", input, rec.Code)
+		}
+	}
+}
@@ -0,0 +1,435 @@
+package httpapi
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"runtime"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"email-verifier/pkg/verify"
+)
+
+const metricsNamespace = "email_verifier_"
+
+// gauge is a value that can go up and down. Gauges created with GaugeFunc
+// are computed on read instead.
+type gauge struct {
+	name  string
+	help  string
+	value atomic.Int64
+	fn    func() int64
+}
+
+func (g *gauge) Inc() { g.value.Add(1) }
+func (g *gauge) Dec() { g.value.Add(-1) }
+
+func (g *gauge) Value() int64 {
+	if g.fn != nil {
+		return g.fn()
+	}
+	return g.value.Load()
+}
+
+// counterVec is a set of monotonically increasing counters split by one label.
+type counterVec struct {
+	name   string
+	help   string
+	label  string
+	mu     sync.Mutex
+	values map[string]int64
+}
+
+func (c *counterVec) Add(labelValue string, n int64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.values[labelValue] += n
+}
+
+func (c *counterVec) Value(labelValue string) int64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.values[labelValue]
+}
+
+func (c *counterVec) snapshot() map[string]int64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	values := make(map[string]int64, len(c.values))
+	for k, v := range c.values {
+		values[k] = v
+	}
+	return values
+}
+
+// latencyBuckets are the histogram upper bounds, in seconds.
+var latencyBuckets = []float64{0.001, 0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30}
+
+// histogramVec is a set of latency histograms split by one label.
+type histogramVec struct {
+	name   string
+	help   string
+	label  string
+	mu     sync.Mutex
+	values map[string]*histogramValues
+}
+
+type histogramValues struct {
+	counts []int64 // per bucket, not cumulative
+	sum    float64
+	count  int64
+}
+
+// Observe records one duration.
+func (h *histogramVec) Observe(labelValue string, d time.Duration) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	v, ok := h.values[labelValue]
+	if !ok {
+		v = &histogramValues{counts: make([]int64, len(latencyBuckets))}
+		h.values[labelValue] = v
+	}
+	seconds := d.Seconds()
+	for i, bound := range latencyBuckets {
+		if seconds <= bound {
+			v.counts[i]++
+			break
+		}
+	}
+	v.sum += seconds
+	v.count++
+}
+
+// Count returns how many durations were observed for labelValue.
+func (h *histogramVec) Count(labelValue string) int64 {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if v, ok := h.values[labelValue]; ok {
+		return v.count
+	}
+	return 0
+}
+
+func (h *histogramVec) writePrometheus(w io.Writer) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	fmt.Fprintf(w, "# HELP %s%s %s\n", metricsNamespace, h.name, h.help)
+	fmt.Fprintf(w, "# TYPE %s%s histogram\n", metricsNamespace, h.name)
+	labels := make([]string, 0, len(h.values))
+	for label := range h.values {
+		labels = append(labels, label)
+	}
+	sort.Strings(labels)
+	for _, label := range labels {
+		v := h.values[label]
+		var cumulative int64
+		for i, bound := range latencyBuckets {
+			cumulative += v.counts[i]
+			fmt.Fprintf(w, "%s%s_bucket{%s=%q,le=%q} %d\n", metricsNamespace, h.name, h.label, label, strconv.FormatFloat(bound, 'g', -1, 64), cumulative)
+		}
+		fmt.Fprintf(w, "%s%s_bucket{%s=%q,le=\"+Inf\"} %d\n", metricsNamespace, h.name, h.label, label, v.count)
+		fmt.Fprintf(w, "%s%s_sum{%s=%q} %g\n", metricsNamespace, h.name, h.label, label, v.sum)
+		fmt.Fprintf(w, "%s%s_count{%s=%q} %d\n", metricsNamespace, h.name, h.label, label, v.count)
+	}
+}
+
+// metricsRegistry holds the process-wide health metrics.
+type metricsRegistry struct {
+	mu         sync.Mutex
+	gauges     map[string]*gauge
+	counters   map[string]*counterVec
+	histograms map[string]*histogramVec
+}
+
+func newMetricsRegistry() *metricsRegistry {
+	return &metricsRegistry{
+		gauges:     make(map[string]*gauge),
+		counters:   make(map[string]*counterVec),
+		histograms: make(map[string]*histogramVec),
+	}
+}
+
+// HistogramVec returns the named latency histogram set, creating it on first use.
+func (m *metricsRegistry) HistogramVec(name, help, label string) *histogramVec {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if h, ok := m.histograms[name]; ok {
+		return h
+	}
+	h := &histogramVec{name: name, help: help, label: label, values: make(map[string]*histogramValues)}
+	m.histograms[name] = h
+	return h
+}
+
+// CounterVec returns the named counter set, creating it on first use.
+func (m *metricsRegistry) CounterVec(name, help, label string) *counterVec {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if c, ok := m.counters[name]; ok {
+		return c
+	}
+	c := &counterVec{name: name, help: help, label: label, values: make(map[string]int64)}
+	m.counters[name] = c
+	return c
+}
+
+// CounterSnapshot returns every counter's values keyed by label value.
+func (m *metricsRegistry) CounterSnapshot() map[string]map[string]int64 {
+	m.mu.Lock()
+	counters := make([]*counterVec, 0, len(m.counters))
+	for _, c := range m.counters {
+		counters = append(counters, c)
+	}
+	m.mu.Unlock()
+
+	values := make(map[string]map[string]int64, len(counters))
+	for _, c := range counters {
+		values[c.name] = c.snapshot()
+	}
+	return values
+}
+
+// Gauge returns the named gauge, creating it on first use.
+func (m *metricsRegistry) Gauge(name, help string) *gauge {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if g, ok := m.gauges[name]; ok {
+		return g
+	}
+	g := &gauge{name: name, help: help}
+	m.gauges[name] = g
+	return g
+}
+
+// GaugeFunc registers a gauge whose value is read from fn.
+func (m *metricsRegistry) GaugeFunc(name, help string, fn func() int64) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.gauges[name] = &gauge{name: name, help: help, fn: fn}
+}
+
+// Snapshot returns the current value of every gauge.
+func (m *metricsRegistry) Snapshot() map[string]int64 {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	values := make(map[string]int64, len(m.gauges))
+	for name, g := range m.gauges {
+		values[name] = g.Value()
+	}
+	return values
+}
+
+// WritePrometheus writes all metrics in the Prometheus text format.
+func (m *metricsRegistry) WritePrometheus(w io.Writer) {
+	m.mu.Lock()
+	names := make([]string, 0, len(m.gauges))
+	for name := range m.gauges {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	gauges := make([]*gauge, len(names))
+	for i, name := range names {
+		gauges[i] = m.gauges[name]
+	}
+	names = names[:0]
+	for name := range m.counters {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	counters := make([]*counterVec, len(names))
+	for i, name := range names {
+		counters[i] = m.counters[name]
+	}
+	names = names[:0]
+	for name := range m.histograms {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	histograms := make([]*histogramVec, len(names))
+	for i, name := range names {
+		histograms[i] = m.histograms[name]
+	}
+	m.mu.Unlock()
+
+	for _, g := range gauges {
+		fmt.Fprintf(w, "# HELP %s%s %s\n", metricsNamespace, g.name, g.help)
+		fmt.Fprintf(w, "# TYPE %s%s gauge\n", metricsNamespace, g.name)
+		fmt.Fprintf(w, "%s%s %d\n", metricsNamespace, g.name, g.Value())
+	}
+	for _, c := range counters {
+		fmt.Fprintf(w, "# HELP %s%s %s\n", metricsNamespace, c.name, c.help)
+		fmt.Fprintf(w, "# TYPE %s%s counter\n", metricsNamespace, c.name)
+		values := c.snapshot()
+		labels := make([]string, 0, len(values))
+		for label := range values {
+			labels = append(labels, label)
+		}
+		sort.Strings(labels)
+		for _, label := range labels {
+			fmt.Fprintf(w, "%s%s{%s=%q} %d\n", metricsNamespace, c.name, c.label, label, values[label])
+		}
+	}
+	for _, h := range histograms {
+		h.writePrometheus(w)
+	}
+}
+
+// ExceededBounds returns a description of every gauge above its bound.
+func (m *metricsRegistry) ExceededBounds(bounds map[string]int64) []string {
+	values := m.Snapshot()
+	var exceeded []string
+	for name, max := range bounds {
+		if value, ok := values[name]; ok && value > max {
+			exceeded = append(exceeded, fmt.Sprintf("%s=%d (bound %d)", name, value, max))
+		}
+	}
+	sort.Strings(exceeded)
+	return exceeded
+}
+
+// CheckBounds logs a warning if any gauge exceeds its bound.
+func (m *metricsRegistry) CheckBounds(bounds map[string]int64) {
+	if exceeded := m.ExceededBounds(bounds); len(exceeded) > 0 {
+		log.Printf("WARNING: possible leak, gauges above bounds: %s", strings.Join(exceeded, ", "))
+	}
+}
+
+// parseGaugeBounds parses "name=max,name=max" into a bounds map.
+func parseGaugeBounds(s string) (map[string]int64, error) {
+	bounds := make(map[string]int64)
+	for _, part := range strings.Split(s, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		name, value, ok := strings.Cut(part, "=")
+		if !ok {
+			return nil, fmt.Errorf("invalid gauge bound %q, want name=max", part)
+		}
+		max, err := strconv.ParseInt(strings.TrimSpace(value), 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid gauge bound %q: %v", part, err)
+		}
+		bounds[strings.TrimSpace(name)] = max
+	}
+	return bounds, nil
+}
+
+var (
+	metrics = newMetricsRegistry()
+
+	watchChecksInFlight = metrics.Gauge("watch_checks_in_flight", "Domain watch checks currently running.")
+
+	verificationVerdicts  = metrics.CounterVec("verifications_total", "Verifications answered to callers, by verdict.", "verdict")
+	verificationDurations = metrics.HistogramVec("verification_duration_seconds", "End-to-end duration of single verifications, by handler.", "handler")
+	smtpProbeDurations    = metrics.HistogramVec("smtp_probe_duration_seconds", "Duration of SMTP probes, by outcome: ok or the error code.", "outcome")
+	smtpRetries           = metrics.CounterVec("smtp_retries_total", "SMTP probes retried after a transient failure, by reason.", "reason")
+	dnsCacheLookups       = metrics.CounterVec("dns_cache_lookups_total", "DNS lookups through the DNS cache, by result: hit or miss.", "result")
+)
+
+// ObserveProbe records an SMTP probe in smtp_probe_duration_seconds; pass
+// it as verify.Config.ProbeObserver.
+func ObserveProbe(d time.Duration, err error) {
+	outcome := "ok"
+	if err != nil {
+		outcome = verify.ErrorCodeFor(err)
+	}
+	smtpProbeDurations.Observe(outcome, d)
+}
+
+// ObserveRetry counts an SMTP probe retry in smtp_retries_total; pass it
+// as verify.Config.RetryObserver.
+func ObserveRetry(reason string) { smtpRetries.Add(reason, 1) }
+
+// ObserveDNSCache counts a DNS cache lookup in dns_cache_lookups_total;
+// pass it as verify.Config.DNSCacheObserver.
+func ObserveDNSCache(hit bool) {
+	if hit {
+		dnsCacheLookups.Add("hit", 1)
+	} else {
+		dnsCacheLookups.Add("miss", 1)
+	}
+}
+
+func init() {
+	metrics.GaugeFunc("goroutines", "Live goroutines in the process.", func() int64 {
+		return int64(runtime.NumGoroutine())
+	})
+	metrics.GaugeFunc("verifications_in_flight", "Verifications currently running.", func() int64 {
+		if service == nil {
+			return 0
+		}
+		return service.InFlight()
+	})
+	metrics.GaugeFunc("network_disabled", "1 while the network kill-switch is engaged.", func() int64 {
+		if service == nil || !service.NetworkDisabled() {
+			return 0
+		}
+		return 1
+	})
+	metrics.GaugeFunc("smtp_outbound_blocked", "1 while the startup self-test found outbound port 25 blocked.", func() int64 {
+		if service == nil || !service.SMTPOutboundBlocked() {
+			return 0
+		}
+		return 1
+	})
+	metrics.GaugeFunc("smtp_circuits_open", "Domains whose SMTP circuit is open.", func() int64 {
+		if service == nil {
+			return 0
+		}
+		return int64(len(service.OpenCircuits()))
+	})
+	metrics.GaugeFunc("watches", "Registered domain watches.", func() int64 {
+		return int64(watches.Len())
+	})
+	metrics.GaugeFunc("watch_changes", "Recorded watch changes across all watches.", func() int64 {
+		return int64(watches.ChangeCount())
+	})
+	metrics.GaugeFunc("list_jobs", "List jobs held for the web UI, running or finished.", func() int64 {
+		return int64(jobs.Len())
+	})
+	metrics.GaugeFunc("batch_plans", "Dry-run batch plans waiting to be executed.", func() int64 {
+		return int64(plans.Len())
+	})
+	metrics.GaugeFunc("forward_pending", "Results queued for forwarding across all API keys.", func() int64 {
+		return int64(forwarder.Len())
+	})
+	metrics.GaugeFunc("history_entries", "Past results kept in history.", func() int64 {
+		if history == nil {
+			return 0
+		}
+		return int64(history.Len())
+	})
+}
+
+var startedAt = time.Now()
+
+func metricsHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+	metrics.WritePrometheus(w)
+}
+
+func adminStateHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"started_at": startedAt.UTC(),
+		"gauges":     metrics.Snapshot(),
+		"counters":   metrics.CounterSnapshot(),
+		"janitor":    housekeeping.Status(),
+		"scheduler":  background.Status(),
+		"network":    networkState(),
+		"alerts":     alerts.Status(),
+		"prewarm":    prewarm.State(),
+		"domain_cache": map[string]interface{}{
+			"enabled": service.DomainCacheEnabled(),
+			"domains": service.DomainCacheLen(),
+		},
+	})
+}
@@ -0,0 +1,187 @@
+package httpapi
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"runtime"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"email-verifier/pkg/verify"
+	"email-verifier/pkg/verify/verifytest"
+)
+
+// TestGaugesReturnToBaseline tests that a burst of work leaves no gauges or goroutines behind
+func TestGaugesReturnToBaseline(t *testing.T) {
+	useService(t, verify.Config{Resolver: verifytest.NewResolver()})
+
+	registry := newWatchRegistry(nil, 0, time.Minute)
+	for i := 0; i < 20; i++ {
+		if _, err := registry.Add("burst", fmt.Sprintf("domain%d.com", i), time.Hour); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	before := metrics.Snapshot()
+	goroutinesBefore := runtime.NumGoroutine()
+
+	var wg sync.WaitGroup
+	for i := 0; i < 50; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			service.Verify(fmt.Sprintf("user%d@invalid", i), verify.Options{Checks: verify.DefaultChecks})
+		}(i)
+	}
+	registry.now = func() time.Time { return time.Now().Add(2 * time.Hour) }
+	for i := 0; i < 5; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			registry.checkDue(context.Background())
+		}()
+	}
+	wg.Wait()
+
+	after := metrics.Snapshot()
+	for _, name := range []string{"verifications_in_flight", "watch_checks_in_flight"} {
+		if after[name] != before[name] {
+			t.Errorf("Gauge %s did not return to baseline: before %d, after %d", name, before[name], after[name])
+		}
+	}
+
+	// Goroutines from the burst may take a moment to be reaped.
+	deadline := time.Now().Add(2 * time.Second)
+	for runtime.NumGoroutine() > goroutinesBefore && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if n := runtime.NumGoroutine(); n > goroutinesBefore {
+		t.Errorf("Goroutines leaked: before %d, after %d", goroutinesBefore, n)
+	}
+}
+
+// TestExceededBounds tests leak detection against configured bounds
+func TestExceededBounds(t *testing.T) {
+	registry := newMetricsRegistry()
+	queued := registry.Gauge("queued", "Queued items.")
+	for i := 0; i < 3; i++ {
+		queued.Inc()
+	}
+
+	bounds, err := parseGaugeBounds("queued=2, missing=1")
+	if err != nil {
+		t.Fatalf("Failed to parse bounds: %v", err)
+	}
+	exceeded := registry.ExceededBounds(bounds)
+	if len(exceeded) != 1 || !strings.HasPrefix(exceeded[0], "queued=3") {
+		t.Errorf("Expected queued to exceed its bound, got %v", exceeded)
+	}
+
+	queued.Dec()
+	if exceeded := registry.ExceededBounds(bounds); len(exceeded) != 0 {
+		t.Errorf("Expected no exceeded bounds, got %v", exceeded)
+	}
+
+	if _, err := parseGaugeBounds("queued"); err == nil {
+		t.Error("Expected error for bound without a value")
+	}
+}
+
+// TestMetricsEndpoint tests the Prometheus text output
+func TestMetricsEndpoint(t *testing.T) {
+	rec := httptest.NewRecorder()
+	metricsHandler(rec, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+
+	body := rec.Body.String()
+	for _, want := range []string{
+		"# TYPE email_verifier_verifications_in_flight gauge",
+		"email_verifier_goroutines ",
+		"email_verifier_watches ",
+	} {
+		if !strings.Contains(body, want) {
+			t.Errorf("Expected metrics output to contain %q", want)
+		}
+	}
+}
+
+// scrapeMetrics fetches /metrics through the router and returns each sample by its name and labels
+func scrapeMetrics(t *testing.T) map[string]float64 {
+	t.Helper()
+	rec := httptest.NewRecorder()
+	Handler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	samples := make(map[string]float64)
+	for _, line := range strings.Split(rec.Body.String(), "\n") {
+		name, value, ok := strings.Cut(line, " ")
+		if !ok || strings.HasPrefix(line, "#") {
+			continue
+		}
+		var v float64
+		fmt.Sscan(value, &v)
+		samples[name] = v
+	}
+	return samples
+}
+
+// TestVerificationMetrics tests that a scrape shows verifications counted by verdict and timed end to end and per SMTP probe
+func TestVerificationMetrics(t *testing.T) {
+	fake := verifytest.NewResolver()
+	fake.MX["partner.mock"] = []*net.MX{{Host: "mx.partner.mock.", Pref: 10}}
+	smtp := verifytest.NewSMTP()
+	smtp.Mailboxes["jane@partner.mock"] = true
+	useService(t, verify.Config{Resolver: fake, Prober: smtp.Probe, ProbeObserver: ObserveProbe, Polite: verify.PoliteConfig{Off: true}})
+
+	samples := []string{
+		`email_verifier_verifications_total{verdict="deliverable"}`,
+		`email_verifier_verifications_total{verdict="invalid"}`,
+		`email_verifier_verification_duration_seconds_count{handler="api"}`,
+		`email_verifier_verification_duration_seconds_count{handler="web"}`,
+		`email_verifier_smtp_probe_duration_seconds_count{outcome="ok"}`,
+	}
+	before := scrapeMetrics(t)
+	postVerify(t, "", `{"email": "jane@partner.mock", "checks": "smtp"}`)
+	postVerify(t, "", `{"email": "not-an-address"}`)
+	form := url.Values{"email": {"jane@partner.mock"}}
+	req := httptest.NewRequest(http.MethodPost, "/verify", strings.NewReader(form.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	verifyHandler(httptest.NewRecorder(), req)
+	after := scrapeMetrics(t)
+
+	expected := []float64{1, 1, 2, 1, 1}
+	for i, sample := range samples {
+		if got := after[sample] - before[sample]; got != expected[i] {
+			t.Errorf("Expected %s to grow by %v, got %v", sample, expected[i], got)
+		}
+	}
+	if _, ok := after["email_verifier_verifications_in_flight"]; !ok {
+		t.Error("Expected the in-flight gauge in the scrape")
+	}
+}
+
+// TestObserveRetry tests that SMTP retries are counted by reason
+func TestObserveRetry(t *testing.T) {
+	before := smtpRetries.Value(verify.RetryReply421)
+	ObserveRetry(verify.RetryReply421)
+	if got := smtpRetries.Value(verify.RetryReply421) - before; got != 1 {
+		t.Errorf("Expected one reply_421 retry counted, got %d", got)
+	}
+}
+
+// TestObserveDNSCache tests that DNS cache lookups are counted as hits and misses
+func TestObserveDNSCache(t *testing.T) {
+	hits, misses := dnsCacheLookups.Value("hit"), dnsCacheLookups.Value("miss")
+	ObserveDNSCache(true)
+	ObserveDNSCache(true)
+	ObserveDNSCache(false)
+	if got := dnsCacheLookups.Value("hit") - hits; got != 2 {
+		t.Errorf("Expected two hits counted, got %d", got)
+	}
+	if got := dnsCacheLookups.Value("miss") - misses; got != 1 {
+		t.Errorf("Expected one miss counted, got %d", got)
+	}
+}
@@ -0,0 +1,96 @@
+package httpapi
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"email-verifier/pkg/verify"
+	"email-verifier/pkg/verify/verifytest"
+)
+
+// countDials wraps dialContext so the test can see every outbound connection
+func countDials(t *testing.T) *atomic.Int64 {
+	t.Helper()
+	var dials atomic.Int64
+	saved := dialContext
+	dialContext = func(ctx context.Context, network, addr string) (net.Conn, error) {
+		dials.Add(1)
+		return saved(ctx, network, addr)
+	}
+	t.Cleanup(func() { dialContext = saved })
+	return &dials
+}
+
+// TestNetworkKillSwitch tests that nothing is dialed, looked up or probed while the switch is engaged, and that engaging and releasing it is audit-logged
+func TestNetworkKillSwitch(t *testing.T) {
+	fake := verifytest.NewResolver()
+	smtp := verifytest.NewSMTP()
+	useService(t, verify.Config{Resolver: fake, Prober: smtp.Probe})
+	dials := countDials(t)
+	logs := captureLog(t)
+	handler := Handler()
+
+	receiver := &forwardReceiver{status: http.StatusOK}
+	server := httptest.NewServer(receiver)
+	defer server.Close()
+	f := newResultForwarder(map[string]forwardTarget{"team": {URL: server.URL, Secret: "shh"}})
+	f.Enqueue("team", &verify.Result{Email: "a@example.com"})
+	notify, _ := newNotifier(server.URL)
+
+	post := func(body string) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/admin/network", strings.NewReader(body)))
+		return rec
+	}
+	if rec := post(`{"reason": "missing disabled"}`); rec.Code != http.StatusBadRequest {
+		t.Errorf("Expected status 400 without disabled, got %d", rec.Code)
+	}
+	if rec := post(`{"disabled": true, "reason": "runaway batch"}`); rec.Code != http.StatusOK || !strings.Contains(rec.Body.String(), `"disabled":true`) {
+		t.Fatalf("Expected the switch engaged, got %d: %s", rec.Code, rec.Body.String())
+	}
+
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/api/verify", strings.NewReader(`{"email": "jane@partner.mock", "checks": ["smtp"]}`)))
+	var result verify.Result
+	json.NewDecoder(rec.Body).Decode(&result)
+	if !result.IsValid || !strings.Contains(strings.Join(result.Warnings, ","), verify.WarningNetworkDisabled) {
+		t.Errorf("Expected an offline result with the %s warning, got %+v", verify.WarningNetworkDisabled, result)
+	}
+	f.Flush(context.Background())
+	if err := notify.Notify(context.Background(), notification{Event: "test"}); !errors.Is(err, verify.ErrNetworkDisabled) {
+		t.Errorf("Expected %v from the notifier, got %v", verify.ErrNetworkDisabled, err)
+	}
+	if dials.Load() != 0 || fake.Lookups() != 0 || smtp.Probes() != 0 || len(receiver.batches) != 0 {
+		t.Fatalf("Expected no network use while disabled, got %d dials, %d lookups and %d probes", dials.Load(), fake.Lookups(), smtp.Probes())
+	}
+	if f.Stats()[0].Pending != 1 || f.Stats()[0].Failed != 0 {
+		t.Errorf("Expected the forwarded result kept without a failure, got %+v", f.Stats()[0])
+	}
+
+	for _, path := range []string{"/readyz", "/admin/state", "/metrics"} {
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, path, nil))
+		body := rec.Body.String()
+		if !strings.Contains(body, `"network_disabled":true`) && !strings.Contains(body, `"disabled":true`) && !strings.Contains(body, "network_disabled 1") {
+			t.Errorf("Expected %s to show the engaged switch, got %s", path, body)
+		}
+	}
+
+	post(`{"disabled": false, "reason": "fixed"}`)
+	f.Flush(context.Background())
+	if dials.Load() == 0 || len(receiver.batches) != 1 {
+		t.Errorf("Expected delivery after release, got %d dials and %d batches", dials.Load(), len(receiver.batches))
+	}
+	for _, want := range []string{`network kill-switch engaged by 192.0.2.1:1234: "runaway batch"`, `network kill-switch released by 192.0.2.1:1234: "fixed"`} {
+		if !strings.Contains(logs.String(), "audit: "+want) {
+			t.Errorf("Expected an audit entry %q, got %s", want, logs.String())
+		}
+	}
+}
@@ -0,0 +1,87 @@
+package httpapi
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+// notification is an event worth telling an operator about.
+type notification struct {
+	Event   string      `json:"event"`
+	Subject string      `json:"subject"`
+	Text    string      `json:"text"`
+	Data    interface{} `json:"data,omitempty"`
+}
+
+// notifier delivers notifications to an external system.
+type notifier interface {
+	Notify(ctx context.Context, n notification) error
+}
+
+// newNotifier picks a notifier for the target URL: Slack incoming webhooks get
+// Slack's message format, anything else receives the notification as JSON.
+// An empty URL disables notifications.
+func newNotifier(target string) (notifier, error) {
+	if target == "" {
+		return nil, nil
+	}
+	u, err := url.Parse(target)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") {
+		return nil, fmt.Errorf("invalid notification URL %q", target)
+	}
+	client := newHTTPClient(10 * time.Second)
+	if u.Host == "hooks.slack.com" {
+		return &slackNotifier{url: target, client: client}, nil
+	}
+	return &webhookNotifier{url: target, client: client}, nil
+}
+
+// webhookNotifier POSTs the notification as JSON.
+type webhookNotifier struct {
+	url    string
+	client *http.Client
+}
+
+func (n *webhookNotifier) Notify(ctx context.Context, event notification) error {
+	return postJSON(ctx, n.client, n.url, event)
+}
+
+// slackNotifier posts to a Slack incoming webhook.
+type slackNotifier struct {
+	url    string
+	client *http.Client
+}
+
+func (n *slackNotifier) Notify(ctx context.Context, event notification) error {
+	return postJSON(ctx, n.client, n.url, map[string]string{
+		"text": fmt.Sprintf("*%s*\n%s", event.Subject, event.Text),
+	})
+}
+
+func postJSON(ctx context.Context, client *http.Client, target string, body interface{}) error {
+	payload, err := json.Marshal(body)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, target, bytes.NewReader(payload))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("notification endpoint returned status %d", resp.StatusCode)
+	}
+	return nil
+}
@@ -0,0 +1,317 @@
+package httpapi
+
+import (
+	"encoding/json"
+	"html/template"
+	"net/http"
+	"reflect"
+	"strings"
+	"sync"
+	"time"
+
+	"email-verifier/pkg/verify"
+)
+
+// openAPISpec is the OpenAPI 3 document for /api/verify. Its schemas are
+// reflected from the structs the handler decodes and encodes, so a field
+// added to verify.Result shows up without anyone updating the spec.
+var openAPISpec = sync.OnceValue(buildOpenAPISpec)
+
+// schemaEnums are the values of enumerated fields, keyed by schema and
+// property name. For arrays they apply to the items.
+var schemaEnums = map[string][]string{
+	"Result.catch_all_confidence": {verify.CatchAllConfirmed, verify.CatchAllLikely, verify.CatchAllNo},
+	"Result.reachable":            {verify.ReachableYes, verify.ReachableNo, verify.ReachableUnknown},
+	"Result.verdict":              verify.Verdicts,
+	"Result.domain_status":        {verify.DomainHasMail, verify.DomainNXDomain, verify.DomainNoMailService, verify.DomainNullMX, verify.DomainDNSError, verify.DomainIPLiteral, verify.DomainNonRoutable},
+	"Result.dns_error":            {verify.DNSErrorNXDomain, verify.DNSErrorServFail, verify.DNSErrorRefused, verify.DNSErrorTimeout, verify.DNSErrorOther},
+	"Result.smtp_address_family":  {verify.AddressFamilyIPv4, verify.AddressFamilyIPv6},
+	"Result.domain_reason":        {verify.DomainReasonSingleLabel, verify.DomainReasonReservedTLD},
+	"Result.smtp_skipped_reason":  {verify.SMTPSkippedAllowlisted, verify.SMTPSkippedSMTPUTF8},
+	"Result.legacy_format":        {verify.LegacySourceRoute, verify.LegacyPercentHack, verify.LegacyBangPath},
+	"Result.error_code":           verify.ErrorCodes,
+	"Result.reachable_reason":     verify.ReachableReasons,
+	"Result.checks_performed":     verify.CheckOrder,
+	"Result.checks_skipped":       verify.CheckOrder,
+	"Result.risk_flags":           verify.RiskFlags,
+	"SMTPDetails.reason":          {verify.SMTPReasonUserUnknown, verify.SMTPReasonQuotaExceeded, verify.SMTPReasonSenderRejected, verify.SMTPReasonPolicyRejection, verify.SMTPReasonTryLater, verify.SMTPReasonOther},
+	"EnvelopeInfo.classification": {verify.EnvelopeNull, verify.EnvelopePlain, verify.EnvelopeVERP, verify.EnvelopeSRS0, verify.EnvelopeSRS1, verify.EnvelopeBATV},
+	"DNSRecords.dmarc_policy":     {verify.DMARCNone, verify.DMARCQuarantine, verify.DMARCReject},
+	"DNSRecords.mta_sts_mode":     {verify.MTASTSEnforce, verify.MTASTSTesting, verify.MTASTSNone},
+	"VerifyRequest.context":       {"recipient", "envelope_sender"},
+	"VerifyRequest.mode":          {modeFast},
+	"StageEvent.stage":            {verify.StageSyntax, verify.StageLists, verify.StageDNS, verify.StageSMTP, stageFinal},
+}
+
+// schemaDescriptions describe the properties whose names don't say it all.
+var schemaDescriptions = map[string]string{
+	"Result.reachable":                     "Whether the mail server confirmed the mailbox; unknown for catch-all servers and skipped probes",
+	"Result.verdict":                       "Summary of the result",
+	"Result.catch_all":                     "The mail server accepts every mailbox of the domain",
+	"Result.catch_all_confidence":          "How many of the catch-all probe's random mailboxes were accepted: confirmed for all, likely for some, no for none",
+	"Result.local_part_randomness":         "How machine-generated the local part looks, from 0 to 1",
+	"Result.error":                         "Same as error_message, kept for older clients",
+	"Result.error_message":                 "Generic message for people; branch on error_code instead",
+	"Result.reachable_reason":              "Why reachable is what it is; the error_code when verification failed",
+	"Result.retry_token":                   "Pass to /api/verify/retry to retry a deferred probe",
+	"Result.retry_after":                   "Seconds to wait before retrying",
+	"Result.attempts":                      "Tries of the SMTP probe that answered, retries of transient failures included",
+	"Result.smtp_host":                     "The mail server that gave the SMTP probe's answer",
+	"Result.smtp_address_family":           "Whether smtp_host was reached over IPv4 or IPv6",
+	"Result.smtp_banner":                   "The text of smtp_host's 220 greeting",
+	"Result.mail_provider":                 "The provider behind the domain's mail servers, such as google-workspace, microsoft-365, proofpoint, mimecast, barracuda, zoho or self-hosted, from the MX hosts and smtp_banner",
+	"Result.transport":                     "Whether smtp_host offers STARTTLS and how negotiating it went, with -smtp-tls-check; it has no bearing on the verdict",
+	"TransportInfo.cert_valid":             "The certificate chains to a trusted root and names the host; left out if no TLS session came up",
+	"TransportInfo.tls_error":              "Why STARTTLS failed",
+	"DNSRecords.mta_sts_mode":              "Mode of the domain's MTA-STS policy; left out if it publishes none or the policy couldn't be fetched",
+	"DNSRecords.has_tls_rpt":               "The domain publishes a TLS-RPT record at _smtp._tls; left out if the lookup failed",
+	"DNSRecords.has_bimi":                  "The domain publishes a BIMI record at default._bimi, with -bimi; left out if the lookup failed",
+	"DNSRecords.bimi_valid":                "The BIMI record is well-formed; left out if there is none",
+	"DNSRecords.bimi_logo":                 "Logo URL of a valid BIMI record",
+	"DNSRecords.dkim_selectors":            "Which of the common DKIM selectors the domain publishes a key under, with -dkim-probe",
+	"Result.deferred":                      "The server (a 4xx reply) or the probing etiquette put the answer off; ask again after retry_after",
+	"Result.cached":                        "Answered from an earlier verification, done at verified_at",
+	"Result.mx":                            "The domain's mail exchangers, lowest preference first",
+	"Result.null_mx":                       "The domain publishes an RFC 7505 null MX and accepts no mail",
+	"Result.mx_fallback_a":                 "The domain has no MX records but resolves to an address, which was probed as its implicit MX",
+	"Result.dns_error":                     "Why the domain's DNS lookup came to nothing: nxdomain for a domain that doesn't exist, or servfail, refused, timeout or error for a failed lookup",
+	"Result.cost_units":                    "Units the verification is metered as",
+	"VerifyRequest.email":                  "Address to verify; either email or ref is required",
+	"VerifyRequest.ref":                    "Address reference such as crm:12345, resolved instead of email",
+	"VerifyRequest.checks":                 "Checks to run, as an array or a comma-separated string; the API key's defaults if left out",
+	"VerifyRequest.skip_smtp":              "Leave out the SMTP probe, whatever checks say",
+	"VerifyRequest.auto_verify_suggestion": "Also verify the address a typo suggestion points at, into suggestion_result",
+	"Result.score":                         "0 to 100, from what the mail server said less a penalty per risk flag; see -score-config",
+	"SMTPDetails.message":                  "The server's reply text, with addresses redacted",
+	"SMTPDetails.temporary":                "A 4xx reply, worth retrying",
+	"Result.suggestion_result":             "The verification of username@suggestion, with auto_verify_suggestion",
+	"StageEvent.result":                    "The result so far; only the final stage's is a finished result with every required field",
+}
+
+// schemaBuilder turns Go types into OpenAPI schemas, collecting named
+// structs as components.
+type schemaBuilder struct {
+	components map[string]interface{}
+}
+
+// schema returns the schema of t, a $ref for named structs.
+func (b *schemaBuilder) schema(t reflect.Type, name string) map[string]interface{} {
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	switch {
+	case t == reflect.TypeOf(time.Time{}):
+		return map[string]interface{}{"type": "string", "format": "date-time"}
+	case t == reflect.TypeOf(checkList{}):
+		return map[string]interface{}{"oneOf": []interface{}{
+			map[string]interface{}{"type": "array", "items": map[string]interface{}{"type": "string", "enum": verify.CheckOrder}},
+			map[string]interface{}{"type": "string"},
+		}}
+	}
+	switch t.Kind() {
+	case reflect.String:
+		return map[string]interface{}{"type": "string"}
+	case reflect.Bool:
+		return map[string]interface{}{"type": "boolean"}
+	case reflect.Int, reflect.Int64, reflect.Int32:
+		return map[string]interface{}{"type": "integer"}
+	case reflect.Uint16:
+		return map[string]interface{}{"type": "integer", "minimum": 0, "maximum": 65535}
+	case reflect.Float64, reflect.Float32:
+		return map[string]interface{}{"type": "number"}
+	case reflect.Slice:
+		return map[string]interface{}{"type": "array", "items": b.schema(t.Elem(), "")}
+	case reflect.Struct:
+		if name == "" {
+			name = t.Name()
+		}
+		if _, ok := b.components[name]; !ok {
+			b.components[name] = nil // placeholder against recursion
+			b.components[name] = b.object(t, name)
+		}
+		return map[string]interface{}{"$ref": "#/components/schemas/" + name}
+	}
+	panic("openapi: no schema for " + t.String())
+}
+
+// object lists the JSON properties of struct t. Fields without omitempty
+// are always present, so they are required.
+func (b *schemaBuilder) object(t reflect.Type, name string) map[string]interface{} {
+	properties := make(map[string]interface{})
+	var required []string
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		tag := field.Tag.Get("json")
+		if !field.IsExported() || tag == "-" {
+			continue
+		}
+		property, opts, _ := strings.Cut(tag, ",")
+		if property == "" {
+			property = field.Name
+		}
+		schema := b.schema(field.Type, "")
+		key := name + "." + property
+		if enum, ok := schemaEnums[key]; ok {
+			if items, isArray := schema["items"].(map[string]interface{}); isArray {
+				items["enum"] = enum
+			} else {
+				schema["enum"] = enum
+			}
+		}
+		if description, ok := schemaDescriptions[key]; ok {
+			schema["description"] = description
+		}
+		properties[property] = schema
+		if !strings.Contains(opts, "omitempty") {
+			required = append(required, property)
+		}
+	}
+	object := map[string]interface{}{"type": "object", "properties": properties}
+	if len(required) > 0 {
+		object["required"] = required
+	}
+	return object
+}
+
+func buildOpenAPISpec() []byte {
+	b := &schemaBuilder{components: make(map[string]interface{})}
+	result := b.schema(reflect.TypeOf(verify.Result{}), "")
+	body := b.schema(reflect.TypeOf(verifyRequest{}), "VerifyRequest")
+	stage := b.schema(reflect.TypeOf(stageEvent{}), "StageEvent")
+	// Either email or ref is needed, which required can't say
+	delete(b.components["VerifyRequest"].(map[string]interface{}), "required")
+	b.components["Error"] = map[string]interface{}{
+		"type": "object",
+		"properties": map[string]interface{}{
+			"error":       map[string]interface{}{"type": "string", "description": "Stable error code"},
+			"detail":      map[string]interface{}{"type": "string"},
+			"retry_after": map[string]interface{}{"type": "integer", "description": "Seconds to wait, on 429"},
+		},
+		"required": []string{"error"},
+	}
+
+	errorRef := map[string]interface{}{"$ref": "#/components/schemas/Error"}
+	plainText := map[string]interface{}{"text/plain": map[string]interface{}{"schema": map[string]interface{}{"type": "string"}}}
+	errorResponse := func(description string) map[string]interface{} {
+		return map[string]interface{}{
+			"description": description,
+			"content":     map[string]interface{}{"application/json": map[string]interface{}{"schema": errorRef}},
+		}
+	}
+	responses := func(badRequest string) map[string]interface{} {
+		return map[string]interface{}{
+			"200": map[string]interface{}{
+				"description": "The verification result. Failed verifications are 200 too, with error_code set. With stream, one StageEvent per line instead.",
+				"content": map[string]interface{}{
+					"application/json":     map[string]interface{}{"schema": result},
+					"application/x-ndjson": map[string]interface{}{"schema": stage},
+				},
+			},
+			"400": map[string]interface{}{
+				"description": badRequest,
+				"content": map[string]interface{}{
+					"application/json": map[string]interface{}{"schema": errorRef},
+					"text/plain":       plainText["text/plain"],
+				},
+			},
+			"401": errorResponse("API keys are required and none or an unknown one was sent (api_key_required, invalid_api_key)"),
+			"403": map[string]interface{}{"description": "include_address was asked for by a key that may not see resolved addresses", "content": plainText},
+			"429": map[string]interface{}{
+				"description": "The client's rate limit (rate_limited, JSON) or the SMTP lane (plain text) is exhausted; see Retry-After",
+				"content": map[string]interface{}{
+					"application/json": map[string]interface{}{"schema": errorRef},
+					"text/plain":       plainText["text/plain"],
+				},
+			},
+			"503": errorResponse("The verifier isn't ready (verifier_unavailable)"),
+		}
+	}
+	parameter := func(name, in, description string, schema map[string]interface{}) map[string]interface{} {
+		return map[string]interface{}{"name": name, "in": in, "description": description, "schema": schema}
+	}
+	requestProps := b.components["VerifyRequest"].(map[string]interface{})["properties"].(map[string]interface{})
+	str := map[string]interface{}{"type": "string"}
+	flag := map[string]interface{}{"type": "string", "enum": []string{"true"}}
+	// The query parameters both methods read; the body's fields win over
+	// them on POST
+	common := []interface{}{
+		parameter("checks", "query", "Comma-separated checks to run", str),
+		parameter("context", "query", "How the address is used", requestProps["context"].(map[string]interface{})),
+		parameter("mode", "query", "fast runs only the checks that need no network", requestProps["mode"].(map[string]interface{})),
+		parameter("skip_smtp", "query", "Leave out the SMTP probe", flag),
+		parameter("auto_verify_suggestion", "query", "Also verify the address a typo suggestion points at", flag),
+		parameter("stream", "query", "Stream the stages as NDJSON instead of answering once", flag),
+		parameter("include_address", "query", "Return the address a ref resolved to, for keys allowed to see it", flag),
+		parameter(headerRequestDeadline, "header", "RFC 3339 time by which the caller needs an answer", str),
+		parameter(headerRequestTimeout, "header", "Milliseconds the caller will wait for an answer", map[string]interface{}{"type": "integer"}),
+	}
+	getParameters := append([]interface{}{
+		parameter("email", "query", "Address to verify; either email or ref is required", str),
+		parameter("ref", "query", "Address reference, resolved instead of email", str),
+	}, common...)
+
+	spec := map[string]interface{}{
+		"openapi": "3.0.3",
+		"info": map[string]interface{}{
+			"title":       "Email Verifier API",
+			"version":     "1",
+			"description": "Verifies email addresses without sending mail. See /docs/examples for worked requests.",
+		},
+		"paths": map[string]interface{}{
+			"/api/verify": map[string]interface{}{
+				"get": map[string]interface{}{
+					"summary":     "Verify an address given in the query",
+					"operationId": "verifyGet",
+					"parameters":  getParameters,
+					"responses":   responses("Neither email nor ref was given (JSON, email_required), or a parameter is invalid (plain text)"),
+				},
+				"post": map[string]interface{}{
+					"summary":     "Verify an address",
+					"operationId": "verifyPost",
+					"parameters":  common,
+					"requestBody": map[string]interface{}{
+						"required": true,
+						"content":  map[string]interface{}{"application/json": map[string]interface{}{"schema": body}},
+					},
+					"responses": responses("The body isn't valid JSON, or names an unknown check, context or mode (plain text)"),
+				},
+			},
+		},
+		"components": map[string]interface{}{
+			"schemas": b.components,
+			"securitySchemes": map[string]interface{}{
+				"apiKey": map[string]interface{}{"type": "apiKey", "in": "header", "name": "X-API-Key"},
+			},
+		},
+		// Keys are only required when the server is started with them
+		"security": []interface{}{map[string]interface{}{}, map[string]interface{}{"apiKey": []string{}}},
+	}
+	data, err := json.MarshalIndent(spec, "", "  ")
+	if err != nil {
+		panic(err)
+	}
+	return data
+}
+
+// openAPIHandler serves the OpenAPI document.
+func openAPIHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(openAPISpec())
+}
+
+// apiDocsPage renders the OpenAPI document with Redoc, loaded from its CDN.
+var apiDocsPage = template.Must(template.New("api-docs").Parse(`<!doctype html>
+<html lang="en">
+<head><meta charset="UTF-8" /><title>Email Verifier API reference</title></head>
+<body>
+<redoc spec-url="/api/openapi.json"></redoc>
+<script src="https://cdn.redoc.ly/redoc/v2.1.5/bundles/redoc.standalone.js"></script>
+</body>
+</html>
+`))
+
+// apiDocsHandler serves the API reference page.
+func apiDocsHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	apiDocsPage.Execute(w, nil)
+}
@@ -0,0 +1,262 @@
+package httpapi
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"email-verifier/pkg/verify"
+)
+
+// jsonFields lists the JSON property names of struct v
+func jsonFields(v interface{}) []string {
+	t := reflect.TypeOf(v)
+	var names []string
+	for i := 0; i < t.NumField(); i++ {
+		name, _, _ := strings.Cut(t.Field(i).Tag.Get("json"), ",")
+		if name != "" && name != "-" {
+			names = append(names, name)
+		}
+	}
+	return names
+}
+
+// TestOpenAPISpec tests that the served spec describes every field of the result structs and that its references resolve
+func TestOpenAPISpec(t *testing.T) {
+	rec := httptest.NewRecorder()
+	Handler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/openapi.json", nil))
+	if rec.Code != http.StatusOK || rec.Header().Get("Content-Type") != "application/json" {
+		t.Fatalf("Expected 200 JSON, got %d %s", rec.Code, rec.Header().Get("Content-Type"))
+	}
+	raw := rec.Body.String()
+	var spec struct {
+		OpenAPI    string `json:"openapi"`
+		Paths      map[string]map[string]json.RawMessage
+		Components struct {
+			Schemas map[string]struct {
+				Properties map[string]struct {
+					Enum  []string `json:"enum"`
+					Items struct {
+						Enum []string `json:"enum"`
+					} `json:"items"`
+				} `json:"properties"`
+				Required []string `json:"required"`
+			} `json:"schemas"`
+		} `json:"components"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &spec); err != nil {
+		t.Fatalf("Failed to parse the spec: %v", err)
+	}
+	if !strings.HasPrefix(spec.OpenAPI, "3.") || spec.Paths["/api/verify"]["get"] == nil || spec.Paths["/api/verify"]["post"] == nil {
+		t.Errorf("Expected an OpenAPI 3 spec of GET and POST /api/verify, got %s %v", spec.OpenAPI, spec.Paths)
+	}
+
+	for schema, v := range map[string]interface{}{
+		"Result":        verify.Result{},
+		"SMTPDetails":   verify.SMTPDetails{},
+		"EnvelopeInfo":  verify.EnvelopeInfo{},
+		"Gravatar":      verify.Gravatar{},
+		"VerifyRequest": verifyRequest{},
+	} {
+		properties := spec.Components.Schemas[schema].Properties
+		for _, field := range jsonFields(v) {
+			if _, ok := properties[field]; !ok {
+				t.Errorf("Expected %s.%s in the spec", schema, field)
+			}
+		}
+		if len(properties) != len(jsonFields(v)) {
+			t.Errorf("Expected %d %s properties, got %d", len(jsonFields(v)), schema, len(properties))
+		}
+	}
+
+	result := spec.Components.Schemas["Result"]
+	if expected := []string{"yes", "no", "unknown"}; !reflect.DeepEqual(result.Properties["reachable"].Enum, expected) {
+		t.Errorf("Expected reachable to be one of %v, got %v", expected, result.Properties["reachable"].Enum)
+	}
+	if !slices.Contains(result.Properties["checks_performed"].Items.Enum, verify.CheckSMTP) {
+		t.Errorf("Expected the check names for checks_performed, got %v", result.Properties["checks_performed"].Items.Enum)
+	}
+	if !slices.Contains(result.Required, "email") || slices.Contains(result.Required, "smtp_details") {
+		t.Errorf("Expected the fields without omitempty required, got %v", result.Required)
+	}
+
+	for _, ref := range regexp.MustCompile(`"#/components/schemas/([A-Za-z]+)"`).FindAllStringSubmatch(raw, -1) {
+		if _, ok := spec.Components.Schemas[ref[1]]; !ok {
+			t.Errorf("Expected schema %s to be defined", ref[1])
+		}
+	}
+
+	rec = httptest.NewRecorder()
+	Handler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/docs", nil))
+	if rec.Code != http.StatusOK || !strings.Contains(rec.Body.String(), `spec-url="/api/openapi.json"`) {
+		t.Errorf("Expected the docs page to load the spec, got %d %s", rec.Code, rec.Body)
+	}
+}
+
+// validateSchema returns how value, decoded JSON, breaks schema, resolving
+// $refs against schemas. Objects may not carry properties the schema
+// leaves out, so a field missing from the spec is caught too.
+func validateSchema(schemas map[string]interface{}, schema map[string]interface{}, value interface{}, path string) []string {
+	if ref, ok := schema["$ref"].(string); ok {
+		target, _ := schemas[strings.TrimPrefix(ref, "#/components/schemas/")].(map[string]interface{})
+		if target == nil {
+			return []string{path + ": unresolved " + ref}
+		}
+		return validateSchema(schemas, target, value, path)
+	}
+	if branches, ok := schema["oneOf"].([]interface{}); ok {
+		for _, branch := range branches {
+			if len(validateSchema(schemas, branch.(map[string]interface{}), value, path)) == 0 {
+				return nil
+			}
+		}
+		return []string{path + ": matches none of oneOf"}
+	}
+
+	var problems []string
+	wrongType := func() []string { return []string{fmt.Sprintf("%s: expected %v, got %T", path, schema["type"], value)} }
+	switch schema["type"] {
+	case "object":
+		object, ok := value.(map[string]interface{})
+		if !ok {
+			return wrongType()
+		}
+		properties, _ := schema["properties"].(map[string]interface{})
+		for name, v := range object {
+			property, ok := properties[name].(map[string]interface{})
+			if !ok {
+				problems = append(problems, path+"."+name+": not in the spec")
+				continue
+			}
+			problems = append(problems, validateSchema(schemas, property, v, path+"."+name)...)
+		}
+		required, _ := schema["required"].([]interface{})
+		for _, name := range required {
+			if _, ok := object[name.(string)]; !ok {
+				problems = append(problems, fmt.Sprintf("%s.%s: required", path, name))
+			}
+		}
+	case "array":
+		array, ok := value.([]interface{})
+		if !ok {
+			return wrongType()
+		}
+		items, _ := schema["items"].(map[string]interface{})
+		for i, v := range array {
+			problems = append(problems, validateSchema(schemas, items, v, fmt.Sprintf("%s[%d]", path, i))...)
+		}
+	case "string":
+		str, ok := value.(string)
+		if !ok {
+			return wrongType()
+		}
+		if enum, ok := schema["enum"].([]interface{}); ok && !slices.Contains(enum, interface{}(str)) {
+			problems = append(problems, fmt.Sprintf("%s: %q is not one of %v", path, str, enum))
+		}
+		if schema["format"] == "date-time" {
+			if _, err := time.Parse(time.RFC3339Nano, str); err != nil {
+				problems = append(problems, fmt.Sprintf("%s: %q is not a date-time", path, str))
+			}
+		}
+	case "boolean":
+		if _, ok := value.(bool); !ok {
+			return wrongType()
+		}
+	case "integer", "number":
+		n, ok := value.(float64)
+		if !ok || (schema["type"] == "integer" && n != float64(int64(n))) {
+			return wrongType()
+		}
+		if minimum, ok := schema["minimum"].(float64); ok && n < minimum {
+			problems = append(problems, fmt.Sprintf("%s: %v is under %v", path, n, minimum))
+		}
+		if maximum, ok := schema["maximum"].(float64); ok && n > maximum {
+			problems = append(problems, fmt.Sprintf("%s: %v is over %v", path, n, maximum))
+		}
+	}
+	return problems
+}
+
+// TestOpenAPIValidatesExamples tests that the result golden files and every recorded example of a documented endpoint match the spec
+func TestOpenAPIValidatesExamples(t *testing.T) {
+	var spec struct {
+		Paths      map[string]map[string]map[string]interface{}
+		Components struct {
+			Schemas map[string]interface{}
+		}
+	}
+	if err := json.Unmarshal(openAPISpec(), &spec); err != nil {
+		t.Fatalf("Failed to parse the spec: %v", err)
+	}
+	validate := func(name string, schema map[string]interface{}, body string) {
+		var value interface{}
+		if err := json.Unmarshal([]byte(body), &value); err != nil {
+			t.Errorf("Expected JSON for %s, got %v", name, err)
+			return
+		}
+		for _, problem := range validateSchema(spec.Components.Schemas, schema, value, "$") {
+			t.Errorf("Expected %s to match the spec: %s", name, problem)
+		}
+	}
+
+	goldens, err := filepath.Glob(filepath.Join("..", "..", "pkg", "verify", "testdata", "golden", "result_*.json"))
+	if err != nil || len(goldens) == 0 {
+		t.Fatalf("Expected the result golden files, got %v", err)
+	}
+	for _, path := range goldens {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		validate(filepath.Base(path), map[string]interface{}{"$ref": "#/components/schemas/Result"}, string(data))
+	}
+
+	rec := httptest.NewRecorder()
+	Handler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/docs/examples.json", nil))
+	var served struct{ Examples []docExample }
+	if err := json.NewDecoder(rec.Body).Decode(&served); err != nil {
+		t.Fatalf("Failed to decode the examples: %v", err)
+	}
+	validated := 0
+	for _, e := range served.Examples {
+		operation := spec.Paths[e.Endpoint][strings.ToLower(e.Method)]
+		if operation == nil {
+			continue
+		}
+		response, _ := operation["responses"].(map[string]interface{})[strconv.Itoa(e.Status)].(map[string]interface{})
+		if response == nil {
+			t.Errorf("Expected the spec to document status %d of %s %s for %q", e.Status, e.Method, e.Endpoint, e.Name)
+			continue
+		}
+		contentType, _, _ := strings.Cut(e.ResponseHeaders["Content-Type"], ";")
+		media, _ := response["content"].(map[string]interface{})[contentType].(map[string]interface{})
+		if media == nil {
+			t.Errorf("Expected the spec to document %s responses of %s %s for %q", contentType, e.Method, e.Endpoint, e.Name)
+			continue
+		}
+		schema := media["schema"].(map[string]interface{})
+		switch contentType {
+		case "application/json":
+			validate(fmt.Sprintf("example %q", e.Name), schema, e.ResponseBody)
+			validated++
+		case "application/x-ndjson":
+			// Only the final stage carries a finished result
+			lines := strings.Split(strings.TrimSpace(e.ResponseBody), "\n")
+			validate(fmt.Sprintf("the last line of example %q", e.Name), schema, lines[len(lines)-1])
+			validated++
+		}
+	}
+	if validated == 0 {
+		t.Error("Expected examples of documented endpoints")
+	}
+}
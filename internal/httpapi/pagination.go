@@ -0,0 +1,105 @@
+package httpapi
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"sort"
+	"strconv"
+)
+
+// Page sizes for list endpoints. A missing limit gets defaultPageLimit and
+// anything larger than maxPageLimit is capped.
+const (
+	defaultPageLimit = 50
+	maxPageLimit     = 500
+)
+
+// errOffsetPagination is returned for offset-style parameters, which skip or
+// repeat rows when the list changes between pages.
+var errOffsetPagination = errors.New("offset pagination is not supported; pass the previous page's next_cursor as cursor")
+
+// pageCursor is the position of a list item: its sort key and, to break ties
+// between items with the same key, its ID. Lists are ordered by (Key, ID)
+// ascending and a page starts after the cursor, so items that exist for the
+// whole walk are returned exactly once however many are added meanwhile.
+type pageCursor struct {
+	Key int64  `json:"k"`
+	ID  string `json:"i,omitempty"`
+}
+
+// String encodes the cursor for next_cursor. Clients should treat it as
+// opaque.
+func (c pageCursor) String() string {
+	data, _ := json.Marshal(c)
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+func (c pageCursor) less(other pageCursor) bool {
+	if c.Key != other.Key {
+		return c.Key < other.Key
+	}
+	return c.ID < other.ID
+}
+
+func decodeCursor(s string) (pageCursor, error) {
+	var c pageCursor
+	data, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return c, errors.New("invalid cursor")
+	}
+	if err := json.Unmarshal(data, &c); err != nil {
+		return c, errors.New("invalid cursor")
+	}
+	return c, nil
+}
+
+// pageRequest is a list request's cursor and limit.
+type pageRequest struct {
+	after *pageCursor // nil for the first page
+	limit int
+}
+
+// firstPage is the first page at the default size.
+var firstPage = pageRequest{limit: defaultPageLimit}
+
+// parsePageRequest reads the cursor and limit parameters and rejects offset
+// and page, which this API doesn't support.
+func parsePageRequest(query url.Values) (pageRequest, error) {
+	if query.Has("offset") || query.Has("page") {
+		return pageRequest{}, errOffsetPagination
+	}
+
+	p := firstPage
+	if v := query.Get("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 {
+			return pageRequest{}, fmt.Errorf("limit must be a number from 1 to %d", maxPageLimit)
+		}
+		p.limit = min(n, maxPageLimit)
+	}
+	if v := query.Get("cursor"); v != "" {
+		c, err := decodeCursor(v)
+		if err != nil {
+			return pageRequest{}, err
+		}
+		p.after = &c
+	}
+	return p, nil
+}
+
+// window returns the bounds of the requested page within a list of n items
+// ordered by key, and the cursor for the page after it ("" if this page
+// reaches the end of the list).
+func (p pageRequest) window(n int, key func(i int) pageCursor) (start, end int, next string) {
+	if p.after != nil {
+		start = sort.Search(n, func(i int) bool { return p.after.less(key(i)) })
+	}
+	end = min(start+p.limit, n)
+	if end < n {
+		next = key(end - 1).String()
+	}
+	return start, end, next
+}
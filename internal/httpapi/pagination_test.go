@@ -0,0 +1,138 @@
+package httpapi
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"email-verifier/pkg/verify"
+)
+
+// TestParsePageRequest tests cursor and limit parsing and the rejection of offset parameters
+func TestParsePageRequest(t *testing.T) {
+	cursor := pageCursor{Key: 42, ID: "abc"}.String()
+
+	testCases := []struct {
+		name  string
+		query string
+		limit int
+		after *pageCursor
+		err   bool
+	}{
+		{"defaults", "", defaultPageLimit, nil, false},
+		{"limit", "limit=10", 10, nil, false},
+		{"limit capped", "limit=100000", maxPageLimit, nil, false},
+		{"zero limit", "limit=0", 0, nil, true},
+		{"bad limit", "limit=ten", 0, nil, true},
+		{"cursor", "cursor=" + cursor, defaultPageLimit, &pageCursor{Key: 42, ID: "abc"}, false},
+		{"bad cursor", "cursor=not-a-cursor", 0, nil, true},
+		{"offset", "offset=20", 0, nil, true},
+		{"page", "page=2", 0, nil, true},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			query, _ := url.ParseQuery(tc.query)
+			p, err := parsePageRequest(query)
+			if tc.err {
+				if err == nil {
+					t.Fatalf("Expected an error for %q", tc.query)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Expected no error, got %v", err)
+			}
+			if p.limit != tc.limit {
+				t.Errorf("Expected limit %d, got %d", tc.limit, p.limit)
+			}
+			if (p.after == nil) != (tc.after == nil) || (p.after != nil && *p.after != *tc.after) {
+				t.Errorf("Expected cursor %+v, got %+v", tc.after, p.after)
+			}
+		})
+	}
+
+	if _, err := parsePageRequest(url.Values{"offset": {"1"}}); !errors.Is(err, errOffsetPagination) {
+		t.Errorf("Expected the offset error pointing at cursor, got %v", err)
+	}
+}
+
+// TestPaginationConcurrentInserts tests that walking history pages while entries are added returns every existing entry exactly once, in order
+func TestPaginationConcurrentInserts(t *testing.T) {
+	saved := history
+	t.Cleanup(func() { history = saved })
+
+	// Three entries share each timestamp so ties are broken by sequence
+	base := time.Date(2024, 3, 3, 0, 0, 0, 0, time.UTC)
+	var tick atomic.Int64
+	history = newHistoryStore()
+	history.now = func() time.Time { return base.Add(time.Duration(tick.Add(1)/3) * time.Second) }
+
+	record := func(i int) {
+		history.Record(verify.DefaultTenant, &verify.Result{Email: "jane@example.com", Error: fmt.Sprint(i)})
+	}
+	const existing = 100
+	for i := 0; i < existing; i++ {
+		record(i)
+	}
+
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for i := existing; i < 2*existing; i++ {
+			record(i)
+		}
+	}()
+
+	seen := make(map[string]int)
+	var last historyEntry
+	cursor := ""
+	for pages := 0; ; pages++ {
+		if pages > 2*existing {
+			t.Fatal("Expected the walk to end")
+		}
+		rec := httptest.NewRecorder()
+		historyHandler(rec, httptest.NewRequest(http.MethodGet, "/api/history?email=jane@example.com&limit=7&cursor="+cursor, nil))
+		if rec.Code != http.StatusOK {
+			t.Fatalf("Expected status 200, got %d: %s", rec.Code, rec.Body.String())
+		}
+		var body struct {
+			Entries    []historyEntry `json:"entries"`
+			NextCursor string         `json:"next_cursor"`
+		}
+		if err := json.Unmarshal(rec.Body.Bytes(), &body); err != nil {
+			t.Fatalf("Failed to decode response: %v", err)
+		}
+		for _, entry := range body.Entries {
+			if entry.VerifiedAt.Before(last.VerifiedAt) {
+				t.Errorf("Expected entries oldest first, got %s after %s", entry.VerifiedAt, last.VerifiedAt)
+			}
+			seen[entry.Result.Error]++
+			last = entry
+		}
+		if body.NextCursor == "" {
+			break
+		}
+		cursor = body.NextCursor
+	}
+	wg.Wait()
+
+	for i := 0; i < existing; i++ {
+		if n := seen[fmt.Sprint(i)]; n != 1 {
+			t.Errorf("Expected entry %d exactly once, got %d", i, n)
+		}
+	}
+	for id, n := range seen {
+		if n > 1 {
+			t.Errorf("Expected entry %s at most once, got %d", id, n)
+		}
+	}
+}
@@ -0,0 +1,116 @@
+package httpapi
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"email-verifier/pkg/verify"
+)
+
+// Errors returned by planRegistry.Take.
+var (
+	errPlanTampered = errors.New("plan token is invalid or belongs to another key")
+	errPlanExpired  = errors.New("plan has expired or was already executed")
+)
+
+// storedPlan is a dry run kept so it can be executed without re-uploading
+// the list.
+type storedPlan struct {
+	plan    verify.BatchPlan
+	opts    verify.Options
+	expires time.Time
+}
+
+// planRegistry holds dry-run plans until they are executed or expire. A
+// plan token is the plan ID signed together with the submitting API key,
+// so a token can't be edited to reach another plan or used by another key.
+// Plans live in memory, so the signing key is generated per process.
+type planRegistry struct {
+	mu    sync.Mutex
+	plans map[string]*storedPlan
+	key   []byte
+	ttl   time.Duration
+	now   func() time.Time
+}
+
+var plans = newPlanRegistry(time.Hour)
+
+func newPlanRegistry(ttl time.Duration) *planRegistry {
+	key := make([]byte, 32)
+	if _, err := rand.Read(key); err != nil {
+		panic(fmt.Sprintf("generate plan token key: %v", err))
+	}
+	return &planRegistry{plans: make(map[string]*storedPlan), key: key, ttl: ttl, now: time.Now}
+}
+
+// Add stores plan for later execution with opts and returns its token and
+// expiry.
+func (pr *planRegistry) Add(plan verify.BatchPlan, opts verify.Options) (string, time.Time) {
+	id := newWatchID()
+	expires := pr.now().Add(pr.ttl)
+
+	pr.mu.Lock()
+	pr.plans[id] = &storedPlan{plan: plan, opts: opts, expires: expires}
+	pr.mu.Unlock()
+	return id + "." + base64.RawURLEncoding.EncodeToString(pr.sign(id, opts.Key)), expires
+}
+
+// Take removes and returns the plan behind token, which must have been
+// issued to apiKey. Each plan executes at most once.
+func (pr *planRegistry) Take(token, apiKey string) (*storedPlan, error) {
+	id, sig, ok := strings.Cut(token, ".")
+	if !ok {
+		return nil, errPlanTampered
+	}
+	rawSig, err := base64.RawURLEncoding.DecodeString(sig)
+	if err != nil || !hmac.Equal(rawSig, pr.sign(id, apiKey)) {
+		return nil, errPlanTampered
+	}
+
+	pr.mu.Lock()
+	defer pr.mu.Unlock()
+	stored, ok := pr.plans[id]
+	if !ok {
+		return nil, errPlanExpired
+	}
+	delete(pr.plans, id)
+	if !pr.now().Before(stored.expires) {
+		return nil, errPlanExpired
+	}
+	return stored, nil
+}
+
+// Len returns the number of plans held.
+func (pr *planRegistry) Len() int {
+	pr.mu.Lock()
+	defer pr.mu.Unlock()
+	return len(pr.plans)
+}
+
+// Sweep drops expired plans.
+func (pr *planRegistry) Sweep(now time.Time) int {
+	pr.mu.Lock()
+	defer pr.mu.Unlock()
+
+	evicted := 0
+	for id, stored := range pr.plans {
+		if !now.Before(stored.expires) {
+			delete(pr.plans, id)
+			evicted++
+		}
+	}
+	return evicted
+}
+
+func (pr *planRegistry) sign(id, apiKey string) []byte {
+	mac := hmac.New(sha256.New, pr.key)
+	mac.Write([]byte(id + "\x00" + apiKey))
+	return mac.Sum(nil)
+}
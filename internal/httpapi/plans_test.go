@@ -0,0 +1,148 @@
+package httpapi
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"email-verifier/pkg/verify"
+)
+
+// usePlans replaces the plan registry for the duration of a test, with a clock the test can move
+func usePlans(t *testing.T, at *time.Time) *planRegistry {
+	t.Helper()
+	saved := plans
+	plans = newPlanRegistry(time.Hour)
+	plans.now = func() time.Time { return *at }
+	t.Cleanup(func() { plans = saved })
+	return plans
+}
+
+// TestPlanTokens tests that plan tokens are bound to their key, single use and expire
+func TestPlanTokens(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+	registry := usePlans(t, &now)
+	opts := verify.Options{Key: "team"}
+	plan := verify.BatchPlan{Emails: []string{"jane@example.com"}}
+
+	token, expires := registry.Add(plan, opts)
+	if !expires.Equal(now.Add(time.Hour)) {
+		t.Errorf("Expected expiry after an hour, got %v", expires)
+	}
+	id, _, _ := strings.Cut(token, ".")
+	otherToken, _ := registry.Add(plan, opts)
+	_, otherSig, _ := strings.Cut(otherToken, ".")
+
+	testCases := []struct {
+		name  string
+		token string
+		key   string
+		err   error
+	}{
+		{"no signature", id, "team", errPlanTampered},
+		{"signature of another plan", id + "." + otherSig, "team", errPlanTampered},
+		{"another key", token, "other", errPlanTampered},
+		{"issued token", token, "team", nil},
+		{"already executed", token, "team", errPlanExpired},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			stored, err := registry.Take(tc.token, tc.key)
+			if err != tc.err {
+				t.Fatalf("Expected error %v, got %v", tc.err, err)
+			}
+			if err == nil && stored.plan.Emails[0] != "jane@example.com" {
+				t.Errorf("Expected the stored plan, got %+v", stored.plan)
+			}
+		})
+	}
+
+	now = now.Add(time.Hour)
+	if _, err := registry.Take(otherToken, "team"); err != errPlanExpired {
+		t.Errorf("Expected an expired plan, got %v", err)
+	}
+
+	registry.Add(plan, opts)
+	now = now.Add(2 * time.Hour)
+	if n := registry.Sweep(now); n != 1 || registry.Len() != 0 {
+		t.Errorf("Expected the expired plan swept, got %d swept and %d left", n, registry.Len())
+	}
+}
+
+// postJob submits body to POST /api/jobs as key
+func postJob(body interface{}, key string) *httptest.ResponseRecorder {
+	encoded, _ := json.Marshal(body)
+	req := httptest.NewRequest(http.MethodPost, "/api/jobs", bytes.NewReader(encoded))
+	req.Header.Set("X-API-Key", key)
+	rec := httptest.NewRecorder()
+	submitJobHandler(rec, req)
+	return rec
+}
+
+// TestDryRunJob tests that a dry run starts no job and that its token executes the planned list once
+func TestDryRunJob(t *testing.T) {
+	registry := useJobs(t, 50)
+	now := time.Now()
+	usePlans(t, &now)
+
+	rec := postJob(map[string]interface{}{
+		"emails":  []string{"a@example.com", "A@example.com", "not-an-address", "b@example.com"},
+		"dry_run": true,
+	}, "team")
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d: %s", rec.Code, rec.Body.String())
+	}
+	var response struct {
+		Plan      verify.BatchPlan `json:"plan"`
+		PlanToken string           `json:"plan_token"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &response); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	if response.Plan.Unique != 3 || response.Plan.Duplicates != 1 || len(response.Plan.Rejected) != 1 || response.PlanToken == "" {
+		t.Errorf("Expected 3 unique, 1 duplicate and 1 rejected with a token, got %+v", response)
+	}
+	if registry.Len() != 0 {
+		t.Fatalf("Expected no job from a dry run, got %d", registry.Len())
+	}
+
+	if rec := postJob(map[string]string{"plan_token": response.PlanToken}, "other"); rec.Code != http.StatusForbidden {
+		t.Errorf("Expected status 403 for another key, got %d", rec.Code)
+	}
+
+	rec = postJob(map[string]string{"plan_token": response.PlanToken}, "team")
+	if rec.Code != http.StatusAccepted {
+		t.Fatalf("Expected status 202, got %d: %s", rec.Code, rec.Body.String())
+	}
+	var view jobView
+	json.Unmarshal(rec.Body.Bytes(), &view)
+	if view.Total != 3 || rec.Header().Get("Location") != "/api/jobs/"+view.ID {
+		t.Errorf("Expected a job for the 3 planned addresses, got %+v", view)
+	}
+
+	if rec := postJob(map[string]string{"plan_token": response.PlanToken}, "team"); rec.Code != http.StatusGone {
+		t.Errorf("Expected status 410 once executed, got %d", rec.Code)
+	}
+}
+
+// TestSubmitJobBadRequests tests job submission validation
+func TestSubmitJobBadRequests(t *testing.T) {
+	useJobs(t, 50)
+
+	if rec := postJob(map[string]interface{}{}, ""); rec.Code != http.StatusBadRequest {
+		t.Errorf("Expected status 400 without emails, got %d", rec.Code)
+	}
+	if rec := postJob(map[string]interface{}{"emails": []string{"a@example.com"}, "checks": []string{"telepathy"}}, ""); rec.Code != http.StatusBadRequest {
+		t.Errorf("Expected status 400 for an unknown check, got %d", rec.Code)
+	}
+	saved := maxJobEmails
+	maxJobEmails = 1
+	t.Cleanup(func() { maxJobEmails = saved })
+	if rec := postJob(map[string]interface{}{"emails": []string{"a@example.com", "b@example.com"}}, ""); rec.Code != http.StatusRequestEntityTooLarge {
+		t.Errorf("Expected status 413 over the limit, got %d", rec.Code)
+	}
+}
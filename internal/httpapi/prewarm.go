@@ -0,0 +1,180 @@
+package httpapi
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"sync"
+	"time"
+
+	"email-verifier/pkg/verify"
+)
+
+// Prewarm run outcomes, as reported in /admin/state.
+const (
+	prewarmOff         = "off"
+	prewarmIdle        = "idle"
+	prewarmRunning     = "running"
+	prewarmDone        = "done"
+	prewarmTimedOut    = "timed_out"
+	prewarmInterrupted = "interrupted"
+	prewarmFailed      = "failed"
+)
+
+// prewarmState is the latest prewarm run.
+type prewarmState struct {
+	Status      string     `json:"status"`
+	Trigger     string     `json:"trigger,omitempty"` // startup or admin
+	StartedAt   *time.Time `json:"started_at,omitempty"`
+	FinishedAt  *time.Time `json:"finished_at,omitempty"`
+	ProbeBudget int        `json:"probe_budget"`
+	verify.PrewarmProgress
+	Error string `json:"error,omitempty"`
+}
+
+// prewarmer refreshes the domain cache with the domains history saw most
+// in the last window, so the first verifications of the day don't pay for
+// cold lookups. Each run has a deadline and a catch-all probe budget, and
+// ends early when the server shuts down.
+type prewarmer struct {
+	ctx     context.Context // ends at shutdown
+	svc     *verify.Service
+	history *historyStore
+
+	domains   int
+	window    time.Duration
+	timeout   time.Duration
+	probes    int
+	readyWait time.Duration
+
+	mu    sync.Mutex
+	state prewarmState
+	done  chan struct{} // closed when the current run ends
+	now   func() time.Time
+}
+
+// prewarm is nil unless -prewarm-domains is set.
+var prewarm *prewarmer
+
+func newPrewarmer(ctx context.Context, svc *verify.Service, h *historyStore, cfg Config) *prewarmer {
+	done := make(chan struct{})
+	close(done)
+	return &prewarmer{
+		ctx:       ctx,
+		svc:       svc,
+		history:   h,
+		domains:   cfg.PrewarmDomains,
+		window:    cfg.PrewarmWindow,
+		timeout:   cfg.PrewarmTimeout,
+		probes:    cfg.PrewarmProbes,
+		readyWait: cfg.PrewarmReadyWait,
+		state:     prewarmState{Status: prewarmIdle, ProbeBudget: cfg.PrewarmProbes},
+		done:      done,
+		now:       time.Now,
+	}
+}
+
+// Start begins a run in the background unless one is going, and returns
+// the run's state and whether it started.
+func (p *prewarmer) Start(trigger string) (prewarmState, bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.state.Status == prewarmRunning {
+		return p.state, false
+	}
+	started := p.now().UTC()
+	p.state = prewarmState{Status: prewarmRunning, Trigger: trigger, StartedAt: &started, ProbeBudget: p.probes}
+	p.done = make(chan struct{})
+	go p.run(p.done)
+	return p.state, true
+}
+
+func (p *prewarmer) run(done chan struct{}) {
+	defer close(done)
+	ctx, cancel := context.WithTimeout(p.ctx, p.timeout)
+	defer cancel()
+
+	domains := p.history.TopDomains(p.now().Add(-p.window), p.domains)
+	p.update(verify.PrewarmProgress{Domains: len(domains)})
+	progress, err := p.svc.Prewarm(ctx, domains, p.probes, p.update)
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	finished := p.now().UTC()
+	p.state.FinishedAt = &finished
+	p.state.PrewarmProgress = progress
+	switch {
+	case err == nil:
+		p.state.Status = prewarmDone
+	case errors.Is(err, context.DeadlineExceeded):
+		p.state.Status = prewarmTimedOut
+	case errors.Is(err, context.Canceled):
+		p.state.Status = prewarmInterrupted
+	default:
+		p.state.Status, p.state.Error = prewarmFailed, err.Error()
+	}
+	log.Printf("prewarm %s: %d of %d domains, %d probes, %d failures", p.state.Status, progress.Done, progress.Domains, progress.Probes, progress.Failures)
+}
+
+func (p *prewarmer) update(progress verify.PrewarmProgress) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.state.PrewarmProgress = progress
+}
+
+// State returns the latest run's state.
+func (p *prewarmer) State() prewarmState {
+	if p == nil {
+		return prewarmState{Status: prewarmOff}
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.state
+}
+
+// Wait blocks until the current run, if any, ends.
+func (p *prewarmer) Wait() {
+	p.mu.Lock()
+	done := p.done
+	p.mu.Unlock()
+	<-done
+}
+
+// holdingReadiness reports whether /readyz should wait for the startup
+// prewarm. It does for at most readyWait from the start of the run; runs
+// started from /admin/prewarm never hold it.
+func (p *prewarmer) holdingReadiness() bool {
+	if p == nil {
+		return false
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.state.Status == prewarmRunning && p.state.Trigger == "startup" && p.now().Before(p.state.StartedAt.Add(p.readyWait))
+}
+
+// adminPrewarmHandler shows the latest prewarm run (GET) or starts one
+// (POST).
+func adminPrewarmHandler(w http.ResponseWriter, r *http.Request) {
+	if prewarm == nil {
+		http.Error(w, "Prewarming is not configured (set -prewarm-domains)", http.StatusNotFound)
+		return
+	}
+	switch r.Method {
+	case http.MethodGet:
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(prewarm.State())
+	case http.MethodPost:
+		state, started := prewarm.Start("admin")
+		w.Header().Set("Content-Type", "application/json")
+		if started {
+			w.WriteHeader(http.StatusAccepted)
+		} else {
+			w.WriteHeader(http.StatusConflict)
+		}
+		json.NewEncoder(w).Encode(state)
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
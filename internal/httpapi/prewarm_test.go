@@ -0,0 +1,192 @@
+package httpapi
+
+import (
+	"context"
+	"encoding/json"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"email-verifier/pkg/verify"
+	"email-verifier/pkg/verify/verifytest"
+)
+
+// prewarmBase is when the test histories were recorded
+var prewarmBase = time.Date(2024, 5, 1, 8, 0, 0, 0, time.UTC)
+
+// newPrewarmHistory returns a store that saw acme.io three times, beta.io
+// twice and gamma.io once, plus an invalid address
+func newPrewarmHistory() *historyStore {
+	h := newHistoryStore()
+	h.now = func() time.Time { return prewarmBase }
+	for _, r := range []verify.Result{
+		{Email: "a@acme.io", Domain: "acme.io", IsValid: true},
+		{Email: "b@acme.io", Domain: "acme.io", IsValid: true},
+		{Email: "c@ACME.io", Domain: "ACME.io", IsValid: true},
+		{Email: "a@beta.io", Domain: "beta.io", IsValid: true},
+		{Email: "b@beta.io", Domain: "beta.io", IsValid: true},
+		{Email: "a@gamma.io", Domain: "gamma.io", IsValid: true},
+		{Email: "nope@@zeta.io"},
+	} {
+		r := r
+		h.Record(verify.DefaultTenant, &r)
+	}
+	return h
+}
+
+// newTestPrewarmer returns a prewarmer over a cached service and
+// newPrewarmHistory, with probes taking delay, installed as the server's
+// prewarmer for the test
+func newTestPrewarmer(t *testing.T, ctx context.Context, delay time.Duration, cfg Config) *prewarmer {
+	t.Helper()
+	fake := verifytest.NewResolver()
+	smtp := verifytest.NewSMTP()
+	smtp.Delay = delay
+	for _, domain := range []string{"acme.io", "beta.io", "gamma.io"} {
+		fake.MX[domain] = []*net.MX{{Host: "mx." + domain + ".", Pref: 10}}
+	}
+	svc := useService(t, verify.Config{Resolver: fake, Prober: smtp.Probe, DomainCacheTTL: time.Hour})
+
+	if cfg.PrewarmDomains == 0 {
+		cfg.PrewarmDomains = 2
+	}
+	if cfg.PrewarmWindow == 0 {
+		cfg.PrewarmWindow = 24 * time.Hour
+	}
+	if cfg.PrewarmTimeout == 0 {
+		cfg.PrewarmTimeout = time.Second
+	}
+	p := newPrewarmer(ctx, svc, newPrewarmHistory(), cfg)
+	p.now = func() time.Time { return prewarmBase.Add(time.Hour) }
+
+	saved := prewarm
+	prewarm = p
+	t.Cleanup(func() {
+		p.Wait()
+		prewarm = saved
+	})
+	return p
+}
+
+// TestHistoryTopDomains tests that the most verified valid domains come first, regardless of case and within the window
+func TestHistoryTopDomains(t *testing.T) {
+	h := newPrewarmHistory()
+	if got := h.TopDomains(prewarmBase, 5); !reflect.DeepEqual(got, []string{"acme.io", "beta.io", "gamma.io"}) {
+		t.Errorf("Expected acme.io, beta.io, gamma.io, got %v", got)
+	}
+	if got := h.TopDomains(prewarmBase, 1); !reflect.DeepEqual(got, []string{"acme.io"}) {
+		t.Errorf("Expected only acme.io, got %v", got)
+	}
+	if got := h.TopDomains(prewarmBase.Add(time.Second), 5); len(got) != 0 {
+		t.Errorf("Expected nothing after the window, got %v", got)
+	}
+}
+
+// TestPrewarmRun tests that a run warms the top domains and reports in /admin/state
+func TestPrewarmRun(t *testing.T) {
+	p := newTestPrewarmer(t, context.Background(), 0, Config{PrewarmProbes: 1})
+	if _, started := p.Start("startup"); !started {
+		t.Fatal("Expected the run to start")
+	}
+	p.Wait()
+
+	state := p.State()
+	if state.Status != prewarmDone || state.Domains != 2 || state.Done != 2 || state.Probes != 1 || state.FinishedAt == nil {
+		t.Errorf("Expected a finished run over 2 domains with 1 probe, got %+v", state)
+	}
+	if n := service.DomainCacheLen(); n != 2 {
+		t.Errorf("Expected 2 cached domains, got %d", n)
+	}
+
+	rec := httptest.NewRecorder()
+	adminStateHandler(rec, httptest.NewRequest(http.MethodGet, "/admin/state", nil))
+	var body struct {
+		Prewarm     prewarmState
+		DomainCache struct{ Enabled bool } `json:"domain_cache"`
+	}
+	if err := json.NewDecoder(rec.Body).Decode(&body); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	if body.Prewarm.Status != prewarmDone || !body.DomainCache.Enabled {
+		t.Errorf("Expected the run and cache in /admin/state, got %+v", body)
+	}
+}
+
+// TestPrewarmDeadline tests that runs past their timeout or shutdown stop with that status
+func TestPrewarmDeadline(t *testing.T) {
+	t.Run("timeout", func(t *testing.T) {
+		p := newTestPrewarmer(t, context.Background(), 50*time.Millisecond, Config{PrewarmTimeout: 10 * time.Millisecond, PrewarmProbes: 5})
+		p.Start("startup")
+		p.Wait()
+		if state := p.State(); state.Status != prewarmTimedOut || state.Done != 0 {
+			t.Errorf("Expected a timed out run, got %+v", state)
+		}
+	})
+	t.Run("shutdown", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		p := newTestPrewarmer(t, ctx, 0, Config{})
+		cancel()
+		p.Start("startup")
+		p.Wait()
+		if state := p.State(); state.Status != prewarmInterrupted {
+			t.Errorf("Expected an interrupted run, got %+v", state)
+		}
+	})
+}
+
+// TestPrewarmReadiness tests that only the startup run holds /readyz, and only for the ready wait
+func TestPrewarmReadiness(t *testing.T) {
+	p := newTestPrewarmer(t, context.Background(), 100*time.Millisecond, Config{PrewarmProbes: 1, PrewarmReadyWait: time.Minute})
+	ready := func() int {
+		rec := httptest.NewRecorder()
+		readyzHandler(rec, httptest.NewRequest(http.MethodGet, "/readyz", nil))
+		return rec.Code
+	}
+	var elapsed atomic.Int64
+	p.now = func() time.Time { return prewarmBase.Add(time.Hour + time.Duration(elapsed.Load())) }
+
+	p.Start("startup")
+	if code := ready(); code != http.StatusServiceUnavailable {
+		t.Errorf("Expected /readyz status 503 while prewarming, got %d", code)
+	}
+	elapsed.Store(int64(time.Minute))
+	if code := ready(); code != http.StatusOK {
+		t.Errorf("Expected /readyz status 200 past the ready wait, got %d", code)
+	}
+	p.Wait()
+
+	p.Start("admin")
+	if code := ready(); code != http.StatusOK {
+		t.Errorf("Expected an admin run not to hold /readyz, got %d", code)
+	}
+}
+
+// TestAdminPrewarmHandler tests starting runs from /admin/prewarm
+func TestAdminPrewarmHandler(t *testing.T) {
+	call := func(method string) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		adminPrewarmHandler(rec, httptest.NewRequest(method, "/admin/prewarm", nil))
+		return rec
+	}
+	if rec := call(http.MethodPost); rec.Code != http.StatusNotFound {
+		t.Errorf("Expected status 404 when not configured, got %d", rec.Code)
+	}
+
+	newTestPrewarmer(t, context.Background(), 50*time.Millisecond, Config{PrewarmProbes: 1})
+	rec := call(http.MethodPost)
+	var state prewarmState
+	json.NewDecoder(rec.Body).Decode(&state)
+	if rec.Code != http.StatusAccepted || state.Status != prewarmRunning || state.Trigger != "admin" {
+		t.Errorf("Expected status 202 with a running admin run, got %d %+v", rec.Code, state)
+	}
+	if rec := call(http.MethodPost); rec.Code != http.StatusConflict {
+		t.Errorf("Expected status 409 while running, got %d", rec.Code)
+	}
+	if rec := call(http.MethodGet); rec.Code != http.StatusOK {
+		t.Errorf("Expected status 200, got %d", rec.Code)
+	}
+}
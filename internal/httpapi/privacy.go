@@ -0,0 +1,106 @@
+package httpapi
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"regexp"
+	"strings"
+
+	"email-verifier/pkg/verify"
+)
+
+// privacySalt is nil unless -privacy-mode is set. With it, what the server
+// keeps about an address (history, the history db, result cache keys and
+// request logs) names it only by its addressDigest; responses to the
+// caller still carry the address.
+var privacySalt []byte
+
+// digestPattern matches an address digest, as passed to ?hash=.
+var digestPattern = regexp.MustCompile(`^[0-9a-f]{64}$`)
+
+// addressDigest is the salted SHA-256 of email's inbox, service.InboxKey,
+// in hex.
+func addressDigest(email string) string {
+	return saltedDigest(service.InboxKey(email))
+}
+
+func saltedDigest(s string) string {
+	h := sha256.New()
+	h.Write(privacySalt)
+	h.Write([]byte(s))
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// addressID is the hash history knows email by: its addressDigest in
+// privacy mode, and otherwise the unsalted verify.AddressHash of its inbox,
+// so every address of one inbox shares its history.
+func addressID(email string) string {
+	if privacySalt != nil {
+		return addressDigest(email)
+	}
+	return verify.AddressHash(service.InboxKey(email))
+}
+
+// privateKey returns s unchanged, or its salted digest in privacy mode,
+// for in-memory keys made from an address.
+func privateKey(s string) string {
+	if privacySalt != nil {
+		return saltedDigest(s)
+	}
+	return s
+}
+
+// storedResult is result as history keeps it: in privacy mode a copy with
+// the address replaced by its digest and the local part, normalized
+// address, display name and retry token left out, and so for a
+// suggestion's result. The
+// addresses an envelope decodes to and any address in an error or SMTP
+// reply become digests too, and the Gravatar URL, an unsalted MD5 of the
+// address, is left out.
+func storedResult(result *verify.Result) *verify.Result {
+	if privacySalt == nil {
+		return result
+	}
+	stored := *result
+	stored.Email, stored.Username, stored.NormalizedEmail, stored.RetryToken = addressDigest(result.Email), "", "", ""
+	stored.DisplayName = ""
+	stored.Error = verify.ReplaceAddresses(result.Error, addressDigest)
+	if result.Envelope != nil {
+		envelope := *result.Envelope
+		envelope.OriginalAddress = digestIfSet(envelope.OriginalAddress)
+		envelope.VerifiedAddress = digestIfSet(envelope.VerifiedAddress)
+		stored.Envelope = &envelope
+	}
+	if result.Gravatar != nil {
+		stored.Gravatar = &verify.Gravatar{HasGravatar: result.Gravatar.HasGravatar}
+	}
+	if result.SMTPDetails != nil {
+		details := *result.SMTPDetails
+		details.Message = verify.ReplaceAddresses(details.Message, addressDigest)
+		stored.SMTPDetails = &details
+	}
+	if result.SuggestionResult != nil {
+		stored.SuggestionResult = storedResult(result.SuggestionResult)
+	}
+	return &stored
+}
+
+func digestIfSet(email string) string {
+	if email == "" {
+		return ""
+	}
+	return addressDigest(email)
+}
+
+// loggedPath is path as the request log shows it: in privacy mode any
+// address in it is replaced by its digest.
+func loggedPath(path string) string {
+	if privacySalt == nil {
+		return path
+	}
+	segments := strings.Split(path, "/")
+	for i, segment := range segments {
+		segments[i] = verify.ReplaceAddresses(segment, addressDigest)
+	}
+	return strings.Join(segments, "/")
+}
@@ -0,0 +1,147 @@
+package httpapi
+
+import (
+	"crypto/md5"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"email-verifier/pkg/verify"
+)
+
+// usePrivacy turns privacy mode on with salt, with empty history and result cache
+func usePrivacy(t *testing.T, salt string) {
+	t.Helper()
+	savedSalt, savedHistory, savedCache := privacySalt, history, verifyCache
+	privacySalt, history, verifyCache = []byte(salt), newHistoryStore(), newResultCache(time.Hour, 10)
+	t.Cleanup(func() { privacySalt, history, verifyCache = savedSalt, savedHistory, savedCache })
+}
+
+// TestPrivacyMode tests that history keeps only a salted digest of the address while the caller still gets the address
+func TestPrivacyMode(t *testing.T) {
+	useStreamService(t)
+	usePrivacy(t, "pepper")
+	logs := useRequestLog(t)
+
+	rec := postVerify(t, "", `{"email": "Jane@partner.mock", "checks": "smtp"}`)
+	var result verify.Result
+	json.Unmarshal(rec.Body.Bytes(), &result)
+	if result.Email != "Jane@partner.mock" {
+		t.Errorf("Expected the response to carry the address, got %q", result.Email)
+	}
+
+	digest := addressDigest("jane@partner.mock")
+	if digest == verify.AddressHash("jane@partner.mock") || len(digest) != 64 {
+		t.Fatalf("Expected a salted digest, got %s", digest)
+	}
+	entries := history.Lookup(verify.DefaultTenant, digest)
+	if len(entries) != 1 || entries[0].Result.Email != digest || entries[0].Result.Username != "" {
+		t.Fatalf("Expected one entry stored under the digest without the address, got %+v", entries)
+	}
+	if result.Email == entries[0].Result.Email {
+		t.Error("Expected history to keep its own copy of the result")
+	}
+
+	for _, query := range []string{"email=JANE@partner.mock", "hash=" + strings.ToUpper(digest)} {
+		rec := httptest.NewRecorder()
+		historyHandler(rec, httptest.NewRequest(http.MethodGet, "/api/history?"+query, nil))
+		var body struct {
+			Entries []historyEntry `json:"entries"`
+		}
+		json.Unmarshal(rec.Body.Bytes(), &body)
+		if rec.Code != http.StatusOK || len(body.Entries) != 1 {
+			t.Errorf("Expected the entry for %s, got %d %s", query, rec.Code, rec.Body)
+		}
+	}
+
+	rec = httptest.NewRecorder()
+	Handler().ServeHTTP(rec, httptest.NewRequest(http.MethodDelete, "/api/cache/jane@partner.mock", nil))
+	if strings.Contains(logs.String(), "jane@partner.mock") || !strings.Contains(logs.String(), "/api/cache/"+digest) {
+		t.Errorf("Expected the logged path to name the digest, got %s", logs)
+	}
+
+	privacySalt = []byte("salt")
+	if addressDigest("jane@partner.mock") == digest {
+		t.Error("Expected another salt to give another digest")
+	}
+}
+
+// TestStoredResultPrivacy tests that a result stored in privacy mode carries no address, local part, display name or Gravatar hash anywhere
+func TestStoredResultPrivacy(t *testing.T) {
+	useStreamService(t)
+	usePrivacy(t, "pepper")
+	email := "jane.doe@partner.mock"
+	gravatarHash := fmt.Sprintf("%x", md5.Sum([]byte(email)))
+	result := &verify.Result{
+		Email:           email,
+		Username:        "jane.doe",
+		NormalizedEmail: email,
+		DisplayName:     "Jane Doe",
+		RetryToken:      "eyJoIjoiYWJjIn0.c2ln",
+		Error:           "Mail server does not exist : 550 5.1.1 <" + email + ">: user unknown",
+		SMTPDetails:     &verify.SMTPDetails{Code: 550, Message: "<" + email + ">: user unknown"},
+		Envelope: &verify.EnvelopeInfo{
+			Classification:  verify.EnvelopeSRS0,
+			OriginalAddress: email,
+			ReturnDomain:    "forwarder.mock",
+			VerifiedAddress: email,
+		},
+		Gravatar:         &verify.Gravatar{HasGravatar: true, GravatarURL: "https://www.gravatar.com/avatar/" + gravatarHash},
+		SuggestionResult: &verify.Result{Email: "jane.doe@gmail.com", Username: "jane.doe"},
+	}
+
+	data, err := json.Marshal(storedResult(result))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, secret := range []string{"jane.doe", "@partner.mock", "Jane Doe", gravatarHash, result.RetryToken} {
+		if strings.Contains(string(data), secret) {
+			t.Errorf("Expected %q left out of the stored result, got %s", secret, data)
+		}
+	}
+	if !strings.Contains(string(data), addressDigest(email)) || !strings.Contains(string(data), `"has_gravatar":true`) {
+		t.Errorf("Expected the digest and the Gravatar flag kept, got %s", data)
+	}
+	if result.Envelope.OriginalAddress != email || result.Gravatar.GravatarURL == "" {
+		t.Error("Expected the caller's result left as it was")
+	}
+}
+
+// TestHistoryDelete tests that an erasure request drops an address's history and cached results
+func TestHistoryDelete(t *testing.T) {
+	useStreamService(t)
+	usePrivacy(t, "pepper")
+	postVerify(t, "", `{"email": "jane@partner.mock", "checks": "smtp"}`)
+	postVerify(t, "", `{"email": "nobody@partner.mock", "checks": "smtp"}`)
+
+	remove := func(query string) (int, map[string]int) {
+		rec := httptest.NewRecorder()
+		historyHandler(rec, httptest.NewRequest(http.MethodDelete, "/api/history?"+query, nil))
+		var body map[string]int
+		json.Unmarshal(rec.Body.Bytes(), &body)
+		return rec.Code, body
+	}
+
+	if code, _ := remove("hash=not-a-digest"); code != http.StatusBadRequest {
+		t.Errorf("Expected status 400 for a bad hash, got %d", code)
+	}
+	if code, _ := remove(""); code != http.StatusBadRequest {
+		t.Errorf("Expected status 400 without an address, got %d", code)
+	}
+	if code, body := remove("hash=" + addressDigest("jane@partner.mock")); code != http.StatusOK || body["deleted"] != 1 || body["evicted"] != 1 {
+		t.Errorf("Expected 1 entry deleted and 1 result evicted, got %d %v", code, body)
+	}
+	if code, body := remove("email=Nobody@partner.mock"); code != http.StatusOK || body["deleted"] != 1 || body["evicted"] != 1 {
+		t.Errorf("Expected 1 entry deleted and 1 result evicted, got %d %v", code, body)
+	}
+	if n := history.Len(); n != 0 {
+		t.Errorf("Expected an empty history, got %d entries", n)
+	}
+	if cached := verifyCache.Get(verify.DefaultTenant, "jane@partner.mock", cacheVariant("jane@partner.mock", "", verify.MustParseChecks(verify.CheckSMTP), "", false)); cached != nil {
+		t.Error("Expected the cached result to be evicted")
+	}
+}
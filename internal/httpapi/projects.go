@@ -0,0 +1,374 @@
+package httpapi
+
+import (
+	"encoding/json"
+	"errors"
+	"math"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"email-verifier/pkg/verify"
+)
+
+// maxProjectRuns bounds the runs kept per project; the oldest go first.
+const maxProjectRuns = 100
+
+var errProjectName = errors.New("name is required")
+
+// projectRun summarizes one job run under a project. The summary outlives
+// the job itself, which expires after -job-ttl.
+type projectRun struct {
+	JobID           string         `json:"job_id"`
+	Status          string         `json:"status"`
+	StartedAt       time.Time      `json:"started_at"`
+	FinishedAt      *time.Time     `json:"finished_at,omitempty"`
+	Total           int            `json:"total"`
+	Completed       int            `json:"completed"`
+	Verdicts        map[string]int `json:"verdicts"`
+	DeliverableRate float64        `json:"deliverable_rate"`
+}
+
+// projectStats aggregates a project's finished runs.
+type projectStats struct {
+	Runs            int            `json:"runs"`
+	Addresses       int            `json:"addresses"`
+	Verdicts        map[string]int `json:"verdicts"`
+	DeliverableRate float64        `json:"deliverable_rate"`
+	// DeliverableChange is the latest run's rate less the one before it.
+	DeliverableChange *float64 `json:"deliverable_change,omitempty"`
+}
+
+// project groups the list jobs of a recurring exercise, such as a monthly
+// list cleaning, and remembers the checks and profile its runs use.
+type project struct {
+	ID        string       `json:"id"`
+	Name      string       `json:"name"`
+	Checks    []string     `json:"checks,omitempty"`
+	Profile   string       `json:"profile,omitempty"`
+	CreatedAt time.Time    `json:"created_at"`
+	Runs      []projectRun `json:"runs"`
+	Stats     projectStats `json:"stats"`
+
+	tenant string
+}
+
+// projectFields are the settable fields of a project; nil leaves a field
+// as it is on update.
+type projectFields struct {
+	Name    *string    `json:"name"`
+	Checks  *checkList `json:"checks"`
+	Profile *string    `json:"profile"`
+}
+
+// projectStore owns the projects of every tenant.
+type projectStore struct {
+	mu       sync.Mutex
+	projects map[string]*project
+	now      func() time.Time
+}
+
+var projects = newProjectStore()
+
+func newProjectStore() *projectStore {
+	return &projectStore{projects: make(map[string]*project), now: time.Now}
+}
+
+// apply validates fields and sets them on p.
+func (f projectFields) apply(p *project) error {
+	if f.Name != nil {
+		p.Name = strings.TrimSpace(*f.Name)
+	}
+	if p.Name == "" {
+		return errProjectName
+	}
+	if f.Checks != nil {
+		checks, err := verify.ParseChecks(*f.Checks...)
+		if err != nil {
+			return err
+		}
+		p.Checks = checks.Names()
+	}
+	if f.Profile != nil {
+		p.Profile = *f.Profile
+	}
+	return nil
+}
+
+// Create adds a project for tenant.
+func (ps *projectStore) Create(tenant string, fields projectFields) (project, error) {
+	p := &project{ID: newWatchID(), CreatedAt: ps.now(), Runs: []projectRun{}, tenant: tenant}
+	if err := fields.apply(p); err != nil {
+		return project{}, err
+	}
+	ps.mu.Lock()
+	defer ps.mu.Unlock()
+	ps.projects[p.ID] = p
+	return p.view(), nil
+}
+
+// lookup returns tenant's project id. Other tenants' projects are not
+// found. It must be called with the lock held.
+func (ps *projectStore) lookup(tenant, id string) *project {
+	if p := ps.projects[id]; p != nil && p.tenant == tenant {
+		return p
+	}
+	return nil
+}
+
+// Get returns tenant's project id.
+func (ps *projectStore) Get(tenant, id string) (project, bool) {
+	ps.mu.Lock()
+	defer ps.mu.Unlock()
+	p := ps.lookup(tenant, id)
+	if p == nil {
+		return project{}, false
+	}
+	return p.view(), true
+}
+
+// List returns tenant's projects by name, without their runs.
+func (ps *projectStore) List(tenant string) []project {
+	ps.mu.Lock()
+	defer ps.mu.Unlock()
+	list := []project{}
+	for _, p := range ps.projects {
+		if p.tenant == tenant {
+			v := p.view()
+			v.Runs = nil
+			list = append(list, v)
+		}
+	}
+	sort.Slice(list, func(i, j int) bool {
+		if list[i].Name != list[j].Name {
+			return list[i].Name < list[j].Name
+		}
+		return list[i].ID < list[j].ID
+	})
+	return list
+}
+
+// Update changes tenant's project id by fields.
+func (ps *projectStore) Update(tenant, id string, fields projectFields) (project, bool, error) {
+	ps.mu.Lock()
+	defer ps.mu.Unlock()
+	p := ps.lookup(tenant, id)
+	if p == nil {
+		return project{}, false, nil
+	}
+	updated := *p
+	if err := fields.apply(&updated); err != nil {
+		return project{}, true, err
+	}
+	*p = updated
+	return p.view(), true, nil
+}
+
+// Delete removes tenant's project id. Its running jobs finish unrecorded.
+func (ps *projectStore) Delete(tenant, id string) bool {
+	ps.mu.Lock()
+	defer ps.mu.Unlock()
+	if ps.lookup(tenant, id) == nil {
+		return false
+	}
+	delete(ps.projects, id)
+	return true
+}
+
+// StartRun records that job started under project id.
+func (ps *projectStore) StartRun(id, jobID string, total int, at time.Time) {
+	ps.mu.Lock()
+	defer ps.mu.Unlock()
+	p := ps.projects[id]
+	if p == nil {
+		return
+	}
+	p.Runs = append(p.Runs, projectRun{JobID: jobID, Status: jobRunning, StartedAt: at, Total: total, Verdicts: map[string]int{}})
+	if over := len(p.Runs) - maxProjectRuns; over > 0 {
+		p.Runs = append([]projectRun(nil), p.Runs[over:]...)
+	}
+}
+
+// FinishRun summarizes a finished job's results into its run.
+func (ps *projectStore) FinishRun(id, jobID, status string, at time.Time, results []*verify.Result) {
+	ps.mu.Lock()
+	defer ps.mu.Unlock()
+	p := ps.projects[id]
+	if p == nil {
+		return
+	}
+	for i := range p.Runs {
+		run := &p.Runs[i]
+		if run.JobID != jobID {
+			continue
+		}
+		run.Status = status
+		run.FinishedAt = &at
+		run.Completed = len(results)
+		run.Verdicts = map[string]int{}
+		for _, result := range results {
+			run.Verdicts[result.Verdict]++
+		}
+		run.DeliverableRate = rate(run.Verdicts[verify.VerdictDeliverable], run.Completed)
+		return
+	}
+}
+
+// view copies p with its stats computed. It must be called with the lock
+// held.
+func (p *project) view() project {
+	v := *p
+	v.Checks = append([]string(nil), p.Checks...)
+	v.Runs = make([]projectRun, len(p.Runs))
+	stats := projectStats{Verdicts: map[string]int{}}
+	deliverable := 0
+	var rates []float64
+	for i, run := range p.Runs {
+		run.Verdicts = copyCounts(run.Verdicts)
+		v.Runs[i] = run
+		if run.FinishedAt == nil {
+			continue
+		}
+		stats.Runs++
+		stats.Addresses += run.Completed
+		for verdict, n := range run.Verdicts {
+			stats.Verdicts[verdict] += n
+		}
+		deliverable += run.Verdicts[verify.VerdictDeliverable]
+		rates = append(rates, run.DeliverableRate)
+	}
+	stats.DeliverableRate = rate(deliverable, stats.Addresses)
+	if n := len(rates); n >= 2 {
+		change := math.Round((rates[n-1]-rates[n-2])*1000) / 1000
+		stats.DeliverableChange = &change
+	}
+	v.Stats = stats
+	return v
+}
+
+// Running reports whether any of the project's runs is still going.
+func (p project) Running() bool {
+	for _, run := range p.Runs {
+		if run.FinishedAt == nil {
+			return true
+		}
+	}
+	return false
+}
+
+// rate is n of total as a fraction rounded to three places.
+func rate(n, total int) float64 {
+	if total == 0 {
+		return 0
+	}
+	return math.Round(float64(n)/float64(total)*1000) / 1000
+}
+
+func copyCounts(counts map[string]int) map[string]int {
+	copied := make(map[string]int, len(counts))
+	for k, n := range counts {
+		copied[k] = n
+	}
+	return copied
+}
+
+// projectsHandler lists the caller's projects (GET) or creates one (POST).
+func projectsHandler(w http.ResponseWriter, r *http.Request) {
+	tenant := service.TenantFor(requestKey(r))
+	switch r.Method {
+	case http.MethodGet:
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{"projects": projects.List(tenant)})
+	case http.MethodPost:
+		var fields projectFields
+		if err := json.NewDecoder(r.Body).Decode(&fields); err != nil {
+			http.Error(w, "Invalid JSON", http.StatusBadRequest)
+			return
+		}
+		p, err := projects.Create(tenant, fields)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Location", "/api/projects/"+p.ID)
+		w.WriteHeader(http.StatusCreated)
+		json.NewEncoder(w).Encode(p)
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// projectHandler shows (GET), updates (PATCH) or deletes (DELETE) one of
+// the caller's projects.
+func projectHandler(w http.ResponseWriter, r *http.Request) {
+	tenant := service.TenantFor(requestKey(r))
+	id := r.PathValue("id")
+	var (
+		p     project
+		found bool
+		err   error
+	)
+	switch r.Method {
+	case http.MethodGet:
+		p, found = projects.Get(tenant, id)
+	case http.MethodPatch:
+		var fields projectFields
+		if err := json.NewDecoder(r.Body).Decode(&fields); err != nil {
+			http.Error(w, "Invalid JSON", http.StatusBadRequest)
+			return
+		}
+		p, found, err = projects.Update(tenant, id, fields)
+	case http.MethodDelete:
+		if !projects.Delete(tenant, id) {
+			http.Error(w, "Project not found", http.StatusNotFound)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+		return
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	switch {
+	case !found:
+		http.Error(w, "Project not found", http.StatusNotFound)
+	case err != nil:
+		http.Error(w, err.Error(), http.StatusBadRequest)
+	default:
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(withLiveRuns(p))
+	}
+}
+
+// withLiveRuns fills in the progress of p's running jobs.
+func withLiveRuns(p project) project {
+	for i, run := range p.Runs {
+		if run.FinishedAt != nil {
+			continue
+		}
+		if view, ok := jobs.Get(run.JobID, pageRequest{limit: 1}); ok {
+			p.Runs[i].Completed = view.Completed
+		}
+	}
+	return p
+}
+
+// projectsPageHandler renders the project list.
+func projectsPageHandler(w http.ResponseWriter, r *http.Request) {
+	tenant := service.TenantFor(requestKey(r))
+	renderPage(w, r, "projects.html", projects.List(tenant))
+}
+
+// projectPageHandler renders a project's trend and runs. While a run is
+// in progress the page polls /api/projects/{id}.
+func projectPageHandler(w http.ResponseWriter, r *http.Request) {
+	p, ok := projects.Get(service.TenantFor(requestKey(r)), r.PathValue("id"))
+	if !ok {
+		http.Error(w, "Project not found", http.StatusNotFound)
+		return
+	}
+	renderPage(w, r, "project.html", withLiveRuns(p))
+}
@@ -0,0 +1,188 @@
+package httpapi
+
+import (
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"email-verifier/pkg/verify"
+	"email-verifier/pkg/verify/verifytest"
+)
+
+// useProjects gives a test its own project store and job registry, with tenants a and b and a mail server at partner.mock
+func useProjects(t *testing.T) *verifytest.SMTP {
+	t.Helper()
+	fake := verifytest.NewResolver()
+	fake.MX["partner.mock"] = []*net.MX{{Host: "mx.partner.mock.", Pref: 10}}
+	smtp := verifytest.NewSMTP()
+	// The runs probe more than the etiquette's per-minute host rate
+	useService(t, verify.Config{Resolver: fake, Prober: smtp.Probe, Polite: verify.PoliteConfig{Off: true}, Tenants: map[string]verify.Tenant{
+		"a": {Keys: []string{"ka"}},
+		"b": {Keys: []string{"kb"}},
+	}})
+	savedProjects, savedJobs := projects, jobs
+	projects, jobs = newProjectStore(), newJobRegistry()
+	t.Cleanup(func() {
+		jobs.Wait()
+		projects, jobs = savedProjects, savedJobs
+	})
+	return smtp
+}
+
+// projectRequest sends body to path as key and decodes the JSON answer into out
+func projectRequest(t *testing.T, method, path, key, body string, out interface{}) int {
+	t.Helper()
+	req := httptest.NewRequest(method, path, strings.NewReader(body))
+	req.Header.Set("X-API-Key", key)
+	rec := httptest.NewRecorder()
+	Handler().ServeHTTP(rec, req)
+	if out != nil && rec.Code < 300 {
+		if err := json.NewDecoder(rec.Body).Decode(out); err != nil {
+			t.Fatalf("Expected JSON from %s %s, got %v", method, path, err)
+		}
+	}
+	return rec.Code
+}
+
+// TestProjectCRUD tests creating, listing, updating and deleting projects, scoped to the caller's tenant
+func TestProjectCRUD(t *testing.T) {
+	useProjects(t)
+
+	var created project
+	if code := projectRequest(t, http.MethodPost, "/api/projects", "ka", `{"name": " Monthly cleanup ", "checks": "smtp", "profile": "bulk"}`, &created); code != http.StatusCreated {
+		t.Fatalf("Expected 201, got %d", code)
+	}
+	if created.Name != "Monthly cleanup" || created.Profile != "bulk" || strings.Join(created.Checks, ",") != "syntax,mx,smtp" {
+		t.Errorf("Expected the trimmed name, profile and resolved checks, got %+v", created)
+	}
+
+	var list struct{ Projects []project }
+	projectRequest(t, http.MethodGet, "/api/projects", "ka", "", &list)
+	if len(list.Projects) != 1 || list.Projects[0].ID != created.ID {
+		t.Errorf("Expected tenant a's project listed, got %+v", list.Projects)
+	}
+	projectRequest(t, http.MethodGet, "/api/projects", "kb", "", &list)
+	if len(list.Projects) != 0 {
+		t.Errorf("Expected tenant b to see no projects, got %+v", list.Projects)
+	}
+	path := "/api/projects/" + created.ID
+	if code := projectRequest(t, http.MethodGet, path, "kb", "", nil); code != http.StatusNotFound {
+		t.Errorf("Expected 404 for another tenant's project, got %d", code)
+	}
+	if code := projectRequest(t, http.MethodDelete, path, "kb", "", nil); code != http.StatusNotFound {
+		t.Errorf("Expected another tenant's delete to 404, got %d", code)
+	}
+
+	var updated project
+	if code := projectRequest(t, http.MethodPatch, path, "ka", `{"name": "Quarterly cleanup"}`, &updated); code != http.StatusOK {
+		t.Fatalf("Expected 200, got %d", code)
+	}
+	if updated.Name != "Quarterly cleanup" || updated.Profile != "bulk" || len(updated.Checks) == 0 {
+		t.Errorf("Expected only the name changed, got %+v", updated)
+	}
+
+	invalid := []struct{ method, path, body string }{
+		{http.MethodPost, "/api/projects", `{"name": ""}`},
+		{http.MethodPost, "/api/projects", `{"name": "x", "checks": "telepathy"}`},
+		{http.MethodPatch, path, `{"name": "  "}`},
+		{http.MethodPost, "/api/projects", `not json`},
+	}
+	for _, tc := range invalid {
+		if code := projectRequest(t, tc.method, tc.path, "ka", tc.body, nil); code != http.StatusBadRequest {
+			t.Errorf("Expected 400 for %s %s, got %d", tc.method, tc.body, code)
+		}
+	}
+	projectRequest(t, http.MethodGet, path, "ka", "", &updated)
+	if updated.Name != "Quarterly cleanup" {
+		t.Errorf("Expected a rejected update to change nothing, got %q", updated.Name)
+	}
+
+	if code := projectRequest(t, http.MethodDelete, path, "ka", "", nil); code != http.StatusNoContent {
+		t.Errorf("Expected 204, got %d", code)
+	}
+	if code := projectRequest(t, http.MethodGet, path, "ka", "", nil); code != http.StatusNotFound {
+		t.Errorf("Expected the deleted project gone, got %d", code)
+	}
+}
+
+// runList submits a job of n addresses under project id, the first deliverable of which exist
+func runList(t *testing.T, smtp *verifytest.SMTP, id string, run, n, deliverable int) {
+	t.Helper()
+	emails := make([]string, n)
+	for i := range emails {
+		emails[i] = fmt.Sprintf("run%d.user%d@partner.mock", run, i)
+		smtp.Mailboxes[emails[i]] = i < deliverable
+	}
+	body, _ := json.Marshal(map[string]interface{}{"emails": emails, "project": id})
+	var view jobView
+	if code := projectRequest(t, http.MethodPost, "/api/jobs", "ka", string(body), &view); code != http.StatusAccepted {
+		t.Fatalf("Expected 202, got %d", code)
+	}
+	jobs.Wait()
+}
+
+// TestProjectRunAggregation tests that a project's runs use its checks and are aggregated across runs
+func TestProjectRunAggregation(t *testing.T) {
+	smtp := useProjects(t)
+	created, _ := projects.Create("a", projectFields{Name: ptr("Newsletter"), Checks: &checkList{"smtp"}})
+
+	runList(t, smtp, created.ID, 1, 4, 2)
+	runList(t, smtp, created.ID, 2, 6, 6)
+	runList(t, smtp, created.ID, 3, 10, 5)
+
+	var p project
+	projectRequest(t, http.MethodGet, "/api/projects/"+created.ID, "ka", "", &p)
+	if len(p.Runs) != 3 {
+		t.Fatalf("Expected 3 runs, got %+v", p.Runs)
+	}
+	rates := []float64{0.5, 1, 0.5}
+	for i, run := range p.Runs {
+		if run.Status != jobDone || run.FinishedAt == nil || run.DeliverableRate != rates[i] {
+			t.Errorf("Expected run %d done at %v, got %+v", i, rates[i], run)
+		}
+	}
+	if p.Runs[2].Verdicts[verify.VerdictDeliverable] != 5 || p.Runs[2].Verdicts[verify.VerdictUndeliverable] != 5 {
+		t.Errorf("Expected the smtp check to split the third run, got %v", p.Runs[2].Verdicts)
+	}
+	stats := p.Stats
+	if stats.Runs != 3 || stats.Addresses != 20 || stats.Verdicts[verify.VerdictDeliverable] != 13 || stats.DeliverableRate != 0.65 {
+		t.Errorf("Expected 13 of 20 deliverable over 3 runs, got %+v", stats)
+	}
+	if stats.DeliverableChange == nil || *stats.DeliverableChange != -0.5 {
+		t.Errorf("Expected a change of -0.5, got %v", stats.DeliverableChange)
+	}
+
+	// Another tenant's key can't run jobs under the project
+	body := `{"emails": ["x@partner.mock"], "project": "` + created.ID + `"}`
+	if code := projectRequest(t, http.MethodPost, "/api/jobs", "kb", body, nil); code != http.StatusNotFound {
+		t.Errorf("Expected 404 for another tenant's project, got %d", code)
+	}
+}
+
+// TestProjectPages tests that the project list and detail pages render the aggregated stats
+func TestProjectPages(t *testing.T) {
+	smtp := useProjects(t)
+	created, _ := projects.Create(verify.DefaultTenant, projectFields{Name: ptr("Cleanup <monthly>"), Checks: &checkList{"smtp"}})
+	body, _ := json.Marshal(map[string]interface{}{"emails": []string{"jane@partner.mock", "john@partner.mock"}, "project": created.ID})
+	smtp.Mailboxes["jane@partner.mock"] = true
+	projectRequest(t, http.MethodPost, "/api/jobs", "", string(body), nil)
+	jobs.Wait()
+
+	page := getPage(t, "/projects", "", "")
+	if !strings.Contains(page, "Cleanup &lt;monthly&gt;") || !strings.Contains(page, "/projects/"+created.ID) || !strings.Contains(page, "50%") {
+		t.Error("Expected the project listed with its deliverable rate")
+	}
+	page = getPage(t, "/projects/"+created.ID, "", "")
+	if !strings.Contains(page, "height: 50%") || !strings.Contains(page, "2</span> of 2") {
+		t.Error("Expected the trend bar and the run")
+	}
+	if code := projectRequest(t, http.MethodGet, "/projects/"+created.ID, "ka", "", nil); code != http.StatusNotFound {
+		t.Errorf("Expected another tenant's project page to 404, got %d", code)
+	}
+}
+
+func ptr[T any](v T) *T { return &v }
@@ -0,0 +1,141 @@
+package httpapi
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"strings"
+
+	"email-verifier/pkg/verify"
+)
+
+// How pseudonymized exports show domains.
+const (
+	domainsClear    = "clear"    // the domain as verified
+	domainsProvider = "provider" // disposable, free, business or invalid
+	domainsHidden   = "hidden"   // left out
+)
+
+// pseudonymKey is one of a tenant's secrets for pseudonymized exports.
+type pseudonymKey struct {
+	ID     string `json:"id"`
+	Secret string `json:"secret"`
+}
+
+// pseudonymKeys maps each tenant to its secrets, current first. A tenant
+// without secrets can't export pseudonymized.
+var pseudonymKeys map[string][]pseudonymKey
+
+// loadPseudonymKeys reads a JSON object mapping tenants to their secrets,
+// current first.
+func loadPseudonymKeys(path string) (map[string][]pseudonymKey, error) {
+	if path == "" {
+		return nil, nil
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var keys map[string][]pseudonymKey
+	if err := json.Unmarshal(data, &keys); err != nil {
+		return nil, fmt.Errorf("parse pseudonym config %s: %v", path, err)
+	}
+	for tenant, list := range keys {
+		seen := make(map[string]bool, len(list))
+		for _, key := range list {
+			if key.ID == "" || strings.ContainsAny(key.ID, ":; ") || len(key.Secret) < 16 {
+				return nil, fmt.Errorf("pseudonym config %s: tenant %q needs an id without spaces, colons or semicolons and a secret of at least 16 bytes for every key", path, tenant)
+			}
+			if seen[key.ID] {
+				return nil, fmt.Errorf("pseudonym config %s: tenant %q lists key %q twice", path, tenant, key.ID)
+			}
+			seen[key.ID] = true
+		}
+	}
+	return keys, nil
+}
+
+// pseudonymizer replaces addresses in an export with HMAC-SHA256 tokens
+// under one tenant secret. The same address always gets the same token
+// under the same secret, so exports can be joined without raw addresses.
+type pseudonymizer struct {
+	keyID   string
+	secret  []byte
+	domains string
+}
+
+// parsePseudonymizer reads the pseudonymize, domains and pseudonym_key
+// parameters. It returns nil when the export should show addresses.
+// pseudonym_key picks an older secret of tenant's, for re-keying.
+func parsePseudonymizer(query url.Values, tenant string) (*pseudonymizer, error) {
+	if query.Get("pseudonymize") != "true" {
+		return nil, nil
+	}
+	p := &pseudonymizer{domains: domainsClear}
+	switch domains := query.Get("domains"); domains {
+	case "":
+	case domainsClear, domainsProvider, domainsHidden:
+		p.domains = domains
+	default:
+		return nil, errors.New("domains must be clear, provider or hidden")
+	}
+
+	keys := pseudonymKeys[tenant]
+	if len(keys) == 0 {
+		return nil, errors.New("no pseudonym secret is configured for this tenant")
+	}
+	key := keys[0]
+	if id := query.Get("pseudonym_key"); id != "" {
+		found := false
+		for _, candidate := range keys {
+			if candidate.ID == id {
+				key, found = candidate, true
+			}
+		}
+		if !found {
+			return nil, errors.New("unknown pseudonym_key")
+		}
+	}
+	p.keyID, p.secret = key.ID, []byte(key.Secret)
+	return p, nil
+}
+
+// Token returns the address's token, prefixed with the secret's ID so
+// tokens from different secrets are never mistaken for each other.
+func (p *pseudonymizer) Token(email string) string {
+	mac := hmac.New(sha256.New, p.secret)
+	mac.Write([]byte(verify.AddressKey(email)))
+	return p.keyID + ":" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// Domain returns the result's domain as the mode shows it.
+func (p *pseudonymizer) Domain(result *verify.Result) string {
+	switch p.domains {
+	case domainsClear:
+		return strings.ToLower(result.Domain)
+	case domainsProvider:
+		switch {
+		case !result.IsValid:
+			return "invalid"
+		case result.Disposable:
+			return "disposable"
+		case result.Free:
+			return "free"
+		}
+		return "business"
+	}
+	return ""
+}
+
+// String describes the mode for the export's header line.
+func (p *pseudonymizer) String() string {
+	if p == nil {
+		return "clear"
+	}
+	return fmt.Sprintf("hmac-sha256 key=%s domains=%s", p.keyID, p.domains)
+}
@@ -0,0 +1,210 @@
+package httpapi
+
+import (
+	"bytes"
+	"encoding/csv"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"email-verifier/pkg/verify"
+)
+
+// usePseudonymKeys installs tenant secrets for the duration of a test
+func usePseudonymKeys(t *testing.T) {
+	t.Helper()
+	saved := pseudonymKeys
+	pseudonymKeys = map[string][]pseudonymKey{
+		"a":                  {{ID: "a2", Secret: "tenant-a-secret-2024-06"}, {ID: "a1", Secret: "tenant-a-secret-2024-01"}},
+		"b":                  {{ID: "b1", Secret: "tenant-b-secret-2024-01"}},
+		verify.DefaultTenant: {{ID: "d1", Secret: "default-tenant-secret"}},
+	}
+	t.Cleanup(func() { pseudonymKeys = saved })
+}
+
+// mustPseudonymizer parses query for tenant, failing the test on error
+func mustPseudonymizer(t *testing.T, query, tenant string) *pseudonymizer {
+	t.Helper()
+	values, _ := url.ParseQuery(query)
+	p, err := parsePseudonymizer(values, tenant)
+	if err != nil {
+		t.Fatalf("Failed to parse %q: %v", query, err)
+	}
+	return p
+}
+
+// TestPseudonymTokens tests that tokens are stable under one secret and diverge across tenants and rotated secrets
+func TestPseudonymTokens(t *testing.T) {
+	usePseudonymKeys(t)
+	current := mustPseudonymizer(t, "pseudonymize=true", "a")
+	again := mustPseudonymizer(t, "pseudonymize=true&domains=hidden", "a")
+	previous := mustPseudonymizer(t, "pseudonymize=true&pseudonym_key=a1", "a")
+	other := mustPseudonymizer(t, "pseudonymize=true", "b")
+
+	token := current.Token("jane@partner.com")
+	if !strings.HasPrefix(token, "a2:") || len(token) != len("a2:")+64 {
+		t.Fatalf("Expected a2: and 64 hex digits, got %q", token)
+	}
+	if got := again.Token(" Jane@Partner.com "); got != token {
+		t.Errorf("Expected the same token for the same address and secret, got %q and %q", token, got)
+	}
+	if current.Token("john@partner.com") == token {
+		t.Error("Expected different addresses to get different tokens")
+	}
+	for name, p := range map[string]*pseudonymizer{"rotated secret": previous, "other tenant": other} {
+		got := p.Token("jane@partner.com")
+		if got == token || got[strings.Index(got, ":"):] == token[strings.Index(token, ":"):] {
+			t.Errorf("Expected the %s to give an unrelated token, got %q for %q", name, got, token)
+		}
+	}
+}
+
+// TestParsePseudonymizer tests parameter validation
+func TestParsePseudonymizer(t *testing.T) {
+	usePseudonymKeys(t)
+	testCases := []struct {
+		query  string
+		tenant string
+		mode   string
+		err    bool
+	}{
+		{"", "a", "clear", false},
+		{"pseudonymize=false", "a", "clear", false},
+		{"pseudonymize=true", "a", "hmac-sha256 key=a2 domains=clear", false},
+		{"pseudonymize=true&domains=provider&pseudonym_key=a1", "a", "hmac-sha256 key=a1 domains=provider", false},
+		{"pseudonymize=true&domains=partial", "a", "", true},
+		{"pseudonymize=true&pseudonym_key=b1", "a", "", true},
+		{"pseudonymize=true", "unconfigured", "", true},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.query+" for "+tc.tenant, func(t *testing.T) {
+			values, _ := url.ParseQuery(tc.query)
+			p, err := parsePseudonymizer(values, tc.tenant)
+			if (err != nil) != tc.err {
+				t.Fatalf("Expected error: %v, got %v", tc.err, err)
+			}
+			if err == nil && p.String() != tc.mode {
+				t.Errorf("Expected mode %q, got %q", tc.mode, p.String())
+			}
+		})
+	}
+}
+
+// TestPseudonymizedCSV tests that pseudonymized exports hold no raw addresses and show domains as asked
+func TestPseudonymizedCSV(t *testing.T) {
+	usePseudonymKeys(t)
+	generated := time.Date(2024, 3, 3, 12, 0, 0, 0, time.UTC)
+	results := append(seededResults(), &verify.Result{Email: "jane@gmail.com", Domain: "gmail.com", IsValid: true, Free: true, Verdict: verify.VerdictDeliverable})
+
+	testCases := []struct {
+		domains string
+		column  []string
+	}{
+		{domainsClear, []string{"example.com", "example.org", "mailinator.com", "exampel.com", "gmail.com"}},
+		{domainsProvider, []string{"business", "business", "disposable", "business", "free"}},
+		{domainsHidden, []string{"", "", "", "", ""}},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.domains, func(t *testing.T) {
+			p := mustPseudonymizer(t, "pseudonymize=true&domains="+tc.domains, "a")
+			var buf bytes.Buffer
+			if err := writeResultsCSV(&buf, results, resultFilter{}, p, generated); err != nil {
+				t.Fatalf("Failed to write CSV: %v", err)
+			}
+			for _, result := range results {
+				if strings.Contains(buf.String(), result.Email) {
+					t.Errorf("Expected no raw addresses, found %s", result.Email)
+				}
+			}
+
+			comment, body, _ := strings.Cut(buf.String(), "\n")
+			if want := "# filters: none; addresses: hmac-sha256 key=a2 domains=" + tc.domains + "; generated_at: 2024-03-03T12:00:00Z"; comment != want {
+				t.Errorf("Expected comment %q, got %q", want, comment)
+			}
+			rows, err := csv.NewReader(strings.NewReader(body)).ReadAll()
+			if err != nil {
+				t.Fatalf("Failed to parse CSV: %v", err)
+			}
+			if rows[0][0] != "email_token" || rows[0][1] != "domain" {
+				t.Errorf("Expected email_token and domain columns, got %v", rows[0][:2])
+			}
+			for i, want := range tc.column {
+				if got := rows[i+1][1]; got != want {
+					t.Errorf("Expected domain %q in row %d, got %q", want, i+1, got)
+				}
+				if got := rows[i+1][0]; got != p.Token(results[i].Email) {
+					t.Errorf("Expected the address token in row %d, got %q", i+1, got)
+				}
+			}
+		})
+	}
+}
+
+// TestJobExport tests the job CSV download, pseudonymized under the submitting tenant's secret
+func TestJobExport(t *testing.T) {
+	registry := useJobs(t, 50)
+	usePseudonymKeys(t)
+	id := registry.Start([]string{"jane@example.com", "not-an-address"}, verify.Options{Checks: verify.DefaultChecks.WithoutNetwork()})
+	registry.Wait()
+
+	get := func(query string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, "/api/jobs/"+id+"/export?"+query, nil)
+		req.SetPathValue("id", id)
+		rec := httptest.NewRecorder()
+		jobExportHandler(rec, req)
+		return rec
+	}
+
+	rec := get("verdict=invalid")
+	if rec.Code != http.StatusOK || !strings.Contains(rec.Body.String(), "not-an-address") || strings.Contains(rec.Body.String(), "jane@example.com") {
+		t.Errorf("Expected a filtered clear export, got %d: %s", rec.Code, rec.Body.String())
+	}
+	if !strings.HasPrefix(rec.Header().Get("Content-Type"), "text/csv") {
+		t.Errorf("Expected CSV, got %q", rec.Header().Get("Content-Type"))
+	}
+
+	rec = get("pseudonymize=true")
+	token := (&pseudonymizer{keyID: "d1", secret: []byte("default-tenant-secret")}).Token("jane@example.com")
+	if rec.Code != http.StatusOK || !strings.Contains(rec.Body.String(), token) || strings.Contains(rec.Body.String(), "jane@") {
+		t.Errorf("Expected the default tenant's token for jane, got %d: %s", rec.Code, rec.Body.String())
+	}
+
+	if rec := get("pseudonymize=true&domains=partial"); rec.Code != http.StatusBadRequest {
+		t.Errorf("Expected status 400 for an unknown domains mode, got %d", rec.Code)
+	}
+}
+
+// TestLoadPseudonymKeys tests secret config validation
+func TestLoadPseudonymKeys(t *testing.T) {
+	testCases := []struct {
+		name    string
+		config  string
+		wantErr bool
+	}{
+		{"valid", `{"a":[{"id":"2024-06","secret":"0123456789abcdef"},{"id":"2024-01","secret":"fedcba9876543210"}]}`, false},
+		{"short secret", `{"a":[{"id":"k","secret":"short"}]}`, true},
+		{"missing id", `{"a":[{"secret":"0123456789abcdef"}]}`, true},
+		{"id with colon", `{"a":[{"id":"k:1","secret":"0123456789abcdef"}]}`, true},
+		{"duplicate id", `{"a":[{"id":"k","secret":"0123456789abcdef"},{"id":"k","secret":"fedcba9876543210"}]}`, true},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "pseudonyms.json")
+			if err := os.WriteFile(path, []byte(tc.config), 0o644); err != nil {
+				t.Fatal(err)
+			}
+			_, err := loadPseudonymKeys(path)
+			if (err != nil) != tc.wantErr {
+				t.Errorf("Expected error: %v, got %v", tc.wantErr, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,212 @@
+package httpapi
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"net"
+	"net/http"
+	"net/netip"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+var rateLimited = metrics.CounterVec("rate_limited_total", "API requests refused by the per-client rate limit.", "group")
+
+// rateLimiter gives every client a token bucket holding up to burst
+// requests and refilled at perMinute. Clients are keyed by IP address.
+type rateLimiter struct {
+	mu        sync.Mutex
+	perMinute int
+	burst     int
+	buckets   map[string]*tokenBucket
+	now       func() time.Time
+}
+
+type tokenBucket struct {
+	tokens  float64
+	updated time.Time
+}
+
+// rateLimit is nil unless -rate-limit is positive.
+var rateLimit *rateLimiter
+
+// trustedProxies are the addresses whose X-Forwarded-For is believed.
+var trustedProxies []netip.Prefix
+
+func newRateLimiter(perMinute, burst int) *rateLimiter {
+	if burst <= 0 {
+		burst = perMinute
+	}
+	return &rateLimiter{perMinute: perMinute, burst: burst, buckets: make(map[string]*tokenBucket), now: time.Now}
+}
+
+// rateDecision is the outcome of one request against its client's bucket.
+type rateDecision struct {
+	allowed   bool
+	remaining int
+	// reset is how long until the bucket is full again; retryAfter, for
+	// a refused request, until it holds a token.
+	reset      time.Duration
+	retryAfter time.Duration
+}
+
+// take spends one of client's tokens if it has one.
+func (l *rateLimiter) take(client string) rateDecision {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	now := l.now()
+	b := l.buckets[client]
+	if b == nil {
+		b = &tokenBucket{tokens: float64(l.burst), updated: now}
+		l.buckets[client] = b
+	}
+	l.refill(b, now)
+	d := rateDecision{allowed: b.tokens >= 1}
+	if d.allowed {
+		b.tokens--
+	} else {
+		d.retryAfter = l.refillTime(1 - b.tokens)
+	}
+	d.remaining = int(b.tokens)
+	d.reset = l.refillTime(float64(l.burst) - b.tokens)
+	return d
+}
+
+func (l *rateLimiter) refill(b *tokenBucket, now time.Time) {
+	b.tokens = math.Min(float64(l.burst), b.tokens+now.Sub(b.updated).Minutes()*float64(l.perMinute))
+	b.updated = now
+}
+
+// refillTime is how long tokens take to come back.
+func (l *rateLimiter) refillTime(tokens float64) time.Duration {
+	return time.Duration(tokens / float64(l.perMinute) * float64(time.Minute))
+}
+
+// Sweep forgets clients whose buckets have filled up again, since a new
+// bucket would start the same, and returns how many.
+func (l *rateLimiter) Sweep(now time.Time) int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	dropped := 0
+	for client, b := range l.buckets {
+		l.refill(b, now)
+		if b.tokens >= float64(l.burst) {
+			delete(l.buckets, client)
+			dropped++
+		}
+	}
+	return dropped
+}
+
+// Len returns the number of clients tracked.
+func (l *rateLimiter) Len() int {
+	if l == nil {
+		return 0
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return len(l.buckets)
+}
+
+func init() {
+	metrics.GaugeFunc("rate_limit_clients", "Clients the API rate limiter is tracking.", func() int64 {
+		return int64(rateLimit.Len())
+	})
+}
+
+// parseTrustedProxies reads a comma-separated list of addresses and CIDR
+// ranges.
+func parseTrustedProxies(s string) ([]netip.Prefix, error) {
+	var prefixes []netip.Prefix
+	for _, entry := range strings.Split(s, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		if !strings.Contains(entry, "/") {
+			addr, err := netip.ParseAddr(entry)
+			if err != nil {
+				return nil, fmt.Errorf("trusted proxies: %q is not an address or CIDR range", entry)
+			}
+			prefixes = append(prefixes, netip.PrefixFrom(addr, addr.BitLen()))
+			continue
+		}
+		prefix, err := netip.ParsePrefix(entry)
+		if err != nil {
+			return nil, fmt.Errorf("trusted proxies: %q is not an address or CIDR range", entry)
+		}
+		prefixes = append(prefixes, prefix.Masked())
+	}
+	return prefixes, nil
+}
+
+func trusted(addr netip.Addr) bool {
+	for _, p := range trustedProxies {
+		if p.Contains(addr.Unmap()) {
+			return true
+		}
+	}
+	return false
+}
+
+// clientIP returns the address r came from. Behind trusted proxies it is
+// the nearest X-Forwarded-For hop that isn't one of them, since hops
+// further out could have been written by the client.
+func clientIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	addr, err := netip.ParseAddr(host)
+	if err != nil || !trusted(addr) {
+		return host
+	}
+	hops := strings.Split(strings.Join(r.Header.Values("X-Forwarded-For"), ","), ",")
+	for i := len(hops) - 1; i >= 0; i-- {
+		hop, err := netip.ParseAddr(strings.TrimSpace(hops[i]))
+		if err != nil {
+			break
+		}
+		addr = hop.Unmap()
+		if !trusted(addr) {
+			break
+		}
+	}
+	return addr.String()
+}
+
+// withRateLimit holds each client to the rate limit, answering 429 once
+// its bucket is empty. Every response says where the client stands.
+func withRateLimit(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if rateLimit == nil {
+			next.ServeHTTP(w, r)
+			return
+		}
+		d := rateLimit.take(clientIP(r))
+		w.Header().Set("X-RateLimit-Limit", strconv.Itoa(rateLimit.burst))
+		w.Header().Set("X-RateLimit-Remaining", strconv.Itoa(d.remaining))
+		w.Header().Set("X-RateLimit-Reset", strconv.Itoa(ceilSeconds(d.reset)))
+		if !d.allowed {
+			rateLimited.Add(string(groupAPI), 1)
+			retryAfter := ceilSeconds(d.retryAfter)
+			w.Header().Set("Retry-After", strconv.Itoa(retryAfter))
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusTooManyRequests)
+			json.NewEncoder(w).Encode(map[string]interface{}{
+				"error":       "rate_limited",
+				"detail":      fmt.Sprintf("Rate limit of %d requests per minute exceeded", rateLimit.perMinute),
+				"retry_after": retryAfter,
+			})
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+func ceilSeconds(d time.Duration) int {
+	return int(math.Ceil(d.Seconds()))
+}
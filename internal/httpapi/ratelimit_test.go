@@ -0,0 +1,143 @@
+package httpapi
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// useRateLimit limits clients to perMinute API requests in bursts of burst for the test, on a clock it returns
+func useRateLimit(t *testing.T, perMinute, burst int) *time.Time {
+	t.Helper()
+	now := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+	limiter := newRateLimiter(perMinute, burst)
+	limiter.now = func() time.Time { return now }
+	saved := rateLimit
+	rateLimit = limiter
+	t.Cleanup(func() { rateLimit = saved })
+	return &now
+}
+
+// useTrustedProxies trusts the proxies in list for the test
+func useTrustedProxies(t *testing.T, list string) {
+	t.Helper()
+	prefixes, err := parseTrustedProxies(list)
+	if err != nil {
+		t.Fatalf("Failed to parse proxies: %v", err)
+	}
+	saved := trustedProxies
+	trustedProxies = prefixes
+	t.Cleanup(func() { trustedProxies = saved })
+}
+
+// TestRateLimit tests that a client gets its burst, then 429 until its bucket refills, with the limit headers on every response
+func TestRateLimit(t *testing.T) {
+	useStreamService(t)
+	now := useRateLimit(t, 60, 2)
+	handler := Handler()
+	send := func(remoteAddr string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/api/verify", strings.NewReader(`{"email": "jane@partner.mock"}`))
+		req.RemoteAddr = remoteAddr
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		return rec
+	}
+
+	for i, remaining := range []string{"1", "0"} {
+		rec := send("203.0.113.7:4000")
+		if rec.Code != http.StatusOK || rec.Header().Get("X-RateLimit-Limit") != "2" || rec.Header().Get("X-RateLimit-Remaining") != remaining {
+			t.Errorf("Expected request %d allowed with %s remaining, got %d %v", i+1, remaining, rec.Code, rec.Header())
+		}
+	}
+	rec := send("203.0.113.7:4001")
+	var body struct {
+		Error      string `json:"error"`
+		Detail     string `json:"detail"`
+		RetryAfter int    `json:"retry_after"`
+	}
+	json.NewDecoder(rec.Body).Decode(&body)
+	if rec.Code != http.StatusTooManyRequests || body.Error != "rate_limited" || body.RetryAfter != 1 || rec.Header().Get("Retry-After") != "1" {
+		t.Errorf("Expected 429 rate_limited retrying after 1s, got %d %+v %v", rec.Code, body, rec.Header())
+	}
+	if reset := rec.Header().Get("X-RateLimit-Reset"); reset != "2" {
+		t.Errorf("Expected the bucket full again in 2s, got %s", reset)
+	}
+	if rec := send("198.51.100.2:4000"); rec.Code != http.StatusOK {
+		t.Errorf("Expected another client unaffected, got %d", rec.Code)
+	}
+	if rec := send("203.0.113.7:4000"); rec.Code != http.StatusTooManyRequests {
+		t.Errorf("Expected status 429 before the refill, got %d", rec.Code)
+	}
+
+	*now = now.Add(time.Second)
+	if rec := send("203.0.113.7:4000"); rec.Code != http.StatusOK {
+		t.Errorf("Expected a request allowed after the refill, got %d", rec.Code)
+	}
+	if rec := send("203.0.113.7:4000"); rec.Code != http.StatusTooManyRequests {
+		t.Errorf("Expected one token refilled, got %d", rec.Code)
+	}
+	if rec := send("203.0.113.7:4000"); rec.Code != http.StatusTooManyRequests {
+		t.Errorf("Expected one token refilled, got %d", rec.Code)
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/health", nil)
+	req.RemoteAddr = "203.0.113.7:4000"
+	health := httptest.NewRecorder()
+	handler.ServeHTTP(health, req)
+	if health.Code != http.StatusOK || health.Header().Get("X-RateLimit-Limit") != "" {
+		t.Errorf("Expected /health outside the limit, got %d %v", health.Code, health.Header())
+	}
+}
+
+// TestRateLimitSweep tests that clients are forgotten once their buckets are full again
+func TestRateLimitSweep(t *testing.T) {
+	now := useRateLimit(t, 60, 5)
+	rateLimit.take("203.0.113.7")
+	rateLimit.take("198.51.100.2")
+	rateLimit.take("198.51.100.2")
+	rateLimit.take("198.51.100.2")
+
+	if dropped := rateLimit.Sweep(now.Add(time.Second)); dropped != 1 || rateLimit.Len() != 1 {
+		t.Errorf("Expected the refilled client dropped, got %d dropped and %d left", dropped, rateLimit.Len())
+	}
+	if dropped := rateLimit.Sweep(now.Add(3 * time.Second)); dropped != 1 || rateLimit.Len() != 0 {
+		t.Errorf("Expected the other client dropped, got %d dropped and %d left", dropped, rateLimit.Len())
+	}
+}
+
+// TestClientIP tests that X-Forwarded-For is only believed from trusted proxies, up to the first hop that isn't one
+func TestClientIP(t *testing.T) {
+	testCases := []struct {
+		remoteAddr   string
+		forwardedFor string
+		trusted      string
+		expectedIP   string
+	}{
+		{"203.0.113.7:4000", "198.51.100.2", "", "203.0.113.7"},
+		{"203.0.113.7:4000", "198.51.100.2", "10.0.0.0/8", "203.0.113.7"},
+		{"10.0.0.5:4000", "198.51.100.2", "10.0.0.0/8", "198.51.100.2"},
+		{"10.0.0.5:4000", "1.2.3.4, 198.51.100.2, 10.0.0.9", "10.0.0.0/8", "198.51.100.2"},
+		{"10.0.0.5:4000", "10.0.0.8, 10.0.0.9", "10.0.0.0/8", "10.0.0.8"},
+		{"10.0.0.5:4000", "", "10.0.0.5", "10.0.0.5"},
+		{"10.0.0.5:4000", "garbage", "10.0.0.5", "10.0.0.5"},
+		{"[2001:db8::1]:4000", "2001:db8:ffff::2", "2001:db8::/64", "2001:db8:ffff::2"},
+	}
+	for _, tc := range testCases {
+		useTrustedProxies(t, tc.trusted)
+		req := httptest.NewRequest(http.MethodGet, "/api/verify", nil)
+		req.RemoteAddr = tc.remoteAddr
+		if tc.forwardedFor != "" {
+			req.Header.Set("X-Forwarded-For", tc.forwardedFor)
+		}
+		if ip := clientIP(req); ip != tc.expectedIP {
+			t.Errorf("Expected %s for %s via %s trusting %q, got %s", tc.expectedIP, tc.forwardedFor, tc.remoteAddr, tc.trusted, ip)
+		}
+	}
+
+	if _, err := parseTrustedProxies("10.0.0.0/8, proxy.internal"); err == nil {
+		t.Error("Expected an error for a host name")
+	}
+}
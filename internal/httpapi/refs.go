@@ -0,0 +1,208 @@
+package httpapi
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"slices"
+	"strings"
+	"time"
+
+	"email-verifier/pkg/verify"
+)
+
+// errRefNotFound is returned by resolvers that don't know a reference.
+var errRefNotFound = errors.New("reference not found")
+
+// addressResolver maps an opaque reference, such as a CRM contact ID, to an
+// address, so callers can verify contacts without handling the address.
+// Resolvers return errRefNotFound for references they don't know; any
+// other error is a lookup failure.
+type addressResolver interface {
+	Resolve(ctx context.Context, ref string) (string, error)
+}
+
+// refResolver is a configured resolver and the API keys it may show
+// resolved addresses to.
+type refResolver struct {
+	resolver   addressResolver
+	revealKeys []string
+}
+
+// refResolvers maps a reference's scheme, the part before the colon in
+// "crm:12345", to its resolver.
+var refResolvers map[string]refResolver
+
+// refResolverConfig is one entry of the resolvers config.
+type refResolverConfig struct {
+	Type string `json:"type"` // https or static
+
+	// URL, AuthHeader and AuthValue configure an https resolver.
+	URL        string `json:"url,omitempty"`
+	AuthHeader string `json:"auth_header,omitempty"`
+	AuthValue  string `json:"auth_value,omitempty"`
+
+	// File is a static resolver's JSON object mapping IDs to addresses.
+	File string `json:"file,omitempty"`
+
+	// RevealKeys may ask for the resolved address with ?include_address=true.
+	RevealKeys []string `json:"reveal_keys,omitempty"`
+}
+
+// loadRefResolvers reads a JSON object mapping reference schemes to
+// resolvers.
+func loadRefResolvers(path string) (map[string]refResolver, error) {
+	if path == "" {
+		return nil, nil
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var configs map[string]refResolverConfig
+	if err := json.Unmarshal(data, &configs); err != nil {
+		return nil, fmt.Errorf("parse ref resolvers %s: %v", path, err)
+	}
+	resolvers := make(map[string]refResolver, len(configs))
+	for scheme, cfg := range configs {
+		if scheme == "" || strings.Contains(scheme, ":") {
+			return nil, fmt.Errorf("ref resolvers %s: %q is not a valid scheme", path, scheme)
+		}
+		var resolver addressResolver
+		switch cfg.Type {
+		case "https":
+			u, err := url.Parse(cfg.URL)
+			if err != nil || u.Scheme != "https" || u.Host == "" {
+				return nil, fmt.Errorf("ref resolvers %s: scheme %q needs an https url", path, scheme)
+			}
+			resolver = &httpsAddressResolver{url: cfg.URL, authHeader: cfg.AuthHeader, authValue: cfg.AuthValue, client: newHTTPClient(10 * time.Second)}
+		case "static":
+			static, err := loadStaticAddresses(cfg.File)
+			if err != nil {
+				return nil, fmt.Errorf("ref resolvers %s: scheme %q: %v", path, scheme, err)
+			}
+			resolver = static
+		default:
+			return nil, fmt.Errorf("ref resolvers %s: scheme %q has unknown type %q: want https or static", path, scheme, cfg.Type)
+		}
+		resolvers[scheme] = refResolver{resolver: resolver, revealKeys: cfg.RevealKeys}
+	}
+	return resolvers, nil
+}
+
+// httpsAddressResolver POSTs {"ref": "..."} to a lookup endpoint, which
+// answers {"email": "..."}, or 404 for an unknown reference.
+type httpsAddressResolver struct {
+	url        string
+	authHeader string
+	authValue  string
+	client     *http.Client
+}
+
+func (r *httpsAddressResolver) Resolve(ctx context.Context, ref string) (string, error) {
+	body, _ := json.Marshal(map[string]string{"ref": ref})
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, r.url, bytes.NewReader(body))
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if r.authHeader != "" {
+		req.Header.Set(r.authHeader, r.authValue)
+	}
+	resp, err := r.client.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	switch resp.StatusCode {
+	case http.StatusOK:
+	case http.StatusNotFound:
+		return "", errRefNotFound
+	default:
+		return "", fmt.Errorf("lookup endpoint returned status %d", resp.StatusCode)
+	}
+	var answer struct {
+		Email string `json:"email"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&answer); err != nil {
+		return "", fmt.Errorf("parse lookup response: %v", err)
+	}
+	if answer.Email == "" {
+		return "", errRefNotFound
+	}
+	return answer.Email, nil
+}
+
+// staticAddressResolver answers from a fixed map of IDs, the part of the
+// reference after the scheme, to addresses.
+type staticAddressResolver map[string]string
+
+func loadStaticAddresses(path string) (staticAddressResolver, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var addresses staticAddressResolver
+	if err := json.Unmarshal(data, &addresses); err != nil {
+		return nil, fmt.Errorf("parse %s: %v", path, err)
+	}
+	return addresses, nil
+}
+
+func (r staticAddressResolver) Resolve(ctx context.Context, ref string) (string, error) {
+	_, id, _ := strings.Cut(ref, ":")
+	if email, ok := r[id]; ok {
+		return email, nil
+	}
+	return "", errRefNotFound
+}
+
+// errUnknownRefScheme is a reference no resolver is configured for.
+var errUnknownRefScheme = errors.New(`Unknown ref scheme (refs look like "crm:12345" and need a configured resolver)`)
+
+// resolveRef looks ref up through its scheme's resolver. Failures come back
+// as the error code to report.
+func resolveRef(ctx context.Context, ref string) (resolver refResolver, email, code string, err error) {
+	scheme, id, ok := strings.Cut(ref, ":")
+	resolver, known := refResolvers[scheme]
+	if !ok || id == "" || !known {
+		return resolver, "", "", errUnknownRefScheme
+	}
+	email, err = resolver.resolver.Resolve(ctx, ref)
+	switch {
+	case errors.Is(err, errRefNotFound):
+		return resolver, "", verify.ErrCodeRefNotFound, nil
+	case err != nil:
+		log.Printf("ref resolver %s: %v", scheme, err)
+		return resolver, "", verify.ErrCodeRefResolverFailed, nil
+	}
+	return resolver, email, "", nil
+}
+
+// mayReveal reports whether key may see the addresses resolver resolves.
+func (r refResolver) mayReveal(key string) bool {
+	return key != "" && slices.Contains(r.revealKeys, key)
+}
+
+// hideAddress keys result by ref in place of the address. The retry token
+// goes too: it carries a hash of the address, and retrying needs the
+// address anyway. A suggestion's result loses its address the same way.
+func hideAddress(result *verify.Result, ref string) {
+	result.Ref = ref
+	result.Email = ""
+	result.Username = ""
+	result.NormalizedEmail = ""
+	result.RetryToken = ""
+	if result.SuggestionResult != nil {
+		// A copy, since cached results share it
+		suggestion := *result.SuggestionResult
+		hideAddress(&suggestion, "")
+		result.SuggestionResult = &suggestion
+	}
+}
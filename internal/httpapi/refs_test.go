@@ -0,0 +1,129 @@
+package httpapi
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"email-verifier/pkg/verify"
+)
+
+// useRefResolvers installs resolvers for the duration of a test
+func useRefResolvers(t *testing.T, resolvers map[string]refResolver) {
+	t.Helper()
+	saved := refResolvers
+	refResolvers = resolvers
+	t.Cleanup(func() { refResolvers = saved })
+}
+
+// verifyRef posts body to /api/verify with key and returns the response
+func verifyRef(t *testing.T, query, key, body string) (*httptest.ResponseRecorder, map[string]interface{}) {
+	t.Helper()
+	req := httptest.NewRequest(http.MethodPost, "/api/verify"+query, strings.NewReader(body))
+	req.Header.Set("X-API-Key", key)
+	rec := httptest.NewRecorder()
+	Handler().ServeHTTP(rec, req)
+	var result map[string]interface{}
+	json.NewDecoder(rec.Body).Decode(&result)
+	return rec, result
+}
+
+// TestVerifyByRef tests that a ref is resolved server-side and that the address is only shown to entitled keys
+func TestVerifyByRef(t *testing.T) {
+	useService(t, verify.Config{})
+	useRefResolvers(t, map[string]refResolver{
+		"crm": {resolver: staticAddressResolver{"12345": "jane.doe@example.com"}, revealKeys: []string{"ops-key"}},
+	})
+	body := `{"ref": "crm:12345", "checks": "syntax"}`
+
+	rec, result := verifyRef(t, "", "app-key", body)
+	if rec.Code != http.StatusOK || result["ref"] != "crm:12345" || result["email"] != "" || result["username"] != nil || result["is_valid"] != true {
+		t.Errorf("Expected a valid result keyed by ref without the address, got %d %v", rec.Code, result)
+	}
+
+	_, result = verifyRef(t, "?include_address=true", "ops-key", body)
+	if result["email"] != "jane.doe@example.com" || result["ref"] != "crm:12345" {
+		t.Errorf("Expected the entitled key to see the address, got %v", result)
+	}
+	if rec, _ := verifyRef(t, "?include_address=true", "app-key", body); rec.Code != http.StatusForbidden {
+		t.Errorf("Expected 403 for an unentitled key, got %d", rec.Code)
+	}
+
+	_, result = verifyRef(t, "", "app-key", `{"ref": "crm:99999"}`)
+	if result["error_code"] != verify.ErrCodeRefNotFound || result["ref"] != "crm:99999" {
+		t.Errorf("Expected %s, got %v", verify.ErrCodeRefNotFound, result)
+	}
+
+	for _, bad := range []string{`{"ref": "erp:1"}`, `{"ref": "12345"}`, `{"ref": "crm:12345", "email": "jane@example.com"}`} {
+		if rec, _ := verifyRef(t, "", "app-key", bad); rec.Code != http.StatusBadRequest {
+			t.Errorf("Expected 400 for %s, got %d", bad, rec.Code)
+		}
+	}
+}
+
+// TestHTTPSAddressResolver tests the lookup request and how endpoint answers map to errors
+func TestHTTPSAddressResolver(t *testing.T) {
+	status := http.StatusOK
+	var gotAuth, gotRef string
+	endpoint := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotAuth = r.Header.Get("Authorization")
+		var req map[string]string
+		json.NewDecoder(r.Body).Decode(&req)
+		gotRef = req["ref"]
+		w.WriteHeader(status)
+		json.NewEncoder(w).Encode(map[string]string{"email": "jane@example.com"})
+	}))
+	defer endpoint.Close()
+	resolver := &httpsAddressResolver{url: endpoint.URL, authHeader: "Authorization", authValue: "Bearer t0ken", client: endpoint.Client()}
+	useService(t, verify.Config{})
+	useRefResolvers(t, map[string]refResolver{"crm": {resolver: resolver}})
+
+	email, err := resolver.Resolve(context.Background(), "crm:12345")
+	if email != "jane@example.com" || err != nil || gotAuth != "Bearer t0ken" || gotRef != "crm:12345" {
+		t.Errorf("Expected the address from an authenticated lookup of the full ref, got %q %v (auth %q, ref %q)", email, err, gotAuth, gotRef)
+	}
+
+	status = http.StatusNotFound
+	if _, result := verifyRef(t, "", "", `{"ref": "crm:1"}`); result["error_code"] != verify.ErrCodeRefNotFound {
+		t.Errorf("Expected %s for a 404, got %v", verify.ErrCodeRefNotFound, result)
+	}
+	status = http.StatusBadGateway
+	if _, result := verifyRef(t, "", "", `{"ref": "crm:1"}`); result["error_code"] != verify.ErrCodeRefResolverFailed {
+		t.Errorf("Expected %s for a failing endpoint, got %v", verify.ErrCodeRefResolverFailed, result)
+	}
+}
+
+// TestLoadRefResolvers tests resolver config validation
+func TestLoadRefResolvers(t *testing.T) {
+	dir := t.TempDir()
+	static := filepath.Join(dir, "refs.json")
+	os.WriteFile(static, []byte(`{"1": "jane@example.com"}`), 0o600)
+	testCases := []struct {
+		name    string
+		config  string
+		wantErr string
+	}{
+		{"valid", `{"crm": {"type": "https", "url": "https://crm.example.com/lookup"}, "fixtures": {"type": "static", "file": "` + static + `"}}`, ""},
+		{"plain http", `{"crm": {"type": "https", "url": "http://crm.example.com/lookup"}}`, "needs an https url"},
+		{"missing file", `{"fixtures": {"type": "static", "file": "` + filepath.Join(dir, "missing.json") + `"}}`, "no such file"},
+		{"unknown type", `{"crm": {"type": "ldap"}}`, "unknown type"},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			path := filepath.Join(dir, "resolvers.json")
+			os.WriteFile(path, []byte(tc.config), 0o600)
+			_, err := loadRefResolvers(path)
+			switch {
+			case tc.wantErr == "" && err != nil:
+				t.Errorf("Expected no error, got %v", err)
+			case tc.wantErr != "" && (err == nil || !strings.Contains(err.Error(), tc.wantErr)):
+				t.Errorf("Expected error containing %q, got %v", tc.wantErr, err)
+			}
+		})
+	}
+}
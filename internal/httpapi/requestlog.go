@@ -0,0 +1,139 @@
+package httpapi
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"log/slog"
+	"net/http"
+	"strings"
+	"time"
+
+	"email-verifier/pkg/verify"
+)
+
+// headerRequestID carries the ID a request is logged under. A caller's
+// own ID is kept so it can be followed across services.
+const headerRequestID = "X-Request-ID"
+
+// maxRequestIDLen bounds a caller's request ID; longer or oddly spelled
+// ones are replaced rather than written to the logs.
+const maxRequestIDLen = 128
+
+type requestInfoKey struct{}
+
+// requestInfo is what handlers add to a request's log line.
+type requestInfo struct {
+	id      string
+	domain  string
+	keyName string // set by withAPIKey
+}
+
+// withRequestLog gives every request an ID, returns it in X-Request-ID
+// and logs the request when it is done. Only the domain of a verified
+// address is logged, never the address.
+func withRequestLog(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		info := &requestInfo{id: r.Header.Get(headerRequestID)}
+		if !validRequestID(info.id) {
+			info.id = newRequestID()
+		}
+		w.Header().Set(headerRequestID, info.id)
+		sw := &statusWriter{ResponseWriter: w, status: http.StatusOK}
+		start := time.Now()
+		next.ServeHTTP(sw, r.WithContext(context.WithValue(r.Context(), requestInfoKey{}, info)))
+
+		attrs := []slog.Attr{
+			slog.String("request_id", info.id),
+			slog.String("method", r.Method),
+			slog.String("path", loggedPath(r.URL.Path)),
+			slog.Int("status", sw.status),
+			slog.Duration("latency", time.Since(start)),
+		}
+		if info.domain != "" {
+			attrs = append(attrs, slog.String("domain", info.domain))
+		}
+		if info.keyName != "" {
+			attrs = append(attrs, slog.String("key", info.keyName))
+		}
+		slog.LogAttrs(r.Context(), slog.LevelInfo, "request", attrs...)
+	})
+}
+
+func validRequestID(id string) bool {
+	if id == "" || len(id) > maxRequestIDLen {
+		return false
+	}
+	for _, c := range id {
+		if !(c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || c == '-' || c == '_' || c == '.') {
+			return false
+		}
+	}
+	return true
+}
+
+func newRequestID() string {
+	b := make([]byte, 8)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// requestID returns the ID r is logged under, or "" outside withRequestLog.
+func requestID(r *http.Request) string {
+	if info, ok := r.Context().Value(requestInfoKey{}).(*requestInfo); ok {
+		return info.id
+	}
+	return ""
+}
+
+// logDomain notes the domain of the address r verifies for its log line.
+func logDomain(r *http.Request, email string) {
+	info, ok := r.Context().Value(requestInfoKey{}).(*requestInfo)
+	if !ok {
+		return
+	}
+	if at := strings.LastIndexByte(email, '@'); at >= 0 {
+		info.domain = strings.ToLower(email[at+1:])
+	}
+}
+
+// withRequestID returns result, or for a failed verification a copy whose
+// error names the request ID, so a report of it can be matched to the logs.
+func withRequestID(r *http.Request, result *verify.Result) *verify.Result {
+	id := requestID(r)
+	if result.ErrorCode == "" || id == "" {
+		return result
+	}
+	shown := *result
+	shown.Error += " (request ID: " + id + ")"
+	return &shown
+}
+
+// statusWriter records the status a handler answered with.
+type statusWriter struct {
+	http.ResponseWriter
+	status      int
+	wroteHeader bool
+}
+
+func (w *statusWriter) WriteHeader(status int) {
+	if !w.wroteHeader {
+		w.status, w.wroteHeader = status, true
+	}
+	w.ResponseWriter.WriteHeader(status)
+}
+
+func (w *statusWriter) Write(b []byte) (int, error) {
+	w.wroteHeader = true
+	return w.ResponseWriter.Write(b)
+}
+
+// Flush passes through, for streamed results and job progress.
+func (w *statusWriter) Flush() {
+	if f, ok := w.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// Unwrap lets http.ResponseController reach the underlying writer.
+func (w *statusWriter) Unwrap() http.ResponseWriter { return w.ResponseWriter }
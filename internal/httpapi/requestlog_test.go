@@ -0,0 +1,105 @@
+package httpapi
+
+import (
+	"bytes"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"email-verifier/pkg/verify"
+)
+
+// useRequestLog sends log output to a JSON buffer for the test
+func useRequestLog(t *testing.T) *bytes.Buffer {
+	t.Helper()
+	var buf bytes.Buffer
+	saved := slog.Default()
+	slog.SetDefault(slog.New(slog.NewJSONHandler(&buf, nil)))
+	t.Cleanup(func() { slog.SetDefault(saved) })
+	return &buf
+}
+
+// TestRequestLog tests that requests are logged under their ID with the domain but not the address
+func TestRequestLog(t *testing.T) {
+	useStreamService(t)
+	logs := useRequestLog(t)
+	handler := Handler()
+
+	req := httptest.NewRequest(http.MethodPost, "/api/verify", strings.NewReader(`{"email": "jane@partner.mock", "checks": "smtp"}`))
+	req.Header.Set(headerRequestID, "trace-42")
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	if rec.Header().Get(headerRequestID) != "trace-42" {
+		t.Errorf("Expected the caller's request ID back, got %q", rec.Header().Get(headerRequestID))
+	}
+	var line struct {
+		Msg, Method, Path, Domain string
+		RequestID                 string `json:"request_id"`
+		Status                    int
+		Latency                   int64
+	}
+	if err := json.Unmarshal(logs.Bytes(), &line); err != nil {
+		t.Fatalf("Expected one JSON log line, got %q", logs)
+	}
+	if line.Msg != "request" || line.RequestID != "trace-42" || line.Method != http.MethodPost || line.Path != "/api/verify" || line.Status != http.StatusOK || line.Domain != "partner.mock" || line.Latency <= 0 {
+		t.Errorf("Expected the request logged, got %+v", line)
+	}
+	if strings.Contains(logs.String(), "jane") {
+		t.Errorf("Expected no address in the log, got %s", logs)
+	}
+
+	for _, id := range []string{"", "has space", strings.Repeat("x", maxRequestIDLen+1)} {
+		req := httptest.NewRequest(http.MethodGet, "/healthz", nil)
+		req.Header.Set(headerRequestID, id)
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		if got := rec.Header().Get(headerRequestID); got == id || len(got) != 16 {
+			t.Errorf("Expected %q replaced with a generated ID, got %q", id, got)
+		}
+	}
+}
+
+// TestRequestIDInError tests that a failed verification's error names the request ID, plain, streamed and in bulk
+func TestRequestIDInError(t *testing.T) {
+	useStreamService(t)
+	useRequestLog(t)
+	handler := Handler()
+	for _, query := range []string{"", "?stream=true"} {
+		req := httptest.NewRequest(http.MethodPost, "/api/verify"+query, strings.NewReader(`{"email": "not-an-address"}`))
+		req.Header.Set(headerRequestID, "trace-7")
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		body := rec.Body.String()
+		if query != "" {
+			lines := strings.Split(strings.TrimSpace(body), "\n")
+			var event struct{ Result json.RawMessage }
+			json.Unmarshal([]byte(lines[len(lines)-1]), &event)
+			body = string(event.Result)
+		}
+		var result verify.Result
+		json.Unmarshal([]byte(body), &result)
+		if result.ErrorCode == "" || !strings.HasSuffix(result.Error, " (request ID: trace-7)") {
+			t.Errorf("Expected the request ID in the error for %q, got %q", query, result.Error)
+		}
+	}
+
+	req := httptest.NewRequest(http.MethodPost, "/api/verify/bulk", strings.NewReader(`{"emails": ["jane@partner.mock", "not-an-address"], "checks": "smtp"}`))
+	req.Header.Set(headerRequestID, "trace-8")
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	var results []verify.Result
+	if err := json.Unmarshal(rec.Body.Bytes(), &results); err != nil || len(results) != 2 {
+		t.Fatalf("Expected 2 bulk results, got %s", rec.Body)
+	}
+	if strings.Contains(results[0].Error, "request ID") || !strings.HasSuffix(results[1].Error, " (request ID: trace-8)") {
+		t.Errorf("Expected the request ID only on the failed bulk result, got %q and %q", results[0].Error, results[1].Error)
+	}
+
+	rec = postVerify(t, "", `{"email": "jane@partner.mock", "checks": "smtp"}`)
+	if strings.Contains(rec.Body.String(), "request ID") {
+		t.Errorf("Expected no request ID outside the middleware or on success, got %s", rec.Body)
+	}
+}
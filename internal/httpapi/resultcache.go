@@ -0,0 +1,205 @@
+package httpapi
+
+import (
+	"container/list"
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"email-verifier/pkg/verify"
+)
+
+var resultCacheLookups = metrics.CounterVec("result_cache_lookups_total", "Result cache lookups by /api/verify, by outcome.", "outcome")
+
+// resultCache keeps recent complete /api/verify results so a repeated
+// verification of an address answers without DNS or SMTP. Results are
+// grouped by tenant and service.InboxKey, so evicting an address drops
+// every address of its inbox; within an inbox they are kept per spelling, API
+// key, checks and context, which all change what a verification finds.
+// Past size addresses, the least recently used is dropped.
+type resultCache struct {
+	mu     sync.Mutex
+	ttl    time.Duration
+	size   int
+	order  *list.List               // of *cachedAddress, most recently used first
+	byAddr map[string]*list.Element // by cachedAddress.key
+	now    func() time.Time
+}
+
+// cachedAddress holds the results kept for one address.
+type cachedAddress struct {
+	key      string
+	variants map[string]cachedResult // by cacheVariant
+}
+
+type cachedResult struct {
+	result     *verify.Result
+	verifiedAt time.Time
+}
+
+// verifyCache is nil unless -cache-size is positive.
+var verifyCache *resultCache
+
+func newResultCache(ttl time.Duration, size int) *resultCache {
+	return &resultCache{ttl: ttl, size: size, order: list.New(), byAddr: make(map[string]*list.Element), now: time.Now}
+}
+
+// cacheAddress groups an address's results by tenant. In privacy mode the
+// address is known by its digest, which makes this its historyKey.
+func cacheAddress(tenant, email string) string {
+	return tenant + "/" + privateKey(service.InboxKey(email))
+}
+
+// cacheVariant names the request settings a cached result answers for.
+func cacheVariant(email, key string, checks verify.CheckSet, context string, suggestion bool) string {
+	return strings.Join([]string{privateKey(email), key, strings.Join(checks.Names(), ","), context, strconv.FormatBool(suggestion)}, "\x00")
+}
+
+// Get returns a copy of the result cached for email and variant, marked
+// cached with when it was verified and costing nothing, or nil. Expired
+// results are dropped as they are found.
+func (c *resultCache) Get(tenant, email, variant string) *verify.Result {
+	if c == nil {
+		return nil
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	el, ok := c.byAddr[cacheAddress(tenant, email)]
+	if !ok {
+		resultCacheLookups.Add("miss", 1)
+		return nil
+	}
+	addr := el.Value.(*cachedAddress)
+	cached, ok := addr.variants[variant]
+	if ok && c.now().Sub(cached.verifiedAt) >= c.ttl {
+		delete(addr.variants, variant)
+		if len(addr.variants) == 0 {
+			c.remove(el)
+		}
+		ok = false
+	}
+	if !ok {
+		resultCacheLookups.Add("miss", 1)
+		return nil
+	}
+	c.order.MoveToFront(el)
+	resultCacheLookups.Add("hit", 1)
+	result := *cached.result
+	result.Cached = true
+	result.VerifiedAt = &cached.verifiedAt
+	result.CostUnits = 0
+	return &result
+}
+
+// Put keeps result for email and variant. Results without a complete
+// answer, such as a timeout or a greylisted probe, are not kept: asking
+// again may well do better.
+func (c *resultCache) Put(tenant, email, variant string, result *verify.Result) {
+	if c == nil || result.ErrorCode != "" {
+		return
+	}
+	kept := *result
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	key := cacheAddress(tenant, email)
+	el, ok := c.byAddr[key]
+	if !ok {
+		el = c.order.PushFront(&cachedAddress{key: key, variants: make(map[string]cachedResult)})
+		c.byAddr[key] = el
+	}
+	el.Value.(*cachedAddress).variants[variant] = cachedResult{result: &kept, verifiedAt: c.now().UTC()}
+	c.order.MoveToFront(el)
+	for c.order.Len() > c.size {
+		c.remove(c.order.Back())
+	}
+}
+
+// Evict drops every result kept for email in tenant and returns how many
+// there were.
+func (c *resultCache) Evict(tenant, email string) int {
+	return c.evictKey(cacheAddress(tenant, email))
+}
+
+// evictKey drops the results kept under key, a cacheAddress.
+func (c *resultCache) evictKey(key string) int {
+	if c == nil {
+		return 0
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	el, ok := c.byAddr[key]
+	if !ok {
+		return 0
+	}
+	n := len(el.Value.(*cachedAddress).variants)
+	c.remove(el)
+	return n
+}
+
+// Sweep drops expired results and returns how many.
+func (c *resultCache) Sweep(now time.Time) int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	dropped := 0
+	for el := c.order.Front(); el != nil; {
+		next := el.Next()
+		addr := el.Value.(*cachedAddress)
+		for variant, cached := range addr.variants {
+			if now.Sub(cached.verifiedAt) >= c.ttl {
+				delete(addr.variants, variant)
+				dropped++
+			}
+		}
+		if len(addr.variants) == 0 {
+			c.remove(el)
+		}
+		el = next
+	}
+	return dropped
+}
+
+// Len returns the number of addresses with results kept.
+func (c *resultCache) Len() int {
+	if c == nil {
+		return 0
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.order.Len()
+}
+
+func (c *resultCache) remove(el *list.Element) {
+	c.order.Remove(el)
+	delete(c.byAddr, el.Value.(*cachedAddress).key)
+}
+
+func init() {
+	metrics.GaugeFunc("result_cache_addresses", "Addresses with results in the result cache.", func() int64 {
+		return int64(verifyCache.Len())
+	})
+}
+
+// apiCacheHandler evicts the caller's tenant's cached results for an
+// address, for when a result is disputed and the next verification should
+// start afresh.
+func apiCacheHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodDelete {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if verifyCache == nil {
+		http.Error(w, "The result cache is disabled", http.StatusNotFound)
+		return
+	}
+	email, _ := verify.NormalizeInput(r.PathValue("email"))
+	if email == "" {
+		http.Error(w, "email is required", http.StatusBadRequest)
+		return
+	}
+	evicted := verifyCache.Evict(service.TenantFor(requestKey(r)), email)
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{"evicted": evicted})
+}
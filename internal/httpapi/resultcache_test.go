@@ -0,0 +1,123 @@
+package httpapi
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"email-verifier/pkg/verify"
+)
+
+// useResultCache installs an empty result cache whose clock is read from now
+func useResultCache(t *testing.T, size int, now *time.Time) *resultCache {
+	t.Helper()
+	saved := verifyCache
+	verifyCache = newResultCache(time.Hour, size)
+	verifyCache.now = func() time.Time { return *now }
+	t.Cleanup(func() { verifyCache = saved })
+	return verifyCache
+}
+
+// verifyResult posts body to /api/verify and decodes the result
+func verifyResult(t *testing.T, body string) verify.Result {
+	t.Helper()
+	var result verify.Result
+	if err := json.NewDecoder(postVerify(t, "", body).Body).Decode(&result); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	return result
+}
+
+// TestResultCache tests that a repeated verification is answered from the cache, marked with its age, and that other settings verify afresh
+func TestResultCache(t *testing.T) {
+	smtp := useStreamService(t)
+	now := time.Date(2026, 5, 1, 12, 0, 0, 0, time.UTC)
+	useResultCache(t, 10, &now)
+	body := `{"email": "jane@partner.mock", "checks": "smtp"}`
+
+	first := verifyResult(t, body)
+	now = now.Add(20 * time.Minute)
+	second := verifyResult(t, body)
+	if first.Cached || !second.Cached || second.VerifiedAt == nil || !second.VerifiedAt.Equal(now.Add(-20*time.Minute)) {
+		t.Errorf("Expected the second result cached from 20 minutes ago, got %v %v", second.Cached, second.VerifiedAt)
+	}
+	if second.Verdict != first.Verdict || second.CostUnits != 0 || smtp.Probes() != 1 {
+		t.Errorf("Expected the same verdict for nothing, got %s costing %d after %d probes", second.Verdict, second.CostUnits, smtp.Probes())
+	}
+
+	for _, other := range []string{
+		`{"email": "jane@partner.mock", "checks": "mx"}`,
+		`{"email": "Jane@partner.mock", "checks": "smtp"}`,
+		`{"email": "not-an-address"}`,
+		`{"email": "not-an-address"}`,
+	} {
+		if result := verifyResult(t, other); result.Cached {
+			t.Errorf("Expected %s to be verified afresh", other)
+		}
+	}
+	if rec := postVerify(t, "?stream=true", body); rec.Code != http.StatusOK || smtp.Probes() != 3 {
+		t.Errorf("Expected a stream to probe again, got %d after %d probes", rec.Code, smtp.Probes())
+	}
+
+	now = now.Add(time.Hour)
+	if result := verifyResult(t, body); result.Cached {
+		t.Error("Expected the result to expire after the TTL")
+	}
+}
+
+// TestResultCacheLimits tests that the least recently used address is dropped and that the sweep drops expired results
+func TestResultCacheLimits(t *testing.T) {
+	now := time.Date(2026, 5, 1, 12, 0, 0, 0, time.UTC)
+	cache := useResultCache(t, 2, &now)
+	put := func(email string) {
+		cache.Put(verify.DefaultTenant, email, email, &verify.Result{Email: email})
+	}
+	put("a@x.mock")
+	put("b@x.mock")
+	cache.Get(verify.DefaultTenant, "a@x.mock", "a@x.mock")
+	put("c@x.mock")
+	if cache.Get(verify.DefaultTenant, "b@x.mock", "b@x.mock") != nil || cache.Get(verify.DefaultTenant, "a@x.mock", "a@x.mock") == nil {
+		t.Error("Expected b, the least recently used, to be dropped")
+	}
+	cache.Put(verify.DefaultTenant, "d@x.mock", "d@x.mock", &verify.Result{ErrorCode: verify.ErrCodeSMTPTryAgain})
+	if cache.Len() != 2 {
+		t.Errorf("Expected a failed result not to be kept, got %d addresses", cache.Len())
+	}
+
+	now = now.Add(30 * time.Minute)
+	put("e@x.mock")
+	if n := cache.Sweep(now.Add(31 * time.Minute)); n != 1 || cache.Len() != 1 {
+		t.Errorf("Expected 1 expired result swept leaving 1 address, got %d and %d", n, cache.Len())
+	}
+}
+
+// TestResultCacheEvict tests that DELETE /api/cache/{email} drops every cached result for the address
+func TestResultCacheEvict(t *testing.T) {
+	smtp := useStreamService(t)
+	now := time.Date(2026, 5, 1, 12, 0, 0, 0, time.UTC)
+	useResultCache(t, 10, &now)
+	verifyResult(t, `{"email": "jane@partner.mock", "checks": "smtp"}`)
+	verifyResult(t, `{"email": "Jane@partner.mock", "checks": "mx"}`)
+
+	handler := Handler()
+	evict := func() (int, int) {
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, httptest.NewRequest(http.MethodDelete, "/api/cache/JANE%40partner.mock", nil))
+		var body struct{ Evicted int }
+		json.NewDecoder(rec.Body).Decode(&body)
+		return rec.Code, body.Evicted
+	}
+	if code, n := evict(); code != http.StatusOK || n != 2 {
+		t.Errorf("Expected both results evicted, got %d and %d", code, n)
+	}
+	if result := verifyResult(t, `{"email": "jane@partner.mock", "checks": "smtp"}`); result.Cached || smtp.Probes() != 2 {
+		t.Errorf("Expected a fresh probe after the eviction, got %d probes", smtp.Probes())
+	}
+
+	verifyCache = nil
+	if code, _ := evict(); code != http.StatusNotFound {
+		t.Errorf("Expected status 404 with the cache off, got %d", code)
+	}
+}
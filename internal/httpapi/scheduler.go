@@ -0,0 +1,219 @@
+package httpapi
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sort"
+	"sync"
+	"time"
+)
+
+var backgroundSkips = metrics.CounterVec("background_skips_total", "Background task runs skipped because the task was still running or the server was overloaded.", "task")
+
+// taskFunc is one run of a background task.
+type taskFunc func(ctx context.Context, now time.Time) error
+
+type scheduledTask struct {
+	name     string
+	interval time.Duration
+	run      taskFunc
+	next     time.Time
+
+	running      bool
+	runs         int
+	skips        int
+	lastRun      time.Time
+	lastDuration time.Duration
+	lastErr      string
+	lastSkip     string
+}
+
+// scheduler runs every periodic background task: watch checks, result
+// forwarding, housekeeping sweeps and leak checks. Intervals are jittered so
+// tasks don't line up, at most limit tasks run at once, and while the
+// server is overloaded due runs are skipped rather than queued, so
+// background work never adds to a latency spike.
+type scheduler struct {
+	mu     sync.Mutex
+	tasks  []*scheduledTask
+	limit  int
+	active int
+	wg     sync.WaitGroup
+
+	// overloaded returns why background work should pause, or "" if it
+	// may run.
+	overloaded func() string
+	now        func() time.Time
+}
+
+var background = newScheduler(2)
+
+func newScheduler(limit int) *scheduler {
+	return &scheduler{limit: limit, overloaded: lanesSaturated, now: time.Now}
+}
+
+// lanesSaturated reports a full slow or SMTP lane: verifications are
+// already waiting for DNS and SMTP slots, so background lookups would only
+// compete with them.
+func lanesSaturated() string {
+	if size := cap(slowLane.slots); size > 0 && slowLane.InUse() >= size {
+		return "slow lane saturated"
+	}
+	if size := cap(smtpLane.slots); size > 0 && smtpLane.InUse() >= size {
+		return "smtp lane saturated"
+	}
+	return ""
+}
+
+// Register adds a task to run every interval, first after a random delay
+// within the interval.
+func (s *scheduler) Register(name string, interval time.Duration, run taskFunc) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.tasks = append(s.tasks, &scheduledTask{
+		name:     name,
+		interval: interval,
+		run:      run,
+		next:     s.now().Add(jitter(interval)),
+	})
+}
+
+// RunDue starts every task whose next run time has passed, each on its own
+// goroutine. Due tasks beyond the concurrency limit stay due and start on a
+// later tick; tasks still running from their last run, and every due task
+// while the server is overloaded, skip this run.
+func (s *scheduler) RunDue(ctx context.Context) {
+	now := s.now()
+	overload := s.overloaded()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, task := range s.tasks {
+		if now.Before(task.next) {
+			continue
+		}
+		switch {
+		case task.running:
+			s.skip(task, now, "previous run still in progress")
+		case overload != "":
+			s.skip(task, now, overload)
+		case s.active < s.limit:
+			s.start(ctx, task, now)
+		}
+	}
+}
+
+// skip must be called with s.mu held. A reason is logged once, not on every
+// skipped run.
+func (s *scheduler) skip(task *scheduledTask, now time.Time, reason string) {
+	if task.lastSkip != reason {
+		log.Printf("scheduler: skipping %s: %s", task.name, reason)
+	}
+	task.lastSkip = reason
+	task.skips++
+	task.next = s.nextRun(task, now)
+	backgroundSkips.Add(task.name, 1)
+}
+
+// start must be called with s.mu held.
+func (s *scheduler) start(ctx context.Context, task *scheduledTask, now time.Time) {
+	task.running = true
+	task.lastSkip = ""
+	task.next = s.nextRun(task, now)
+	s.active++
+	s.wg.Add(1)
+
+	go func() {
+		defer s.wg.Done()
+		started := time.Now()
+		err := runTask(ctx, task, now)
+
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		s.active--
+		task.running = false
+		task.runs++
+		task.lastRun = now
+		task.lastDuration = time.Since(started)
+		task.lastErr = ""
+		if err != nil {
+			task.lastErr = err.Error()
+			log.Printf("scheduler: %s failed: %v", task.name, err)
+		}
+	}()
+}
+
+// runTask runs one task, turning a panic into an error so one broken task
+// can't take the scheduler down.
+func runTask(ctx context.Context, task *scheduledTask, now time.Time) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("panic: %v", r)
+		}
+	}()
+	return task.run(ctx, now)
+}
+
+func (s *scheduler) nextRun(task *scheduledTask, now time.Time) time.Time {
+	return now.Add(task.interval - task.interval/10 + jitter(task.interval/5))
+}
+
+// Run starts due tasks every tick until ctx is cancelled.
+func (s *scheduler) Run(ctx context.Context, tick time.Duration) {
+	ticker := time.NewTicker(tick)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			s.RunDue(ctx)
+		}
+	}
+}
+
+// Wait blocks until every started run has finished.
+func (s *scheduler) Wait() { s.wg.Wait() }
+
+// taskStatus is one background task's recent activity, for /admin/state.
+type taskStatus struct {
+	Name         string     `json:"name"`
+	Interval     string     `json:"interval"`
+	Running      bool       `json:"running"`
+	Runs         int        `json:"runs"`
+	Skips        int        `json:"skips"`
+	LastRun      *time.Time `json:"last_run,omitempty"`
+	LastDuration string     `json:"last_duration,omitempty"`
+	LastError    string     `json:"last_error,omitempty"`
+	LastSkip     string     `json:"last_skip_reason,omitempty"`
+	NextRun      time.Time  `json:"next_run"`
+}
+
+// Status reports every task ordered by name.
+func (s *scheduler) Status() []taskStatus {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	statuses := make([]taskStatus, 0, len(s.tasks))
+	for _, task := range s.tasks {
+		status := taskStatus{
+			Name:      task.name,
+			Interval:  task.interval.String(),
+			Running:   task.running,
+			Runs:      task.runs,
+			Skips:     task.skips,
+			LastError: task.lastErr,
+			LastSkip:  task.lastSkip,
+			NextRun:   task.next,
+		}
+		if !task.lastRun.IsZero() {
+			lastRun := task.lastRun
+			status.LastRun = &lastRun
+			status.LastDuration = task.lastDuration.String()
+		}
+		statuses = append(statuses, status)
+	}
+	sort.Slice(statuses, func(i, k int) bool { return statuses[i].Name < statuses[k].Name })
+	return statuses
+}
@@ -0,0 +1,183 @@
+package httpapi
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"log"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// newTestScheduler returns a scheduler with a clock the test moves and no overload unless overload is set
+func newTestScheduler(limit int, now *time.Time, overload *string) *scheduler {
+	s := newScheduler(limit)
+	s.now = func() time.Time { return *now }
+	s.overloaded = func() string { return *overload }
+	return s
+}
+
+// captureLog sends the standard logger to a buffer for the duration of a test
+func captureLog(t *testing.T) *bytes.Buffer {
+	t.Helper()
+	var buf bytes.Buffer
+	saved := log.Writer()
+	log.SetOutput(&buf)
+	t.Cleanup(func() { log.SetOutput(saved) })
+	return &buf
+}
+
+// TestSchedulerSkipsWhenOverloaded tests that due tasks skip with one logged reason instead of queueing while the server is saturated
+func TestSchedulerSkipsWhenOverloaded(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+	overload := "slow lane saturated"
+	s := newTestScheduler(2, &now, &overload)
+	logs := captureLog(t)
+
+	var runs atomic.Int32
+	s.Register("sweep", time.Minute, func(context.Context, time.Time) error {
+		runs.Add(1)
+		return nil
+	})
+
+	for i := 0; i < 5; i++ {
+		now = now.Add(2 * time.Minute)
+		s.RunDue(context.Background())
+	}
+	s.Wait()
+	if n := runs.Load(); n != 0 {
+		t.Fatalf("Expected no runs while overloaded, got %d", n)
+	}
+	status := s.Status()[0]
+	if status.Skips != 5 || status.LastSkip != overload {
+		t.Errorf("Expected 5 skips for %q, got %+v", overload, status)
+	}
+	if n := strings.Count(logs.String(), "skipping sweep: slow lane saturated"); n != 1 {
+		t.Errorf("Expected the skip reason logged once, got %d times in %q", n, logs.String())
+	}
+
+	// Once the overload clears, the next due run goes ahead
+	overload = ""
+	now = now.Add(2 * time.Minute)
+	s.RunDue(context.Background())
+	s.Wait()
+	if n := runs.Load(); n != 1 {
+		t.Errorf("Expected one run after the overload cleared, got %d", n)
+	}
+	if status := s.Status()[0]; status.LastSkip != "" || status.LastRun == nil {
+		t.Errorf("Expected a recorded run and no skip reason, got %+v", status)
+	}
+}
+
+// TestSchedulerConcurrencyLimit tests that tasks beyond the limit wait for a later tick rather than being skipped
+func TestSchedulerConcurrencyLimit(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+	overload := ""
+	s := newTestScheduler(1, &now, &overload)
+
+	release := make(chan struct{})
+	var started atomic.Int32
+	block := func(context.Context, time.Time) error {
+		started.Add(1)
+		<-release
+		return nil
+	}
+	s.Register("a", time.Hour, block)
+	s.Register("b", time.Hour, block)
+
+	now = now.Add(time.Hour)
+	s.RunDue(context.Background())
+	s.RunDue(context.Background())
+	running := 0
+	for _, status := range s.Status() {
+		if status.Running {
+			running++
+		}
+	}
+	if running != 1 {
+		t.Fatalf("Expected one task running at the limit, got %d", running)
+	}
+	close(release)
+	s.Wait()
+
+	s.RunDue(context.Background())
+	s.Wait()
+	if n := started.Load(); n != 2 {
+		t.Errorf("Expected the waiting task to start once a slot freed, got %d runs", n)
+	}
+	for _, status := range s.Status() {
+		if status.Skips != 0 || status.Runs != 1 {
+			t.Errorf("Expected %s to run once without skips, got %+v", status.Name, status)
+		}
+	}
+}
+
+// TestSchedulerSkipsOverlappingRuns tests that a task still running when it comes due again is skipped, and that errors and panics are reported
+func TestSchedulerSkipsOverlappingRuns(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+	overload := ""
+	s := newTestScheduler(4, &now, &overload)
+	captureLog(t)
+
+	release := make(chan struct{})
+	s.Register("slow", time.Second, func(context.Context, time.Time) error {
+		<-release
+		return errors.New("upstream timeout")
+	})
+
+	now = now.Add(2 * time.Second)
+	s.RunDue(context.Background())
+	now = now.Add(2 * time.Second)
+	s.RunDue(context.Background())
+	close(release)
+	s.Wait()
+
+	slow := s.Status()[0]
+	if slow.Runs != 1 || slow.Skips != 1 || slow.LastSkip != "previous run still in progress" {
+		t.Errorf("Expected one run and one overlap skip, got %+v", slow)
+	}
+	if slow.LastError != "upstream timeout" {
+		t.Errorf("Expected the task's error, got %q", slow.LastError)
+	}
+
+	// A panicking task is reported and keeps being scheduled
+	s = newTestScheduler(4, &now, &overload)
+	s.Register("broken", time.Second, func(context.Context, time.Time) error {
+		panic("nil map")
+	})
+	for i := 0; i < 2; i++ {
+		now = now.Add(2 * time.Second)
+		s.RunDue(context.Background())
+		s.Wait()
+	}
+	if broken := s.Status()[0]; broken.Runs != 2 || !strings.Contains(broken.LastError, "panic: nil map") {
+		t.Errorf("Expected panics to be recorded as errors, got %+v", broken)
+	}
+}
+
+// TestLanesSaturated tests the overload signal from the slow lane
+func TestLanesSaturated(t *testing.T) {
+	saved := slowLane
+	slowLane = newLane(laneSlow, 1)
+	t.Cleanup(func() { slowLane = saved })
+
+	if reason := lanesSaturated(); reason != "" {
+		t.Errorf("Expected no overload with a free slot, got %q", reason)
+	}
+	release := make(chan struct{})
+	done := make(chan struct{})
+	go func() {
+		slowLane.Do(context.Background(), func() { <-release })
+		close(done)
+	}()
+	for slowLane.InUse() == 0 {
+		time.Sleep(time.Millisecond)
+	}
+	if reason := lanesSaturated(); reason == "" {
+		t.Error("Expected overload with every slow lane slot taken")
+	}
+	close(release)
+	<-done
+}
@@ -0,0 +1,170 @@
+package httpapi
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"time"
+
+	"email-verifier/pkg/verify"
+)
+
+// What a send check's answer is based on.
+const (
+	sendBasedOnPolicy = "policy"
+	sendBasedOnCached = "cached"
+	sendBasedOnLive   = "live"
+)
+
+// Send check reasons. Policy reasons come from checks that need no
+// network; verdict reasons from a recent or live verification.
+const (
+	sendReasonInvalidSyntax = "invalid_syntax"
+	sendReasonBlocked       = "domain_blocked"
+	sendReasonNonRoutable   = "non_routable"
+	sendReasonSuppressed    = "suppressed"
+	sendReasonDisposable    = "disposable"
+	sendReasonRoleAccount   = "role_account"
+	sendReasonNoRecent      = "no_recent_verification"
+	sendReasonVerdictPrefix = "verdict_"
+)
+
+var (
+	// sendCheckMaxStaleness is how old a recorded result may be before a
+	// send check stops trusting it, unless the request says otherwise.
+	sendCheckMaxStaleness = 7 * 24 * time.Hour
+	// sendCheckDenyRole makes role accounts (info@, sales@) a deny.
+	sendCheckDenyRole = false
+)
+
+// sendDecision is the answer to "is it safe to send to this address now?".
+// Only negative evidence denies: an address nothing is known about is
+// allowed.
+type sendDecision struct {
+	Allow      bool       `json:"allow"`
+	Reason     string     `json:"reason"`
+	BasedOn    string     `json:"based_on"`
+	Verdict    string     `json:"verdict,omitempty"`
+	VerifiedAt *time.Time `json:"verified_at,omitempty"`
+	// Error is why a live verification failed, with the request ID.
+	Error string `json:"error,omitempty"`
+}
+
+// policyDecision denies addresses that fail the checks needing no network.
+// ok is false when the policy has no objection.
+func policyDecision(result *verify.Result) (decision sendDecision, ok bool) {
+	deny := func(reason string) (sendDecision, bool) {
+		return sendDecision{Allow: false, Reason: reason, BasedOn: sendBasedOnPolicy}, true
+	}
+	switch {
+	case result.ErrorCode == verify.ErrCodeDomainBlocked:
+		return deny(sendReasonBlocked)
+	case !result.IsValid:
+		return deny(sendReasonInvalidSyntax)
+	case result.DomainStatus == verify.DomainNonRoutable:
+		return deny(sendReasonNonRoutable)
+	case result.Suppressed:
+		return deny(sendReasonSuppressed)
+	case result.Disposable:
+		return deny(sendReasonDisposable)
+	case result.RoleAccount && sendCheckDenyRole:
+		return deny(sendReasonRoleAccount)
+	}
+	return sendDecision{}, false
+}
+
+// verdictDecision answers from a verification's verdict. Undeliverable and
+// invalid addresses are denied; risky and unknown ones carry no negative
+// evidence and are allowed.
+func verdictDecision(verdict, basedOn string, verifiedAt time.Time) sendDecision {
+	allow := verdict != verify.VerdictUndeliverable && verdict != verify.VerdictInvalid
+	at := verifiedAt.UTC()
+	return sendDecision{
+		Allow:      allow,
+		Reason:     sendReasonVerdictPrefix + verdict,
+		BasedOn:    basedOn,
+		Verdict:    verdict,
+		VerifiedAt: &at,
+	}
+}
+
+// sendCheckHandler answers GET /api/send-check?email=... from, in order,
+// policy, the most recent recorded result no older than max_staleness, and
+// a live verification if allow_probe=true. Only the live step touches the
+// network.
+func sendCheckHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	query := r.URL.Query()
+	email, _ := verify.NormalizeInput(query.Get("email"))
+	if email == "" {
+		http.Error(w, "email is required", http.StatusBadRequest)
+		return
+	}
+	maxStaleness := sendCheckMaxStaleness
+	if v := query.Get("max_staleness"); v != "" {
+		d, err := time.ParseDuration(v)
+		if err != nil || d < 0 {
+			http.Error(w, "max_staleness must be a duration such as 24h", http.StatusBadRequest)
+			return
+		}
+		maxStaleness = d
+	}
+	allowProbe := false
+	if v := query.Get("allow_probe"); v != "" {
+		b, err := strconv.ParseBool(v)
+		if err != nil {
+			http.Error(w, "allow_probe must be true or false", http.StatusBadRequest)
+			return
+		}
+		allowProbe = b
+	}
+
+	if err := service.Ready(); err != nil {
+		writeVerifierUnavailable(w, err)
+		return
+	}
+
+	key := requestKey(r)
+	policy := service.Verify(email, verify.Options{Checks: service.ChecksFor(key).WithoutNetwork(), Key: key})
+	decision, ok := policyDecision(policy)
+
+	if !ok && history != nil {
+		now := time.Now()
+		if entry, found, _ := history.AsOf(service.TenantFor(key), addressID(email), now); found && now.Sub(entry.VerifiedAt) <= maxStaleness {
+			decision, ok = verdictDecision(entry.Result.Verdict, sendBasedOnCached, entry.VerifiedAt), true
+		}
+	}
+
+	if !ok && allowProbe {
+		checks := service.ChecksFor(key)
+		l := laneFor(checks)
+		ctx, cancel := context.WithTimeout(r.Context(), waitFor(l))
+		defer cancel()
+		var result *verify.Result
+		var took time.Duration
+		if err := l.Do(ctx, func() {
+			start := time.Now()
+			result = service.Verify(email, verify.Options{Checks: checks, Key: key, Context: r.Context()})
+			took = time.Since(start)
+		}); err != nil {
+			writeLaneBusy(w, l)
+			return
+		}
+		recordResult(key, result, took)
+		decision, ok = verdictDecision(result.Verdict, sendBasedOnLive, time.Now()), true
+		if result.ErrorCode != "" {
+			decision.Error = withRequestID(r, result).Error
+		}
+	}
+
+	if !ok {
+		decision = sendDecision{Allow: true, Reason: sendReasonNoRecent, BasedOn: sendBasedOnPolicy}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(decision)
+}
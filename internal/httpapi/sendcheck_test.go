@@ -0,0 +1,147 @@
+package httpapi
+
+import (
+	"encoding/json"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"email-verifier/pkg/verify"
+	"email-verifier/pkg/verify/verifytest"
+)
+
+// useSendCheckHistory replaces history with one holding a result per address, recorded age ago
+func useSendCheckHistory(t *testing.T, results map[string]time.Duration, verdicts map[string]string) {
+	t.Helper()
+	saved := history
+	history = newHistoryStore()
+	t.Cleanup(func() { history = saved })
+	for email, age := range results {
+		at := time.Now().Add(-age)
+		history.now = func() time.Time { return at }
+		history.Record(verify.DefaultTenant, &verify.Result{Email: email, Verdict: verdicts[email]})
+	}
+	history.now = time.Now
+}
+
+// TestSendCheck tests the decision for each source of evidence and the order they are consulted in
+func TestSendCheck(t *testing.T) {
+	fake := verifytest.NewResolver()
+	fake.MX["partner.mock"] = []*net.MX{{Host: "mx.partner.mock.", Pref: 10}}
+	useService(t, verify.Config{Resolver: fake, BlockedDomains: []string{"blocked.mock"}})
+
+	useSendCheckHistory(t, map[string]time.Duration{
+		"fresh-good@partner.mock":   time.Hour,
+		"fresh-bad@partner.mock":    time.Hour,
+		"fresh-risky@partner.mock":  time.Hour,
+		"fresh-unsure@partner.mock": time.Hour,
+		"stale-bad@partner.mock":    30 * 24 * time.Hour,
+		"info@partner.mock":         time.Hour,
+	}, map[string]string{
+		"fresh-good@partner.mock":   verify.VerdictDeliverable,
+		"fresh-bad@partner.mock":    verify.VerdictUndeliverable,
+		"fresh-risky@partner.mock":  verify.VerdictRisky,
+		"fresh-unsure@partner.mock": verify.VerdictUnknown,
+		"stale-bad@partner.mock":    verify.VerdictUndeliverable,
+		"info@partner.mock":         verify.VerdictDeliverable,
+	})
+
+	testCases := []struct {
+		name     string
+		query    string
+		denyRole bool
+		allow    bool
+		reason   string
+		basedOn  string
+		verified bool
+	}{
+		{"invalid syntax", "email=not-an-address", false, false, sendReasonInvalidSyntax, sendBasedOnPolicy, false},
+		{"blocked domain", "email=jane@blocked.mock", false, false, sendReasonBlocked, sendBasedOnPolicy, false},
+		{"non-routable domain", "email=jane@localhost", false, false, sendReasonNonRoutable, sendBasedOnPolicy, false},
+		{"disposable domain", "email=temp@mailinator.com", false, false, sendReasonDisposable, sendBasedOnPolicy, false},
+		{"role account allowed by default", "email=info@partner.mock", false, true, "verdict_deliverable", sendBasedOnCached, true},
+		{"role account denied when configured", "email=info@partner.mock", true, false, sendReasonRoleAccount, sendBasedOnPolicy, false},
+		{"recent deliverable", "email=fresh-good@partner.mock", false, true, "verdict_deliverable", sendBasedOnCached, true},
+		{"recent undeliverable", "email=fresh-bad@partner.mock", false, false, "verdict_undeliverable", sendBasedOnCached, true},
+		{"recent risky", "email=fresh-risky@partner.mock", false, true, "verdict_risky", sendBasedOnCached, true},
+		{"recent unknown", "email=fresh-unsure@partner.mock", false, true, "verdict_unknown", sendBasedOnCached, true},
+		{"input is normalized", "email=" + url.QueryEscape(" Fresh-Bad@Partner.mock "), false, false, "verdict_undeliverable", sendBasedOnCached, true},
+		{"stale result ignored", "email=stale-bad@partner.mock", false, true, sendReasonNoRecent, sendBasedOnPolicy, false},
+		{"staleness widened by request", "email=stale-bad@partner.mock&max_staleness=1000h", false, false, "verdict_undeliverable", sendBasedOnCached, true},
+		{"staleness narrowed by request", "email=fresh-bad@partner.mock&max_staleness=1m", false, true, sendReasonNoRecent, sendBasedOnPolicy, false},
+		{"policy wins over history", "email=info@partner.mock&allow_probe=true", true, false, sendReasonRoleAccount, sendBasedOnPolicy, false},
+		{"history wins over probing", "email=fresh-bad@partner.mock&allow_probe=true", false, false, "verdict_undeliverable", sendBasedOnCached, true},
+		{"never verified", "email=new@partner.mock", false, true, sendReasonNoRecent, sendBasedOnPolicy, false},
+		{"live probe without smtp check", "email=new@partner.mock&allow_probe=true", false, true, "verdict_unknown", sendBasedOnLive, true},
+		{"live probe of a missing domain", "email=new@gone.mock&allow_probe=true", false, false, "verdict_undeliverable", sendBasedOnLive, true},
+		{"live result answers the next check", "email=new@gone.mock", false, false, "verdict_undeliverable", sendBasedOnCached, true},
+		{"probing turned off", "email=other@gone.mock&allow_probe=false", false, true, sendReasonNoRecent, sendBasedOnPolicy, false},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			sendCheckDenyRole = tc.denyRole
+			t.Cleanup(func() { sendCheckDenyRole = false })
+
+			rec := httptest.NewRecorder()
+			sendCheckHandler(rec, httptest.NewRequest(http.MethodGet, "/api/send-check?"+tc.query, nil))
+			if rec.Code != http.StatusOK {
+				t.Fatalf("Expected status 200, got %d: %s", rec.Code, rec.Body.String())
+			}
+			var decision sendDecision
+			if err := json.Unmarshal(rec.Body.Bytes(), &decision); err != nil {
+				t.Fatalf("Failed to decode response: %v", err)
+			}
+			if decision.Allow != tc.allow || decision.Reason != tc.reason || decision.BasedOn != tc.basedOn {
+				t.Errorf("Expected allow=%v reason=%s based_on=%s, got %+v", tc.allow, tc.reason, tc.basedOn, decision)
+			}
+			if (decision.VerifiedAt != nil) != tc.verified {
+				t.Errorf("Expected verified_at set: %v, got %v", tc.verified, decision.VerifiedAt)
+			}
+		})
+	}
+}
+
+// TestSendCheckWithoutHistory tests that without history only policy and live probes can answer
+func TestSendCheckWithoutHistory(t *testing.T) {
+	useService(t, verify.Config{Resolver: verifytest.NewResolver()})
+	saved := history
+	history = nil
+	t.Cleanup(func() { history = saved })
+
+	rec := httptest.NewRecorder()
+	sendCheckHandler(rec, httptest.NewRequest(http.MethodGet, "/api/send-check?email=jane@partner.mock", nil))
+	var decision sendDecision
+	json.Unmarshal(rec.Body.Bytes(), &decision)
+	if !decision.Allow || decision.Reason != sendReasonNoRecent {
+		t.Errorf("Expected an allow with no recent verification, got %+v", decision)
+	}
+}
+
+// TestSendCheckBadRequests tests parameter validation
+func TestSendCheckBadRequests(t *testing.T) {
+	testCases := []struct {
+		method string
+		query  string
+		code   int
+	}{
+		{http.MethodPost, "email=jane@partner.mock", http.StatusMethodNotAllowed},
+		{http.MethodGet, "", http.StatusBadRequest},
+		{http.MethodGet, "email=jane@partner.mock&max_staleness=week", http.StatusBadRequest},
+		{http.MethodGet, "email=jane@partner.mock&max_staleness=-1h", http.StatusBadRequest},
+		{http.MethodGet, "email=jane@partner.mock&allow_probe=maybe", http.StatusBadRequest},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.method+" "+tc.query, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			sendCheckHandler(rec, httptest.NewRequest(tc.method, "/api/send-check?"+tc.query, nil))
+			if rec.Code != tc.code {
+				t.Errorf("Expected status %d, got %d", tc.code, rec.Code)
+			}
+		})
+	}
+}
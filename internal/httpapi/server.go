@@ -0,0 +1,553 @@
+// Package httpapi serves package verify over HTTP: the web UI, the JSON API
+// and the admin, metrics and housekeeping endpoints around it.
+//
+// Server state lives in package variables with usable defaults, so handlers
+// work in tests without any setup; Start replaces them from a Config.
+package httpapi
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"path/filepath"
+	"time"
+
+	"email-verifier/pkg/verify"
+)
+
+// service runs every verification the server performs.
+var service = verify.New(verify.Config{})
+
+// Config holds the server settings main reads from its flags.
+type Config struct {
+	// Service verifies addresses; a default Service if nil.
+	Service *verify.Service
+	// ProfilesConfig is re-read by /admin/profiles/reload.
+	ProfilesConfig string
+
+	// TemplateDir and StaticDir locate the web UI; "templates" and
+	// "static" if empty.
+	TemplateDir string
+	StaticDir   string
+
+	// AsyncPasteThreshold is the number of pasted addresses at which the
+	// web form switches to a background job; MaxPaste caps a paste.
+	AsyncPasteThreshold int
+	MaxPaste            int
+	// MaxBulk caps the addresses in one /api/verify/bulk request, 500 if
+	// zero; BulkWorkers is how many of them are verified at once, 8 if
+	// zero.
+	MaxBulk     int
+	BulkWorkers int
+	// MaxCSVUpload caps the size in bytes of a /api/verify/csv upload,
+	// 10 MiB if zero.
+	MaxCSVUpload int64
+	// MaxJobEmails caps the addresses in one /api/jobs submission, 100000
+	// if zero; JobWorkers is how many chunks of a job are verified at
+	// once, 4 if zero.
+	MaxJobEmails int
+	JobWorkers   int
+	// JobRetryDelay is how long a job waits before verifying its
+	// deferred results once more, off if zero; JobRetryLimit caps the
+	// deferred addresses waiting on that retry across jobs, 1000 if zero.
+	JobRetryDelay time.Duration
+	JobRetryLimit int
+	// DomainConcurrency and DomainRate throttle the bulk and job
+	// verifications that probe mail servers per destination domain: at
+	// most DomainConcurrency at once and DomainRate started in any minute,
+	// unlimited if zero. DomainLimits overrides them for specific domains
+	// as "domain=concurrency/rate,...".
+	DomainConcurrency int
+	DomainRate        int
+	DomainLimits      string
+	// JobCallbackSecret signs the callbacks jobs submitted with a
+	// callback_url make when they finish; callback_url is refused
+	// without it. JobCallbackPrivate lets callbacks reach loopback and
+	// private addresses.
+	JobCallbackSecret  string
+	JobCallbackPrivate bool
+	// JobTTL is how long finished jobs stay viewable.
+	JobTTL time.Duration
+	// PlanTTL is how long a dry-run plan token can be executed.
+	PlanTTL time.Duration
+
+	// FastLaneSize and SlowLaneSize are the slots of the fast and slow
+	// lanes, and LaneWait how long a request waits for one. Zero keeps
+	// the defaults of 64, 32 and 10s.
+	FastLaneSize int
+	SlowLaneSize int
+	LaneWait     time.Duration
+	// SMTPLaneSize caps the verifications probing mail servers at once,
+	// and SMTPLaneWait how long one waits for a slot before getting 429.
+	// Zero keeps the defaults of 10 and 5s.
+	SMTPLaneSize int
+	SMTPLaneWait time.Duration
+
+	WatchWebhook     string
+	MaxWatchesPerKey int
+	WatchMinInterval time.Duration
+	WatchHistoryTTL  time.Duration
+
+	ForwardConfig string
+	ForwardTTL    time.Duration
+
+	// CaptureDir is where /admin/capture writes its bundles; captures are
+	// off if empty. Bundles are deleted after CaptureTTL.
+	CaptureDir string
+	CaptureTTL time.Duration
+
+	// RefResolvers maps address reference schemes, such as "crm" in
+	// "crm:12345", to the resolvers /api/verify looks them up with.
+	RefResolvers string
+
+	// MaxRequestDeadline caps the deadline callers may ask for with
+	// X-Request-Deadline or X-Request-Timeout-Ms; 30s if zero.
+	MaxRequestDeadline time.Duration
+
+	// BrandConfig sets the web UI's product name, logo, colors and footer,
+	// server-wide and per tenant.
+	BrandConfig string
+
+	// SuppressionSources names the ESP suppression lists to pull on a
+	// schedule or take bounce and complaint events from.
+	SuppressionSources string
+
+	// PseudonymConfig maps tenants to the secrets pseudonymized exports
+	// are keyed with, current first.
+	PseudonymConfig string
+
+	History    bool
+	HistoryTTL time.Duration
+	// HistoryDB is the SQLite file every recorded verification is kept
+	// in for /history and filtered /api/history listings; nothing is
+	// written to disk if it's empty. Rows older than HistoryDBRetention
+	// are pruned, unless it is zero.
+	HistoryDB          string
+	HistoryDBRetention time.Duration
+
+	// PrivacyMode keeps addresses out of history, the history db, result
+	// cache keys, request logs and capture bundles, in favour of a
+	// SHA-256 of the normalized address salted with PrivacySalt.
+	PrivacyMode bool
+	PrivacySalt string
+
+	// CacheSize caps the addresses /api/verify keeps results for, each
+	// for CacheTTL; zero turns the result cache off.
+	CacheSize int
+	CacheTTL  time.Duration
+
+	// PrewarmDomains is how many of the domains history saw most in the
+	// last PrewarmWindow are refreshed in the Service's domain cache at
+	// startup and on /admin/prewarm; off if zero. A run stops after
+	// PrewarmTimeout, probes at most PrewarmProbes domains for catch-all,
+	// and holds /readyz back for at most PrewarmReadyWait.
+	PrewarmDomains   int
+	PrewarmWindow    time.Duration
+	PrewarmTimeout   time.Duration
+	PrewarmProbes    int
+	PrewarmReadyWait time.Duration
+
+	// UsageTTL is how long per-key daily usage totals are kept.
+	UsageTTL time.Duration
+
+	// SendCheckMaxStaleness is the default age past which /api/send-check
+	// stops trusting a recorded result; SendCheckDenyRole denies role
+	// accounts there.
+	SendCheckMaxStaleness time.Duration
+	SendCheckDenyRole     bool
+
+	// ShadowProfile enables shadow mode; ShadowPercent is 0 to 100.
+	ShadowProfile string
+	ShadowPercent float64
+	ShadowBudget  int
+	ShadowTTL     time.Duration
+
+	JanitorInterval   time.Duration
+	GaugeBounds       string
+	LeakCheckInterval time.Duration
+
+	// AlertRules is a JSON file of alert rules evaluated every
+	// AlertInterval and re-read by /admin/alerts/reload; alerting is off
+	// if empty.
+	AlertRules    string
+	AlertInterval time.Duration
+
+	// BackgroundConcurrency caps how many background tasks run at once.
+	BackgroundConcurrency int
+
+	// APIKeys is a comma-separated list of name=key (or bare) keys and
+	// APIKeysFile a JSON file mapping names to keys; with either set,
+	// /api/ and /admin/ requests need one of them in X-API-Key. The admin
+	// group is only served with keys.
+	APIKeys     string
+	APIKeysFile string
+
+	// RateLimitPerMinute holds each client to that many /api/ requests a
+	// minute, in bursts of up to RateLimitBurst (RateLimitPerMinute if 0);
+	// 0 turns the limit off.
+	RateLimitPerMinute int
+	RateLimitBurst     int
+	// TrustedProxies is a comma-separated list of proxy addresses and CIDR
+	// ranges whose X-Forwarded-For names the client.
+	TrustedProxies string
+
+	// CORSOrigins is a comma-separated list of browser origins (or *)
+	// allowed to call /api/ routes; none if empty.
+	CORSOrigins string
+
+	// RouteGroups is a comma-separated list of the route groups to serve
+	// (ui, api, admin, metrics, docs); all of them if empty, except admin
+	// without APIKeys.
+	RouteGroups string
+}
+
+var (
+	// profilesConfigPath is re-read by /admin/profiles/reload.
+	profilesConfigPath string
+
+	templateDir = "templates"
+	staticDir   = "static"
+
+	asyncPasteThreshold = 50
+	maxPaste            = 10000
+	maxBulk             = 500
+	maxJobEmails        = 100000
+	bulkWorkers         = 8
+	maxCSVUpload        = int64(10 << 20)
+)
+
+// Start installs cfg and starts the background scheduler (domain watches,
+// forwarding, housekeeping and leak checks) and verifier init retries, which
+// run until ctx is cancelled.
+func Start(ctx context.Context, cfg Config) error {
+	if cfg.Service != nil {
+		service = cfg.Service
+	}
+	groups, err := parseRouteGroups(cfg.RouteGroups)
+	if err != nil {
+		return err
+	}
+	if err := validateRouteGroups(groups); err != nil {
+		return err
+	}
+	apiKeys, err = loadAPIKeys(cfg.APIKeys, cfg.APIKeysFile)
+	if err != nil {
+		return err
+	}
+	if err := requireAdminAuth(groups, cfg.RouteGroups, apiKeys); err != nil {
+		return err
+	}
+	enabledGroups = groups
+	profilesConfigPath = cfg.ProfilesConfig
+	if cfg.TemplateDir != "" {
+		templateDir = cfg.TemplateDir
+	}
+	if cfg.StaticDir != "" {
+		staticDir = cfg.StaticDir
+	}
+
+	asyncPasteThreshold = cfg.AsyncPasteThreshold
+	maxPaste = cfg.MaxPaste
+	if cfg.MaxBulk > 0 {
+		maxBulk = cfg.MaxBulk
+	}
+	if cfg.BulkWorkers > 0 {
+		bulkWorkers = cfg.BulkWorkers
+	}
+	if cfg.MaxCSVUpload > 0 {
+		maxCSVUpload = cfg.MaxCSVUpload
+	}
+	if cfg.MaxJobEmails > 0 {
+		maxJobEmails = cfg.MaxJobEmails
+	}
+	if cfg.JobWorkers > 0 {
+		jobWorkers = cfg.JobWorkers
+	}
+	jobRetryDelay = cfg.JobRetryDelay
+	if cfg.JobRetryLimit > 0 {
+		maxPendingRetries = cfg.JobRetryLimit
+	}
+	domainLimits, err := parseDomainLimits(cfg.DomainLimits)
+	if err != nil {
+		return err
+	}
+	domainThrottles = newDomainThrottle(throttleLimit{Concurrent: cfg.DomainConcurrency, PerMinute: cfg.DomainRate}, domainLimits)
+	jobCallbackSecret, jobCallbackPrivate = cfg.JobCallbackSecret, cfg.JobCallbackPrivate
+	sendCheckMaxStaleness = cfg.SendCheckMaxStaleness
+	sendCheckDenyRole = cfg.SendCheckDenyRole
+
+	if cfg.FastLaneSize > 0 {
+		fastLane = newLane(laneFast, cfg.FastLaneSize)
+	}
+	if cfg.SlowLaneSize > 0 {
+		slowLane = newLane(laneSlow, cfg.SlowLaneSize)
+	}
+	if cfg.SMTPLaneSize > 0 {
+		smtpLane = newLane(laneSMTP, cfg.SMTPLaneSize)
+	}
+	if cfg.LaneWait > 0 {
+		laneWait = cfg.LaneWait
+	}
+	if cfg.SMTPLaneWait > 0 {
+		smtpWait = cfg.SMTPLaneWait
+	}
+	if cfg.MaxRequestDeadline > 0 {
+		maxRequestDeadline = cfg.MaxRequestDeadline
+	}
+
+	watchNotifier, err := newNotifier(cfg.WatchWebhook)
+	if err != nil {
+		return err
+	}
+	watches = newWatchRegistry(watchNotifier, cfg.MaxWatchesPerKey, cfg.WatchMinInterval)
+
+	forwardTargets, err := loadForwardTargets(cfg.ForwardConfig)
+	if err != nil {
+		return err
+	}
+	forwarder = newResultForwarder(forwardTargets)
+
+	refResolvers, err = loadRefResolvers(cfg.RefResolvers)
+	if err != nil {
+		return err
+	}
+
+	brands, err = loadBrandConfig(cfg.BrandConfig)
+	if err != nil {
+		return err
+	}
+
+	sources, err := loadSuppressionSources(cfg.SuppressionSources)
+	if err != nil {
+		return err
+	}
+	suppressionSync = newSuppressionSyncer(sources)
+
+	pseudonymKeys, err = loadPseudonymKeys(cfg.PseudonymConfig)
+	if err != nil {
+		return err
+	}
+
+	trustedProxies, err = parseTrustedProxies(cfg.TrustedProxies)
+	if err != nil {
+		return err
+	}
+	cors, err = parseCORSOrigins(cfg.CORSOrigins)
+	if err != nil {
+		return err
+	}
+	if cfg.RateLimitPerMinute > 0 {
+		rateLimit = newRateLimiter(cfg.RateLimitPerMinute, cfg.RateLimitBurst)
+		housekeeping.Register("rate_limits", cfg.JanitorInterval, rateLimit.Sweep)
+	}
+
+	bounds, err := parseGaugeBounds(cfg.GaugeBounds)
+	if err != nil {
+		return err
+	}
+
+	housekeeping.Register("forward_queue", cfg.JanitorInterval, func(now time.Time) int {
+		return forwarder.Sweep(now, cfg.ForwardTTL)
+	})
+	housekeeping.Register("watch_changes", cfg.JanitorInterval, func(now time.Time) int {
+		return watches.Sweep(now, cfg.WatchHistoryTTL)
+	})
+	housekeeping.Register("usage", cfg.JanitorInterval, func(now time.Time) int {
+		return usage.Sweep(now, cfg.UsageTTL)
+	})
+	housekeeping.Register("list_jobs", cfg.JanitorInterval, func(now time.Time) int {
+		return jobs.Sweep(now, cfg.JobTTL)
+	})
+	captureDir = cfg.CaptureDir
+	housekeeping.Register("capture_bundles", cfg.JanitorInterval, func(now time.Time) int {
+		return sweepCaptures(now, cfg.CaptureTTL)
+	})
+	plans = newPlanRegistry(cfg.PlanTTL)
+	housekeeping.Register("batch_plans", cfg.JanitorInterval, plans.Sweep)
+	housekeeping.Register("polite", cfg.JanitorInterval, service.SweepPolite)
+	housekeeping.Register("circuits", cfg.JanitorInterval, service.SweepCircuits)
+	housekeeping.Register("domain_throttles", cfg.JanitorInterval, domainThrottles.Sweep)
+	if service.DomainCacheEnabled() {
+		housekeeping.Register("domain_cache", cfg.JanitorInterval, service.SweepDomainCache)
+	}
+	if service.DNSCacheEnabled() {
+		housekeeping.Register("dns_cache", cfg.JanitorInterval, service.SweepDNSCache)
+	}
+	if cfg.CacheSize > 0 && cfg.CacheTTL > 0 {
+		verifyCache = newResultCache(cfg.CacheTTL, cfg.CacheSize)
+		housekeeping.Register("result_cache", cfg.JanitorInterval, verifyCache.Sweep)
+	}
+	if cfg.PrivacyMode {
+		if cfg.PrivacySalt == "" {
+			return errors.New("-privacy-mode needs -privacy-salt")
+		}
+		privacySalt = []byte(cfg.PrivacySalt)
+	}
+	if cfg.History {
+		history = newHistoryStore()
+		housekeeping.Register("history", cfg.JanitorInterval, func(now time.Time) int {
+			return history.Sweep(now, cfg.HistoryTTL)
+		})
+	}
+	if cfg.HistoryDB != "" {
+		if historyLog, err = openHistoryDB(cfg.HistoryDB); err != nil {
+			return err
+		}
+		go func() {
+			<-ctx.Done()
+			historyLog.Close()
+		}()
+		if cfg.HistoryDBRetention > 0 {
+			housekeeping.Register("history_db", cfg.JanitorInterval, func(now time.Time) int {
+				return historyLog.Prune(now, cfg.HistoryDBRetention)
+			})
+		}
+	}
+	if cfg.ShadowProfile != "" {
+		if cfg.ShadowPercent < 0 || cfg.ShadowPercent > 100 {
+			return fmt.Errorf("invalid shadow percent %v: want 0 to 100", cfg.ShadowPercent)
+		}
+		shadow = newShadowRunner(cfg.ShadowProfile, cfg.ShadowPercent/100, cfg.ShadowBudget)
+		housekeeping.Register("shadow_comparisons", cfg.JanitorInterval, func(now time.Time) int {
+			return shadow.Sweep(now, cfg.ShadowTTL)
+		})
+	}
+
+	background = newScheduler(cfg.BackgroundConcurrency)
+	background.Register("watch_checks", time.Second, func(ctx context.Context, now time.Time) error {
+		watches.checkDue(ctx)
+		return nil
+	})
+	background.Register("forward_flush", 5*time.Second, func(ctx context.Context, now time.Time) error {
+		forwarder.Flush(ctx)
+		return nil
+	})
+	suppressionSync.Register(background)
+	background.Register("housekeeping", time.Second, func(ctx context.Context, now time.Time) error {
+		housekeeping.RunDue()
+		return nil
+	})
+	background.Register("leak_check", cfg.LeakCheckInterval, func(ctx context.Context, now time.Time) error {
+		metrics.CheckBounds(bounds)
+		return nil
+	})
+	alerts = nil
+	if cfg.AlertRules != "" {
+		if alerts, err = newAlertEvaluator(cfg.AlertRules, builtinAlertMetrics()); err != nil {
+			return err
+		}
+		background.Register("alerts", cfg.AlertInterval, func(ctx context.Context, now time.Time) error {
+			return alerts.Evaluate(ctx)
+		})
+	}
+
+	if service.NetworkDisabled() {
+		log.Printf("audit: network kill-switch engaged at startup")
+	}
+	// Recording the examples swaps package state, so it happens before
+	// the background tasks run or any request is served
+	if groups[groupDocs] {
+		docExamples()
+	}
+	prewarm = nil
+	if cfg.PrewarmDomains > 0 {
+		if history == nil || !service.DomainCacheEnabled() {
+			return errors.New("-prewarm-domains needs -history and -domain-cache-ttl")
+		}
+		prewarm = newPrewarmer(ctx, service, history, cfg)
+		prewarm.Start("startup")
+	}
+	go background.Run(ctx, time.Second)
+	go service.RetryInit(ctx, time.Second, time.Minute)
+	return nil
+}
+
+// Handler returns the routes of the enabled groups, each behind its cache
+// policy. Start has validated the groups, so an error here is a bug in
+// routes.
+func Handler() http.Handler {
+	handler, err := newRouter(enabledGroups)
+	if err != nil {
+		panic(err)
+	}
+	return handler
+}
+
+// route is one registered pattern, the cache policy of its responses and
+// the group that turns it on.
+type route struct {
+	pattern string
+	cache   cacheClass
+	group   routeGroup
+	handler http.Handler
+}
+
+// routes lists every route Handler registers.
+func routes() []route {
+	static := http.StripPrefix("/static/", http.FileServer(http.Dir(staticDir)))
+	return []route{
+		{"/static/", cacheStatic, groupUI, static},
+
+		{"/", cacheNoStore, groupUI, http.HandlerFunc(indexHandler)},
+		{"/verify", cacheNoStore, groupUI, http.HandlerFunc(verifyHandler)},
+		{"/api/verify", cacheNoStore, groupAPI, http.HandlerFunc(apiVerifyHandler)},
+		{"/api/verify/retry", cacheNoStore, groupAPI, http.HandlerFunc(apiRetryHandler)},
+		{"/api/verify/bulk", cacheNoStore, groupAPI, http.HandlerFunc(apiVerifyBulkHandler)},
+		{"/api/verify/csv", cacheNoStore, groupAPI, http.HandlerFunc(apiVerifyCSVHandler)},
+		{"/api/cache/{email}", cacheNoStore, groupAPI, http.HandlerFunc(apiCacheHandler)},
+		{"/api/domain/{domain}", cacheNoStore, groupAPI, http.HandlerFunc(apiDomainHandler)},
+		{"/jobs/{id}", cacheNoStore, groupUI, http.HandlerFunc(jobPageHandler)},
+		{"/events/{id}", cacheNoStore, groupUI, http.HandlerFunc(jobEventsHandler)},
+		{"/projects", cacheNoStore, groupUI, http.HandlerFunc(projectsPageHandler)},
+		{"/history", cacheNoStore, groupUI, http.HandlerFunc(historyPageHandler)},
+		{"/projects/{id}", cacheNoStore, groupUI, http.HandlerFunc(projectPageHandler)},
+		{"/api/jobs", cacheNoStore, groupAPI, http.HandlerFunc(submitJobHandler)},
+		{"/api/jobs/{id}", cacheNoStore, groupAPI, http.HandlerFunc(jobHandler)},
+		{"/api/jobs/{id}/cancel", cacheNoStore, groupAPI, http.HandlerFunc(jobCancelHandler)},
+		{"/api/jobs/{id}/results", cacheNoStore, groupAPI, http.HandlerFunc(jobResultsHandler)},
+		{"/api/jobs/{id}/export", cacheNoStore, groupAPI, http.HandlerFunc(jobExportHandler)},
+		{"/api/projects", cacheNoStore, groupAPI, http.HandlerFunc(projectsHandler)},
+		{"/api/projects/{id}", cacheNoStore, groupAPI, http.HandlerFunc(projectHandler)},
+		{"/api/watches", cacheNoStore, groupAPI, http.HandlerFunc(watchesHandler)},
+		{"/api/history", cacheNoStore, groupAPI, http.HandlerFunc(historyHandler)},
+		{"/api/history/export", cacheNoStore, groupAPI, http.HandlerFunc(historyExportHandler)},
+		{"/api/usage", cachePerKey, groupAPI, http.HandlerFunc(usageHandler)},
+		{"/api/send-check", cacheNoStore, groupAPI, http.HandlerFunc(sendCheckHandler)},
+		{"/api/suppressions/events", cacheNoStore, groupAPI, http.HandlerFunc(suppressionEventsHandler)},
+		{"/health", cacheNoStore, groupCore, http.HandlerFunc(healthHandler)},
+		{"/readyz", cacheNoStore, groupCore, http.HandlerFunc(readyzHandler)},
+		{"/metrics", cacheNoStore, groupMetrics, http.HandlerFunc(metricsHandler)},
+		{"/docs", cacheNoStore, groupDocs, http.HandlerFunc(docsHandler)},
+		{"/docs/examples", cacheNoStore, groupDocs, http.HandlerFunc(docsExamplesHandler)},
+		{"/docs/examples.json", cacheNoStore, groupDocs, http.HandlerFunc(docsExamplesJSONHandler)},
+		{"/api/openapi.json", cacheStatic, groupDocs, http.HandlerFunc(openAPIHandler)},
+		{"/api/docs", cacheStatic, groupDocs, http.HandlerFunc(apiDocsHandler)},
+		{"/admin/state", cacheNoStore, groupAdmin, http.HandlerFunc(adminStateHandler)},
+		{"/admin/prewarm", cacheNoStore, groupAdmin, http.HandlerFunc(adminPrewarmHandler)},
+		{"/admin/network", cacheNoStore, groupAdmin, http.HandlerFunc(adminNetworkHandler)},
+		{"/admin/usage", cacheNoStore, groupAdmin, http.HandlerFunc(adminUsageHandler)},
+		{"/admin/forwarding", cacheNoStore, groupAdmin, http.HandlerFunc(adminForwardingHandler)},
+		{"/admin/forwarding/{key}/{action}", cacheNoStore, groupAdmin, http.HandlerFunc(adminForwardingActionHandler)},
+		{"/admin/verifier/reload", cacheNoStore, groupAdmin, http.HandlerFunc(adminVerifierReloadHandler)},
+		{"/admin/tenants", cacheNoStore, groupAdmin, http.HandlerFunc(adminTenantsHandler)},
+		{"/api/admin/lists", cacheNoStore, groupAdmin, http.HandlerFunc(adminListsHandler)},
+		{"/api/admin/lists/{list}/{value}", cacheNoStore, groupAdmin, http.HandlerFunc(adminListEntryHandler)},
+		{"/admin/profiles", cacheNoStore, groupAdmin, http.HandlerFunc(adminProfilesHandler)},
+		{"/admin/profiles/reload", cacheNoStore, groupAdmin, http.HandlerFunc(adminProfilesReloadHandler)},
+		{"/admin/alerts/reload", cacheNoStore, groupAdmin, http.HandlerFunc(adminAlertsReloadHandler)},
+		{"/admin/suppressions", cacheNoStore, groupAdmin, http.HandlerFunc(adminSuppressionsHandler)},
+		{"/admin/suppressions/sources/{source}", cacheNoStore, groupAdmin, http.HandlerFunc(adminSuppressionSourceHandler)},
+		{"/admin/shadow-report", cacheNoStore, groupAdmin, http.HandlerFunc(adminShadowReportHandler)},
+		{"/admin/compliance", cacheNoStore, groupAdmin, http.HandlerFunc(adminComplianceHandler)},
+		{"/admin/circuits", cacheNoStore, groupAdmin, http.HandlerFunc(adminCircuitsHandler)},
+		{"/admin/capture", cacheNoStore, groupAdmin, http.HandlerFunc(adminCaptureHandler)},
+		{"/admin/capture/{id}", cacheNoStore, groupAdmin, http.HandlerFunc(adminCaptureDownloadHandler)},
+	}
+}
+
+// templatePath locates a web UI template.
+func templatePath(name string) string {
+	return filepath.Join(templateDir, name)
+}
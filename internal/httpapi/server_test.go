@@ -0,0 +1,75 @@
+package httpapi
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+
+	"email-verifier/pkg/verify"
+)
+
+// sharedListVerifier builds the disposable-domain list once for the whole
+// test binary; building it fetches the list over the network every time.
+var sharedListVerifier = sync.OnceValues(verify.NewListVerifier)
+
+func TestMain(m *testing.M) {
+	templateDir = filepath.Join("..", "..", "templates")
+	staticDir = filepath.Join("..", "..", "static")
+	service = verify.New(verify.Config{BuildVerifier: sharedListVerifier})
+	os.Exit(m.Run())
+}
+
+// useService replaces the server's Service for the duration of a test
+func useService(t *testing.T, cfg verify.Config) *verify.Service {
+	t.Helper()
+	if cfg.BuildVerifier == nil {
+		cfg.BuildVerifier = sharedListVerifier
+	}
+	saved := service
+	service = verify.New(cfg)
+	t.Cleanup(func() { service = saved })
+	return service
+}
+
+// TestAPIEndpoint tests the HTTP API endpoint
+func TestAPIEndpoint(t *testing.T) {
+	server := httptest.NewServer(Handler())
+	defer server.Close()
+
+	// Test API request
+	requestBody := map[string]string{
+		"email": "test@example.com",
+	}
+
+	jsonBody, _ := json.Marshal(requestBody)
+
+	resp, err := http.Post(server.URL+"/api/verify", "application/json", bytes.NewBuffer(jsonBody))
+	if err != nil {
+		t.Fatalf("Failed to make API request: %v", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		t.Errorf("Expected status 200, got %d", resp.StatusCode)
+	}
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatalf("Failed to read response body: %v", err)
+	}
+
+	var result verify.Result
+	if err := json.Unmarshal(body, &result); err != nil {
+		t.Fatalf("Failed to parse JSON response: %v", err)
+	}
+
+	if result.Email != "test@example.com" {
+		t.Errorf("Expected email to be test@example.com, got %s", result.Email)
+	}
+}
@@ -0,0 +1,226 @@
+package httpapi
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"math/rand"
+	"net/http"
+	"slices"
+	"sort"
+	"sync"
+	"time"
+
+	"email-verifier/pkg/verify"
+)
+
+// shadowComparison records one live verification next to its shadow run.
+// Addresses are kept only as hashes.
+type shadowComparison struct {
+	At               time.Time `json:"at"`
+	AddressHash      string    `json:"address_hash"`
+	PrimaryVerdict   string    `json:"primary_verdict"`
+	ShadowVerdict    string    `json:"shadow_verdict"`
+	PrimaryReachable string    `json:"primary_reachable"`
+	ShadowReachable  string    `json:"shadow_reachable"`
+}
+
+func (c shadowComparison) verdictAgrees() bool   { return c.PrimaryVerdict == c.ShadowVerdict }
+func (c shadowComparison) reachableAgrees() bool { return c.PrimaryReachable == c.ShadowReachable }
+
+// shadowRunner re-runs a sample of live verifications against a second
+// profile in the background and records how the two compare. Shadow runs
+// draw from their own per-minute budget so an experiment can't add more
+// than a fixed amount of probe traffic.
+type shadowRunner struct {
+	profile string
+	rate    float64 // fraction of verifications shadowed, 0 to 1
+	budget  int     // shadow runs per minute
+
+	mu          sync.Mutex
+	windowStart time.Time
+	used        int
+	overBudget  int64
+	reused      int64              // shadow runs the probing etiquette answered
+	laneBusy    int64              // shadow runs that got no lane slot in time
+	comparisons []shadowComparison // ordered by At
+
+	wg     sync.WaitGroup
+	verify func(string, verify.Options) *verify.Result
+	sample func() float64
+	now    func() time.Time
+}
+
+// shadow is nil unless -shadow-profile is set.
+var shadow *shadowRunner
+
+func newShadowRunner(profile string, rate float64, budget int) *shadowRunner {
+	return &shadowRunner{
+		profile: profile,
+		rate:    rate,
+		budget:  budget,
+		verify:  func(email string, opts verify.Options) *verify.Result { return service.Verify(email, opts) },
+		sample:  rand.Float64,
+		now:     time.Now,
+	}
+}
+
+// Maybe shadows a sample of verifications. It never blocks: the shadow run
+// happens on its own goroutine.
+func (s *shadowRunner) Maybe(email string, opts verify.Options, primary *verify.Result) {
+	if primary.Email == "" || s.sample() >= s.rate || !s.take() {
+		return
+	}
+
+	opts.Profile = s.profile
+	s.wg.Add(1)
+	go func() {
+		defer s.wg.Done()
+		// Shadow probes count against the same lanes as live ones
+		var result *verify.Result
+		l := laneFor(opts.Checks)
+		ctx, cancel := context.WithTimeout(context.Background(), waitFor(l))
+		defer cancel()
+		if err := l.Do(ctx, func() { result = s.verify(email, opts) }); err != nil {
+			s.mu.Lock()
+			s.laneBusy++
+			s.mu.Unlock()
+			return
+		}
+		if slices.Contains(result.Warnings, verify.WarningSMTPReused) {
+			// The shadow profile never reached the mail server, so
+			// there is nothing to compare
+			s.mu.Lock()
+			s.reused++
+			s.mu.Unlock()
+			return
+		}
+		s.record(shadowComparison{
+			At:               s.now().UTC(),
+			AddressHash:      verify.AddressHash(primary.Email),
+			PrimaryVerdict:   primary.Verdict,
+			ShadowVerdict:    result.Verdict,
+			PrimaryReachable: primary.Reachable,
+			ShadowReachable:  result.Reachable,
+		})
+	}()
+}
+
+// take spends one unit of this minute's budget.
+func (s *shadowRunner) take() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := s.now()
+	if now.Sub(s.windowStart) >= time.Minute {
+		s.windowStart = now
+		s.used = 0
+	}
+	if s.used >= s.budget {
+		s.overBudget++
+		return false
+	}
+	s.used++
+	return true
+}
+
+// BudgetUsed returns the percentage of this minute's budget spent.
+func (s *shadowRunner) BudgetUsed() float64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.budget <= 0 {
+		return 100
+	}
+	if s.now().Sub(s.windowStart) >= time.Minute {
+		return 0
+	}
+	return 100 * float64(s.used) / float64(s.budget)
+}
+
+func (s *shadowRunner) record(c shadowComparison) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	i := sort.Search(len(s.comparisons), func(i int) bool { return s.comparisons[i].At.After(c.At) })
+	s.comparisons = append(s.comparisons, shadowComparison{})
+	copy(s.comparisons[i+1:], s.comparisons[i:])
+	s.comparisons[i] = c
+}
+
+// Wait blocks until every shadow run started so far has been recorded.
+func (s *shadowRunner) Wait() { s.wg.Wait() }
+
+// Sweep drops comparisons older than ttl.
+func (s *shadowRunner) Sweep(now time.Time, ttl time.Duration) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	cutoff := now.Add(-ttl)
+	n := sort.Search(len(s.comparisons), func(i int) bool { return s.comparisons[i].At.After(cutoff) })
+	s.comparisons = append([]shadowComparison(nil), s.comparisons[n:]...)
+	return n
+}
+
+// shadowReport summarizes comparisons over a window.
+type shadowReport struct {
+	Profile            string         `json:"profile"`
+	Window             string         `json:"window"`
+	Comparisons        int            `json:"comparisons"`
+	VerdictAgreement   float64        `json:"verdict_agreement"`
+	ReachableAgreement float64        `json:"reachable_agreement"`
+	Disagreements      map[string]int `json:"disagreements"` // "primary->shadow" verdicts
+	OverBudget         int64          `json:"over_budget"`
+	Reused             int64          `json:"reused"`    // skipped, the etiquette reused the primary's probe
+	LaneBusy           int64          `json:"lane_busy"` // skipped, no lane slot within the wait
+}
+
+// Report summarizes the comparisons recorded within window of now.
+func (s *shadowRunner) Report(window time.Duration) shadowReport {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	report := shadowReport{
+		Profile:       s.profile,
+		Window:        window.String(),
+		Disagreements: map[string]int{},
+		OverBudget:    s.overBudget,
+		Reused:        s.reused,
+		LaneBusy:      s.laneBusy,
+	}
+	cutoff := s.now().Add(-window)
+	start := sort.Search(len(s.comparisons), func(i int) bool { return s.comparisons[i].At.After(cutoff) })
+	verdicts, reachable := 0, 0
+	for _, c := range s.comparisons[start:] {
+		report.Comparisons++
+		if c.verdictAgrees() {
+			verdicts++
+		} else {
+			report.Disagreements[fmt.Sprintf("%s->%s", c.PrimaryVerdict, c.ShadowVerdict)]++
+		}
+		if c.reachableAgrees() {
+			reachable++
+		}
+	}
+	if report.Comparisons > 0 {
+		report.VerdictAgreement = float64(verdicts) / float64(report.Comparisons)
+		report.ReachableAgreement = float64(reachable) / float64(report.Comparisons)
+	}
+	return report
+}
+
+func adminShadowReportHandler(w http.ResponseWriter, r *http.Request) {
+	if shadow == nil {
+		http.Error(w, "Shadow mode is not enabled", http.StatusNotFound)
+		return
+	}
+
+	window := 24 * time.Hour
+	if v := r.URL.Query().Get("window"); v != "" {
+		d, err := time.ParseDuration(v)
+		if err != nil || d <= 0 {
+			http.Error(w, "Invalid window", http.StatusBadRequest)
+			return
+		}
+		window = d
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(shadow.Report(window))
+}
@@ -0,0 +1,182 @@
+package httpapi
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"email-verifier/pkg/verify"
+	"email-verifier/pkg/verify/verifytest"
+	emailverifier "github.com/AfterShip/email-verifier"
+)
+
+// useShadowFakes routes SMTP probes through a fake where the "strict"
+// profile finds no deliverable mailboxes. Without polite the probing
+// etiquette is off, so shadow runs can probe addresses again.
+func useShadowFakes(t *testing.T, polite bool) {
+	t.Helper()
+	fake := verifytest.NewResolver()
+	smtp := verifytest.NewSMTP()
+	for d := 0; d < 2; d++ {
+		domain := fmt.Sprintf("d%d.mock", d)
+		fake.MX[domain] = []*net.MX{{Host: "mx." + domain + ".", Pref: 10}}
+		smtp.CatchAll[domain] = d%2 == 0
+		smtp.Mailboxes["user0@"+domain] = true
+	}
+	useService(t, verify.Config{Resolver: fake, Polite: verify.PoliteConfig{Off: !polite}, Prober: func(ctx context.Context, profile, domain, username string, catchAll bool) (*emailverifier.SMTP, error) {
+		result, err := smtp.Probe(ctx, profile, domain, username, catchAll)
+		if profile == "strict" {
+			result.Deliverable = false
+		}
+		return result, err
+	}})
+}
+
+// TestShadowComparisons tests that shadow runs use the shadow profile and are summarized per verdict pair
+func TestShadowComparisons(t *testing.T) {
+	useShadowFakes(t, false)
+	s := newShadowRunner("strict", 1, 100)
+	opts := verify.Options{Checks: verify.MustParseChecks(verify.CheckSMTP)}
+
+	// d0 is catch-all, so only user0@d1.mock should disagree
+	for _, email := range []string{"user0@d0.mock", "user0@d1.mock", "user1@d1.mock"} {
+		s.Maybe(email, opts, service.Verify(email, opts))
+	}
+	s.Wait()
+
+	report := s.Report(time.Hour)
+	if report.Comparisons != 3 {
+		t.Fatalf("Expected 3 comparisons, got %d", report.Comparisons)
+	}
+	if got := report.Disagreements[verify.VerdictDeliverable+"->"+verify.VerdictUndeliverable]; got != 1 {
+		t.Errorf("Expected 1 deliverable->undeliverable disagreement, got %v", report.Disagreements)
+	}
+	if report.VerdictAgreement < 0.66 || report.VerdictAgreement > 0.67 {
+		t.Errorf("Expected verdict agreement of 2/3, got %v", report.VerdictAgreement)
+	}
+}
+
+// TestShadowBudget tests that shadow runs stop at the per-minute budget and resume in the next minute
+func TestShadowBudget(t *testing.T) {
+	useShadowFakes(t, false)
+	now := time.Date(2024, 3, 3, 0, 0, 0, 0, time.UTC)
+	s := newShadowRunner("strict", 1, 2)
+	s.now = func() time.Time { return now }
+	opts := verify.Options{Checks: verify.MustParseChecks(verify.CheckSMTP)}
+	primary := service.Verify("user0@d1.mock", opts)
+
+	for i := 0; i < 5; i++ {
+		s.Maybe("user0@d1.mock", opts, primary)
+	}
+	s.Wait()
+	if report := s.Report(time.Hour); report.Comparisons != 2 || report.OverBudget != 3 {
+		t.Errorf("Expected 2 comparisons and 3 over budget, got %d and %d", report.Comparisons, report.OverBudget)
+	}
+
+	now = now.Add(time.Minute)
+	s.Maybe("user0@d1.mock", opts, primary)
+	s.Wait()
+	if report := s.Report(time.Hour); report.Comparisons != 3 {
+		t.Errorf("Expected budget to reset after a minute, got %d comparisons", report.Comparisons)
+	}
+}
+
+// TestShadowPolite tests that shadow runs the probing etiquette answered from the primary's probe are skipped and counted
+func TestShadowPolite(t *testing.T) {
+	useShadowFakes(t, true)
+	s := newShadowRunner("strict", 1, 100)
+	opts := verify.Options{Checks: verify.MustParseChecks(verify.CheckSMTP)}
+
+	s.Maybe("user0@d1.mock", opts, service.Verify("user0@d1.mock", opts))
+	s.Wait()
+	if report := s.Report(time.Hour); report.Comparisons != 0 || report.Reused != 1 {
+		t.Errorf("Expected no comparisons and 1 reused, got %+v", report)
+	}
+}
+
+// TestShadowLaneBusy tests that shadow runs wait for an SMTP lane slot and are counted when they get none
+func TestShadowLaneBusy(t *testing.T) {
+	useShadowFakes(t, false)
+	s := newShadowRunner("strict", 1, 100)
+	opts := verify.Options{Checks: verify.MustParseChecks(verify.CheckSMTP)}
+	primary := service.Verify("user0@d1.mock", opts)
+
+	useFullLanes(t)
+	s.Maybe("user0@d1.mock", opts, primary)
+	s.Wait()
+	if report := s.Report(time.Hour); report.Comparisons != 0 || report.LaneBusy != 1 {
+		t.Errorf("Expected no comparisons and 1 lane busy, got %+v", report)
+	}
+}
+
+// TestShadowSampling tests that unsampled verifications are not shadowed or charged to the budget
+func TestShadowSampling(t *testing.T) {
+	useShadowFakes(t, false)
+	s := newShadowRunner("strict", 0.25, 100)
+	samples := []float64{0.1, 0.5, 0.9, 0.2}
+	s.sample = func() float64 { v := samples[0]; samples = samples[1:]; return v }
+	opts := verify.Options{Checks: verify.MustParseChecks(verify.CheckSMTP)}
+	primary := service.Verify("user0@d1.mock", opts)
+
+	for i := 0; i < 4; i++ {
+		s.Maybe("user0@d1.mock", opts, primary)
+	}
+	s.Wait()
+	if report := s.Report(time.Hour); report.Comparisons != 2 || report.OverBudget != 0 {
+		t.Errorf("Expected 2 sampled comparisons, got %d (%d over budget)", report.Comparisons, report.OverBudget)
+	}
+}
+
+// TestShadowReportWindow tests the report window and sweep
+func TestShadowReportWindow(t *testing.T) {
+	now := time.Date(2024, 3, 3, 0, 0, 0, 0, time.UTC)
+	s := newShadowRunner("strict", 1, 100)
+	s.now = func() time.Time { return now }
+	s.record(shadowComparison{At: now.Add(-2 * time.Hour), PrimaryVerdict: verify.VerdictRisky, ShadowVerdict: verify.VerdictUnknown})
+	s.record(shadowComparison{At: now.Add(-time.Minute), PrimaryVerdict: verify.VerdictDeliverable, ShadowVerdict: verify.VerdictDeliverable})
+
+	if report := s.Report(time.Hour); report.Comparisons != 1 || report.VerdictAgreement != 1 {
+		t.Errorf("Expected 1 agreeing comparison in the last hour, got %+v", report)
+	}
+	if evicted := s.Sweep(now, time.Hour); evicted != 1 {
+		t.Errorf("Expected 1 eviction, got %d", evicted)
+	}
+	if report := s.Report(24 * time.Hour); report.Comparisons != 1 {
+		t.Errorf("Expected 1 comparison after sweep, got %d", report.Comparisons)
+	}
+}
+
+// TestShadowReportHandler tests the admin endpoint
+func TestShadowReportHandler(t *testing.T) {
+	original := shadow
+	defer func() { shadow = original }()
+
+	shadow = nil
+	w := httptest.NewRecorder()
+	adminShadowReportHandler(w, httptest.NewRequest(http.MethodGet, "/admin/shadow-report", nil))
+	if w.Code != http.StatusNotFound {
+		t.Errorf("Expected 404 when disabled, got %d", w.Code)
+	}
+
+	shadow = newShadowRunner("strict", 1, 100)
+	w = httptest.NewRecorder()
+	adminShadowReportHandler(w, httptest.NewRequest(http.MethodGet, "/admin/shadow-report?window=bogus", nil))
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("Expected 400 for a bad window, got %d", w.Code)
+	}
+
+	w = httptest.NewRecorder()
+	adminShadowReportHandler(w, httptest.NewRequest(http.MethodGet, "/admin/shadow-report?window=1h", nil))
+	var report shadowReport
+	if err := json.NewDecoder(w.Body).Decode(&report); err != nil {
+		t.Fatal(err)
+	}
+	if report.Profile != "strict" || report.Window != "1h0m0s" {
+		t.Errorf("Expected strict profile over 1h, got %+v", report)
+	}
+}
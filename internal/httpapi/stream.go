@@ -0,0 +1,60 @@
+package httpapi
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+
+	"email-verifier/pkg/verify"
+)
+
+// stageFinal is the last event of a streamed verification, carrying the
+// complete result.
+const stageFinal = "final"
+
+// stageEvent is one NDJSON line of a streamed verification.
+type stageEvent struct {
+	Stage  string         `json:"stage"`
+	Result *verify.Result `json:"result"`
+}
+
+// stageWriter streams a verification's stages as NDJSON, flushing after
+// each one. Once the client has gone it asks Verify to stop.
+type stageWriter struct {
+	w       http.ResponseWriter
+	ctx     context.Context
+	started bool
+	gone    bool
+}
+
+func newStageWriter(w http.ResponseWriter, ctx context.Context) *stageWriter {
+	return &stageWriter{w: w, ctx: ctx}
+}
+
+// Stage is the verification's Options.Progress.
+func (s *stageWriter) Stage(stage string, partial *verify.Result) bool {
+	s.write(stage, partial)
+	return !s.gone
+}
+
+// Final sends the complete result.
+func (s *stageWriter) Final(result *verify.Result) { s.write(stageFinal, result) }
+
+// Gone reports whether the client disconnected before the end.
+func (s *stageWriter) Gone() bool { return s.gone }
+
+func (s *stageWriter) write(stage string, result *verify.Result) {
+	if s.gone || s.ctx.Err() != nil {
+		s.gone = true
+		return
+	}
+	if !s.started {
+		s.w.Header().Set("Content-Type", "application/x-ndjson")
+		s.started = true
+	}
+	if err := json.NewEncoder(s.w).Encode(stageEvent{Stage: stage, Result: result}); err != nil {
+		s.gone = true
+		return
+	}
+	http.NewResponseController(s.w).Flush()
+}
@@ -0,0 +1,113 @@
+package httpapi
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+
+	"email-verifier/pkg/verify"
+	"email-verifier/pkg/verify/verifytest"
+)
+
+// useStreamService installs a service whose one mail server knows
+// jane@partner.mock, without the probing etiquette so the same address
+// can be probed streamed and plain
+func useStreamService(t *testing.T) *verifytest.SMTP {
+	t.Helper()
+	fake := verifytest.NewResolver()
+	fake.MX["partner.mock"] = []*net.MX{{Host: "mx.partner.mock.", Pref: 10}}
+	smtp := verifytest.NewSMTP()
+	smtp.Mailboxes["jane@partner.mock"] = true
+	useService(t, verify.Config{Resolver: fake, Prober: smtp.Probe, Polite: verify.PoliteConfig{Off: true}})
+	return smtp
+}
+
+// postVerify sends body to /api/verify with query appended
+func postVerify(t *testing.T, query, body string) *httptest.ResponseRecorder {
+	t.Helper()
+	rec := httptest.NewRecorder()
+	apiVerifyHandler(rec, httptest.NewRequest(http.MethodPost, "/api/verify"+query, strings.NewReader(body)))
+	return rec
+}
+
+// TestStreamedVerification tests that stages arrive in order and the final event matches the plain response
+func TestStreamedVerification(t *testing.T) {
+	useStreamService(t)
+	testCases := []struct {
+		body   string
+		stages []string
+	}{
+		{`{"email": "jane@partner.mock", "checks": "smtp"}`, []string{verify.StageSyntax, verify.StageLists, verify.StageDNS, verify.StageSMTP, stageFinal}},
+		{`{"email": "jane@partner.mock"}`, []string{verify.StageSyntax, verify.StageLists, verify.StageDNS, stageFinal}},
+		{`{"email": "jane@partner.mock", "mode": "fast"}`, []string{verify.StageSyntax, verify.StageLists, stageFinal}},
+		{`{"email": "jane@mailinator.com", "checks": "disposable,smtp"}`, []string{verify.StageSyntax, verify.StageLists, stageFinal}},
+		{`{"email": "not-an-address"}`, []string{stageFinal}},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.body, func(t *testing.T) {
+			rec := postVerify(t, "?stream=true", tc.body)
+			if ct := rec.Header().Get("Content-Type"); ct != "application/x-ndjson" {
+				t.Fatalf("Expected NDJSON, got %q", ct)
+			}
+			var stages []string
+			var final json.RawMessage
+			scanner := bufio.NewScanner(rec.Body)
+			for scanner.Scan() {
+				var event struct {
+					Stage  string          `json:"stage"`
+					Result json.RawMessage `json:"result"`
+				}
+				if err := json.Unmarshal(scanner.Bytes(), &event); err != nil {
+					t.Fatalf("Failed to parse event %q: %v", scanner.Text(), err)
+				}
+				stages = append(stages, event.Stage)
+				final = event.Result
+			}
+			if !reflect.DeepEqual(stages, tc.stages) {
+				t.Fatalf("Expected stages %v, got %v", tc.stages, stages)
+			}
+
+			var streamed, plain map[string]interface{}
+			json.Unmarshal(final, &streamed)
+			json.NewDecoder(postVerify(t, "", tc.body).Body).Decode(&plain)
+			if !reflect.DeepEqual(streamed, plain) {
+				t.Errorf("Expected the final event to match the plain response\nstreamed: %v\nplain:    %v", streamed, plain)
+			}
+		})
+	}
+}
+
+// cancelOnWrite cancels the request's context as soon as anything is written, like a client that hangs up after the first event
+type cancelOnWrite struct {
+	*httptest.ResponseRecorder
+	cancel context.CancelFunc
+}
+
+func (c cancelOnWrite) Write(p []byte) (int, error) {
+	defer c.cancel()
+	return c.ResponseRecorder.Write(p)
+}
+
+// TestStreamedVerificationDisconnect tests that a client hanging up cancels the remaining stages
+func TestStreamedVerificationDisconnect(t *testing.T) {
+	smtp := useStreamService(t)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	req := httptest.NewRequest(http.MethodPost, "/api/verify?stream=true", strings.NewReader(`{"email": "jane@partner.mock", "checks": "smtp"}`)).WithContext(ctx)
+	rec := httptest.NewRecorder()
+	apiVerifyHandler(cancelOnWrite{rec, cancel}, req)
+
+	if lines := strings.Count(rec.Body.String(), "\n"); lines != 1 || !strings.Contains(rec.Body.String(), `"stage":"syntax"`) {
+		t.Errorf("Expected only the syntax event, got %s", rec.Body.String())
+	}
+	if smtp.Probes() != 0 {
+		t.Errorf("Expected no probe after the client left, got %d", smtp.Probes())
+	}
+}
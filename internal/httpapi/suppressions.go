@@ -0,0 +1,390 @@
+package httpapi
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"email-verifier/pkg/verify"
+)
+
+// maxSuppressionDump bounds how much of a suppression dump is read.
+const maxSuppressionDump = 64 << 20
+
+var suppressionEvents = metrics.CounterVec("suppression_events_total", "Suppression webhook events by outcome.", "outcome")
+
+// suppressionSource is an ESP suppression list synced into the store. A
+// source with a URL is pulled every interval; one with a secret accepts
+// signed events at /api/suppressions/events. A source may do both.
+type suppressionSource struct {
+	Tenant   string `json:"tenant"`
+	URL      string `json:"url,omitempty"`
+	Format   string `json:"format,omitempty"` // csv (the default) or json
+	Interval string `json:"interval,omitempty"`
+	Secret   string `json:"secret,omitempty"`
+
+	name     string
+	interval time.Duration
+}
+
+// suppressionSourceStatus is a source's last pull, for /admin/suppressions.
+type suppressionSourceStatus struct {
+	Source   string     `json:"source"`
+	Tenant   string     `json:"tenant"`
+	Pull     bool       `json:"pull"`
+	Events   bool       `json:"events"`
+	LastPull *time.Time `json:"last_pull,omitempty"`
+	Listed   int        `json:"listed"`
+	Added    int        `json:"added"`
+	Removed  int        `json:"removed"`
+	Error    string     `json:"error,omitempty"`
+}
+
+// suppressionSyncer pulls dumps from and takes events for the configured
+// sources.
+type suppressionSyncer struct {
+	mu      sync.Mutex
+	sources map[string]*suppressionSource
+	status  map[string]*suppressionSourceStatus
+	client  *http.Client
+	now     func() time.Time
+}
+
+var suppressionSync = newSuppressionSyncer(nil)
+
+func newSuppressionSyncer(sources map[string]*suppressionSource) *suppressionSyncer {
+	s := &suppressionSyncer{
+		sources: sources,
+		status:  make(map[string]*suppressionSourceStatus, len(sources)),
+		client:  newHTTPClient(time.Minute),
+		now:     time.Now,
+	}
+	for name, source := range sources {
+		s.status[name] = &suppressionSourceStatus{Source: name, Tenant: source.Tenant, Pull: source.URL != "", Events: source.Secret != ""}
+	}
+	return s
+}
+
+// loadSuppressionSources reads a JSON object mapping source names to
+// sources.
+func loadSuppressionSources(path string) (map[string]*suppressionSource, error) {
+	if path == "" {
+		return nil, nil
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var sources map[string]*suppressionSource
+	if err := json.Unmarshal(data, &sources); err != nil {
+		return nil, fmt.Errorf("parse suppression sources %s: %v", path, err)
+	}
+	for name, source := range sources {
+		if name == verify.SuppressionManual {
+			return nil, fmt.Errorf("suppression sources %s: %q is reserved for manual suppressions", path, name)
+		}
+		if source.URL == "" && source.Secret == "" {
+			return nil, fmt.Errorf("suppression sources %s: source %q needs a url, a secret or both", path, name)
+		}
+		if source.Tenant == "" {
+			source.Tenant = verify.DefaultTenant
+		}
+		switch source.Format {
+		case "", "csv", "json":
+		default:
+			return nil, fmt.Errorf("suppression sources %s: source %q has unknown format %q: want csv or json", path, name, source.Format)
+		}
+		source.name = name
+		source.interval = time.Hour
+		if source.Interval != "" {
+			source.interval, err = time.ParseDuration(source.Interval)
+			if err != nil || source.interval < time.Minute {
+				return nil, fmt.Errorf("suppression sources %s: source %q has invalid interval %q: want a duration of at least 1m", path, name, source.Interval)
+			}
+		}
+	}
+	return sources, nil
+}
+
+// Register schedules a pull of every source with a URL.
+func (s *suppressionSyncer) Register(sched *scheduler) {
+	for _, source := range s.sources {
+		if source.URL == "" {
+			continue
+		}
+		sched.Register("suppression_pull:"+source.name, source.interval, func(ctx context.Context, now time.Time) error {
+			return s.Pull(ctx, source)
+		})
+	}
+}
+
+// Pull fetches source's dump and makes it the source's whole list.
+func (s *suppressionSyncer) Pull(ctx context.Context, source *suppressionSource) error {
+	if service.NetworkDisabled() {
+		// The next pull after the network is back catches up
+		return nil
+	}
+	addresses, err := s.fetch(ctx, source)
+	now := s.now()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	status := s.status[source.name]
+	status.LastPull = &now
+	if err != nil {
+		status.Error = err.Error()
+		return err
+	}
+	status.Error = ""
+	status.Listed = len(addresses)
+	status.Added, status.Removed = service.Suppressions().Replace(source.Tenant, source.name, addresses, now)
+	return nil
+}
+
+func (s *suppressionSyncer) fetch(ctx context.Context, source *suppressionSource) ([]string, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, source.URL, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("source returned status %d", resp.StatusCode)
+	}
+	// A truncated dump would drop every suppression past the cut
+	body, err := io.ReadAll(io.LimitReader(resp.Body, maxSuppressionDump+1))
+	if err != nil {
+		return nil, err
+	}
+	if len(body) > maxSuppressionDump {
+		return nil, fmt.Errorf("dump is over %d bytes", maxSuppressionDump)
+	}
+	if source.Format == "json" {
+		return parseJSONDump(bytes.NewReader(body))
+	}
+	return parseCSVDump(bytes.NewReader(body))
+}
+
+// parseCSVDump reads addresses from the email (or address) column, or the
+// first column if there is no header row.
+func parseCSVDump(r io.Reader) ([]string, error) {
+	reader := csv.NewReader(r)
+	reader.FieldsPerRecord = -1
+	records, err := reader.ReadAll()
+	if err != nil {
+		return nil, fmt.Errorf("parse csv dump: %v", err)
+	}
+	column := 0
+	if len(records) > 0 && !strings.Contains(records[0][0], "@") {
+		column = -1
+		for i, field := range records[0] {
+			if name := strings.ToLower(strings.TrimSpace(field)); name == "email" || name == "address" {
+				column = i
+			}
+		}
+		if column < 0 {
+			return nil, errors.New("parse csv dump: no email column")
+		}
+		records = records[1:]
+	}
+	addresses := make([]string, 0, len(records))
+	for _, record := range records {
+		if column < len(record) {
+			addresses = append(addresses, record[column])
+		}
+	}
+	return addresses, nil
+}
+
+// parseJSONDump reads an array of addresses or of objects with an email
+// field.
+func parseJSONDump(r io.Reader) ([]string, error) {
+	var raw []json.RawMessage
+	if err := json.NewDecoder(r).Decode(&raw); err != nil {
+		return nil, fmt.Errorf("parse json dump: %v", err)
+	}
+	addresses := make([]string, 0, len(raw))
+	for _, item := range raw {
+		var address string
+		if json.Unmarshal(item, &address) != nil {
+			var object struct {
+				Email string `json:"email"`
+			}
+			if err := json.Unmarshal(item, &object); err != nil {
+				return nil, fmt.Errorf("parse json dump: want strings or objects with an email field")
+			}
+			address = object.Email
+		}
+		addresses = append(addresses, address)
+	}
+	return addresses, nil
+}
+
+// Statuses returns every source's status, ordered by name.
+func (s *suppressionSyncer) Statuses() []suppressionSourceStatus {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	list := make([]suppressionSourceStatus, 0, len(s.status))
+	for _, status := range s.status {
+		list = append(list, *status)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Source < list[j].Source })
+	return list
+}
+
+// suppressionEvent is one bounce or complaint from an ESP.
+type suppressionEvent struct {
+	Type       string    `json:"type"` // bounce or complaint
+	BounceType string    `json:"bounce_type,omitempty"`
+	Email      string    `json:"email"`
+	Timestamp  time.Time `json:"timestamp"`
+}
+
+// suppressionEventsHandler takes a signed batch of events from a source and
+// suppresses the bounced and complaining addresses at once. Transient
+// bounces and other event types are ignored.
+func suppressionEventsHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	name := r.URL.Query().Get("source")
+	source := suppressionSync.sources[name]
+	if source == nil || source.Secret == "" {
+		http.Error(w, "Unknown event source", http.StatusNotFound)
+		return
+	}
+	body, err := io.ReadAll(io.LimitReader(r.Body, maxSuppressionDump))
+	if err != nil {
+		http.Error(w, "Failed to read body", http.StatusBadRequest)
+		return
+	}
+	signature := strings.TrimPrefix(r.Header.Get("X-Signature"), "sha256=")
+	if !hmac.Equal([]byte(signature), []byte(signBody(source.Secret, body))) {
+		suppressionEvents.Add("bad_signature", 1)
+		http.Error(w, "Invalid signature", http.StatusUnauthorized)
+		return
+	}
+
+	var request struct {
+		Events []suppressionEvent `json:"events"`
+	}
+	if err := json.Unmarshal(body, &request); err != nil {
+		http.Error(w, `Expected {"events": [{"type": "bounce|complaint", "email": "...", "timestamp": "..."}]}`, http.StatusBadRequest)
+		return
+	}
+	added, ignored := 0, 0
+	for _, event := range request.Events {
+		if !suppressingEvent(event) {
+			ignored++
+			continue
+		}
+		at := event.Timestamp
+		if at.IsZero() {
+			at = suppressionSync.now()
+		}
+		if service.Suppressions().Add(source.Tenant, name, event.Email, at) {
+			added++
+		} else {
+			ignored++
+		}
+	}
+	suppressionEvents.Add("suppressed", int64(added))
+	suppressionEvents.Add("ignored", int64(ignored))
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"suppressed": added,
+		"ignored":    ignored,
+	})
+}
+
+func suppressingEvent(event suppressionEvent) bool {
+	switch event.Type {
+	case "complaint":
+		return true
+	case "bounce":
+		return event.BounceType != "transient" && event.BounceType != "soft"
+	}
+	return false
+}
+
+// adminSuppressionsHandler lists a tenant's runtime suppressions and the
+// sources' sync status, and on POST suppresses or unsuppresses an address
+// by hand.
+func adminSuppressionsHandler(w http.ResponseWriter, r *http.Request) {
+	tenant := r.URL.Query().Get("tenant")
+	switch r.Method {
+	case http.MethodGet:
+	case http.MethodPost:
+		var req struct {
+			Tenant string `json:"tenant"`
+			Email  string `json:"email"`
+			Action string `json:"action"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Email == "" {
+			http.Error(w, `Expected {"tenant": "...", "email": "...", "action": "suppress|unsuppress"}`, http.StatusBadRequest)
+			return
+		}
+		tenant = req.Tenant
+		if tenant == "" {
+			tenant = verify.DefaultTenant
+		}
+		var ok bool
+		switch req.Action {
+		case "suppress":
+			ok = service.Suppressions().Add(tenant, verify.SuppressionManual, req.Email, suppressionSync.now())
+		case "unsuppress":
+			ok = service.Suppressions().Unsuppress(tenant, req.Email)
+		default:
+			http.Error(w, "Unknown action (use suppress or unsuppress)", http.StatusBadRequest)
+			return
+		}
+		if !ok {
+			http.Error(w, "Expected an address or @domain", http.StatusBadRequest)
+			return
+		}
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if tenant == "" {
+		tenant = verify.DefaultTenant
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"tenant":       tenant,
+		"suppressions": service.Suppressions().List(tenant),
+		"sources":      suppressionSync.Statuses(),
+	})
+}
+
+// adminSuppressionSourceHandler removes everything a source suppressed. A
+// pulled source lists its addresses again on its next pull unless it is
+// taken out of the config.
+func adminSuppressionSourceHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodDelete {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	removed := service.Suppressions().RemoveSource(r.PathValue("source"))
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"source":  r.PathValue("source"),
+		"removed": removed,
+	})
+}
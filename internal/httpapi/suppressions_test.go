@@ -0,0 +1,216 @@
+package httpapi
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"email-verifier/pkg/verify"
+)
+
+// useSuppressionSources installs sources on a fresh service for the duration of a test
+func useSuppressionSources(t *testing.T, sources map[string]*suppressionSource) *verify.Service {
+	t.Helper()
+	s := useService(t, verify.Config{})
+	for name, source := range sources {
+		source.name = name
+	}
+	saved := suppressionSync
+	suppressionSync = newSuppressionSyncer(sources)
+	t.Cleanup(func() { suppressionSync = saved })
+	return s
+}
+
+// TestSuppressionPull tests that a pulled dump is merged in and that addresses it drops are removed
+func TestSuppressionPull(t *testing.T) {
+	dump := "email,reason\njane@partner.mock,bounce\n@spamtrap.mock,complaint\n"
+	esp := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(dump))
+	}))
+	defer esp.Close()
+	source := &suppressionSource{Tenant: verify.DefaultTenant, URL: esp.URL}
+	s := useSuppressionSources(t, map[string]*suppressionSource{"esp": source})
+
+	if err := suppressionSync.Pull(context.Background(), source); err != nil {
+		t.Fatalf("Pull failed: %v", err)
+	}
+	if !s.Suppressions().Suppressed(verify.DefaultTenant, "jane", "partner.mock") || !s.Suppressions().Suppressed(verify.DefaultTenant, "anyone", "spamtrap.mock") {
+		t.Errorf("Expected the dump's address and domain suppressed, got %+v", s.Suppressions().List(verify.DefaultTenant))
+	}
+	result := s.Verify("jane@partner.mock", verify.Options{Checks: verify.DefaultChecks})
+	if !result.Suppressed {
+		t.Errorf("Expected the verification suppressed, got %+v", result)
+	}
+
+	dump = "jane@partner.mock\n"
+	suppressionSync.Pull(context.Background(), source)
+	if s.Suppressions().Suppressed(verify.DefaultTenant, "anyone", "spamtrap.mock") {
+		t.Error("Expected the dropped domain removed")
+	}
+	status := suppressionSync.Statuses()[0]
+	if status.Listed != 1 || status.Removed != 1 || status.LastPull == nil || status.Error != "" {
+		t.Errorf("Expected the last pull's counts, got %+v", status)
+	}
+}
+
+// TestParseDumps tests the CSV and JSON dump formats
+func TestParseDumps(t *testing.T) {
+	testCases := []struct {
+		name     string
+		parse    func(string) ([]string, error)
+		dump     string
+		expected string
+		wantErr  bool
+	}{
+		{"csv without header", csvDump, "a@x.mock\nb@x.mock,extra\n", "a@x.mock b@x.mock", false},
+		{"csv header", csvDump, "created,Address\n2026-01-01,a@x.mock\n", "a@x.mock", false},
+		{"csv without email column", csvDump, "created,reason\n2026-01-01,bounce\n", "", true},
+		{"json strings", jsonDump, `["a@x.mock", "@y.mock"]`, "a@x.mock @y.mock", false},
+		{"json objects", jsonDump, `[{"email": "a@x.mock", "reason": "bounce"}]`, "a@x.mock", false},
+		{"json malformed", jsonDump, `{"email": "a@x.mock"}`, "", true},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			addresses, err := tc.parse(tc.dump)
+			if (err != nil) != tc.wantErr {
+				t.Fatalf("Expected error %v, got %v", tc.wantErr, err)
+			}
+			if got := strings.Join(addresses, " "); got != tc.expected {
+				t.Errorf("Expected %q, got %q", tc.expected, got)
+			}
+		})
+	}
+}
+
+func csvDump(s string) ([]string, error)  { return parseCSVDump(strings.NewReader(s)) }
+func jsonDump(s string) ([]string, error) { return parseJSONDump(strings.NewReader(s)) }
+
+// postEvents sends a batch of events to the webhook, signed with secret
+func postEvents(t *testing.T, source, secret, body string) *httptest.ResponseRecorder {
+	t.Helper()
+	req := httptest.NewRequest(http.MethodPost, "/api/suppressions/events?source="+source, strings.NewReader(body))
+	req.Header.Set("X-Signature", "sha256="+signBody(secret, []byte(body)))
+	rec := httptest.NewRecorder()
+	Handler().ServeHTTP(rec, req)
+	return rec
+}
+
+// TestSuppressionEvents tests that signed bounce and complaint events suppress at once and that everything else is refused or ignored
+func TestSuppressionEvents(t *testing.T) {
+	s := useSuppressionSources(t, map[string]*suppressionSource{
+		"events": {Tenant: "acme", Secret: "s3cret"},
+		"pulled": {Tenant: "acme", URL: "http://esp.mock/dump"},
+	})
+	body := `{"events": [
+		{"type": "bounce", "email": "jane@partner.mock"},
+		{"type": "complaint", "email": "joe@partner.mock"},
+		{"type": "bounce", "bounce_type": "transient", "email": "full@partner.mock"},
+		{"type": "delivery", "email": "ok@partner.mock"}
+	]}`
+
+	rec := postEvents(t, "events", "s3cret", body)
+	var response map[string]int
+	json.NewDecoder(rec.Body).Decode(&response)
+	if rec.Code != http.StatusOK || response["suppressed"] != 2 || response["ignored"] != 2 {
+		t.Errorf("Expected 2 suppressed and 2 ignored, got %d %v", rec.Code, response)
+	}
+	for user, expected := range map[string]bool{"jane": true, "joe": true, "full": false, "ok": false} {
+		if got := s.Suppressions().Suppressed("acme", user, "partner.mock"); got != expected {
+			t.Errorf("Expected %s suppressed %v, got %v", user, expected, got)
+		}
+	}
+
+	for _, tc := range []struct {
+		source, secret string
+		status         int
+	}{
+		{"events", "wrong", http.StatusUnauthorized},
+		{"pulled", "", http.StatusNotFound},
+		{"unknown", "s3cret", http.StatusNotFound},
+	} {
+		if rec := postEvents(t, tc.source, tc.secret, body); rec.Code != tc.status {
+			t.Errorf("Expected %d for source %s, got %d", tc.status, tc.source, rec.Code)
+		}
+	}
+}
+
+// TestAdminSuppressions tests manual unsuppression of an imported address, manual suppression and per-source removal
+func TestAdminSuppressions(t *testing.T) {
+	s := useSuppressionSources(t, nil)
+	s.Suppressions().Add("acme", "esp", "jane@partner.mock", time.Now().Add(-time.Hour))
+	s.Suppressions().Add("acme", "esp", "joe@partner.mock", time.Now().Add(-time.Hour))
+	handler := Handler()
+	post := func(body string) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/admin/suppressions", strings.NewReader(body)))
+		return rec
+	}
+
+	if rec := post(`{"tenant": "acme", "email": "jane@partner.mock", "action": "unsuppress"}`); rec.Code != http.StatusOK {
+		t.Fatalf("Expected 200, got %d: %s", rec.Code, rec.Body.String())
+	}
+	if s.Suppressions().Suppressed("acme", "jane", "partner.mock") {
+		t.Error("Expected the manual unsuppression to override the import")
+	}
+	post(`{"email": "temp@example.com", "action": "suppress"}`)
+	if !s.Suppressions().Suppressed(verify.DefaultTenant, "temp", "example.com") {
+		t.Error("Expected the manual suppression in the default tenant")
+	}
+	if rec := post(`{"email": "not-an-address", "action": "suppress"}`); rec.Code != http.StatusBadRequest {
+		t.Errorf("Expected 400 for a non-address, got %d", rec.Code)
+	}
+
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodDelete, "/admin/suppressions/sources/esp", nil))
+	var removed map[string]interface{}
+	json.NewDecoder(rec.Body).Decode(&removed)
+	if removed["removed"] != float64(2) || s.Suppressions().Suppressed("acme", "joe", "partner.mock") {
+		t.Errorf("Expected both of the source's entries removed, got %v", removed)
+	}
+
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/admin/suppressions?tenant=acme", nil))
+	var listing struct {
+		Suppressions []verify.SuppressionEntry `json:"suppressions"`
+	}
+	json.NewDecoder(rec.Body).Decode(&listing)
+	if len(listing.Suppressions) != 1 || listing.Suppressions[0].Unsuppressed == nil {
+		t.Errorf("Expected only jane's unsuppression kept, got %+v", listing.Suppressions)
+	}
+}
+
+// TestLoadSuppressionSources tests that sources are validated at load
+func TestLoadSuppressionSources(t *testing.T) {
+	testCases := []struct {
+		name    string
+		config  string
+		wantErr string
+	}{
+		{"valid", `{"ses": {"tenant": "acme", "url": "https://esp.mock/dump", "interval": "30m"}, "hooks": {"secret": "x"}}`, ""},
+		{"nothing to do", `{"ses": {"tenant": "acme"}}`, "needs a url, a secret or both"},
+		{"reserved", `{"manual": {"secret": "x"}}`, "reserved"},
+		{"format", `{"ses": {"url": "https://esp.mock", "format": "xml"}}`, "unknown format"},
+		{"interval", `{"ses": {"url": "https://esp.mock", "interval": "5s"}}`, "invalid interval"},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "sources.json")
+			os.WriteFile(path, []byte(tc.config), 0o600)
+			sources, err := loadSuppressionSources(path)
+			switch {
+			case tc.wantErr == "" && err != nil:
+				t.Errorf("Expected no error, got %v", err)
+			case tc.wantErr != "" && (err == nil || !strings.Contains(err.Error(), tc.wantErr)):
+				t.Errorf("Expected error containing %q, got %v", tc.wantErr, err)
+			case tc.wantErr == "" && (sources["hooks"].Tenant != verify.DefaultTenant || sources["ses"].interval != 30*time.Minute):
+				t.Errorf("Expected defaults filled in, got %+v", sources)
+			}
+		})
+	}
+}
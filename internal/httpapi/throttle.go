@@ -0,0 +1,296 @@
+package httpapi
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"email-verifier/pkg/verify"
+)
+
+// throttleLimit caps the verifications under way at one destination
+// domain. Zero is unlimited.
+type throttleLimit struct {
+	Concurrent int // at once
+	PerMinute  int // started in any minute
+}
+
+func (l throttleLimit) unlimited() bool { return l.Concurrent <= 0 && l.PerMinute <= 0 }
+
+var throttleWait = metrics.HistogramVec("domain_throttle_wait_seconds", "Time bulk and job work waited on per-domain throttles, by limit: an overridden domain or default.", "limit")
+
+// domainThrottles holds bulk and job verifications that probe mail servers
+// to per-domain limits, so a list full of one provider's addresses doesn't
+// earn 421 slow-downs. Start sets the limits; there are none by default.
+var domainThrottles = newDomainThrottle(throttleLimit{}, nil)
+
+// domainSlots is what the throttle knows about one domain.
+type domainSlots struct {
+	active int
+	recent []time.Time // starts within the last minute
+}
+
+// domainThrottle tracks the verifications under way per domain.
+type domainThrottle struct {
+	limit     throttleLimit
+	overrides map[string]throttleLimit
+
+	mu      sync.Mutex
+	domains map[string]*domainSlots
+	changed chan struct{} // closed and replaced whenever a slot frees up
+	now     func() time.Time
+}
+
+func newDomainThrottle(limit throttleLimit, overrides map[string]throttleLimit) *domainThrottle {
+	return &domainThrottle{
+		limit:     limit,
+		overrides: overrides,
+		domains:   make(map[string]*domainSlots),
+		changed:   make(chan struct{}),
+		now:       time.Now,
+	}
+}
+
+// limitFor returns domain's limit and the label its waits are observed
+// under. Work queued under "" is never limited.
+func (t *domainThrottle) limitFor(domain string) (throttleLimit, string) {
+	if domain == "" {
+		return throttleLimit{}, ""
+	}
+	if limit, ok := t.overrides[domain]; ok {
+		return limit, domain
+	}
+	return t.limit, "default"
+}
+
+// Limits reports whether the throttle limits any domain.
+func (t *domainThrottle) Limits() bool {
+	if !t.limit.unlimited() {
+		return true
+	}
+	for _, limit := range t.overrides {
+		if !limit.unlimited() {
+			return true
+		}
+	}
+	return false
+}
+
+// tryAcquire takes one of domain's slots for a run of up to n
+// verifications and returns how many of them may start. When none may, it
+// also returns how long until the rate allows one, or zero if it is
+// waiting on a slot to be released.
+func (t *domainThrottle) tryAcquire(domain string, n int) (int, time.Duration) {
+	limit, _ := t.limitFor(domain)
+	if limit.unlimited() {
+		return n, 0
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	now := t.now()
+	slots := t.domains[domain]
+	if slots == nil {
+		slots = &domainSlots{}
+		t.domains[domain] = slots
+	}
+	slots.trim(now)
+	if limit.Concurrent > 0 && slots.active >= limit.Concurrent {
+		return 0, 0
+	}
+	if limit.PerMinute > 0 {
+		n = min(n, limit.PerMinute-len(slots.recent))
+		if n <= 0 {
+			return 0, slots.recent[0].Add(time.Minute).Sub(now)
+		}
+	}
+	slots.active++
+	for range n {
+		slots.recent = append(slots.recent, now)
+	}
+	return n, 0
+}
+
+// release gives back a slot tryAcquire took.
+func (t *domainThrottle) release(domain string) {
+	if limit, _ := t.limitFor(domain); limit.unlimited() {
+		return
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if slots := t.domains[domain]; slots != nil && slots.active > 0 {
+		slots.active--
+	}
+	close(t.changed)
+	t.changed = make(chan struct{})
+}
+
+// changes returns a channel closed the next time a slot is released.
+func (t *domainThrottle) changes() <-chan struct{} {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.changed
+}
+
+// Sweep drops domains with nothing under way and no starts in the last
+// minute, and returns how many.
+func (t *domainThrottle) Sweep(now time.Time) int {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	removed := 0
+	for domain, slots := range t.domains {
+		slots.trim(now)
+		if slots.active == 0 && len(slots.recent) == 0 {
+			delete(t.domains, domain)
+			removed++
+		}
+	}
+	return removed
+}
+
+// trim drops starts older than a minute.
+func (s *domainSlots) trim(now time.Time) {
+	n := sort.Search(len(s.recent), func(i int) bool { return now.Sub(s.recent[i]) < time.Minute })
+	s.recent = append(s.recent[:0], s.recent[n:]...)
+}
+
+// parseDomainLimits parses "domain=concurrent/per_minute,..." into
+// per-domain overrides. Either number may be 0 for unlimited.
+func parseDomainLimits(s string) (map[string]throttleLimit, error) {
+	limits := make(map[string]throttleLimit)
+	for _, part := range strings.Split(s, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		domain, value, ok := strings.Cut(part, "=")
+		concurrent, perMinute, ok2 := strings.Cut(value, "/")
+		if !ok || !ok2 {
+			return nil, fmt.Errorf("invalid domain limit %q, want domain=concurrent/per_minute", part)
+		}
+		var limit throttleLimit
+		var err error
+		if limit.Concurrent, err = strconv.Atoi(strings.TrimSpace(concurrent)); err != nil {
+			return nil, fmt.Errorf("invalid domain limit %q: %v", part, err)
+		}
+		if limit.PerMinute, err = strconv.Atoi(strings.TrimSpace(perMinute)); err != nil {
+			return nil, fmt.Errorf("invalid domain limit %q: %v", part, err)
+		}
+		limits[strings.ToLower(strings.TrimSpace(domain))] = limit
+	}
+	return limits, nil
+}
+
+// throttleDomain returns the domain email's verification is throttled
+// under, or "" for verifications that don't probe mail servers and, while
+// no domain is limited, for every one.
+func throttleDomain(email string, checks verify.CheckSet) string {
+	if !checks.Has(verify.CheckSMTP) || !domainThrottles.Limits() {
+		return ""
+	}
+	email, _ = verify.NormalizeInput(email)
+	at := strings.LastIndexByte(email, '@')
+	if at < 0 {
+		return ""
+	}
+	return strings.ToLower(strings.TrimRight(email[at+1:], "> "))
+}
+
+// throttleQueue hands out a pipeline's work a domain's run at a time.
+// Domains take turns, and those at their limits are passed over, so their
+// work waits without holding up the rest of the pool.
+type throttleQueue struct {
+	throttle *domainThrottle
+	batch    int // most items in a run
+
+	mu      sync.Mutex
+	domains []string // with work left, in turn order
+	turn    int
+	work    map[string][]int
+	held    map[string]time.Time // since a domain was first passed over
+}
+
+// newThrottleQueue queues items by the domain domainOf returns for each.
+func newThrottleQueue(throttle *domainThrottle, items []int, domainOf func(int) string, batch int) *throttleQueue {
+	q := &throttleQueue{throttle: throttle, batch: max(1, batch), work: make(map[string][]int), held: make(map[string]time.Time)}
+	for _, item := range items {
+		domain := domainOf(item)
+		if _, ok := q.work[domain]; !ok {
+			q.domains = append(q.domains, domain)
+		}
+		q.work[domain] = append(q.work[domain], item)
+	}
+	return q
+}
+
+// Next returns the next run of items, all at one domain, waiting while
+// every domain with work left is at its limits. It returns false once the
+// work is handed out or ctx ends. The caller releases the domain's slot
+// with Done once the run is verified.
+func (q *throttleQueue) Next(ctx context.Context) (string, []int, bool) {
+	for {
+		if ctx.Err() != nil {
+			return "", nil, false
+		}
+		changed := q.throttle.changes()
+		q.mu.Lock()
+		if len(q.domains) == 0 {
+			q.mu.Unlock()
+			return "", nil, false
+		}
+		soonest := time.Duration(0)
+		for i := range q.domains {
+			index := (q.turn + i) % len(q.domains)
+			domain := q.domains[index]
+			work := q.work[domain]
+			n, wait := q.throttle.tryAcquire(domain, min(len(work), q.batch))
+			if n == 0 {
+				if _, ok := q.held[domain]; !ok {
+					q.held[domain] = time.Now()
+				}
+				if wait > 0 && (soonest == 0 || wait < soonest) {
+					soonest = wait
+				}
+				continue
+			}
+			run := work[:n]
+			if len(work) == n {
+				delete(q.work, domain)
+				q.domains = append(q.domains[:index], q.domains[index+1:]...)
+				q.turn = index
+			} else {
+				q.work[domain] = work[n:]
+				q.turn = index + 1
+			}
+			if since, ok := q.held[domain]; ok {
+				delete(q.held, domain)
+				_, label := q.throttle.limitFor(domain)
+				throttleWait.Observe(label, time.Since(since))
+			}
+			q.mu.Unlock()
+			return domain, run, true
+		}
+		q.mu.Unlock()
+
+		var timer *time.Timer
+		var timeout <-chan time.Time
+		if soonest > 0 {
+			timer = time.NewTimer(soonest)
+			timeout = timer.C
+		}
+		select {
+		case <-changed:
+		case <-timeout:
+		case <-ctx.Done():
+		}
+		if timer != nil {
+			timer.Stop()
+		}
+	}
+}
+
+// Done releases the slot of a run Next returned.
+func (q *throttleQueue) Done(domain string) { q.throttle.release(domain) }
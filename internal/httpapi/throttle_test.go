@@ -0,0 +1,209 @@
+package httpapi
+
+import (
+	"context"
+	"encoding/json"
+	"net"
+	"net/http"
+	"sync"
+	"testing"
+	"time"
+
+	emailverifier "github.com/AfterShip/email-verifier"
+
+	"email-verifier/pkg/verify"
+	"email-verifier/pkg/verify/verifytest"
+)
+
+// useDomainThrottle replaces the per-domain throttle for the duration of a test
+func useDomainThrottle(t *testing.T, limit throttleLimit, overrides map[string]throttleLimit) *domainThrottle {
+	t.Helper()
+	saved := domainThrottles
+	domainThrottles = newDomainThrottle(limit, overrides)
+	t.Cleanup(func() { domainThrottles = saved })
+	return domainThrottles
+}
+
+// concurrencyProber answers every mailbox after a delay and records the most
+// probes of each domain it saw at once
+type concurrencyProber struct {
+	mu      sync.Mutex
+	delay   time.Duration
+	current map[string]int
+	peak    map[string]int
+}
+
+func newConcurrencyProber(delay time.Duration) *concurrencyProber {
+	return &concurrencyProber{delay: delay, current: make(map[string]int), peak: make(map[string]int)}
+}
+
+func (p *concurrencyProber) Probe(ctx context.Context, profile, domain, username string, catchAll bool) (*emailverifier.SMTP, error) {
+	p.mu.Lock()
+	p.current[domain]++
+	p.peak[domain] = max(p.peak[domain], p.current[domain])
+	p.mu.Unlock()
+	time.Sleep(p.delay)
+	p.mu.Lock()
+	p.current[domain]--
+	p.mu.Unlock()
+	return &emailverifier.SMTP{HostExists: true, Deliverable: username != ""}, nil
+}
+
+func (p *concurrencyProber) Peak(domain string) int {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.peak[domain]
+}
+
+// TestDomainThrottle tests the concurrency and per-minute limits, overrides and sweeping
+func TestDomainThrottle(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+	throttle := newDomainThrottle(throttleLimit{Concurrent: 2, PerMinute: 3}, map[string]throttleLimit{"partner.mock": {}})
+	throttle.now = func() time.Time { return now }
+
+	if n, _ := throttle.tryAcquire("yahoo.mock", 1); n != 1 {
+		t.Fatalf("Expected a slot, got %d", n)
+	}
+	if n, _ := throttle.tryAcquire("yahoo.mock", 5); n != 2 {
+		t.Fatalf("Expected a run cut to the rest of the minute's 3, got %d", n)
+	}
+	if n, wait := throttle.tryAcquire("yahoo.mock", 1); n != 0 || wait != 0 {
+		t.Errorf("Expected both slots taken, got %d and %v", n, wait)
+	}
+	throttle.release("yahoo.mock")
+	now = now.Add(20 * time.Second)
+	if n, wait := throttle.tryAcquire("yahoo.mock", 1); n != 0 || wait != 40*time.Second {
+		t.Errorf("Expected the minute's starts used up for 40s, got %d and %v", n, wait)
+	}
+	now = now.Add(40 * time.Second)
+	if n, _ := throttle.tryAcquire("yahoo.mock", 1); n != 1 {
+		t.Errorf("Expected a slot once the minute passed, got %d", n)
+	}
+	if n, _ := throttle.tryAcquire("partner.mock", 50); n != 50 {
+		t.Errorf("Expected an unlimited override to take the whole run, got %d", n)
+	}
+
+	throttle.release("yahoo.mock")
+	throttle.release("yahoo.mock")
+	if removed := throttle.Sweep(now.Add(time.Minute)); removed != 1 {
+		t.Errorf("Expected yahoo.mock swept, got %d", removed)
+	}
+}
+
+// TestParseDomainLimits tests the override syntax
+func TestParseDomainLimits(t *testing.T) {
+	limits, err := parseDomainLimits(" Yahoo.com=1/20, gmail.com=0/120 ,")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(limits) != 2 || limits["yahoo.com"] != (throttleLimit{1, 20}) || limits["gmail.com"] != (throttleLimit{0, 120}) {
+		t.Errorf("Expected two overrides, got %v", limits)
+	}
+	for _, bad := range []string{"yahoo.com", "yahoo.com=2", "yahoo.com=a/20", "yahoo.com=2/b"} {
+		if _, err := parseDomainLimits(bad); err == nil {
+			t.Errorf("Expected %q to be rejected", bad)
+		}
+	}
+}
+
+// TestThrottleQueue tests that a domain at its limit is passed over for others and resumes once a slot frees up
+func TestThrottleQueue(t *testing.T) {
+	throttle := newDomainThrottle(throttleLimit{}, map[string]throttleLimit{"yahoo.mock": {Concurrent: 1}})
+	domains := []string{"yahoo.mock", "yahoo.mock", "other.mock"}
+	queue := newThrottleQueue(throttle, []int{0, 1, 2}, func(i int) string { return domains[i] }, 1)
+	ctx := context.Background()
+	waits := throttleWait.Count("yahoo.mock")
+
+	if domain, items, _ := queue.Next(ctx); domain != "yahoo.mock" || items[0] != 0 {
+		t.Fatalf("Expected the first yahoo.mock address, got %s %v", domain, items)
+	}
+	if domain, items, _ := queue.Next(ctx); domain != "other.mock" || items[0] != 2 {
+		t.Fatalf("Expected other.mock while yahoo.mock is at its limit, got %s %v", domain, items)
+	}
+	next := make(chan int)
+	go func() {
+		_, items, _ := queue.Next(ctx)
+		next <- items[0]
+	}()
+	select {
+	case i := <-next:
+		t.Fatalf("Expected the second yahoo.mock address to wait, got %d", i)
+	case <-time.After(50 * time.Millisecond):
+	}
+	queue.Done("yahoo.mock")
+	if i := <-next; i != 1 {
+		t.Errorf("Expected the second yahoo.mock address once the slot freed up, got %d", i)
+	}
+	if _, _, ok := queue.Next(ctx); ok {
+		t.Error("Expected the queue to be empty")
+	}
+	if n := throttleWait.Count("yahoo.mock") - waits; n != 1 {
+		t.Errorf("Expected one wait observed for yahoo.mock, got %d", n)
+	}
+
+	cancelled, cancel := context.WithCancel(ctx)
+	cancel()
+	queue = newThrottleQueue(throttle, []int{0}, func(int) string { return "other.mock" }, 1)
+	if _, _, ok := queue.Next(cancelled); ok {
+		t.Error("Expected nothing handed out once the context ended")
+	}
+}
+
+// TestBulkDomainThrottle tests that a throttled domain's addresses are probed one at a time while other domains' run alongside
+func TestBulkDomainThrottle(t *testing.T) {
+	fake := verifytest.NewResolver()
+	var emails []string
+	for _, domain := range []string{"yahoo.mock", "a.mock", "b.mock", "c.mock"} {
+		fake.MX[domain] = []*net.MX{{Host: "mx." + domain + ".", Pref: 10}}
+		for _, user := range []string{"jane", "john", "joan"} {
+			emails = append(emails, user+"@"+domain)
+		}
+	}
+	prober := newConcurrencyProber(30 * time.Millisecond)
+	useService(t, verify.Config{Resolver: fake, Prober: prober.Probe, CatchAllDisabled: true})
+	useDomainThrottle(t, throttleLimit{}, map[string]throttleLimit{"yahoo.mock": {Concurrent: 1}})
+
+	body, _ := json.Marshal(map[string]any{"emails": emails, "checks": "smtp"})
+	start := time.Now()
+	if rec := postBulk(string(body)); rec.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d", rec.Code)
+	}
+	if peak := prober.Peak("yahoo.mock"); peak != 1 {
+		t.Errorf("Expected yahoo.mock probed one at a time, got %d at once", peak)
+	}
+	if elapsed := time.Since(start); elapsed >= 6*prober.delay {
+		t.Errorf("Expected the other domains to run alongside yahoo.mock, took %v", elapsed)
+	}
+}
+
+// TestJobDomainThrottle tests that a job verifies a throttled domain a chunk at a time and still publishes in paste order
+func TestJobDomainThrottle(t *testing.T) {
+	registry := useJobs(t, 5)
+	fake := verifytest.NewResolver()
+	var emails []string
+	for i := range 12 {
+		domain := []string{"yahoo.mock", "a.mock", "b.mock"}[i%3]
+		fake.MX[domain] = []*net.MX{{Host: "mx." + domain + ".", Pref: 10}}
+		emails = append(emails, []string{"jane", "john", "joan", "jill"}[i/3]+"@"+domain)
+	}
+	prober := newConcurrencyProber(10 * time.Millisecond)
+	useService(t, verify.Config{Resolver: fake, Prober: prober.Probe})
+	useDomainThrottle(t, throttleLimit{Concurrent: 1}, nil)
+
+	id := registry.Start(emails, verify.Options{Checks: verify.MustParseChecks(verify.CheckSMTP)})
+	registry.Wait()
+	view, _ := registry.Get(id, pageRequest{limit: maxPageLimit})
+	if view.Status != jobDone || view.Completed != len(emails) {
+		t.Fatalf("Expected a finished job, got %s %d/%d", view.Status, view.Completed, view.Total)
+	}
+	for i, result := range view.Results {
+		if result.Email != emails[i] {
+			t.Fatalf("Expected %s at %d, got %s", emails[i], i, result.Email)
+		}
+	}
+	for _, domain := range []string{"yahoo.mock", "a.mock", "b.mock"} {
+		if peak := prober.Peak(domain); peak != 1 {
+			t.Errorf("Expected %s probed one at a time, got %d at once", domain, peak)
+		}
+	}
+}
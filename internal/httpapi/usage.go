@@ -0,0 +1,207 @@
+package httpapi
+
+import (
+	"encoding/json"
+	"net/http"
+	"slices"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Usage periods. Totals are kept per UTC day and summed into months on read.
+const (
+	usageDay   = "day"
+	usageMonth = "month"
+)
+
+// usageTotals is one key's metered usage over a period.
+type usageTotals struct {
+	Period        string `json:"period"` // 2006-01-02 or 2006-01
+	Verifications int    `json:"verifications"`
+	CostUnits     int    `json:"cost_units"`
+
+	start time.Time
+}
+
+// keyUsage is a key's totals per period, for the admin listing.
+type keyUsage struct {
+	Key    string        `json:"key"`
+	Tenant string        `json:"tenant"`
+	Totals []usageTotals `json:"totals"`
+}
+
+// usageMeter accumulates verifications and cost units per API key, so
+// infrastructure cost can be charged back to the teams that consume it.
+type usageMeter struct {
+	mu   sync.Mutex
+	days map[string]map[time.Time]*usageTotals // key, then UTC midnight
+	now  func() time.Time
+}
+
+var usage = newUsageMeter()
+
+func newUsageMeter() *usageMeter {
+	return &usageMeter{days: make(map[string]map[time.Time]*usageTotals), now: time.Now}
+}
+
+// Record adds one verification costing units to key's usage today.
+func (m *usageMeter) Record(key string, units int) {
+	now := m.now().UTC()
+	day := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.UTC)
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	days := m.days[key]
+	if days == nil {
+		days = make(map[time.Time]*usageTotals)
+		m.days[key] = days
+	}
+	totals := days[day]
+	if totals == nil {
+		totals = &usageTotals{Period: day.Format(time.DateOnly), start: day}
+		days[day] = totals
+	}
+	totals.Verifications++
+	totals.CostUnits += units
+}
+
+// Totals returns key's usage per day or per month, oldest first.
+func (m *usageMeter) Totals(key, period string) []usageTotals {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return sumUsage(m.days[key], period)
+}
+
+// Keys returns every metered key, ordered by key.
+func (m *usageMeter) Keys() []string {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	keys := make([]string, 0, len(m.days))
+	for key := range m.days {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// Sweep drops days that ended more than ttl ago.
+func (m *usageMeter) Sweep(now time.Time, ttl time.Duration) int {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	evicted := 0
+	for key, days := range m.days {
+		for day := range days {
+			if now.Sub(day.AddDate(0, 0, 1)) > ttl {
+				delete(days, day)
+				evicted++
+			}
+		}
+		if len(days) == 0 {
+			delete(m.days, key)
+		}
+	}
+	return evicted
+}
+
+// sumUsage groups daily totals into the requested period, oldest first.
+func sumUsage(days map[time.Time]*usageTotals, period string) []usageTotals {
+	byStart := make(map[time.Time]*usageTotals)
+	for day, totals := range days {
+		start, label := day, totals.Period
+		if period == usageMonth {
+			start = time.Date(day.Year(), day.Month(), 1, 0, 0, 0, 0, time.UTC)
+			label = start.Format("2006-01")
+		}
+		sum := byStart[start]
+		if sum == nil {
+			sum = &usageTotals{Period: label, start: start}
+			byStart[start] = sum
+		}
+		sum.Verifications += totals.Verifications
+		sum.CostUnits += totals.CostUnits
+	}
+
+	list := make([]usageTotals, 0, len(byStart))
+	for _, totals := range byStart {
+		list = append(list, *totals)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].start.Before(list[j].start) })
+	return list
+}
+
+// usagePeriod reads the period parameter, day by default.
+func usagePeriod(r *http.Request) (string, bool) {
+	switch period := r.URL.Query().Get("period"); period {
+	case "", usageDay:
+		return usageDay, true
+	case usageMonth:
+		return usageMonth, true
+	}
+	return "", false
+}
+
+// usageHandler reports the calling key's own usage.
+func usageHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	period, ok := usagePeriod(r)
+	if !ok {
+		http.Error(w, "period must be day or month", http.StatusBadRequest)
+		return
+	}
+	page, err := parsePageRequest(r.URL.Query())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	totals := usage.Totals(requestKey(r), period)
+	start, end, next := page.window(len(totals), func(i int) pageCursor {
+		return pageCursor{Key: totals[i].start.Unix()}
+	})
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"period":      period,
+		"usage":       totals[start:end],
+		"next_cursor": next,
+	})
+}
+
+// adminUsageHandler lists every key's usage, or with ?tenant= only the
+// keys of that tenant.
+func adminUsageHandler(w http.ResponseWriter, r *http.Request) {
+	period, ok := usagePeriod(r)
+	if !ok {
+		http.Error(w, "period must be day or month", http.StatusBadRequest)
+		return
+	}
+	page, err := parsePageRequest(r.URL.Query())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	keys := usage.Keys()
+	if tenant := r.URL.Query().Get("tenant"); tenant != "" {
+		keys = slices.DeleteFunc(keys, func(key string) bool { return service.TenantFor(key) != tenant })
+	}
+	start, end, next := page.window(len(keys), func(i int) pageCursor {
+		return pageCursor{ID: keys[i]}
+	})
+	list := make([]keyUsage, 0, end-start)
+	for _, key := range keys[start:end] {
+		list = append(list, keyUsage{Key: key, Tenant: service.TenantFor(key), Totals: usage.Totals(key, period)})
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"period":      period,
+		"usage":       list,
+		"next_cursor": next,
+	})
+}
@@ -0,0 +1,118 @@
+package httpapi
+
+import (
+	"bytes"
+	"encoding/json"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"email-verifier/pkg/verify"
+	"email-verifier/pkg/verify/verifytest"
+)
+
+// useUsage replaces the usage meter for the duration of a test, with a clock the test can move
+func useUsage(t *testing.T, at *time.Time) *usageMeter {
+	t.Helper()
+	saved := usage
+	usage = newUsageMeter()
+	usage.now = func() time.Time { return *at }
+	t.Cleanup(func() { usage = saved })
+	return usage
+}
+
+// TestUsageMeter tests daily and monthly totals and sweeping old days
+func TestUsageMeter(t *testing.T) {
+	now := time.Date(2024, 2, 28, 12, 0, 0, 0, time.UTC)
+	meter := useUsage(t, &now)
+
+	meter.Record("team", 1)
+	meter.Record("team", 6)
+	now = now.Add(24 * time.Hour)
+	meter.Record("team", 5)
+	now = now.Add(48 * time.Hour)
+	meter.Record("team", 1)
+	meter.Record("other", 6)
+
+	days := meter.Totals("team", usageDay)
+	if len(days) != 3 || days[0].Period != "2024-02-28" || days[0].Verifications != 2 || days[0].CostUnits != 7 {
+		t.Fatalf("Expected 3 days starting with 2 verifications and 7 units on 2024-02-28, got %+v", days)
+	}
+	months := meter.Totals("team", usageMonth)
+	if len(months) != 2 || months[0].Period != "2024-02" || months[0].CostUnits != 12 || months[1].Period != "2024-03" || months[1].CostUnits != 1 {
+		t.Errorf("Expected 12 units in 2024-02 and 1 in 2024-03, got %+v", months)
+	}
+
+	if n := meter.Sweep(now, 24*time.Hour); n != 2 {
+		t.Errorf("Expected 2 days swept, got %d", n)
+	}
+	if days := meter.Totals("team", usageDay); len(days) != 1 || days[0].Period != "2024-03-02" {
+		t.Errorf("Expected only 2024-03-02 to remain, got %+v", days)
+	}
+}
+
+// TestUsageHandlers tests that API verifications are metered and reported to their key and the admin listing
+func TestUsageHandlers(t *testing.T) {
+	fake := verifytest.NewResolver()
+	fake.MX["partner.com"] = []*net.MX{{Host: "mx.partner.com.", Pref: 10}}
+	useService(t, verify.Config{Resolver: fake, Tenants: map[string]verify.Tenant{"unit": {Keys: []string{"team"}}}})
+	now := time.Date(2024, 3, 3, 12, 0, 0, 0, time.UTC)
+	useUsage(t, &now)
+
+	for _, key := range []string{"team", "team", "other"} {
+		body, _ := json.Marshal(map[string]string{"email": "jane@partner.com"})
+		req := httptest.NewRequest(http.MethodPost, "/api/verify", bytes.NewReader(body))
+		req.Header.Set("X-API-Key", key)
+		rec := httptest.NewRecorder()
+		apiVerifyHandler(rec, req)
+		var result verify.Result
+		json.Unmarshal(rec.Body.Bytes(), &result)
+		if result.CostUnits != 1 {
+			t.Fatalf("Expected the default checks to cost 1 unit, got %d", result.CostUnits)
+		}
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/api/usage?period=month", nil)
+	req.Header.Set("X-API-Key", "team")
+	rec := httptest.NewRecorder()
+	usageHandler(rec, req)
+	var own struct {
+		Usage []usageTotals `json:"usage"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &own); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	if len(own.Usage) != 1 || own.Usage[0].Period != "2024-03" || own.Usage[0].Verifications != 2 || own.Usage[0].CostUnits != 2 {
+		t.Errorf("Expected 2 verifications and 2 units for team in 2024-03, got %+v", own.Usage)
+	}
+
+	rec = httptest.NewRecorder()
+	adminUsageHandler(rec, httptest.NewRequest(http.MethodGet, "/admin/usage", nil))
+	var all struct {
+		Usage []keyUsage `json:"usage"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &all); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	if len(all.Usage) != 2 || all.Usage[0].Key != "other" || all.Usage[1].Key != "team" {
+		t.Errorf("Expected other and team in key order, got %+v", all.Usage)
+	}
+	if all.Usage[0].Tenant != verify.DefaultTenant || all.Usage[1].Tenant != "unit" {
+		t.Errorf("Expected other in the default tenant and team in unit, got %+v", all.Usage)
+	}
+
+	rec = httptest.NewRecorder()
+	adminUsageHandler(rec, httptest.NewRequest(http.MethodGet, "/admin/usage?tenant=unit", nil))
+	json.Unmarshal(rec.Body.Bytes(), &all)
+	if len(all.Usage) != 1 || all.Usage[0].Key != "team" {
+		t.Errorf("Expected only team for tenant unit, got %+v", all.Usage)
+	}
+
+	rec = httptest.NewRecorder()
+	usageHandler(rec, httptest.NewRequest(http.MethodGet, "/api/usage?period=week", nil))
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("Expected status 400 for an unknown period, got %d", rec.Code)
+	}
+}
@@ -0,0 +1,401 @@
+package httpapi
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"math/big"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"email-verifier/pkg/verify"
+)
+
+// maxWatchChanges bounds the change history kept per watch.
+const maxWatchChanges = 20
+
+var (
+	errWatchLimit    = errors.New("watch limit reached for this API key")
+	errWatchInterval = errors.New("interval is below the minimum")
+	errWatchDomain   = errors.New("invalid domain")
+)
+
+// watchRecords are the mail-related DNS records tracked for a domain.
+type watchRecords struct {
+	MX  []string `json:"mx"`
+	SPF string   `json:"spf,omitempty"`
+}
+
+// watchChange records how a domain's records differed between two checks.
+type watchChange struct {
+	DetectedAt time.Time `json:"detected_at"`
+	MXAdded    []string  `json:"mx_added,omitempty"`
+	MXRemoved  []string  `json:"mx_removed,omitempty"`
+	SPFBefore  string    `json:"spf_before,omitempty"`
+	SPFAfter   string    `json:"spf_after,omitempty"`
+}
+
+// domainWatch is a domain whose mail records are re-checked periodically.
+type domainWatch struct {
+	ID          string        `json:"id"`
+	Domain      string        `json:"domain"`
+	Interval    string        `json:"interval"`
+	CreatedAt   time.Time     `json:"created_at"`
+	LastChecked *time.Time    `json:"last_checked,omitempty"`
+	NextCheck   time.Time     `json:"next_check"`
+	LastSeen    *watchRecords `json:"last_seen,omitempty"`
+	LastError   string        `json:"last_error,omitempty"`
+	Changes     []watchChange `json:"changes,omitempty"`
+
+	owner    string
+	interval time.Duration
+}
+
+// watchRegistry owns all domain watches and runs their checks.
+type watchRegistry struct {
+	mu      sync.Mutex
+	watches map[string]*domainWatch
+
+	notifier    notifier
+	maxPerOwner int
+	minInterval time.Duration
+	now         func() time.Time
+}
+
+var watches = newWatchRegistry(nil, 50, 5*time.Minute)
+
+func newWatchRegistry(n notifier, maxPerOwner int, minInterval time.Duration) *watchRegistry {
+	return &watchRegistry{
+		watches:     make(map[string]*domainWatch),
+		notifier:    n,
+		maxPerOwner: maxPerOwner,
+		minInterval: minInterval,
+		now:         time.Now,
+	}
+}
+
+// Add registers a watch for domain. The first check is scheduled at a random
+// point within the interval so that watches created together don't fire
+// together.
+func (wr *watchRegistry) Add(owner, domain string, interval time.Duration) (*domainWatch, error) {
+	domain = strings.TrimSuffix(strings.ToLower(strings.TrimSpace(domain)), ".")
+	if domain == "" || !strings.Contains(domain, ".") || strings.ContainsAny(domain, "@/ ") {
+		return nil, errWatchDomain
+	}
+	// Re-querying faster than typical MX TTLs would only see cached answers.
+	if interval < wr.minInterval {
+		return nil, errWatchInterval
+	}
+
+	wr.mu.Lock()
+	defer wr.mu.Unlock()
+
+	count := 0
+	for _, w := range wr.watches {
+		if w.owner == owner {
+			count++
+		}
+	}
+	if wr.maxPerOwner > 0 && count >= wr.maxPerOwner {
+		return nil, errWatchLimit
+	}
+
+	now := wr.now()
+	w := &domainWatch{
+		ID:        newWatchID(),
+		Domain:    domain,
+		Interval:  interval.String(),
+		CreatedAt: now,
+		NextCheck: now.Add(jitter(interval)),
+		owner:     owner,
+		interval:  interval,
+	}
+	wr.watches[w.ID] = w
+
+	copied := *w
+	return &copied, nil
+}
+
+// List returns the owner's watches ordered by creation time, then ID. The
+// wall-clock time is compared, as it is in page cursors.
+func (wr *watchRegistry) List(owner string) []domainWatch {
+	wr.mu.Lock()
+	defer wr.mu.Unlock()
+
+	list := make([]domainWatch, 0)
+	for _, w := range wr.watches {
+		if w.owner == owner {
+			list = append(list, *w)
+		}
+	}
+	sort.Slice(list, func(i, j int) bool {
+		ti, tj := list[i].CreatedAt.UnixNano(), list[j].CreatedAt.UnixNano()
+		if ti == tj {
+			return list[i].ID < list[j].ID
+		}
+		return ti < tj
+	})
+	return list
+}
+
+// Len returns the number of registered watches.
+func (wr *watchRegistry) Len() int {
+	wr.mu.Lock()
+	defer wr.mu.Unlock()
+	return len(wr.watches)
+}
+
+// Sweep drops recorded changes older than ttl.
+func (wr *watchRegistry) Sweep(now time.Time, ttl time.Duration) int {
+	wr.mu.Lock()
+	defer wr.mu.Unlock()
+
+	evicted := 0
+	for _, w := range wr.watches {
+		n := 0
+		for n < len(w.Changes) && now.Sub(w.Changes[n].DetectedAt) > ttl {
+			n++
+		}
+		if n > 0 {
+			w.Changes = w.Changes[n:]
+			evicted += n
+		}
+	}
+	return evicted
+}
+
+// ChangeCount returns the number of recorded changes across all watches.
+func (wr *watchRegistry) ChangeCount() int {
+	wr.mu.Lock()
+	defer wr.mu.Unlock()
+	n := 0
+	for _, w := range wr.watches {
+		n += len(w.Changes)
+	}
+	return n
+}
+
+// checkDue re-checks every watch whose next check time has passed.
+func (wr *watchRegistry) checkDue(ctx context.Context) {
+	if service.NetworkDisabled() {
+		// Due watches are checked once the network is back
+		return
+	}
+	now := wr.now()
+
+	wr.mu.Lock()
+	var due []*domainWatch
+	for _, w := range wr.watches {
+		if !now.Before(w.NextCheck) {
+			due = append(due, w)
+		}
+	}
+	wr.mu.Unlock()
+
+	for _, w := range due {
+		wr.check(ctx, w)
+	}
+}
+
+func (wr *watchRegistry) check(ctx context.Context, w *domainWatch) {
+	watchChecksInFlight.Inc()
+	defer watchChecksInFlight.Dec()
+
+	records, err := lookupWatchRecords(ctx, w.Domain)
+
+	wr.mu.Lock()
+	now := wr.now()
+	w.LastChecked = &now
+	w.NextCheck = now.Add(w.interval - w.interval/10 + jitter(w.interval/5))
+	if err != nil {
+		w.LastError = verify.ErrorMessage(verify.ErrorCodeFor(err))
+		wr.mu.Unlock()
+		return
+	}
+	w.LastError = ""
+
+	var change *watchChange
+	if w.LastSeen != nil {
+		change = diffWatchRecords(*w.LastSeen, records)
+	}
+	w.LastSeen = &records
+	if change != nil {
+		change.DetectedAt = now
+		w.Changes = append(w.Changes, *change)
+		if len(w.Changes) > maxWatchChanges {
+			w.Changes = w.Changes[len(w.Changes)-maxWatchChanges:]
+		}
+	}
+	domain := w.Domain
+	wr.mu.Unlock()
+
+	if change != nil {
+		wr.announce(ctx, domain, *change)
+	}
+}
+
+func (wr *watchRegistry) announce(ctx context.Context, domain string, change watchChange) {
+	log.Printf("watch: mail records changed for %s (mx added %v, removed %v)", domain, change.MXAdded, change.MXRemoved)
+	if wr.notifier == nil {
+		return
+	}
+
+	text := fmt.Sprintf("MX added: %s\nMX removed: %s", listOrNone(change.MXAdded), listOrNone(change.MXRemoved))
+	if change.SPFBefore != change.SPFAfter {
+		text += fmt.Sprintf("\nSPF: %q -> %q", change.SPFBefore, change.SPFAfter)
+	}
+	err := wr.notifier.Notify(ctx, notification{
+		Event:   "watch.changed",
+		Subject: "Mail records changed for " + domain,
+		Text:    text,
+		Data:    map[string]interface{}{"domain": domain, "change": change},
+	})
+	if err != nil {
+		log.Printf("watch: notification for %s failed: %v", domain, err)
+	}
+}
+
+// lookupWatchRecords fetches the current MX hosts and SPF record. A domain
+// that does not exist is reported as having no records rather than an error.
+func lookupWatchRecords(ctx context.Context, domain string) (watchRecords, error) {
+	records := watchRecords{MX: []string{}}
+
+	mx, err := service.Resolver().LookupMX(ctx, domain)
+	if err != nil && !verify.IsNotFound(err) {
+		return records, err
+	}
+	for _, r := range mx {
+		records.MX = append(records.MX, strings.ToLower(strings.TrimSuffix(r.Host, ".")))
+	}
+	sort.Strings(records.MX)
+
+	spf, err := verify.LookupSPF(ctx, service.Resolver(), domain)
+	if err != nil && !verify.IsNotFound(err) {
+		return records, err
+	}
+	records.SPF = spf
+	return records, nil
+}
+
+// diffWatchRecords returns the change between two snapshots, or nil if equal.
+func diffWatchRecords(before, after watchRecords) *watchChange {
+	change := &watchChange{}
+	seen := make(map[string]bool, len(before.MX))
+	for _, host := range before.MX {
+		seen[host] = true
+	}
+	for _, host := range after.MX {
+		if !seen[host] {
+			change.MXAdded = append(change.MXAdded, host)
+		}
+		delete(seen, host)
+	}
+	for _, host := range before.MX {
+		if seen[host] {
+			change.MXRemoved = append(change.MXRemoved, host)
+		}
+	}
+	if before.SPF != after.SPF {
+		change.SPFBefore = before.SPF
+		change.SPFAfter = after.SPF
+	}
+	if len(change.MXAdded) == 0 && len(change.MXRemoved) == 0 && before.SPF == after.SPF {
+		return nil
+	}
+	return change
+}
+
+func listOrNone(items []string) string {
+	if len(items) == 0 {
+		return "none"
+	}
+	return strings.Join(items, ", ")
+}
+
+// jitter returns a random duration in [0, d).
+func jitter(d time.Duration) time.Duration {
+	if d <= 0 {
+		return 0
+	}
+	n, err := rand.Int(rand.Reader, big.NewInt(int64(d)))
+	if err != nil {
+		return 0
+	}
+	return time.Duration(n.Int64())
+}
+
+func newWatchID() string {
+	b := make([]byte, 8)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+func watchesHandler(w http.ResponseWriter, r *http.Request) {
+	owner := requestKey(r)
+
+	switch r.Method {
+	case http.MethodGet:
+		page, err := parsePageRequest(r.URL.Query())
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		list := watches.List(owner)
+		start, end, next := page.window(len(list), func(i int) pageCursor {
+			return pageCursor{Key: list[i].CreatedAt.UnixNano(), ID: list[i].ID}
+		})
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"watches":     list[start:end],
+			"next_cursor": next,
+		})
+
+	case http.MethodPost:
+		var request struct {
+			Domain   string `json:"domain"`
+			Interval string `json:"interval"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+			http.Error(w, "Invalid JSON", http.StatusBadRequest)
+			return
+		}
+
+		interval := time.Hour
+		if request.Interval != "" {
+			parsed, err := time.ParseDuration(request.Interval)
+			if err != nil {
+				http.Error(w, "Invalid interval", http.StatusBadRequest)
+				return
+			}
+			interval = parsed
+		}
+
+		watch, err := watches.Add(owner, request.Domain, interval)
+		switch {
+		case errors.Is(err, errWatchLimit):
+			http.Error(w, "Watch limit reached", http.StatusTooManyRequests)
+			return
+		case errors.Is(err, errWatchInterval):
+			http.Error(w, fmt.Sprintf("Interval must be at least %s", watches.minInterval), http.StatusBadRequest)
+			return
+		case err != nil:
+			http.Error(w, "Invalid domain", http.StatusBadRequest)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusCreated)
+		json.NewEncoder(w).Encode(watch)
+
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
@@ -0,0 +1,138 @@
+package httpapi
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"email-verifier/pkg/verify"
+	"email-verifier/pkg/verify/verifytest"
+)
+
+// recordingNotifier collects notifications instead of sending them
+type recordingNotifier struct {
+	mu     sync.Mutex
+	events []notification
+}
+
+func (n *recordingNotifier) Notify(ctx context.Context, event notification) error {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	n.events = append(n.events, event)
+	return nil
+}
+
+// TestWatchDetectsChanges tests that MX and SPF changes are recorded and announced
+func TestWatchDetectsChanges(t *testing.T) {
+	fake := verifytest.NewResolver()
+	fake.MX["partner.com"] = []*net.MX{{Host: "mx1.partner.com.", Pref: 10}}
+	fake.TXT["partner.com"] = []string{"v=spf1 -all"}
+	useService(t, verify.Config{Resolver: fake})
+
+	now := time.Unix(1700000000, 0)
+	events := &recordingNotifier{}
+	registry := newWatchRegistry(events, 10, time.Minute)
+	registry.now = func() time.Time { return now }
+
+	watch, err := registry.Add("team", "Partner.com", time.Hour)
+	if err != nil {
+		t.Fatalf("Failed to add watch: %v", err)
+	}
+	if watch.NextCheck.Before(now) || !watch.NextCheck.Before(now.Add(time.Hour)) {
+		t.Errorf("Expected first check within the interval, got %v", watch.NextCheck)
+	}
+
+	now = now.Add(time.Hour)
+	registry.checkDue(context.Background())
+	if len(events.events) != 0 {
+		t.Fatalf("Expected no notification on first check, got %d", len(events.events))
+	}
+
+	fake.MX["partner.com"] = []*net.MX{{Host: "mx.attacker.net.", Pref: 10}}
+	fake.TXT["partner.com"] = []string{"v=spf1 include:attacker.net -all"}
+	now = now.Add(2 * time.Hour)
+	registry.checkDue(context.Background())
+
+	list := registry.List("team")
+	if len(list) != 1 || len(list[0].Changes) != 1 {
+		t.Fatalf("Expected one recorded change, got %+v", list)
+	}
+	change := list[0].Changes[0]
+	if len(change.MXAdded) != 1 || change.MXAdded[0] != "mx.attacker.net" {
+		t.Errorf("Expected mx.attacker.net added, got %v", change.MXAdded)
+	}
+	if len(change.MXRemoved) != 1 || change.MXRemoved[0] != "mx1.partner.com" {
+		t.Errorf("Expected mx1.partner.com removed, got %v", change.MXRemoved)
+	}
+	if change.SPFAfter != "v=spf1 include:attacker.net -all" {
+		t.Errorf("Expected new SPF recorded, got %q", change.SPFAfter)
+	}
+	if len(events.events) != 1 || events.events[0].Event != "watch.changed" {
+		t.Errorf("Expected one watch.changed notification, got %+v", events.events)
+	}
+}
+
+// TestWatchLimits tests the per-key cap and the minimum interval
+func TestWatchLimits(t *testing.T) {
+	registry := newWatchRegistry(nil, 2, 5*time.Minute)
+
+	if _, err := registry.Add("a", "one.com", time.Minute); !errors.Is(err, errWatchInterval) {
+		t.Errorf("Expected interval error, got %v", err)
+	}
+	if _, err := registry.Add("a", "not a domain", time.Hour); !errors.Is(err, errWatchDomain) {
+		t.Errorf("Expected domain error, got %v", err)
+	}
+
+	for _, domain := range []string{"one.com", "two.com"} {
+		if _, err := registry.Add("a", domain, time.Hour); err != nil {
+			t.Fatalf("Failed to add %s: %v", domain, err)
+		}
+	}
+	if _, err := registry.Add("a", "three.com", time.Hour); !errors.Is(err, errWatchLimit) {
+		t.Errorf("Expected limit error, got %v", err)
+	}
+	if _, err := registry.Add("b", "three.com", time.Hour); err != nil {
+		t.Errorf("Expected other key to have its own cap, got %v", err)
+	}
+	if got := len(registry.List("a")); got != 2 {
+		t.Errorf("Expected 2 watches for key a, got %d", got)
+	}
+}
+
+// TestWatchesHandler tests creating and listing watches over HTTP
+func TestWatchesHandler(t *testing.T) {
+	original := watches
+	watches = newWatchRegistry(nil, 10, 5*time.Minute)
+	defer func() { watches = original }()
+
+	body, _ := json.Marshal(map[string]string{"domain": "partner.com", "interval": "30m"})
+	req := httptest.NewRequest(http.MethodPost, "/api/watches", bytes.NewReader(body))
+	req.Header.Set("X-API-Key", "team")
+	rec := httptest.NewRecorder()
+	watchesHandler(rec, req)
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("Expected status 201, got %d: %s", rec.Code, rec.Body.String())
+	}
+
+	req = httptest.NewRequest(http.MethodGet, "/api/watches", nil)
+	req.Header.Set("X-API-Key", "team")
+	rec = httptest.NewRecorder()
+	watchesHandler(rec, req)
+
+	var response struct {
+		Watches []domainWatch `json:"watches"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &response); err != nil {
+		t.Fatalf("Failed to parse JSON response: %v", err)
+	}
+	if len(response.Watches) != 1 || response.Watches[0].Domain != "partner.com" {
+		t.Errorf("Expected partner.com watch, got %+v", response.Watches)
+	}
+}
@@ -0,0 +1,196 @@
+package verify
+
+import (
+	"context"
+
+	emailverifier "github.com/AfterShip/email-verifier"
+)
+
+// domainFacts are the parts of a verification that depend only on the
+// domain.
+type domainFacts struct {
+	Free       bool
+	Disposable bool
+	Suggestion string
+	Status     string
+	MX         []MXRecord
+	StatusErr  error
+	DNS        *DNSRecords // with CheckAuthRecords
+
+	// Set once the domain's catch-all status has been probed
+	catchAllProbed     bool
+	CatchAll           bool
+	CatchAllConfidence string
+	CatchAllErr        error
+	// catchAllCached is set when the status came from the domain cache
+	catchAllCached bool
+
+	// Set once an address in a batch has been charged for the lookups
+	billed bool
+	// cached are the checks answered from the domain cache
+	cached map[string]bool
+}
+
+// fromCache records that check was answered from the domain cache.
+func (f *domainFacts) fromCache(check string) {
+	if f.cached == nil {
+		f.cached = make(map[string]bool)
+	}
+	f.cached[check] = true
+}
+
+// reused returns the checks whose work the domain cache or an earlier
+// address at the domain already paid for. The mailbox probe is repeated
+// per address unless the domain turned out to be catch-all.
+func (f *domainFacts) reused() map[string]bool {
+	if f == nil || !f.billed {
+		if f == nil || f.cached == nil {
+			return nil
+		}
+		return f.cached
+	}
+	reused := map[string]bool{CheckFree: true, CheckDisposable: true, CheckSuggest: true, CheckMX: true}
+	for _, check := range dnsChecks {
+		reused[check] = true
+	}
+	if f.catchAllProbed && (f.CatchAll || f.CatchAllErr != nil) {
+		reused[CheckSMTP] = true
+	}
+	return reused
+}
+
+// lookupDomainFacts resolves the list, suggestion and DNS facts the checks
+// ask for, with tenant's lists on top of the server-wide ones. Disposable
+// domains stop there, as in a single verification.
+func (s *Service) lookupDomainFacts(ctx context.Context, verifier *emailverifier.Verifier, domain string, checks CheckSet, tenant *tenantPolicy) *domainFacts {
+	facts := &domainFacts{}
+	if checks.Has(CheckFree) {
+		facts.Free = s.isFree(verifier, domain)
+	}
+	if checks.Has(CheckDisposable) {
+		facts.Disposable = s.isDisposable(verifier, domain, tenant)
+	}
+	if facts.Disposable {
+		return facts
+	}
+	if checks.Has(CheckSuggest) {
+		facts.Suggestion = verifier.SuggestDomain(domain)
+	}
+	if checks.Has(CheckMX) {
+		s.domainStatus(ctx, s.resolver, domain, facts)
+		s.dnsRecords(ctx, s.resolver, domain, checks, facts)
+	}
+	return facts
+}
+
+// BatchSummary reports how much work grouping by domain saved.
+type BatchSummary struct {
+	Addresses       int `json:"addresses"`
+	Domains         int `json:"domains"`
+	DNSLookups      int `json:"dns_lookups"`
+	CatchAllProbes  int `json:"catch_all_probes"`
+	CatchAllDomains int `json:"catch_all_domains"`
+	MailboxProbes   int `json:"mailbox_probes"`
+	SkippedProbes   int `json:"skipped_probes"`
+	CostUnits       int `json:"cost_units"`
+}
+
+// VerifyBatch verifies emails, grouping them by domain first: DNS, list
+// lookups and the catch-all probe run once per domain, then only the
+// per-address RCPT checks remain. Addresses at catch-all domains are not
+// probed individually since the server would accept them all. Results are
+// returned in input order.
+func (s *Service) VerifyBatch(emails []string, opts Options) ([]*Result, BatchSummary) {
+	summary := BatchSummary{Addresses: len(emails)}
+	results := make([]*Result, len(emails))
+	opts.Checks = s.allowedChecks(opts.Checks)
+
+	// With the network disabled there are no lookups to share
+	verifier, err := s.verifiers.Get()
+	if err != nil || s.NetworkDisabled() {
+		for i, email := range emails {
+			results[i] = s.Verify(email, opts)
+		}
+		return results, summary
+	}
+
+	// Group valid addresses by domain; everything else is verified as-is
+	byDomain := make(map[string][]int)
+	var domains []string
+	for i, email := range emails {
+		normalized, _ := NormalizeInput(email)
+		if address, _, count := splitDisplayName(normalized); count == 1 {
+			normalized = address
+		}
+		if legacy, ok := parseLegacyAddress(normalized); ok {
+			if s.legacyAddresses == LegacyReject || legacy.Mailbox == "" {
+				results[i] = s.Verify(email, opts)
+				continue
+			}
+			normalized = legacy.Mailbox
+		}
+		syntax := parseAddress(verifier, normalized)
+		if !syntax.Valid {
+			results[i] = s.Verify(email, opts)
+			continue
+		}
+		domain := syntax.Domain
+		if _, ok := byDomain[domain]; !ok {
+			domains = append(domains, domain)
+		}
+		byDomain[domain] = append(byDomain[domain], i)
+	}
+	summary.Domains = len(domains)
+
+	tenant := s.keyTenants[opts.Key]
+	for _, domain := range domains {
+		if s.isSuppressed(tenant, "", domain) || s.blockedDomains.match(domain) {
+			// Suppressed and blocked addresses need no lookups
+			for _, i := range byDomain[domain] {
+				results[i] = s.Verify(emails[i], opts)
+			}
+			continue
+		}
+		facts := s.lookupDomainFacts(opts.context(), verifier, domain, opts.Checks, tenant)
+		if opts.Checks.Has(CheckMX) && !facts.Disposable && !facts.cached[CheckMX] {
+			summary.DNSLookups++
+		}
+		if opts.Checks.Has(CheckSMTP) && !s.catchAllDisabled && facts.Status == DomainHasMail && facts.StatusErr == nil && !isSpecialUse(domain) && !s.skipSMTPDomains.match(domain) {
+			s.cachedCatchAll(domain, opts.profile(), facts)
+			if !facts.catchAllProbed {
+				smtp, info, err := s.probe(opts, domain, "", true)
+				summary.CatchAllProbes++
+				facts.catchAllProbed = true
+				if facts.CatchAllErr = smtpError(err); facts.CatchAllErr == nil {
+					facts.CatchAllConfidence = probedConfidence(smtp, info.report)
+					facts.CatchAll = facts.CatchAllConfidence != CatchAllNo
+					if opts.context().Err() == nil {
+						s.domains.putCatchAll(domain, opts.profile(), facts.CatchAllConfidence)
+					}
+				}
+			}
+			if facts.CatchAll {
+				summary.CatchAllDomains++
+			}
+		}
+
+		domainOpts := opts
+		domainOpts.facts = facts
+		for _, i := range byDomain[domain] {
+			results[i] = s.Verify(emails[i], domainOpts)
+			facts.billed = true
+			if facts.catchAllProbed {
+				if facts.CatchAll || facts.CatchAllErr != nil {
+					summary.SkippedProbes++
+				} else {
+					summary.MailboxProbes++
+				}
+			}
+		}
+	}
+
+	for _, result := range results {
+		summary.CostUnits += result.CostUnits
+	}
+	return results, summary
+}
@@ -0,0 +1,135 @@
+package verify
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"sync/atomic"
+	"testing"
+
+	"email-verifier/pkg/verify/verifytest"
+)
+
+// countingResolver counts MX lookups on top of a verifytest.Resolver
+type countingResolver struct {
+	*verifytest.Resolver
+	mxLookups atomic.Int64
+}
+
+func (c *countingResolver) LookupMX(ctx context.Context, name string) ([]*net.MX, error) {
+	c.mxLookups.Add(1)
+	return c.Resolver.LookupMX(ctx, name)
+}
+
+// newBatchService returns a service with a counting resolver and fake SMTP
+// prober for domains d0..d(n-1).mock, where every even domain is catch-all
+func newBatchService(domains int) (*Service, *countingResolver, *verifytest.SMTP) {
+	fake := verifytest.NewResolver()
+	smtp := verifytest.NewSMTP()
+	for d := 0; d < domains; d++ {
+		domain := fmt.Sprintf("d%d.mock", d)
+		fake.MX[domain] = []*net.MX{{Host: "mx." + domain + ".", Pref: 10}}
+		smtp.CatchAll[domain] = d%2 == 0
+		smtp.Mailboxes["user0@"+domain] = true
+	}
+	counting := &countingResolver{Resolver: fake}
+	return newTestService(Config{Resolver: counting, Prober: smtp.Probe}), counting, smtp
+}
+
+// batchEmails returns perDomain addresses at each of domains domains
+func batchEmails(domains, perDomain int) []string {
+	emails := make([]string, 0, domains*perDomain)
+	for i := 0; i < perDomain; i++ {
+		for d := 0; d < domains; d++ {
+			emails = append(emails, fmt.Sprintf("user%d@d%d.mock", i, d))
+		}
+	}
+	return emails
+}
+
+// TestVerifyBatchGroupsByDomain tests that domain facts are resolved once per domain
+func TestVerifyBatchGroupsByDomain(t *testing.T) {
+	s, dns, smtp := newBatchService(4)
+	emails := append(batchEmails(4, 5), "not-an-address")
+
+	checks := MustParseChecks(CheckDisposable, CheckFree, CheckRole, CheckSMTP)
+	results, summary := s.VerifyBatch(emails, Options{Checks: checks})
+
+	if len(results) != len(emails) {
+		t.Fatalf("Expected %d results, got %d", len(emails), len(results))
+	}
+	for i, result := range results {
+		if result.Email != emails[i] {
+			t.Fatalf("Expected results in input order, got %s at %d", result.Email, i)
+		}
+	}
+
+	expected := BatchSummary{
+		Addresses:       21,
+		Domains:         4,
+		DNSLookups:      4,
+		CatchAllProbes:  4,
+		CatchAllDomains: 2,
+		MailboxProbes:   10,
+		SkippedProbes:   10,
+		// Full price (dns 1 + smtp 5) for the first address at each domain,
+		// then only the mailbox probes at the two non-catch-all domains
+		CostUnits: 4*6 + 8*5,
+	}
+	if summary != expected {
+		t.Errorf("Expected summary %+v, got %+v", expected, summary)
+	}
+	if n := dns.mxLookups.Load(); n != 4 {
+		t.Errorf("Expected 4 MX lookups, got %d", n)
+	}
+	if n := smtp.Probes(); n != 14 {
+		t.Errorf("Expected 14 SMTP probes, got %d", n)
+	}
+
+	// d0 is catch-all, d1 is not and only user0 exists there
+	byEmail := make(map[string]*Result)
+	for _, result := range results {
+		byEmail[result.Email] = result
+	}
+	testCases := []struct {
+		email   string
+		verdict string
+	}{
+		{"user0@d0.mock", VerdictRisky},
+		{"user3@d0.mock", VerdictRisky},
+		{"user0@d1.mock", VerdictDeliverable},
+		{"user3@d1.mock", VerdictUndeliverable},
+		{"not-an-address", VerdictInvalid},
+	}
+	for _, tc := range testCases {
+		if got := byEmail[tc.email].Verdict; got != tc.verdict {
+			t.Errorf("Expected %s to be %s, got %s", tc.email, tc.verdict, got)
+		}
+	}
+}
+
+// benchmarkBatch reports DNS and SMTP operations per batch of 1000 addresses at 50 domains
+func benchmarkBatch(b *testing.B, grouped bool) {
+	s, dns, smtp := newBatchService(50)
+	emails := batchEmails(50, 20)
+	opts := Options{Checks: MustParseChecks(CheckSMTP)}
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if grouped {
+			s.VerifyBatch(emails, opts)
+		} else {
+			for _, email := range emails {
+				s.Verify(email, opts)
+			}
+		}
+	}
+	b.ReportMetric(float64(dns.mxLookups.Load())/float64(b.N), "dns/batch")
+	b.ReportMetric(float64(smtp.Probes())/float64(b.N), "smtp/batch")
+}
+
+// BenchmarkBatchNaive verifies each address independently
+func BenchmarkBatchNaive(b *testing.B) { benchmarkBatch(b, false) }
+
+// BenchmarkBatchGrouped verifies addresses grouped by domain
+func BenchmarkBatchGrouped(b *testing.B) { benchmarkBatch(b, true) }
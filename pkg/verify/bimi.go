@@ -0,0 +1,82 @@
+package verify
+
+import (
+	"context"
+	"net/url"
+	"strings"
+)
+
+// parseTags splits a semicolon-separated tag=value record, as BIMI and
+// DKIM records are, into its tags. It reports false if a tag has no =
+// or is given twice.
+func parseTags(record string) (map[string]string, bool) {
+	tags := map[string]string{}
+	for _, tag := range strings.Split(record, ";") {
+		if strings.TrimSpace(tag) == "" {
+			continue
+		}
+		name, value, found := strings.Cut(tag, "=")
+		name = strings.ToLower(strings.TrimSpace(name))
+		if _, seen := tags[name]; !found || name == "" || seen {
+			return nil, false
+		}
+		tags[name] = strings.TrimSpace(value)
+	}
+	return tags, true
+}
+
+// httpsURL reports whether s is an absolute https URL.
+func httpsURL(s string) bool {
+	u, err := url.Parse(s)
+	return err == nil && u.Scheme == "https" && u.Host != ""
+}
+
+// parseBIMI returns the logo URL of record, which starts with v=BIMI1,
+// and whether it is a valid BIMI record: the version tag first, an l tag
+// that is empty (the domain declines to show a logo) or an https URL, and
+// an a tag, if any, that is too.
+func parseBIMI(record string) (logo string, ok bool) {
+	version, _, _ := strings.Cut(record, ";")
+	if strings.ReplaceAll(version, " ", "") != "v=BIMI1" {
+		return "", false
+	}
+	tags, ok := parseTags(record)
+	if !ok {
+		return "", false
+	}
+	logo, hasLogo := tags["l"]
+	if !hasLogo || logo != "" && !httpsURL(logo) {
+		return "", false
+	}
+	if authority := tags["a"]; authority != "" && !httpsURL(authority) {
+		return "", false
+	}
+	return logo, true
+}
+
+// lookupBIMI fills in records' BIMI record for domain, looked up under
+// the default selector. Only one may be published, so several are
+// reported as invalid. A failed lookup leaves it unset and complete false.
+func lookupBIMI(ctx context.Context, resolver Resolver, domain string, records *DNSRecords) (complete bool) {
+	txt, err := resolver.LookupTXT(ctx, "default._bimi."+domain)
+	if err != nil && !IsNotFound(err) {
+		return false
+	}
+	var bimi []string
+	for _, record := range txt {
+		if strings.HasPrefix(strings.ToLower(record), "v=bimi1") {
+			bimi = append(bimi, record)
+		}
+	}
+	published := len(bimi) > 0
+	records.HasBIMI = &published
+	if published {
+		logo, valid := parseBIMI(bimi[0])
+		valid = valid && len(bimi) == 1
+		records.BIMIValid = &valid
+		if valid {
+			records.BIMILogo = logo
+		}
+	}
+	return true
+}
@@ -0,0 +1,80 @@
+package verify
+
+import (
+	"context"
+	"errors"
+	"net"
+	"testing"
+	"time"
+
+	"email-verifier/pkg/verify/verifytest"
+)
+
+// TestParseBIMI tests which BIMI records are well-formed, and their logos
+func TestParseBIMI(t *testing.T) {
+	testCases := []struct {
+		record string
+		logo   string
+		ok     bool
+	}{
+		{"v=BIMI1; l=https://example.com/logo.svg; a=https://example.com/vmc.pem", "https://example.com/logo.svg", true},
+		{"v=BIMI1; l=https://example.com/logo.svg", "https://example.com/logo.svg", true},
+		{"v=BIMI1; l=; a=;", "", true},
+		{"v=BIMI1;l=https://example.com/logo.svg;", "https://example.com/logo.svg", true},
+		{"v=BIMI1; l=http://example.com/logo.svg", "", false},
+		{"v=BIMI1; l=logo.svg", "", false},
+		{"v=BIMI1; a=https://example.com/vmc.pem", "", false},
+		{"v=BIMI1; l=https://example.com/logo.svg; a=ftp://example.com/vmc.pem", "", false},
+		{"v=BIMI1; l=https://example.com/a.svg; l=https://example.com/b.svg", "", false},
+		{"v=BIMI1; l https://example.com/logo.svg", "", false},
+		{"v=BIMI2; l=https://example.com/logo.svg", "", false},
+		{"l=https://example.com/logo.svg; v=BIMI1", "", false},
+	}
+	for _, tc := range testCases {
+		if logo, ok := parseBIMI(tc.record); logo != tc.logo || ok != tc.ok {
+			t.Errorf("Expected %q, %v for %q, got %q, %v", tc.logo, tc.ok, tc.record, logo, ok)
+		}
+	}
+}
+
+// TestBIMI tests that BIMI records are reported only when enabled, that malformed and duplicate records are present but invalid, and that a failed lookup leaves them out
+func TestBIMI(t *testing.T) {
+	fake := verifytest.NewResolver()
+	for _, domain := range []string{"brand.mock", "bad.mock", "twice.mock", "none.mock", "flaky.mock"} {
+		fake.MX[domain] = []*net.MX{{Host: "mx." + domain + ".", Pref: 10}}
+	}
+	fake.TXT["default._bimi.brand.mock"] = []string{"v=BIMI1; l=https://brand.mock/logo.svg; a=https://brand.mock/vmc.pem"}
+	fake.TXT["default._bimi.bad.mock"] = []string{"v=BIMI1; l=http://bad.mock/logo.svg"}
+	fake.TXT["default._bimi.twice.mock"] = []string{"v=BIMI1; l=https://twice.mock/a.svg", "v=BIMI1; l=https://twice.mock/b.svg"}
+	fake.Err["default._bimi.flaky.mock"] = errors.New("i/o timeout")
+	opts := Options{Checks: DefaultChecks}
+
+	if result := newTestService(Config{Resolver: fake}).Verify("jane@brand.mock", opts); result.DNS != nil {
+		t.Errorf("Expected no dns section by default, got %+v", result.DNS)
+	}
+
+	s := newTestService(Config{Resolver: fake, BIMI: true, DomainCacheTTL: time.Hour})
+	opts = Options{Checks: s.ChecksFor("")}
+	brand := s.Verify("jane@brand.mock", opts).DNS
+	if brand == nil || brand.HasBIMI == nil || !*brand.HasBIMI || !*brand.BIMIValid || brand.BIMILogo != "https://brand.mock/logo.svg" {
+		t.Fatalf("Expected a valid BIMI record, got %+v", brand)
+	}
+	for _, domain := range []string{"bad.mock", "twice.mock"} {
+		if records := s.Verify("jane@"+domain, opts).DNS; !*records.HasBIMI || *records.BIMIValid || records.BIMILogo != "" {
+			t.Errorf("Expected a present but invalid record for %s, got %+v", domain, records)
+		}
+	}
+	if none := s.Verify("jane@none.mock", opts).DNS; *none.HasBIMI || none.BIMIValid != nil {
+		t.Errorf("Expected no record, got %+v", none)
+	}
+	if flaky := s.Verify("jane@flaky.mock", opts); flaky.DNS.HasBIMI != nil || flaky.Error != "" {
+		t.Errorf("Expected the failed lookup to leave the record out, got %+v (%s)", flaky.DNS, flaky.Error)
+	}
+	before := fake.Lookups()
+	if s.Verify("john@flaky.mock", opts); fake.Lookups() == before {
+		t.Errorf("Expected a failed lookup not to be cached")
+	}
+	if result := s.InspectDomain(context.Background(), "brand.mock", ""); result.DNS == nil || result.DNS.BIMILogo != brand.BIMILogo {
+		t.Errorf("Expected the record on a domain inspection, got %+v", result.DNS)
+	}
+}
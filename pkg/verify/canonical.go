@@ -0,0 +1,121 @@
+package verify
+
+import (
+	"encoding/json"
+	"fmt"
+	"maps"
+	"os"
+	"strings"
+)
+
+// ProviderRule says how a mail provider folds addresses into one inbox.
+// Addresses at a domain with a rule have their local part lowercased, as
+// every provider in DefaultProviderRules ignores case.
+type ProviderRule struct {
+	// Domain, if set, is the domain the provider's addresses are known
+	// by, as googlemail.com addresses are gmail.com's.
+	Domain string `json:"domain,omitempty"`
+	// IgnoreDots drops the dots of the local part, as Gmail does.
+	IgnoreDots bool `json:"ignore_dots,omitempty"`
+	// Separator starts a subaddress tag, which is dropped with the rest of
+	// the local part after it; empty for a provider without subaddressing.
+	Separator string `json:"separator,omitempty"`
+}
+
+// DefaultProviderRules are the providers whose rules are known, by domain.
+var DefaultProviderRules = map[string]ProviderRule{
+	"gmail.com":      {IgnoreDots: true, Separator: "+"},
+	"googlemail.com": {Domain: "gmail.com", IgnoreDots: true, Separator: "+"},
+	"outlook.com":    {Separator: "+"},
+	"hotmail.com":    {Separator: "+"},
+	"live.com":       {Separator: "+"},
+	"icloud.com":     {Separator: "+"},
+	"me.com":         {Separator: "+"},
+	"mac.com":        {Separator: "+"},
+	"fastmail.com":   {Separator: "+"},
+	"protonmail.com": {Separator: "+"},
+	"proton.me":      {Separator: "+"},
+	"pm.me":          {Separator: "+"},
+	"yahoo.com":      {Separator: "-"},
+	"hey.com":        {Separator: "+"},
+}
+
+// LoadProviderRules returns DefaultProviderRules with the rules in the
+// JSON file at path, an object mapping domains to rules, on top. A domain
+// mapped to null drops its default rule. An empty path loads the defaults
+// alone.
+func LoadProviderRules(path string) (map[string]ProviderRule, error) {
+	rules := maps.Clone(DefaultProviderRules)
+	if path == "" {
+		return rules, nil
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var overrides map[string]*ProviderRule
+	if err := json.Unmarshal(data, &overrides); err != nil {
+		return nil, fmt.Errorf("parse provider rules %s: %v", path, err)
+	}
+	for domain, rule := range overrides {
+		ascii, err := NormalizeDomain(domain)
+		if err != nil {
+			return nil, fmt.Errorf("provider rules %s: %q is not a domain", path, domain)
+		}
+		if rule == nil {
+			delete(rules, ascii)
+			continue
+		}
+		if rule.Domain != "" {
+			if rule.Domain, err = NormalizeDomain(rule.Domain); err != nil {
+				return nil, fmt.Errorf("provider rules %s, domain %q: %q is not a domain", path, domain, rule.Domain)
+			}
+		}
+		rules[ascii] = *rule
+	}
+	return rules, nil
+}
+
+// NormalizeEmail returns the address the inbox at email is known by: its
+// domain lowercased and in punycode, and for a provider with a rule, its
+// local part folded as the provider does. subaddressed reports whether a
+// subaddress tag was dropped. Input that isn't an address comes back
+// cleaned up by NormalizeInput.
+func (s *Service) NormalizeEmail(email string) (normalized string, subaddressed bool) {
+	email, _ = NormalizeInput(email)
+	at := strings.LastIndex(email, "@")
+	if at < 0 {
+		return email, false
+	}
+	local, domain := email[:at], email[at+1:]
+	if ascii, err := NormalizeDomain(domain); err == nil {
+		domain = ascii
+	} else {
+		domain = strings.ToLower(domain)
+	}
+	rule, ok := s.providerRules[domain]
+	if !ok || strings.HasPrefix(local, `"`) {
+		return local + "@" + domain, false
+	}
+	local = strings.ToLower(local)
+	if rule.Separator != "" {
+		if i := strings.Index(local, rule.Separator); i > 0 {
+			local, subaddressed = local[:i], true
+		}
+	}
+	if rule.IgnoreDots {
+		local = strings.ReplaceAll(local, ".", "")
+	}
+	if rule.Domain != "" {
+		domain = rule.Domain
+	}
+	return local + "@" + domain, subaddressed
+}
+
+// InboxKey is AddressKey for the inbox at email: addresses NormalizeEmail
+// folds together share it. History and the result cache know addresses by
+// it.
+func (s *Service) InboxKey(email string) string {
+	normalized, _ := s.NormalizeEmail(email)
+	return AddressKey(normalized)
+}
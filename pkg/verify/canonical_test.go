@@ -0,0 +1,77 @@
+package verify
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// TestNormalizeEmail tests the provider rules that fold addresses into one inbox
+func TestNormalizeEmail(t *testing.T) {
+	s := newTestService(Config{})
+	testCases := []struct {
+		email        string
+		normalized   string
+		subaddressed bool
+	}{
+		{"J.Ohn+promo@Gmail.com", "john@gmail.com", true},
+		{"john.smith@googlemail.com", "johnsmith@gmail.com", false},
+		{"jane+news@outlook.com", "jane@outlook.com", true},
+		{"jane.doe@outlook.com", "jane.doe@outlook.com", false},
+		{"jane-shop@yahoo.com", "jane@yahoo.com", true},
+		{"+promo@gmail.com", "+promo@gmail.com", false},
+		{"Jane+news@Acme.Mock", "Jane+news@acme.mock", false},
+		{"jane@Bücher.mock", "jane@xn--bcher-kva.mock", false},
+		{`"j.ohn+x"@gmail.com`, `"j.ohn+x"@gmail.com`, false},
+		{"not an address", "not an address", false},
+	}
+	for _, tc := range testCases {
+		normalized, subaddressed := s.NormalizeEmail(tc.email)
+		if normalized != tc.normalized || subaddressed != tc.subaddressed {
+			t.Errorf("Expected %q to normalize to %q (subaddressed %v), got %q (%v)", tc.email, tc.normalized, tc.subaddressed, normalized, subaddressed)
+		}
+	}
+	if s.InboxKey("J.Ohn+promo@gmail.com") != s.InboxKey("john@GMAIL.com") {
+		t.Error("Expected both addresses to share an inbox key")
+	}
+
+	result := s.Verify("j.ohn+promo@gmail.com", Options{Checks: MustParseChecks(CheckSyntax)})
+	if result.NormalizedEmail != "john@gmail.com" || !result.IsSubaddressed {
+		t.Errorf("Expected the normalized address in the result, got %+v", result)
+	}
+}
+
+// TestLoadProviderRules tests that a rules file adds to, replaces and drops the defaults
+func TestLoadProviderRules(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "rules.json")
+	os.WriteFile(path, []byte(`{
+		"Acme.Mock": {"separator": "+"},
+		"acme-mail.mock": {"domain": "Acme.Mock", "separator": "+"},
+		"yahoo.com": null,
+		"outlook.com": {"separator": "+", "ignore_dots": true}
+	}`), 0o600)
+	rules, err := LoadProviderRules(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := newTestService(Config{ProviderRules: rules})
+	for email, expected := range map[string]string{
+		"jane+x@acme.mock":      "jane@acme.mock",
+		"jane+x@acme-mail.mock": "jane@acme.mock",
+		"jane-shop@yahoo.com":   "jane-shop@yahoo.com",
+		"ja.ne@outlook.com":     "jane@outlook.com",
+		"j.ohn+x@gmail.com":     "john@gmail.com",
+	} {
+		if normalized, _ := s.NormalizeEmail(email); normalized != expected {
+			t.Errorf("Expected %s to normalize to %s, got %s", email, expected, normalized)
+		}
+	}
+	if _, ok := DefaultProviderRules["acme.mock"]; ok {
+		t.Error("Expected the defaults left alone")
+	}
+
+	os.WriteFile(path, []byte(`{"bad..mock": {}}`), 0o600)
+	if _, err := LoadProviderRules(path); err == nil {
+		t.Error("Expected an error for a bad domain")
+	}
+}
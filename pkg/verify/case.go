@@ -0,0 +1,36 @@
+package verify
+
+import (
+	"strings"
+	"unicode"
+)
+
+// Addresses are handled case by case, by part. Domains are case-insensitive,
+// so they are lowercased for every lookup, list check and result field.
+// RFC 5321 lets a mail server treat local parts case-sensitively, so the
+// SMTP probe sends them as submitted. Almost no provider does, though, so
+// history, retry tokens, pseudonyms and deduplication key an address by
+// AddressKey, under which every spelling is the same address.
+
+// WarningUppercaseLocalPart is reported when the local part has uppercase
+// letters. It was probed as written, but stored results are shared with
+// every other spelling of the address.
+const WarningUppercaseLocalPart = "uppercase_local_part"
+
+// AddressKey returns the form email is keyed, stored and deduplicated by:
+// its normalized input, lowercased. It lowercases rather than applying
+// full Unicode case folding, which would merge spellings such as ß and ss
+// that providers do not, and which would change the keys stored before
+// the policy was written down.
+func AddressKey(email string) string {
+	email, _ = NormalizeInput(email)
+	return strings.ToLower(email)
+}
+
+// warnCase adds WarningUppercaseLocalPart to result if username has
+// uppercase letters.
+func warnCase(result *Result, username string) {
+	if strings.IndexFunc(username, unicode.IsUpper) >= 0 {
+		result.Warnings = append(result.Warnings, WarningUppercaseLocalPart)
+	}
+}
@@ -0,0 +1,65 @@
+package verify
+
+import (
+	"net"
+	"slices"
+	"testing"
+
+	"email-verifier/pkg/verify/verifytest"
+)
+
+// TestAddressKey tests that every spelling of an address shares one key
+func TestAddressKey(t *testing.T) {
+	testCases := []struct {
+		a, b string
+		same bool
+	}{
+		{"User@EXAMPLE.COM", "user@example.com", true},
+		{" John.Smith@Partner.Mock​", "john.smith@partner.mock", true},
+		{"ÉLODIE@exemple.fr", "élodie@exemple.fr", true},
+		{"straße@example.de", "strasse@example.de", false},
+		{"jane@example.com", "jane@example.org", false},
+	}
+	for _, tc := range testCases {
+		if same := AddressKey(tc.a) == AddressKey(tc.b); same != tc.same {
+			t.Errorf("Expected same key for %q and %q to be %v", tc.a, tc.b, tc.same)
+		}
+		if same := AddressHash(tc.a) == AddressHash(tc.b); same != tc.same {
+			t.Errorf("Expected the hashes of %q and %q to agree with their keys", tc.a, tc.b)
+		}
+	}
+}
+
+// TestCasePolicy tests that domains are lowercased, local parts are probed as written and uppercase is flagged
+func TestCasePolicy(t *testing.T) {
+	fake := verifytest.NewResolver()
+	fake.MX["partner.mock"] = []*net.MX{{Host: "mx.partner.mock.", Pref: 10}}
+	smtp := verifytest.NewSMTP()
+	// A case-sensitive server that knows only the capitalized spelling
+	smtp.Mailboxes["John.Smith@partner.mock"] = true
+	s := newTestService(Config{Resolver: fake, Prober: smtp.Probe})
+	checks := MustParseChecks(CheckSMTP)
+
+	testCases := []struct {
+		email, username, verdict string
+		warned                   bool
+	}{
+		{"John.Smith@PARTNER.Mock", "John.Smith", VerdictDeliverable, true},
+		{"john.smith@partner.mock", "john.smith", VerdictUndeliverable, false},
+		{"JOHN.SMITH@partner.mock", "JOHN.SMITH", VerdictUndeliverable, true},
+	}
+	for _, tc := range testCases {
+		result := s.Verify(tc.email, Options{Checks: checks})
+		if result.Domain != "partner.mock" || result.Username != tc.username || result.Verdict != tc.verdict {
+			t.Errorf("Expected %s probed as %s at partner.mock to be %s, got %+v", tc.email, tc.username, tc.verdict, result)
+		}
+		if warned := slices.Contains(result.Warnings, WarningUppercaseLocalPart); warned != tc.warned {
+			t.Errorf("Expected %s warned=%v, got %v", tc.email, tc.warned, result.Warnings)
+		}
+	}
+
+	special := s.Verify("Postmaster@LOCALHOST", Options{Checks: checks})
+	if special.Domain != "localhost" || !slices.Contains(special.Warnings, WarningUppercaseLocalPart) {
+		t.Errorf("Expected a lowercased non-routable domain and the warning, got %+v", special)
+	}
+}
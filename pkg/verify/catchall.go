@@ -0,0 +1,54 @@
+package verify
+
+import (
+	"crypto/rand"
+	"encoding/base32"
+	"strings"
+
+	emailverifier "github.com/AfterShip/email-verifier"
+)
+
+// Catch-all confidences, reported in Result.CatchAllConfidence: how many
+// of the random mailboxes the catch-all probe asked about were accepted.
+const (
+	CatchAllConfirmed = "confirmed" // all of them
+	CatchAllLikely    = "likely"    // some, the others rejected or deferred
+	CatchAllNo        = "no"        // none
+)
+
+// DefaultCatchAllProbes is how many random mailboxes the catch-all probe
+// asks about.
+const DefaultCatchAllProbes = 2
+
+// catchAllConfidence grades a catch-all probe that had accepted of probes
+// random mailboxes accepted.
+func catchAllConfidence(accepted, probes int) string {
+	switch {
+	case accepted == 0:
+		return CatchAllNo
+	case accepted >= probes:
+		return CatchAllConfirmed
+	}
+	return CatchAllLikely
+}
+
+// randomLocalPart returns a local part no one would have: 32 random
+// letters and digits, so probing it can't hit a real mailbox.
+func randomLocalPart() string {
+	b := make([]byte, 20)
+	rand.Read(b)
+	return strings.ToLower(base32.StdEncoding.EncodeToString(b))
+}
+
+// probedConfidence returns the catch-all confidence of a catch-all probe
+// that came back with smtp, from report when the prober graded it and
+// otherwise from smtp alone.
+func probedConfidence(smtp *emailverifier.SMTP, report probeReport) string {
+	switch {
+	case report.catchAll != "":
+		return report.catchAll
+	case smtp != nil && smtp.CatchAll:
+		return CatchAllConfirmed
+	}
+	return CatchAllNo
+}
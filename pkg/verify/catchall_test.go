@@ -0,0 +1,155 @@
+package verify
+
+import (
+	"bufio"
+	"context"
+	"net"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"email-verifier/pkg/verify/verifytest"
+)
+
+// serveRcpt answers SMTP sessions on a local port until the test ends,
+// replying to the nth RCPT TO of the server's life with reply(n, mailbox).
+// It returns the port.
+func serveRcpt(t *testing.T, reply func(n int64, mailbox string) string) string {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { listener.Close() })
+	var rcpts atomic.Int64
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				conn.Write([]byte("220 mx.test ESMTP\r\n"))
+				r := bufio.NewReader(conn)
+				for {
+					line, err := r.ReadString('\n')
+					if err != nil {
+						return
+					}
+					line = strings.TrimSpace(line)
+					answer := "250 OK"
+					switch {
+					case strings.HasPrefix(strings.ToUpper(line), "RCPT"):
+						answer = reply(rcpts.Add(1), strings.Trim(strings.TrimPrefix(line[len("RCPT"):], " TO:"), "<>"))
+					case strings.EqualFold(line, "QUIT"):
+						conn.Write([]byte("221 Bye\r\n"))
+						return
+					}
+					conn.Write([]byte(answer + "\r\n"))
+				}
+			}()
+		}
+	}()
+	_, port, _ := net.SplitHostPort(listener.Addr().String())
+	return port
+}
+
+// TestCatchAllConfidence tests the grading of catch-all probes and that the random mailboxes are long and distinct
+func TestCatchAllConfidence(t *testing.T) {
+	testCases := []struct {
+		accepted, probes int
+		expected         string
+	}{
+		{2, 2, CatchAllConfirmed},
+		{1, 1, CatchAllConfirmed},
+		{1, 2, CatchAllLikely},
+		{2, 3, CatchAllLikely},
+		{0, 2, CatchAllNo},
+	}
+	for _, tc := range testCases {
+		if got := catchAllConfidence(tc.accepted, tc.probes); got != tc.expected {
+			t.Errorf("Expected %s for %d of %d accepted, got %s", tc.expected, tc.accepted, tc.probes, got)
+		}
+	}
+
+	first, second := randomLocalPart(), randomLocalPart()
+	if len(first) != 32 || first == second || strings.ToLower(first) != first {
+		t.Errorf("Expected distinct 32-character lowercase local parts, got %q and %q", first, second)
+	}
+}
+
+// TestSMTPClientCatchAllConfidence tests that every random mailbox is asked about and a deferred one isn't taken for catch-all
+func TestSMTPClientCatchAllConfidence(t *testing.T) {
+	fake := verifytest.NewResolver()
+	fake.MX["acme.io"] = []*net.MX{{Host: "127.0.0.1", Pref: 10}}
+	var randoms atomic.Int64
+	testCases := []struct {
+		name       string
+		reply      func(n int64, mailbox string) string
+		confidence string
+		catchAll   bool
+	}{
+		{"accepts all", func(n int64, mailbox string) string { return "250 OK" }, CatchAllConfirmed, true},
+		{"accepts some", func(n int64, mailbox string) string {
+			if n == 1 {
+				return "250 OK"
+			}
+			return "550 5.1.1 User unknown"
+		}, CatchAllLikely, true},
+		{"defers unknown users", func(n int64, mailbox string) string {
+			if strings.HasPrefix(mailbox, "jane@") {
+				return "250 OK"
+			}
+			return "450 4.1.1 Recipient address rejected: unverified address"
+		}, CatchAllNo, false},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			randoms.Store(0)
+			client := NewSMTPClient(Profile{})
+			client.CatchAllProbes = 3
+			client.port = serveRcpt(t, func(n int64, mailbox string) string {
+				if !strings.HasPrefix(mailbox, "jane@") {
+					randoms.Add(1)
+				}
+				return tc.reply(n, mailbox)
+			})
+			smtp, report, err := client.check(context.Background(), fake, "acme.io", "jane", true)
+			if err != nil || smtp.CatchAll != tc.catchAll || report.catchAll != tc.confidence {
+				t.Errorf("Expected catch_all %v (%s), got %+v (%s) and %v", tc.catchAll, tc.confidence, smtp, report.catchAll, err)
+			}
+			if randoms.Load() != 3 {
+				t.Errorf("Expected 3 random mailboxes asked about, got %d", randoms.Load())
+			}
+			if !tc.catchAll && !smtp.Deliverable {
+				t.Error("Expected the mailbox probed once the domain isn't catch-all")
+			}
+		})
+	}
+}
+
+// TestCatchAllConfidenceCached tests that the confidence is cached with the catch-all status, so the random mailboxes are asked about once per TTL
+func TestCatchAllConfidenceCached(t *testing.T) {
+	fake := verifytest.NewResolver()
+	fake.MX["acme.io"] = []*net.MX{{Host: "127.0.0.1", Pref: 10}}
+	var rcpts atomic.Int64
+	port := serveRcpt(t, func(n int64, mailbox string) string {
+		rcpts.Store(n)
+		return "250 OK"
+	})
+	s := newTestService(Config{Resolver: fake, CatchAllCacheTTL: time.Hour, BuildProfile: func(p Profile) *SMTPClient {
+		client := NewSMTPClient(p)
+		client.port = port
+		return client
+	}})
+
+	first := s.Verify("jane@acme.io", Options{Checks: MustParseChecks(CheckSMTP)})
+	second := s.Verify("john@acme.io", Options{Checks: MustParseChecks(CheckSMTP)})
+	if first.CatchAllConfidence != CatchAllConfirmed || second.CatchAllConfidence != CatchAllConfirmed || !second.CatchAllCached {
+		t.Errorf("Expected confirmed both times, the second from the cache, got %q and %q", first.CatchAllConfidence, second.CatchAllConfidence)
+	}
+	if rcpts.Load() != DefaultCatchAllProbes {
+		t.Errorf("Expected %d random mailboxes asked about in all, got %d", DefaultCatchAllProbes, rcpts.Load())
+	}
+}
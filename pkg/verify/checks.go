@@ -0,0 +1,218 @@
+package verify
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// Check names, in the order they run.
+const (
+	CheckSyntax     = "syntax"
+	CheckFree       = "free"
+	CheckRole       = "role"
+	CheckDisposable = "disposable"
+	CheckSuggest    = "suggest"
+	CheckMX         = "mx"
+	// The mail-auth checks fill in Result.DNS: auth_records the SPF and
+	// DMARC records, which the other three report alongside.
+	CheckAuthRecords = "auth_records"
+	CheckMTASTS      = "mta_sts"
+	CheckBIMI        = "bimi"
+	CheckDKIM        = "dkim"
+	CheckGravatar    = "gravatar"
+	CheckSMTP        = "smtp"
+)
+
+// CheckOrder lists every check in the order they run.
+var CheckOrder = []string{CheckSyntax, CheckFree, CheckRole, CheckDisposable, CheckSuggest, CheckMX, CheckAuthRecords, CheckMTASTS, CheckBIMI, CheckDKIM, CheckGravatar, CheckSMTP}
+
+// checkDependencies lists the checks each check needs to have run first.
+var checkDependencies = map[string][]string{
+	CheckSyntax:      nil,
+	CheckFree:        {CheckSyntax},
+	CheckRole:        {CheckSyntax},
+	CheckDisposable:  {CheckSyntax},
+	CheckSuggest:     {CheckSyntax},
+	CheckMX:          {CheckSyntax},
+	CheckAuthRecords: {CheckMX},
+	CheckMTASTS:      {CheckAuthRecords},
+	CheckBIMI:        {CheckAuthRecords},
+	CheckDKIM:        {CheckAuthRecords},
+	CheckGravatar:    {CheckMX},
+	CheckSMTP:        {CheckMX},
+}
+
+// networkChecks are the checks that talk to DNS, mail servers or Gravatar.
+var networkChecks = []string{CheckMX, CheckAuthRecords, CheckMTASTS, CheckBIMI, CheckDKIM, CheckGravatar, CheckSMTP}
+
+// dnsChecks are the mail-auth checks, in the order they run.
+var dnsChecks = []string{CheckAuthRecords, CheckMTASTS, CheckBIMI, CheckDKIM}
+
+// CheckSet is a resolved set of checks to run. Build one with ParseChecks,
+// which adds each check's dependencies.
+type CheckSet map[string]bool
+
+// DefaultChecks run when a request doesn't say otherwise. SMTP probing is
+// opt-in because most hosts can't reach port 25, and the mail-auth and
+// Gravatar checks are opt-in unless their Config flags add them to the
+// service's defaults; see Service.ChecksFor.
+var DefaultChecks = MustParseChecks(CheckSyntax, CheckFree, CheckRole, CheckDisposable, CheckSuggest, CheckMX)
+
+// defaultChecksFor returns DefaultChecks with the optional checks cfg
+// turns on.
+func defaultChecksFor(cfg Config) CheckSet {
+	names := DefaultChecks.Names()
+	optional := []struct {
+		check string
+		on    bool
+	}{
+		{CheckAuthRecords, cfg.AuthRecords},
+		{CheckMTASTS, cfg.MTASTS},
+		{CheckBIMI, cfg.BIMI},
+		{CheckDKIM, cfg.DKIMProbe},
+		{CheckGravatar, cfg.Gravatar},
+	}
+	for _, o := range optional {
+		if o.on {
+			names = append(names, o.check)
+		}
+	}
+	return MustParseChecks(names...)
+}
+
+// ParseChecks validates names and adds their dependencies. Syntax always
+// runs.
+func ParseChecks(names ...string) (CheckSet, error) {
+	set := make(CheckSet)
+	unknown := 0
+	for _, name := range names {
+		name = strings.ToLower(strings.TrimSpace(name))
+		if name == "" {
+			continue
+		}
+		if _, ok := checkDependencies[name]; !ok {
+			unknown++
+			continue
+		}
+		set.add(name)
+	}
+	// Unknown names are counted rather than echoed back, since they are
+	// unvalidated input.
+	if unknown > 0 {
+		return nil, fmt.Errorf("%d unknown check(s); valid checks are %s", unknown, strings.Join(CheckOrder, ", "))
+	}
+	set.add(CheckSyntax)
+	return set, nil
+}
+
+// MustParseChecks is ParseChecks for names known to be valid; it panics on
+// an unknown name.
+func MustParseChecks(names ...string) CheckSet {
+	set, err := ParseChecks(names...)
+	if err != nil {
+		panic(err)
+	}
+	return set
+}
+
+func (s CheckSet) add(name string) {
+	if s[name] {
+		return
+	}
+	s[name] = true
+	for _, dep := range checkDependencies[name] {
+		s.add(dep)
+	}
+}
+
+// Has reports whether the check should run.
+func (s CheckSet) Has(name string) bool { return s[name] }
+
+// Names returns the checks in run order.
+func (s CheckSet) Names() []string {
+	names := make([]string, 0, len(s))
+	for _, name := range CheckOrder {
+		if s[name] {
+			names = append(names, name)
+		}
+	}
+	return names
+}
+
+// dns returns the mail-auth checks in s.
+func (s CheckSet) dns() CheckSet {
+	set := make(CheckSet)
+	for _, name := range dnsChecks {
+		if s[name] {
+			set[name] = true
+		}
+	}
+	return set
+}
+
+// WithoutNetwork returns a copy of s without the network checks.
+func (s CheckSet) WithoutNetwork() CheckSet {
+	local := make(CheckSet, len(s))
+	for name := range s {
+		local[name] = true
+	}
+	for _, name := range networkChecks {
+		delete(local, name)
+	}
+	return local
+}
+
+// Without returns a copy of s without name and the checks that need it.
+func (s CheckSet) Without(name string) CheckSet {
+	rest := make(CheckSet, len(s))
+	for _, check := range CheckOrder {
+		if !s[check] || check == name {
+			continue
+		}
+		needed := true
+		for _, dep := range checkDependencies[check] {
+			needed = needed && rest[dep]
+		}
+		if needed {
+			rest[check] = true
+		}
+	}
+	return rest
+}
+
+// NeedsNetwork reports whether s includes a check that talks to DNS or mail
+// servers.
+func (s CheckSet) NeedsNetwork() bool {
+	for _, name := range networkChecks {
+		if s.Has(name) {
+			return true
+		}
+	}
+	return false
+}
+
+// LoadKeyChecks reads a JSON file mapping API keys to default check lists.
+func LoadKeyChecks(path string) (map[string]CheckSet, error) {
+	if path == "" {
+		return map[string]CheckSet{}, nil
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var lists map[string][]string
+	if err := json.Unmarshal(data, &lists); err != nil {
+		return nil, fmt.Errorf("parse checks config %s: %v", path, err)
+	}
+	sets := make(map[string]CheckSet, len(lists))
+	for key, names := range lists {
+		set, err := ParseChecks(names...)
+		if err != nil {
+			return nil, fmt.Errorf("checks config %s, key %q: unknown checks in %v; valid checks are %s", path, key, names, strings.Join(CheckOrder, ", "))
+		}
+		sets[key] = set
+	}
+	return sets, nil
+}
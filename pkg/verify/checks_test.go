@@ -0,0 +1,142 @@
+package verify
+
+import (
+	"net"
+	"os"
+	"path/filepath"
+	"reflect"
+	"slices"
+	"testing"
+	"time"
+
+	emailverifier "github.com/AfterShip/email-verifier"
+
+	"email-verifier/pkg/verify/verifytest"
+)
+
+// TestParseChecks tests check validation and dependency resolution
+func TestParseChecks(t *testing.T) {
+	testCases := []struct {
+		name     string
+		input    []string
+		expected []string
+		err      bool
+	}{
+		{"syntax always runs", []string{"free"}, []string{"syntax", "free"}, false},
+		{"smtp pulls in mx", []string{"smtp"}, []string{"syntax", "mx", "smtp"}, false},
+		{"case and spaces", []string{" MX ", "Role"}, []string{"syntax", "role", "mx"}, false},
+		{"empty entries ignored", []string{"", "disposable", ""}, []string{"syntax", "disposable"}, false},
+		{"nothing requested", nil, []string{"syntax"}, false},
+		{"unknown check", []string{"mx", "telepathy"}, nil, true},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			set, err := ParseChecks(tc.input...)
+			if tc.err {
+				if err == nil {
+					t.Fatalf("Expected error, got %v", set.Names())
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Expected no error, got %v", err)
+			}
+			if got := set.Names(); !reflect.DeepEqual(got, tc.expected) {
+				t.Errorf("Expected %v, got %v", tc.expected, got)
+			}
+		})
+	}
+}
+
+// TestChecksReport tests that checks_performed and checks_skipped reflect what ran
+func TestChecksReport(t *testing.T) {
+	fake := verifytest.NewResolver()
+	fake.MX["example.com"] = []*net.MX{{Host: "mx.example.com.", Pref: 10}}
+	s := newTestService(Config{Resolver: fake})
+
+	testCases := []struct {
+		name      string
+		email     string
+		checks    []string
+		performed []string
+	}{
+		{"defaults", "jane@example.com", DefaultChecks.Names(), []string{"syntax", "free", "role", "disposable", "suggest", "mx"}},
+		{"syntax only", "jane@example.com", []string{"syntax"}, []string{"syntax"}},
+		{"invalid stops after syntax", "not-an-address", []string{"mx"}, []string{"syntax"}},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			result := s.Verify(tc.email, Options{Checks: MustParseChecks(tc.checks...)})
+			if !reflect.DeepEqual(result.ChecksPerformed, tc.performed) {
+				t.Errorf("Expected performed %v, got %v", tc.performed, result.ChecksPerformed)
+			}
+			if len(result.ChecksPerformed)+len(result.ChecksSkipped) != len(CheckOrder) {
+				t.Errorf("Expected performed and skipped to cover %v, got %v and %v", CheckOrder, result.ChecksPerformed, result.ChecksSkipped)
+			}
+		})
+	}
+}
+
+// TestOptionalChecks tests that the mail-auth and Gravatar checks default to their Config flags, can be asked for and left out per call, are reported and charged, and that the domain cache only answers for the records it looked up
+func TestOptionalChecks(t *testing.T) {
+	fake := verifytest.NewResolver()
+	fake.MX["brand.mock"] = []*net.MX{{Host: "mx.brand.mock.", Pref: 10}}
+	fake.TXT["brand.mock"] = []string{"v=spf1 -all"}
+	fake.TXT["default._bimi.brand.mock"] = []string{"v=BIMI1; l=https://brand.mock/logo.svg"}
+	gravatar := func(string) (*emailverifier.Gravatar, error) { return &emailverifier.Gravatar{HasGravatar: true}, nil }
+
+	if names := newTestService(Config{Resolver: fake}).ChecksFor("").Names(); !reflect.DeepEqual(names, DefaultChecks.Names()) {
+		t.Errorf("Expected DefaultChecks without the flags, got %v", names)
+	}
+	s := newTestService(Config{Resolver: fake, BIMI: true, Gravatar: true, GravatarLookup: gravatar, DomainCacheTTL: time.Hour})
+	expected := []string{"syntax", "free", "role", "disposable", "suggest", "mx", "auth_records", "bimi", "gravatar"}
+	if names := s.ChecksFor("").Names(); !reflect.DeepEqual(names, expected) {
+		t.Fatalf("Expected the flags to add %v, got %v", expected, names)
+	}
+
+	result := s.Verify("jane@brand.mock", Options{Checks: MustParseChecks(CheckAuthRecords)})
+	if !reflect.DeepEqual(result.ChecksPerformed, []string{"syntax", "mx", "auth_records"}) || result.DNS == nil || !result.DNS.HasSPF || result.DNS.HasBIMI != nil || result.Gravatar != nil || result.CostUnits != 2 {
+		t.Errorf("Expected only the SPF and DMARC records, got %v, %+v and %d units", result.ChecksPerformed, result.DNS, result.CostUnits)
+	}
+	before := fake.Lookups()
+	result = s.Verify("john@brand.mock", Options{Checks: s.ChecksFor("")})
+	if !reflect.DeepEqual(result.ChecksPerformed, expected) || result.DNS.HasBIMI == nil || !*result.DNS.HasBIMI || result.Gravatar == nil || fake.Lookups() == before {
+		t.Errorf("Expected BIMI looked up on top of the cached records, got %v and %+v after %d lookups", result.ChecksPerformed, result.DNS, fake.Lookups()-before)
+	}
+	before = fake.Lookups()
+	result = s.Verify("jane@brand.mock", Options{Checks: s.ChecksFor("").Without(CheckAuthRecords)})
+	if result.DNS != nil || slices.Contains(result.ChecksPerformed, CheckBIMI) || !slices.Contains(result.ChecksSkipped, CheckBIMI) || fake.Lookups() != before {
+		t.Errorf("Expected leaving out auth_records to leave out bimi, got %v and %+v", result.ChecksPerformed, result.DNS)
+	}
+	result = s.Verify("jane@brand.mock", Options{Checks: MustParseChecks(CheckAuthRecords)})
+	if result.DNS == nil || result.DNS.HasBIMI != nil || fake.Lookups() != before {
+		t.Errorf("Expected the cached records without the bimi ones, got %+v after %d lookups", result.DNS, fake.Lookups()-before)
+	}
+	if names := MustParseChecks(CheckDKIM, CheckGravatar).Names(); !reflect.DeepEqual(names, []string{"syntax", "mx", "auth_records", "dkim", "gravatar"}) {
+		t.Errorf("Expected the optional checks to pull in mx, got %v", names)
+	}
+}
+
+// TestLoadKeyChecks tests reading per-key defaults from a config file
+func TestLoadKeyChecks(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "checks.json")
+	if err := os.WriteFile(path, []byte(`{"bulk":["smtp"]}`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	sets, err := LoadKeyChecks(path)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if got, expected := sets["bulk"].Names(), []string{"syntax", "mx", "smtp"}; !reflect.DeepEqual(got, expected) {
+		t.Errorf("Expected %v, got %v", expected, got)
+	}
+
+	if err := os.WriteFile(path, []byte(`{"bulk":["smpt"]}`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := LoadKeyChecks(path); err == nil {
+		t.Error("Expected error for unknown check in config")
+	}
+}
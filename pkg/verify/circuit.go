@@ -0,0 +1,222 @@
+package verify
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	emailverifier "github.com/AfterShip/email-verifier"
+)
+
+// Circuit breaker defaults.
+const (
+	DefaultCircuitFailures = 5
+	DefaultCircuitWindow   = 10 * time.Minute
+	DefaultCircuitCooldown = 15 * time.Minute
+)
+
+// CircuitConfig sets the per-domain circuit breaker in front of SMTP
+// probes. Once a domain's probes time out or fail to connect Failures
+// times in a row, all within Window, the circuit opens: its addresses
+// aren't probed for Cooldown and fail with ErrCircuitOpen instead. After
+// the cooldown the next probe goes through; the circuit closes if it
+// reaches a server and opens again if it doesn't. The zero value is the
+// breaker with its defaults.
+type CircuitConfig struct {
+	Off      bool
+	Failures int
+	Window   time.Duration
+	Cooldown time.Duration
+}
+
+// ErrCircuitOpen is returned, wrapped with the domain and wait, for
+// probes of a domain whose circuit is open.
+var ErrCircuitOpen = errors.New("SMTP circuit open")
+
+type circuitOpen struct {
+	domain string
+	wait   time.Duration
+}
+
+func (e *circuitOpen) Error() string {
+	return fmt.Sprintf("%v for %s, closes in %v", ErrCircuitOpen, e.domain, e.wait.Round(time.Second))
+}
+
+func (e *circuitOpen) Is(target error) bool { return target == ErrCircuitOpen }
+
+// domainCircuit is one domain's run of failed probes. openedAt is set
+// once the circuit has opened, and stays set while it is half-open after
+// the cooldown.
+type domainCircuit struct {
+	failures  []time.Time
+	openedAt  time.Time
+	openUntil time.Time
+}
+
+// circuits enforces CircuitConfig.
+type circuits struct {
+	cfg CircuitConfig
+
+	mu      sync.Mutex
+	domains map[string]*domainCircuit
+	now     func() time.Time
+}
+
+// newCircuits returns the breaker for cfg, or nil if it is off.
+func newCircuits(cfg CircuitConfig) *circuits {
+	if cfg.Off {
+		return nil
+	}
+	if cfg.Failures <= 0 {
+		cfg.Failures = DefaultCircuitFailures
+	}
+	if cfg.Window <= 0 {
+		cfg.Window = DefaultCircuitWindow
+	}
+	if cfg.Cooldown <= 0 {
+		cfg.Cooldown = DefaultCircuitCooldown
+	}
+	return &circuits{cfg: cfg, domains: make(map[string]*domainCircuit), now: time.Now}
+}
+
+// allow returns ErrCircuitOpen if domain's circuit is open, and nil if
+// domain may be probed.
+func (c *circuits) allow(domain string) error {
+	if c == nil {
+		return nil
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	state := c.domains[strings.ToLower(domain)]
+	if state == nil {
+		return nil
+	}
+	if now := c.now(); now.Before(state.openUntil) {
+		return &circuitOpen{domain: domain, wait: state.openUntil.Sub(now)}
+	}
+	return nil
+}
+
+// record counts a probe of domain: a timeout or failed connection adds to
+// the run of failures, and reaching a server ends it. Other outcomes,
+// such as deferred probes, leave it as it was.
+func (c *circuits) record(domain string, smtp *emailverifier.SMTP, err error) {
+	if c == nil {
+		return
+	}
+	domain = strings.ToLower(domain)
+	failed := circuitFailure(smtp, err)
+	if !failed && err != nil && (smtp == nil || !smtp.HostExists) {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if !failed {
+		if state := c.domains[domain]; state != nil && !state.openedAt.IsZero() {
+			log.Printf("circuit: %s answered again, closing its circuit", domain)
+		}
+		delete(c.domains, domain)
+		return
+	}
+	now := c.now()
+	state := c.domains[domain]
+	if state == nil {
+		state = &domainCircuit{}
+		c.domains[domain] = state
+	}
+	state.trim(now, c.cfg.Window)
+	state.failures = append(state.failures, now)
+	if !state.openedAt.IsZero() || len(state.failures) >= c.cfg.Failures {
+		if state.openedAt.IsZero() {
+			state.openedAt = now
+		}
+		state.openUntil = now.Add(c.cfg.Cooldown)
+		log.Printf("circuit: %s failed %d probes in a row, not probing it until %s", domain, len(state.failures), state.openUntil.UTC().Format(time.RFC3339))
+	}
+}
+
+// circuitFailure reports whether a probe timed out or never reached a
+// server to talk to.
+func circuitFailure(smtp *emailverifier.SMTP, err error) bool {
+	if smtpError(err) == nil || (smtp != nil && smtp.HostExists) {
+		return false
+	}
+	switch ErrorCodeFor(err) {
+	case ErrCodeSMTPTimeout, ErrCodeSMTPUnavailable:
+		return true
+	}
+	return false
+}
+
+// trim drops failures older than window.
+func (d *domainCircuit) trim(now time.Time, window time.Duration) {
+	n := sort.Search(len(d.failures), func(i int) bool { return now.Sub(d.failures[i]) < window })
+	d.failures = append(d.failures[:0], d.failures[n:]...)
+}
+
+// sweep drops domains whose failures the window has passed and whose
+// circuits have never opened, and returns how many. A circuit that has
+// opened is kept, half-open, until a probe gets through: the cooldown
+// outlasts the window by default, so its failures are gone by then.
+func (c *circuits) sweep(now time.Time) int {
+	if c == nil {
+		return 0
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	removed := 0
+	for domain, state := range c.domains {
+		state.trim(now, c.cfg.Window)
+		if len(state.failures) == 0 && state.openedAt.IsZero() {
+			delete(c.domains, domain)
+			removed++
+		}
+	}
+	return removed
+}
+
+// OpenCircuit is a domain whose circuit is open.
+type OpenCircuit struct {
+	Domain    string    `json:"domain"`
+	Failures  int       `json:"failures"` // in a row, within the window
+	OpenedAt  time.Time `json:"opened_at"`
+	OpenUntil time.Time `json:"open_until"`
+}
+
+// OpenCircuits lists the domains whose circuits are open, soonest to
+// close first.
+func (s *Service) OpenCircuits() []OpenCircuit {
+	open := []OpenCircuit{}
+	c := s.circuits
+	if c == nil {
+		return open
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	now := c.now()
+	for domain, state := range c.domains {
+		if now.Before(state.openUntil) {
+			open = append(open, OpenCircuit{
+				Domain:    domain,
+				Failures:  len(state.failures),
+				OpenedAt:  state.openedAt.UTC(),
+				OpenUntil: state.openUntil.UTC(),
+			})
+		}
+	}
+	sort.Slice(open, func(i, j int) bool {
+		if !open[i].OpenUntil.Equal(open[j].OpenUntil) {
+			return open[i].OpenUntil.Before(open[j].OpenUntil)
+		}
+		return open[i].Domain < open[j].Domain
+	})
+	return open
+}
+
+// SweepCircuits drops circuit state the window has passed and returns how
+// many domains went with it.
+func (s *Service) SweepCircuits(now time.Time) int { return s.circuits.sweep(now) }
@@ -0,0 +1,109 @@
+package verify
+
+import (
+	"net"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	emailverifier "github.com/AfterShip/email-verifier"
+
+	"email-verifier/pkg/verify/verifytest"
+)
+
+// TestCircuitBreaker tests that a domain's circuit opens after a run of timeouts in the window and closes once a probe gets through
+func TestCircuitBreaker(t *testing.T) {
+	fake := verifytest.NewResolver()
+	for _, domain := range []string{"slow.mock", "flaky.mock", "partner.mock"} {
+		fake.MX[domain] = []*net.MX{{Host: "mx." + domain + ".", Pref: 10}}
+	}
+	smtp := verifytest.NewSMTP()
+	smtp.Errors["slow.mock"] = &emailverifier.LookupError{Message: emailverifier.ErrTimeout}
+	smtp.Errors["flaky.mock"] = &emailverifier.LookupError{Message: emailverifier.ErrServerUnavailable}
+	s := newTestService(Config{
+		Resolver: fake,
+		Prober:   smtp.Probe,
+		Polite:   PoliteConfig{Off: true},
+		Circuit:  CircuitConfig{Failures: 3, Window: time.Minute, Cooldown: 10 * time.Minute},
+	})
+	var elapsed atomic.Int64
+	s.circuits.now = func() time.Time { return politeBase.Add(time.Duration(elapsed.Load())) }
+	verify := func(email string) *Result {
+		return s.Verify(email, Options{Checks: MustParseChecks(CheckSMTP)})
+	}
+
+	for _, email := range []string{"a@slow.mock", "b@slow.mock", "c@slow.mock"} {
+		if result := verify(email); result.ErrorCode != ErrCodeSMTPTimeout {
+			t.Fatalf("Expected %s below the threshold, got %s", ErrCodeSMTPTimeout, result.ErrorCode)
+		}
+	}
+	result := verify("d@slow.mock")
+	if result.Reachable != ReachableUnknown || result.ReachableReason != ErrCodeCircuitOpen || result.RetryAfter != 600 || smtp.Probes() != 3 {
+		t.Errorf("Expected the open circuit to answer without a probe, got %+v after %d probes", result, smtp.Probes())
+	}
+	open := s.OpenCircuits()
+	if len(open) != 1 || open[0].Domain != "slow.mock" || open[0].Failures != 3 || !open[0].OpenUntil.Equal(politeBase.Add(10*time.Minute)) {
+		t.Errorf("Expected slow.mock open until the cooldown ends, got %+v", open)
+	}
+	if result := verify("jane@partner.mock"); result.ErrorCode != "" {
+		t.Errorf("Expected other domains to be probed, got %s", result.ErrorCode)
+	}
+
+	// Failures further apart than the window don't add up
+	verify("a@flaky.mock")
+	elapsed.Add(int64(2 * time.Minute))
+	verify("b@flaky.mock")
+	if result := verify("c@flaky.mock"); result.ErrorCode != ErrCodeSMTPUnavailable {
+		t.Errorf("Expected flaky.mock still probed, got %s", result.ErrorCode)
+	}
+
+	// After the cooldown one failure opens the circuit again
+	elapsed.Add(int64(10 * time.Minute))
+	verify("e@slow.mock")
+	if result := verify("f@slow.mock"); result.ErrorCode != ErrCodeCircuitOpen {
+		t.Errorf("Expected the circuit open again after a failed probe, got %s", result.ErrorCode)
+	}
+
+	// A probe that reaches the server closes it
+	elapsed.Add(int64(10 * time.Minute))
+	delete(smtp.Errors, "slow.mock")
+	if result := verify("g@slow.mock"); result.ErrorCode != "" {
+		t.Errorf("Expected the probe through after the cooldown, got %s", result.ErrorCode)
+	}
+	if result := verify("h@slow.mock"); result.ErrorCode != "" || len(s.OpenCircuits()) != 0 {
+		t.Errorf("Expected the circuit closed, got %s and %+v", result.ErrorCode, s.OpenCircuits())
+	}
+	if removed := s.SweepCircuits(politeBase.Add(time.Hour)); removed != 1 {
+		t.Errorf("Expected flaky.mock swept, got %d", removed)
+	}
+}
+
+// TestCircuitSweepHalfOpen tests that with the default window and cooldown a sweep after the cooldown keeps the circuit half-open, so the next failure opens it again
+func TestCircuitSweepHalfOpen(t *testing.T) {
+	fake := verifytest.NewResolver()
+	fake.MX["slow.mock"] = []*net.MX{{Host: "mx.slow.mock.", Pref: 10}}
+	smtp := verifytest.NewSMTP()
+	smtp.Errors["slow.mock"] = &emailverifier.LookupError{Message: emailverifier.ErrTimeout}
+	s := newTestService(Config{Resolver: fake, Prober: smtp.Probe, Polite: PoliteConfig{Off: true}})
+	var elapsed atomic.Int64
+	now := func() time.Time { return politeBase.Add(time.Duration(elapsed.Load())) }
+	s.circuits.now = now
+	verify := func(email string) *Result {
+		return s.Verify(email, Options{Checks: MustParseChecks(CheckSMTP)})
+	}
+
+	for i := 0; i < DefaultCircuitFailures; i++ {
+		verify("jane@slow.mock")
+	}
+	if open := s.OpenCircuits(); len(open) != 1 {
+		t.Fatalf("Expected slow.mock open, got %+v", open)
+	}
+	elapsed.Add(int64(DefaultCircuitCooldown + time.Minute))
+	if removed := s.SweepCircuits(now()); removed != 0 {
+		t.Errorf("Expected the half-open circuit kept, got %d swept", removed)
+	}
+	verify("jane@slow.mock")
+	if result := verify("jane@slow.mock"); result.ErrorCode != ErrCodeCircuitOpen || smtp.Probes() != DefaultCircuitFailures+1 {
+		t.Errorf("Expected one failed probe to open the circuit again, got %s after %d probes", result.ErrorCode, smtp.Probes())
+	}
+}
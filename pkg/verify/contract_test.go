@@ -0,0 +1,194 @@
+package verify
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+var update = flag.Bool("update", false, "rewrite golden files in testdata/golden")
+
+// goldenFixtures are the canonical response shapes. Changing any JSON field
+// name, tag or omitempty behaviour must come with a regenerated golden file
+// (go test -run TestGoldenContracts -update).
+func goldenFixtures() map[string]interface{} {
+	verifiedAt := time.Date(2024, 3, 3, 9, 30, 0, 0, time.UTC)
+	certValid := true
+	mtaSTSMode, hasTLSRPT := MTASTSEnforce, true
+	hasBIMI, bimiValid := true, true
+	return map[string]interface{}{
+		"result_full": &Result{
+			Email:               "jane.doe@example.com",
+			Ref:                 "crm:12345",
+			IsValid:             true,
+			Reachable:           "yes",
+			ReachableReason:     ReachableReasonCatchAll,
+			Verdict:             VerdictRisky,
+			VerdictReasons:      []string{"default policy: disposable=mark_risky"},
+			Score:               45,
+			RiskFlags:           []string{SignalDisposable},
+			Disposable:          true,
+			RoleAccount:         true,
+			Free:                true,
+			HasMxRecords:        true,
+			MX:                  []MXRecord{{Host: "mx1.example.com", Preference: 10}, {Host: "mx2.example.com", Preference: 20}},
+			NullMX:              true,
+			MXFallbackA:         true,
+			DNSError:            DNSErrorServFail,
+			CatchAll:            true,
+			CatchAllCached:      true,
+			CatchAllConfidence:  CatchAllLikely,
+			Suppressed:          true,
+			DomainStatus:        DomainHasMail,
+			DomainReason:        DomainReasonReservedTLD,
+			LegacyFormat:        LegacyPercentHack,
+			LocalPartRandomness: 0.12,
+			Suggestion:          "gmail.com",
+			SuggestionResult:    &Result{Email: "jane.doe@gmail.com", IsValid: true, Reachable: ReachableYes, ReachableReason: ReachableReasonDeliverable, Verdict: VerdictDeliverable, RiskFlags: []string{}, ChecksPerformed: []string{CheckSyntax}, ChecksSkipped: []string{}},
+			Error:               errorMessages[ErrCodeSMTPTryAgain],
+			ErrorCode:           ErrCodeSMTPTryAgain,
+			ErrorMessage:        errorMessages[ErrCodeSMTPTryAgain],
+			SMTPDetails:         &SMTPDetails{Code: 452, EnhancedCode: "4.2.2", Reason: SMTPReasonQuotaExceeded, Message: "The email account that you tried to reach is over quota.", Temporary: true},
+			Attempts:            2,
+			SMTPHost:            "mx2.example.com",
+			SMTPAddressFamily:   AddressFamilyIPv6,
+			SMTPBanner:          "mx2.example.com ESMTP Postfix",
+			MailProvider:        MailProviderSelfHosted,
+			Transport:           &TransportInfo{STARTTLS: true, TLSVersion: "TLS 1.3", CertValid: &certValid},
+			SMTPSkippedReason:   SMTPSkippedAllowlisted,
+			Username:            "jane.doe",
+			Domain:              "example.com",
+			ASCIIDomain:         "example.com",
+			RequiresSMTPUTF8:    true,
+			NormalizedEmail:     "jane.doe@example.com",
+			IsSubaddressed:      true,
+			DisplayName:         "Jane Doe",
+			RetryToken:          "eyJoIjoiYWJjIn0.c2ln",
+			RetryAfter:          300,
+			Deferred:            true,
+			Warnings:            []string{WarningInvisibleCharacters},
+			Envelope: &EnvelopeInfo{
+				Classification:  EnvelopeSRS0,
+				OriginalAddress: "jane.doe@example.com",
+				ReturnDomain:    "forwarder.example",
+				VerifiedAddress: "jane.doe@example.com",
+			},
+			DNS: &DNSRecords{
+				HasSPF: true, SPFValid: true, SPF: "v=spf1 include:_spf.example.com -all",
+				HasDMARC: true, DMARCValid: true, DMARC: "v=DMARC1; p=reject", DMARCPolicy: DMARCReject,
+				MTASTSMode: &mtaSTSMode, HasTLSRPT: &hasTLSRPT,
+				HasBIMI: &hasBIMI, BIMIValid: &bimiValid, BIMILogo: "https://example.com/bimi/logo.svg",
+				DKIMSelectors: []string{"google", "selector1"},
+				Error:         "lookup _dmarc.example.com: i/o timeout",
+			},
+			Gravatar:        &Gravatar{HasGravatar: true, GravatarURL: "https://www.gravatar.com/avatar/0f2b6d1e"},
+			Cached:          true,
+			VerifiedAt:      &verifiedAt,
+			ChecksPerformed: []string{CheckSyntax, CheckFree, CheckRole, CheckDisposable, CheckSuggest, CheckMX, CheckSMTP},
+			ChecksSkipped:   []string{},
+			CostUnits:       6,
+		},
+		"result_minimal": &Result{
+			Email:           "",
+			Reachable:       "unknown",
+			ReachableReason: ReachableReasonNotChecked,
+			Verdict:         VerdictUnknown,
+			RiskFlags:       []string{},
+			ChecksPerformed: []string{},
+			ChecksSkipped:   CheckOrder,
+		},
+		"result_error": &Result{
+			Email:           "not-an-address",
+			Reachable:       "unknown",
+			Verdict:         VerdictInvalid,
+			ReachableReason: ReachableReasonInvalid,
+			RiskFlags:       []string{},
+			Error:           errorMessages[ErrCodeInvalidSyntax],
+			ErrorCode:       ErrCodeInvalidSyntax,
+			ErrorMessage:    errorMessages[ErrCodeInvalidSyntax],
+			ChecksPerformed: []string{CheckSyntax},
+			ChecksSkipped:   []string{CheckFree, CheckRole, CheckDisposable, CheckSuggest, CheckMX, CheckSMTP},
+		},
+		"result_retryable": &Result{
+			Email:           "user@greylisted.example",
+			IsValid:         true,
+			Reachable:       "unknown",
+			Verdict:         VerdictUnknown,
+			ReachableReason: ReachableReasonInconclusive,
+			RiskFlags:       []string{},
+			HasMxRecords:    true,
+			DomainStatus:    DomainHasMail,
+			Error:           "Verification failed: Try again later : 451 greylisted",
+			Username:        "user",
+			Domain:          "greylisted.example",
+			RetryToken:      "eyJoIjoiYWJjIn0.c2ln",
+			RetryAfter:      300,
+			Deferred:        true,
+			ChecksPerformed: []string{CheckSyntax, CheckFree, CheckRole, CheckDisposable, CheckSuggest, CheckMX, CheckSMTP},
+			ChecksSkipped:   []string{},
+		},
+	}
+}
+
+// TestGoldenContracts tests that response JSON matches the checked-in golden files byte for byte
+func TestGoldenContracts(t *testing.T) {
+	for name, fixture := range goldenFixtures() {
+		t.Run(name, func(t *testing.T) {
+			got, err := json.MarshalIndent(fixture, "", "  ")
+			if err != nil {
+				t.Fatalf("Failed to marshal fixture: %v", err)
+			}
+			got = append(got, '\n')
+
+			path := filepath.Join("testdata", "golden", name+".json")
+			if *update {
+				if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+					t.Fatal(err)
+				}
+				if err := os.WriteFile(path, got, 0o644); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			want, err := os.ReadFile(path)
+			if err != nil {
+				t.Fatalf("Missing golden file %s (run with -update to create it): %v", path, err)
+			}
+			if !bytes.Equal(got, want) {
+				t.Errorf("JSON shape changed for %s; if intentional, rerun with -update and commit the diff\n--- got\n%s\n--- want\n%s", name, got, want)
+			}
+		})
+	}
+}
+
+// TestGoldenFilesAreUsed tests that every golden file on disk has a fixture
+func TestGoldenFilesAreUsed(t *testing.T) {
+	fixtures := goldenFixtures()
+	files, err := filepath.Glob(filepath.Join("testdata", "golden", "*.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, file := range files {
+		name := filepath.Base(file)
+		name = name[:len(name)-len(".json")]
+		if _, ok := fixtures[name]; !ok {
+			t.Errorf("Golden file %s has no fixture; delete it or add the fixture back", file)
+		}
+	}
+}
+
+// TestGoldenFullCoversAllFields tests that the full fixture sets every
+// Result field, so adding a field forces a golden file update
+func TestGoldenFullCoversAllFields(t *testing.T) {
+	full := reflect.ValueOf(goldenFixtures()["result_full"]).Elem()
+	for i := 0; i < full.NumField(); i++ {
+		if full.Field(i).IsZero() {
+			t.Errorf("result_full fixture leaves %s unset; populate it and rerun with -update", full.Type().Field(i).Name)
+		}
+	}
+}
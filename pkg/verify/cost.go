@@ -0,0 +1,96 @@
+package verify
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Cost categories that checks are charged under.
+const (
+	CostSyntax = "syntax"
+	CostList   = "list" // free, role, disposable and suggest
+	CostDNS    = "dns"  // mx and the mail-auth records
+	CostHTTP   = "http" // gravatar
+	CostSMTP   = "smtp"
+)
+
+// DefaultCostUnits is the unit cost of each category when none is
+// configured. Only network work costs anything by default.
+var DefaultCostUnits = map[string]int{
+	CostSyntax: 0,
+	CostList:   0,
+	CostDNS:    1,
+	CostHTTP:   1,
+	CostSMTP:   5,
+}
+
+// checkCostCategory maps each check to the category it is charged under.
+var checkCostCategory = map[string]string{
+	CheckSyntax:      CostSyntax,
+	CheckFree:        CostList,
+	CheckRole:        CostList,
+	CheckDisposable:  CostList,
+	CheckSuggest:     CostList,
+	CheckMX:          CostDNS,
+	CheckAuthRecords: CostDNS,
+	CheckMTASTS:      CostDNS,
+	CheckBIMI:        CostDNS,
+	CheckDKIM:        CostDNS,
+	CheckGravatar:    CostHTTP,
+	CheckSMTP:        CostSMTP,
+}
+
+// CostModel prices verifications in abstract units so infrastructure cost
+// can be attributed to the keys that consume it.
+type CostModel struct {
+	// Units is the cost of each category; DefaultCostUnits if nil.
+	Units map[string]int
+	// CachedPercent is the share of a check's cost charged when its work
+	// was reused rather than repeated, such as the DNS lookup for the second
+	// address at a domain in a batch. Reused work is free by default.
+	CachedPercent int
+}
+
+// charge returns the units for the performed checks, at the cached rate
+// for those in reused.
+func (m CostModel) charge(performed []string, reused map[string]bool) int {
+	units := m.Units
+	if units == nil {
+		units = DefaultCostUnits
+	}
+	total := 0
+	for _, check := range performed {
+		cost := units[checkCostCategory[check]]
+		if reused[check] {
+			cost = cost * m.CachedPercent / 100
+		}
+		total += cost
+	}
+	return total
+}
+
+// ParseCostUnits reads comma-separated category=units overrides, e.g.
+// "dns=2,smtp=10", on top of DefaultCostUnits.
+func ParseCostUnits(s string) (map[string]int, error) {
+	units := make(map[string]int, len(DefaultCostUnits))
+	for category, cost := range DefaultCostUnits {
+		units[category] = cost
+	}
+	for _, pair := range strings.Split(s, ",") {
+		pair = strings.TrimSpace(pair)
+		if pair == "" {
+			continue
+		}
+		category, value, ok := strings.Cut(pair, "=")
+		if _, known := DefaultCostUnits[category]; !ok || !known {
+			return nil, fmt.Errorf("invalid cost %q: want one of syntax, list, dns, http or smtp followed by =units", pair)
+		}
+		cost, err := strconv.Atoi(value)
+		if err != nil || cost < 0 {
+			return nil, fmt.Errorf("invalid cost %q: units must be a non-negative integer", pair)
+		}
+		units[category] = cost
+	}
+	return units, nil
+}
@@ -0,0 +1,85 @@
+package verify
+
+import (
+	"testing"
+)
+
+// TestCostUnits tests what single verifications are charged for the checks they ran
+func TestCostUnits(t *testing.T) {
+	s, _, _ := newBatchService(2)
+
+	testCases := []struct {
+		name   string
+		email  string
+		checks CheckSet
+		units  int
+	}{
+		{"list checks only", "user0@d1.mock", MustParseChecks(CheckFree, CheckRole, CheckDisposable), 0},
+		{"dns", "user0@d1.mock", DefaultChecks, 1},
+		{"smtp", "user0@d1.mock", MustParseChecks(CheckSMTP), 6},
+		{"invalid syntax", "not-an-address", MustParseChecks(CheckSMTP), 0},
+		{"non-routable needs no lookup", "user@intranet", MustParseChecks(CheckSMTP), 0},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := s.Verify(tc.email, Options{Checks: tc.checks}).CostUnits; got != tc.units {
+				t.Errorf("Expected %d units, got %d", tc.units, got)
+			}
+		})
+	}
+}
+
+// TestBatchCostUnits tests that a batch's summary units equal the sum of its items, with reused lookups at the cached rate
+func TestBatchCostUnits(t *testing.T) {
+	emails := append(batchEmails(4, 5), "not-an-address", "user@intranet")
+
+	testCases := []struct {
+		name  string
+		costs CostModel
+		units int
+	}{
+		{"reused work free", CostModel{}, 4*6 + 8*5},
+		// Reused DNS lookups and catch-all answers cost half
+		{"reused work at half", CostModel{Units: map[string]int{CostDNS: 2, CostSMTP: 10}, CachedPercent: 50}, 4*12 + 8*(1+10) + 8*(1+5)},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			s, _, _ := newBatchService(4)
+			s.costs = tc.costs
+			results, summary := s.VerifyBatch(emails, Options{Checks: MustParseChecks(CheckSMTP)})
+
+			sum := 0
+			for _, result := range results {
+				sum += result.CostUnits
+			}
+			if summary.CostUnits != sum {
+				t.Errorf("Expected summary units to equal the items' sum %d, got %d", sum, summary.CostUnits)
+			}
+			if summary.CostUnits != tc.units {
+				t.Errorf("Expected %d units, got %d", tc.units, summary.CostUnits)
+			}
+		})
+	}
+}
+
+// TestParseCostUnits tests cost overrides on top of the defaults
+func TestParseCostUnits(t *testing.T) {
+	units, err := ParseCostUnits("smtp=10, dns=0")
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if units[CostSMTP] != 10 || units[CostDNS] != 0 || units[CostSyntax] != 0 {
+		t.Errorf("Expected smtp=10 dns=0 over the defaults, got %v", units)
+	}
+	if DefaultCostUnits[CostSMTP] != 5 {
+		t.Error("Expected the defaults to be left unchanged")
+	}
+
+	for _, bad := range []string{"smtp", "whois=3", "dns=-1", "dns=cheap"} {
+		if _, err := ParseCostUnits(bad); err == nil {
+			t.Errorf("Expected an error for %q", bad)
+		}
+	}
+}
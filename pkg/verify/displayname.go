@@ -0,0 +1,28 @@
+package verify
+
+import (
+	"net/mail"
+	"strings"
+)
+
+// splitDisplayName takes an address as a mail client writes it, such as
+// "Jane Doe <jane@example.com>", apart into the bare address and the
+// display name. count is how many addresses input holds if it parses as an
+// RFC 5322 address list; it is 0, and input is left to the other parsers,
+// if it doesn't or if it is a single bare address.
+func splitDisplayName(input string) (address, name string, count int) {
+	if !strings.ContainsAny(input, "<,") {
+		return input, "", 0
+	}
+	list, err := mail.ParseAddressList(input)
+	if err != nil {
+		return input, "", 0
+	}
+	if len(list) == 1 && !strings.Contains(input, "<") {
+		return input, "", 0
+	}
+	if len(list) > 1 {
+		return input, "", len(list)
+	}
+	return list[0].Address, list[0].Name, 1
+}
@@ -0,0 +1,46 @@
+package verify
+
+import (
+	"net"
+	"testing"
+
+	"email-verifier/pkg/verify/verifytest"
+)
+
+// TestDisplayName tests that addresses with display names are verified by the bare address, and lists of several are refused
+func TestDisplayName(t *testing.T) {
+	fake := verifytest.NewResolver()
+	fake.MX["acme.mock"] = []*net.MX{{Host: "mx.acme.mock.", Pref: 10}}
+	s := newTestService(Config{Resolver: fake})
+	opts := Options{Checks: MustParseChecks(CheckMX)}
+
+	testCases := []struct {
+		input, email, name string
+	}{
+		{"Jane Doe <jane@acme.mock>", "jane@acme.mock", "Jane Doe"},
+		{`"Doe, Jane" <jane@acme.mock>`, "jane@acme.mock", "Doe, Jane"},
+		{"<jane@acme.mock>", "jane@acme.mock", ""},
+		{"=?utf-8?q?J=C3=BCrgen?= <jurgen@acme.mock>", "jurgen@acme.mock", "Jürgen"},
+		{"jane@acme.mock", "jane@acme.mock", ""},
+	}
+	for _, tc := range testCases {
+		result := s.Verify(tc.input, opts)
+		if !result.IsValid || result.Email != tc.email || result.DisplayName != tc.name || !result.HasMxRecords {
+			t.Errorf("Expected %q verified as %q named %q, got %+v", tc.input, tc.email, tc.name, result)
+		}
+	}
+
+	result := s.Verify("Jane <jane@acme.mock>, bob@acme.mock, Ann <ann@acme.mock>", opts)
+	if result.IsValid || result.ErrorCode != ErrCodeMultipleAddresses || result.Error != "Invalid email address format: found 3 addresses, expected one" {
+		t.Errorf("Expected the list refused with its count, got %+v", result)
+	}
+	// What net/mail can't parse goes the old way
+	if result := s.Verify("Jane Doe <jane@acme.mock", opts); result.IsValid || result.ErrorCode != ErrCodeInvalidSyntax {
+		t.Errorf("Expected invalid syntax, got %+v", result)
+	}
+
+	results, summary := s.VerifyBatch([]string{"Jane <jane@acme.mock>", "bob@acme.mock"}, opts)
+	if results[0].DisplayName != "Jane" || !results[0].HasMxRecords || summary.Domains != 1 {
+		t.Errorf("Expected both addresses grouped under one domain, got %+v and %+v", results[0], summary)
+	}
+}
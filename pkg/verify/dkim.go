@@ -0,0 +1,66 @@
+package verify
+
+import (
+	"context"
+	"encoding/base64"
+	"strings"
+	"sync"
+)
+
+// DefaultDKIMSelectors are the DKIM selectors Config.DKIMProbe looks for:
+// Google Workspace's, Microsoft 365's two, Mailchimp's and the usual
+// default.
+var DefaultDKIMSelectors = []string{"google", "default", "selector1", "selector2", "k1"}
+
+// parseDKIMKey reports whether record is a published DKIM key: a v tag,
+// if any, first and DKIM1, and a p tag holding a base64 public key. An
+// empty p tag is a revoked key.
+func parseDKIMKey(record string) bool {
+	tags, ok := parseTags(record)
+	if !ok {
+		return false
+	}
+	if version, found := tags["v"]; found {
+		first, _, _ := strings.Cut(record, "=")
+		if version != "DKIM1" || strings.TrimSpace(first) != "v" {
+			return false
+		}
+	}
+	key := strings.Join(strings.Fields(tags["p"]), "")
+	if key == "" {
+		return false
+	}
+	_, err := base64.StdEncoding.DecodeString(key)
+	return err == nil
+}
+
+// lookupDKIM fills in which of DefaultDKIMSelectors have a key published
+// for domain. The selectors are looked up at once, so this takes about as
+// long as one lookup. If any lookup failed, complete is false and only
+// the keys found are reported.
+func lookupDKIM(ctx context.Context, resolver Resolver, domain string, records *DNSRecords) (complete bool) {
+	found := make([]bool, len(DefaultDKIMSelectors))
+	failed := make([]bool, len(DefaultDKIMSelectors))
+	var wg sync.WaitGroup
+	for i, selector := range DefaultDKIMSelectors {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			txt, err := resolver.LookupTXT(ctx, selector+"._domainkey."+domain)
+			failed[i] = err != nil && !IsNotFound(err)
+			for _, record := range txt {
+				found[i] = found[i] || parseDKIMKey(record)
+			}
+		}()
+	}
+	wg.Wait()
+
+	complete = true
+	for i, selector := range DefaultDKIMSelectors {
+		if found[i] {
+			records.DKIMSelectors = append(records.DKIMSelectors, selector)
+		}
+		complete = complete && !failed[i]
+	}
+	return complete
+}
@@ -0,0 +1,76 @@
+package verify
+
+import (
+	"context"
+	"errors"
+	"net"
+	"reflect"
+	"testing"
+	"time"
+
+	"email-verifier/pkg/verify/verifytest"
+)
+
+// TestParseDKIMKey tests which DKIM key records count as a published key
+func TestParseDKIMKey(t *testing.T) {
+	testCases := map[string]bool{
+		"v=DKIM1; k=rsa; p=MIGfMA0GCSqGSIb3DQEBAQUAA4GNADCBiQKBgQC1": true,
+		"k=rsa; p=MIGfMA0GCSqGSIb3DQEBAQUAA4GNADCBiQKBgQC1":          true,
+		"v=DKIM1; p=MIGfMA0GCSqG SIb3DQEB AQUAA4GNADCBiQKBgQC1":      true,
+		"v=DKIM1; k=rsa; p=": false,
+		"v=DKIM1; k=rsa":     false,
+		"v=DKIM2; p=MIGfMA0GCSqGSIb3DQEBAQUAA4GNADCBiQKBgQC1":        false,
+		"k=rsa; v=DKIM1; p=MIGfMA0GCSqGSIb3DQEBAQUAA4GNADCBiQKBgQC1": false,
+		"v=DKIM1; p=not base64!":                                     false,
+		"v=DKIM1; p=MIGf; p=MIGf":                                    false,
+		"v=DKIM1 p=MIGfMA0GCSqGSIb3DQEBAQUAA4GNADCBiQKBgQC1":         false,
+		"google-site-verification=abc":                               false,
+	}
+	for record, expected := range testCases {
+		if got := parseDKIMKey(record); got != expected {
+			t.Errorf("Expected %v for %q, got %v", expected, record, got)
+		}
+	}
+}
+
+// TestDKIMProbe tests that the selectors with published keys are reported only when enabled, skipping revoked and malformed ones, and that a failed lookup drops only its selector
+func TestDKIMProbe(t *testing.T) {
+	fake := verifytest.NewResolver()
+	for _, domain := range []string{"signed.mock", "none.mock", "flaky.mock"} {
+		fake.MX[domain] = []*net.MX{{Host: "mx." + domain + ".", Pref: 10}}
+	}
+	key := "v=DKIM1; k=rsa; p=MIGfMA0GCSqGSIb3DQEBAQUAA4GNADCBiQKBgQC1"
+	fake.TXT["google._domainkey.signed.mock"] = []string{key}
+	fake.TXT["default._domainkey.signed.mock"] = []string{"v=DKIM1; k=rsa; p="}
+	fake.TXT["selector1._domainkey.signed.mock"] = []string{"v=DKIM1; k=rsa p=MIGf"}
+	fake.TXT["k1._domainkey.signed.mock"] = []string{"google-site-verification=abc", key}
+	fake.TXT["google._domainkey.flaky.mock"] = []string{key}
+	fake.TXT["selector2._domainkey.flaky.mock"] = []string{key}
+	fake.Err["google._domainkey.flaky.mock"] = errors.New("i/o timeout")
+	opts := Options{Checks: DefaultChecks}
+
+	if result := newTestService(Config{Resolver: fake}).Verify("jane@signed.mock", opts); result.DNS != nil {
+		t.Errorf("Expected no dns section by default, got %+v", result.DNS)
+	}
+
+	s := newTestService(Config{Resolver: fake, DKIMProbe: true, DomainCacheTTL: time.Hour})
+	opts = Options{Checks: s.ChecksFor("")}
+	if signed := s.Verify("jane@signed.mock", opts).DNS; signed == nil || !reflect.DeepEqual(signed.DKIMSelectors, []string{"google", "k1"}) {
+		t.Fatalf("Expected selectors google and k1, got %+v", signed)
+	}
+	if none := s.Verify("jane@none.mock", opts).DNS; none == nil || none.DKIMSelectors != nil {
+		t.Errorf("Expected no selectors, got %+v", none)
+	}
+	flaky := s.Verify("jane@flaky.mock", opts)
+	if !reflect.DeepEqual(flaky.DNS.DKIMSelectors, []string{"selector2"}) || flaky.Error != "" {
+		t.Errorf("Expected only the selector that was looked up, got %+v (%s)", flaky.DNS, flaky.Error)
+	}
+	before := fake.Lookups()
+	if s.Verify("john@flaky.mock", opts); fake.Lookups() == before {
+		t.Errorf("Expected a failed lookup not to be cached")
+	}
+	before = fake.Lookups()
+	if result := s.InspectDomain(context.Background(), "signed.mock", ""); result.DNS == nil || len(result.DNS.DKIMSelectors) != 2 || fake.Lookups() != before {
+		t.Errorf("Expected the cached selectors on a domain inspection, got %+v", result.DNS)
+	}
+}
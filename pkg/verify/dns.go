@@ -0,0 +1,138 @@
+package verify
+
+import (
+	"context"
+	"errors"
+	"net"
+	"strings"
+	"time"
+)
+
+// Resolver is the subset of *net.Resolver used for domain lookups, so tests
+// can substitute canned answers.
+type Resolver interface {
+	LookupMX(ctx context.Context, name string) ([]*net.MX, error)
+	LookupTXT(ctx context.Context, name string) ([]string, error)
+	LookupHost(ctx context.Context, host string) ([]string, error)
+}
+
+// LookupSPF returns the domain's SPF record, or "" if none is published.
+func LookupSPF(ctx context.Context, resolver Resolver, domain string) (string, error) {
+	records, err := resolver.LookupTXT(ctx, domain)
+	if err != nil {
+		return "", err
+	}
+	for _, record := range records {
+		if strings.HasPrefix(strings.ToLower(record), "v=spf1") {
+			return record, nil
+		}
+	}
+	return "", nil
+}
+
+// IsNotFound reports whether err is a DNS answer that the name doesn't
+// exist, as opposed to a failed lookup.
+func IsNotFound(err error) bool {
+	var dnsErr *net.DNSError
+	return errors.As(err, &dnsErr) && dnsErr.IsNotFound
+}
+
+// DNSConfig says where DNS lookups go and how their answers are kept.
+type DNSConfig struct {
+	// Servers (host:port) answer lookups in place of the system resolver,
+	// tried in order.
+	Servers []string
+	// DoHURL, if set, is a DNS-over-HTTPS endpoint that answers lookups in
+	// place of Servers and the system resolver, queried with DoHMethod
+	// (GET if empty). DoHFallback lets the system resolver answer lookups
+	// that failed there, though not those it said don't exist.
+	DoHURL      string
+	DoHMethod   string
+	DoHFallback bool
+	// Timeout bounds each lookup, or with Servers each query to a server;
+	// the resolver's own limits apply if zero.
+	Timeout time.Duration
+	// CacheMaxTTL turns on the DNS cache, which keeps answers for their
+	// TTL up to CacheMaxTTL. TTLs are only known with Servers; the system
+	// resolver's answers are kept for CacheMaxTTL. Off if zero.
+	CacheMaxTTL time.Duration
+}
+
+// newResolver returns the resolver cfg describes, without its cache.
+func newResolver(cfg DNSConfig) Resolver {
+	var system Resolver = net.DefaultResolver
+	if cfg.Timeout > 0 {
+		system = timeoutResolver{next: system, timeout: cfg.Timeout}
+	}
+	if cfg.DoHURL != "" {
+		client := &DNSClient{DoHURL: cfg.DoHURL, DoHMethod: cfg.DoHMethod, Timeout: cfg.Timeout}
+		if cfg.DoHFallback {
+			client.Fallback = system
+		}
+		return client
+	}
+	if client := NewDNSClient(cfg.Servers, cfg.Timeout); len(client.Servers) > 0 {
+		return client
+	}
+	return system
+}
+
+// timeoutResolver bounds each of next's lookups to timeout.
+type timeoutResolver struct {
+	next    Resolver
+	timeout time.Duration
+}
+
+func (r timeoutResolver) LookupMX(ctx context.Context, name string) ([]*net.MX, error) {
+	ctx, cancel := context.WithTimeout(ctx, r.timeout)
+	defer cancel()
+	return r.next.LookupMX(ctx, name)
+}
+
+func (r timeoutResolver) LookupTXT(ctx context.Context, name string) ([]string, error) {
+	ctx, cancel := context.WithTimeout(ctx, r.timeout)
+	defer cancel()
+	return r.next.LookupTXT(ctx, name)
+}
+
+func (r timeoutResolver) LookupHost(ctx context.Context, host string) ([]string, error) {
+	ctx, cancel := context.WithTimeout(ctx, r.timeout)
+	defer cancel()
+	return r.next.LookupHost(ctx, host)
+}
+
+// Kinds of failed lookup, as reported in Result.DNSError.
+const (
+	DNSErrorNXDomain = "nxdomain" // the domain doesn't exist
+	DNSErrorServFail = "servfail" // its name servers failed to answer
+	DNSErrorRefused  = "refused"  // the resolver refused to answer
+	DNSErrorTimeout  = "timeout"  // no answer in time
+	DNSErrorOther    = "error"
+)
+
+// DNSErrorKind says how a lookup failed: whether the name doesn't exist,
+// which is an answer, or the lookup itself failed and may well succeed if
+// tried again. It returns "" for a nil err.
+func DNSErrorKind(err error) string {
+	if err == nil {
+		return ""
+	}
+	var dnsErr *net.DNSError
+	if !errors.As(err, &dnsErr) {
+		if errors.Is(err, context.DeadlineExceeded) {
+			return DNSErrorTimeout
+		}
+		return DNSErrorOther
+	}
+	switch {
+	case dnsErr.IsNotFound:
+		return DNSErrorNXDomain
+	case dnsErr.IsTimeout:
+		return DNSErrorTimeout
+	case dnsErr.Err == dnsErrServFail:
+		return DNSErrorServFail
+	case strings.Contains(dnsErr.Err, "refused"):
+		return DNSErrorRefused
+	}
+	return DNSErrorOther
+}
@@ -0,0 +1,25 @@
+package verify
+
+import (
+	"context"
+	"testing"
+
+	"email-verifier/pkg/verify/verifytest"
+)
+
+// TestLookupSPF tests picking the SPF record out of a domain's TXT records
+func TestLookupSPF(t *testing.T) {
+	fake := verifytest.NewResolver()
+	fake.TXT["example.com"] = []string{"google-site-verification=abc", "v=spf1 include:_spf.google.com ~all"}
+	fake.TXT["nospf.com"] = []string{"hello"}
+
+	spf, err := LookupSPF(context.Background(), fake, "example.com")
+	if err != nil || spf != "v=spf1 include:_spf.google.com ~all" {
+		t.Errorf("Expected SPF record, got %q (err %v)", spf, err)
+	}
+
+	spf, err = LookupSPF(context.Background(), fake, "nospf.com")
+	if err != nil || spf != "" {
+		t.Errorf("Expected no SPF record, got %q (err %v)", spf, err)
+	}
+}
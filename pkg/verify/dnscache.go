@@ -0,0 +1,151 @@
+package verify
+
+import (
+	"context"
+	"net"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/net/dns/dnsmessage"
+)
+
+// DNSCacheObserver is told whether each lookup through the DNS cache was
+// answered from it, e.g. to export the hit rate. It is called from the
+// looking-up goroutine, so it must be safe for concurrent use.
+type DNSCacheObserver func(hit bool)
+
+// dnsCache is a Resolver that keeps next's answers for their TTL, up to
+// maxTTL. Only a *DNSClient reports TTLs; answers from any other resolver,
+// the client's fallback included, are kept for maxTTL. Answers that a name
+// doesn't exist are kept too, but failed lookups never are.
+type dnsCache struct {
+	next     Resolver
+	client   *DNSClient // next, if it is one
+	maxTTL   time.Duration
+	observer DNSCacheObserver
+
+	mu      sync.Mutex
+	entries map[dnsCacheKey]cachedLookup
+	now     func() time.Time
+}
+
+type dnsCacheKey struct {
+	qtype dnsmessage.Type // TypeA stands for LookupHost's A and AAAA both
+	name  string
+}
+
+type cachedLookup struct {
+	answer  dnsAnswer
+	err     error
+	expires time.Time
+}
+
+// newDNSCache returns a cache in front of next, or nil if maxTTL is zero.
+func newDNSCache(next Resolver, maxTTL time.Duration, observer DNSCacheObserver) *dnsCache {
+	if maxTTL <= 0 {
+		return nil
+	}
+	client, _ := next.(*DNSClient)
+	return &dnsCache{next: next, client: client, maxTTL: maxTTL, observer: observer, entries: make(map[dnsCacheKey]cachedLookup), now: time.Now}
+}
+
+func (c *dnsCache) LookupMX(ctx context.Context, name string) ([]*net.MX, error) {
+	answer, err := c.lookup(ctx, dnsmessage.TypeMX, name)
+	mx := make([]*net.MX, 0, len(answer.mx))
+	for _, record := range answer.mx {
+		copied := *record
+		mx = append(mx, &copied)
+	}
+	return mx, err
+}
+
+func (c *dnsCache) LookupTXT(ctx context.Context, name string) ([]string, error) {
+	answer, err := c.lookup(ctx, dnsmessage.TypeTXT, name)
+	return append([]string(nil), answer.txt...), err
+}
+
+func (c *dnsCache) LookupHost(ctx context.Context, host string) ([]string, error) {
+	answer, err := c.lookup(ctx, dnsmessage.TypeA, host)
+	return append([]string(nil), answer.hosts...), err
+}
+
+// lookup answers from the cache when it can, and otherwise asks next and
+// keeps what it says. The answer's slices are shared with the cache.
+func (c *dnsCache) lookup(ctx context.Context, qtype dnsmessage.Type, name string) (dnsAnswer, error) {
+	key := dnsCacheKey{qtype, strings.ToLower(strings.TrimSuffix(name, "."))}
+	c.mu.Lock()
+	cached, ok := c.entries[key]
+	if ok && !c.now().Before(cached.expires) {
+		delete(c.entries, key)
+		ok = false
+	}
+	c.mu.Unlock()
+	if c.observer != nil {
+		c.observer(ok)
+	}
+	if ok {
+		return cached.answer, cached.err
+	}
+
+	answer, err := c.fetch(ctx, qtype, name)
+	ttl := min(answer.ttl, c.maxTTL)
+	if (err == nil || IsNotFound(err)) && ctx.Err() == nil && ttl > 0 {
+		c.mu.Lock()
+		c.entries[key] = cachedLookup{answer: answer, err: err, expires: c.now().Add(ttl)}
+		c.mu.Unlock()
+	}
+	return answer, err
+}
+
+// fetch asks next for name's records of qtype.
+func (c *dnsCache) fetch(ctx context.Context, qtype dnsmessage.Type, name string) (dnsAnswer, error) {
+	if c.client != nil {
+		if qtype == dnsmessage.TypeA {
+			return c.client.resolve(ctx, name, dnsmessage.TypeA, dnsmessage.TypeAAAA)
+		}
+		return c.client.resolve(ctx, name, qtype)
+	}
+	return lookupAnswer(ctx, c.next, name, qtype)
+}
+
+// lookupAnswer asks resolver for name's records of qtype, where TypeA
+// stands for LookupHost. Resolver doesn't say how long they may be kept.
+func lookupAnswer(ctx context.Context, resolver Resolver, name string, qtype dnsmessage.Type) (dnsAnswer, error) {
+	answer := dnsAnswer{ttl: ttlUnknown}
+	var err error
+	switch qtype {
+	case dnsmessage.TypeMX:
+		answer.mx, err = resolver.LookupMX(ctx, name)
+	case dnsmessage.TypeTXT:
+		answer.txt, err = resolver.LookupTXT(ctx, name)
+	default:
+		answer.hosts, err = resolver.LookupHost(ctx, name)
+	}
+	return answer, err
+}
+
+// sweep drops expired answers and returns how many.
+func (c *dnsCache) sweep(now time.Time) int {
+	if c == nil {
+		return 0
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	removed := 0
+	for key, cached := range c.entries {
+		if !now.Before(cached.expires) {
+			delete(c.entries, key)
+			removed++
+		}
+	}
+	return removed
+}
+
+// SweepDNSCache drops expired DNS answers and returns how many were
+// removed.
+func (s *Service) SweepDNSCache(now time.Time) int { return s.dnsCache.sweep(now) }
+
+// DNSCacheEnabled reports whether Config.DNS.CacheMaxTTL turned the DNS
+// cache on.
+func (s *Service) DNSCacheEnabled() bool { return s.dnsCache != nil }
@@ -0,0 +1,101 @@
+package verify
+
+import (
+	"context"
+	"net"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"email-verifier/pkg/verify/verifytest"
+)
+
+// TestDNSCache tests that answers and not-found answers are reused until they expire, while failed lookups are asked again
+func TestDNSCache(t *testing.T) {
+	fake := &countingResolver{Resolver: verifytest.NewResolver()}
+	fake.MX["mail.mock"] = []*net.MX{{Host: "mx.mail.mock.", Pref: 10}}
+	fake.Err["broken.mock"] = &net.DNSError{Err: "server misbehaving", Name: "broken.mock", IsTemporary: true}
+	var hits, misses int
+	cache := newDNSCache(fake, time.Minute, func(hit bool) {
+		if hit {
+			hits++
+		} else {
+			misses++
+		}
+	})
+	now := time.Unix(1700000000, 0)
+	cache.now = func() time.Time { return now }
+	ctx := context.Background()
+
+	for _, name := range []string{"mail.mock", "Mail.mock.", "missing.mock", "missing.mock", "broken.mock", "broken.mock"} {
+		cache.LookupMX(ctx, name)
+	}
+	if n := fake.mxLookups.Load(); n != 4 {
+		t.Errorf("Expected mail.mock and missing.mock looked up once and broken.mock twice, got %d lookups", n)
+	}
+	if hits != 2 || misses != 4 {
+		t.Errorf("Expected 2 hits and 4 misses, got %d and %d", hits, misses)
+	}
+	if _, err := cache.LookupMX(ctx, "missing.mock"); !IsNotFound(err) {
+		t.Errorf("Expected the cached not-found answer, got %v", err)
+	}
+
+	mx, _ := cache.LookupMX(ctx, "mail.mock")
+	mx[0].Host = "changed."
+	if mx, _ := cache.LookupMX(ctx, "mail.mock"); mx[0].Host != "mx.mail.mock." {
+		t.Errorf("Expected the cached answer untouched by callers, got %s", mx[0].Host)
+	}
+
+	now = now.Add(time.Minute)
+	if removed := cache.sweep(now); removed != 2 {
+		t.Errorf("Expected both answers swept, got %d", removed)
+	}
+	lookups := fake.mxLookups.Load()
+	cache.LookupMX(ctx, "mail.mock")
+	if n := fake.mxLookups.Load() - lookups; n != 1 {
+		t.Errorf("Expected an expired answer to be looked up again, got %d lookups", n)
+	}
+	if newDNSCache(fake, 0, nil) != nil {
+		t.Error("Expected no cache without a max TTL")
+	}
+}
+
+// TestDNSCacheTTL tests that answers from a DNSClient are kept for their own TTL, capped at the max
+func TestDNSCacheTTL(t *testing.T) {
+	client := NewDNSClient([]string{startDNSServer(t, testZone)}, time.Second)
+	cache := newDNSCache(client, 100*time.Second, nil)
+	now := time.Unix(1700000000, 0)
+	cache.now = func() time.Time { return now }
+	ctx := context.Background()
+
+	cache.LookupMX(ctx, "mail.mock")    // 120s, capped at 100s
+	cache.LookupHost(ctx, "mail.mock")  // A for 60s, AAAA for 30s
+	cache.LookupMX(ctx, "missing.mock") // SOA minimum of 45s
+	cache.LookupMX(ctx, "broken.mock")  // never kept
+	for _, tt := range []struct {
+		after time.Duration
+		left  int
+	}{{29 * time.Second, 3}, {30 * time.Second, 2}, {45 * time.Second, 1}, {100 * time.Second, 0}} {
+		if cache.sweep(now.Add(tt.after)); len(cache.entries) != tt.left {
+			t.Errorf("Expected %d answers kept after %v, got %d", tt.left, tt.after, len(cache.entries))
+		}
+	}
+}
+
+// TestServiceDNSCache tests that the Service puts the cache in front of its resolver
+func TestServiceDNSCache(t *testing.T) {
+	fake := &countingResolver{Resolver: verifytest.NewResolver()}
+	fake.MX["mail.mock"] = []*net.MX{{Host: "mx.mail.mock.", Pref: 10}}
+	var hits atomic.Int64
+	s := newTestService(Config{Resolver: fake, DNS: DNSConfig{CacheMaxTTL: time.Minute}, DNSCacheObserver: func(hit bool) {
+		if hit {
+			hits.Add(1)
+		}
+	}})
+	opts := Options{Checks: MustParseChecks(CheckMX)}
+	s.Verify("jane@mail.mock", opts)
+	s.Verify("john@mail.mock", opts)
+	if n := fake.mxLookups.Load(); n != 1 || hits.Load() != 1 || !s.DNSCacheEnabled() {
+		t.Errorf("Expected one MX lookup and one cache hit, got %d and %d", n, hits.Load())
+	}
+}
@@ -0,0 +1,324 @@
+package verify
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"io"
+	"math"
+	"math/rand"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+
+	"golang.org/x/net/dns/dnsmessage"
+)
+
+// dnsQueryTimeout bounds one query to one server when neither the client
+// nor the context sets a limit.
+const dnsQueryTimeout = 5 * time.Second
+
+// DNSClient is a Resolver that sends its queries to Servers (host:port),
+// trying them in order until one answers, or to the DNS-over-HTTPS
+// endpoint DoHURL, instead of going through the system's resolver. Unlike *net.Resolver it knows how long each answer
+// may be cached, which the DNS cache honors. Errors are *net.DNSError
+// values, as net's: a timeout has IsTimeout, a name that doesn't exist
+// IsNotFound, and SERVFAIL and REFUSED answers say so in Err.
+type DNSClient struct {
+	Servers []string
+	// DoHURL, if set, is an RFC 8484 endpoint such as
+	// https://cloudflare-dns.com/dns-query that queries go to in place of
+	// Servers, with DoHMethod: http.MethodGet (the default) or
+	// http.MethodPost. HTTPClient sends them; one with timeouts of its own
+	// that doesn't follow redirects if nil.
+	DoHURL     string
+	DoHMethod  string
+	HTTPClient *http.Client
+	// Fallback, if set, answers lookups that failed, though not those
+	// that found the name doesn't exist.
+	Fallback Resolver
+	// Timeout bounds each query to a server; 5s if zero and the context
+	// has no deadline.
+	Timeout time.Duration
+}
+
+// Errors a DNSClient reports in net.DNSError.Err, worded as net's.
+const (
+	dnsErrNoSuchHost  = "no such host"
+	dnsErrServFail    = "server misbehaving"
+	dnsErrRefused     = "server refused the query"
+	dnsErrTimeout     = "i/o timeout"
+	dnsErrBadAnswer   = "cannot unmarshal DNS message"
+	dnsErrAnswerRcode = "server answered with an error"
+)
+
+// ttlUnknown stands for the TTL of answers from resolvers that don't say,
+// which the DNS cache keeps for its maximum.
+const ttlUnknown = time.Duration(math.MaxInt64)
+
+// defaultNegativeTTL is how long a not-found answer without an SOA record
+// may be kept.
+const defaultNegativeTTL = 5 * time.Minute
+
+// NewDNSClient returns a client for servers, each a host or host:port (53
+// if no port is given), whose queries time out after timeout.
+func NewDNSClient(servers []string, timeout time.Duration) *DNSClient {
+	c := &DNSClient{Timeout: timeout}
+	for _, server := range servers {
+		server = strings.TrimSpace(server)
+		if server == "" {
+			continue
+		}
+		if _, _, err := net.SplitHostPort(server); err != nil {
+			server = net.JoinHostPort(strings.Trim(server, "[]"), "53")
+		}
+		c.Servers = append(c.Servers, server)
+	}
+	return c
+}
+
+// dnsAnswer is what a lookup found and how long it may be kept.
+type dnsAnswer struct {
+	mx    []*net.MX
+	txt   []string
+	hosts []string
+	ttl   time.Duration
+}
+
+func (c *DNSClient) LookupMX(ctx context.Context, name string) ([]*net.MX, error) {
+	answer, err := c.resolve(ctx, name, dnsmessage.TypeMX)
+	return answer.mx, err
+}
+
+func (c *DNSClient) LookupTXT(ctx context.Context, name string) ([]string, error) {
+	answer, err := c.resolve(ctx, name, dnsmessage.TypeTXT)
+	return answer.txt, err
+}
+
+func (c *DNSClient) LookupHost(ctx context.Context, host string) ([]string, error) {
+	answer, err := c.resolve(ctx, host, dnsmessage.TypeA, dnsmessage.TypeAAAA)
+	return answer.hosts, err
+}
+
+// resolve looks name up for each of types, combining the answers. Either
+// type answering is enough; otherwise the first error is returned. As
+// with *net.Resolver, a name with no records of the types is reported as
+// not found. The answer's TTL is the shortest of the answers it combines,
+// not-found ones included, whose TTL comes from the zone's SOA.
+func (c *DNSClient) resolve(ctx context.Context, name string, types ...dnsmessage.Type) (dnsAnswer, error) {
+	var combined dnsAnswer
+	var firstErr error
+	found := false
+	for i, qtype := range types {
+		answer, err := c.query(ctx, name, qtype)
+		if i == 0 || answer.ttl < combined.ttl {
+			combined.ttl = answer.ttl
+		}
+		if err != nil {
+			if firstErr == nil {
+				firstErr = err
+			}
+			continue
+		}
+		found = true
+		combined.mx = append(combined.mx, answer.mx...)
+		combined.txt = append(combined.txt, answer.txt...)
+		combined.hosts = append(combined.hosts, answer.hosts...)
+	}
+	if found {
+		return combined, nil
+	}
+	if c.Fallback != nil && !IsNotFound(firstErr) {
+		return lookupAnswer(ctx, c.Fallback, name, types[0])
+	}
+	return combined, firstErr
+}
+
+// query asks each server in turn for name's records of qtype, moving on
+// when one fails or times out. A server saying the name doesn't exist is
+// an answer, so the rest aren't asked.
+func (c *DNSClient) query(ctx context.Context, name string, qtype dnsmessage.Type) (dnsAnswer, error) {
+	fqdn := name
+	if !strings.HasSuffix(fqdn, ".") {
+		fqdn += "."
+	}
+	question, err := dnsmessage.NewName(fqdn)
+	if err != nil {
+		return dnsAnswer{}, &net.DNSError{Err: dnsErrNoSuchHost, Name: name, IsNotFound: true}
+	}
+	servers := c.Servers
+	if c.DoHURL != "" {
+		servers = []string{c.DoHURL}
+	}
+	if len(servers) == 0 {
+		return dnsAnswer{}, &net.DNSError{Err: "no DNS servers configured", Name: name}
+	}
+	var lastErr error
+	for _, server := range servers {
+		answer, err := c.exchange(ctx, server, question, qtype)
+		if err == nil {
+			return answer, nil
+		}
+		var dnsErr *net.DNSError
+		if errors.As(err, &dnsErr) {
+			dnsErr.Name = name
+			if dnsErr.IsNotFound {
+				return answer, err
+			}
+		}
+		lastErr = err
+		if ctx.Err() != nil {
+			break
+		}
+	}
+	return dnsAnswer{}, lastErr
+}
+
+// exchange sends one query to server, over DNS-over-HTTPS if the client
+// uses it and otherwise over UDP, then again over TCP if the answer was
+// truncated, and reads the answer.
+func (c *DNSClient) exchange(ctx context.Context, server string, name dnsmessage.Name, qtype dnsmessage.Type) (dnsAnswer, error) {
+	timeout := c.Timeout
+	if _, ok := ctx.Deadline(); !ok && timeout <= 0 {
+		timeout = dnsQueryTimeout
+	}
+	if timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+	id := uint16(rand.Intn(1 << 16))
+	if c.DoHURL != "" {
+		id = 0 // as RFC 8484 asks, so HTTP caches can share answers
+	}
+	query := dnsmessage.Message{
+		Header:    dnsmessage.Header{ID: id, RecursionDesired: true},
+		Questions: []dnsmessage.Question{{Name: name, Type: qtype, Class: dnsmessage.ClassINET}},
+	}
+	var opt dnsmessage.ResourceHeader
+	opt.SetEDNS0(4096, dnsmessage.RCodeSuccess, false)
+	query.Additionals = []dnsmessage.Resource{{Header: opt, Body: &dnsmessage.OPTResource{}}}
+	packed, err := query.Pack()
+	if err != nil {
+		return dnsAnswer{}, &net.DNSError{Err: err.Error(), Server: server}
+	}
+
+	var reply *dnsmessage.Message
+	if c.DoHURL != "" {
+		reply, err = c.dohRoundTrip(ctx, packed)
+	} else if reply, err = roundTrip(ctx, "udp", server, packed); err == nil && reply.Header.Truncated {
+		reply, err = roundTrip(ctx, "tcp", server, packed)
+	}
+	if err != nil {
+		dnsErr := &net.DNSError{Err: err.Error(), Server: server}
+		var netErr net.Error
+		if errors.As(err, &netErr) && netErr.Timeout() || errors.Is(err, context.DeadlineExceeded) {
+			dnsErr.Err, dnsErr.IsTimeout, dnsErr.IsTemporary = dnsErrTimeout, true, true
+		}
+		return dnsAnswer{}, dnsErr
+	}
+	if !reply.Header.Response || reply.Header.ID != id || len(reply.Questions) != 1 || !strings.EqualFold(reply.Questions[0].Name.String(), name.String()) {
+		return dnsAnswer{}, &net.DNSError{Err: dnsErrBadAnswer, Server: server}
+	}
+	switch reply.Header.RCode {
+	case dnsmessage.RCodeSuccess:
+	case dnsmessage.RCodeNameError:
+		return dnsAnswer{ttl: negativeTTL(reply)}, &net.DNSError{Err: dnsErrNoSuchHost, Server: server, IsNotFound: true}
+	case dnsmessage.RCodeServerFailure:
+		return dnsAnswer{}, &net.DNSError{Err: dnsErrServFail, Server: server, IsTemporary: true}
+	case dnsmessage.RCodeRefused:
+		return dnsAnswer{}, &net.DNSError{Err: dnsErrRefused, Server: server}
+	default:
+		return dnsAnswer{}, &net.DNSError{Err: dnsErrAnswerRcode, Server: server}
+	}
+
+	var answer dnsAnswer
+	ttl := uint32(0)
+	found := false
+	for _, record := range reply.Answers {
+		if record.Header.Type != qtype {
+			continue
+		}
+		switch body := record.Body.(type) {
+		case *dnsmessage.MXResource:
+			answer.mx = append(answer.mx, &net.MX{Host: body.MX.String(), Pref: body.Pref})
+		case *dnsmessage.TXTResource:
+			answer.txt = append(answer.txt, strings.Join(body.TXT, ""))
+		case *dnsmessage.AResource:
+			answer.hosts = append(answer.hosts, net.IP(body.A[:]).String())
+		case *dnsmessage.AAAAResource:
+			answer.hosts = append(answer.hosts, net.IP(body.AAAA[:]).String())
+		default:
+			continue
+		}
+		if !found || record.Header.TTL < ttl {
+			ttl = record.Header.TTL
+		}
+		found = true
+	}
+	if !found {
+		// No records of the type, which net reports as not found too
+		return dnsAnswer{ttl: negativeTTL(reply)}, &net.DNSError{Err: dnsErrNoSuchHost, Server: server, IsNotFound: true}
+	}
+	answer.ttl = time.Duration(ttl) * time.Second
+	return answer, nil
+}
+
+// negativeTTL is how long a not-found answer may be kept: the SOA's
+// minimum, capped by the SOA record's own TTL, as RFC 2308 has it.
+func negativeTTL(reply *dnsmessage.Message) time.Duration {
+	for _, record := range reply.Authorities {
+		if soa, ok := record.Body.(*dnsmessage.SOAResource); ok {
+			return time.Duration(min(soa.MinTTL, record.Header.TTL)) * time.Second
+		}
+	}
+	return defaultNegativeTTL
+}
+
+// roundTrip sends packed to server over network and parses the reply,
+// within ctx.
+func roundTrip(ctx context.Context, network, server string, packed []byte) (*dnsmessage.Message, error) {
+	var d net.Dialer
+	conn, err := d.DialContext(ctx, network, server)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(deadline)
+	}
+
+	var buf []byte
+	if network == "tcp" {
+		framed := make([]byte, 2+len(packed))
+		binary.BigEndian.PutUint16(framed, uint16(len(packed)))
+		copy(framed[2:], packed)
+		if _, err := conn.Write(framed); err != nil {
+			return nil, err
+		}
+		var length [2]byte
+		if _, err := io.ReadFull(conn, length[:]); err != nil {
+			return nil, err
+		}
+		buf = make([]byte, binary.BigEndian.Uint16(length[:]))
+		if _, err := io.ReadFull(conn, buf); err != nil {
+			return nil, err
+		}
+	} else {
+		if _, err := conn.Write(packed); err != nil {
+			return nil, err
+		}
+		buf = make([]byte, 4096)
+		n, err := conn.Read(buf)
+		if err != nil {
+			return nil, err
+		}
+		buf = buf[:n]
+	}
+	var reply dnsmessage.Message
+	if err := reply.Unpack(buf); err != nil {
+		return nil, err
+	}
+	return &reply, nil
+}
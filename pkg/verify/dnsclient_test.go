@@ -0,0 +1,193 @@
+package verify
+
+import (
+	"context"
+	"encoding/binary"
+	"io"
+	"net"
+	"reflect"
+	"sort"
+	"testing"
+	"time"
+
+	"golang.org/x/net/dns/dnsmessage"
+)
+
+// dnsHandler answers one question, or returns nil to send nothing back
+type dnsHandler func(q dnsmessage.Question, tcp bool) *dnsmessage.Message
+
+// startDNSServer serves handler over UDP and TCP on one local port and returns its address
+func startDNSServer(t *testing.T, handler dnsHandler) string {
+	t.Helper()
+	udp, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	tcp, err := net.Listen("tcp", udp.LocalAddr().String())
+	if err != nil {
+		udp.Close()
+		t.Skipf("Expected the TCP port to be free too: %v", err)
+	}
+	t.Cleanup(func() { udp.Close(); tcp.Close() })
+
+	answer := func(query []byte, isTCP bool) []byte {
+		var msg dnsmessage.Message
+		if err := msg.Unpack(query); err != nil || len(msg.Questions) != 1 {
+			return nil
+		}
+		reply := handler(msg.Questions[0], isTCP)
+		if reply == nil {
+			return nil
+		}
+		reply.Header.ID, reply.Header.Response = msg.Header.ID, true
+		reply.Questions = msg.Questions
+		packed, _ := reply.Pack()
+		return packed
+	}
+	go func() {
+		buf := make([]byte, 4096)
+		for {
+			n, addr, err := udp.ReadFrom(buf)
+			if err != nil {
+				return
+			}
+			if packed := answer(buf[:n], false); packed != nil {
+				udp.WriteTo(packed, addr)
+			}
+		}
+	}()
+	go func() {
+		for {
+			conn, err := tcp.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				var length [2]byte
+				if _, err := io.ReadFull(conn, length[:]); err != nil {
+					return
+				}
+				query := make([]byte, binary.BigEndian.Uint16(length[:]))
+				if _, err := io.ReadFull(conn, query); err != nil {
+					return
+				}
+				if packed := answer(query, true); packed != nil {
+					framed := binary.BigEndian.AppendUint16(nil, uint16(len(packed)))
+					conn.Write(append(framed, packed...))
+				}
+			}()
+		}
+	}()
+	return udp.LocalAddr().String()
+}
+
+func dnsHeader(q dnsmessage.Question, ttl uint32) dnsmessage.ResourceHeader {
+	return dnsmessage.ResourceHeader{Name: q.Name, Type: q.Type, Class: dnsmessage.ClassINET, TTL: ttl}
+}
+
+// testZone answers for a handful of names the way a real server would
+func testZone(q dnsmessage.Question, tcp bool) *dnsmessage.Message {
+	reply := &dnsmessage.Message{}
+	switch name := q.Name.String(); {
+	case name == "mail.mock." && q.Type == dnsmessage.TypeMX:
+		reply.Answers = []dnsmessage.Resource{
+			{Header: dnsHeader(q, 300), Body: &dnsmessage.MXResource{Pref: 10, MX: dnsmessage.MustNewName("mx1.mail.mock.")}},
+			{Header: dnsHeader(q, 120), Body: &dnsmessage.MXResource{Pref: 20, MX: dnsmessage.MustNewName("mx2.mail.mock.")}},
+		}
+	case name == "mail.mock." && q.Type == dnsmessage.TypeTXT:
+		reply.Answers = []dnsmessage.Resource{{Header: dnsHeader(q, 60), Body: &dnsmessage.TXTResource{TXT: []string{"v=spf1 ", "-all"}}}}
+	case name == "mail.mock." && q.Type == dnsmessage.TypeA:
+		reply.Answers = []dnsmessage.Resource{{Header: dnsHeader(q, 60), Body: &dnsmessage.AResource{A: [4]byte{192, 0, 2, 1}}}}
+	case name == "mail.mock." && q.Type == dnsmessage.TypeAAAA:
+		reply.Answers = []dnsmessage.Resource{{Header: dnsHeader(q, 30), Body: &dnsmessage.AAAAResource{AAAA: [16]byte{0x20, 0x01, 0x0d, 0xb8, 15: 1}}}}
+	case name == "big.mock." && !tcp:
+		reply.Header.Truncated = true
+	case name == "big.mock.":
+		reply.Answers = []dnsmessage.Resource{{Header: dnsHeader(q, 60), Body: &dnsmessage.MXResource{Pref: 10, MX: dnsmessage.MustNewName("mx.big.mock.")}}}
+	case name == "broken.mock.":
+		reply.Header.RCode = dnsmessage.RCodeServerFailure
+	case name == "private.mock.":
+		reply.Header.RCode = dnsmessage.RCodeRefused
+	case name == "slow.mock.":
+		return nil
+	default:
+		reply.Header.RCode = dnsmessage.RCodeNameError
+		soa := dnsmessage.MustNewName("mock.")
+		reply.Authorities = []dnsmessage.Resource{{
+			Header: dnsmessage.ResourceHeader{Name: soa, Type: dnsmessage.TypeSOA, Class: dnsmessage.ClassINET, TTL: 900},
+			Body:   &dnsmessage.SOAResource{NS: soa, MBox: soa, MinTTL: 45},
+		}}
+	}
+	return reply
+}
+
+// TestDNSClient tests MX, TXT and host lookups against a server, with the TTLs the cache keeps answers for
+func TestDNSClient(t *testing.T) {
+	client := NewDNSClient([]string{startDNSServer(t, testZone)}, time.Second)
+	ctx := context.Background()
+
+	answer, err := client.resolve(ctx, "mail.mock", dnsmessage.TypeMX)
+	if err != nil || len(answer.mx) != 2 || answer.mx[0].Host != "mx1.mail.mock." || answer.mx[1].Pref != 20 {
+		t.Fatalf("Expected two MX hosts, got %v (err %v)", answer.mx, err)
+	}
+	if answer.ttl != 120*time.Second {
+		t.Errorf("Expected the shortest TTL, got %v", answer.ttl)
+	}
+	if txt, err := client.LookupTXT(ctx, "mail.mock"); err != nil || !reflect.DeepEqual(txt, []string{"v=spf1 -all"}) {
+		t.Errorf("Expected the TXT strings joined, got %q (err %v)", txt, err)
+	}
+	hosts, err := client.LookupHost(ctx, "mail.mock")
+	sort.Strings(hosts)
+	if err != nil || !reflect.DeepEqual(hosts, []string{"192.0.2.1", "2001:db8::1"}) {
+		t.Errorf("Expected the A and AAAA addresses, got %v (err %v)", hosts, err)
+	}
+	if mx, err := client.LookupMX(ctx, "big.mock"); err != nil || len(mx) != 1 {
+		t.Errorf("Expected a truncated answer to be asked again over TCP, got %v (err %v)", mx, err)
+	}
+
+	answer, err = client.resolve(ctx, "missing.mock", dnsmessage.TypeMX)
+	if !IsNotFound(err) || answer.ttl != 45*time.Second {
+		t.Errorf("Expected not found for the SOA minimum, got %v for %v", err, answer.ttl)
+	}
+	if _, err := client.LookupHost(ctx, "mail.mock."); err != nil {
+		t.Errorf("Expected a trailing dot to be accepted, got %v", err)
+	}
+}
+
+// TestDNSClientErrors tests that NXDOMAIN, SERVFAIL, REFUSED and timeouts come back as distinct errors
+func TestDNSClientErrors(t *testing.T) {
+	client := NewDNSClient([]string{startDNSServer(t, testZone)}, 50*time.Millisecond)
+	ctx := context.Background()
+
+	tests := []struct {
+		name string
+		kind string
+	}{
+		{"missing.mock", DNSErrorNXDomain},
+		{"broken.mock", DNSErrorServFail},
+		{"private.mock", DNSErrorRefused},
+		{"slow.mock", DNSErrorTimeout},
+	}
+	for _, tt := range tests {
+		_, err := client.LookupMX(ctx, tt.name)
+		if kind := DNSErrorKind(err); kind != tt.kind {
+			t.Errorf("Expected %s for %s, got %s (%v)", tt.kind, tt.name, kind, err)
+		}
+		if dnsErr, ok := err.(*net.DNSError); !ok || dnsErr.Name != tt.name {
+			t.Errorf("Expected a *net.DNSError naming %s, got %v", tt.name, err)
+		}
+	}
+}
+
+// TestDNSClientFailover tests that a server that doesn't answer is passed over for the next
+func TestDNSClientFailover(t *testing.T) {
+	silent := startDNSServer(t, func(dnsmessage.Question, bool) *dnsmessage.Message { return nil })
+	client := NewDNSClient([]string{silent, startDNSServer(t, testZone)}, 50*time.Millisecond)
+	if mx, err := client.LookupMX(context.Background(), "mail.mock"); err != nil || len(mx) != 2 {
+		t.Errorf("Expected the second server to answer, got %v (err %v)", mx, err)
+	}
+	if servers := NewDNSClient([]string{"192.0.2.53", " [2001:db8::53]:5353 ", ""}, 0).Servers; !reflect.DeepEqual(servers, []string{"192.0.2.53:53", "[2001:db8::53]:5353"}) {
+		t.Errorf("Expected port 53 by default, got %v", servers)
+	}
+}
@@ -0,0 +1,108 @@
+package verify
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net"
+	"net/http"
+	"net/url"
+	"time"
+
+	"golang.org/x/net/dns/dnsmessage"
+)
+
+// dohMediaType is the content type of RFC 8484 queries and answers.
+const dohMediaType = "application/dns-message"
+
+// dohMaxAnswer is the largest DNS message there is.
+const dohMaxAnswer = 65535
+
+// dohHTTPClient sends DNS-over-HTTPS queries for clients without an
+// HTTPClient of their own. Each query is also bounded by its context.
+var dohHTTPClient = &http.Client{
+	Transport: &http.Transport{
+		Proxy:                 http.ProxyFromEnvironment,
+		DialContext:           (&net.Dialer{Timeout: 5 * time.Second, KeepAlive: 30 * time.Second}).DialContext,
+		ForceAttemptHTTP2:     true,
+		TLSHandshakeTimeout:   5 * time.Second,
+		ResponseHeaderTimeout: 5 * time.Second,
+		IdleConnTimeout:       90 * time.Second,
+		MaxIdleConnsPerHost:   16,
+	},
+	Timeout: 10 * time.Second,
+	// A redirect is answered as the error it is rather than followed
+	CheckRedirect: func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse },
+}
+
+// ParseDoHURL checks that raw is an https URL a DNS-over-HTTPS endpoint
+// could be at.
+func ParseDoHURL(raw string) error {
+	u, err := url.Parse(raw)
+	if err != nil {
+		return err
+	}
+	if u.Scheme != "https" || u.Host == "" {
+		return fmt.Errorf("DoH URL %q must be an https URL", raw)
+	}
+	return nil
+}
+
+// dohRoundTrip sends packed to c.DoHURL as RFC 8484 says: in the dns
+// query parameter of a GET, or as the body of a POST. It only accepts a
+// 200 answer of the DNS message type.
+func (c *DNSClient) dohRoundTrip(ctx context.Context, packed []byte) (*dnsmessage.Message, error) {
+	var req *http.Request
+	var err error
+	if c.DoHMethod == http.MethodPost {
+		req, err = http.NewRequestWithContext(ctx, http.MethodPost, c.DoHURL, bytes.NewReader(packed))
+		if err == nil {
+			req.Header.Set("Content-Type", dohMediaType)
+		}
+	} else {
+		var u *url.URL
+		if u, err = url.Parse(c.DoHURL); err != nil {
+			return nil, err
+		}
+		query := u.Query()
+		query.Set("dns", base64.RawURLEncoding.EncodeToString(packed))
+		u.RawQuery = query.Encode()
+		req, err = http.NewRequestWithContext(ctx, http.MethodGet, u.String(), nil)
+	}
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", dohMediaType)
+
+	client := c.HTTPClient
+	if client == nil {
+		client = dohHTTPClient
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("DoH server answered %s", resp.Status)
+	}
+	if mediaType, _, err := mime.ParseMediaType(resp.Header.Get("Content-Type")); err != nil || mediaType != dohMediaType {
+		return nil, fmt.Errorf("DoH server answered with content type %q", resp.Header.Get("Content-Type"))
+	}
+	body, err := io.ReadAll(io.LimitReader(resp.Body, dohMaxAnswer+1))
+	if err != nil {
+		return nil, err
+	}
+	if len(body) > dohMaxAnswer {
+		return nil, errors.New("DoH answer is longer than a DNS message can be")
+	}
+	var reply dnsmessage.Message
+	if err := reply.Unpack(body); err != nil {
+		return nil, err
+	}
+	return &reply, nil
+}
@@ -0,0 +1,135 @@
+package verify
+
+import (
+	"context"
+	"encoding/base64"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"golang.org/x/net/dns/dnsmessage"
+
+	"email-verifier/pkg/verify/verifytest"
+)
+
+// startDoHServer serves testZone over RFC 8484 GET and POST, checking each query is well formed
+func startDoHServer(t *testing.T) *httptest.Server {
+	t.Helper()
+	srv := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var query []byte
+		var err error
+		switch r.Method {
+		case http.MethodGet:
+			query, err = base64.RawURLEncoding.DecodeString(r.URL.Query().Get("dns"))
+		case http.MethodPost:
+			if r.Header.Get("Content-Type") != dohMediaType {
+				http.Error(w, "bad content type", http.StatusUnsupportedMediaType)
+				return
+			}
+			query, err = io.ReadAll(r.Body)
+		}
+		var msg dnsmessage.Message
+		if err != nil || r.Header.Get("Accept") != dohMediaType || msg.Unpack(query) != nil || msg.Header.ID != 0 || len(msg.Questions) != 1 {
+			http.Error(w, "bad query", http.StatusBadRequest)
+			return
+		}
+		switch msg.Questions[0].Name.String() {
+		case "slow.mock.":
+			time.Sleep(200 * time.Millisecond)
+			return
+		case "html.mock.":
+			w.Header().Set("Content-Type", "text/html")
+			w.Write([]byte("<html>blocked</html>"))
+			return
+		case "down.mock.":
+			http.Error(w, "unavailable", http.StatusServiceUnavailable)
+			return
+		case "moved.mock.":
+			http.Redirect(w, r, "https://elsewhere.example/dns-query", http.StatusFound)
+			return
+		}
+		reply := testZone(msg.Questions[0], true)
+		reply.Header.ID, reply.Header.Response = msg.Header.ID, true
+		reply.Questions = msg.Questions
+		packed, _ := reply.Pack()
+		w.Header().Set("Content-Type", dohMediaType)
+		w.Write(packed)
+	}))
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+// TestDoHClient tests MX and TXT lookups over GET and POST, and that answers carry their TTLs
+func TestDoHClient(t *testing.T) {
+	srv := startDoHServer(t)
+	for _, method := range []string{"", http.MethodPost} {
+		client := &DNSClient{DoHURL: srv.URL + "/dns-query", DoHMethod: method, HTTPClient: srv.Client(), Timeout: time.Second}
+		ctx := context.Background()
+		answer, err := client.resolve(ctx, "mail.mock", dnsmessage.TypeMX)
+		if err != nil || len(answer.mx) != 2 || answer.ttl != 120*time.Second {
+			t.Errorf("Expected two MX hosts for 120s over %q, got %v for %v (err %v)", method, answer.mx, answer.ttl, err)
+		}
+		if txt, err := client.LookupTXT(ctx, "mail.mock"); err != nil || len(txt) != 1 || txt[0] != "v=spf1 -all" {
+			t.Errorf("Expected the TXT record over %q, got %q (err %v)", method, txt, err)
+		}
+		if _, err := client.LookupMX(ctx, "missing.mock"); !IsNotFound(err) {
+			t.Errorf("Expected not found over %q, got %v", method, err)
+		}
+	}
+}
+
+// TestDoHClientErrors tests that answers that aren't DNS messages fail the lookup, and slow ones time out
+func TestDoHClientErrors(t *testing.T) {
+	srv := startDoHServer(t)
+	client := &DNSClient{DoHURL: srv.URL, HTTPClient: srv.Client(), Timeout: 50 * time.Millisecond}
+	tests := []struct {
+		name string
+		kind string
+	}{
+		{"html.mock", DNSErrorOther},
+		{"down.mock", DNSErrorOther},
+		{"moved.mock", DNSErrorOther},
+		{"broken.mock", DNSErrorServFail},
+		{"slow.mock", DNSErrorTimeout},
+	}
+	for _, tt := range tests {
+		if _, err := client.LookupMX(context.Background(), tt.name); DNSErrorKind(err) != tt.kind {
+			t.Errorf("Expected %s for %s, got %v", tt.kind, tt.name, err)
+		}
+	}
+}
+
+// TestDoHFallback tests that only failed lookups fall back, not those that found the name doesn't exist
+func TestDoHFallback(t *testing.T) {
+	srv := startDoHServer(t)
+	fallback := &countingResolver{Resolver: verifytest.NewResolver()}
+	fallback.MX["down.mock"] = []*net.MX{{Host: "mx.down.mock.", Pref: 10}}
+	fallback.MX["missing.mock"] = []*net.MX{{Host: "wildcard.example.", Pref: 10}}
+	client := &DNSClient{DoHURL: srv.URL, HTTPClient: srv.Client(), Fallback: fallback, Timeout: time.Second}
+	ctx := context.Background()
+
+	if mx, err := client.LookupMX(ctx, "down.mock"); err != nil || len(mx) != 1 || mx[0].Host != "mx.down.mock." {
+		t.Errorf("Expected the fallback's answer, got %v (err %v)", mx, err)
+	}
+	if _, err := client.LookupMX(ctx, "missing.mock"); !IsNotFound(err) || fallback.mxLookups.Load() != 1 {
+		t.Errorf("Expected the DoH server's not found without asking the fallback, got %v after %d fallback lookups", err, fallback.mxLookups.Load())
+	}
+	if answer, _ := client.resolve(ctx, "down.mock", dnsmessage.TypeMX); answer.ttl != ttlUnknown {
+		t.Errorf("Expected the fallback's answer kept for the cache's maximum, got %v", answer.ttl)
+	}
+}
+
+// TestParseDoHURL tests that only https URLs are accepted
+func TestParseDoHURL(t *testing.T) {
+	if err := ParseDoHURL("https://cloudflare-dns.com/dns-query"); err != nil {
+		t.Errorf("Expected the URL to be accepted, got %v", err)
+	}
+	for _, bad := range []string{"http://cloudflare-dns.com/dns-query", "cloudflare-dns.com", "https:///dns-query", "://"} {
+		if err := ParseDoHURL(bad); err == nil {
+			t.Errorf("Expected %q to be rejected", bad)
+		}
+	}
+}
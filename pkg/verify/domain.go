@@ -0,0 +1,70 @@
+package verify
+
+import (
+	"context"
+	"net"
+	"sort"
+	"strings"
+)
+
+// Domain statuses derived from DNS.
+const (
+	DomainNXDomain      = "nxdomain"
+	DomainNoMailService = "no_mail_service"
+	DomainNullMX        = "null_mx"
+	DomainHasMail       = "has_mail"
+	DomainDNSError      = "dns_error"
+)
+
+// MXRecord is one of a domain's mail exchangers. Lower preferences are
+// tried first.
+type MXRecord struct {
+	Host       string `json:"host"`
+	Preference uint16 `json:"preference"`
+}
+
+// mxRecords returns mx's hosts, lowercased and without the trailing dot,
+// by preference. A null MX's "." host is left out.
+func mxRecords(mx []*net.MX) []MXRecord {
+	var records []MXRecord
+	for _, record := range mx {
+		if host := strings.ToLower(strings.TrimSuffix(record.Host, ".")); host != "" {
+			records = append(records, MXRecord{Host: host, Preference: record.Pref})
+		}
+	}
+	sort.SliceStable(records, func(i, j int) bool { return records[i].Preference < records[j].Preference })
+	return records
+}
+
+// classifyDomain works out whether a domain can receive mail, and returns
+// the MX hosts of one that can. A domain without MX records that still
+// resolves to an address is a web-only domain (no_mail_service), which is
+// a different problem from a domain that does not exist at all
+// (nxdomain). An RFC 7505 null MX ("MX 0 .") explicitly declares that the
+// domain accepts no mail.
+func (s *Service) classifyDomain(ctx context.Context, resolver Resolver, domain string) (string, []MXRecord, error) {
+	mx, err := resolver.LookupMX(ctx, domain)
+	if err != nil && !IsNotFound(err) {
+		return DomainDNSError, nil, err
+	}
+
+	if len(mx) == 1 && (mx[0].Host == "." || mx[0].Host == "") {
+		return DomainNullMX, nil, nil
+	}
+	if records := mxRecords(mx); len(records) > 0 {
+		s.polite.noteMX(domain, mx)
+		return DomainHasMail, records, nil
+	}
+
+	hosts, err := resolver.LookupHost(ctx, domain)
+	if err != nil {
+		if IsNotFound(err) {
+			return DomainNXDomain, nil, nil
+		}
+		return DomainDNSError, nil, err
+	}
+	if len(hosts) == 0 {
+		return DomainNXDomain, nil, nil
+	}
+	return DomainNoMailService, nil, nil
+}
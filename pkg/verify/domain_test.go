@@ -0,0 +1,163 @@
+package verify
+
+import (
+	"context"
+	"errors"
+	"net"
+	"reflect"
+	"testing"
+	"time"
+
+	"email-verifier/pkg/verify/verifytest"
+
+	emailverifier "github.com/AfterShip/email-verifier"
+)
+
+// TestClassifyDomain tests each domain status branch with the fake resolver
+func TestClassifyDomain(t *testing.T) {
+	fake := verifytest.NewResolver()
+	fake.MX["mail.mock"] = []*net.MX{{Host: "mx1.mail.mock.", Pref: 10}}
+	fake.MX["nullmx.mock"] = []*net.MX{{Host: ".", Pref: 0}}
+	fake.Hosts["webonly.mock"] = []string{"192.0.2.10"}
+	fake.MX["empty.mock"] = []*net.MX{}
+	fake.Err["broken.mock"] = &net.DNSError{Err: "server misbehaving", Name: "broken.mock", IsTemporary: true}
+	s := newTestService(Config{Resolver: fake})
+
+	testCases := []struct {
+		domain  string
+		status  string
+		wantErr bool
+	}{
+		{"mail.mock", DomainHasMail, false},
+		{"nullmx.mock", DomainNullMX, false},
+		{"webonly.mock", DomainNoMailService, false},
+		{"missing.mock", DomainNXDomain, false},
+		{"empty.mock", DomainNXDomain, false},
+		{"broken.mock", DomainDNSError, true},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.domain, func(t *testing.T) {
+			status, _, err := s.classifyDomain(context.Background(), s.resolver, tc.domain)
+			if status != tc.status {
+				t.Errorf("Expected status %s, got %s", tc.status, status)
+			}
+			if (err != nil) != tc.wantErr {
+				t.Errorf("Expected error=%v, got %v", tc.wantErr, err)
+			}
+		})
+	}
+}
+
+// TestDomainStatusVerdicts tests that domain statuses drive the verdict end to end
+func TestDomainStatusVerdicts(t *testing.T) {
+	fake := verifytest.NewResolver()
+	fake.Hosts["webonly.mock"] = []string{"192.0.2.10"}
+	fake.MX["nullmx.mock"] = []*net.MX{{Host: ".", Pref: 0}}
+	fake.Err["broken.mock"] = errors.New("i/o timeout")
+	s := newTestService(Config{Resolver: fake})
+
+	testCases := []struct {
+		email   string
+		status  string
+		verdict string
+	}{
+		{"user@missing.mock", DomainNXDomain, VerdictUndeliverable},
+		{"user@nullmx.mock", DomainNullMX, VerdictUndeliverable},
+		{"user@webonly.mock", DomainNoMailService, VerdictRisky},
+		{"user@broken.mock", DomainDNSError, VerdictUnknown},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.email, func(t *testing.T) {
+			result := s.Verify(tc.email, Options{Checks: DefaultChecks})
+			if result.DomainStatus != tc.status {
+				t.Errorf("Expected domain status %s, got %s", tc.status, result.DomainStatus)
+			}
+			if result.Verdict != tc.verdict {
+				t.Errorf("Expected verdict %s, got %s", tc.verdict, result.Verdict)
+			}
+			if result.HasMxRecords {
+				t.Errorf("Expected has_mx_records=false for %s", tc.status)
+			}
+		})
+	}
+
+	s = newTestService(Config{Resolver: fake, NoMailServiceVerdict: VerdictUndeliverable})
+	if result := s.Verify("user@webonly.mock", Options{Checks: DefaultChecks}); result.Verdict != VerdictUndeliverable {
+		t.Errorf("Expected configured undeliverable verdict, got %s", result.Verdict)
+	}
+}
+
+// TestMXDetails tests that results list the MX hosts by preference, with or without the domain cache, and tell a null MX and a failed lookup from no records
+func TestMXDetails(t *testing.T) {
+	fake := verifytest.NewResolver()
+	fake.MX["mail.mock"] = []*net.MX{{Host: "MX2.mail.mock.", Pref: 20}, {Host: "mx1.mail.mock.", Pref: 10}}
+	fake.MX["nullmx.mock"] = []*net.MX{{Host: ".", Pref: 0}}
+	fake.Err["broken.mock"] = &net.DNSError{Err: "server misbehaving", Name: "broken.mock", IsTemporary: true}
+	fake.Err["slow.mock"] = &net.DNSError{Err: "i/o timeout", Name: "slow.mock", IsTimeout: true}
+	s := newTestService(Config{Resolver: fake, DomainCacheTTL: time.Hour})
+	opts := Options{Checks: DefaultChecks}
+
+	expected := []MXRecord{{"mx1.mail.mock", 10}, {"mx2.mail.mock", 20}}
+	for _, email := range []string{"jane@mail.mock", "john@mail.mock"} {
+		if result := s.Verify(email, opts); !reflect.DeepEqual(result.MX, expected) || result.NullMX || result.DNSError != "" {
+			t.Errorf("Expected MX hosts %v for %s, got %v", expected, email, result.MX)
+		}
+	}
+
+	result := s.Verify("jane@nullmx.mock", opts)
+	if !result.NullMX || result.Reachable != ReachableNo || len(result.MX) != 0 {
+		t.Errorf("Expected a null MX to make the address unreachable, got null_mx %v, reachable %s, mx %v", result.NullMX, result.Reachable, result.MX)
+	}
+
+	if result := s.Verify("jane@missing.mock", opts); result.DNSError != DNSErrorNXDomain || result.HasMxRecords || result.ErrorCode != "" {
+		t.Errorf("Expected a missing domain to be nxdomain without an error, got %q (%s)", result.DNSError, result.ErrorCode)
+	}
+	if result := s.Verify("jane@broken.mock", opts); result.DNSError != DNSErrorServFail || result.ErrorCode != ErrCodeDNS {
+		t.Errorf("Expected servfail, got %q (%s)", result.DNSError, result.ErrorCode)
+	}
+	if result := s.Verify("jane@slow.mock", opts); result.DNSError != DNSErrorTimeout || result.ErrorCode != ErrCodeDNSTimeout {
+		t.Errorf("Expected timeout, got %q (%s)", result.DNSError, result.ErrorCode)
+	}
+}
+
+// TestMXFallbackA tests that a domain without MX records that resolves to an address is probed at that address, and one that resolves to nothing is not
+func TestMXFallbackA(t *testing.T) {
+	fake := verifytest.NewResolver()
+	fake.MX["mail.mock"] = []*net.MX{{Host: "mx.mail.mock.", Pref: 10}}
+	fake.Hosts["webonly.mock"] = []string{"192.0.2.10"}
+	fake.Hosts["deadweb.mock"] = []string{"192.0.2.11"}
+	smtp := verifytest.NewSMTP()
+	smtp.Mailboxes["jane@mail.mock"] = true
+	smtp.Mailboxes["jane@webonly.mock"] = true
+	smtp.Errors["deadweb.mock"] = &emailverifier.LookupError{Message: emailverifier.ErrServerUnavailable}
+	s := newTestService(Config{Resolver: fake, Prober: smtp.Probe})
+	opts := Options{Checks: MustParseChecks(CheckSMTP)}
+
+	if result := s.Verify("jane@mail.mock", opts); !result.HasMxRecords || result.MXFallbackA || result.Reachable != ReachableYes {
+		t.Errorf("Expected an MX domain probed as usual, got has_mx_records %v, mx_fallback_a %v, reachable %s", result.HasMxRecords, result.MXFallbackA, result.Reachable)
+	}
+
+	result := s.Verify("jane@webonly.mock", opts)
+	if result.HasMxRecords || !result.MXFallbackA || result.DomainStatus != DomainHasMail || result.Reachable != ReachableYes {
+		t.Errorf("Expected an A-only domain probed at its address, got has_mx_records %v, mx_fallback_a %v, status %s, reachable %s", result.HasMxRecords, result.MXFallbackA, result.DomainStatus, result.Reachable)
+	}
+
+	result = s.Verify("jane@deadweb.mock", opts)
+	if !result.MXFallbackA || result.DomainStatus != DomainNoMailService || result.Verdict != VerdictRisky || result.ErrorCode != "" {
+		t.Errorf("Expected an A-only domain nobody answers at to stay no_mail_service, got status %s, verdict %s (%s)", result.DomainStatus, result.Verdict, result.ErrorCode)
+	}
+
+	probes := smtp.Probes()
+	result = s.Verify("jane@missing.mock", opts)
+	if result.MXFallbackA || result.DomainStatus != DomainNXDomain || result.Verdict != VerdictUndeliverable || smtp.Probes() != probes {
+		t.Errorf("Expected a domain with neither MX nor A to stay undeliverable unprobed, got mx_fallback_a %v, status %s, verdict %s", result.MXFallbackA, result.DomainStatus, result.Verdict)
+	}
+
+	s = newTestService(Config{Resolver: fake, Prober: smtp.Probe, MXFallbackDisabled: true})
+	probes = smtp.Probes()
+	if result := s.Verify("jane@webonly.mock", opts); result.MXFallbackA || result.DomainStatus != DomainNoMailService || smtp.Probes() != probes {
+		t.Errorf("Expected no fallback probe when disabled, got mx_fallback_a %v, status %s", result.MXFallbackA, result.DomainStatus)
+	}
+}
@@ -0,0 +1,279 @@
+package verify
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+)
+
+// ErrDomainCacheDisabled is returned by Prewarm when Config.DomainCacheTTL
+// is zero, since there is nowhere to keep what it finds.
+var ErrDomainCacheDisabled = errors.New("domain cache is disabled")
+
+// domainCache keeps the network facts about domains, which are the same for
+// every address there: how the MX lookup classified the domain, with its MX
+// hosts, its SPF and DMARC records and, per
+// SMTP profile, whether it is catch-all. List lookups are in memory and
+// cheap, so they are not cached. Failed lookups are never cached.
+type domainCache struct {
+	mu          sync.Mutex
+	ttl         time.Duration // of statuses; none are kept if zero
+	catchAllTTL time.Duration
+	entries     map[string]*cachedDomain
+	now         func() time.Time
+}
+
+type cachedDomain struct {
+	status        string
+	mx            []MXRecord
+	statusExpires time.Time
+	dns           *DNSRecords
+	dnsChecks     CheckSet // the mail-auth checks dns was looked up for
+	dnsExpires    time.Time
+	catchAll      map[string]cachedCatchAll // by profile
+}
+
+type cachedCatchAll struct {
+	confidence string
+	expires    time.Time
+}
+
+// newDomainCache returns a cache keeping MX classifications for ttl and
+// catch-all statuses for catchAllTTL, or for ttl if that is zero. It is nil
+// if both are zero; a nil cache finds nothing and keeps nothing.
+func newDomainCache(ttl, catchAllTTL time.Duration) *domainCache {
+	if catchAllTTL <= 0 {
+		catchAllTTL = ttl
+	}
+	if ttl <= 0 && catchAllTTL <= 0 {
+		return nil
+	}
+	return &domainCache{ttl: max(ttl, 0), catchAllTTL: catchAllTTL, entries: make(map[string]*cachedDomain), now: time.Now}
+}
+
+// status returns domain's cached classification and MX hosts.
+func (c *domainCache) status(domain string) (string, []MXRecord, bool) {
+	if c == nil {
+		return "", nil, false
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	entry := c.entries[domain]
+	if entry == nil || entry.status == "" || !c.now().Before(entry.statusExpires) {
+		return "", nil, false
+	}
+	return entry.status, entry.mx, true
+}
+
+// dnsRecords returns domain's cached records for the mail-auth checks, if
+// they were all looked up.
+func (c *domainCache) dnsRecords(domain string, checks CheckSet) (*DNSRecords, bool) {
+	if c == nil {
+		return nil, false
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	entry := c.entries[domain]
+	if entry == nil || entry.dns == nil || !c.now().Before(entry.dnsExpires) {
+		return nil, false
+	}
+	for check := range checks {
+		if !entry.dnsChecks.Has(check) {
+			return nil, false
+		}
+	}
+	return entry.dns.only(checks), true
+}
+
+// catchAll returns the catch-all confidence domain was found with under
+// profile.
+func (c *domainCache) catchAll(domain, profile string) (confidence string, ok bool) {
+	if c == nil {
+		return "", false
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	entry := c.entries[domain]
+	if entry == nil {
+		return "", false
+	}
+	cached, ok := entry.catchAll[profile]
+	if !ok || !c.now().Before(cached.expires) {
+		return "", false
+	}
+	return cached.confidence, true
+}
+
+// entry returns domain's entry, creating it. It must be called with the
+// lock held.
+func (c *domainCache) entry(domain string) *cachedDomain {
+	entry := c.entries[domain]
+	if entry == nil {
+		entry = &cachedDomain{catchAll: make(map[string]cachedCatchAll)}
+		c.entries[domain] = entry
+	}
+	return entry
+}
+
+func (c *domainCache) putStatus(domain, status string, mx []MXRecord) {
+	if c == nil || c.ttl == 0 {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	entry := c.entry(domain)
+	entry.status, entry.mx, entry.statusExpires = status, mx, c.now().Add(c.ttl)
+}
+
+func (c *domainCache) putDNSRecords(domain string, checks CheckSet, records *DNSRecords) {
+	if c == nil || c.ttl == 0 {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	entry := c.entry(domain)
+	entry.dns, entry.dnsChecks, entry.dnsExpires = records, checks, c.now().Add(c.ttl)
+}
+
+func (c *domainCache) putCatchAll(domain, profile, confidence string) {
+	if c == nil {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.entry(domain).catchAll[profile] = cachedCatchAll{confidence: confidence, expires: c.now().Add(c.catchAllTTL)}
+}
+
+// sweep drops expired facts and returns how many domains went with them.
+func (c *domainCache) sweep(now time.Time) int {
+	if c == nil {
+		return 0
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	removed := 0
+	for domain, entry := range c.entries {
+		for profile, cached := range entry.catchAll {
+			if !now.Before(cached.expires) {
+				delete(entry.catchAll, profile)
+			}
+		}
+		if !now.Before(entry.dnsExpires) {
+			entry.dns = nil
+		}
+		if !now.Before(entry.statusExpires) && entry.dns == nil && len(entry.catchAll) == 0 {
+			delete(c.entries, domain)
+			removed++
+		}
+	}
+	return removed
+}
+
+func (c *domainCache) len() int {
+	if c == nil {
+		return 0
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return len(c.entries)
+}
+
+// SweepDomainCache drops expired domain facts and returns how many domains
+// were removed.
+func (s *Service) SweepDomainCache(now time.Time) int { return s.domains.sweep(now) }
+
+// DomainCacheEnabled reports whether Config.DomainCacheTTL turned the
+// domain cache on.
+func (s *Service) DomainCacheEnabled() bool { return s.domains != nil }
+
+// DomainCacheLen returns the number of domains with cached facts.
+func (s *Service) DomainCacheLen() int { return s.domains.len() }
+
+// domainStatus classifies domain's mail setup into facts, answering from
+// the domain cache when it can.
+func (s *Service) domainStatus(ctx context.Context, resolver Resolver, domain string, facts *domainFacts) {
+	if status, mx, ok := s.domains.status(domain); ok {
+		facts.Status, facts.MX = status, mx
+		facts.fromCache(CheckMX)
+		return
+	}
+	facts.Status, facts.MX, facts.StatusErr = s.classifyDomain(ctx, resolver, domain)
+	if facts.StatusErr == nil && ctx.Err() == nil {
+		s.domains.putStatus(domain, facts.Status, facts.MX)
+	}
+}
+
+// cachedCatchAll fills in facts' catch-all status for profile from the
+// domain cache, if it has it.
+func (s *Service) cachedCatchAll(domain, profile string, facts *domainFacts) {
+	confidence, ok := s.domains.catchAll(domain, profile)
+	if !ok {
+		return
+	}
+	facts.catchAllProbed, facts.catchAllCached = true, true
+	facts.CatchAll, facts.CatchAllConfidence = confidence != CatchAllNo, confidence
+	if facts.CatchAll {
+		facts.fromCache(CheckSMTP)
+	}
+}
+
+// PrewarmProgress reports how far a Prewarm run got.
+type PrewarmProgress struct {
+	Domains  int `json:"domains"`
+	Done     int `json:"done"`
+	Probes   int `json:"probes"`
+	Failures int `json:"failures"`
+}
+
+// Prewarm refreshes the cached facts of domains in order, so the most
+// important should come first: the MX classification for each, then a
+// catch-all probe under the default profile while probes remain. It stops
+// when ctx ends and calls progress after each domain. Domains on the
+// server-wide disposable list are skipped, as a verification would skip
+// them.
+func (s *Service) Prewarm(ctx context.Context, domains []string, probes int, progress func(PrewarmProgress)) (PrewarmProgress, error) {
+	p := PrewarmProgress{Domains: len(domains)}
+	if s.domains == nil {
+		return p, ErrDomainCacheDisabled
+	}
+	if s.NetworkDisabled() {
+		return p, ErrNetworkDisabled
+	}
+	verifier, err := s.verifiers.Get()
+	if err != nil {
+		return p, err
+	}
+	opts := Options{Context: ctx}
+	for _, domain := range domains {
+		if ctx.Err() != nil {
+			return p, ctx.Err()
+		}
+		if !s.isDisposable(verifier, domain, nil) && !isSpecialUse(domain) {
+			status, mx, err := s.classifyDomain(ctx, s.resolver, domain)
+			switch {
+			case err != nil:
+				p.Failures++
+			case ctx.Err() == nil:
+				s.domains.putStatus(domain, status, mx)
+			}
+			if err == nil && status == DomainHasMail && p.Probes < probes && !s.catchAllDisabled {
+				p.Probes++
+				smtp, info, err := s.probe(opts, domain, "", true)
+				if err = smtpError(err); err != nil {
+					p.Failures++
+				} else if ctx.Err() == nil {
+					s.domains.putCatchAll(domain, opts.profile(), probedConfidence(smtp, info.report))
+				}
+			}
+		}
+		if ctx.Err() != nil {
+			return p, ctx.Err()
+		}
+		p.Done++
+		if progress != nil {
+			progress(p)
+		}
+	}
+	return p, nil
+}
@@ -0,0 +1,157 @@
+package verify
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+// newCachedService returns newBatchService's service with a domain cache
+func newCachedService(domains int) (*Service, *countingResolver, *domainCacheClock) {
+	s, dns, _ := newBatchService(domains)
+	clock := &domainCacheClock{now: time.Date(2026, 3, 1, 9, 0, 0, 0, time.UTC)}
+	s.domains = newDomainCache(time.Hour, 0)
+	s.domains.now = clock.Now
+	return s, dns, clock
+}
+
+type domainCacheClock struct{ now time.Time }
+
+func (c *domainCacheClock) Now() time.Time { return c.now }
+
+// TestDomainCacheReusesFacts tests that a second verification at a domain reuses its MX and catch-all status and is charged for it
+func TestDomainCacheReusesFacts(t *testing.T) {
+	s, dns, _ := newCachedService(2)
+	checks := MustParseChecks(CheckSMTP)
+
+	first := s.Verify("user0@d0.mock", Options{Checks: checks})
+	lookups := dns.mxLookups.Load()
+	second := s.Verify("user1@d0.mock", Options{Checks: checks})
+	if n := dns.mxLookups.Load(); n != lookups {
+		t.Errorf("Expected no new MX lookups, got %d", n-lookups)
+	}
+	if !second.CatchAll || second.Verdict != first.Verdict {
+		t.Errorf("Expected the cached catch-all verdict %s, got %+v", first.Verdict, second)
+	}
+	if second.CostUnits >= first.CostUnits {
+		t.Errorf("Expected the cached verification to cost less than %d, got %d", first.CostUnits, second.CostUnits)
+	}
+
+	// d1 is not catch-all, so each mailbox is still probed
+	s.Verify("user0@d1.mock", Options{Checks: checks})
+	if r := s.Verify("user3@d1.mock", Options{Checks: checks}); r.Verdict != VerdictUndeliverable {
+		t.Errorf("Expected user3@d1.mock to be probed and undeliverable, got %s", r.Verdict)
+	}
+}
+
+// TestDomainCacheExpiry tests that facts are looked up again after the TTL and swept
+func TestDomainCacheExpiry(t *testing.T) {
+	s, dns, clock := newCachedService(1)
+	s.Verify("user0@d0.mock", Options{Checks: DefaultChecks})
+	if s.DomainCacheLen() != 1 {
+		t.Fatalf("Expected one cached domain, got %d", s.DomainCacheLen())
+	}
+
+	clock.now = clock.now.Add(time.Hour)
+	lookups := dns.mxLookups.Load()
+	s.Verify("user1@d0.mock", Options{Checks: DefaultChecks})
+	if dns.mxLookups.Load() == lookups {
+		t.Error("Expected an expired status to be looked up again")
+	}
+
+	if n := s.SweepDomainCache(clock.now.Add(2 * time.Hour)); n != 1 || s.DomainCacheLen() != 0 {
+		t.Errorf("Expected the sweep to remove 1 domain, got %d with %d left", n, s.DomainCacheLen())
+	}
+}
+
+// TestPrewarm tests that prewarming fills the cache within its probe budget
+func TestPrewarm(t *testing.T) {
+	s, dns, _ := newCachedService(4)
+	domains := []string{"d0.mock", "d1.mock", "d2.mock", "d3.mock", "mailinator.com"}
+
+	var reports int
+	progress, err := s.Prewarm(context.Background(), domains, 2, func(PrewarmProgress) { reports++ })
+	if err != nil {
+		t.Fatalf("Expected prewarming to succeed, got %v", err)
+	}
+	expected := PrewarmProgress{Domains: 5, Done: 5, Probes: 2}
+	if progress != expected || reports != 5 {
+		t.Errorf("Expected %+v with 5 reports, got %+v with %d", expected, progress, reports)
+	}
+	if _, ok := s.domains.catchAll("d1.mock", Options{}.profile()); !ok {
+		t.Error("Expected d1.mock's catch-all status within the budget")
+	}
+	if _, ok := s.domains.catchAll("d2.mock", Options{}.profile()); ok {
+		t.Error("Expected no probe of d2.mock past the budget")
+	}
+
+	lookups := dns.mxLookups.Load()
+	s.Verify("user0@d3.mock", Options{Checks: DefaultChecks})
+	if dns.mxLookups.Load() != lookups {
+		t.Error("Expected a prewarmed domain to need no lookup")
+	}
+}
+
+// TestPrewarmStops tests that prewarming stops with its context and needs the cache
+func TestPrewarmStops(t *testing.T) {
+	s, _, _ := newCachedService(2)
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if progress, err := s.Prewarm(ctx, []string{"d0.mock", "d1.mock"}, 2, nil); !errors.Is(err, context.Canceled) || progress.Done != 0 {
+		t.Errorf("Expected a cancelled run to stop at once, got %+v, %v", progress, err)
+	}
+
+	uncached, _, _ := newBatchService(1)
+	if _, err := uncached.Prewarm(context.Background(), []string{"d0.mock"}, 1, nil); !errors.Is(err, ErrDomainCacheDisabled) {
+		t.Errorf("Expected ErrDomainCacheDisabled, got %v", err)
+	}
+}
+
+// TestCatchAllCacheTTL tests that catch-all statuses are cached on their own TTL and marked catch_all_cached
+func TestCatchAllCacheTTL(t *testing.T) {
+	_, dns, smtp := newBatchService(1)
+	s := newTestService(Config{Resolver: dns, Prober: smtp.Probe, CatchAllCacheTTL: time.Hour})
+	clock := &domainCacheClock{now: time.Date(2026, 3, 1, 9, 0, 0, 0, time.UTC)}
+	s.domains.now = clock.Now
+	checks := MustParseChecks(CheckSMTP)
+
+	first := s.Verify("user0@d0.mock", Options{Checks: checks})
+	lookups := dns.mxLookups.Load()
+	second := s.Verify("user1@d0.mock", Options{Checks: checks})
+	if first.CatchAllCached || !second.CatchAll || !second.CatchAllCached || smtp.Probes() != 1 {
+		t.Errorf("Expected the second catch-all status from the cache, got %+v after %d probes", second, smtp.Probes())
+	}
+	if dns.mxLookups.Load() == lookups {
+		t.Error("Expected the MX classification not to be cached without DomainCacheTTL")
+	}
+
+	clock.now = clock.now.Add(time.Hour)
+	if third := s.Verify("user2@d0.mock", Options{Checks: checks}); third.CatchAllCached || smtp.Probes() != 2 {
+		t.Errorf("Expected the catch-all status probed again after the TTL, got %+v", third)
+	}
+}
+
+// TestCatchAllDisabled tests that without the catch-all probe every mailbox is probed and none is marked catch-all
+func TestCatchAllDisabled(t *testing.T) {
+	_, dns, smtp := newBatchService(2)
+	s := newTestService(Config{Resolver: dns, Prober: smtp.Probe, CatchAllDisabled: true, DomainCacheTTL: time.Hour})
+	checks := MustParseChecks(CheckSMTP)
+
+	results, summary := s.VerifyBatch(batchEmails(2, 2), Options{Checks: checks})
+	if summary.CatchAllProbes != 0 || summary.CatchAllDomains != 0 || smtp.Probes() != 4 {
+		t.Errorf("Expected 4 mailbox probes and no catch-all probe, got %+v after %d probes", summary, smtp.Probes())
+	}
+	for _, r := range results {
+		if r.CatchAll || r.CatchAllCached {
+			t.Errorf("Expected %s not marked catch-all, got %+v", r.Email, r)
+		}
+	}
+	// d0 accepts everything, but only user0 exists
+	if r := s.Verify("user1@d0.mock", Options{Checks: checks}); r.Verdict != VerdictUndeliverable {
+		t.Errorf("Expected the mailbox answer for user1@d0.mock, got %s", r.Verdict)
+	}
+	if plan := s.PlanBatch(batchEmails(2, 2), Options{Checks: checks}); plan.EstimatedCatchAllProbes != 0 || plan.EstimatedMailboxProbes != 4 {
+		t.Errorf("Expected the plan to count only mailbox probes, got %+v", plan)
+	}
+}
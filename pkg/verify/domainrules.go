@@ -0,0 +1,95 @@
+package verify
+
+import (
+	"fmt"
+	"strings"
+)
+
+// SMTPSkippedAllowlisted is Result.SMTPSkippedReason for a domain in
+// Config.SkipSMTPDomains.
+const SMTPSkippedAllowlisted = "allowlisted"
+
+// domainSet matches domains against exact entries and wildcard entries such
+// as *.example.com, which match every subdomain of example.com but not
+// example.com itself. A nil set matches nothing.
+type domainSet struct {
+	exact    map[string]bool
+	suffixes []string // ".example.com" for *.example.com
+}
+
+// newDomainSet builds the set of patterns, which LoadDomainPatterns has
+// checked; any it would reject are left out.
+func newDomainSet(patterns []string) *domainSet {
+	if len(patterns) == 0 {
+		return nil
+	}
+	set := &domainSet{exact: make(map[string]bool)}
+	for _, pattern := range patterns {
+		if normalized, err := normalizeDomainPattern(pattern); err == nil {
+			if suffix, ok := strings.CutPrefix(normalized, "*"); ok {
+				set.suffixes = append(set.suffixes, suffix)
+			} else {
+				set.exact[normalized] = true
+			}
+		}
+	}
+	return set
+}
+
+func (d *domainSet) match(domain string) bool {
+	if d == nil {
+		return false
+	}
+	domain = strings.ToLower(strings.TrimSuffix(domain, "."))
+	if d.exact[domain] {
+		return true
+	}
+	for _, suffix := range d.suffixes {
+		if strings.HasSuffix(domain, suffix) {
+			return true
+		}
+	}
+	return false
+}
+
+// normalizeDomainPattern lowercases a domain or *.domain pattern, taking
+// the domain to its ASCII form.
+func normalizeDomainPattern(pattern string) (string, error) {
+	pattern = strings.TrimSpace(pattern)
+	wildcard := strings.HasPrefix(pattern, "*.")
+	domain, err := NormalizeDomain(strings.TrimPrefix(pattern, "*."))
+	if err != nil || strings.Contains(domain, "*") {
+		return "", fmt.Errorf("%q is not a domain or *.domain pattern", pattern)
+	}
+	if wildcard {
+		return "*." + domain, nil
+	}
+	return domain, nil
+}
+
+// LoadDomainPatterns returns the domain patterns in list, comma-separated,
+// and in the file at path, one per line. Either may be empty. Patterns are
+// domains or wildcards such as *.example.com.
+func LoadDomainPatterns(list, path string) ([]string, error) {
+	var patterns []string
+	for _, entry := range strings.Split(list, ",") {
+		if entry = strings.TrimSpace(entry); entry != "" {
+			patterns = append(patterns, entry)
+		}
+	}
+	if path != "" {
+		entries, err := ReadListFile(path)
+		if err != nil {
+			return nil, err
+		}
+		patterns = append(patterns, entries...)
+	}
+	for i, pattern := range patterns {
+		normalized, err := normalizeDomainPattern(pattern)
+		if err != nil {
+			return nil, err
+		}
+		patterns[i] = normalized
+	}
+	return patterns, nil
+}
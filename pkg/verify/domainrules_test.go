@@ -0,0 +1,118 @@
+package verify
+
+import (
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"email-verifier/pkg/verify/verifytest"
+)
+
+// TestDomainSet tests exact and wildcard matching of domain patterns
+func TestDomainSet(t *testing.T) {
+	set := newDomainSet([]string{"Partner.Mock", "*.corp.mock", "bücher.mock"})
+	for domain, expected := range map[string]bool{
+		"partner.mock":       true,
+		"PARTNER.mock.":      true,
+		"mx.partner.mock":    false,
+		"corp.mock":          false,
+		"eu.corp.mock":       true,
+		"mail.eu.corp.mock":  true,
+		"notcorp.mock":       false,
+		"xn--bcher-kva.mock": true,
+		"other.mock":         false,
+	} {
+		if got := set.match(domain); got != expected {
+			t.Errorf("Expected match(%q) to be %v, got %v", domain, expected, got)
+		}
+	}
+	if (*domainSet)(nil).match("partner.mock") {
+		t.Error("Expected an empty set to match nothing")
+	}
+}
+
+// TestLoadDomainPatterns tests that patterns come from the flag and the file, and that bad ones are refused
+func TestLoadDomainPatterns(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "allow.txt")
+	os.WriteFile(file, []byte("# partners\n*.Corp.Mock\n\nvendor.mock\n"), 0o600)
+	patterns, err := LoadDomainPatterns(" partner.mock, ,bücher.mock", file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []string{"partner.mock", "xn--bcher-kva.mock", "*.corp.mock", "vendor.mock"}
+	if len(patterns) != len(expected) {
+		t.Fatalf("Expected %v, got %v", expected, patterns)
+	}
+	for i := range expected {
+		if patterns[i] != expected[i] {
+			t.Errorf("Expected %v, got %v", expected, patterns)
+		}
+	}
+	for _, bad := range []string{"*", "a.*.mock", "bad..mock", "*corp.mock"} {
+		if _, err := LoadDomainPatterns(bad, ""); err == nil {
+			t.Errorf("Expected %q to be refused", bad)
+		}
+	}
+	if _, err := LoadDomainPatterns("", filepath.Join(t.TempDir(), "missing.txt")); err == nil {
+		t.Error("Expected an error for a missing file")
+	}
+}
+
+// TestSkipSMTPDomains tests that allowlisted domains are reachable from their MX records without a probe
+func TestSkipSMTPDomains(t *testing.T) {
+	fake := verifytest.NewResolver()
+	fake.MX["partner.mock"] = []*net.MX{{Host: "mx.partner.mock.", Pref: 10}}
+	fake.MX["eu.corp.mock"] = []*net.MX{{Host: "mx.corp.mock.", Pref: 10}}
+	fake.Hosts["fallback.mock"] = []string{"192.0.2.1"}
+	smtp := verifytest.NewSMTP()
+	s := newTestService(Config{Resolver: fake, Prober: smtp.Probe, SkipSMTPDomains: []string{"partner.mock", "*.corp.mock", "nomail.mock", "fallback.mock"}})
+	opts := Options{Checks: MustParseChecks(CheckSMTP)}
+
+	for _, email := range []string{"jane@partner.mock", "jane@eu.corp.mock"} {
+		result := s.Verify(email, opts)
+		if result.SMTPSkippedReason != SMTPSkippedAllowlisted || result.Reachable != ReachableYes || !result.HasMxRecords {
+			t.Errorf("Expected %s reachable without a probe, got %+v", email, result)
+		}
+	}
+	// Without MX records there is nothing to be reachable at
+	if result := s.Verify("jane@nomail.mock", opts); result.Reachable == ReachableYes || result.SMTPSkippedReason != "" {
+		t.Errorf("Expected an allowlisted domain without MX records not to be reachable, got %+v", result)
+	}
+	// Nor is an A record fallback an MX
+	if result := s.Verify("jane@fallback.mock", opts); !result.MXFallbackA || result.Reachable != ReachableUnknown || smtp.Probes() != 0 {
+		t.Errorf("Expected an allowlisted domain on its A record fallback to stay unknown without a probe, got %+v", result)
+	}
+	results, _ := s.VerifyBatch([]string{"jane@partner.mock", "bob@partner.mock"}, opts)
+	plan := s.PlanBatch([]string{"jane@partner.mock"}, opts)
+	if smtp.Probes() != 0 || results[1].SMTPSkippedReason != SMTPSkippedAllowlisted || plan.EstimatedCatchAllProbes != 0 || plan.EstimatedMailboxProbes != 0 {
+		t.Errorf("Expected no probes from a batch or its plan, got %d probes and %+v", smtp.Probes(), plan)
+	}
+}
+
+// TestBlockedDomains tests that blocked domains are invalid without a lookup
+func TestBlockedDomains(t *testing.T) {
+	fake := verifytest.NewResolver()
+	fake.MX["spam.mock"] = []*net.MX{{Host: "mx.spam.mock.", Pref: 10}}
+	s := newTestService(Config{Resolver: fake, BlockedDomains: []string{"spam.mock", "*.junk.mock"}})
+	opts := Options{Checks: MustParseChecks(CheckMX, CheckSMTP)}
+
+	for _, email := range []string{"jane@spam.mock", "jane@a.junk.mock"} {
+		result := s.Verify(email, opts)
+		if result.ErrorCode != ErrCodeDomainBlocked || result.Verdict != VerdictInvalid || result.HasMxRecords {
+			t.Errorf("Expected %s blocked as invalid, got %+v", email, result)
+		}
+	}
+	results, _ := s.VerifyBatch([]string{"bob@spam.mock", "bob@b.junk.mock"}, opts)
+	for _, result := range results {
+		if result.ErrorCode != ErrCodeDomainBlocked {
+			t.Errorf("Expected the batch result blocked, got %+v", result)
+		}
+	}
+	if fake.Lookups() != 0 {
+		t.Errorf("Expected no lookups, got %d", fake.Lookups())
+	}
+	if plan := s.PlanBatch([]string{"jane@spam.mock"}, opts); len(plan.Rejected) != 1 || plan.Rejected[0].ErrorCode != ErrCodeDomainBlocked {
+		t.Errorf("Expected the plan to reject the blocked address, got %+v", plan)
+	}
+}
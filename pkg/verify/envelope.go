@@ -0,0 +1,135 @@
+package verify
+
+import (
+	"regexp"
+	"strings"
+)
+
+// Envelope sender classifications.
+const (
+	EnvelopeNull  = "null_sender"
+	EnvelopePlain = "plain"
+	EnvelopeVERP  = "verp"
+	EnvelopeSRS0  = "srs0"
+	EnvelopeSRS1  = "srs1"
+	EnvelopeBATV  = "batv"
+)
+
+// EnvelopeInfo describes how a MAIL FROM address was decoded.
+type EnvelopeInfo struct {
+	Classification  string `json:"classification"`
+	OriginalAddress string `json:"original_address,omitempty"`
+	ReturnDomain    string `json:"return_domain,omitempty"`
+	VerifiedAddress string `json:"verified_address,omitempty"`
+}
+
+var (
+	// prvs=tag=user, msprvs1=tag=user and btv1==tag==user
+	batvPattern = regexp.MustCompile(`(?i)^(?:(?:ms)?prvs1?=[^=]+=|btv1==[^=]+==)(.+)$`)
+	// prefix+user=example.com or prefix-user=example.com
+	verpPattern = regexp.MustCompile(`^([^+=]+)[+-]([^=]+)=([A-Za-z0-9-]+(?:\.[A-Za-z0-9-]+)*\.[A-Za-z]{2,})$`)
+)
+
+// parseEnvelopeSender decodes an SMTP envelope sender. The empty sender
+// (bounces) is classified as null_sender. SRS rewrites decode to the original
+// sender, which is what gets verified; BATV tags are stripped; VERP addresses
+// surface the original recipient but the bounce address itself is verified,
+// since that is the mailbox that has to accept mail.
+func parseEnvelopeSender(input string) EnvelopeInfo {
+	address := strings.TrimSpace(input)
+	address = strings.TrimSuffix(strings.TrimPrefix(address, "<"), ">")
+	address = strings.TrimSpace(address)
+
+	if address == "" {
+		return EnvelopeInfo{Classification: EnvelopeNull}
+	}
+
+	at := strings.LastIndex(address, "@")
+	if at < 0 {
+		return EnvelopeInfo{Classification: EnvelopePlain, VerifiedAddress: address}
+	}
+	local, domain := address[:at], strings.ToLower(address[at+1:])
+
+	if info, ok := decodeSRS(local, domain); ok {
+		return info
+	}
+
+	if m := batvPattern.FindStringSubmatch(local); m != nil {
+		return EnvelopeInfo{
+			Classification:  EnvelopeBATV,
+			ReturnDomain:    domain,
+			VerifiedAddress: m[1] + "@" + domain,
+		}
+	}
+
+	if m := verpPattern.FindStringSubmatch(local); m != nil {
+		return EnvelopeInfo{
+			Classification:  EnvelopeVERP,
+			OriginalAddress: m[2] + "@" + strings.ToLower(m[3]),
+			ReturnDomain:    domain,
+			VerifiedAddress: address,
+		}
+	}
+
+	return EnvelopeInfo{Classification: EnvelopePlain, VerifiedAddress: address}
+}
+
+// decodeSRS decodes SRS0=HHH=TT=domain=local and
+// SRS1=HHH=forwarder==HHH=TT=domain=local local parts.
+func decodeSRS(local, domain string) (EnvelopeInfo, bool) {
+	if len(local) < 5 || !strings.ContainsRune("=+-", rune(local[4])) {
+		return EnvelopeInfo{}, false
+	}
+	tag, rest := strings.ToUpper(local[:4]), local[5:]
+
+	classification := EnvelopeSRS0
+	switch tag {
+	case "SRS0":
+	case "SRS1":
+		// hash=forwarder=<srs0 remainder with its own leading separator>
+		parts := strings.SplitN(rest, "=", 3)
+		if len(parts) != 3 || parts[2] == "" || !strings.ContainsRune("=+-", rune(parts[2][0])) {
+			return EnvelopeInfo{}, false
+		}
+		rest = parts[2][1:]
+		classification = EnvelopeSRS1
+	default:
+		return EnvelopeInfo{}, false
+	}
+
+	parts := strings.SplitN(rest, "=", 4)
+	if len(parts) != 4 || parts[2] == "" || parts[3] == "" {
+		return EnvelopeInfo{}, false
+	}
+	original := parts[3] + "@" + strings.ToLower(parts[2])
+	return EnvelopeInfo{
+		Classification:  classification,
+		OriginalAddress: original,
+		ReturnDomain:    domain,
+		VerifiedAddress: original,
+	}, true
+}
+
+// VerifyEnvelopeSender verifies an SMTP envelope sender (MAIL FROM),
+// decoding SRS, BATV and VERP forms first.
+func (s *Service) VerifyEnvelopeSender(input string, opts Options) *Result {
+	info := parseEnvelopeSender(input)
+	if info.Classification == EnvelopeNull {
+		return &Result{
+			Email:           strings.TrimSpace(input),
+			IsValid:         true,
+			Reachable:       ReachableUnknown,
+			ReachableReason: ReachableReasonNotChecked,
+			Verdict:         VerdictUnknown,
+			RiskFlags:       []string{},
+			Envelope:        &info,
+			ChecksPerformed: []string{},
+			ChecksSkipped:   skippedChecks(nil),
+		}
+	}
+
+	result := s.Verify(info.VerifiedAddress, opts)
+	result.Email = strings.TrimSpace(input)
+	result.Envelope = &info
+	return result
+}
@@ -0,0 +1,45 @@
+package verify
+
+import "testing"
+
+// TestParseEnvelopeSender tests decoding of null, VERP, SRS and BATV senders
+func TestParseEnvelopeSender(t *testing.T) {
+	testCases := []struct {
+		input          string
+		classification string
+		original       string
+		returnDomain   string
+		verified       string
+	}{
+		{"<>", EnvelopeNull, "", "", ""},
+		{"", EnvelopeNull, "", "", ""},
+		{"<bounces@sender.com>", EnvelopePlain, "", "", "bounces@sender.com"},
+		{"bounces+user=example.com@sender.com", EnvelopeVERP, "user@example.com", "sender.com", "bounces+user=example.com@sender.com"},
+		{"list-jane.doe=example.org@lists.example.net", EnvelopeVERP, "jane.doe@example.org", "lists.example.net", "list-jane.doe=example.org@lists.example.net"},
+		{"SRS0=HHH=TT=example.com=alice@forwarder.net", EnvelopeSRS0, "alice@example.com", "forwarder.net", "alice@example.com"},
+		{"srs0+a1b2=Xy=Example.COM=bob@forwarder.net", EnvelopeSRS0, "bob@example.com", "forwarder.net", "bob@example.com"},
+		{"SRS1=HHH=first.example==HHH=TT=orig.example=carol@second.example", EnvelopeSRS1, "carol@orig.example", "second.example", "carol@orig.example"},
+		{"prvs=1234567890=dave@example.com", EnvelopeBATV, "", "example.com", "dave@example.com"},
+		{"msprvs1=17530abcdef=erin@example.com", EnvelopeBATV, "", "example.com", "erin@example.com"},
+		{"btv1==0123456789==frank@example.com", EnvelopeBATV, "", "example.com", "frank@example.com"},
+		{"SRS0=broken@forwarder.net", EnvelopePlain, "", "", "SRS0=broken@forwarder.net"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.input, func(t *testing.T) {
+			info := parseEnvelopeSender(tc.input)
+			if info.Classification != tc.classification {
+				t.Errorf("Expected classification %s, got %s", tc.classification, info.Classification)
+			}
+			if info.OriginalAddress != tc.original {
+				t.Errorf("Expected original %q, got %q", tc.original, info.OriginalAddress)
+			}
+			if info.ReturnDomain != tc.returnDomain {
+				t.Errorf("Expected return domain %q, got %q", tc.returnDomain, info.ReturnDomain)
+			}
+			if info.VerifiedAddress != tc.verified {
+				t.Errorf("Expected verified address %q, got %q", tc.verified, info.VerifiedAddress)
+			}
+		})
+	}
+}
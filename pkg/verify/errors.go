@@ -0,0 +1,158 @@
+package verify
+
+import (
+	"errors"
+	"log"
+	"net"
+	"regexp"
+
+	emailverifier "github.com/AfterShip/email-verifier"
+)
+
+// Stable error codes reported in Result.ErrorCode. Clients should branch on
+// these; the accompanying messages are for people and may change.
+const (
+	ErrCodeEmailRequired        = "email_required"
+	ErrCodeInvalidSyntax        = "invalid_syntax"
+	ErrCodeAmbiguousLegacyRoute = "ambiguous_legacy_route"
+	ErrCodeLegacyNotAccepted    = "legacy_route_not_accepted"
+	ErrCodeVerifierUnavailable  = "verifier_unavailable"
+	ErrCodeDNSTimeout           = "dns_timeout"
+	ErrCodeDNS                  = "dns_error"
+	ErrCodeSMTPTryAgain         = "smtp_try_again_later"
+	ErrCodeSMTPTimeout          = "smtp_timeout"
+	ErrCodeSMTPBlocked          = "smtp_blocked"
+	ErrCodeSMTPUnavailable      = "smtp_unavailable"
+	ErrCodeSMTP                 = "smtp_error"
+	ErrCodeRefNotFound          = "ref_not_found"
+	ErrCodeRefResolverFailed    = "ref_resolver_failed"
+	ErrCodeDeadlineExceeded     = "deadline_exceeded"
+	ErrCodeProbeDeferred        = "probe_deferred"
+	ErrCodeCircuitOpen          = "circuit_open"
+	ErrCodeDomainBlocked        = "domain_blocked"
+	ErrCodeMultipleAddresses    = "multiple_addresses"
+)
+
+// ErrorCodes lists every error code.
+var ErrorCodes = []string{
+	ErrCodeEmailRequired, ErrCodeInvalidSyntax, ErrCodeAmbiguousLegacyRoute, ErrCodeLegacyNotAccepted,
+	ErrCodeVerifierUnavailable, ErrCodeDNSTimeout, ErrCodeDNS, ErrCodeSMTPTryAgain, ErrCodeSMTPTimeout,
+	ErrCodeSMTPBlocked, ErrCodeSMTPUnavailable, ErrCodeSMTP, ErrCodeRefNotFound, ErrCodeRefResolverFailed,
+	ErrCodeDeadlineExceeded, ErrCodeProbeDeferred, ErrCodeCircuitOpen, ErrCodeDomainBlocked, ErrCodeMultipleAddresses,
+}
+
+// errorMessages are the generic messages shown for each code. None of them
+// include the address, the server's reply or any other request input.
+var errorMessages = map[string]string{
+	ErrCodeEmailRequired:        "Email address is required",
+	ErrCodeInvalidSyntax:        "Invalid email address format",
+	ErrCodeAmbiguousLegacyRoute: "Invalid email address format: the final mailbox of this legacy routing form can't be determined",
+	ErrCodeLegacyNotAccepted:    "Invalid email address format: legacy routing forms are not accepted",
+	ErrCodeVerifierUnavailable:  "Verifier unavailable, try again shortly",
+	ErrCodeDNSTimeout:           "Verification failed: DNS lookup timed out",
+	ErrCodeDNS:                  "Verification failed: DNS lookup failed",
+	ErrCodeSMTPTryAgain:         "Verification failed: the mail server asked us to try again later",
+	ErrCodeSMTPTimeout:          "Verification failed: the mail server timed out",
+	ErrCodeSMTPBlocked:          "Verification failed: blocked by the mail server",
+	ErrCodeSMTPUnavailable:      "Verification failed: the mail server is unavailable",
+	ErrCodeSMTP:                 "Verification failed: the mail server returned an error",
+	ErrCodeRefNotFound:          "The reference doesn't resolve to an address",
+	ErrCodeRefResolverFailed:    "The reference couldn't be resolved, try again shortly",
+	ErrCodeDeadlineExceeded:     "Verification timed out: the deadline passed before it finished",
+	ErrCodeProbeDeferred:        "Verification deferred: the mail server was probed too recently, try again later",
+	ErrCodeCircuitOpen:          "Verification skipped: the domain's mail servers keep timing out, try again later",
+	ErrCodeDomainBlocked:        "The address's domain is not accepted",
+	ErrCodeMultipleAddresses:    "Invalid email address format: found more than one address, expected one",
+}
+
+// ErrorMessage returns the generic message for an error code.
+func ErrorMessage(code string) string { return errorMessages[code] }
+
+// ErrorResult is the result for a verification that failed with code
+// before any check ran, such as an address reference that didn't resolve.
+func ErrorResult(code string) *Result {
+	return &Result{
+		Reachable:       ReachableUnknown,
+		Verdict:         VerdictUnknown,
+		ReachableReason: code,
+		ErrorCode:       code,
+		Error:           errorMessages[code],
+		ErrorMessage:    errorMessages[code],
+		RiskFlags:       []string{},
+		ChecksPerformed: []string{},
+		ChecksSkipped:   skippedChecks(nil),
+	}
+}
+
+// addressPattern matches anything address-shaped in a raw error, such as the
+// recipient echoed back in an SMTP reply.
+var addressPattern = regexp.MustCompile(`[^\s<>"'()\[\],;:@]+@[^\s<>"'()\[\],;:@]+`)
+
+// RedactAddresses replaces every address in s.
+func RedactAddresses(s string) string {
+	return addressPattern.ReplaceAllString(s, "[redacted]")
+}
+
+// ReplaceAddresses replaces every address in s with what replace returns
+// for it.
+func ReplaceAddresses(s string, replace func(address string) string) string {
+	return addressPattern.ReplaceAllStringFunc(s, replace)
+}
+
+// ErrorCodeFor maps a DNS or SMTP error to its stable code. SMTP replies
+// with a recognizable status code are mapped by their reason; the library's
+// text matching is the fallback.
+func ErrorCodeFor(err error) string {
+	if errors.Is(err, ErrProbeDeferred) {
+		return ErrCodeProbeDeferred
+	}
+	if errors.Is(err, ErrCircuitOpen) {
+		return ErrCodeCircuitOpen
+	}
+	if details := smtpDetailsFor(err); details != nil {
+		switch details.Reason {
+		case SMTPReasonTryLater, SMTPReasonQuotaExceeded:
+			return ErrCodeSMTPTryAgain
+		case SMTPReasonSenderRejected, SMTPReasonPolicyRejection:
+			return ErrCodeSMTPBlocked
+		}
+	}
+
+	var lookupErr *emailverifier.LookupError
+	if errors.As(err, &lookupErr) {
+		switch lookupErr.Message {
+		case emailverifier.ErrTryAgainLater, emailverifier.ErrMailboxBusy,
+			emailverifier.ErrExceededMessagingLimits, emailverifier.ErrTooManyRCPT,
+			emailverifier.ErrFullInbox:
+			return ErrCodeSMTPTryAgain
+		case emailverifier.ErrTimeout:
+			return ErrCodeSMTPTimeout
+		case emailverifier.ErrBlocked, emailverifier.ErrNotAllowed:
+			return ErrCodeSMTPBlocked
+		case emailverifier.ErrServerUnavailable, emailverifier.ErrNoSuchHost:
+			return ErrCodeSMTPUnavailable
+		}
+		return ErrCodeSMTP
+	}
+
+	var dnsErr *net.DNSError
+	if errors.As(err, &dnsErr) {
+		if dnsErr.IsTimeout {
+			return ErrCodeDNSTimeout
+		}
+		return ErrCodeDNS
+	}
+	return ErrCodeSMTP
+}
+
+// setError records code and its generic message, as both Error and
+// ErrorMessage, on result. The raw error, if any, only reaches the log, and
+// only with Config.DebugErrors.
+func (s *Service) setError(result *Result, code string, err error) {
+	result.ErrorCode = code
+	result.Error = errorMessages[code]
+	result.ErrorMessage = result.Error
+	if err != nil && s.debugErrors {
+		log.Printf("verify: %s: %s", code, RedactAddresses(err.Error()))
+	}
+}
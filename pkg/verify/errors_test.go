@@ -0,0 +1,59 @@
+package verify
+
+import (
+	"errors"
+	"net"
+	"strings"
+	"testing"
+
+	emailverifier "github.com/AfterShip/email-verifier"
+)
+
+// TestErrorCodeFor tests mapping library and DNS errors to stable codes
+func TestErrorCodeFor(t *testing.T) {
+	testCases := []struct {
+		name     string
+		err      error
+		expected string
+	}{
+		{"greylisted", &emailverifier.LookupError{Message: emailverifier.ErrTryAgainLater, Details: "451 4.7.1 <jane@example.com> greylisted"}, ErrCodeSMTPTryAgain},
+		{"smtp timeout", &emailverifier.LookupError{Message: emailverifier.ErrTimeout}, ErrCodeSMTPTimeout},
+		{"blocked", &emailverifier.LookupError{Message: emailverifier.ErrBlocked}, ErrCodeSMTPBlocked},
+		{"unavailable", &emailverifier.LookupError{Message: emailverifier.ErrServerUnavailable}, ErrCodeSMTPUnavailable},
+		{"other smtp", &emailverifier.LookupError{Message: emailverifier.ErrNeedMAILBeforeRCPT}, ErrCodeSMTP},
+		{"dns timeout", &net.DNSError{Err: "i/o timeout", Name: "example.com", IsTimeout: true}, ErrCodeDNSTimeout},
+		{"dns failure", &net.DNSError{Err: "server misbehaving", Name: "example.com"}, ErrCodeDNS},
+		{"unknown", errors.New("boom"), ErrCodeSMTP},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := ErrorCodeFor(tc.err); got != tc.expected {
+				t.Errorf("Expected %s, got %s", tc.expected, got)
+			}
+		})
+	}
+}
+
+// TestSetErrorHidesRawError tests that result messages never carry the raw server reply
+func TestSetErrorHidesRawError(t *testing.T) {
+	err := &emailverifier.LookupError{Message: emailverifier.ErrTryAgainLater, Details: "451 4.7.1 <jane@example.com> greylisted"}
+	result := &Result{Email: "jane@example.com"}
+	newTestService(Config{}).setError(result, ErrorCodeFor(err), err)
+
+	if strings.Contains(result.Error, "jane@example.com") || strings.Contains(result.Error, "451") {
+		t.Errorf("Expected generic message, got %q", result.Error)
+	}
+	if result.ErrorCode != ErrCodeSMTPTryAgain {
+		t.Errorf("Expected code %s, got %s", ErrCodeSMTPTryAgain, result.ErrorCode)
+	}
+}
+
+// TestRedactAddresses tests scrubbing addresses from logged errors
+func TestRedactAddresses(t *testing.T) {
+	got := RedactAddresses("550 5.1.1 <jane.doe+tag@example.com>: user unknown (from bob@mx.example.net)")
+	expected := "550 5.1.1 <[redacted]>: user unknown (from [redacted])"
+	if got != expected {
+		t.Errorf("Expected %q, got %q", expected, got)
+	}
+}
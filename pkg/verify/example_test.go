@@ -0,0 +1,35 @@
+package verify_test
+
+import (
+	"fmt"
+	"net"
+
+	"email-verifier/pkg/verify"
+	"email-verifier/pkg/verify/verifytest"
+)
+
+// Example demonstrates how to use the email verification
+func Example() {
+	service := verify.New(verify.Config{})
+	result := service.Verify("user@example.com", verify.Options{Checks: verify.DefaultChecks})
+	fmt.Printf("Email: %s\n", result.Email)
+	fmt.Printf("Valid: %v\n", result.IsValid)
+	fmt.Printf("Reachable: %s\n", result.Reachable)
+}
+
+// ExampleService_VerifyBatch verifies a list against canned DNS and SMTP
+// answers, probing the mail server once per domain
+func ExampleService_VerifyBatch() {
+	resolver := verifytest.NewResolver()
+	resolver.MX["example.com"] = []*net.MX{{Host: "mx.example.com.", Pref: 10}}
+	smtp := verifytest.NewSMTP()
+	smtp.Mailboxes["jane@example.com"] = true
+
+	service := verify.New(verify.Config{Resolver: resolver, Prober: smtp.Probe})
+	checks := verify.MustParseChecks(verify.CheckSMTP)
+	results, summary := service.VerifyBatch([]string{"jane@example.com", "john@example.com"}, verify.Options{Checks: checks})
+	for _, result := range results {
+		fmt.Printf("%s: %s\n", result.Email, result.Verdict)
+	}
+	fmt.Printf("Domains: %d, mailbox probes: %d\n", summary.Domains, summary.MailboxProbes)
+}
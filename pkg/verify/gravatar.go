@@ -0,0 +1,58 @@
+package verify
+
+import (
+	"log"
+
+	emailverifier "github.com/AfterShip/email-verifier"
+)
+
+// Gravatar reports whether an address has a Gravatar profile picture.
+type Gravatar struct {
+	HasGravatar bool   `json:"has_gravatar"`
+	GravatarURL string `json:"gravatar_url,omitempty"`
+}
+
+// GravatarLookup looks up the Gravatar of an address. The library's
+// CheckGravatar is used unless Config.GravatarLookup replaces it.
+type GravatarLookup func(email string) (*emailverifier.Gravatar, error)
+
+// WarningGravatarFailed is reported when CheckGravatar runs but the
+// lookup failed, so Result.Gravatar is left out and the check is skipped.
+const WarningGravatarFailed = "gravatar_lookup_failed"
+
+// checkGravatar sets result.Gravatar for email. It returns early if
+// opts.Context ends first, as a probe does; the library's lookup gives up
+// on its own after ten seconds.
+func (s *Service) checkGravatar(verifier *emailverifier.Verifier, result *Result, email string, opts Options) {
+	if !opts.Checks.Has(CheckGravatar) || s.NetworkDisabled() {
+		return
+	}
+	lookup := s.gravatarLookup
+	if lookup == nil {
+		lookup = verifier.CheckGravatar
+	}
+	type outcome struct {
+		gravatar *emailverifier.Gravatar
+		err      error
+	}
+	done := make(chan outcome, 1)
+	go func() {
+		gravatar, err := lookup(email)
+		done <- outcome{gravatar, err}
+	}()
+	var o outcome
+	select {
+	case o = <-done:
+	case <-opts.context().Done():
+		return
+	}
+	if o.err != nil || o.gravatar == nil {
+		if o.err != nil && s.debugErrors {
+			log.Printf("verify: gravatar: %s", RedactAddresses(o.err.Error()))
+		}
+		result.Warnings = append(result.Warnings, WarningGravatarFailed)
+		return
+	}
+	result.Gravatar = &Gravatar{HasGravatar: o.gravatar.HasGravatar, GravatarURL: o.gravatar.GravatarUrl}
+	result.ran(CheckGravatar)
+}
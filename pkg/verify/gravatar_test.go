@@ -0,0 +1,59 @@
+package verify
+
+import (
+	"encoding/json"
+	"errors"
+	"net"
+	"slices"
+	"strings"
+	"testing"
+
+	"email-verifier/pkg/verify/verifytest"
+	emailverifier "github.com/AfterShip/email-verifier"
+)
+
+// TestGravatar tests that the lookup is reported when the check runs, by default with Config.Gravatar or when asked for, and left out otherwise
+func TestGravatar(t *testing.T) {
+	fake := verifytest.NewResolver()
+	fake.MX["partner.mock"] = []*net.MX{{Host: "mx.partner.mock.", Pref: 10}}
+	lookups := 0
+	lookup := func(email string) (*emailverifier.Gravatar, error) {
+		lookups++
+		if strings.HasPrefix(email, "broken@") {
+			return nil, errors.New("gravatar unreachable")
+		}
+		return &emailverifier.Gravatar{HasGravatar: true, GravatarUrl: "https://www.gravatar.com/avatar/abc"}, nil
+	}
+	s := newTestService(Config{Resolver: fake, Gravatar: true, GravatarLookup: lookup})
+	checks := s.ChecksFor("")
+
+	r := s.Verify("jane@partner.mock", Options{Checks: checks})
+	if r.Gravatar == nil || !r.Gravatar.HasGravatar || r.Gravatar.GravatarURL != "https://www.gravatar.com/avatar/abc" || !slices.Contains(r.ChecksPerformed, CheckGravatar) {
+		t.Errorf("Expected the Gravatar to be reported, got %+v and %v", r.Gravatar, r.ChecksPerformed)
+	}
+	if r := s.Verify("broken@partner.mock", Options{Checks: checks}); r.Gravatar != nil || !slices.Contains(r.Warnings, WarningGravatarFailed) || !slices.Contains(r.ChecksSkipped, CheckGravatar) {
+		t.Errorf("Expected a failed lookup to warn and be skipped, got %+v, %v and %v", r.Gravatar, r.Warnings, r.ChecksSkipped)
+	}
+	if r := s.Verify("jane@partner.mock", Options{Checks: checks.Without(CheckGravatar)}); r.Gravatar != nil {
+		t.Errorf("Expected no lookup when the check is left out, got %+v", r.Gravatar)
+	}
+	if r := s.Verify("jane@partner.mock", Options{Checks: MustParseChecks(CheckSyntax)}); r.Gravatar != nil {
+		t.Errorf("Expected no lookup without DNS checks, got %+v", r.Gravatar)
+	}
+	s.SetNetworkDisabled(true)
+	if r := s.Verify("jane@partner.mock", Options{Checks: checks}); r.Gravatar != nil {
+		t.Errorf("Expected no lookup with the network disabled, got %+v", r.Gravatar)
+	}
+	if lookups != 2 {
+		t.Errorf("Expected 2 lookups, got %d", lookups)
+	}
+
+	off := newTestService(Config{Resolver: fake, GravatarLookup: lookup})
+	data, _ := json.Marshal(off.Verify("jane@partner.mock", Options{Checks: off.ChecksFor("")}))
+	if strings.Contains(string(data), "gravatar_url") || lookups != 2 {
+		t.Errorf("Expected no gravatar field when disabled, got %s", data)
+	}
+	if r := off.Verify("jane@partner.mock", Options{Checks: MustParseChecks(CheckGravatar)}); r.Gravatar == nil || lookups != 3 {
+		t.Errorf("Expected the lookup when asked for, got %+v", r.Gravatar)
+	}
+}
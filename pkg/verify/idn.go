@@ -0,0 +1,158 @@
+package verify
+
+import (
+	"strings"
+	"unicode"
+
+	emailverifier "github.com/AfterShip/email-verifier"
+)
+
+// Homograph warnings describe an internationalized domain that could pass
+// for another one.
+const (
+	// WarningMixedScriptDomain is reported when a label of the domain mixes
+	// letters of different scripts, as in a Latin name with one Cyrillic
+	// letter. Latin with Chinese, Japanese or Korean is not reported.
+	WarningMixedScriptDomain = "mixed_script_domain"
+	// WarningConfusableDomain is reported when a label of the domain is
+	// spelled with letters that look like Latin ones, so it reads as an
+	// ASCII name it isn't.
+	WarningConfusableDomain = "confusable_domain"
+)
+
+// SMTPSkippedSMTPUTF8 is Result.SMTPSkippedReason for an address whose
+// local part needs SMTPUTF8, which the prober can't send.
+const SMTPSkippedSMTPUTF8 = "requires_smtputf8"
+
+// parsedAddress is an address as the verifier works on it: Domain is the
+// lowercased ASCII form DNS and SMTP are given, and WrittenDomain the
+// domain as the address spells it, lowercased.
+type parsedAddress struct {
+	emailverifier.Syntax
+	WrittenDomain string
+	// SMTPUTF8 is set for a local part with non-ASCII characters.
+	SMTPUTF8 bool
+}
+
+// parseAddress validates email as the library does, and also takes
+// internationalized addresses: the domain is checked and converted to
+// punycode by NormalizeDomain, and a local part's non-ASCII letters,
+// marks, numbers and symbols are allowed (RFC 6531).
+func parseAddress(verifier *emailverifier.Verifier, email string) parsedAddress {
+	at := strings.LastIndex(email, "@")
+	if at < 0 || isASCII(email) {
+		syntax := verifier.ParseAddress(email)
+		syntax.Domain = strings.ToLower(syntax.Domain)
+		return parsedAddress{Syntax: syntax, WrittenDomain: syntax.Domain}
+	}
+	local, domain := email[:at], email[at+1:]
+	ascii, err := NormalizeDomain(domain)
+	if err != nil {
+		return parsedAddress{}
+	}
+	checked := local
+	if !isASCII(local) {
+		checked = strings.Map(func(r rune) rune {
+			switch {
+			case r <= unicode.MaxASCII:
+				return r
+			case unicode.In(r, unicode.L, unicode.M, unicode.N, unicode.S):
+				return 'x'
+			}
+			return -1
+		}, local)
+		if len([]rune(checked)) != len([]rune(local)) {
+			return parsedAddress{}
+		}
+	}
+	if !verifier.ParseAddress(checked + "@" + ascii).Valid {
+		return parsedAddress{}
+	}
+	return parsedAddress{
+		Syntax:        emailverifier.Syntax{Username: local, Domain: ascii, Valid: true},
+		WrittenDomain: strings.ToLower(domain),
+		SMTPUTF8:      checked != local,
+	}
+}
+
+func isASCII(s string) bool {
+	for i := 0; i < len(s); i++ {
+		if s[i] > unicode.MaxASCII {
+			return false
+		}
+	}
+	return true
+}
+
+// cjkScripts may be mixed with each other and with Latin in one label, as
+// Japanese and Korean names are written.
+var cjkScripts = map[string]bool{"Han": true, "Hiragana": true, "Katakana": true, "Hangul": true, "Bopomofo": true}
+
+// latinLookalikes maps Cyrillic and Greek letters to the Latin letters
+// they are indistinguishable from in most fonts.
+var latinLookalikes = map[rune]rune{
+	'а': 'a', 'с': 'c', 'ԁ': 'd', 'е': 'e', 'һ': 'h', 'і': 'i', 'ј': 'j', 'к': 'k',
+	'ӏ': 'l', 'о': 'o', 'р': 'p', 'ԛ': 'q', 'ѕ': 's', 'у': 'y', 'ԝ': 'w', 'х': 'x',
+	'α': 'a', 'ι': 'i', 'κ': 'k', 'ν': 'v', 'ο': 'o', 'ρ': 'p', 'υ': 'u', 'χ': 'x',
+}
+
+// scriptOf names the script of letter r, or returns "" for characters
+// shared between scripts, such as digits and hyphens.
+func scriptOf(r rune) string {
+	if r <= unicode.MaxASCII {
+		if unicode.IsLetter(r) {
+			return "Latin"
+		}
+		return ""
+	}
+	for name, table := range unicode.Scripts {
+		if name != "Common" && name != "Inherited" && unicode.Is(table, r) {
+			return name
+		}
+	}
+	return ""
+}
+
+// homographWarnings returns the homograph warnings for the ASCII domain,
+// judged by how its labels read once decoded.
+func homographWarnings(ascii string) []string {
+	if !strings.Contains(ascii, "xn--") {
+		return nil
+	}
+	unicodeDomain, err := domainProfile.ToUnicode(ascii)
+	if err != nil {
+		return nil
+	}
+	var mixed, confusable bool
+	for _, label := range strings.Split(unicodeDomain, ".") {
+		scripts := make(map[string]bool)
+		lookalikes, others := 0, 0
+		for _, r := range label {
+			if script := scriptOf(r); script != "" {
+				if cjkScripts[script] {
+					script = "CJK"
+				}
+				scripts[script] = true
+			}
+			if _, ok := latinLookalikes[r]; ok {
+				lookalikes++
+			} else if r > unicode.MaxASCII && unicode.IsLetter(r) {
+				others++
+			}
+		}
+		if len(scripts) > 1 && !(len(scripts) == 2 && scripts["Latin"] && scripts["CJK"]) {
+			mixed = true
+		}
+		if lookalikes > 0 && others == 0 {
+			confusable = true
+		}
+	}
+	var warnings []string
+	if mixed {
+		warnings = append(warnings, WarningMixedScriptDomain)
+	}
+	if confusable {
+		warnings = append(warnings, WarningConfusableDomain)
+	}
+	return warnings
+}
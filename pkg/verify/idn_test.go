@@ -0,0 +1,96 @@
+package verify
+
+import (
+	"net"
+	"slices"
+	"testing"
+
+	"email-verifier/pkg/verify/verifytest"
+)
+
+// TestParseAddressIDN tests that internationalized addresses are valid, with their domains in punycode
+func TestParseAddressIDN(t *testing.T) {
+	verifier, err := sharedListVerifier()
+	if err != nil {
+		t.Fatal(err)
+	}
+	testCases := []struct {
+		email    string
+		valid    bool
+		domain   string
+		smtputf8 bool
+	}{
+		{"jane@example.com", true, "example.com", false},
+		{"müller@Bücher.de", true, "xn--bcher-kva.de", true},
+		{"jane@bücher.de", true, "xn--bcher-kva.de", false},
+		{"用户@例子.广告", true, "xn--fsqu00a.xn--4rr70v", true},
+		{"jane@xn--bcher-kva.de", true, "xn--bcher-kva.de", false},
+		{"😀@example.com", true, "example.com", true},
+		{"ja\u0007ne@bücher.de", false, "", false},
+		{"jane　doe@example.com", false, "", false},
+		{"jane@bü..de", false, "", false},
+		{"jane@-bücher.de", false, "", false},
+	}
+	for _, tc := range testCases {
+		addr := parseAddress(verifier, tc.email)
+		if addr.Valid != tc.valid || addr.Domain != tc.domain || addr.SMTPUTF8 != tc.smtputf8 {
+			t.Errorf("Expected %q valid %v at %q with smtputf8 %v, got %+v", tc.email, tc.valid, tc.domain, tc.smtputf8, addr)
+		}
+	}
+}
+
+// TestHomographWarnings tests that mixed-script and lookalike domains are flagged, and ordinary IDNs are not
+func TestHomographWarnings(t *testing.T) {
+	testCases := map[string][]string{
+		"paypal.com":    nil,
+		"bücher.de":     nil,
+		"例子.广告":         nil,
+		"ソニーsony.jp":    nil,
+		"пример.рф":     nil,
+		"pаypal.com":    {WarningMixedScriptDomain, WarningConfusableDomain}, // Cyrillic а
+		"аррӏе.com":     {WarningConfusableDomain},                           // all Cyrillic
+		"gοοgle.com":    {WarningMixedScriptDomain, WarningConfusableDomain}, // Greek ο
+		"ѕberbank.рф":   {WarningMixedScriptDomain, WarningConfusableDomain},
+		"москваmsk.com": {WarningMixedScriptDomain},
+	}
+	for domain, expected := range testCases {
+		ascii, err := NormalizeDomain(domain)
+		if err != nil {
+			t.Fatalf("Expected %q to normalize, got %v", domain, err)
+		}
+		if got := homographWarnings(ascii); !slices.Equal(got, expected) {
+			t.Errorf("Expected %v for %s (%s), got %v", expected, domain, ascii, got)
+		}
+	}
+}
+
+// TestVerifyIDN tests that internationalized addresses are looked up by their ASCII domain and not probed without SMTPUTF8
+func TestVerifyIDN(t *testing.T) {
+	fake := verifytest.NewResolver()
+	fake.MX["xn--bcher-kva.mock"] = []*net.MX{{Host: "mx.xn--bcher-kva.mock.", Pref: 10}}
+	smtp := verifytest.NewSMTP()
+	smtp.Mailboxes["jane@xn--bcher-kva.mock"] = true
+	s := newTestService(Config{Resolver: fake, Prober: smtp.Probe})
+	opts := Options{Checks: MustParseChecks(CheckMX, CheckSMTP)}
+
+	result := s.Verify("jane@Bücher.mock", opts)
+	if result.Email != "jane@Bücher.mock" || result.Domain != "bücher.mock" || result.ASCIIDomain != "xn--bcher-kva.mock" {
+		t.Errorf("Expected the address as written with its ASCII domain, got %+v", result)
+	}
+	if !result.HasMxRecords || result.Reachable != ReachableYes || result.RequiresSMTPUTF8 {
+		t.Errorf("Expected the mailbox found at the punycode domain, got %+v", result)
+	}
+
+	before := smtp.Probes()
+	result = s.Verify("müller@bücher.mock", opts)
+	if !result.IsValid || !result.RequiresSMTPUTF8 || result.SMTPSkippedReason != SMTPSkippedSMTPUTF8 || result.Reachable != ReachableUnknown {
+		t.Errorf("Expected a valid address left unprobed, got %+v", result)
+	}
+	if smtp.Probes() != before {
+		t.Errorf("Expected no probe of a non-ASCII mailbox, got %d", smtp.Probes()-before)
+	}
+	results, _ := s.VerifyBatch([]string{"müller@bücher.mock", "jane@bücher.mock"}, opts)
+	if results[0].SMTPSkippedReason != SMTPSkippedSMTPUTF8 || results[1].Reachable != ReachableYes {
+		t.Errorf("Expected the batch to probe only the ASCII mailbox, got %+v and %+v", results[0], results[1])
+	}
+}
@@ -0,0 +1,129 @@
+package verify
+
+import (
+	"context"
+	"errors"
+	"strings"
+
+	"golang.org/x/net/idna"
+)
+
+// DomainResult is what a domain on its own says about the addresses at
+// it: its mail setup and the free, disposable and typo lists. Its JSON
+// form is the server's response body for a domain inspection.
+type DomainResult struct {
+	// Domain is the domain as looked up: lowercased, without a trailing
+	// dot, and in its ASCII (punycode) form. UnicodeDomain is set when
+	// that differs from how the domain reads.
+	Domain        string `json:"domain"`
+	UnicodeDomain string `json:"unicode_domain,omitempty"`
+	IsValid       bool   `json:"is_valid"`
+
+	HasMxRecords bool       `json:"has_mx_records"`
+	MXRecords    []MXRecord `json:"mx_records"`
+	NullMX       bool       `json:"null_mx,omitempty"`
+	MXFallbackA  bool       `json:"mx_fallback_a,omitempty"`
+	DNSError     string     `json:"dns_error,omitempty"`
+	DomainStatus string     `json:"domain_status,omitempty"`
+	DomainReason string     `json:"domain_reason,omitempty"`
+	Disposable   bool       `json:"disposable"`
+	Free         bool       `json:"free"`
+	Suggestion   string     `json:"suggestion,omitempty"`
+	// DNS is only set when key's default checks include CheckAuthRecords.
+	DNS *DNSRecords `json:"dns,omitempty"`
+
+	Error        string   `json:"error,omitempty"`
+	ErrorCode    string   `json:"error_code,omitempty"`
+	ErrorMessage string   `json:"error_message,omitempty"`
+	Warnings     []string `json:"warnings,omitempty"`
+}
+
+// errInvalidDomain is returned by NormalizeDomain.
+var errInvalidDomain = errors.New("not a valid domain name")
+
+// domainProfile converts domains as idna.Lookup does, and also rejects
+// empty and overlong labels.
+var domainProfile = idna.New(idna.MapForLookup(), idna.BidiRule(), idna.VerifyDNSLength(true))
+
+// NormalizeDomain returns domain trimmed, lowercased, without a trailing
+// dot and with internationalized labels converted to punycode, so
+// "Bücher.Example." becomes "xn--bcher-kva.example".
+func NormalizeDomain(domain string) (string, error) {
+	domain = strings.TrimSuffix(strings.TrimSpace(domain), ".")
+	if domain == "" {
+		return "", errInvalidDomain
+	}
+	ascii, err := domainProfile.ToASCII(domain)
+	if err != nil {
+		return "", errInvalidDomain
+	}
+	return strings.ToLower(ascii), nil
+}
+
+// InspectDomain reports on domain without an address at it. It runs the
+// verifier's list and DNS checks against a placeholder mailbox at the
+// domain, under the policy lists of key's tenant.
+func (s *Service) InspectDomain(ctx context.Context, domain, key string) *DomainResult {
+	result := &DomainResult{Domain: strings.ToLower(strings.TrimSpace(domain)), MXRecords: []MXRecord{}}
+	ascii, err := NormalizeDomain(domain)
+	if err != nil {
+		s.setDomainError(result, ErrCodeInvalidSyntax, err)
+		return result
+	}
+	result.Domain = ascii
+	if unicode, err := domainProfile.ToUnicode(ascii); err == nil && unicode != ascii {
+		result.UnicodeDomain = unicode
+	}
+
+	verifier, err := s.verifiers.Get()
+	if err != nil {
+		s.setDomainError(result, ErrCodeVerifierUnavailable, err)
+		return result
+	}
+	// Only the domain part of the placeholder is of interest, and the
+	// library validates whole addresses
+	placeholder := "postmaster@" + ascii
+	if addr, ok := classifySpecialAddress(placeholder); ok {
+		result.IsValid = addr.Status != DomainIPLiteral
+		result.DomainStatus, result.DomainReason = addr.Status, addr.Reason
+		return result
+	}
+	if result.IsValid = verifier.ParseAddress(placeholder).Valid; !result.IsValid {
+		s.setDomainError(result, ErrCodeInvalidSyntax, nil)
+		return result
+	}
+
+	checks := MustParseChecks(CheckFree, CheckDisposable, CheckSuggest)
+	facts := s.lookupDomainFacts(ctx, verifier, ascii, checks, s.keyTenants[key])
+	result.Free, result.Disposable, result.Suggestion = facts.Free, facts.Disposable, facts.Suggestion
+	if s.NetworkDisabled() {
+		result.Warnings = append(result.Warnings, WarningNetworkDisabled)
+		return result
+	}
+
+	s.domainStatus(ctx, s.resolver, ascii, facts)
+	s.dnsRecords(ctx, s.resolver, ascii, s.ChecksFor(key), facts)
+	result.DNS = facts.DNS
+	result.DomainStatus = facts.Status
+	result.HasMxRecords = facts.Status == DomainHasMail
+	result.NullMX = facts.Status == DomainNullMX
+	result.MXFallbackA = facts.Status == DomainNoMailService && !s.mxFallbackDisabled
+	if len(facts.MX) > 0 {
+		result.MXRecords = facts.MX
+	}
+	if facts.Status == DomainNXDomain {
+		result.DNSError = DNSErrorNXDomain
+	}
+	if err := facts.StatusErr; err != nil {
+		result.DNSError = DNSErrorKind(err)
+		s.setDomainError(result, ErrorCodeFor(err), err)
+	}
+	return result
+}
+
+// setDomainError is setError for a DomainResult.
+func (s *Service) setDomainError(result *DomainResult, code string, err error) {
+	scratch := &Result{}
+	s.setError(scratch, code, err)
+	result.ErrorCode, result.Error, result.ErrorMessage = scratch.ErrorCode, scratch.Error, scratch.ErrorMessage
+}
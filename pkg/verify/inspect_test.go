@@ -0,0 +1,73 @@
+package verify
+
+import (
+	"context"
+	"net"
+	"reflect"
+	"testing"
+
+	"email-verifier/pkg/verify/verifytest"
+)
+
+// TestNormalizeDomain tests that domains are lowercased, stripped of a trailing dot and converted to punycode
+func TestNormalizeDomain(t *testing.T) {
+	testCases := []struct {
+		domain   string
+		expected string
+		ok       bool
+	}{
+		{" Example.COM. ", "example.com", true},
+		{"Bücher.example", "xn--bcher-kva.example", true},
+		{"xn--bcher-kva.example", "xn--bcher-kva.example", true},
+		{"", "", false},
+		{"bad..example", "", false},
+	}
+	for _, tc := range testCases {
+		domain, err := NormalizeDomain(tc.domain)
+		if (err == nil) != tc.ok || domain != tc.expected {
+			t.Errorf("Expected %q (ok %v) for %q, got %q, %v", tc.expected, tc.ok, tc.domain, domain, err)
+		}
+	}
+}
+
+// TestInspectDomain tests the DNS and list facts reported for a domain on its own
+func TestInspectDomain(t *testing.T) {
+	fake := verifytest.NewResolver()
+	fake.MX["mail.mock"] = []*net.MX{{Host: "MX2.mail.mock.", Pref: 20}, {Host: "mx1.mail.mock.", Pref: 10}}
+	fake.MX["xn--bcher-kva.mock"] = []*net.MX{{Host: "mx.xn--bcher-kva.mock.", Pref: 5}}
+	fake.Hosts["webonly.mock"] = []string{"192.0.2.10"}
+	s := newTestService(Config{Resolver: fake})
+	ctx := context.Background()
+
+	result := s.InspectDomain(ctx, "Mail.mock", "")
+	expected := []MXRecord{{"mx1.mail.mock", 10}, {"mx2.mail.mock", 20}}
+	if !result.IsValid || !result.HasMxRecords || !reflect.DeepEqual(result.MXRecords, expected) {
+		t.Errorf("Expected MX hosts %v, got %+v", expected, result)
+	}
+
+	result = s.InspectDomain(ctx, "bücher.mock", "")
+	if result.Domain != "xn--bcher-kva.mock" || result.UnicodeDomain != "bücher.mock" || len(result.MXRecords) != 1 {
+		t.Errorf("Expected the punycode domain to be looked up, got %+v", result)
+	}
+
+	result = s.InspectDomain(ctx, "webonly.mock", "")
+	if result.HasMxRecords || result.DomainStatus != DomainNoMailService || result.MXRecords == nil || len(result.MXRecords) != 0 {
+		t.Errorf("Expected no MX hosts for a web-only domain, got %+v", result)
+	}
+
+	if result := s.InspectDomain(ctx, "gmail.com", ""); !result.Free || result.Disposable {
+		t.Errorf("Expected gmail.com to be free, got %+v", result)
+	}
+	if result := s.InspectDomain(ctx, "mailinator.com", ""); !result.Disposable {
+		t.Errorf("Expected mailinator.com to be disposable, got %+v", result)
+	}
+	if result := s.InspectDomain(ctx, "gmaii.com", ""); result.Suggestion != "gmail.com" {
+		t.Errorf("Expected the suggestion gmail.com, got %q", result.Suggestion)
+	}
+	if result := s.InspectDomain(ctx, "localhost", ""); result.DomainStatus != DomainNonRoutable || result.HasMxRecords {
+		t.Errorf("Expected localhost to be non-routable, got %+v", result)
+	}
+	if result := s.InspectDomain(ctx, "not a domain", ""); result.IsValid || result.ErrorCode != ErrCodeInvalidSyntax {
+		t.Errorf("Expected an invalid domain, got %+v", result)
+	}
+}
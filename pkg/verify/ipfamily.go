@@ -0,0 +1,123 @@
+package verify
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"time"
+)
+
+// IP preferences for SMTP probes: which address family of a mail server
+// is dialed first. The other family is still tried if the first fails.
+const (
+	IPPreferenceAuto = "auto" // alternate families, starting with the resolver's first answer
+	IPPreferenceV4   = "v4"
+	IPPreferenceV6   = "v6"
+)
+
+// Address families reported in Result.SMTPAddressFamily.
+const (
+	AddressFamilyIPv4 = "ipv4"
+	AddressFamilyIPv6 = "ipv6"
+)
+
+// ParseIPPreference validates an IP preference; "" means auto.
+func ParseIPPreference(s string) (string, error) {
+	switch s {
+	case "":
+		return IPPreferenceAuto, nil
+	case IPPreferenceAuto, IPPreferenceV4, IPPreferenceV6:
+		return s, nil
+	}
+	return "", fmt.Errorf("unknown IP preference %q: want auto, v4 or v6", s)
+}
+
+// addressFamily returns the family of ip, or "" if it isn't an address.
+func addressFamily(ip string) string {
+	addr := net.ParseIP(ip)
+	switch {
+	case addr == nil:
+		return ""
+	case addr.To4() != nil:
+		return AddressFamilyIPv4
+	default:
+		return AddressFamilyIPv6
+	}
+}
+
+// orderAddrs returns addrs in the order preference dials them: all of the
+// preferred family first, or with auto the families alternating as RFC
+// 8305 suggests, so a broken family costs one attempt rather than all of
+// them. The order within a family is kept; anything that isn't an address
+// is dropped.
+func orderAddrs(addrs []string, preference string) []string {
+	var v4, v6 []string
+	first := ""
+	for _, addr := range addrs {
+		family := addressFamily(addr)
+		if first == "" {
+			first = family
+		}
+		switch family {
+		case AddressFamilyIPv4:
+			v4 = append(v4, addr)
+		case AddressFamilyIPv6:
+			v6 = append(v6, addr)
+		}
+	}
+	switch preference {
+	case IPPreferenceV4:
+		return append(v4, v6...)
+	case IPPreferenceV6:
+		return append(v6, v4...)
+	}
+	primary, secondary := v4, v6
+	if first == AddressFamilyIPv6 {
+		primary, secondary = v6, v4
+	}
+	ordered := make([]string, 0, len(v4)+len(v6))
+	for i := 0; i < max(len(primary), len(secondary)); i++ {
+		if i < len(primary) {
+			ordered = append(ordered, primary[i])
+		}
+		if i < len(secondary) {
+			ordered = append(ordered, secondary[i])
+		}
+	}
+	return ordered
+}
+
+// dialAddrs connects to host on port within timeout, looking up its A and
+// AAAA records with resolver and trying the addresses in the order
+// c.IPPreference gives, each with an even share of the time left. It
+// returns the connection and its address family, or the first error. The
+// lookup and every dial stop once ctx ends.
+func (c *SMTPClient) dialAddrs(ctx context.Context, resolver Resolver, host, port string, timeout time.Duration) (net.Conn, string, error) {
+	deadline := time.Now().Add(timeout)
+	addrs := []string{host}
+	if addressFamily(host) == "" {
+		ctx, cancel := context.WithDeadline(ctx, deadline)
+		defer cancel()
+		found, err := resolver.LookupHost(ctx, host)
+		if err != nil {
+			return nil, "", err
+		}
+		if addrs = orderAddrs(found, c.IPPreference); len(addrs) == 0 {
+			return nil, "", &net.DNSError{Err: "no addresses", Name: host, IsNotFound: true}
+		}
+	}
+	var firstErr error
+	var dialer net.Dialer
+	for i, addr := range addrs {
+		dialCtx, cancel := context.WithTimeout(ctx, time.Until(deadline)/time.Duration(len(addrs)-i))
+		conn, err := dialer.DialContext(dialCtx, "tcp", net.JoinHostPort(addr, port))
+		cancel()
+		if err == nil {
+			return conn, addressFamily(addr), nil
+		}
+		if firstErr == nil {
+			firstErr = err
+		}
+	}
+	return nil, "", firstErr
+}
@@ -0,0 +1,58 @@
+package verify
+
+import (
+	"context"
+	"net"
+	"reflect"
+	"testing"
+
+	"email-verifier/pkg/verify/verifytest"
+)
+
+// TestOrderAddrs tests that each IP preference dials its family first and auto alternates families
+func TestOrderAddrs(t *testing.T) {
+	addrs := []string{"192.0.2.1", "192.0.2.2", "2001:db8::1", "not-an-ip", "2001:db8::2"}
+	testCases := []struct {
+		preference string
+		addrs      []string
+		expected   []string
+	}{
+		{IPPreferenceV4, addrs, []string{"192.0.2.1", "192.0.2.2", "2001:db8::1", "2001:db8::2"}},
+		{IPPreferenceV6, addrs, []string{"2001:db8::1", "2001:db8::2", "192.0.2.1", "192.0.2.2"}},
+		{IPPreferenceAuto, addrs, []string{"192.0.2.1", "2001:db8::1", "192.0.2.2", "2001:db8::2"}},
+		{IPPreferenceAuto, []string{"2001:db8::1", "192.0.2.1", "192.0.2.2"}, []string{"2001:db8::1", "192.0.2.1", "192.0.2.2"}},
+		{IPPreferenceV6, []string{"192.0.2.1"}, []string{"192.0.2.1"}},
+	}
+	for _, tc := range testCases {
+		if got := orderAddrs(tc.addrs, tc.preference); !reflect.DeepEqual(got, tc.expected) {
+			t.Errorf("Expected %v for %s, got %v", tc.expected, tc.preference, got)
+		}
+	}
+
+	if _, err := ParseIPPreference("v5"); err == nil {
+		t.Error("Expected an unknown preference to be rejected")
+	}
+	if preference, err := ParseIPPreference(""); err != nil || preference != IPPreferenceAuto {
+		t.Errorf("Expected auto by default, got %q and %v", preference, err)
+	}
+}
+
+// TestSMTPClientIPFallback tests that a mail server whose preferred family can't be reached is dialed over the other one
+func TestSMTPClientIPFallback(t *testing.T) {
+	fake := verifytest.NewResolver()
+	fake.MX["dual.mock"] = []*net.MX{{Host: "mx.dual.mock", Pref: 10}}
+	fake.Hosts["mx.dual.mock"] = []string{"127.0.0.1", "::1"}
+	fake.MX["v6only.mock"] = []*net.MX{{Host: "mx.v6only.mock", Pref: 10}}
+	fake.Hosts["mx.v6only.mock"] = []string{"::1"}
+	client := NewSMTPClient(Profile{})
+	client.port = serveSMTP(t, nil)
+	client.IPPreference = IPPreferenceV6
+
+	smtp, peer, err := client.check(context.Background(), fake, "dual.mock", "jane", false)
+	if err != nil || !smtp.Deliverable || peer.host != "mx.dual.mock" || peer.family != AddressFamilyIPv4 {
+		t.Errorf("Expected jane deliverable over IPv4 after IPv6 failed, got %+v from %+v and %v", smtp, peer, err)
+	}
+	if smtp, _, err := client.check(context.Background(), fake, "v6only.mock", "jane", false); err == nil || smtp.HostExists {
+		t.Errorf("Expected a server with IPv6 only to be unreachable, got %+v and %v", smtp, err)
+	}
+}
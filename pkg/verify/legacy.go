@@ -0,0 +1,116 @@
+package verify
+
+import "strings"
+
+// Legacy routing forms reported in Result.LegacyFormat.
+const (
+	// LegacySourceRoute is an RFC 822 source route, @a,@b:user@c.
+	LegacySourceRoute = "source_route"
+	// LegacyPercentHack is percent-hack relaying, user%host@relay.
+	LegacyPercentHack = "percent_hack"
+	// LegacyBangPath is a UUCP bang path, host!user.
+	LegacyBangPath = "uucp_bang_path"
+)
+
+// WarningLegacyRoutingForm is reported when the submitted address used a
+// legacy routing form and the final mailbox was verified instead.
+const WarningLegacyRoutingForm = "legacy_routing_form"
+
+// How Config.LegacyAddresses treats legacy routing forms.
+const (
+	// LegacyExtract verifies the final mailbox of source routes and
+	// percent-hack addresses. It is the default.
+	LegacyExtract = "extract"
+	// LegacyReject classifies legacy forms and fails them with
+	// ErrCodeLegacyNotAccepted.
+	LegacyReject = "reject"
+)
+
+// legacyAddress is a submitted address in a legacy routing form.
+type legacyAddress struct {
+	Form string
+	// Mailbox is the final user@domain, or "" when it can't be told
+	// unambiguously.
+	Mailbox string
+}
+
+// parseLegacyAddress recognizes source routes, percent-hack addresses and
+// UUCP bang paths. ok is false for anything else, including local parts
+// that merely contain % or !, which are left to the syntax check.
+//
+// Bang paths are only recognized without an @: RFC 976 gives no single
+// reading of mixed forms such as a!user@b, and ! is legal in a local part.
+// A bang path names UUCP hosts rather than a mailbox on the internet, so it
+// never has an unambiguous Mailbox.
+func parseLegacyAddress(email string) (addr legacyAddress, ok bool) {
+	email = strings.TrimSuffix(strings.TrimPrefix(email, "<"), ">")
+
+	if strings.HasPrefix(email, "@") {
+		route, rest, found := strings.Cut(email, ":")
+		if !found {
+			return addr, false
+		}
+		addr.Form = LegacySourceRoute
+		for _, hop := range strings.Split(route, ",") {
+			if !strings.HasPrefix(hop, "@") || !validHostname(hop[1:]) {
+				return addr, true
+			}
+		}
+		if user, domain, found := strings.Cut(rest, "@"); found && user != "" && !strings.ContainsAny(user, "%!") && validHostname(domain) {
+			addr.Mailbox = rest
+		}
+		return addr, true
+	}
+
+	at := strings.LastIndex(email, "@")
+	if at < 0 {
+		hops := strings.Split(email, "!")
+		if len(hops) < 2 || hops[len(hops)-1] == "" {
+			return addr, false
+		}
+		for _, hop := range hops[:len(hops)-1] {
+			if !validLabelPath(strings.ToLower(hop)) {
+				return addr, false
+			}
+		}
+		return legacyAddress{Form: LegacyBangPath}, true
+	}
+
+	local, relay := email[:at], email[at+1:]
+	user, route, found := strings.Cut(local, "%")
+	if !found || !validHostname(relay) {
+		return addr, false
+	}
+	hosts := strings.Split(route, "%")
+	for _, host := range hosts {
+		if !validHostname(host) {
+			return addr, false
+		}
+	}
+	addr.Form = LegacyPercentHack
+	// Each relay strips the rightmost hop, so the leftmost host is the
+	// final destination
+	if user != "" && !strings.ContainsAny(user, "@!") {
+		addr.Mailbox = user + "@" + hosts[0]
+	}
+	return addr, true
+}
+
+// validHostname reports whether s is a dotted hostname of LDH labels.
+func validHostname(s string) bool {
+	return strings.Contains(s, ".") && validLabelPath(strings.ToLower(s))
+}
+
+// validLabelPath reports whether s is one or more dot-separated LDH
+// labels.
+func validLabelPath(s string) bool {
+	if s == "" {
+		return false
+	}
+	for _, label := range strings.Split(s, ".") {
+		if !validLabel(label) {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,120 @@
+package verify
+
+import (
+	"context"
+	"net"
+	"slices"
+	"testing"
+
+	emailverifier "github.com/AfterShip/email-verifier"
+
+	"email-verifier/pkg/verify/verifytest"
+)
+
+// TestParseLegacyAddress tests RFC 822 and RFC 976 era routing forms
+func TestParseLegacyAddress(t *testing.T) {
+	testCases := []struct {
+		email   string
+		form    string
+		mailbox string
+	}{
+		// RFC 822 source routes
+		{"@relay.mock:jane@partner.mock", LegacySourceRoute, "jane@partner.mock"},
+		{"<@ARPA.ARPA,@WASHINGTON.ARPA:JONES@USC-ISIF.ARPA>", LegacySourceRoute, "JONES@USC-ISIF.ARPA"},
+		{"@a.mock,@b.mock,@c.mock:user@d.mock", LegacySourceRoute, "user@d.mock"},
+		{"@relay.mock:jane", LegacySourceRoute, ""},
+		{"@relay.mock,relay2.mock:jane@partner.mock", LegacySourceRoute, ""},
+		{"@relay.mock:jane%inner.mock@partner.mock", LegacySourceRoute, ""},
+		{"@partner.mock", "", ""},
+
+		// Percent hack, relayed right to left
+		{"jane%partner.mock@relay.mock", LegacyPercentHack, "jane@partner.mock"},
+		{"user%final.mock%hop.mock@relay.mock", LegacyPercentHack, "user@final.mock"},
+		{"%partner.mock@relay.mock", LegacyPercentHack, ""},
+		{"50%off@shop.mock", "", ""},
+		{"jane%partner@relay.mock", "", ""},
+
+		// UUCP bang paths
+		{"ucbvax!seismo!user", LegacyBangPath, ""},
+		{"host!user", LegacyBangPath, ""},
+		{"host!user@relay.mock", "", ""},
+		{"hey!", "", ""},
+		{"plain@partner.mock", "", ""},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.email, func(t *testing.T) {
+			addr, ok := parseLegacyAddress(tc.email)
+			if ok != (tc.form != "") || addr.Form != tc.form {
+				t.Fatalf("Expected form %q, got %q (ok %v)", tc.form, addr.Form, ok)
+			}
+			if addr.Mailbox != tc.mailbox {
+				t.Errorf("Expected mailbox %q, got %q", tc.mailbox, addr.Mailbox)
+			}
+		})
+	}
+}
+
+// TestVerifyLegacyAddress tests that the final mailbox is verified, and that ambiguous or rejected forms fail with their own codes
+func TestVerifyLegacyAddress(t *testing.T) {
+	fake := verifytest.NewResolver()
+	fake.MX["partner.mock"] = []*net.MX{{Host: "mx.partner.mock.", Pref: 10}}
+	var probed []string
+	prober := func(ctx context.Context, profile, domain, username string, catchAll bool) (*emailverifier.SMTP, error) {
+		probed = append(probed, username+"@"+domain)
+		return &emailverifier.SMTP{HostExists: true, Deliverable: true}, nil
+	}
+
+	testCases := []struct {
+		mode    string
+		email   string
+		code    string
+		verdict string
+	}{
+		{LegacyExtract, "jane%partner.mock@relay.mock", "", VerdictDeliverable},
+		{LegacyExtract, "@relay.mock:jane@partner.mock", "", VerdictDeliverable},
+		{LegacyExtract, "seismo!jane", ErrCodeAmbiguousLegacyRoute, VerdictInvalid},
+		{LegacyReject, "jane%partner.mock@relay.mock", ErrCodeLegacyNotAccepted, VerdictInvalid},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.mode+" "+tc.email, func(t *testing.T) {
+			probed = nil
+			s := newTestService(Config{Resolver: fake, Prober: prober, LegacyAddresses: tc.mode})
+			result := s.Verify(tc.email, Options{Checks: MustParseChecks(CheckSMTP)})
+			if result.ErrorCode != tc.code || result.Verdict != tc.verdict {
+				t.Fatalf("Expected %q and %s, got %q and %s", tc.code, tc.verdict, result.ErrorCode, result.Verdict)
+			}
+			if result.Email != tc.email || result.LegacyFormat == "" {
+				t.Errorf("Expected the submitted address and its legacy format, got %q and %q", result.Email, result.LegacyFormat)
+			}
+			if tc.code != "" {
+				return
+			}
+			if result.Domain != "partner.mock" || !slices.Equal(probed, []string{"jane@partner.mock"}) {
+				t.Errorf("Expected jane@partner.mock to be verified, got domain %q and probes %v", result.Domain, probed)
+			}
+			if !slices.Contains(result.Warnings, WarningLegacyRoutingForm) {
+				t.Errorf("Expected the %s warning, got %v", WarningLegacyRoutingForm, result.Warnings)
+			}
+		})
+	}
+}
+
+// TestVerifyBatchLegacyAddress tests that batches group legacy forms under their final mailbox's domain
+func TestVerifyBatchLegacyAddress(t *testing.T) {
+	fake := verifytest.NewResolver()
+	fake.MX["partner.mock"] = []*net.MX{{Host: "mx.partner.mock.", Pref: 10}}
+	s := newTestService(Config{Resolver: fake})
+
+	results, summary := s.VerifyBatch([]string{"jane%partner.mock@relay.mock", "john@partner.mock", "host!user"}, Options{Checks: MustParseChecks(CheckMX)})
+	if summary.Domains != 1 || summary.DNSLookups != 1 {
+		t.Errorf("Expected one domain and one lookup, got %+v", summary)
+	}
+	if results[0].Domain != "partner.mock" || !results[0].HasMxRecords {
+		t.Errorf("Expected the extracted mailbox's domain facts, got %+v", results[0])
+	}
+	if results[2].ErrorCode != ErrCodeAmbiguousLegacyRoute {
+		t.Errorf("Expected %s for the bang path, got %q", ErrCodeAmbiguousLegacyRoute, results[2].ErrorCode)
+	}
+}
@@ -0,0 +1,317 @@
+package verify
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	emailverifier "github.com/AfterShip/email-verifier"
+)
+
+// The lists CustomLists can add to or take entries off.
+const (
+	ListDisposable = "disposable"
+	ListFree       = "free"
+	ListRole       = "role"
+)
+
+// ListNames lists every list CustomLists manages.
+var ListNames = []string{ListDisposable, ListFree, ListRole}
+
+// ErrUnknownList is returned for a list name not in ListNames.
+var ErrUnknownList = fmt.Errorf("unknown list (use %s)", strings.Join(ListNames, ", "))
+
+// ErrInvalidListEntry is returned by CustomLists.Set for a value that
+// can't be on the list, such as an address on the disposable list.
+var ErrInvalidListEntry = errors.New("not a valid list entry")
+
+// CustomLists overlays the library's disposable and free domains and role
+// account local parts with entries of the server's own: some loaded from
+// files at startup, and overrides set at runtime that can also take an
+// entry off a list, library or file. Overrides win over files, which win
+// over the library. Overrides are saved to a file, if one is set, so they
+// survive restarts. It is safe for concurrent use.
+type CustomLists struct {
+	mu    sync.RWMutex
+	lists map[string]*customList
+	path  string // where overrides are saved; not saved if empty
+	now   func() time.Time
+}
+
+type customList struct {
+	file      map[string]bool
+	overrides map[string]bool // true adds the entry, false takes it off
+	modified  time.Time
+}
+
+// ListSummary describes one list's overlay for the admin listing.
+type ListSummary struct {
+	FromFile   int        `json:"from_file"`
+	Added      int        `json:"added"`
+	Removed    int        `json:"removed"`
+	ModifiedAt *time.Time `json:"modified_at,omitempty"`
+}
+
+// listOverrides is the saved form of the overrides.
+type listOverrides map[string]struct {
+	Add        []string  `json:"add,omitempty"`
+	Remove     []string  `json:"remove,omitempty"`
+	ModifiedAt time.Time `json:"modified_at"`
+}
+
+// NewCustomLists returns empty lists whose overrides are saved to path,
+// or not saved if path is empty.
+func NewCustomLists(path string) *CustomLists {
+	c := &CustomLists{lists: make(map[string]*customList), path: path, now: time.Now}
+	for _, name := range ListNames {
+		c.lists[name] = &customList{file: make(map[string]bool), overrides: make(map[string]bool)}
+	}
+	return c
+}
+
+// LoadCustomLists reads each list's file, named by list in files, and the
+// overrides saved at path if there are any. A list file has one entry per
+// line; blank lines and lines starting with # are skipped.
+func LoadCustomLists(files map[string]string, path string) (*CustomLists, error) {
+	c := NewCustomLists(path)
+	for name, file := range files {
+		list, ok := c.lists[name]
+		if !ok {
+			return nil, ErrUnknownList
+		}
+		if file == "" {
+			continue
+		}
+		entries, err := ReadListFile(file)
+		if err != nil {
+			return nil, fmt.Errorf("%s list %s: %w", name, file, err)
+		}
+		for _, entry := range entries {
+			if entry = normalizeListEntry(name, entry); entry != "" {
+				list.file[entry] = true
+			}
+		}
+	}
+	if path == "" {
+		return c, nil
+	}
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return c, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var saved listOverrides
+	if err := json.Unmarshal(data, &saved); err != nil {
+		return nil, fmt.Errorf("parse list overrides %s: %v", path, err)
+	}
+	for name, overrides := range saved {
+		list, ok := c.lists[name]
+		if !ok {
+			return nil, fmt.Errorf("list overrides %s: %w", path, ErrUnknownList)
+		}
+		for _, entry := range overrides.Add {
+			list.overrides[entry] = true
+		}
+		for _, entry := range overrides.Remove {
+			list.overrides[entry] = false
+		}
+		list.modified = overrides.ModifiedAt
+	}
+	return c, nil
+}
+
+// ReadListFile returns the entries of a list file, one per line, skipping
+// blank lines and lines starting with #.
+func ReadListFile(path string) ([]string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	var entries []string
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		if line := strings.TrimSpace(scanner.Text()); line != "" && !strings.HasPrefix(line, "#") {
+			entries = append(entries, line)
+		}
+	}
+	return entries, scanner.Err()
+}
+
+// normalizeListEntry lowercases entry, taking the domain lists' entries
+// to their ASCII form. It returns "" for an entry that can't be on list.
+func normalizeListEntry(list, entry string) string {
+	entry = strings.TrimSpace(entry)
+	if list == ListRole {
+		if entry == "" || strings.ContainsAny(entry, "@ ") {
+			return ""
+		}
+		return strings.ToLower(entry)
+	}
+	domain, err := NormalizeDomain(strings.TrimPrefix(entry, "@"))
+	if err != nil {
+		return ""
+	}
+	return domain
+}
+
+// Set puts value on list, or takes it off if on is false, whatever the
+// library and the list's file say, and saves the overrides. It returns the
+// entry as stored.
+func (c *CustomLists) Set(list, value string, on bool) (string, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	l, ok := c.lists[list]
+	if !ok {
+		return "", ErrUnknownList
+	}
+	entry := normalizeListEntry(list, value)
+	if entry == "" {
+		return "", fmt.Errorf("%q is %w for %s", value, ErrInvalidListEntry, list)
+	}
+	previous, had := l.overrides[entry]
+	previousModified := l.modified
+	l.overrides[entry], l.modified = on, c.now().UTC()
+	if err := c.save(); err != nil {
+		// Keep memory and disk in step
+		if had {
+			l.overrides[entry] = previous
+		} else {
+			delete(l.overrides, entry)
+		}
+		l.modified = previousModified
+		return "", err
+	}
+	return entry, nil
+}
+
+// save writes the overrides to c.path through a temporary file, so a
+// crash leaves the old file or the new one. It must be called with the
+// lock held.
+func (c *CustomLists) save() error {
+	if c.path == "" {
+		return nil
+	}
+	saved := make(listOverrides)
+	for name, list := range c.lists {
+		if len(list.overrides) == 0 {
+			continue
+		}
+		overrides := saved[name]
+		for entry, on := range list.overrides {
+			if on {
+				overrides.Add = append(overrides.Add, entry)
+			} else {
+				overrides.Remove = append(overrides.Remove, entry)
+			}
+		}
+		sort.Strings(overrides.Add)
+		sort.Strings(overrides.Remove)
+		overrides.ModifiedAt = list.modified
+		saved[name] = overrides
+	}
+	data, err := json.MarshalIndent(saved, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(c.path), ".list-overrides-*")
+	if err != nil {
+		return fmt.Errorf("save list overrides: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return fmt.Errorf("save list overrides: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("save list overrides: %w", err)
+	}
+	if err := os.Rename(tmp.Name(), c.path); err != nil {
+		return fmt.Errorf("save list overrides: %w", err)
+	}
+	return nil
+}
+
+// lookup returns whether the overlay puts value on list or takes it off;
+// ok is false if it says nothing and the library decides. A nil
+// CustomLists says nothing.
+func (c *CustomLists) lookup(list, value string) (on, ok bool) {
+	if c == nil {
+		return false, false
+	}
+	value = strings.ToLower(value)
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	l := c.lists[list]
+	if on, ok := l.overrides[value]; ok {
+		return on, true
+	}
+	if l.file[value] {
+		return true, true
+	}
+	return false, false
+}
+
+// Summary describes each list's overlay, by list name.
+func (c *CustomLists) Summary() map[string]ListSummary {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	summary := make(map[string]ListSummary, len(c.lists))
+	for name, list := range c.lists {
+		s := ListSummary{FromFile: len(list.file)}
+		for _, on := range list.overrides {
+			if on {
+				s.Added++
+			} else {
+				s.Removed++
+			}
+		}
+		if !list.modified.IsZero() {
+			modified := list.modified
+			s.ModifiedAt = &modified
+		}
+		summary[name] = s
+	}
+	return summary
+}
+
+// isFree reports whether domain is a free provider's.
+func (s *Service) isFree(verifier *emailverifier.Verifier, domain string) bool {
+	if on, ok := s.lists.lookup(ListFree, domain); ok {
+		return on
+	}
+	return verifier.IsFreeDomain(domain)
+}
+
+// isDisposable reports whether domain is disposable. A tenant's own list
+// adds to the server-wide one.
+func (s *Service) isDisposable(verifier *emailverifier.Verifier, domain string, tenant *tenantPolicy) bool {
+	if tenant.isDisposable(domain) {
+		return true
+	}
+	if on, ok := s.lists.lookup(ListDisposable, domain); ok {
+		return on
+	}
+	return verifier.IsDisposable(domain)
+}
+
+// isRole reports whether username is a role account's. A tenant's own
+// list adds to the server-wide one.
+func (s *Service) isRole(verifier *emailverifier.Verifier, username string, tenant *tenantPolicy) bool {
+	if tenant.isRole(username) {
+		return true
+	}
+	if on, ok := s.lists.lookup(ListRole, username); ok {
+		return on
+	}
+	return verifier.IsRoleAccount(username)
+}
@@ -0,0 +1,87 @@
+package verify
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// TestCustomLists tests that files and runtime overrides change what verifications report, overrides winning
+func TestCustomLists(t *testing.T) {
+	dir := t.TempDir()
+	file := filepath.Join(dir, "disposable.txt")
+	os.WriteFile(file, []byte("# seen in abuse\nBurner.Mock\n\n@throwaway.mock\npartner.mock\n"), 0o600)
+	lists, err := LoadCustomLists(map[string]string{ListDisposable: file}, filepath.Join(dir, "overrides.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := newTestService(Config{Lists: lists})
+	opts := Options{Checks: MustParseChecks(CheckFree, CheckRole, CheckDisposable)}
+
+	for _, email := range []string{"jane@burner.mock", "jane@throwaway.mock", "jane@mailinator.com"} {
+		if !s.Verify(email, opts).Disposable {
+			t.Errorf("Expected %s to be disposable", email)
+		}
+	}
+
+	// The partner domain comes off the file list, and the built-in one
+	for _, domain := range []string{"partner.mock", "Mailinator.com"} {
+		if _, err := lists.Set(ListDisposable, domain, false); err != nil {
+			t.Fatal(err)
+		}
+		if s.Verify("jane@"+domain, opts).Disposable {
+			t.Errorf("Expected %s to be taken off the disposable list", domain)
+		}
+	}
+	lists.Set(ListFree, "mail.partner.mock", true)
+	lists.Set(ListRole, "Billing", true)
+	lists.Set(ListRole, "admin", false)
+	if result := s.Verify("billing@mail.partner.mock", opts); !result.Free || !result.RoleAccount {
+		t.Errorf("Expected a free domain and a role account, got free %v, role %v", result.Free, result.RoleAccount)
+	}
+	if s.Verify("admin@acme.mock", opts).RoleAccount {
+		t.Error("Expected admin to be taken off the role list")
+	}
+
+	for _, tc := range []struct{ list, value string }{{"spam", "x.mock"}, {ListDisposable, "not a domain"}, {ListRole, "jane@acme.mock"}} {
+		if _, err := lists.Set(tc.list, tc.value, true); err == nil {
+			t.Errorf("Expected an error for %s on %s", tc.value, tc.list)
+		}
+	}
+
+	// The overrides survive a restart; the file entries come from the file
+	reloaded, err := LoadCustomLists(nil, filepath.Join(dir, "overrides.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	summary := reloaded.Summary()
+	if d := summary[ListDisposable]; d.Removed != 2 || d.Added != 0 || d.FromFile != 0 || d.ModifiedAt == nil {
+		t.Errorf("Expected 2 saved removals from the disposable list, got %+v", d)
+	}
+	if r := summary[ListRole]; r.Added != 1 || r.Removed != 1 {
+		t.Errorf("Expected the role overrides saved, got %+v", r)
+	}
+	if on, ok := reloaded.lookup(ListDisposable, "partner.mock"); !ok || on {
+		t.Error("Expected the partner domain to stay off the disposable list")
+	}
+	if lists.Summary()[ListDisposable].FromFile != 3 {
+		t.Errorf("Expected 3 entries from the file, got %+v", lists.Summary()[ListDisposable])
+	}
+}
+
+// TestCustomListsSaveFailure tests that an override that can't be saved is not applied
+func TestCustomListsSaveFailure(t *testing.T) {
+	lists := NewCustomLists(filepath.Join(t.TempDir(), "missing", "overrides.json"))
+	lists.now = func() time.Time { return time.Date(2024, 3, 3, 0, 0, 0, 0, time.UTC) }
+	if _, err := lists.Set(ListDisposable, "burner.mock", true); err == nil || !strings.Contains(err.Error(), "save list overrides") {
+		t.Fatalf("Expected a save error, got %v", err)
+	}
+	if _, ok := lists.lookup(ListDisposable, "burner.mock"); ok {
+		t.Error("Expected the unsaved override to be rolled back")
+	}
+	if lists.Summary()[ListDisposable].ModifiedAt != nil {
+		t.Error("Expected no modification time after a failed save")
+	}
+}
@@ -0,0 +1,168 @@
+package verify
+
+import (
+	"context"
+	"regexp"
+	"strings"
+)
+
+// DNSRecords reports whether a domain is set up to send mail: its SPF
+// record and its DMARC policy. A record that is published but can't be
+// parsed is present with its Valid field false. With CheckMTASTS it
+// also reports how the domain asks for mail to it to be encrypted, and
+// with CheckBIMI and CheckDKIM how it brands and signs its mail.
+type DNSRecords struct {
+	HasSPF   bool   `json:"has_spf"`
+	SPFValid bool   `json:"spf_valid"`
+	SPF      string `json:"spf_record,omitempty"`
+
+	HasDMARC    bool   `json:"has_dmarc"`
+	DMARCValid  bool   `json:"dmarc_valid"`
+	DMARC       string `json:"dmarc_record,omitempty"`
+	DMARCPolicy string `json:"dmarc_policy,omitempty"`
+
+	// MTASTSMode is the mode of the domain's MTA-STS policy, left out if
+	// it publishes none, or it couldn't be fetched or parsed.
+	MTASTSMode *string `json:"mta_sts_mode,omitempty"`
+	// HasTLSRPT is whether the domain publishes a TLS-RPT record, left
+	// out if the lookup failed.
+	HasTLSRPT *bool `json:"has_tls_rpt,omitempty"`
+
+	// HasBIMI is whether the domain publishes a BIMI record under the
+	// default selector, and BIMIValid whether it parses; both are left
+	// out if the lookup failed. BIMILogo is a valid record's logo URL,
+	// empty if the domain declines to show one.
+	HasBIMI   *bool  `json:"has_bimi,omitempty"`
+	BIMIValid *bool  `json:"bimi_valid,omitempty"`
+	BIMILogo  string `json:"bimi_logo,omitempty"`
+	// DKIMSelectors are the DefaultDKIMSelectors the domain publishes a
+	// key under.
+	DKIMSelectors []string `json:"dkim_selectors,omitempty"`
+
+	// Error is set when a lookup failed, as opposed to finding no record.
+	Error string `json:"error,omitempty"`
+}
+
+// DMARC policies, the p= tag.
+const (
+	DMARCNone       = "none"
+	DMARCQuarantine = "quarantine"
+	DMARCReject     = "reject"
+)
+
+// spfTerm matches one SPF mechanism or modifier (RFC 7208 section 4.6.1).
+var spfTerm = regexp.MustCompile(`^(?i:[+?~-]?(all|(include|exists):\S+|(a|mx)(:[^/\s]+)?(/\d{1,3})?(//\d{1,3})?|ptr(:\S+)?|ip4:[0-9.]+(/\d{1,2})?|ip6:[0-9a-f:.]+(/\d{1,3})?)|[a-z][a-z0-9_.-]*=\S*)$`)
+
+// parseSPF reports whether record, which starts with v=spf1, is made of
+// well-formed terms.
+func parseSPF(record string) bool {
+	terms := strings.Fields(record)
+	if len(terms) == 0 || !strings.EqualFold(terms[0], "v=spf1") {
+		return false
+	}
+	for _, term := range terms[1:] {
+		if !spfTerm.MatchString(term) {
+			return false
+		}
+	}
+	return true
+}
+
+// parseDMARC returns record's policy, and whether it is a valid DMARC
+// record: a v=DMARC1 tag first, then a p tag naming a policy.
+func parseDMARC(record string) (policy string, ok bool) {
+	tags := strings.Split(record, ";")
+	if strings.ReplaceAll(tags[0], " ", "") != "v=DMARC1" {
+		return "", false
+	}
+	for _, tag := range tags[1:] {
+		name, value, found := strings.Cut(strings.TrimSpace(tag), "=")
+		if !found {
+			if strings.TrimSpace(tag) == "" {
+				continue
+			}
+			return "", false
+		}
+		if strings.EqualFold(strings.TrimSpace(name), "p") {
+			policy = strings.ToLower(strings.TrimSpace(value))
+		}
+	}
+	switch policy {
+	case DMARCNone, DMARCQuarantine, DMARCReject:
+		return policy, true
+	}
+	return "", false
+}
+
+// lookupDNSRecords looks up domain's SPF and DMARC records. Only one SPF
+// record may be published, so several are reported as invalid.
+func lookupDNSRecords(ctx context.Context, resolver Resolver, domain string) *DNSRecords {
+	records := &DNSRecords{}
+	txt, err := resolver.LookupTXT(ctx, domain)
+	if err != nil && !IsNotFound(err) {
+		records.Error = err.Error()
+	}
+	var spf []string
+	for _, record := range txt {
+		if lower := strings.ToLower(record); lower == "v=spf1" || strings.HasPrefix(lower, "v=spf1 ") {
+			spf = append(spf, record)
+		}
+	}
+	if records.HasSPF = len(spf) > 0; records.HasSPF {
+		records.SPF = spf[0]
+		records.SPFValid = len(spf) == 1 && parseSPF(spf[0])
+	}
+
+	txt, err = resolver.LookupTXT(ctx, "_dmarc."+domain)
+	if err != nil && !IsNotFound(err) && records.Error == "" {
+		records.Error = err.Error()
+	}
+	for _, record := range txt {
+		if strings.HasPrefix(strings.ToLower(record), "v=dmarc1") {
+			records.HasDMARC, records.DMARC = true, record
+			records.DMARCPolicy, records.DMARCValid = parseDMARC(record)
+			break
+		}
+	}
+	return records
+}
+
+// only returns a copy of r with the sections the mail-auth checks in
+// checks report.
+func (r *DNSRecords) only(checks CheckSet) *DNSRecords {
+	records := *r
+	if !checks.Has(CheckMTASTS) {
+		records.MTASTSMode, records.HasTLSRPT = nil, nil
+	}
+	if !checks.Has(CheckBIMI) {
+		records.HasBIMI, records.BIMIValid, records.BIMILogo = nil, nil, ""
+	}
+	if !checks.Has(CheckDKIM) {
+		records.DKIMSelectors = nil
+	}
+	return &records
+}
+
+// dnsRecords fills in facts' SPF and DMARC records for domain, and the
+// MTA-STS, TLS-RPT, BIMI and DKIM ones checks asks for, from the domain
+// cache if it has them. It does nothing without CheckAuthRecords.
+func (s *Service) dnsRecords(ctx context.Context, resolver Resolver, domain string, checks CheckSet, facts *domainFacts) {
+	if !checks.Has(CheckAuthRecords) || facts.DNS != nil {
+		return
+	}
+	wanted := checks.dns()
+	if records, ok := s.domains.dnsRecords(domain, wanted); ok {
+		facts.DNS = records
+		for check := range wanted {
+			facts.fromCache(check)
+		}
+		return
+	}
+	facts.DNS = lookupDNSRecords(ctx, resolver, domain)
+	complete := !wanted.Has(CheckMTASTS) || s.lookupMTASTS(ctx, resolver, domain, facts.DNS)
+	complete = (!wanted.Has(CheckBIMI) || lookupBIMI(ctx, resolver, domain, facts.DNS)) && complete
+	complete = (!wanted.Has(CheckDKIM) || lookupDKIM(ctx, resolver, domain, facts.DNS)) && complete
+	if complete && facts.DNS.Error == "" && ctx.Err() == nil {
+		s.domains.putDNSRecords(domain, wanted, facts.DNS)
+	}
+}
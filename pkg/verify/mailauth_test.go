@@ -0,0 +1,100 @@
+package verify
+
+import (
+	"context"
+	"errors"
+	"net"
+	"reflect"
+	"testing"
+	"time"
+
+	"email-verifier/pkg/verify/verifytest"
+)
+
+// TestParseSPF tests which SPF records are well-formed
+func TestParseSPF(t *testing.T) {
+	testCases := map[string]bool{
+		"v=spf1 -all":                         true,
+		"v=spf1":                              true,
+		"V=SPF1 include:_spf.google.com ~all": true,
+		"v=spf1 ip4:192.0.2.0/24 ip6:2001:db8::1 a mx:mail.example.com/24 -all": true,
+		"v=spf1 redirect=_spf.example.com":                                      true,
+		"v=spf1 include: -all":                                                  false,
+		"v=spf1 ip4:not-an-ip -all":                                             false,
+		"v=spf1 +bogus":                                                         false,
+	}
+	for record, valid := range testCases {
+		if got := parseSPF(record); got != valid {
+			t.Errorf("Expected valid %v for %q, got %v", valid, record, got)
+		}
+	}
+}
+
+// TestParseDMARC tests the policy read from DMARC records and which are malformed
+func TestParseDMARC(t *testing.T) {
+	testCases := []struct {
+		record string
+		policy string
+		valid  bool
+	}{
+		{"v=DMARC1; p=reject; rua=mailto:dmarc@example.com", DMARCReject, true},
+		{"v=DMARC1;p=Quarantine;", DMARCQuarantine, true},
+		{"v=DMARC1; p=none", DMARCNone, true},
+		{"v=DMARC1; rua=mailto:dmarc@example.com", "", false},
+		{"v=DMARC1; p=block", "", false},
+		{"p=reject; v=DMARC1", "", false},
+		{"v=DMARC1; p=reject; junk", "", false},
+	}
+	for _, tc := range testCases {
+		policy, valid := parseDMARC(tc.record)
+		if policy != tc.policy || valid != tc.valid {
+			t.Errorf("Expected %q (valid %v) for %q, got %q (valid %v)", tc.policy, tc.valid, tc.record, policy, valid)
+		}
+	}
+}
+
+// TestAuthRecords tests that SPF and DMARC are reported only when enabled, that malformed records are present but invalid, and that the domain cache keeps them
+func TestAuthRecords(t *testing.T) {
+	fake := verifytest.NewResolver()
+	for _, domain := range []string{"good.mock", "bad.mock", "none.mock"} {
+		fake.MX[domain] = []*net.MX{{Host: "mx." + domain + ".", Pref: 10}}
+	}
+	fake.TXT["good.mock"] = []string{"google-site-verification=abc", "v=spf1 include:_spf.good.mock -all"}
+	fake.TXT["_dmarc.good.mock"] = []string{"v=DMARC1; p=quarantine"}
+	fake.TXT["bad.mock"] = []string{"v=spf1 -all", "v=spf1 ~all"}
+	fake.TXT["_dmarc.bad.mock"] = []string{"v=DMARC1; p=maybe"}
+	opts := Options{Checks: DefaultChecks}
+
+	if result := newTestService(Config{Resolver: fake}).Verify("jane@good.mock", opts); result.DNS != nil {
+		t.Errorf("Expected no dns section by default, got %+v", result.DNS)
+	}
+
+	s := newTestService(Config{Resolver: fake, AuthRecords: true, DomainCacheTTL: time.Hour})
+	opts = Options{Checks: s.ChecksFor("")}
+	good := s.Verify("jane@good.mock", opts).DNS
+	expected := DNSRecords{HasSPF: true, SPFValid: true, SPF: "v=spf1 include:_spf.good.mock -all", HasDMARC: true, DMARCValid: true, DMARC: "v=DMARC1; p=quarantine", DMARCPolicy: DMARCQuarantine}
+	if good == nil || !reflect.DeepEqual(*good, expected) {
+		t.Fatalf("Expected %+v, got %+v", expected, good)
+	}
+	before := fake.Lookups()
+	if cached := s.Verify("john@good.mock", opts).DNS; cached == nil || !reflect.DeepEqual(*cached, expected) || fake.Lookups() != before {
+		t.Errorf("Expected the records from the domain cache, got %+v after %d lookups", cached, fake.Lookups()-before)
+	}
+
+	bad := s.Verify("jane@bad.mock", opts).DNS
+	if !bad.HasSPF || bad.SPFValid || !bad.HasDMARC || bad.DMARCValid || bad.DMARCPolicy != "" {
+		t.Errorf("Expected present but invalid records, got %+v", bad)
+	}
+	if none := s.Verify("jane@none.mock", opts).DNS; none.HasSPF || none.HasDMARC || none.Error != "" {
+		t.Errorf("Expected no records and no error, got %+v", none)
+	}
+
+	fake.MX["flaky.mock"] = []*net.MX{{Host: "mx.flaky.mock.", Pref: 10}}
+	fake.Err["_dmarc.flaky.mock"] = errors.New("i/o timeout")
+	if flaky := s.Verify("jane@flaky.mock", opts).DNS; flaky.Error == "" || flaky.HasDMARC {
+		t.Errorf("Expected the failed lookup to be reported, got %+v", flaky)
+	}
+	if result := s.InspectDomain(context.Background(), "good.mock", ""); result.DNS == nil || !reflect.DeepEqual(*result.DNS, expected) {
+		t.Errorf("Expected the records on a domain inspection, got %+v", result.DNS)
+	}
+}
@@ -0,0 +1,119 @@
+package verify
+
+import (
+	_ "embed"
+	"encoding/json"
+	"fmt"
+	"maps"
+	"os"
+	"sort"
+	"strings"
+)
+
+// MailProviderSelfHosted is the mail provider of a domain that no
+// signature matches and whose mail servers are its own.
+const MailProviderSelfHosted = "self-hosted"
+
+// MailProviderSignature tells a mail provider's servers apart: by the
+// domains its MX hosts are under, or by text its SMTP banners contain,
+// ignoring case.
+type MailProviderSignature struct {
+	MX     []string `json:"mx,omitempty"`
+	Banner []string `json:"banner,omitempty"`
+}
+
+//go:embed mailproviders.json
+var defaultMailProviders []byte
+
+// DefaultMailProviders are the built-in signatures, by provider name.
+var DefaultMailProviders = func() map[string]MailProviderSignature {
+	var signatures map[string]MailProviderSignature
+	if err := json.Unmarshal(defaultMailProviders, &signatures); err != nil {
+		panic("verify: mailproviders.json: " + err.Error())
+	}
+	return signatures
+}()
+
+// LoadMailProviders returns DefaultMailProviders with the signatures in
+// the JSON file at path, an object mapping provider names to signatures,
+// on top. A provider mapped to null drops its built-in signature. An
+// empty path loads the defaults alone.
+func LoadMailProviders(path string) (map[string]MailProviderSignature, error) {
+	signatures := maps.Clone(DefaultMailProviders)
+	if path == "" {
+		return signatures, nil
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var overrides map[string]*MailProviderSignature
+	if err := json.Unmarshal(data, &overrides); err != nil {
+		return nil, fmt.Errorf("parse mail providers %s: %v", path, err)
+	}
+	for name, signature := range overrides {
+		if signature == nil {
+			delete(signatures, name)
+			continue
+		}
+		for i, domain := range signature.MX {
+			if signature.MX[i], err = NormalizeDomain(domain); err != nil {
+				return nil, fmt.Errorf("mail providers %s, provider %q: %q is not a domain", path, name, domain)
+			}
+		}
+		signatures[name] = *signature
+	}
+	return signatures, nil
+}
+
+// mailProviders matches mail servers against signatures.
+type mailProviders struct {
+	names      []string // sorted, so overlapping signatures match the same way every time
+	signatures map[string]MailProviderSignature
+}
+
+func newMailProviders(signatures map[string]MailProviderSignature) *mailProviders {
+	if signatures == nil {
+		signatures = DefaultMailProviders
+	}
+	names := make([]string, 0, len(signatures))
+	for name := range signatures {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return &mailProviders{names: names, signatures: signatures}
+}
+
+// detect names the provider behind domain's mail servers from their
+// hosts, most preferred first, and banner, which may be empty. The MX
+// hosts are looked at first, since a gateway in front of a mailbox
+// provider is the server that answers. It returns "" when nothing is
+// known about domain's mail servers, or they are someone else's that no
+// signature matches.
+func (m *mailProviders) detect(domain string, hosts []string, banner string) string {
+	for _, host := range hosts {
+		for _, name := range m.names {
+			for _, suffix := range m.signatures[name].MX {
+				if host == suffix || strings.HasSuffix(host, "."+suffix) {
+					return name
+				}
+			}
+		}
+	}
+	if banner != "" {
+		lower := strings.ToLower(banner)
+		for _, name := range m.names {
+			for _, text := range m.signatures[name].Banner {
+				if strings.Contains(lower, strings.ToLower(text)) {
+					return name
+				}
+			}
+		}
+	}
+	for _, host := range hosts {
+		if host == domain || strings.HasSuffix(host, "."+domain) {
+			return MailProviderSelfHosted
+		}
+	}
+	return ""
+}
@@ -0,0 +1,124 @@
+package verify
+
+import (
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"email-verifier/pkg/verify/verifytest"
+)
+
+// TestDetectMailProvider tests each built-in signature against real MX hosts and banners
+func TestDetectMailProvider(t *testing.T) {
+	providers := newMailProviders(nil)
+	testCases := []struct {
+		domain   string
+		hosts    []string
+		banner   string
+		provider string
+	}{
+		{"acme.com", []string{"aspmx.l.google.com", "alt1.aspmx.l.google.com"}, "", "google-workspace"},
+		{"gmail.com", []string{"gmail-smtp-in.l.google.com"}, "", "google-workspace"},
+		{"acme.com", nil, "mx.google.com ESMTP a1-20020a05600c2c4100b00412345sor123456wmb.0 - gsmtp", "google-workspace"},
+		{"acme.com", []string{"acme-com.mail.protection.outlook.com"}, "", "microsoft-365"},
+		{"hotmail.com", []string{"hotmail-com.olc.protection.outlook.com"}, "", "microsoft-365"},
+		{"acme.com", nil, "BN8NAM11FT066.mail.protection.outlook.com Microsoft ESMTP MAIL Service ready at Mon, 1 Apr 2024 12:00:00 +0000", "microsoft-365"},
+		{"acme.com", []string{"mx0a-00123456.pphosted.com"}, "", "proofpoint"},
+		{"acme.com", nil, "mx0a-00123456.pphosted.com ESMTP mfa-m0012345", "proofpoint"},
+		{"acme.com", []string{"us-smtp-inbound-1.mimecast.com"}, "", "mimecast"},
+		{"acme.co.za", []string{"za-smtp-inbound-1.mimecast.co.za"}, "", "mimecast"},
+		{"acme.com", nil, "eu-smtp-inbound-1.mimecast.com ESMTP Mimecast", "mimecast"},
+		{"acme.com", []string{"d123456a.ess.barracudanetworks.com"}, "", "barracuda"},
+		{"acme.com", nil, "mx.acme.com ESMTP (Barracuda Email Security Service)", "barracuda"},
+		{"acme.com", []string{"mx.zoho.com", "mx2.zoho.com"}, "", "zoho"},
+		{"acme.eu", []string{"mx.zoho.eu"}, "", "zoho"},
+		{"acme.com", nil, "mx.zohomail.com SMTP Server ready", "zoho"},
+		{"yahoo.com", []string{"mta5.am0.yahoodns.net"}, "", "yahoo"},
+		{"icloud.com", []string{"mx01.mail.icloud.com"}, "", "icloud"},
+
+		// A gateway's MX is what answers, whatever is behind it
+		{"acme.com", []string{"us-smtp-inbound-1.mimecast.com"}, "Microsoft ESMTP MAIL Service ready", "mimecast"},
+		{"acme.com", []string{"mail.acme.com"}, "mail.acme.com ESMTP Postfix", MailProviderSelfHosted},
+		{"acme.com", []string{"acme.com"}, "", MailProviderSelfHosted},
+		{"acme.com", []string{"mx.hosting.example"}, "mx.hosting.example ESMTP", ""},
+		{"acme.com", []string{"notgoogle.com"}, "", ""},
+		{"acme.com", nil, "", ""},
+	}
+	for _, tc := range testCases {
+		if provider := providers.detect(tc.domain, tc.hosts, tc.banner); provider != tc.provider {
+			t.Errorf("Expected %q for %v %q, got %q", tc.provider, tc.hosts, tc.banner, provider)
+		}
+	}
+
+	for name, signature := range DefaultMailProviders {
+		for _, suffix := range signature.MX {
+			if provider := providers.detect("acme.test", []string{"mx." + suffix}, ""); provider != name {
+				t.Errorf("Expected MX under %s to be %s, got %q", suffix, name, provider)
+			}
+		}
+		for _, text := range signature.Banner {
+			if provider := providers.detect("acme.test", nil, "220 "+text+" ready"); provider != name {
+				t.Errorf("Expected banner %q to be %s, got %q", text, name, provider)
+			}
+		}
+	}
+}
+
+// TestLoadMailProviders tests that a signatures file adds to, replaces and drops the built-in ones
+func TestLoadMailProviders(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "providers.json")
+	os.WriteFile(path, []byte(`{"fastmail": {"mx": ["MessagingEngine.com"], "banner": ["messagingengine"]}, "zoho": null, "yahoo": {"mx": ["yahoo.example"]}}`), 0o644)
+	signatures, err := LoadMailProviders(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	providers := newMailProviders(signatures)
+	testCases := map[string]string{
+		"in1-smtp.messagingengine.com": "fastmail",
+		"mx.zoho.com":                  "",
+		"mta5.am0.yahoodns.net":        "",
+		"mx.yahoo.example":             "yahoo",
+		"aspmx.l.google.com":           "google-workspace",
+	}
+	for host, expected := range testCases {
+		if provider := providers.detect("acme.com", []string{host}, ""); provider != expected {
+			t.Errorf("Expected %q for %s, got %q", expected, host, provider)
+		}
+	}
+	if _, ok := DefaultMailProviders["zoho"]; !ok {
+		t.Error("Expected the built-in signatures left alone")
+	}
+
+	os.WriteFile(path, []byte(`{"broken": {"mx": ["not a domain"]}}`), 0o644)
+	if _, err := LoadMailProviders(path); err == nil {
+		t.Error("Expected an MX that isn't a domain to be rejected")
+	}
+}
+
+// TestSMTPBanner tests that results carry the answering server's greeting and the provider it points to
+func TestSMTPBanner(t *testing.T) {
+	if banner := parseBanner([]byte("220-mx.acme.com ESMTP\x07 ready\r\n220 second line\r\n")); banner != "mx.acme.com ESMTP ready" {
+		t.Errorf("Expected the first line without control characters, got %q", banner)
+	}
+
+	port := serveSMTP(t, nil)
+	serveMX(t, "127.0.0.2:"+port, "220 mx0a-00123456.pphosted.com ESMTP mfa-m0012345", "250 OK")
+	fake := verifytest.NewResolver()
+	fake.MX["acme.io"] = []*net.MX{{Host: "127.0.0.2", Pref: 10}}
+	fake.MX["self.io"] = []*net.MX{{Host: "127.0.0.1", Pref: 10}}
+	s := newTestService(Config{Resolver: fake, BuildProfile: func(p Profile) *SMTPClient {
+		client := NewSMTPClient(p)
+		client.port = port
+		return client
+	}})
+
+	result := s.Verify("jane@acme.io", Options{Checks: MustParseChecks(CheckSMTP)})
+	if result.SMTPBanner != "mx0a-00123456.pphosted.com ESMTP mfa-m0012345" || result.MailProvider != "proofpoint" {
+		t.Errorf("Expected the Proofpoint banner, got %q (%q)", result.SMTPBanner, result.MailProvider)
+	}
+	result = s.Verify("jane@self.io", Options{Checks: MustParseChecks(CheckSMTP)})
+	if result.SMTPBanner != "mx.test ESMTP" || result.MailProvider != "" {
+		t.Errorf("Expected an unknown provider, got %q (%q)", result.SMTPBanner, result.MailProvider)
+	}
+}
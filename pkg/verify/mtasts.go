@@ -0,0 +1,140 @@
+package verify
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// MTA-STS policy modes, the mode key of the policy file (RFC 8461
+// section 3.2).
+const (
+	MTASTSEnforce = "enforce"
+	MTASTSTesting = "testing"
+	MTASTSNone    = "none"
+)
+
+// DefaultMTASTSTimeout bounds fetching a domain's MTA-STS policy.
+const DefaultMTASTSTimeout = 3 * time.Second
+
+// maxMTASTSPolicy caps how much of a policy file is read; RFC 8461 says
+// 64 KiB is plenty.
+const maxMTASTSPolicy = 64 << 10
+
+// parseMTASTSPolicy returns the mode of policy, an MTA-STS policy file,
+// and whether it is valid: version STSv1, a known mode, a max_age, and at
+// least one mx pattern unless the mode is none.
+func parseMTASTSPolicy(policy string) (mode string, ok bool) {
+	var version string
+	var maxAge bool
+	var mx []string
+	for _, line := range strings.Split(policy, "\n") {
+		key, value, found := strings.Cut(strings.TrimRight(line, "\r"), ":")
+		if !found {
+			continue
+		}
+		value = strings.TrimSpace(value)
+		switch strings.TrimSpace(key) {
+		case "version":
+			version = value
+		case "mode":
+			mode = value
+		case "max_age":
+			maxAge = value != ""
+		case "mx":
+			if value != "" {
+				mx = append(mx, value)
+			}
+		}
+	}
+	if version != "STSv1" || !maxAge {
+		return "", false
+	}
+	switch mode {
+	case MTASTSEnforce, MTASTSTesting:
+		return mode, len(mx) > 0
+	case MTASTSNone:
+		return mode, true
+	}
+	return "", false
+}
+
+// singleRecord returns the one record in txt that starts with the version
+// tag, case-insensitively; none, or several, is no record at all.
+func singleRecord(txt []string, version string) (string, bool) {
+	var found []string
+	for _, record := range txt {
+		tag, _, _ := strings.Cut(record, ";")
+		if strings.EqualFold(strings.ReplaceAll(tag, " ", ""), version) {
+			found = append(found, record)
+		}
+	}
+	if len(found) != 1 {
+		return "", false
+	}
+	return found[0], true
+}
+
+// fetchMTASTSPolicy fetches domain's policy file from its well-known
+// HTTPS location. Redirects aren't followed, as RFC 8461 forbids them.
+func fetchMTASTSPolicy(ctx context.Context, client *http.Client, domain string) (string, error) {
+	if client == nil {
+		client = &http.Client{Timeout: DefaultMTASTSTimeout}
+	}
+	noRedirect := *client
+	noRedirect.CheckRedirect = func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse }
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, "https://mta-sts."+domain+"/.well-known/mta-sts.txt", nil)
+	if err != nil {
+		return "", err
+	}
+	resp, err := noRedirect.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("mta-sts policy: %s", resp.Status)
+	}
+	if mediaType, _, _ := mime.ParseMediaType(resp.Header.Get("Content-Type")); mediaType != "text/plain" {
+		return "", errors.New("mta-sts policy: not text/plain")
+	}
+	body, err := io.ReadAll(io.LimitReader(resp.Body, maxMTASTSPolicy))
+	return string(body), err
+}
+
+// lookupMTASTS fills in records' MTA-STS mode and TLS-RPT presence for
+// domain. Anything that fails is left unset rather than reported as an
+// error; complete is false if so, and the records shouldn't be cached.
+func (s *Service) lookupMTASTS(ctx context.Context, resolver Resolver, domain string, records *DNSRecords) (complete bool) {
+	complete = true
+	txt, err := resolver.LookupTXT(ctx, "_smtp._tls."+domain)
+	if err == nil || IsNotFound(err) {
+		_, found := singleRecord(txt, "v=TLSRPTv1")
+		records.HasTLSRPT = &found
+	} else {
+		complete = false
+	}
+
+	txt, err = resolver.LookupTXT(ctx, "_mta-sts."+domain)
+	if err != nil {
+		return complete && IsNotFound(err)
+	}
+	if _, found := singleRecord(txt, "v=STSv1"); !found || s.NetworkDisabled() {
+		return complete && !found
+	}
+	ctx, cancel := context.WithTimeout(ctx, DefaultMTASTSTimeout)
+	defer cancel()
+	policy, err := fetchMTASTSPolicy(ctx, s.mtaSTSClient, domain)
+	if err != nil {
+		return false
+	}
+	if mode, ok := parseMTASTSPolicy(policy); ok {
+		records.MTASTSMode = &mode
+	}
+	return complete
+}
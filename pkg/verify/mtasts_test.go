@@ -0,0 +1,113 @@
+package verify
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"email-verifier/pkg/verify/verifytest"
+)
+
+// TestParseMTASTSPolicy tests which MTA-STS policy files are valid, and their modes
+func TestParseMTASTSPolicy(t *testing.T) {
+	testCases := map[string]string{
+		"version: STSv1\r\nmode: enforce\r\nmx: mail.example.com\r\nmx: *.example.net\r\nmax_age: 86400\r\n": MTASTSEnforce,
+		"version: STSv1\nmode: testing\nmx: mail.example.com\nmax_age: 604800\n":                             MTASTSTesting,
+		"version: STSv1\nmode: none\nmax_age: 86400\n":                                                       MTASTSNone,
+		"version: STSv1\nmode: enforce\nmax_age: 86400\n":                                                    "",
+		"version: STSv1\nmode: strict\nmx: mail.example.com\nmax_age: 86400\n":                               "",
+		"version: STSv2\nmode: enforce\nmx: mail.example.com\nmax_age: 86400\n":                              "",
+		"version: STSv1\nmode: enforce\nmx: mail.example.com\n":                                              "",
+		"<html>not found</html>": "",
+	}
+	for policy, expected := range testCases {
+		mode, ok := parseMTASTSPolicy(policy)
+		if ok != (expected != "") || ok && mode != expected {
+			t.Errorf("Expected %q for %q, got %q (valid %v)", expected, policy, mode, ok)
+		}
+	}
+}
+
+// TestMTASTS tests that the MTA-STS mode and TLS-RPT record are reported only when enabled, and that failures leave them out without failing the verification
+func TestMTASTS(t *testing.T) {
+	policies := map[string]string{
+		"mta-sts.secure.mock":  "version: STSv1\nmode: enforce\nmx: mx.secure.mock\nmax_age: 86400\n",
+		"mta-sts.testing.mock": "version: STSv1\nmode: testing\nmx: mx.testing.mock\nmax_age: 86400\n",
+	}
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		policy, ok := policies[strings.Split(r.Host, ":")[0]]
+		if !ok || r.URL.Path != "/.well-known/mta-sts.txt" {
+			http.NotFound(w, r)
+			return
+		}
+		w.Header().Set("Content-Type", "text/plain")
+		w.Write([]byte(policy))
+	}))
+	defer server.Close()
+	client := server.Client()
+	transport := client.Transport.(*http.Transport).Clone()
+	transport.DialContext = func(ctx context.Context, network, _ string) (net.Conn, error) {
+		return (&net.Dialer{}).DialContext(ctx, network, server.Listener.Addr().String())
+	}
+	transport.TLSClientConfig.InsecureSkipVerify = true
+	client.Transport = transport
+
+	fake := verifytest.NewResolver()
+	for _, domain := range []string{"secure.mock", "testing.mock", "missing.mock", "plain.mock", "flaky.mock"} {
+		fake.MX[domain] = []*net.MX{{Host: "mx." + domain + ".", Pref: 10}}
+		fake.TXT["_mta-sts."+domain] = []string{"v=STSv1; id=20240101T000000;"}
+	}
+	fake.TXT["_smtp._tls.secure.mock"] = []string{"v=TLSRPTv1; rua=mailto:tls@secure.mock"}
+	delete(fake.TXT, "_mta-sts.plain.mock")
+	fake.Err["_smtp._tls.flaky.mock"] = errors.New("i/o timeout")
+	opts := Options{Checks: DefaultChecks}
+
+	if result := newTestService(Config{Resolver: fake, MTASTSClient: client}).Verify("jane@secure.mock", opts); result.DNS != nil {
+		t.Errorf("Expected no dns section by default, got %+v", result.DNS)
+	}
+
+	s := newTestService(Config{Resolver: fake, MTASTS: true, MTASTSClient: client, DomainCacheTTL: time.Hour})
+	opts = Options{Checks: s.ChecksFor("")}
+	testCases := []struct {
+		domain string
+		mode   string
+		tlsRPT string
+	}{
+		{"secure.mock", MTASTSEnforce, "true"},
+		{"testing.mock", MTASTSTesting, "false"},
+		{"missing.mock", "", "false"},
+		{"plain.mock", "", "false"},
+		{"flaky.mock", "", ""},
+	}
+	for _, tc := range testCases {
+		result := s.Verify("jane@"+tc.domain, opts)
+		if result.DNS == nil || result.Error != "" {
+			t.Fatalf("Expected a dns section and no error for %s, got %+v (%s)", tc.domain, result.DNS, result.Error)
+		}
+		mode, tlsRPT := "", ""
+		if result.DNS.MTASTSMode != nil {
+			mode = *result.DNS.MTASTSMode
+		}
+		if result.DNS.HasTLSRPT != nil {
+			tlsRPT = strconv.FormatBool(*result.DNS.HasTLSRPT)
+		}
+		if mode != tc.mode || tlsRPT != tc.tlsRPT {
+			t.Errorf("Expected mode %q and has_tls_rpt %q for %s, got %q and %q", tc.mode, tc.tlsRPT, tc.domain, mode, tlsRPT)
+		}
+	}
+
+	before := fake.Lookups()
+	if cached := s.Verify("john@secure.mock", opts).DNS; cached == nil || cached.MTASTSMode == nil || fake.Lookups() != before {
+		t.Errorf("Expected the policy from the domain cache, got %+v after %d lookups", cached, fake.Lookups()-before)
+	}
+	before = fake.Lookups()
+	if s.Verify("john@missing.mock", opts); fake.Lookups() == before {
+		t.Errorf("Expected a failed policy fetch not to be cached")
+	}
+}
@@ -0,0 +1,88 @@
+package verify
+
+import (
+	"context"
+	"errors"
+	"net"
+	"sync/atomic"
+
+	emailverifier "github.com/AfterShip/email-verifier"
+)
+
+// ErrNetworkDisabled is returned instead of any DNS lookup or SMTP probe
+// while the network kill-switch is engaged.
+var ErrNetworkDisabled = errors.New("network access is disabled")
+
+// WarningNetworkDisabled is reported when network checks were requested
+// but skipped because the kill-switch is engaged.
+const WarningNetworkDisabled = "network_disabled"
+
+// NetworkDisabled reports whether the network kill-switch is engaged.
+func (s *Service) NetworkDisabled() bool { return s.networkDisabled.Load() }
+
+// SetNetworkDisabled engages or releases the network kill-switch and
+// reports whether that changed anything. While engaged, verifications run
+// only the offline checks, and the resolver and prober refuse every call;
+// the built-in list verifier also stops fetching disposable domain updates
+// until it is released, which fetches them again before returning.
+func (s *Service) SetNetworkDisabled(disabled bool) bool {
+	s.networkMu.Lock()
+	defer s.networkMu.Unlock()
+	if s.networkDisabled.Swap(disabled) == disabled {
+		return false
+	}
+	if state := s.verifiers.state.Load(); s.autoUpdate && state != nil && state.verifier != nil {
+		if disabled {
+			state.verifier.DisableAutoUpdateDisposable()
+		} else {
+			state.verifier.EnableAutoUpdateDisposable()
+		}
+	}
+	return true
+}
+
+// buildListVerifier is the default list verifier build. It only schedules
+// disposable list updates while the network is enabled.
+func (s *Service) buildListVerifier() (*emailverifier.Verifier, error) {
+	if s.NetworkDisabled() {
+		return newListVerifier(false)
+	}
+	return NewListVerifier()
+}
+
+// guardedResolver refuses lookups while disabled is set.
+type guardedResolver struct {
+	next     Resolver
+	disabled *atomic.Bool
+}
+
+func (g guardedResolver) LookupMX(ctx context.Context, name string) ([]*net.MX, error) {
+	if g.disabled.Load() {
+		return nil, ErrNetworkDisabled
+	}
+	return g.next.LookupMX(ctx, name)
+}
+
+func (g guardedResolver) LookupTXT(ctx context.Context, name string) ([]string, error) {
+	if g.disabled.Load() {
+		return nil, ErrNetworkDisabled
+	}
+	return g.next.LookupTXT(ctx, name)
+}
+
+func (g guardedResolver) LookupHost(ctx context.Context, host string) ([]string, error) {
+	if g.disabled.Load() {
+		return nil, ErrNetworkDisabled
+	}
+	return g.next.LookupHost(ctx, host)
+}
+
+// guardProber wraps next so it refuses probes while disabled is set.
+func guardProber(next Prober, disabled *atomic.Bool) Prober {
+	return func(ctx context.Context, profile, domain, username string, catchAll bool) (*emailverifier.SMTP, error) {
+		if disabled.Load() {
+			return nil, ErrNetworkDisabled
+		}
+		return next(ctx, profile, domain, username, catchAll)
+	}
+}
@@ -0,0 +1,48 @@
+package verify
+
+import (
+	"context"
+	"errors"
+	"net"
+	"slices"
+	"testing"
+
+	"email-verifier/pkg/verify/verifytest"
+)
+
+// TestNetworkKillSwitch tests that no lookup or probe is made while the switch is engaged, that offline checks still run, and that releasing it restores network checks
+func TestNetworkKillSwitch(t *testing.T) {
+	fake := verifytest.NewResolver()
+	fake.MX["partner.mock"] = []*net.MX{{Host: "mx.partner.mock.", Pref: 10}}
+	smtp := verifytest.NewSMTP()
+	smtp.Mailboxes["jane@partner.mock"] = true
+	s := newTestService(Config{Resolver: fake, Prober: smtp.Probe, NetworkDisabled: true})
+	all := MustParseChecks(CheckFree, CheckRole, CheckDisposable, CheckSuggest, CheckSMTP)
+
+	result := s.Verify("info@partner.mock", Options{Checks: all})
+	if !result.IsValid || !result.RoleAccount || result.HasMxRecords {
+		t.Errorf("Expected offline checks only, got %+v", result)
+	}
+	if !slices.Contains(result.Warnings, WarningNetworkDisabled) || !slices.Equal(result.ChecksSkipped, networkChecks) {
+		t.Errorf("Expected the %s warning and the network checks skipped, got %v and %v", WarningNetworkDisabled, result.Warnings, result.ChecksSkipped)
+	}
+	s.VerifyBatch(append(batchEmails(2, 3), "john@partner.mock"), Options{Checks: all})
+	if _, err := s.Resolver().LookupMX(context.Background(), "partner.mock"); !errors.Is(err, ErrNetworkDisabled) {
+		t.Errorf("Expected %v from the resolver, got %v", ErrNetworkDisabled, err)
+	}
+	if fake.Lookups() != 0 || smtp.Probes() != 0 {
+		t.Fatalf("Expected no lookups or probes while disabled, got %d and %d", fake.Lookups(), smtp.Probes())
+	}
+
+	if result := s.Verify("jane@partner.mock", Options{Checks: DefaultChecks.WithoutNetwork()}); slices.Contains(result.Warnings, WarningNetworkDisabled) {
+		t.Errorf("Expected no warning when no network check was asked for, got %v", result.Warnings)
+	}
+
+	if !s.SetNetworkDisabled(false) || s.SetNetworkDisabled(false) {
+		t.Error("Expected only the first release to change the switch")
+	}
+	result = s.Verify("jane@partner.mock", Options{Checks: all})
+	if result.Verdict != VerdictDeliverable || smtp.Probes() == 0 {
+		t.Errorf("Expected a live verification after release, got %s with %d probes", result.Verdict, smtp.Probes())
+	}
+}
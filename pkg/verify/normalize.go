@@ -0,0 +1,49 @@
+package verify
+
+import (
+	"strings"
+	"unicode"
+
+	"golang.org/x/text/unicode/norm"
+)
+
+// WarningInvisibleCharacters is reported when zero-width or other invisible
+// characters had to be removed from an input address.
+const WarningInvisibleCharacters = "invisible_characters_removed"
+
+// NormalizeInput cleans up an address as pasted from spreadsheets and mail
+// clients: it strips byte order marks and surrounding Unicode whitespace
+// (including CR/LF and non-breaking spaces), removes invisible characters and
+// converts the result to NFC. Any warnings describe changes the caller may
+// want to surface.
+func NormalizeInput(s string) (string, []string) {
+	var warnings []string
+
+	s = strings.TrimPrefix(s, "\ufeff")
+	s = strings.TrimFunc(s, unicode.IsSpace)
+
+	if strings.IndexFunc(s, isInvisible) >= 0 {
+		s = strings.Map(func(r rune) rune {
+			if isInvisible(r) {
+				return -1
+			}
+			return r
+		}, s)
+		s = strings.TrimFunc(s, unicode.IsSpace)
+		warnings = append(warnings, WarningInvisibleCharacters)
+	}
+
+	return norm.NFC.String(s), warnings
+}
+
+// isInvisible reports whether r renders as nothing: zero-width spaces and
+// joiners, word joiners, soft hyphens, stray BOMs and bidi control marks.
+func isInvisible(r rune) bool {
+	switch r {
+	case '\u00ad', '\u034f', '\u061c', '\u180e',
+		'\u200b', '\u200c', '\u200d', '\u200e', '\u200f',
+		'\u2060', '\u2061', '\u2062', '\u2063', '\u2064', '\ufeff':
+		return true
+	}
+	return (r >= '\u202a' && r <= '\u202e') || (r >= '\u2066' && r <= '\u2069')
+}
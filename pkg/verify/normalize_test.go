@@ -0,0 +1,73 @@
+package verify
+
+import (
+	"net"
+	"testing"
+
+	"email-verifier/pkg/verify/verifytest"
+)
+
+// TestNormalizeInput tests cleaning up addresses pasted from Excel, Outlook and the web
+func TestNormalizeInput(t *testing.T) {
+	testCases := []struct {
+		name      string
+		input     string
+		expected  string
+		invisible bool
+	}{
+		{"plain", "user@example.com", "user@example.com", false},
+		{"excel BOM", "\ufeffuser@example.com", "user@example.com", false},
+		{"windows line ending", "user@example.com\r\n", "user@example.com", false},
+		{"trailing nbsp", "user@example.com\u00a0", "user@example.com", false},
+		{"outlook narrow nbsp and tab", "\tuser@example.com\u202f", "user@example.com", false},
+		{"ideographic space", "\u3000user@example.com\u3000", "user@example.com", false},
+		{"zero width space", "user\u200b@example.com", "user@example.com", true},
+		{"zero width joiner", "us\u200der@example.com", "user@example.com", true},
+		{"word joiner at end", "user@example.com\u2060", "user@example.com", true},
+		{"bidi marks from web copy", "\u200euser@example.com\u200f", "user@example.com", true},
+		{"soft hyphen in domain", "user@exam\u00adple.com", "user@example.com", true},
+		{"BOM mid string", "user@example.com\ufeff", "user@example.com", true},
+		{"decomposed accent to NFC", "jose\u0301@example.com", "jos\u00e9@example.com", false},
+		{"only invisible", "\u200b\u200b", "", true},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			got, warnings := NormalizeInput(tc.input)
+			if got != tc.expected {
+				t.Errorf("Expected %q, got %q", tc.expected, got)
+			}
+			hasWarning := len(warnings) == 1 && warnings[0] == WarningInvisibleCharacters
+			if hasWarning != tc.invisible {
+				t.Errorf("Expected invisible warning=%v, got %v", tc.invisible, warnings)
+			}
+		})
+	}
+}
+
+// TestPastedAddressesVerify tests that pasted addresses pass syntax validation after normalization
+func TestPastedAddressesVerify(t *testing.T) {
+	pasted := []string{
+		"\ufeffjane.doe@example.com\r\n",
+		"jane.doe@example.com\u00a0",
+		"jane\u200b.doe@example.com",
+		"\u200ejane.doe@example.com\u200f",
+		" jane.doe@example.com\t",
+	}
+
+	fake := verifytest.NewResolver()
+	fake.MX["example.com"] = []*net.MX{{Host: "mx.example.com.", Pref: 10}}
+	s := newTestService(Config{Resolver: fake})
+
+	for _, input := range pasted {
+		t.Run(input, func(t *testing.T) {
+			result := s.Verify(input, Options{Checks: DefaultChecks})
+			if result.Email != "jane.doe@example.com" {
+				t.Errorf("Expected normalized email, got %q", result.Email)
+			}
+			if !result.IsValid || result.Error == "Invalid email address format" {
+				t.Errorf("Expected valid syntax for %q, got error %q", input, result.Error)
+			}
+		})
+	}
+}
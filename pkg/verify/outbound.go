@@ -0,0 +1,104 @@
+package verify
+
+import (
+	"context"
+	"net"
+	"strings"
+	"time"
+)
+
+// WarningSMTPOutboundBlocked is reported on results that asked for the
+// smtp check while the self-test says outbound port 25 is blocked, so
+// their SMTP-level answers can't be trusted.
+const WarningSMTPOutboundBlocked = "smtp_outbound_blocked"
+
+// DefaultOutboundProbeHosts are the well-known mail servers the outbound
+// SMTP self-test dials.
+var DefaultOutboundProbeHosts = []string{
+	"gmail-smtp-in.l.google.com",
+	"mx1.hotmail.com",
+	"mta5.am0.yahoodns.net",
+}
+
+// DefaultOutboundProbeTimeout bounds each of the self-test's dials.
+const DefaultOutboundProbeTimeout = 3 * time.Second
+
+// OutboundProbe is how dialing one host went.
+type OutboundProbe struct {
+	Host     string
+	Duration time.Duration
+	Error    string
+}
+
+// OutboundReport is what the outbound SMTP self-test found. Blocked is set
+// when no host could be reached at all.
+type OutboundReport struct {
+	Blocked bool
+	Probes  []OutboundProbe
+}
+
+// CheckOutboundSMTP dials each of hosts (host or host:port, port 25 if
+// left out) over TCP at once, each within timeout, and reports whether
+// any connected. Nothing is sent: a connection is enough to tell port 25
+// isn't blocked. dial replaces the dialer, e.g. in tests.
+func CheckOutboundSMTP(ctx context.Context, hosts []string, timeout time.Duration, dial func(ctx context.Context, network, addr string) (net.Conn, error)) OutboundReport {
+	if dial == nil {
+		dial = (&net.Dialer{}).DialContext
+	}
+	if timeout <= 0 {
+		timeout = DefaultOutboundProbeTimeout
+	}
+	probes := make([]OutboundProbe, len(hosts))
+	done := make(chan struct{}, len(hosts))
+	for i, host := range hosts {
+		go func() {
+			defer func() { done <- struct{}{} }()
+			addr := strings.TrimSpace(host)
+			if _, _, err := net.SplitHostPort(addr); err != nil {
+				addr = net.JoinHostPort(strings.Trim(addr, "[]"), "25")
+			}
+			ctx, cancel := context.WithTimeout(ctx, timeout)
+			defer cancel()
+			start := time.Now()
+			conn, err := dial(ctx, "tcp", addr)
+			probes[i] = OutboundProbe{Host: addr, Duration: time.Since(start)}
+			if err != nil {
+				probes[i].Error = err.Error()
+				return
+			}
+			conn.Close()
+		}()
+	}
+	for range hosts {
+		<-done
+	}
+
+	report := OutboundReport{Blocked: len(hosts) > 0, Probes: probes}
+	for _, probe := range probes {
+		if probe.Error == "" {
+			report.Blocked = false
+		}
+	}
+	return report
+}
+
+// Failures lists the hosts that couldn't be reached, with why, for logs.
+func (r OutboundReport) Failures() string {
+	var failures []string
+	for _, probe := range r.Probes {
+		if probe.Error != "" {
+			failures = append(failures, probe.Host+": "+probe.Error)
+		}
+	}
+	return strings.Join(failures, "; ")
+}
+
+// SMTPOutboundBlocked reports whether the outbound SMTP self-test last
+// found port 25 blocked.
+func (s *Service) SMTPOutboundBlocked() bool { return s.outboundBlocked.Load() }
+
+// SetSMTPOutboundBlocked records what the outbound SMTP self-test found.
+// While blocked, results that ask for the smtp check carry
+// WarningSMTPOutboundBlocked; probes are still made, so a wrong self-test
+// costs nothing but the warning.
+func (s *Service) SetSMTPOutboundBlocked(blocked bool) { s.outboundBlocked.Store(blocked) }
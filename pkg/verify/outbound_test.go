@@ -0,0 +1,67 @@
+package verify
+
+import (
+	"context"
+	"errors"
+	"net"
+	"slices"
+	"testing"
+	"time"
+
+	"email-verifier/pkg/verify/verifytest"
+)
+
+// TestCheckOutboundSMTP tests that one reachable host is enough and that none makes port 25 blocked
+func TestCheckOutboundSMTP(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	closed, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	closedAddr := closed.Addr().String()
+	closed.Close()
+	ctx := context.Background()
+
+	report := CheckOutboundSMTP(ctx, []string{closedAddr, ln.Addr().String()}, time.Second, nil)
+	if report.Blocked || len(report.Probes) != 2 || report.Probes[0].Error == "" || report.Probes[1].Error != "" {
+		t.Errorf("Expected one host reached, got %+v", report)
+	}
+	if report := CheckOutboundSMTP(ctx, []string{closedAddr}, time.Second, nil); !report.Blocked {
+		t.Errorf("Expected port 25 blocked with no host reached, got %+v", report)
+	}
+	if report := CheckOutboundSMTP(ctx, nil, time.Second, nil); report.Blocked {
+		t.Error("Expected no hosts to prove nothing")
+	}
+
+	var dialed []string
+	blackhole := func(ctx context.Context, network, addr string) (net.Conn, error) {
+		dialed = append(dialed, addr)
+		<-ctx.Done()
+		return nil, errors.New("i/o timeout")
+	}
+	start := time.Now()
+	report = CheckOutboundSMTP(ctx, []string{"mx.example.com"}, 20*time.Millisecond, blackhole)
+	if !report.Blocked || time.Since(start) > time.Second || !slices.Equal(dialed, []string{"mx.example.com:25"}) {
+		t.Errorf("Expected a dial to port 25 cut off by the timeout, got %+v dialing %v", report, dialed)
+	}
+}
+
+// TestSMTPOutboundBlockedWarning tests that results asking for the smtp check carry the warning while port 25 is blocked
+func TestSMTPOutboundBlockedWarning(t *testing.T) {
+	s := newTestService(Config{Resolver: verifytest.NewResolver(), Prober: verifytest.NewSMTP().Probe})
+	s.SetSMTPOutboundBlocked(true)
+	if result := s.Verify("jane@example.mock", Options{Checks: MustParseChecks(CheckSMTP)}); !slices.Contains(result.Warnings, WarningSMTPOutboundBlocked) {
+		t.Errorf("Expected the warning, got %v", result.Warnings)
+	}
+	if result := s.Verify("jane@example.mock", Options{Checks: MustParseChecks(CheckSyntax)}); slices.Contains(result.Warnings, WarningSMTPOutboundBlocked) {
+		t.Errorf("Expected no warning without the smtp check, got %v", result.Warnings)
+	}
+	s.SetSMTPOutboundBlocked(false)
+	if result := s.Verify("jane@example.mock", Options{Checks: MustParseChecks(CheckSMTP)}); slices.Contains(result.Warnings, WarningSMTPOutboundBlocked) {
+		t.Errorf("Expected no warning once unblocked, got %v", result.Warnings)
+	}
+}
@@ -0,0 +1,114 @@
+package verify
+
+import (
+	"slices"
+	"sort"
+	"strings"
+)
+
+// BatchPlan is what VerifyBatch would do with a list, worked out from the
+// phases that need no network: normalization, dedupe, syntax, list lookups
+// and domain policy. The estimates are upper bounds, since a catch-all
+// domain skips its mailbox probes and that is only known once probed.
+type BatchPlan struct {
+	Submitted  int `json:"submitted"`
+	Unique     int `json:"unique"`
+	Duplicates int `json:"duplicates"`
+
+	// Rejected are addresses that fail syntax; they are verified offline
+	// and never reach DNS or SMTP.
+	Rejected []PlanRejection `json:"rejected"`
+	// Offline counts valid addresses answered without the network:
+	// suppressed addresses, disposable domains, and address literals or
+	// non-routable domains.
+	Offline int `json:"offline"`
+
+	Domains                 []PlanDomain `json:"domains"`
+	EstimatedDNSLookups     int          `json:"estimated_dns_lookups"`
+	EstimatedCatchAllProbes int          `json:"estimated_catch_all_probes"`
+	EstimatedMailboxProbes  int          `json:"estimated_mailbox_probes"`
+	EstimatedCostUnits      int          `json:"estimated_cost_units"`
+
+	// Emails are the deduplicated addresses, in input order, that
+	// executing the plan verifies.
+	Emails []string `json:"-"`
+}
+
+// PlanRejection is a submitted address that failed syntax.
+type PlanRejection struct {
+	Email     string `json:"email"`
+	ErrorCode string `json:"error_code"`
+}
+
+// PlanDomain is a domain the plan will look up, with how many addresses
+// are at it.
+type PlanDomain struct {
+	Domain    string `json:"domain"`
+	Addresses int    `json:"addresses"`
+}
+
+// PlanBatch returns the plan for verifying emails with opts, without
+// touching the network. Addresses that differ only in case are duplicates;
+// the first spelling is kept.
+func (s *Service) PlanBatch(emails []string, opts Options) BatchPlan {
+	plan := BatchPlan{Submitted: len(emails), Rejected: []PlanRejection{}, Domains: []PlanDomain{}}
+	opts.Checks = s.allowedChecks(opts.Checks)
+	offline := Options{Checks: opts.Checks.WithoutNetwork(), Key: opts.Key}
+
+	seen := make(map[string]bool, len(emails))
+	byDomain := make(map[string]int)
+	var domains []string
+	for _, email := range emails {
+		normalized, _ := NormalizeInput(email)
+		if seen[AddressKey(normalized)] {
+			plan.Duplicates++
+			continue
+		}
+		seen[AddressKey(normalized)] = true
+		plan.Emails = append(plan.Emails, normalized)
+
+		result := s.Verify(normalized, offline)
+		switch {
+		case !result.IsValid || result.ErrorCode == ErrCodeDomainBlocked:
+			plan.Rejected = append(plan.Rejected, PlanRejection{Email: normalized, ErrorCode: result.ErrorCode})
+			plan.EstimatedCostUnits += result.CostUnits
+			continue
+		case result.Disposable || result.Suppressed || result.DomainStatus != "":
+			plan.Offline++
+			plan.EstimatedCostUnits += result.CostUnits
+			continue
+		}
+
+		domain := strings.ToLower(result.Domain)
+		if _, ok := byDomain[domain]; !ok {
+			domains = append(domains, domain)
+		}
+		var reused map[string]bool
+		if byDomain[domain] > 0 {
+			reused = (&domainFacts{billed: true}).reused()
+		}
+		byDomain[domain]++
+		performed := opts.Checks.Names()
+		if isSpecialUse(domain) || s.skipSMTPDomains.match(domain) {
+			// Documentation and allowlisted domains are never probed
+			performed = slices.DeleteFunc(performed, func(check string) bool { return check == CheckSMTP })
+		}
+		plan.EstimatedCostUnits += s.costs.charge(performed, reused)
+	}
+	plan.Unique = len(plan.Emails)
+
+	sort.Strings(domains)
+	for _, domain := range domains {
+		plan.Domains = append(plan.Domains, PlanDomain{Domain: domain, Addresses: byDomain[domain]})
+		if opts.Checks.Has(CheckMX) {
+			plan.EstimatedDNSLookups++
+		}
+		if opts.Checks.Has(CheckSMTP) && !isSpecialUse(domain) && !s.skipSMTPDomains.match(domain) {
+			if !s.catchAllDisabled {
+				plan.EstimatedCatchAllProbes++
+			}
+			plan.EstimatedMailboxProbes += byDomain[domain]
+		}
+	}
+	return plan
+}
@@ -0,0 +1,67 @@
+package verify
+
+import (
+	"reflect"
+	"testing"
+)
+
+// TestPlanBatch tests that a plan dedupes, rejects bad syntax and estimates the network work without doing any
+func TestPlanBatch(t *testing.T) {
+	s, dns, smtp := newBatchService(4)
+	emails := append(batchEmails(4, 5),
+		"not-an-address",
+		"USER0@D1.mock",
+		" user1@d2.mock ",
+		"temp@mailinator.com",
+		"jane@localhost",
+		"jane@example.com",
+	)
+
+	checks := MustParseChecks(CheckDisposable, CheckFree, CheckRole, CheckSMTP)
+	plan := s.PlanBatch(emails, Options{Checks: checks})
+
+	if n := dns.mxLookups.Load(); n != 0 {
+		t.Errorf("Expected no DNS lookups while planning, got %d", n)
+	}
+	if n := smtp.Probes(); n != 0 {
+		t.Errorf("Expected no SMTP probes while planning, got %d", n)
+	}
+
+	if plan.Submitted != 26 || plan.Unique != 24 || plan.Duplicates != 2 {
+		t.Errorf("Expected 26 submitted, 24 unique and 2 duplicates, got %d, %d and %d", plan.Submitted, plan.Unique, plan.Duplicates)
+	}
+	if want := []PlanRejection{{Email: "not-an-address", ErrorCode: ErrCodeInvalidSyntax}}; !reflect.DeepEqual(plan.Rejected, want) {
+		t.Errorf("Expected %+v rejected, got %+v", want, plan.Rejected)
+	}
+	if plan.Offline != 2 {
+		t.Errorf("Expected the disposable and non-routable addresses offline, got %d", plan.Offline)
+	}
+	wantDomains := []PlanDomain{
+		{Domain: "d0.mock", Addresses: 5},
+		{Domain: "d1.mock", Addresses: 5},
+		{Domain: "d2.mock", Addresses: 5},
+		{Domain: "d3.mock", Addresses: 5},
+		{Domain: "example.com", Addresses: 1},
+	}
+	if !reflect.DeepEqual(plan.Domains, wantDomains) {
+		t.Errorf("Expected domains %+v, got %+v", wantDomains, plan.Domains)
+	}
+
+	// example.com is looked up but never probed
+	if plan.EstimatedDNSLookups != 5 || plan.EstimatedCatchAllProbes != 4 || plan.EstimatedMailboxProbes != 20 {
+		t.Errorf("Expected 5 lookups, 4 catch-all probes and at most 20 mailbox probes, got %+v", plan)
+	}
+	// Full price for the first address at each domain and every mailbox
+	// probe, as if no domain were catch-all
+	if want := 4*6 + 16*5 + 1; plan.EstimatedCostUnits != want {
+		t.Errorf("Expected an estimate of %d units, got %d", want, plan.EstimatedCostUnits)
+	}
+
+	_, summary := s.VerifyBatch(plan.Emails, Options{Checks: checks})
+	if summary.CostUnits > plan.EstimatedCostUnits {
+		t.Errorf("Expected the estimate to bound the actual cost, got %d > %d", summary.CostUnits, plan.EstimatedCostUnits)
+	}
+	if summary.Addresses != plan.Unique {
+		t.Errorf("Expected the plan's addresses to be verified, got %d", summary.Addresses)
+	}
+}
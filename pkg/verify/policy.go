@@ -0,0 +1,187 @@
+package verify
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"slices"
+	"strings"
+)
+
+// Soft signals a verdict policy can act on. Unlike a missing domain or a
+// rejected mailbox they don't settle deliverability, so deployments pick
+// how strict to be about each.
+const (
+	SignalDisposable  = "disposable"
+	SignalRoleAccount = "role_account"
+	SignalFree        = "free"
+	SignalCatchAll    = "catch_all"
+	SignalLookalike   = "lookalike" // the domain looks like a typo of a known one
+	SignalRecentlyReg = "recently_registered"
+	SignalRandomLocal = "random_local_part" // see LocalPartRandomness
+)
+
+// Effects a policy gives a signal.
+const (
+	EffectIgnore        = "ignore"
+	EffectRisky         = "mark_risky"
+	EffectUndeliverable = "mark_undeliverable"
+)
+
+// Signals lists the policy signals in the order reasons are reported.
+// No check raises recently_registered yet, since domain age needs an RDAP
+// lookup the service doesn't make; it is accepted so policies can be
+// written ahead of it.
+var Signals = []string{SignalDisposable, SignalRoleAccount, SignalFree, SignalCatchAll, SignalLookalike, SignalRecentlyReg, SignalRandomLocal}
+
+// VerdictPolicy maps signals to their effect on the verdict. Signals it
+// doesn't name fall through to the next, less specific, policy.
+type VerdictPolicy map[string]string
+
+// DefaultVerdictPolicy is the behavior without any policy config:
+// disposable and catch-all addresses are risky, everything else is only
+// reported in its own field.
+var DefaultVerdictPolicy = VerdictPolicy{
+	SignalDisposable:  EffectRisky,
+	SignalRoleAccount: EffectIgnore,
+	SignalFree:        EffectIgnore,
+	SignalCatchAll:    EffectRisky,
+	SignalLookalike:   EffectIgnore,
+	SignalRecentlyReg: EffectIgnore,
+	SignalRandomLocal: EffectIgnore,
+}
+
+// Validate reports signals or effects p doesn't know.
+func (p VerdictPolicy) Validate() error {
+	for signal, effect := range p {
+		if !slices.Contains(Signals, signal) {
+			return fmt.Errorf("unknown signal %q: valid signals are %s", signal, strings.Join(Signals, ", "))
+		}
+		switch effect {
+		case EffectIgnore, EffectRisky, EffectUndeliverable:
+		default:
+			return fmt.Errorf("signal %q: unknown effect %q: want ignore, mark_risky or mark_undeliverable", signal, effect)
+		}
+	}
+	return nil
+}
+
+// PolicyConfig layers verdict policies: a key's policy overrides its
+// profile's, which overrides the global one, signal by signal.
+type PolicyConfig struct {
+	Global   VerdictPolicy            `json:"global,omitempty"`
+	Profiles map[string]VerdictPolicy `json:"profiles,omitempty"`
+	Keys     map[string]VerdictPolicy `json:"keys,omitempty"`
+}
+
+// Validate checks every policy in c.
+func (c PolicyConfig) Validate() error {
+	if err := c.Global.Validate(); err != nil {
+		return fmt.Errorf("global policy: %v", err)
+	}
+	for name, policy := range c.Profiles {
+		if err := policy.Validate(); err != nil {
+			return fmt.Errorf("profile %q policy: %v", name, err)
+		}
+	}
+	for key, policy := range c.Keys {
+		if err := policy.Validate(); err != nil {
+			return fmt.Errorf("key %q policy: %v", key, err)
+		}
+	}
+	return nil
+}
+
+// LoadPolicyConfig reads a JSON file of verdict policies, e.g.
+// {"global": {"role_account": "mark_risky"}, "keys": {"strict-key": {"disposable": "mark_undeliverable"}}}.
+func LoadPolicyConfig(path string) (PolicyConfig, error) {
+	if path == "" {
+		return PolicyConfig{}, nil
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return PolicyConfig{}, err
+	}
+	var cfg PolicyConfig
+	if err := json.Unmarshal(data, &cfg); err != nil {
+		return PolicyConfig{}, fmt.Errorf("parse policy config %s: %v", path, err)
+	}
+	if err := cfg.Validate(); err != nil {
+		return PolicyConfig{}, fmt.Errorf("policy config %s: %v", path, err)
+	}
+	return cfg, nil
+}
+
+// policyRule is a signal's effect and the policy it came from.
+type policyRule struct {
+	effect string
+	scope  string // default, global, profile or key
+}
+
+// resolvedPolicy is the effect of every signal for one verification.
+type resolvedPolicy map[string]policyRule
+
+// policyFor resolves the layered policy for opts' key and profile.
+func (s *Service) policyFor(opts Options) resolvedPolicy {
+	resolved := make(resolvedPolicy, len(Signals))
+	layers := []struct {
+		scope  string
+		policy VerdictPolicy
+	}{
+		{"default", DefaultVerdictPolicy},
+		{"global", s.policies.Global},
+		{"profile", s.policies.Profiles[opts.profile()]},
+		{"key", s.policies.Keys[opts.Key]},
+	}
+	for _, layer := range layers {
+		for signal, effect := range layer.policy {
+			resolved[signal] = policyRule{effect: effect, scope: layer.scope}
+		}
+	}
+	return resolved
+}
+
+// raised reports whether result carries signal.
+func raised(result *Result, signal string) bool {
+	switch signal {
+	case SignalDisposable:
+		return result.Disposable
+	case SignalRoleAccount:
+		return result.RoleAccount
+	case SignalFree:
+		return result.Free
+	case SignalCatchAll:
+		return result.CatchAll
+	case SignalLookalike:
+		return result.Suggestion != ""
+	case SignalRandomLocal:
+		return slices.Contains(result.Warnings, WarningRandomLocalPart)
+	}
+	return false
+}
+
+// apply returns the strongest effect among the signals result raises and
+// the reasons naming the policies behind it.
+func (p resolvedPolicy) apply(result *Result) (string, []string) {
+	var risky, undeliverable []string
+	for _, signal := range Signals {
+		rule := p[signal]
+		if !raised(result, signal) {
+			continue
+		}
+		reason := fmt.Sprintf("%s policy: %s=%s", rule.scope, signal, rule.effect)
+		switch rule.effect {
+		case EffectRisky:
+			risky = append(risky, reason)
+		case EffectUndeliverable:
+			undeliverable = append(undeliverable, reason)
+		}
+	}
+	switch {
+	case undeliverable != nil:
+		return EffectUndeliverable, undeliverable
+	case risky != nil:
+		return EffectRisky, risky
+	}
+	return EffectIgnore, nil
+}
@@ -0,0 +1,469 @@
+package verify
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	emailverifier "github.com/AfterShip/email-verifier"
+)
+
+// Probing etiquette defaults.
+const (
+	DefaultPoliteAddressWindow  = 24 * time.Hour
+	DefaultPoliteHostRate       = 20
+	DefaultPoliteRejectCooldown = 6 * time.Hour
+)
+
+// PoliteConfig sets the probing etiquette every SMTP probe goes through,
+// whatever the caller asked for:
+//
+//   - an address gets at most one answered RCPT probe per AddressWindow;
+//     asking again returns the earlier answer with WarningSMTPReused. A
+//     reply asking to try again later doesn't count, since it invites a
+//     retry.
+//   - a mail server is probed at most HostRate times in any minute. The
+//     library dials every MX host of a domain at once, so a probe counts
+//     against all of them.
+//   - a server that rejects the connection outright (521 or 554 before
+//     the conversation starts) isn't probed again for RejectCooldown.
+//
+// Probes the etiquette holds back fail with ErrProbeDeferred and carry a
+// retry token for when they would be allowed. The zero value is the
+// etiquette with its defaults.
+type PoliteConfig struct {
+	// Off turns the etiquette off, for lab setups probing servers of
+	// their own.
+	Off            bool
+	AddressWindow  time.Duration
+	HostRate       int
+	RejectCooldown time.Duration
+}
+
+// WarningSMTPReused is reported when the SMTP answer is the one an earlier
+// probe of the address got, because the etiquette allows only one.
+const WarningSMTPReused = "smtp_result_reused"
+
+// ErrProbeDeferred is returned, wrapped with the reason and wait, for
+// probes the etiquette holds back.
+var ErrProbeDeferred = errors.New("probe deferred by the probing etiquette")
+
+// Reasons a probe is deferred, as counted in PoliteReport.
+const (
+	DeferHostRate     = "host_rate"
+	DeferHostCooldown = "host_cooldown"
+)
+
+type probeDeferral struct {
+	reason string
+	host   string
+	wait   time.Duration
+}
+
+func (d *probeDeferral) Error() string {
+	return fmt.Sprintf("%v: %s for %s, allowed in %v", ErrProbeDeferred, d.reason, d.host, d.wait.Round(time.Second))
+}
+
+func (d *probeDeferral) Is(target error) bool { return target == ErrProbeDeferred }
+
+// addressProbe is the one probe of an address in the window. done is
+// closed once smtp and err are set.
+type addressProbe struct {
+	at     time.Time
+	done   chan struct{}
+	smtp   *emailverifier.SMTP
+	err    error
+	reused int
+}
+
+// hostProbes is what the etiquette knows about one mail server.
+type hostProbes struct {
+	recent        []time.Time   // probe starts within the last minute
+	hourly        map[int64]int // probes per hour, for the report
+	cooldownUntil time.Time     // set by a connection-time rejection
+	rejections    int
+}
+
+// domainMX is a domain's MX hosts, as last seen by classifyDomain.
+type domainMX struct {
+	hosts []string
+	seen  time.Time
+}
+
+// etiquette enforces PoliteConfig.
+type etiquette struct {
+	cfg PoliteConfig
+
+	mu        sync.Mutex
+	addresses map[string]*addressProbe // by username as probed and domain
+	hosts     map[string]*hostProbes
+	mx        map[string]domainMX
+	deferred  map[string]int64 // by reason
+	now       func() time.Time
+	lookupMX  func(domain string) []string
+}
+
+// newEtiquette returns the etiquette for cfg, or nil if it is off.
+func newEtiquette(cfg PoliteConfig, resolver Resolver) *etiquette {
+	if cfg.Off {
+		return nil
+	}
+	if cfg.AddressWindow <= 0 {
+		cfg.AddressWindow = DefaultPoliteAddressWindow
+	}
+	if cfg.HostRate <= 0 {
+		cfg.HostRate = DefaultPoliteHostRate
+	}
+	if cfg.RejectCooldown <= 0 {
+		cfg.RejectCooldown = DefaultPoliteRejectCooldown
+	}
+	return &etiquette{
+		cfg:       cfg,
+		addresses: make(map[string]*addressProbe),
+		hosts:     make(map[string]*hostProbes),
+		mx:        make(map[string]domainMX),
+		deferred:  make(map[string]int64),
+		now:       time.Now,
+		lookupMX: func(domain string) []string {
+			ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			defer cancel()
+			mx, _ := resolver.LookupMX(ctx, domain)
+			return mxHosts(mx)
+		},
+	}
+}
+
+func mxHosts(mx []*net.MX) []string {
+	var hosts []string
+	for _, record := range mx {
+		if host := strings.ToLower(strings.TrimSuffix(record.Host, ".")); host != "" {
+			hosts = append(hosts, host)
+		}
+	}
+	return hosts
+}
+
+// noteMX remembers domain's MX hosts, so probes can be counted against
+// them without another lookup.
+func (e *etiquette) noteMX(domain string, mx []*net.MX) {
+	if e == nil {
+		return
+	}
+	hosts := mxHosts(mx)
+	if len(hosts) == 0 {
+		return
+	}
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.mx[strings.ToLower(domain)] = domainMX{hosts: hosts, seen: e.now()}
+}
+
+// hostsFor returns the servers a probe of domain reaches: its MX hosts,
+// looked up if classifyDomain hasn't seen them, or the domain itself for
+// address literals and lookup failures.
+func (e *etiquette) hostsFor(domain string) []string {
+	domain = strings.ToLower(domain)
+	e.mu.Lock()
+	known, ok := e.mx[domain]
+	e.mu.Unlock()
+	if ok {
+		return known.hosts
+	}
+	if hosts := e.lookupMX(domain); len(hosts) > 0 {
+		e.mu.Lock()
+		e.mx[domain] = domainMX{hosts: hosts, seen: e.now()}
+		e.mu.Unlock()
+		return hosts
+	}
+	return []string{domain}
+}
+
+// probe runs one probe of username at domain through the etiquette. It
+// returns the earlier answer, with reused set, for an address already
+// probed in the window, and ErrProbeDeferred for a probe that would break
+// a host's limits. username is empty for catch-all probes, which use a
+// random address and only count against the hosts.
+func (e *etiquette) probe(domain, username string, run func() (*emailverifier.SMTP, error)) (*emailverifier.SMTP, bool, error) {
+	hosts := e.hostsFor(domain)
+
+	e.mu.Lock()
+	now := e.now()
+	var key string
+	if username != "" {
+		// Local parts are probed as written (see AddressKey), so each
+		// spelling is its own probe
+		key = username + "@" + strings.ToLower(domain)
+		if earlier := e.addresses[key]; earlier != nil && now.Sub(earlier.at) < e.cfg.AddressWindow {
+			earlier.reused++
+			e.mu.Unlock()
+			<-earlier.done
+			if cancelled(earlier.err) {
+				// The earlier caller went away before its answer
+				return e.probe(domain, username, run)
+			}
+			return copySMTP(earlier.smtp), true, earlier.err
+		}
+	}
+	if deferral := e.check(hosts, now); deferral != nil {
+		e.deferred[deferral.reason]++
+		e.mu.Unlock()
+		return nil, false, deferral
+	}
+	for _, host := range hosts {
+		state := e.host(host)
+		state.recent = append(state.recent, now)
+		state.hourly[now.Unix()/3600]++
+	}
+	var entry *addressProbe
+	if key != "" {
+		entry = &addressProbe{at: now, done: make(chan struct{})}
+		e.addresses[key] = entry
+	}
+	e.mu.Unlock()
+
+	smtp, err := run()
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if connectionRejected(smtp, err) {
+		until := e.now().Add(e.cfg.RejectCooldown)
+		for _, host := range hosts {
+			state := e.host(host)
+			state.cooldownUntil = until
+			state.rejections++
+		}
+		log.Printf("polite: %s rejected the connection, not probing %s until %s", domain, strings.Join(hosts, ", "), until.UTC().Format(time.RFC3339))
+	}
+	if entry != nil {
+		entry.smtp, entry.err = copySMTP(smtp), err
+		if _, transient := retryDelay(err); transient || errors.Is(err, ErrNetworkDisabled) || cancelled(err) {
+			// Nothing was learned about the mailbox, so the next
+			// verification may ask again
+			delete(e.addresses, key)
+		}
+		close(entry.done)
+	}
+	return smtp, false, err
+}
+
+// cancelled reports whether err is a probe's context ending.
+func cancelled(err error) bool {
+	return errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded)
+}
+
+// check returns why hosts can't be probed now, or nil if they can. It
+// must be called with the lock held.
+func (e *etiquette) check(hosts []string, now time.Time) *probeDeferral {
+	for _, host := range hosts {
+		state := e.hosts[host]
+		if state == nil {
+			continue
+		}
+		if now.Before(state.cooldownUntil) {
+			return &probeDeferral{reason: DeferHostCooldown, host: host, wait: state.cooldownUntil.Sub(now)}
+		}
+		state.trim(now)
+		if len(state.recent) >= e.cfg.HostRate {
+			return &probeDeferral{reason: DeferHostRate, host: host, wait: state.recent[0].Add(time.Minute).Sub(now)}
+		}
+	}
+	return nil
+}
+
+// host returns host's state, creating it. It must be called with the lock
+// held.
+func (e *etiquette) host(host string) *hostProbes {
+	state := e.hosts[host]
+	if state == nil {
+		state = &hostProbes{hourly: make(map[int64]int)}
+		e.hosts[host] = state
+	}
+	return state
+}
+
+// trim drops probe starts older than a minute.
+func (h *hostProbes) trim(now time.Time) {
+	n := sort.Search(len(h.recent), func(i int) bool { return now.Sub(h.recent[i]) < time.Minute })
+	h.recent = append(h.recent[:0], h.recent[n:]...)
+}
+
+// connectionRejected reports whether a probe failed on a 521 or 554
+// greeting, before the server accepted the conversation.
+func connectionRejected(smtp *emailverifier.SMTP, err error) bool {
+	if smtpError(err) == nil || (smtp != nil && smtp.HostExists) {
+		return false
+	}
+	details := smtpDetailsFor(err)
+	return details != nil && (details.Code == 521 || details.Code == 554)
+}
+
+func copySMTP(smtp *emailverifier.SMTP) *emailverifier.SMTP {
+	if smtp == nil {
+		return nil
+	}
+	c := *smtp
+	return &c
+}
+
+// sweep drops addresses and hosts the window has passed, and returns how
+// many.
+func (e *etiquette) sweep(now time.Time) int {
+	if e == nil {
+		return 0
+	}
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	removed := 0
+	for key, entry := range e.addresses {
+		select {
+		case <-entry.done:
+		default:
+			continue // still probing
+		}
+		if now.Sub(entry.at) >= e.cfg.AddressWindow {
+			delete(e.addresses, key)
+			removed++
+		}
+	}
+	oldest := now.Add(-e.cfg.AddressWindow).Unix() / 3600
+	for host, state := range e.hosts {
+		for hour := range state.hourly {
+			if hour < oldest {
+				delete(state.hourly, hour)
+			}
+		}
+		state.trim(now)
+		if len(state.recent) == 0 && len(state.hourly) == 0 && !now.Before(state.cooldownUntil) {
+			delete(e.hosts, host)
+			removed++
+		}
+	}
+	for domain, known := range e.mx {
+		if now.Sub(known.seen) >= e.cfg.AddressWindow {
+			delete(e.mx, domain)
+		}
+	}
+	return removed
+}
+
+// maxReportAddresses caps the addresses listed in a PoliteReport.
+const maxReportAddresses = 1000
+
+// PoliteReport shows how the etiquette was kept over its address window.
+// Addresses are listed by AddressHash, most asked for first; each spelling
+// of an address is probed once, so Probes can be more than one.
+type PoliteReport struct {
+	Mode            string           `json:"mode"` // polite or off
+	AddressWindow   string           `json:"address_window,omitempty"`
+	HostRate        int              `json:"host_rate_per_minute,omitempty"`
+	RejectCooldown  string           `json:"reject_cooldown,omitempty"`
+	AddressesProbed int              `json:"addresses_probed"`
+	Addresses       []AddressProbes  `json:"addresses"`
+	Hosts           []HostProbes     `json:"hosts"`
+	Deferred        map[string]int64 `json:"deferred"`
+}
+
+// AddressProbes is one address's probes in the window. ProbedAt is the
+// latest.
+type AddressProbes struct {
+	AddressHash string    `json:"address_hash"`
+	Probes      int       `json:"probes"`
+	Reused      int       `json:"reused"`
+	ProbedAt    time.Time `json:"probed_at"`
+}
+
+// HostProbes is one mail server's probes.
+type HostProbes struct {
+	Host          string     `json:"host"`
+	LastMinute    int        `json:"last_minute"`
+	InWindow      int        `json:"in_window"`
+	Rejections    int        `json:"rejections,omitempty"`
+	CooldownUntil *time.Time `json:"cooldown_until,omitempty"`
+}
+
+// PoliteReport reports the probes the etiquette let through and held back.
+func (s *Service) PoliteReport() PoliteReport {
+	e := s.polite
+	if e == nil {
+		return PoliteReport{Mode: "off", Addresses: []AddressProbes{}, Hosts: []HostProbes{}, Deferred: map[string]int64{}}
+	}
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	now := e.now()
+	report := PoliteReport{
+		Mode:           "polite",
+		AddressWindow:  e.cfg.AddressWindow.String(),
+		HostRate:       e.cfg.HostRate,
+		RejectCooldown: e.cfg.RejectCooldown.String(),
+		Addresses:      []AddressProbes{},
+		Hosts:          []HostProbes{},
+		Deferred:       make(map[string]int64, len(e.deferred)),
+	}
+	byHash := make(map[string]*AddressProbes)
+	for key, entry := range e.addresses {
+		if now.Sub(entry.at) >= e.cfg.AddressWindow {
+			continue
+		}
+		hash := AddressHash(key)
+		a := byHash[hash]
+		if a == nil {
+			a = &AddressProbes{AddressHash: hash, ProbedAt: entry.at.UTC()}
+			byHash[hash] = a
+		}
+		a.Probes++
+		a.Reused += entry.reused
+		if entry.at.After(a.ProbedAt) {
+			a.ProbedAt = entry.at.UTC()
+		}
+	}
+	for _, a := range byHash {
+		report.Addresses = append(report.Addresses, *a)
+	}
+	report.AddressesProbed = len(report.Addresses)
+	sort.Slice(report.Addresses, func(i, j int) bool {
+		a, b := report.Addresses[i], report.Addresses[j]
+		if a.Reused != b.Reused {
+			return a.Reused > b.Reused
+		}
+		return a.AddressHash < b.AddressHash
+	})
+	if len(report.Addresses) > maxReportAddresses {
+		report.Addresses = report.Addresses[:maxReportAddresses]
+	}
+	oldest := now.Add(-e.cfg.AddressWindow).Unix() / 3600
+	for host, state := range e.hosts {
+		state.trim(now)
+		h := HostProbes{Host: host, LastMinute: len(state.recent), Rejections: state.rejections}
+		for hour, n := range state.hourly {
+			if hour >= oldest {
+				h.InWindow += n
+			}
+		}
+		if now.Before(state.cooldownUntil) {
+			until := state.cooldownUntil.UTC()
+			h.CooldownUntil = &until
+		}
+		report.Hosts = append(report.Hosts, h)
+	}
+	sort.Slice(report.Hosts, func(i, j int) bool {
+		a, b := report.Hosts[i], report.Hosts[j]
+		if a.InWindow != b.InWindow {
+			return a.InWindow > b.InWindow
+		}
+		return a.Host < b.Host
+	})
+	for reason, n := range e.deferred {
+		report.Deferred[reason] = n
+	}
+	return report
+}
+
+// SweepPolite drops etiquette state the address window has passed and
+// returns how many addresses and hosts went with it.
+func (s *Service) SweepPolite(now time.Time) int { return s.polite.sweep(now) }
@@ -0,0 +1,219 @@
+package verify
+
+import (
+	"context"
+	"errors"
+	"net"
+	"slices"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"email-verifier/pkg/verify/verifytest"
+	emailverifier "github.com/AfterShip/email-verifier"
+)
+
+// politeBase is when the etiquette tests start
+var politeBase = time.Date(2026, 4, 1, 12, 0, 0, 0, time.UTC)
+
+// newPoliteService returns a service whose partner.mock and other.mock share
+// mx2.shared.mock, with the etiquette's clock at politeBase plus the
+// returned offset
+func newPoliteService(cfg PoliteConfig, prober Prober) (*Service, *atomic.Int64) {
+	fake := verifytest.NewResolver()
+	fake.MX["partner.mock"] = []*net.MX{{Host: "mx1.partner.mock.", Pref: 10}, {Host: "mx2.shared.mock.", Pref: 20}}
+	fake.MX["other.mock"] = []*net.MX{{Host: "mx2.shared.mock.", Pref: 10}}
+	s := newTestService(Config{Resolver: fake, Prober: prober, Polite: cfg})
+	var elapsed atomic.Int64
+	s.polite.now = func() time.Time { return politeBase.Add(time.Duration(elapsed.Load())) }
+	return s, &elapsed
+}
+
+// hammer verifies each email from its own goroutine, all at once
+func hammer(s *Service, emails []string) []*Result {
+	results := make([]*Result, len(emails))
+	start := make(chan struct{})
+	var wg sync.WaitGroup
+	for i, email := range emails {
+		wg.Add(1)
+		go func(i int, email string) {
+			defer wg.Done()
+			<-start
+			results[i] = s.Verify(email, Options{Checks: MustParseChecks(CheckSMTP)})
+		}(i, email)
+	}
+	close(start)
+	wg.Wait()
+	return results
+}
+
+// TestPoliteAddressOnce tests that concurrent verifications of one address probe it once and share the answer
+func TestPoliteAddressOnce(t *testing.T) {
+	smtp := verifytest.NewSMTP()
+	smtp.Delay = 20 * time.Millisecond
+	smtp.Mailboxes["jane@partner.mock"] = true
+	s, elapsed := newPoliteService(PoliteConfig{}, smtp.Probe)
+
+	emails := make([]string, 30)
+	for i := range emails {
+		emails[i] = "jane@partner.mock"
+	}
+	reused := 0
+	for _, r := range hammer(s, emails) {
+		if r.Verdict != VerdictDeliverable {
+			t.Errorf("Expected every caller to get the deliverable answer, got %+v", r)
+		}
+		if slices.Contains(r.Warnings, WarningSMTPReused) {
+			reused++
+		}
+	}
+	if n := smtp.Probes(); n != 1 || reused != 29 {
+		t.Errorf("Expected 1 probe and 29 reused answers, got %d and %d", n, reused)
+	}
+
+	// Each spelling is probed as written, so it gets its own probe
+	s.Verify("Jane@partner.mock", Options{Checks: MustParseChecks(CheckSMTP)})
+	if n := smtp.Probes(); n != 2 {
+		t.Errorf("Expected another spelling to be probed, got %d probes", n)
+	}
+
+	elapsed.Store(int64(DefaultPoliteAddressWindow))
+	if r := s.Verify("jane@partner.mock", Options{Checks: MustParseChecks(CheckSMTP)}); slices.Contains(r.Warnings, WarningSMTPReused) || smtp.Probes() != 3 {
+		t.Errorf("Expected a new probe after the window, got %d probes and %v", smtp.Probes(), r.Warnings)
+	}
+}
+
+// TestPoliteTransientNotKept tests that an answer asking to try again later doesn't use up the address's probe
+func TestPoliteTransientNotKept(t *testing.T) {
+	var probes atomic.Int64
+	s, _ := newPoliteService(PoliteConfig{}, func(ctx context.Context, profile, domain, username string, catchAll bool) (*emailverifier.SMTP, error) {
+		if probes.Add(1) == 1 {
+			return nil, &emailverifier.LookupError{Message: emailverifier.ErrTryAgainLater, Details: "451 4.7.1 greylisted"}
+		}
+		return &emailverifier.SMTP{HostExists: true, Deliverable: true}, nil
+	})
+	checks := MustParseChecks(CheckSMTP)
+
+	if r := s.Verify("jane@partner.mock", Options{Checks: checks}); r.ErrorCode != ErrCodeSMTPTryAgain {
+		t.Fatalf("Expected the greylisting reply, got %+v", r)
+	}
+	if r := s.Verify("jane@partner.mock", Options{Checks: checks}); r.Verdict != VerdictDeliverable || probes.Load() != 2 {
+		t.Errorf("Expected the retry to probe again, got %d probes and %+v", probes.Load(), r)
+	}
+}
+
+// TestPoliteHostRate tests that concurrent verifications of many addresses stay within each mail server's rate
+func TestPoliteHostRate(t *testing.T) {
+	smtp := verifytest.NewSMTP()
+	s, elapsed := newPoliteService(PoliteConfig{HostRate: 5}, smtp.Probe)
+
+	emails := make([]string, 40)
+	for i := range emails {
+		emails[i] = "user" + string(rune('a'+i%26)) + string(rune('a'+i/26)) + "@partner.mock"
+	}
+	deferred := 0
+	for _, r := range hammer(s, emails) {
+		if r.ErrorCode != ErrCodeProbeDeferred {
+			continue
+		}
+		deferred++
+		if r.RetryToken == "" || r.RetryAfter <= 0 || r.RetryAfter > 60 {
+			t.Errorf("Expected a retry token within the minute, got %q after %d", r.RetryToken, r.RetryAfter)
+		}
+	}
+	if n := smtp.Probes(); n != 5 || deferred != 35 {
+		t.Errorf("Expected 5 probes and 35 deferred, got %d and %d", n, deferred)
+	}
+
+	// partner.mock's probes reached the server other.mock shares with it
+	if r := s.Verify("jane@other.mock", Options{Checks: MustParseChecks(CheckSMTP)}); r.ErrorCode != ErrCodeProbeDeferred {
+		t.Errorf("Expected the shared server's rate to hold back other.mock, got %+v", r)
+	}
+
+	elapsed.Store(int64(time.Minute))
+	if r := s.Verify("jane@other.mock", Options{Checks: MustParseChecks(CheckSMTP)}); r.ErrorCode != "" {
+		t.Errorf("Expected a probe a minute later, got %+v", r)
+	}
+	if report := s.PoliteReport(); report.Deferred[DeferHostRate] != 36 {
+		t.Errorf("Expected 36 deferrals for the host rate, got %v", report.Deferred)
+	}
+}
+
+// TestPoliteRejectCooldown tests that a rejected connection keeps every caller off the server until the cooldown passes
+func TestPoliteRejectCooldown(t *testing.T) {
+	var rejecting atomic.Bool
+	rejecting.Store(true)
+	var probes atomic.Int64
+	s, elapsed := newPoliteService(PoliteConfig{RejectCooldown: time.Hour}, func(ctx context.Context, profile, domain, username string, catchAll bool) (*emailverifier.SMTP, error) {
+		probes.Add(1)
+		if rejecting.Load() {
+			return &emailverifier.SMTP{}, &emailverifier.LookupError{Message: emailverifier.ErrServerUnavailable, Details: "554 5.7.1 no probing from your network"}
+		}
+		return &emailverifier.SMTP{HostExists: true}, nil
+	})
+
+	if r := s.Verify("jane@partner.mock", Options{Checks: MustParseChecks(CheckSMTP)}); r.ErrorCode != ErrCodeSMTPBlocked {
+		t.Fatalf("Expected the rejection, got %+v", r)
+	}
+	rejecting.Store(false)
+
+	emails := []string{"a@partner.mock", "b@partner.mock", "c@other.mock", "d@other.mock"}
+	for _, r := range hammer(s, emails) {
+		if r.ErrorCode != ErrCodeProbeDeferred {
+			t.Errorf("Expected every probe deferred during the cooldown, got %+v", r)
+		}
+	}
+	if n := probes.Load(); n != 1 {
+		t.Errorf("Expected no probes during the cooldown, got %d", n-1)
+	}
+	report := s.PoliteReport()
+	if report.Deferred[DeferHostCooldown] != 4 || len(report.Hosts) != 2 || report.Hosts[0].CooldownUntil == nil || report.Hosts[0].Rejections != 1 {
+		t.Errorf("Expected both servers cooling down after 1 rejection, got %+v", report)
+	}
+
+	elapsed.Store(int64(time.Hour))
+	if r := s.Verify("a@partner.mock", Options{Checks: MustParseChecks(CheckSMTP)}); r.ErrorCode != "" {
+		t.Errorf("Expected a probe after the cooldown, got %+v", r)
+	}
+}
+
+// TestPoliteReportAndSweep tests the report's counts and that the sweep drops state past the window
+func TestPoliteReportAndSweep(t *testing.T) {
+	smtp := verifytest.NewSMTP()
+	s, _ := newPoliteService(PoliteConfig{}, smtp.Probe)
+	hammer(s, []string{"jane@partner.mock", "jane@partner.mock", "jane@partner.mock", "bob@other.mock"})
+
+	report := s.PoliteReport()
+	if report.Mode != "polite" || report.AddressesProbed != 2 || report.Addresses[0].AddressHash != AddressHash("jane@partner.mock") || report.Addresses[0].Reused != 2 {
+		t.Errorf("Expected jane probed once and reused twice first, got %+v", report)
+	}
+	if report.Hosts[0].Host != "mx2.shared.mock" || report.Hosts[0].InWindow != 2 || report.Hosts[0].LastMinute != 2 {
+		t.Errorf("Expected the shared server probed twice, got %+v", report.Hosts)
+	}
+
+	if n := s.SweepPolite(politeBase.Add(DefaultPoliteAddressWindow + time.Hour)); n != 4 {
+		t.Errorf("Expected 2 addresses and 2 servers swept, got %d", n)
+	}
+	if report := s.PoliteReport(); len(report.Addresses) != 0 {
+		t.Errorf("Expected no addresses after the sweep, got %+v", report.Addresses)
+	}
+}
+
+// TestPoliteOff tests that the etiquette can be turned off and stays out of the way
+func TestPoliteOff(t *testing.T) {
+	smtp := verifytest.NewSMTP()
+	fake := verifytest.NewResolver()
+	fake.MX["partner.mock"] = []*net.MX{{Host: "mx.partner.mock.", Pref: 10}}
+	s := newTestService(Config{Resolver: fake, Prober: smtp.Probe, Polite: PoliteConfig{Off: true}})
+	hammer(s, []string{"jane@partner.mock", "jane@partner.mock", "jane@partner.mock"})
+	if n := smtp.Probes(); n != 3 {
+		t.Errorf("Expected 3 probes, got %d", n)
+	}
+	if report := s.PoliteReport(); report.Mode != "off" {
+		t.Errorf("Expected the report to say off, got %+v", report)
+	}
+	if !errors.Is(&probeDeferral{reason: DeferHostRate}, ErrProbeDeferred) || ErrorCodeFor(&probeDeferral{}) != ErrCodeProbeDeferred {
+		t.Error("Expected deferrals to be ErrProbeDeferred with their own code")
+	}
+}
@@ -0,0 +1,367 @@
+package verify
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/mail"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	emailverifier "github.com/AfterShip/email-verifier"
+)
+
+// What happens to per-profile limiter and breaker state on reload: reset
+// starts the new generation empty, migrate hands the old state over.
+const (
+	ReloadStateReset   = "reset"
+	ReloadStateMigrate = "migrate"
+)
+
+// DefaultProfile is used for API keys without a profile of their own.
+const DefaultProfile = "default"
+
+// Profile is the SMTP identity and transport used to probe mail
+// servers for an API key.
+type Profile struct {
+	Proxy     string `json:"proxy,omitempty"`
+	HelloName string `json:"hello_name,omitempty"`
+	FromEmail string `json:"from_email,omitempty"`
+}
+
+// What the library sends in EHLO and MAIL FROM when a profile doesn't say.
+const (
+	LibraryHelloName = "localhost"
+	LibraryFromEmail = "user@example.org"
+)
+
+// Identity returns the EHLO name and MAIL FROM address probes with p
+// send.
+func (p Profile) Identity() (helloName, fromEmail string) {
+	helloName, fromEmail = p.HelloName, p.FromEmail
+	if helloName == "" {
+		helloName = LibraryHelloName
+	}
+	if fromEmail == "" {
+		fromEmail = LibraryFromEmail
+	}
+	return helloName, fromEmail
+}
+
+// Validate checks that p's FROM address is a bare address and its HELLO
+// name a fully qualified hostname, since mail servers reject probes that
+// announce anything else.
+func (p Profile) Validate() error {
+	if p.FromEmail != "" {
+		addr, err := mail.ParseAddress(p.FromEmail)
+		if err != nil || addr.Address != p.FromEmail || addr.Name != "" {
+			return fmt.Errorf("from_email %q is not an email address", p.FromEmail)
+		}
+	}
+	if p.HelloName != "" && !isHostname(p.HelloName) {
+		return fmt.Errorf("hello_name %q is not a fully qualified hostname", p.HelloName)
+	}
+	return nil
+}
+
+// isHostname reports whether name is a dotted hostname of LDH labels.
+func isHostname(name string) bool {
+	name = strings.TrimSuffix(name, ".")
+	labels := strings.Split(name, ".")
+	if len(name) > 253 || len(labels) < 2 {
+		return false
+	}
+	for _, label := range labels {
+		if label == "" || len(label) > 63 || label[0] == '-' || label[len(label)-1] == '-' {
+			return false
+		}
+		for _, c := range label {
+			if !(c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || c == '-') {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// ProfileState holds per-profile state, such as limiters and breakers, that
+// outlives a single verification.
+type ProfileState struct {
+	mu     sync.Mutex
+	values map[string]interface{}
+}
+
+func newProfileState() *ProfileState {
+	return &ProfileState{values: make(map[string]interface{})}
+}
+
+// Get returns the named state, creating it with init on first use.
+func (s *ProfileState) Get(name string, init func() interface{}) interface{} {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if v, ok := s.values[name]; ok {
+		return v
+	}
+	v := init()
+	s.values[name] = v
+	return v
+}
+
+// profileGeneration is one loaded set of profiles. Reloading replaces the
+// current generation; the old one drains and is then closed.
+type profileGeneration struct {
+	id       int64
+	profiles map[string]Profile
+	clients  map[string]*SMTPClient
+	states   map[string]*ProfileState
+	loadedAt time.Time
+
+	inFlight atomic.Int64
+	idle     chan struct{} // closed once retired and inFlight reaches zero
+	idleOnce sync.Once
+	retired  atomic.Bool
+	closed   atomic.Bool
+}
+
+// ProfileLease pins a generation while a probe uses its client.
+type ProfileLease struct {
+	gen    *profileGeneration
+	Name   string
+	Client *SMTPClient
+	State  *ProfileState
+}
+
+// Generation returns the id of the generation the lease was taken from.
+func (l *ProfileLease) Generation() int64 { return l.gen.id }
+
+// Stale reports whether the lease's generation was closed while it was held,
+// meaning its settings must not be trusted any more.
+func (l *ProfileLease) Stale() bool { return l.gen.closed.Load() }
+
+// Release returns the lease.
+func (l *ProfileLease) Release() {
+	if l.gen.inFlight.Add(-1) == 0 && l.gen.retired.Load() {
+		l.gen.signalIdle()
+	}
+}
+
+func (g *profileGeneration) signalIdle() {
+	g.idleOnce.Do(func() { close(g.idle) })
+}
+
+// ProfileRegistry versions verifier profiles so a reload never mixes old and
+// new settings: new probes always lease the current generation, and retired
+// generations are closed once their probes finish or the drain window ends,
+// whichever comes first.
+type ProfileRegistry struct {
+	mu      sync.Mutex
+	current atomic.Pointer[profileGeneration]
+	retired []*profileGeneration
+	nextID  int64
+	drain   time.Duration
+	policy  string
+	// fallback is the default profile of sets that don't define one
+	fallback Profile
+	build    func(Profile) *SMTPClient
+	now      func() time.Time
+}
+
+// NewProfileRegistry loads initial as the first generation. Replaced
+// generations get drain to finish their probes; policy says what happens to
+// per-profile state on reload.
+func NewProfileRegistry(initial map[string]Profile, drain time.Duration, policy string, build func(Profile) *SMTPClient) *ProfileRegistry {
+	return newProfileRegistry(initial, Profile{}, drain, policy, build)
+}
+
+func newProfileRegistry(initial map[string]Profile, fallback Profile, drain time.Duration, policy string, build func(Profile) *SMTPClient) *ProfileRegistry {
+	r := &ProfileRegistry{drain: drain, policy: policy, fallback: fallback, build: build, now: time.Now}
+	r.current.Store(r.newGeneration(initial, nil))
+	return r
+}
+
+func (r *ProfileRegistry) newGeneration(set map[string]Profile, previous *profileGeneration) *profileGeneration {
+	r.nextID++
+	if _, ok := set[DefaultProfile]; !ok {
+		withDefault := make(map[string]Profile, len(set)+1)
+		for name, p := range set {
+			withDefault[name] = p
+		}
+		withDefault[DefaultProfile] = r.fallback
+		set = withDefault
+	}
+
+	gen := &profileGeneration{
+		id:       r.nextID,
+		profiles: set,
+		clients:  make(map[string]*SMTPClient, len(set)),
+		states:   make(map[string]*ProfileState, len(set)),
+		loadedAt: r.now(),
+		idle:     make(chan struct{}),
+	}
+	for name, p := range set {
+		gen.clients[name] = r.build(p)
+		if previous != nil && r.policy == ReloadStateMigrate {
+			if state, ok := previous.states[name]; ok {
+				gen.states[name] = state
+				continue
+			}
+		}
+		gen.states[name] = newProfileState()
+	}
+	return gen
+}
+
+// Acquire leases the current generation's profile for key.
+func (r *ProfileRegistry) Acquire(key string) *ProfileLease {
+	for {
+		gen := r.current.Load()
+		gen.inFlight.Add(1)
+		// A reload may have retired gen between the load and the increment;
+		// if so, give it back and lease the replacement.
+		if gen.retired.Load() {
+			(&ProfileLease{gen: gen}).Release()
+			continue
+		}
+		name := key
+		if _, ok := gen.profiles[name]; !ok {
+			name = DefaultProfile
+		}
+		return &ProfileLease{
+			gen:    gen,
+			Name:   name,
+			Client: gen.clients[name],
+			State:  gen.states[name],
+		}
+	}
+}
+
+// Default returns the current default profile.
+func (r *ProfileRegistry) Default() Profile {
+	return r.current.Load().profiles[DefaultProfile]
+}
+
+// Reload installs set as a new generation and starts draining the old one.
+// It returns the new generation's id.
+func (r *ProfileRegistry) Reload(set map[string]Profile) int64 {
+	r.mu.Lock()
+	old := r.current.Load()
+	gen := r.newGeneration(set, old)
+	r.current.Store(gen)
+	old.retired.Store(true)
+	r.retired = append(r.retired, old)
+	r.mu.Unlock()
+
+	if old.inFlight.Load() == 0 {
+		old.signalIdle()
+	}
+	go r.drainGeneration(old)
+	return gen.id
+}
+
+// drainGeneration closes gen once it is idle or the drain window expires.
+func (r *ProfileRegistry) drainGeneration(gen *profileGeneration) {
+	timer := time.NewTimer(r.drain)
+	defer timer.Stop()
+	select {
+	case <-gen.idle:
+	case <-timer.C:
+	}
+	r.closeGeneration(gen)
+}
+
+func (r *ProfileRegistry) closeGeneration(gen *profileGeneration) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	gen.closed.Store(true)
+	for i, g := range r.retired {
+		if g == gen {
+			r.retired = append(r.retired[:i], r.retired[i+1:]...)
+			break
+		}
+	}
+}
+
+// ProfileGenerationStatus describes a loaded generation.
+type ProfileGenerationStatus struct {
+	Generation int64     `json:"generation"`
+	Profiles   []string  `json:"profiles"`
+	LoadedAt   time.Time `json:"loaded_at"`
+	InFlight   int64     `json:"in_flight"`
+}
+
+// Policy returns the reload state policy.
+func (r *ProfileRegistry) Policy() string { return r.policy }
+
+// Drain returns how long replaced generations get to drain.
+func (r *ProfileRegistry) Drain() time.Duration { return r.drain }
+
+// Status reports the current generation and any still draining.
+func (r *ProfileRegistry) Status() (current ProfileGenerationStatus, draining []ProfileGenerationStatus) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	current = r.current.Load().status()
+	draining = make([]ProfileGenerationStatus, 0, len(r.retired))
+	for _, gen := range r.retired {
+		draining = append(draining, gen.status())
+	}
+	return current, draining
+}
+
+func (g *profileGeneration) status() ProfileGenerationStatus {
+	names := make([]string, 0, len(g.profiles))
+	for name := range g.profiles {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return ProfileGenerationStatus{
+		Generation: g.id,
+		Profiles:   names,
+		LoadedAt:   g.loadedAt,
+		InFlight:   g.inFlight.Load(),
+	}
+}
+
+// probeSMTP checks a mailbox using key's profile, running the catch-all
+// probe first when catchAll is set, and fills in report. A probe whose
+// generation was closed underneath it ran with settings that have since
+// been replaced, so it is repeated once on the current generation. Stale
+// is read before the lease is released, since releasing the last lease of
+// a retired generation closes it.
+func (s *Service) probeSMTP(ctx context.Context, key, domain, username string, catchAll bool, report *probeReport) (*emailverifier.SMTP, error) {
+	for attempt := 0; ; attempt++ {
+		lease := s.profiles.Acquire(key)
+		smtp, answered, err := lease.Client.check(ctx, s.resolver, domain, username, catchAll)
+		*report = answered
+		stale := lease.Stale()
+		lease.Release()
+		if !stale || attempt > 0 {
+			return smtp, err
+		}
+	}
+}
+
+// LoadProfiles reads a JSON file mapping API keys (or "default") to
+// verifier profiles.
+func LoadProfiles(path string) (map[string]Profile, error) {
+	if path == "" {
+		return nil, nil
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var set map[string]Profile
+	if err := json.Unmarshal(data, &set); err != nil {
+		return nil, fmt.Errorf("parse profiles config %s: %v", path, err)
+	}
+	for name, p := range set {
+		if err := p.Validate(); err != nil {
+			return nil, fmt.Errorf("profiles config %s: profile %s: %v", path, name, err)
+		}
+	}
+	return set, nil
+}
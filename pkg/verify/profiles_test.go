@@ -0,0 +1,195 @@
+package verify
+
+import (
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// fakeProfileBuilder builds clients without touching the network and
+// remembers which profile each came from.
+func fakeProfileBuilder(built *sync.Map) func(Profile) *SMTPClient {
+	return func(p Profile) *SMTPClient {
+		c := NewSMTPClient(p)
+		built.Store(c, p)
+		return c
+	}
+}
+
+// TestProfileReloadMidTraffic tests that no lease taken after a reload sees the old settings
+func TestProfileReloadMidTraffic(t *testing.T) {
+	var built sync.Map
+	registry := NewProfileRegistry(map[string]Profile{"team": {HelloName: "old.example"}}, 50*time.Millisecond, ReloadStateReset, fakeProfileBuilder(&built))
+
+	var reloaded atomic.Bool
+	var stale atomic.Int64
+	stop := make(chan struct{})
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				select {
+				case <-stop:
+					return
+				default:
+				}
+				after := reloaded.Load()
+				lease := registry.Acquire("team")
+				p, _ := built.Load(lease.Client)
+				if after && p.(Profile).HelloName != "new.example" {
+					stale.Add(1)
+				}
+				time.Sleep(time.Millisecond)
+				lease.Release()
+			}
+		}()
+	}
+
+	time.Sleep(20 * time.Millisecond)
+	if generation := registry.Reload(map[string]Profile{"team": {HelloName: "new.example"}}); generation != 2 {
+		t.Errorf("Expected generation 2, got %d", generation)
+	}
+	reloaded.Store(true)
+	time.Sleep(100 * time.Millisecond)
+	close(stop)
+	wg.Wait()
+
+	if n := stale.Load(); n != 0 {
+		t.Errorf("Expected no leases with old settings after reload, got %d", n)
+	}
+	current, draining := registry.Status()
+	if current.Generation != 2 {
+		t.Errorf("Expected current generation 2, got %d", current.Generation)
+	}
+	if len(draining) != 0 {
+		t.Errorf("Expected old generation to be closed after the drain window, got %+v", draining)
+	}
+}
+
+// TestProfileDrainWindow tests that a probe outliving the drain window is marked stale
+func TestProfileDrainWindow(t *testing.T) {
+	var built sync.Map
+	registry := NewProfileRegistry(nil, 20*time.Millisecond, ReloadStateReset, fakeProfileBuilder(&built))
+
+	quick := registry.Acquire("anyone")
+	slow := registry.Acquire("anyone")
+	if quick.Name != DefaultProfile {
+		t.Errorf("Expected unknown key to use %q, got %q", DefaultProfile, quick.Name)
+	}
+
+	registry.Reload(nil)
+	quick.Release()
+	if _, draining := registry.Status(); len(draining) != 1 || draining[0].InFlight != 1 {
+		t.Fatalf("Expected one draining generation with one probe, got %+v", draining)
+	}
+
+	time.Sleep(50 * time.Millisecond)
+	if !slow.Stale() {
+		t.Error("Expected lease held past the drain window to be stale")
+	}
+	slow.Release()
+	if lease := registry.Acquire("anyone"); lease.Stale() || lease.Generation() != 2 {
+		t.Errorf("Expected fresh lease on generation 2, got generation %d stale=%v", lease.Generation(), lease.Stale())
+	}
+}
+
+// TestProfileIdleGenerationClosesEarly tests that a drained generation closes without waiting out the window
+func TestProfileIdleGenerationClosesEarly(t *testing.T) {
+	var built sync.Map
+	registry := NewProfileRegistry(nil, time.Hour, ReloadStateReset, fakeProfileBuilder(&built))
+
+	lease := registry.Acquire("")
+	registry.Reload(nil)
+	lease.Release()
+
+	deadline := time.Now().Add(time.Second)
+	for time.Now().Before(deadline) {
+		if _, draining := registry.Status(); len(draining) == 0 {
+			return
+		}
+		time.Sleep(time.Millisecond)
+	}
+	t.Error("Expected idle generation to close before the drain window")
+}
+
+// TestProfileReloadStatePolicy tests the reset and migrate policies for per-profile state
+func TestProfileReloadStatePolicy(t *testing.T) {
+	testCases := []struct {
+		policy string
+		shared bool
+	}{
+		{ReloadStateReset, false},
+		{ReloadStateMigrate, true},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.policy, func(t *testing.T) {
+			var built sync.Map
+			registry := NewProfileRegistry(nil, time.Millisecond, tc.policy, fakeProfileBuilder(&built))
+			newState := func() interface{} { return new(int) }
+
+			lease := registry.Acquire("")
+			before := lease.State.Get("state", newState)
+			lease.Release()
+
+			registry.Reload(nil)
+			lease = registry.Acquire("")
+			after := lease.State.Get("state", newState)
+			lease.Release()
+
+			if (before == after) != tc.shared {
+				t.Errorf("Expected state shared=%v across reload, got %v", tc.shared, before == after)
+			}
+		})
+	}
+}
+
+// TestProfileFallbackDefault tests that the configured default profile stands in whenever a loaded set has none
+func TestProfileFallbackDefault(t *testing.T) {
+	var built sync.Map
+	fallback := Profile{HelloName: "probe.example", Proxy: "socks5://127.0.0.1:1080"}
+	registry := newProfileRegistry(map[string]Profile{"team": {HelloName: "team.example"}}, fallback, time.Millisecond, ReloadStateReset, fakeProfileBuilder(&built))
+	profileOf := func(key string) Profile {
+		lease := registry.Acquire(key)
+		defer lease.Release()
+		p, _ := built.Load(lease.Client)
+		return p.(Profile)
+	}
+	if p := profileOf("unknown-key"); p != fallback {
+		t.Errorf("Expected the fallback default, got %+v", p)
+	}
+	registry.Reload(map[string]Profile{})
+	if p := profileOf("unknown-key"); p != fallback {
+		t.Errorf("Expected the fallback default after a reload, got %+v", p)
+	}
+	registry.Reload(map[string]Profile{DefaultProfile: {HelloName: "file.example"}})
+	if p := profileOf("unknown-key"); p.HelloName != "file.example" {
+		t.Errorf("Expected the loaded default to win, got %+v", p)
+	}
+}
+
+// TestProfileValidate tests the HELLO names and FROM addresses profiles accept
+func TestProfileValidate(t *testing.T) {
+	testCases := []struct {
+		profile Profile
+		valid   bool
+	}{
+		{Profile{}, true},
+		{Profile{HelloName: "mail.example.com", FromEmail: "verify@example.com"}, true},
+		{Profile{HelloName: "mail.example.com."}, true},
+		{Profile{HelloName: "localhost"}, false},
+		{Profile{HelloName: "mail_server.example.com"}, false},
+		{Profile{HelloName: "-mail.example.com"}, false},
+		{Profile{HelloName: "mail..example.com"}, false},
+		{Profile{FromEmail: "not-an-address"}, false},
+		{Profile{FromEmail: "Verifier <verify@example.com>"}, false},
+	}
+	for _, tc := range testCases {
+		if err := tc.profile.Validate(); (err == nil) != tc.valid {
+			t.Errorf("Expected %+v valid=%v, got %v", tc.profile, tc.valid, err)
+		}
+	}
+}
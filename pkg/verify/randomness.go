@@ -0,0 +1,130 @@
+package verify
+
+import (
+	"bufio"
+	_ "embed"
+	"math"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// WarningRandomLocalPart flags a local part that looks machine-generated,
+// as bot signups often are.
+const WarningRandomLocalPart = "random_local_part"
+
+// DefaultRandomnessThreshold is the LocalPartRandomness score above which
+// WarningRandomLocalPart is added.
+const DefaultRandomnessThreshold = 0.5
+
+//go:embed localparts.txt
+var localPartBigrams string
+
+// bigramModel is the likelihood of each letter following another in real
+// local parts, from the embedded frequency table.
+type bigramModel struct {
+	counts map[string]float64
+	totals map[byte]float64
+}
+
+var loadBigramModel = sync.OnceValue(func() *bigramModel {
+	m := &bigramModel{counts: make(map[string]float64), totals: make(map[byte]float64)}
+	scanner := bufio.NewScanner(strings.NewReader(localPartBigrams))
+	for scanner.Scan() {
+		line := scanner.Text()
+		if strings.HasPrefix(line, "#") {
+			continue
+		}
+		pair, count, ok := strings.Cut(line, " ")
+		n, err := strconv.Atoi(count)
+		if !ok || len(pair) != 2 || err != nil {
+			continue
+		}
+		m.counts[pair] += float64(n)
+		m.totals[pair[0]] += float64(n)
+	}
+	return m
+})
+
+// surprisal is the mean negative log likelihood of a letter run's bigrams,
+// with add-one smoothing over the 26 letters and the end marker.
+func (m *bigramModel) surprisal(run string) float64 {
+	word := "^" + run + "$"
+	total := 0.0
+	for i := 0; i+1 < len(word); i++ {
+		p := (m.counts[word[i:i+2]] + 1) / (m.totals[word[i]] + 27)
+		total -= math.Log(p)
+	}
+	return total / float64(len(word)-1)
+}
+
+// Surprisal of real names sits below randomnessLow; strings of random
+// letters score above randomnessHigh.
+const (
+	randomnessLow  = 2.6
+	randomnessHigh = 4.2
+)
+
+// LocalPartRandomness scores how machine-generated a local part looks,
+// from 0 (a name or word) to 1 (random characters). It combines how
+// unlikely its letter sequences are in real local parts, how often it
+// switches between letters and digits, and its digit density, discounted
+// for short local parts, which carry too little to judge. A +tag is
+// ignored, and so is a trailing number of up to four digits after letters
+// alone, as in john.smith1985.
+func LocalPartRandomness(local string) float64 {
+	local = strings.ToLower(local)
+	if tag := strings.IndexByte(local, '+'); tag >= 0 {
+		local = local[:tag]
+	}
+	trimmed := strings.TrimRight(local, "0123456789")
+	if len(local)-len(trimmed) <= 4 && !strings.ContainsAny(trimmed, "0123456789") {
+		local = trimmed
+	}
+
+	model := loadBigramModel()
+	var chars, letters, digits, transitions int
+	var weighted float64
+	for _, segment := range strings.FieldsFunc(local, func(r rune) bool { return r == '.' || r == '_' || r == '-' }) {
+		runStart, prevDigit := 0, false
+		for i := 0; i <= len(segment); i++ {
+			isDigit := i < len(segment) && segment[i] >= '0' && segment[i] <= '9'
+			isLetter := i < len(segment) && segment[i] >= 'a' && segment[i] <= 'z'
+			if i > 0 && i < len(segment) && isDigit != prevDigit {
+				transitions++
+			}
+			if !isLetter {
+				if i > runStart {
+					run := segment[runStart:i]
+					weighted += model.surprisal(run) * float64(len(run))
+					letters += len(run)
+				}
+				runStart = i + 1
+			}
+			if i < len(segment) {
+				chars++
+				if isDigit {
+					digits++
+				}
+				prevDigit = isDigit
+			}
+		}
+	}
+	if chars < 4 {
+		return 0
+	}
+
+	unlikely := 0.0
+	if letters > 0 {
+		unlikely = clamp01((weighted/float64(letters) - randomnessLow) / (randomnessHigh - randomnessLow))
+	}
+	switching := clamp01(2 * float64(transitions) / float64(chars-1))
+	density := float64(digits) / float64(chars)
+	score := math.Max(unlikely, 0.3*unlikely+0.5*switching+0.2*density)
+	confidence := math.Min(1, float64(chars)/8)
+	return math.Round(score*confidence*100) / 100
+}
+
+func clamp01(x float64) float64 {
+	return math.Max(0, math.Min(1, x))
+}
@@ -0,0 +1,59 @@
+package verify
+
+import (
+	"slices"
+	"testing"
+)
+
+// TestLocalPartRandomness tests that common mailbox patterns score low and random strings score high
+func TestLocalPartRandomness(t *testing.T) {
+	realistic := []string{
+		"john.smith", "jane_doe", "maria.garcia+newsletter", "john.smith1985", "mike88",
+		"sarah_j", "li.wei", "nguyen.van.minh", "kevin-oconnor", "j.r.r.tolkien",
+		"jsmith", "christopher.wilson", "thomas.mueller", "info", "support", "user2024",
+		"olivia+shopping", "priya.sharma", "takahashi", "bob",
+	}
+	random := []string{
+		"xk7q2m9p", "qzxvbnrt", "hjkqwxzp", "vbxqrtzk", "8f3k2l9x1", "a8s7d6f5g4",
+		"jd83kdl29d", "q1w9z8x2", "zq3x9v7w", "k4j2h5g8", "dk39fj20sl", "fjdkslaq",
+	}
+
+	for _, local := range realistic {
+		if score := LocalPartRandomness(local); score > 0.3 {
+			t.Errorf("Expected %s to look real, got %.2f", local, score)
+		}
+	}
+	for _, local := range random {
+		if score := LocalPartRandomness(local); score <= DefaultRandomnessThreshold {
+			t.Errorf("Expected %s to look random, got %.2f", local, score)
+		}
+	}
+	if LocalPartRandomness("xk7q2m9p+tag") != LocalPartRandomness("XK7Q2M9P") {
+		t.Error("Expected the tag and case to be ignored")
+	}
+}
+
+// TestRandomLocalPartWarning tests the warning threshold and the policy signal it raises
+func TestRandomLocalPartWarning(t *testing.T) {
+	checks := MustParseChecks(CheckSyntax)
+	testCases := []struct {
+		name    string
+		cfg     Config
+		email   string
+		warning bool
+		verdict string
+	}{
+		{"name", Config{}, "john.smith@example.com", false, VerdictUnknown},
+		{"random", Config{}, "xk7q2m9p@example.com", true, VerdictUnknown},
+		{"raised threshold", Config{RandomnessThreshold: 0.95}, "xk7q2m9p@example.com", false, VerdictUnknown},
+		{"policy", Config{Policies: PolicyConfig{Global: VerdictPolicy{SignalRandomLocal: EffectRisky}}}, "xk7q2m9p@example.com", true, VerdictRisky},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			result := newTestService(tc.cfg).Verify(tc.email, Options{Checks: checks})
+			if got := slices.Contains(result.Warnings, WarningRandomLocalPart); got != tc.warning || result.Verdict != tc.verdict {
+				t.Errorf("Expected warning %v and verdict %s, got %v and %s (score %.2f)", tc.warning, tc.verdict, got, result.Verdict, result.LocalPartRandomness)
+			}
+		})
+	}
+}
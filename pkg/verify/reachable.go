@@ -0,0 +1,68 @@
+package verify
+
+import "slices"
+
+// Reasons reported in Result.ReachableReason. A verification that failed
+// reports its error code instead, such as ErrCodeSMTPTimeout.
+const (
+	ReachableReasonDeliverable     = "smtp_deliverable"   // the server accepted the mailbox
+	ReachableReasonMailboxNotFound = "mailbox_not_found"  // the server rejected the mailbox
+	ReachableReasonCatchAll        = "catch_all_domain"   // the server accepts every mailbox
+	ReachableReasonAllowlisted     = "allowlisted_domain" // see Config.SkipSMTPDomains
+	ReachableReasonNoMX            = "domain_no_mx"       // the domain exists without mail service
+	ReachableReasonNullMX          = "domain_null_mx"
+	ReachableReasonNotFound        = "domain_not_found"
+	ReachableReasonNotRoutable     = "domain_not_routable"
+	ReachableReasonInvalid         = "invalid_address"
+	ReachableReasonSuppressed      = "suppressed"
+	ReachableReasonNotChecked      = "smtp_not_checked"  // no probe: not asked for or skipped
+	ReachableReasonInconclusive    = "smtp_inconclusive" // probed without a clear answer
+)
+
+// invalidCodes are the error codes of addresses that are invalid, as
+// opposed to verifications that failed.
+var invalidCodes = []string{ErrCodeEmailRequired, ErrCodeInvalidSyntax, ErrCodeAmbiguousLegacyRoute, ErrCodeLegacyNotAccepted, ErrCodeDomainBlocked, ErrCodeMultipleAddresses}
+
+// ReachableReasons lists every value of Result.ReachableReason.
+var ReachableReasons = append([]string{
+	ReachableReasonDeliverable, ReachableReasonMailboxNotFound, ReachableReasonCatchAll, ReachableReasonAllowlisted,
+	ReachableReasonNoMX, ReachableReasonNullMX, ReachableReasonNotFound, ReachableReasonNotRoutable,
+	ReachableReasonInvalid, ReachableReasonSuppressed, ReachableReasonNotChecked, ReachableReasonInconclusive,
+}, slices.DeleteFunc(slices.Clone(ErrorCodes), func(code string) bool { return slices.Contains(invalidCodes, code) })...)
+
+// reachableReasonFor explains result.Reachable.
+func reachableReasonFor(result *Result) string {
+	switch {
+	case slices.Contains(invalidCodes, result.ErrorCode):
+		return ReachableReasonInvalid
+	case result.ErrorCode != "":
+		return result.ErrorCode
+	case !result.IsValid:
+		return ReachableReasonInvalid
+	case result.Suppressed:
+		return ReachableReasonSuppressed
+	}
+	switch result.DomainStatus {
+	case DomainNXDomain:
+		return ReachableReasonNotFound
+	case DomainNullMX:
+		return ReachableReasonNullMX
+	case DomainNoMailService:
+		return ReachableReasonNoMX
+	case DomainNonRoutable:
+		return ReachableReasonNotRoutable
+	}
+	switch {
+	case result.SMTPSkippedReason == SMTPSkippedAllowlisted:
+		return ReachableReasonAllowlisted
+	case !slices.Contains(result.ChecksPerformed, CheckSMTP):
+		return ReachableReasonNotChecked
+	case result.CatchAll:
+		return ReachableReasonCatchAll
+	case result.Reachable == ReachableYes:
+		return ReachableReasonDeliverable
+	case result.Reachable == ReachableNo:
+		return ReachableReasonMailboxNotFound
+	}
+	return ReachableReasonInconclusive
+}
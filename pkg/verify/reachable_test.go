@@ -0,0 +1,156 @@
+package verify
+
+import (
+	"context"
+	"errors"
+	"net"
+	"slices"
+	"testing"
+	"time"
+
+	emailverifier "github.com/AfterShip/email-verifier"
+
+	"email-verifier/pkg/verify/verifytest"
+)
+
+// TestReachableReasonsEmitted tests that crafted inputs produce every reachable reason and every error code
+func TestReachableReasonsEmitted(t *testing.T) {
+	fake := verifytest.NewResolver()
+	smtp := verifytest.NewSMTP()
+	for _, domain := range []string{"partner.mock", "catchall.mock", "allow.mock", "deferred.mock", "suppressed.mock", "timeout.mock", "blocked.mock", "down.mock", "later.mock", "broken.mock", "slow.mock"} {
+		fake.MX[domain] = []*net.MX{{Host: "mx." + domain + ".", Pref: 10}}
+	}
+	fake.MX["nullmx.mock"] = []*net.MX{{Host: ".", Pref: 0}}
+	fake.Hosts["web.mock"] = []string{"192.0.2.1"}
+	fake.Err["dnstimeout.mock"] = &net.DNSError{Err: "i/o timeout", Name: "dnstimeout.mock", IsTimeout: true}
+	fake.Err["dnsfail.mock"] = &net.DNSError{Err: "server misbehaving", Name: "dnsfail.mock"}
+	smtp.Mailboxes["jane@partner.mock"] = true
+	smtp.CatchAll["catchall.mock"] = true
+	smtp.Errors["timeout.mock"] = &emailverifier.LookupError{Message: emailverifier.ErrTimeout}
+	smtp.Errors["blocked.mock"] = &emailverifier.LookupError{Message: emailverifier.ErrBlocked}
+	smtp.Errors["down.mock"] = &emailverifier.LookupError{Message: emailverifier.ErrServerUnavailable}
+	smtp.Errors["later.mock"] = &emailverifier.LookupError{Message: emailverifier.ErrTryAgainLater}
+	smtp.Errors["broken.mock"] = &emailverifier.LookupError{Message: emailverifier.ErrNeedMAILBeforeRCPT}
+	smtp.Errors["web.mock"] = &emailverifier.LookupError{Message: emailverifier.ErrServerUnavailable}
+	prober := func(ctx context.Context, profile, domain, username string, catchAll bool) (*emailverifier.SMTP, error) {
+		if domain == "slow.mock" {
+			// Connected, but the server never answered the mailbox
+			return nil, nil
+		}
+		return smtp.Probe(ctx, profile, domain, username, catchAll)
+	}
+	s := newTestService(Config{
+		Resolver:        fake,
+		Prober:          prober,
+		SkipSMTPDomains: []string{"allow.mock"},
+		BlockedDomains:  []string{"blocked-list.mock"},
+	})
+	s.Suppressions().Add(DefaultTenant, "esp", "@suppressed.mock", time.Now())
+	cancelled, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	testCases := []struct {
+		email  string
+		opts   Options
+		reason string
+	}{
+		{"jane@partner.mock", Options{}, ReachableReasonDeliverable},
+		{"john@partner.mock", Options{}, ReachableReasonMailboxNotFound},
+		{"jane@catchall.mock", Options{}, ReachableReasonCatchAll},
+		{"jane@allow.mock", Options{}, ReachableReasonAllowlisted},
+		{"jane@web.mock", Options{}, ReachableReasonNoMX},
+		{"jane@nullmx.mock", Options{}, ReachableReasonNullMX},
+		{"jane@missing.mock", Options{}, ReachableReasonNotFound},
+		{"jane@printer.invalid", Options{}, ReachableReasonNotRoutable},
+		{"jane@suppressed.mock", Options{}, ReachableReasonSuppressed},
+		{"jane@partner.mock", Options{Checks: MustParseChecks(CheckMX)}, ReachableReasonNotChecked},
+		{"jane@slow.mock", Options{}, ReachableReasonInconclusive},
+		{"", Options{}, ReachableReasonInvalid},
+		{"not-an-address", Options{}, ReachableReasonInvalid},
+		{"seismo!jane", Options{}, ReachableReasonInvalid},
+		{"jane@blocked-list.mock", Options{}, ReachableReasonInvalid},
+		{"jane@partner.mock, john@partner.mock", Options{}, ReachableReasonInvalid},
+		{"jane@dnstimeout.mock", Options{}, ErrCodeDNSTimeout},
+		{"jane@dnsfail.mock", Options{}, ErrCodeDNS},
+		{"jane@timeout.mock", Options{}, ErrCodeSMTPTimeout},
+		{"jane@blocked.mock", Options{}, ErrCodeSMTPBlocked},
+		{"jane@down.mock", Options{}, ErrCodeSMTPUnavailable},
+		{"jane@later.mock", Options{}, ErrCodeSMTPTryAgain},
+		{"jane@broken.mock", Options{}, ErrCodeSMTP},
+		{"jane@partner.mock", Options{Context: cancelled}, ErrCodeDeadlineExceeded},
+	}
+
+	reasons := make(map[string]bool)
+	codes := make(map[string]bool)
+	for _, tc := range testCases {
+		if tc.opts.Checks == nil {
+			tc.opts.Checks = MustParseChecks(CheckOrder...)
+		}
+		result := s.Verify(tc.email, tc.opts)
+		if result.ReachableReason != tc.reason {
+			t.Errorf("Expected %s for %q, got %s: %+v", tc.reason, tc.email, result.ReachableReason, result)
+		}
+		if result.ErrorMessage != result.Error || (result.ErrorCode == "") != (result.ErrorMessage == "") {
+			t.Errorf("Expected error_message to go with error_code for %q, got %q and %q", tc.email, result.ErrorCode, result.ErrorMessage)
+		}
+		reasons[result.ReachableReason] = true
+		codes[result.ErrorCode] = true
+	}
+
+	strict := newTestService(Config{Resolver: fake, Prober: prober, LegacyAddresses: LegacyReject})
+	result := strict.Verify("jane%partner.mock@relay.mock", Options{Checks: DefaultChecks})
+	if result.ReachableReason != ReachableReasonInvalid {
+		t.Errorf("Expected %s for a rejected legacy route, got %s", ReachableReasonInvalid, result.ReachableReason)
+	}
+	codes[result.ErrorCode] = true
+
+	// A second address at a server that takes one probe a minute waits
+	polite := newTestService(Config{Resolver: fake, Prober: prober, Polite: PoliteConfig{HostRate: 1}})
+	polite.Verify("jane@deferred.mock", Options{Checks: MustParseChecks(CheckSMTP)})
+	result = polite.Verify("john@deferred.mock", Options{Checks: MustParseChecks(CheckSMTP)})
+	reasons[result.ReachableReason] = true
+	codes[result.ErrorCode] = true
+
+	// A domain that timed out once before is skipped by a one-failure breaker
+	tripped := newTestService(Config{Resolver: fake, Prober: prober, Circuit: CircuitConfig{Failures: 1}})
+	tripped.Verify("jane@timeout.mock", Options{Checks: MustParseChecks(CheckSMTP)})
+	result = tripped.Verify("john@timeout.mock", Options{Checks: MustParseChecks(CheckSMTP)})
+	reasons[result.ReachableReason] = true
+	codes[result.ErrorCode] = true
+
+	unavailable := New(Config{BuildVerifier: func() (*emailverifier.Verifier, error) {
+		return nil, errors.New("disposable list failed to load")
+	}})
+	result = unavailable.Verify("jane@partner.mock", Options{Checks: DefaultChecks})
+	reasons[result.ReachableReason] = true
+	codes[result.ErrorCode] = true
+
+	// Refs are resolved before Verify, which never sees the codes for them
+	for _, code := range []string{ErrCodeRefNotFound, ErrCodeRefResolverFailed} {
+		result := ErrorResult(code)
+		if result.ReachableReason != code || result.ErrorMessage == "" {
+			t.Errorf("Expected %s with a message, got %+v", code, result)
+		}
+		reasons[result.ReachableReason] = true
+		codes[result.ErrorCode] = true
+	}
+
+	for _, reason := range ReachableReasons {
+		if !reasons[reason] {
+			t.Errorf("Expected reason %s to be emitted", reason)
+		}
+	}
+	for _, code := range ErrorCodes {
+		if !codes[code] {
+			t.Errorf("Expected error code %s to be emitted", code)
+		}
+		if errorMessages[code] == "" {
+			t.Errorf("Expected a message for %s", code)
+		}
+	}
+	for reason := range reasons {
+		if !slices.Contains(ReachableReasons, reason) {
+			t.Errorf("Expected %s to be listed in ReachableReasons", reason)
+		}
+	}
+}
@@ -0,0 +1,177 @@
+package verify
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+	"time"
+
+	emailverifier "github.com/AfterShip/email-verifier"
+)
+
+// Recommended delays before a transient failure is worth retrying. Greylisting
+// servers usually accept the second attempt after a few minutes; timeouts are
+// more often a passing network problem.
+const (
+	greylistRetryDelay = 5 * time.Minute
+	timeoutRetryDelay  = 1 * time.Minute
+)
+
+// Errors returned by RetrySigner.Parse.
+var (
+	ErrTokenMalformed = errors.New("malformed retry token")
+	ErrTokenSignature = errors.New("invalid retry token signature")
+	ErrTokenExpired   = errors.New("retry token has expired")
+)
+
+// RetryClaims is the signed payload of a retry token.
+type RetryClaims struct {
+	AddressHash string `json:"h"`
+	NotBefore   int64  `json:"nbf"`
+	Expires     int64  `json:"exp"`
+}
+
+// RetrySigner issues and checks HMAC-signed retry tokens.
+type RetrySigner struct {
+	key    []byte
+	window time.Duration
+	now    func() time.Time
+}
+
+// NewRetrySigner creates a signer whose tokens stay valid for window after
+// their retry delay. When key is empty a random key is generated, so tokens
+// only stay valid for the lifetime of the process.
+func NewRetrySigner(key []byte, window time.Duration) *RetrySigner {
+	if len(key) == 0 {
+		key = make([]byte, 32)
+		if _, err := rand.Read(key); err != nil {
+			panic(fmt.Sprintf("generate retry token key: %v", err))
+		}
+	}
+	return &RetrySigner{key: key, window: window, now: time.Now}
+}
+
+// Issue returns a token for email that becomes usable after delay and expires
+// once the signer's window has passed.
+func (s *RetrySigner) Issue(email string, delay time.Duration) string {
+	now := s.now()
+	claims := RetryClaims{
+		AddressHash: AddressHash(email),
+		NotBefore:   now.Add(delay).Unix(),
+		Expires:     now.Add(delay + s.window).Unix(),
+	}
+	payload, _ := json.Marshal(claims)
+	encoded := base64.RawURLEncoding.EncodeToString(payload)
+	return encoded + "." + base64.RawURLEncoding.EncodeToString(s.sign(encoded))
+}
+
+// Parse validates the token signature and expiry and returns its claims.
+func (s *RetrySigner) Parse(token string) (*RetryClaims, error) {
+	encoded, sig, ok := strings.Cut(token, ".")
+	if !ok {
+		return nil, ErrTokenMalformed
+	}
+	rawSig, err := base64.RawURLEncoding.DecodeString(sig)
+	if err != nil {
+		return nil, ErrTokenMalformed
+	}
+	if !hmac.Equal(rawSig, s.sign(encoded)) {
+		return nil, ErrTokenSignature
+	}
+	payload, err := base64.RawURLEncoding.DecodeString(encoded)
+	if err != nil {
+		return nil, ErrTokenMalformed
+	}
+	var claims RetryClaims
+	if err := json.Unmarshal(payload, &claims); err != nil {
+		return nil, ErrTokenMalformed
+	}
+	if s.now().Unix() >= claims.Expires {
+		return nil, ErrTokenExpired
+	}
+	return &claims, nil
+}
+
+// Wait returns how long is left before the token's retry delay passes.
+func (s *RetrySigner) Wait(claims *RetryClaims) time.Duration {
+	return time.Unix(claims.NotBefore, 0).Sub(s.now())
+}
+
+func (s *RetrySigner) sign(data string) []byte {
+	mac := hmac.New(sha256.New, s.key)
+	mac.Write([]byte(data))
+	return mac.Sum(nil)
+}
+
+// AddressHash returns the hex SHA-256 of the address's AddressKey, for
+// keying stored results without keeping the address itself.
+func AddressHash(email string) string {
+	sum := sha256.Sum256([]byte(AddressKey(email)))
+	return hex.EncodeToString(sum[:])
+}
+
+// retryDelay reports whether err is a transient failure (greylisting, a
+// timeout, a deferred probe or an open circuit) and how long the caller
+// should wait before trying again.
+func retryDelay(err error) (time.Duration, bool) {
+	var deferral *probeDeferral
+	if errors.As(err, &deferral) {
+		return deferral.wait, true
+	}
+	var open *circuitOpen
+	if errors.As(err, &open) {
+		return open.wait, true
+	}
+	var lookupErr *emailverifier.LookupError
+	if errors.As(err, &lookupErr) {
+		switch lookupErr.Message {
+		case emailverifier.ErrTryAgainLater,
+			emailverifier.ErrMailboxBusy,
+			emailverifier.ErrExceededMessagingLimits:
+			return greylistRetryDelay, true
+		case emailverifier.ErrTimeout:
+			return timeoutRetryDelay, true
+		}
+		if details := parseSMTPReply(lookupErr.Details); details != nil && details.Temporary {
+			return greylistRetryDelay, true
+		}
+		return 0, false
+	}
+
+	var netErr net.Error
+	if errors.As(err, &netErr) && netErr.Timeout() {
+		return timeoutRetryDelay, true
+	}
+	return 0, false
+}
+
+// isDeferral reports whether err put the answer off rather than failing:
+// a 4xx reply, as greylisting servers send, or a probe the etiquette held
+// back.
+func isDeferral(err error) bool {
+	var deferral *probeDeferral
+	if errors.As(err, &deferral) {
+		return true
+	}
+	details := smtpDetailsFor(err)
+	return details != nil && details.Temporary
+}
+
+// markRetryable attaches a retry token to result when err is transient,
+// and marks it deferred when err is a deferral.
+func (s *Service) markRetryable(result *Result, err error) {
+	delay, ok := retryDelay(err)
+	if !ok {
+		return
+	}
+	result.RetryToken = s.retryTokens.Issue(result.Email, delay)
+	result.RetryAfter = int(delay.Seconds())
+	result.Deferred = isDeferral(err)
+}
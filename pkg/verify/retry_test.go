@@ -0,0 +1,100 @@
+package verify
+
+import (
+	"context"
+	"errors"
+	"net"
+	"testing"
+	"time"
+
+	emailverifier "github.com/AfterShip/email-verifier"
+
+	"email-verifier/pkg/verify/verifytest"
+)
+
+// TestRetryTokenRoundTrip tests issuing and parsing retry tokens
+func TestRetryTokenRoundTrip(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+	signer := NewRetrySigner([]byte("secret"), time.Hour)
+	signer.now = func() time.Time { return now }
+
+	token := signer.Issue("User@Example.com", 5*time.Minute)
+
+	claims, err := signer.Parse(token)
+	if err != nil {
+		t.Fatalf("Failed to parse token: %v", err)
+	}
+	if claims.AddressHash != AddressHash("user@example.com") {
+		t.Errorf("Expected address hash of normalized email, got %s", claims.AddressHash)
+	}
+	if claims.NotBefore != now.Add(5*time.Minute).Unix() {
+		t.Errorf("Expected not-before %d, got %d", now.Add(5*time.Minute).Unix(), claims.NotBefore)
+	}
+
+	other := NewRetrySigner([]byte("other"), time.Hour)
+	if _, err := other.Parse(token); !errors.Is(err, ErrTokenSignature) {
+		t.Errorf("Expected signature error for foreign key, got %v", err)
+	}
+
+	signer.now = func() time.Time { return now.Add(2 * time.Hour) }
+	if _, err := signer.Parse(token); !errors.Is(err, ErrTokenExpired) {
+		t.Errorf("Expected expiry error, got %v", err)
+	}
+
+	if _, err := signer.Parse("not-a-token"); !errors.Is(err, ErrTokenMalformed) {
+		t.Errorf("Expected malformed error, got %v", err)
+	}
+}
+
+// TestRetryDelay tests which errors are considered transient
+func TestRetryDelay(t *testing.T) {
+	testCases := []struct {
+		name      string
+		err       error
+		retryable bool
+	}{
+		{"greylisted", &emailverifier.LookupError{Message: emailverifier.ErrTryAgainLater}, true},
+		{"mailbox busy", &emailverifier.LookupError{Message: emailverifier.ErrMailboxBusy}, true},
+		{"timeout", &emailverifier.LookupError{Message: emailverifier.ErrTimeout}, true},
+		{"blocked", &emailverifier.LookupError{Message: emailverifier.ErrBlocked}, false},
+		{"other 4xx reply", emailverifier.ParseSMTPError(errors.New("454 4.7.0 TLS not available due to local problem")), true},
+		{"plain error", errors.New("boom"), false},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			if _, ok := retryDelay(tc.err); ok != tc.retryable {
+				t.Errorf("Expected retryable=%v, got %v", tc.retryable, ok)
+			}
+		})
+	}
+}
+
+// TestDeferred tests that 4xx replies mark the result deferred with a retry delay, and other failures don't
+func TestDeferred(t *testing.T) {
+	fake := verifytest.NewResolver()
+	fake.MX["acme.io"] = []*net.MX{{Host: "mx.acme.io.", Pref: 10}}
+	testCases := []struct {
+		name       string
+		err        error
+		deferred   bool
+		retryAfter int
+	}{
+		{"greylisted", emailverifier.ParseSMTPError(errors.New("451 4.7.1 Greylisted, try again later")), true, 300},
+		{"other 4xx", emailverifier.ParseSMTPError(errors.New("454 4.7.0 TLS not available due to local problem")), true, 300},
+		{"timeout", &emailverifier.LookupError{Message: emailverifier.ErrTimeout}, false, 60},
+		{"policy", emailverifier.ParseSMTPError(errors.New("550 5.7.1 Blocked by policy")), false, 0},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			s := newTestService(Config{Resolver: fake, Prober: func(ctx context.Context, profile, domain, username string, catchAll bool) (*emailverifier.SMTP, error) {
+				return &emailverifier.SMTP{HostExists: true}, tc.err
+			}})
+			result := s.Verify("jane@acme.io", Options{Checks: MustParseChecks(CheckSMTP)})
+			if result.Deferred != tc.deferred || result.RetryAfter != tc.retryAfter {
+				t.Errorf("Expected deferred=%v after %d, got %v after %d", tc.deferred, tc.retryAfter, result.Deferred, result.RetryAfter)
+			}
+		})
+	}
+}
@@ -0,0 +1,129 @@
+package verify
+
+import (
+	"encoding/json"
+	"fmt"
+	"maps"
+	"os"
+	"slices"
+	"strings"
+)
+
+// RiskNoMX is the risk flag for a domain found to have no MX records.
+// The other risk flags are the policy Signals.
+const RiskNoMX = "no_mx"
+
+// RiskFlags lists the risk flags in the order Result.RiskFlags reports
+// them.
+var RiskFlags = append(slices.Clone(Signals), RiskNoMX)
+
+// ScoreWeights tune Result.Score. A score starts from the base for what
+// the mail server said about the mailbox and loses the penalty of each
+// risk flag raised, ending up between 0 and 100. Invalid addresses score
+// 0.
+type ScoreWeights struct {
+	Deliverable   int `json:"deliverable"`   // the server accepted the mailbox
+	CatchAll      int `json:"catch_all"`     // the server accepts every mailbox
+	Unknown       int `json:"unknown"`       // not probed, or no clear answer
+	Undeliverable int `json:"undeliverable"` // rejected, suppressed or no such domain
+	// Penalties are by risk flag; flags left out cost nothing.
+	Penalties map[string]int `json:"penalties"`
+}
+
+// DefaultScoreWeights are the weights without a score config.
+var DefaultScoreWeights = ScoreWeights{
+	Deliverable:   100,
+	CatchAll:      60,
+	Unknown:       50,
+	Undeliverable: 0,
+	Penalties: map[string]int{
+		SignalDisposable:  50,
+		SignalRoleAccount: 15,
+		SignalFree:        5,
+		SignalLookalike:   20,
+		SignalRecentlyReg: 10,
+		SignalRandomLocal: 10,
+		RiskNoMX:          50,
+	},
+}
+
+// Validate reports weights outside 0 to 100 and penalties for unknown
+// flags.
+func (w ScoreWeights) Validate() error {
+	for name, weight := range map[string]int{"deliverable": w.Deliverable, "catch_all": w.CatchAll, "unknown": w.Unknown, "undeliverable": w.Undeliverable} {
+		if weight < 0 || weight > 100 {
+			return fmt.Errorf("%s weight %d: want 0 to 100", name, weight)
+		}
+	}
+	for flag, penalty := range w.Penalties {
+		if !slices.Contains(RiskFlags, flag) {
+			return fmt.Errorf("unknown risk flag %q: valid flags are %s", flag, strings.Join(RiskFlags, ", "))
+		}
+		if penalty < 0 || penalty > 100 {
+			return fmt.Errorf("%s penalty %d: want 0 to 100", flag, penalty)
+		}
+	}
+	return nil
+}
+
+// LoadScoreWeights reads a JSON file of score weights over the defaults,
+// e.g. {"catch_all": 40, "penalties": {"free": 0, "role_account": 30}}.
+// Weights the file leaves out keep their default.
+func LoadScoreWeights(path string) (ScoreWeights, error) {
+	weights := DefaultScoreWeights
+	weights.Penalties = maps.Clone(DefaultScoreWeights.Penalties)
+	if path == "" {
+		return weights, nil
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return ScoreWeights{}, err
+	}
+	if err := json.Unmarshal(data, &weights); err != nil {
+		return ScoreWeights{}, fmt.Errorf("parse score config %s: %v", path, err)
+	}
+	if err := weights.Validate(); err != nil {
+		return ScoreWeights{}, fmt.Errorf("score config %s: %v", path, err)
+	}
+	return weights, nil
+}
+
+// riskFlags returns the risk flags result raises, in RiskFlags order.
+func riskFlags(result *Result) []string {
+	flags := []string{}
+	for _, signal := range Signals {
+		if raised(result, signal) {
+			flags = append(flags, signal)
+		}
+	}
+	if slices.Contains(result.ChecksPerformed, CheckMX) && !result.HasMxRecords {
+		flags = append(flags, RiskNoMX)
+	}
+	return flags
+}
+
+// scoreFor scores result from 0 to 100 under w, with the risk flags that
+// cost it points.
+func scoreFor(result *Result, w ScoreWeights) (int, []string) {
+	flags := riskFlags(result)
+	if result.Verdict == VerdictInvalid {
+		return 0, flags
+	}
+	var score int
+	switch {
+	case result.Suppressed, result.Reachable == ReachableNo:
+		score = w.Undeliverable
+	case result.DomainStatus == DomainNXDomain, result.DomainStatus == DomainNonRoutable:
+		score = w.Undeliverable
+	case result.CatchAll:
+		score = w.CatchAll
+	case result.Reachable == ReachableYes:
+		score = w.Deliverable
+	default:
+		score = w.Unknown
+	}
+	for _, flag := range flags {
+		score -= w.Penalties[flag]
+	}
+	return max(0, min(100, score)), flags
+}
@@ -0,0 +1,89 @@
+package verify
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+)
+
+// TestScore tests the score and risk flags of each signal, alone and combined, under the default weights
+func TestScore(t *testing.T) {
+	deliverable := func(edit func(*Result)) *Result {
+		r := &Result{IsValid: true, Reachable: ReachableYes, Verdict: VerdictDeliverable, HasMxRecords: true, ChecksPerformed: []string{CheckSyntax, CheckMX, CheckSMTP}}
+		if edit != nil {
+			edit(r)
+		}
+		return r
+	}
+	testCases := []struct {
+		name   string
+		result *Result
+		score  int
+		flags  []string
+	}{
+		{"deliverable", deliverable(nil), 100, []string{}},
+		{"disposable", deliverable(func(r *Result) { r.Disposable = true }), 50, []string{SignalDisposable}},
+		{"role account", deliverable(func(r *Result) { r.RoleAccount = true }), 85, []string{SignalRoleAccount}},
+		{"free", deliverable(func(r *Result) { r.Free = true }), 95, []string{SignalFree}},
+		{"catch-all", deliverable(func(r *Result) { r.CatchAll, r.Reachable = true, ReachableUnknown }), 60, []string{SignalCatchAll}},
+		{"catch-all accepting", deliverable(func(r *Result) { r.CatchAll = true }), 60, []string{SignalCatchAll}},
+		{"lookalike", deliverable(func(r *Result) { r.Suggestion = "gmail.com" }), 80, []string{SignalLookalike}},
+		{"random local part", deliverable(func(r *Result) { r.Warnings = []string{WarningRandomLocalPart} }), 90, []string{SignalRandomLocal}},
+		{"role and free", deliverable(func(r *Result) { r.RoleAccount, r.Free = true, true }), 80, []string{SignalRoleAccount, SignalFree}},
+		{"catch-all role", deliverable(func(r *Result) { r.CatchAll, r.RoleAccount = true, true }), 45, []string{SignalRoleAccount, SignalCatchAll}},
+		{"disposable role free", deliverable(func(r *Result) { r.Disposable, r.RoleAccount, r.Free = true, true, true }), 30, []string{SignalDisposable, SignalRoleAccount, SignalFree}},
+		{"every flag", deliverable(func(r *Result) {
+			r.Disposable, r.RoleAccount, r.Free, r.CatchAll, r.Suggestion = true, true, true, true, "gmail.com"
+		}), 0, []string{SignalDisposable, SignalRoleAccount, SignalFree, SignalCatchAll, SignalLookalike}},
+		{"not probed", deliverable(func(r *Result) { r.Reachable, r.ChecksPerformed = ReachableUnknown, []string{CheckSyntax, CheckMX} }), 50, []string{}},
+		{"no mx", deliverable(func(r *Result) {
+			r.Reachable, r.HasMxRecords, r.DomainStatus = ReachableUnknown, false, DomainNoMailService
+		}), 0, []string{RiskNoMX}},
+		{"no mx check", deliverable(func(r *Result) {
+			r.Reachable, r.HasMxRecords, r.ChecksPerformed = ReachableUnknown, false, []string{CheckSyntax}
+		}), 50, []string{}},
+		{"nxdomain", deliverable(func(r *Result) { r.Reachable, r.HasMxRecords, r.DomainStatus = ReachableUnknown, false, DomainNXDomain }), 0, []string{RiskNoMX}},
+		{"rejected", deliverable(func(r *Result) { r.Reachable, r.Verdict = ReachableNo, VerdictUndeliverable }), 0, []string{}},
+		{"suppressed", deliverable(func(r *Result) { r.Reachable, r.Suppressed = ReachableUnknown, true }), 0, []string{}},
+		{"invalid", &Result{Verdict: VerdictInvalid, ChecksPerformed: []string{CheckSyntax}}, 0, []string{}},
+		{"blocked disposable", deliverable(func(r *Result) { r.Verdict, r.Disposable = VerdictInvalid, true }), 0, []string{SignalDisposable}},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			score, flags := scoreFor(tc.result, DefaultScoreWeights)
+			if score != tc.score || !slices.Equal(flags, tc.flags) {
+				t.Errorf("Expected %d with %v, got %d with %v", tc.score, tc.flags, score, flags)
+			}
+		})
+	}
+}
+
+// TestScoreWeights tests that a score config overrides the defaults it names and that bad weights are refused
+func TestScoreWeights(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "score.json")
+	os.WriteFile(path, []byte(`{"catch_all": 40, "penalties": {"free": 0, "role_account": 30}}`), 0o600)
+	weights, err := LoadScoreWeights(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if weights.CatchAll != 40 || weights.Deliverable != 100 || weights.Penalties[SignalFree] != 0 || weights.Penalties[SignalDisposable] != 50 {
+		t.Errorf("Expected the file's weights over the defaults, got %+v", weights)
+	}
+	if DefaultScoreWeights.Penalties[SignalFree] != 5 {
+		t.Error("Expected the defaults left alone")
+	}
+
+	s := newTestService(Config{ScoreWeights: &weights})
+	result := s.Verify("admin@gmail.com", Options{Checks: MustParseChecks(CheckFree, CheckRole)})
+	if result.Score != 20 || !slices.Equal(result.RiskFlags, []string{SignalRoleAccount, SignalFree}) {
+		t.Errorf("Expected 20 for a free role account, got %d with %v", result.Score, result.RiskFlags)
+	}
+
+	for _, bad := range []string{`{"deliverable": 101}`, `{"penalties": {"spam": 10}}`, `{"penalties": {"free": -1}}`, `{"unknown": "high"}`} {
+		os.WriteFile(path, []byte(bad), 0o600)
+		if _, err := LoadScoreWeights(path); err == nil {
+			t.Errorf("Expected %s to be refused", bad)
+		}
+	}
+}
@@ -0,0 +1,446 @@
+package verify
+
+import (
+	"context"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	emailverifier "github.com/AfterShip/email-verifier"
+)
+
+// Prober runs the SMTP step of a verification for domain and username using
+// the named profile, running the catch-all probe first when catchAll is set.
+// It should give up once ctx ends.
+type Prober func(ctx context.Context, profile, domain, username string, catchAll bool) (*emailverifier.SMTP, error)
+
+// Config configures a Service. The zero value is usable: it resolves with
+// the system resolver, probes with the default profile and issues retry
+// tokens signed with a random key.
+type Config struct {
+	// Resolver answers DNS lookups; the one DNS describes if nil.
+	Resolver Resolver
+	// DNS sets the DNS servers, timeout and cache. The cache is in front
+	// of Resolver too, when it is set. DNSCacheObserver, if set, is told
+	// whether each lookup was answered from the cache.
+	DNS              DNSConfig
+	DNSCacheObserver DNSCacheObserver
+
+	// Profiles maps API keys (or DefaultProfile) to SMTP settings.
+	Profiles map[string]Profile
+	// DefaultSMTP is the default profile's settings whenever Profiles,
+	// as loaded or reloaded, doesn't define DefaultProfile.
+	DefaultSMTP Profile
+	// SMTPDisabled drops the smtp check from every verification, whatever
+	// the request or key asks for; checks_skipped shows it.
+	SMTPDisabled bool
+	// ProfileDrain is how long probes on a replaced profile generation may
+	// run before it is closed; 30s if zero.
+	ProfileDrain time.Duration
+	// ProfileReloadState is ReloadStateReset (the default) or
+	// ReloadStateMigrate.
+	ProfileReloadState string
+
+	// NoMailServiceVerdict is the verdict for domains that exist but have
+	// no mail service: VerdictRisky (the default) or VerdictUndeliverable.
+	NoMailServiceVerdict string
+
+	// Policies sets how soft signals such as disposable or role addresses
+	// affect the verdict; DefaultVerdictPolicy covers what they leave out.
+	Policies PolicyConfig
+
+	// RandomnessThreshold is the local part randomness score above which
+	// results carry WarningRandomLocalPart; DefaultRandomnessThreshold if
+	// zero.
+	RandomnessThreshold float64
+
+	// LegacyAddresses is LegacyExtract (the default), which verifies the
+	// final mailbox of source routes and percent-hack addresses, or
+	// LegacyReject.
+	LegacyAddresses string
+
+	// ScoreWeights tune Result.Score; nil uses DefaultScoreWeights.
+	ScoreWeights *ScoreWeights
+
+	// ProviderRules says how providers fold addresses into one inbox for
+	// NormalizeEmail, by domain; nil uses DefaultProviderRules.
+	ProviderRules map[string]ProviderRule
+
+	// SkipSMTPDomains are domains, or wildcards such as *.example.com,
+	// whose addresses are never probed: reachable follows from the MX
+	// lookup alone, and the result carries SMTPSkippedAllowlisted.
+	SkipSMTPDomains []string
+	// BlockedDomains are domains, or wildcards, whose addresses are
+	// invalid with ErrCodeDomainBlocked, without any lookup.
+	BlockedDomains []string
+
+	// Lists overlays the library's disposable, free and role lists; an
+	// empty overlay that saves nothing if nil.
+	Lists *CustomLists
+
+	// KeyChecks overrides the default checks per API key.
+	KeyChecks map[string]CheckSet
+	// Tenants groups API keys under their own policy lists; keys no tenant
+	// lists belong to DefaultTenant.
+	Tenants map[string]Tenant
+
+	// RetryTokens signs the retry tokens attached to transient failures; a
+	// signer with a random key and a one hour window if nil.
+	RetryTokens *RetrySigner
+
+	// ProbeIPLiterals lets the SMTP check run for address literals such as
+	// user@[192.0.2.1]; they are only classified by default. The library's
+	// prober looks up MX records, so this needs a Prober that dials the
+	// literal itself.
+	ProbeIPLiterals bool
+
+	// Costs prices each verification's checks for Result.CostUnits.
+	Costs CostModel
+
+	// DomainCacheTTL is how long the MX classification and catch-all
+	// status of a domain are reused by later verifications; they are
+	// looked up every time if zero.
+	DomainCacheTTL time.Duration
+	// CatchAllCacheTTL, if set, is how long a domain's catch-all status is
+	// reused instead of DomainCacheTTL, and caches it even when
+	// DomainCacheTTL is zero.
+	CatchAllCacheTTL time.Duration
+	// CatchAllDisabled skips the catch-all probe: every address is probed
+	// on its own and no result is marked catch_all.
+	CatchAllDisabled bool
+	// CatchAllProbes is how many random mailboxes the catch-all probe
+	// asks about, DefaultCatchAllProbes if zero.
+	CatchAllProbes int
+
+	// TLSCheck negotiates STARTTLS during SMTP probes to report
+	// Result.Transport, at the cost of a longer conversation.
+	TLSCheck bool
+	// MXFallbackDisabled treats a domain without MX records as having no
+	// mail service, instead of probing its own address as RFC 5321's
+	// implicit MX.
+	MXFallbackDisabled bool
+
+	// VerifyTimeout bounds each verification on top of Options.Context;
+	// one that runs out answers with what it has, as for a caller's
+	// deadline. Zero leaves verifications unbounded.
+	VerifyTimeout time.Duration
+
+	// Polite is the probing etiquette every SMTP probe goes through; on
+	// with its defaults unless Polite.Off is set.
+	Polite PoliteConfig
+
+	// Circuit is the per-domain circuit breaker in front of SMTP probes;
+	// on with its defaults unless Circuit.Off is set.
+	Circuit CircuitConfig
+
+	// SMTPRetry retries SMTP probes that failed for a passing reason; off
+	// unless SMTPRetry.Attempts is more than 1. RetryObserver, if set, is
+	// told the reason for every retry.
+	SMTPRetry     SMTPRetryConfig
+	RetryObserver RetryObserver
+
+	// SMTPMaxMXHosts caps how many of a domain's mail servers a probe
+	// tries in preference order, DefaultMaxMXHosts if zero. SMTPMXHeadStart,
+	// if set, dials the second server once the first has had that long and
+	// keeps whichever connects first.
+	SMTPMaxMXHosts  int
+	SMTPMXHeadStart time.Duration
+	// SMTPIPPreference is the address family of a mail server dialed
+	// first, falling back to the other; IPPreferenceAuto if empty.
+	SMTPIPPreference string
+
+	// MailProviders are the signatures Result.MailProvider is detected
+	// with, DefaultMailProviders if nil; see LoadMailProviders.
+	MailProviders map[string]MailProviderSignature
+
+	// NetworkDisabled starts the Service with the network kill-switch
+	// engaged; see SetNetworkDisabled.
+	NetworkDisabled bool
+
+	// DebugErrors logs the underlying error behind every error code, with
+	// addresses redacted.
+	DebugErrors bool
+
+	// AuthRecords adds CheckAuthRecords to the checks keys without their
+	// own run by default. It looks up the SPF and DMARC records of each
+	// domain for Result.DNS, which costs two more DNS queries per domain.
+	AuthRecords bool
+	// MTASTS adds CheckMTASTS, which also looks up each domain's MTA-STS
+	// policy and TLS-RPT record for Result.DNS and brings CheckAuthRecords
+	// with it. It costs two more DNS queries per domain, and an HTTPS
+	// fetch for a domain that publishes a policy.
+	MTASTS bool
+	// MTASTSClient replaces the client MTA-STS policies are fetched with,
+	// e.g. in tests.
+	MTASTSClient *http.Client
+	// BIMI adds CheckBIMI, which also looks up each domain's BIMI record,
+	// and DKIMProbe CheckDKIM, which looks up which of DefaultDKIMSelectors
+	// it publishes DKIM keys under, for Result.DNS; either brings
+	// CheckAuthRecords with it. BIMI costs one more DNS query per domain
+	// and DKIMProbe one per selector, made at once.
+	BIMI      bool
+	DKIMProbe bool
+
+	// Gravatar adds CheckGravatar, which looks up each recipient's
+	// Gravatar for Result.Gravatar, to the default checks.
+	Gravatar bool
+	// GravatarLookup replaces the Gravatar lookup, e.g. in tests.
+	GravatarLookup GravatarLookup
+
+	// Prober replaces the SMTP step, e.g. to avoid the network in tests.
+	Prober Prober
+	// ProbeObserver, if set, is told how long every SMTP probe took and
+	// how it ended, e.g. to export probe latency. It is called from the
+	// probing goroutine, so it must be safe for concurrent use.
+	ProbeObserver ProbeObserver
+	// BuildVerifier and BuildProfile replace how the list verifier and the
+	// per-profile SMTP clients are created.
+	BuildVerifier func() (*emailverifier.Verifier, error)
+	BuildProfile  func(Profile) *SMTPClient
+}
+
+// Service verifies addresses. It is safe for concurrent use.
+type Service struct {
+	resolver      Resolver
+	dnsCache      *dnsCache
+	domains       *domainCache
+	polite        *etiquette
+	circuits      *circuits
+	smtpRetry     SMTPRetryConfig
+	retryObserver RetryObserver
+	verifiers     *verifierHolder
+	profiles      *ProfileRegistry
+	// proberFor returns the prober for one probe; the default one fills
+	// in report
+	proberFor           func(report *probeReport) Prober
+	retryTokens         *RetrySigner
+	noMailVerdict       string
+	policies            PolicyConfig
+	randomnessThreshold float64
+	legacyAddresses     string
+	keyChecks           map[string]CheckSet
+	defaultChecks       CheckSet
+	tenants             map[string]*tenantPolicy
+	keyTenants          map[string]*tenantPolicy
+	suppressions        *SuppressionStore
+	lists               *CustomLists
+	skipSMTPDomains     *domainSet
+	providerRules       map[string]ProviderRule
+	scoreWeights        ScoreWeights
+	blockedDomains      *domainSet
+	debugErrors         bool
+	probeIPLiterals     bool
+	mtaSTSClient        *http.Client
+	gravatarLookup      GravatarLookup
+	verifyTimeout       time.Duration
+	smtpDisabled        bool
+	catchAllDisabled    bool
+	mxFallbackDisabled  bool
+	mailProviders       *mailProviders
+	costs               CostModel
+	inFlight            atomic.Int64
+
+	networkMu       sync.Mutex
+	networkDisabled atomic.Bool
+	outboundBlocked atomic.Bool
+	autoUpdate      bool // the list verifier is the built-in one
+}
+
+// New creates a Service. The list verifier is built on first use, so New
+// itself never fails; Ready reports whether it could be built.
+func New(cfg Config) *Service {
+	s := &Service{
+		resolver:            cfg.Resolver,
+		retryTokens:         cfg.RetryTokens,
+		noMailVerdict:       cfg.NoMailServiceVerdict,
+		policies:            cfg.Policies,
+		randomnessThreshold: cfg.RandomnessThreshold,
+		legacyAddresses:     cfg.LegacyAddresses,
+		keyChecks:           cfg.KeyChecks,
+		defaultChecks:       defaultChecksFor(cfg),
+		debugErrors:         cfg.DebugErrors,
+		probeIPLiterals:     cfg.ProbeIPLiterals,
+		lists:               cfg.Lists,
+		skipSMTPDomains:     newDomainSet(cfg.SkipSMTPDomains),
+		providerRules:       cfg.ProviderRules,
+		blockedDomains:      newDomainSet(cfg.BlockedDomains),
+		mtaSTSClient:        cfg.MTASTSClient,
+		gravatarLookup:      cfg.GravatarLookup,
+		verifyTimeout:       cfg.VerifyTimeout,
+		smtpDisabled:        cfg.SMTPDisabled,
+		catchAllDisabled:    cfg.CatchAllDisabled,
+		mxFallbackDisabled:  cfg.MXFallbackDisabled,
+		mailProviders:       newMailProviders(cfg.MailProviders),
+		costs:               cfg.Costs,
+		suppressions:        NewSuppressionStore(),
+	}
+	if s.resolver == nil {
+		s.resolver = newResolver(cfg.DNS)
+	}
+	if s.dnsCache = newDNSCache(s.resolver, cfg.DNS.CacheMaxTTL, cfg.DNSCacheObserver); s.dnsCache != nil {
+		s.resolver = s.dnsCache
+	}
+	if s.retryTokens == nil {
+		s.retryTokens = NewRetrySigner(nil, time.Hour)
+	}
+	if s.noMailVerdict == "" {
+		s.noMailVerdict = VerdictRisky
+	}
+	if s.randomnessThreshold == 0 {
+		s.randomnessThreshold = DefaultRandomnessThreshold
+	}
+	if s.keyChecks == nil {
+		s.keyChecks = map[string]CheckSet{}
+	}
+	if s.lists == nil {
+		s.lists = NewCustomLists("")
+	}
+	if s.providerRules == nil {
+		s.providerRules = DefaultProviderRules
+	}
+	s.scoreWeights = DefaultScoreWeights
+	if cfg.ScoreWeights != nil {
+		s.scoreWeights = *cfg.ScoreWeights
+	}
+	s.tenants = make(map[string]*tenantPolicy, len(cfg.Tenants))
+	s.keyTenants = make(map[string]*tenantPolicy)
+	for name, tenant := range cfg.Tenants {
+		policy := newTenantPolicy(name, tenant)
+		s.tenants[name] = policy
+		for _, key := range tenant.Keys {
+			s.keyTenants[key] = policy
+		}
+	}
+
+	s.networkDisabled.Store(cfg.NetworkDisabled)
+	s.resolver = guardedResolver{next: s.resolver, disabled: &s.networkDisabled}
+	s.domains = newDomainCache(cfg.DomainCacheTTL, cfg.CatchAllCacheTTL)
+	s.polite = newEtiquette(cfg.Polite, s.resolver)
+	s.circuits = newCircuits(cfg.Circuit)
+	s.smtpRetry, s.retryObserver = cfg.SMTPRetry, cfg.RetryObserver
+	if s.smtpRetry.Backoff <= 0 {
+		s.smtpRetry.Backoff = DefaultSMTPRetryBackoff
+	}
+	if s.smtpRetry.MaxBackoff <= 0 {
+		s.smtpRetry.MaxBackoff = DefaultSMTPRetryMaxBackoff
+	}
+
+	build := cfg.BuildVerifier
+	if build == nil {
+		build, s.autoUpdate = s.buildListVerifier, true
+	}
+	s.verifiers = newVerifierHolder(build)
+
+	drain := cfg.ProfileDrain
+	if drain == 0 {
+		drain = 30 * time.Second
+	}
+	policy := cfg.ProfileReloadState
+	if policy == "" {
+		policy = ReloadStateReset
+	}
+	buildProfile := cfg.BuildProfile
+	if buildProfile == nil {
+		buildProfile = func(p Profile) *SMTPClient {
+			c := NewSMTPClient(p)
+			if t := cfg.VerifyTimeout; t > 0 {
+				c.MXBudget = min(c.MXBudget, t)
+			}
+			if cfg.SMTPMaxMXHosts > 0 {
+				c.MaxMXHosts = cfg.SMTPMaxMXHosts
+			}
+			if cfg.CatchAllProbes > 0 {
+				c.CatchAllProbes = cfg.CatchAllProbes
+			}
+			c.TLSCheck = cfg.TLSCheck
+			c.MXHeadStart = cfg.SMTPMXHeadStart
+			c.IPPreference = cfg.SMTPIPPreference
+			return c
+		}
+	}
+	s.profiles = newProfileRegistry(cfg.Profiles, cfg.DefaultSMTP, drain, policy, buildProfile)
+
+	s.proberFor = func(report *probeReport) Prober {
+		prober := cfg.Prober
+		if prober == nil {
+			prober = func(ctx context.Context, profile, domain, username string, catchAll bool) (*emailverifier.SMTP, error) {
+				return s.probeSMTP(ctx, profile, domain, username, catchAll, report)
+			}
+		}
+		if cfg.ProbeObserver != nil {
+			prober = observeProber(prober, cfg.ProbeObserver)
+		}
+		return guardProber(prober, &s.networkDisabled)
+	}
+	return s
+}
+
+// Ready returns the error that stopped the list verifier from building, or
+// nil once it is available.
+func (s *Service) Ready() error {
+	_, err := s.verifiers.Get()
+	return err
+}
+
+// Reload builds a fresh list verifier and swaps it in without disturbing
+// verifications in flight. A failed reload keeps the current one.
+func (s *Service) Reload() error { return s.verifiers.Reload() }
+
+// ListsLoadedAt returns when the list verifier's disposable and free
+// provider lists were last loaded, by the initial build or a Reload, or
+// false if they haven't been. The library's own daily disposable list
+// refresh doesn't report whether it succeeded, so it doesn't count.
+func (s *Service) ListsLoadedAt() (time.Time, bool) { return s.verifiers.LoadedAt() }
+
+// RetryInit keeps rebuilding a list verifier that failed to initialize,
+// backing off from min to max, until one builds or ctx is cancelled.
+func (s *Service) RetryInit(ctx context.Context, min, max time.Duration) {
+	s.verifiers.Retry(ctx, min, max)
+}
+
+// Lists returns the overlay on the disposable, free and role lists.
+func (s *Service) Lists() *CustomLists { return s.lists }
+
+// Profiles returns the SMTP profile registry.
+func (s *Service) Profiles() *ProfileRegistry { return s.profiles }
+
+// RetryTokens returns the signer used for retry tokens.
+func (s *Service) RetryTokens() *RetrySigner { return s.retryTokens }
+
+// Resolver returns the resolver used for DNS lookups.
+func (s *Service) Resolver() Resolver { return s.resolver }
+
+// InFlight returns the number of verifications currently running.
+func (s *Service) InFlight() int64 { return s.inFlight.Load() }
+
+// ChecksFor returns the default checks for an API key: its own, else its
+// tenant's, else DefaultChecks with the optional checks Config turns on.
+func (s *Service) ChecksFor(key string) CheckSet {
+	if set, ok := s.keyChecks[key]; ok {
+		return set
+	}
+	if policy := s.keyTenants[key]; policy != nil && policy.checks != nil {
+		return policy.checks
+	}
+	return s.defaultChecks
+}
+
+// allowedChecks returns checks without those the service is configured
+// never to run.
+func (s *Service) allowedChecks(checks CheckSet) CheckSet {
+	if s.smtpDisabled && checks.Has(CheckSMTP) {
+		return checks.Without(CheckSMTP)
+	}
+	return checks
+}
+
+// Suggest returns a likely correction for a mistyped domain, or "" if the
+// domain looks fine.
+func (s *Service) Suggest(domain string) (string, error) {
+	verifier, err := s.verifiers.Get()
+	if err != nil {
+		return "", err
+	}
+	return verifier.SuggestDomain(domain), nil
+}
@@ -0,0 +1,510 @@
+package verify
+
+import (
+	"bytes"
+	"context"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"net"
+	"net/smtp"
+	"net/textproto"
+	"net/url"
+	"strings"
+	"time"
+	"unicode"
+
+	emailverifier "github.com/AfterShip/email-verifier"
+	"golang.org/x/net/proxy"
+)
+
+// smtpTimeout is the default connect and operation timeout of a probe, the
+// library's.
+const smtpTimeout = 10 * time.Second
+
+// DefaultMaxMXHosts is how many of a domain's mail servers a probe tries
+// before giving up.
+const DefaultMaxMXHosts = 3
+
+// SMTPClient probes mailboxes for one profile. It holds the same
+// conversation as the library's SMTP check, but hands back the server's
+// reply to the RCPT TO of the mailbox instead of dropping it.
+type SMTPClient struct {
+	Proxy            string // SOCKS5 proxy URI, if any
+	HelloName        string
+	FromEmail        string
+	ConnectTimeout   time.Duration
+	OperationTimeout time.Duration
+	// MaxMXHosts caps how many of a domain's mail servers a probe tries,
+	// and MXBudget the time it spends getting through them; see check.
+	// MXHeadStart, if set, races the second server against the first
+	// once the first has had that long to connect.
+	MaxMXHosts  int
+	MXBudget    time.Duration
+	MXHeadStart time.Duration
+	// IPPreference is the address family dialed first, IPPreferenceAuto
+	// if empty.
+	IPPreference string
+	// CatchAllProbes is how many random mailboxes the catch-all probe
+	// asks about; see CatchAllConfidence.
+	CatchAllProbes int
+	// TLSCheck negotiates STARTTLS with the answering server and reports
+	// it in Result.Transport.
+	TLSCheck bool
+
+	port     string         // for tests; 25 if empty
+	tlsRoots *x509.CertPool // for tests; the system's if nil
+}
+
+// NewSMTPClient returns the client a profile probes with.
+func NewSMTPClient(p Profile) *SMTPClient {
+	helloName, fromEmail := p.Identity()
+	return &SMTPClient{
+		Proxy:            p.Proxy,
+		HelloName:        helloName,
+		FromEmail:        fromEmail,
+		ConnectTimeout:   smtpTimeout,
+		OperationTimeout: smtpTimeout,
+		MaxMXHosts:       DefaultMaxMXHosts,
+		MXBudget:         2 * smtpTimeout,
+		CatchAllProbes:   DefaultCatchAllProbes,
+	}
+}
+
+// Check probes username@domain on the domain's mail servers, running the
+// catch-all probe first when catchAll is set. A rejected mailbox is
+// reported as the *emailverifier.LookupError of the reply, alongside the
+// SMTP result, so smtpDetailsFor can read it. Once ctx ends, dials are
+// abandoned and an open session is cut off.
+func (c *SMTPClient) Check(ctx context.Context, resolver Resolver, domain, username string, catchAll bool) (*emailverifier.SMTP, error) {
+	smtp, _, err := c.check(ctx, resolver, domain, username, catchAll)
+	return smtp, err
+}
+
+// probeReport is what a probe learned beyond the library's SMTP result:
+// the mail server it got its answer from, and how sure its catch-all
+// probe was.
+type probeReport struct {
+	host      string
+	family    string // AddressFamilyIPv4 or AddressFamilyIPv6; "" through a proxy
+	banner    string // the text of its 220 greeting
+	catchAll  string // a CatchAllConfidence, if the catch-all probe ran
+	transport *TransportInfo
+	// transcript is every session the probe opened, for Options.Trace
+	transcript []TraceSMTP
+	session    *smtpSession
+}
+
+// check is Check, also returning the server that answered. The hosts are
+// tried in preference order, at most MaxMXHosts of them within MXBudget:
+// one that can't be reached, or that turns the session away with anything
+// but a permanent reply before the mailbox is asked about, hands over to
+// the next. Once a host has accepted MAIL FROM, its answer is final.
+func (c *SMTPClient) check(ctx context.Context, resolver Resolver, domain, username string, catchAll bool) (*emailverifier.SMTP, probeReport, error) {
+	hosts, err := c.mailHosts(ctx, resolver, domain)
+	if err != nil {
+		return &emailverifier.SMTP{}, probeReport{}, err
+	}
+	if c.MaxMXHosts > 0 && len(hosts) > c.MaxMXHosts {
+		hosts = hosts[:c.MaxMXHosts]
+	}
+	deadline := time.Now().Add(c.MXBudget)
+	if c.MXBudget <= 0 {
+		deadline = time.Now().Add(time.Duration(len(hosts)) * (c.ConnectTimeout + c.OperationTimeout))
+	}
+
+	var firstErr error
+	var transcript []TraceSMTP
+	for len(hosts) > 0 && time.Now().Before(deadline) && ctx.Err() == nil {
+		client, peer, tried, err := c.dialOrdered(ctx, resolver, hosts, deadline)
+		if err != nil {
+			if firstErr == nil {
+				firstErr = err
+			}
+			break
+		}
+		hosts = hosts[tried:]
+		client, err = c.open(ctx, resolver, client, &peer)
+		if err == nil || isPermanentReply(err) || len(hosts) == 0 {
+			smtp, confidence, err := c.converse(client, domain, username, catchAll, err)
+			client.Close()
+			peer.catchAll = confidence
+			peer.transcript = append(append(transcript, peer.transcript...), peer.session.recorded()...)
+			peer.session = nil
+			return smtp, peer, err
+		}
+		client.Close()
+		transcript = append(append(transcript, peer.transcript...), peer.session.recorded()...)
+		if firstErr == nil {
+			firstErr = err
+		}
+	}
+	if firstErr == nil {
+		firstErr = errors.New("Timeout connecting to mail-exchanger")
+	}
+	return &emailverifier.SMTP{}, probeReport{transcript: transcript}, parseReply(firstErr)
+}
+
+// open greets the server, negotiating TLS with TLSCheck, and gives it the
+// envelope sender. It returns the session to go on with, which is a new
+// one in the clear if the TLS handshake failed: the check reports on the
+// transport without standing in the way of the probe.
+func (c *SMTPClient) open(ctx context.Context, resolver Resolver, client *smtp.Client, peer *probeReport) (*smtp.Client, error) {
+	if err := client.Hello(c.HelloName); err != nil {
+		return client, err
+	}
+	if c.TLSCheck {
+		var usable bool
+		if peer.transport, usable = c.negotiateTLS(client, peer.host); !usable {
+			client.Close()
+			fresh, session, err := c.dial(ctx, resolver, peer.host, c.ConnectTimeout)
+			if err != nil {
+				return client, err
+			}
+			peer.transcript = append(peer.transcript, peer.session.recorded()...)
+			client, peer.session = fresh, session.session
+			if err := client.Hello(c.HelloName); err != nil {
+				return client, err
+			}
+		} else if peer.transport.TLSVersion != "" {
+			peer.session.attach(client)
+		}
+	}
+	return client, client.Mail(c.FromEmail)
+}
+
+// converse asks about the mailbox on a session open returned err for,
+// returning the catch-all probe's confidence if it ran.
+func (c *SMTPClient) converse(client *smtp.Client, domain, username string, catchAll bool, err error) (*emailverifier.SMTP, string, error) {
+	var ret emailverifier.SMTP
+	if err != nil {
+		return &ret, "", parseReply(err)
+	}
+	ret.HostExists = true
+
+	confidence := ""
+	if catchAll {
+		// The server is taken for catch-all if it accepts any of the
+		// random mailboxes. A deferred one proves nothing, since a server
+		// that defers unknown users would defer a real one too.
+		probes, accepted := max(c.CatchAllProbes, 1), 0
+		for i := 0; i < probes; i++ {
+			err := client.Rcpt(randomLocalPart() + "@" + domain)
+			if err == nil {
+				accepted++
+				continue
+			}
+			if e := parseReply(err); e != nil {
+				switch e.Message {
+				case emailverifier.ErrFullInbox:
+					ret.FullInbox = true
+				case emailverifier.ErrNotAllowed:
+					ret.Disabled = true
+				}
+			}
+		}
+		confidence = catchAllConfidence(accepted, probes)
+		if ret.CatchAll = confidence != CatchAllNo; ret.CatchAll {
+			return &ret, confidence, nil
+		}
+	}
+	if username == "" {
+		return &ret, confidence, nil
+	}
+	if err := client.Rcpt(username + "@" + domain); err != nil {
+		if e := parseReply(err); e != nil {
+			return &ret, confidence, e
+		}
+		return &ret, confidence, nil
+	}
+	ret.Deliverable = true
+	return &ret, confidence, nil
+}
+
+// isPermanentReply reports whether err is a 5xx reply, which another host
+// of the same domain would only repeat.
+func isPermanentReply(err error) bool {
+	var reply *textproto.Error
+	return errors.As(err, &reply) && reply.Code >= 500
+}
+
+// parseReply is emailverifier.ParseSMTPError for a reply written out as the
+// server sent it, since textproto quotes the text.
+func parseReply(err error) *emailverifier.LookupError {
+	var reply *textproto.Error
+	if errors.As(err, &reply) {
+		err = fmt.Errorf("%03d %s", reply.Code, reply.Msg)
+	}
+	return emailverifier.ParseSMTPError(err)
+}
+
+// mailHosts returns the hosts to dial for domain: the MX hosts, lowest
+// preference first, the domain itself if it has none (RFC 5321's implicit
+// MX), or the address of a literal like [192.0.2.1].
+func (c *SMTPClient) mailHosts(ctx context.Context, resolver Resolver, domain string) ([]string, error) {
+	if strings.HasPrefix(domain, "[") && strings.HasSuffix(domain, "]") {
+		return []string{strings.TrimPrefix(strings.ToLower(domain[1:len(domain)-1]), "ipv6:")}, nil
+	}
+	ctx, cancel := context.WithTimeout(ctx, c.ConnectTimeout)
+	defer cancel()
+	mx, err := resolver.LookupMX(ctx, domain)
+	if err != nil && !IsNotFound(err) {
+		return nil, err
+	}
+	if len(mx) == 1 && (mx[0].Host == "." || mx[0].Host == "") {
+		return nil, errors.New("Null MX: the domain accepts no mail")
+	}
+	records := mxRecords(mx)
+	if len(records) == 0 {
+		return []string{domain}, nil
+	}
+	hosts := make([]string, len(records))
+	for i, record := range records {
+		hosts[i] = record.Host
+	}
+	return hosts, nil
+}
+
+// dialOrdered connects to the first of hosts to answer, trying them in
+// order and starting the next as soon as one fails. With MXHeadStart set,
+// the second host is also dialed once the first has had that long, and
+// whichever connects first wins. It returns the server connected to and how
+// many of hosts were tried, or the first host's error if none answer
+// before deadline or ctx ends.
+func (c *SMTPClient) dialOrdered(ctx context.Context, resolver Resolver, hosts []string, deadline time.Time) (*smtp.Client, probeReport, int, error) {
+	type dialed struct {
+		index  int
+		client *smtp.Client
+		peer   probeReport
+		err    error
+	}
+	ch := make(chan dialed, len(hosts))
+	next, pending := 0, 0
+	launch := func() {
+		i, host := next, hosts[next]
+		timeout := min(c.ConnectTimeout, time.Until(deadline))
+		next++
+		pending++
+		go func() {
+			client, peer, err := c.dial(ctx, resolver, host, timeout)
+			ch <- dialed{i, client, peer, err}
+		}()
+	}
+	var headStart <-chan time.Time
+	if c.MXHeadStart > 0 && len(hosts) > 1 {
+		timer := time.NewTimer(c.MXHeadStart)
+		defer timer.Stop()
+		headStart = timer.C
+	}
+
+	launch()
+	errs := make([]error, len(hosts))
+	for pending > 0 {
+		select {
+		case <-headStart:
+			headStart = nil
+			if next == 1 && time.Now().Before(deadline) {
+				launch()
+			}
+		case d := <-ch:
+			pending--
+			if d.err == nil {
+				// A slower host that still connects is hung up on
+				go func(pending int) {
+					for ; pending > 0; pending-- {
+						if late := <-ch; late.client != nil {
+							late.client.Close()
+						}
+					}
+				}(pending)
+				return d.client, d.peer, next, nil
+			}
+			errs[d.index] = d.err
+			if pending == 0 && next < len(hosts) && time.Now().Before(deadline) {
+				launch()
+			}
+		}
+	}
+	for _, err := range errs {
+		if err != nil {
+			return nil, probeReport{}, next, err
+		}
+	}
+	return nil, probeReport{}, next, errors.New("Unexpected response dialing SMTP server")
+}
+
+// dial opens an SMTP session with host within timeout, through the proxy
+// if one is set, and returns the server as reached. The session's
+// connection times out as soon as ctx ends.
+func (c *SMTPClient) dial(ctx context.Context, resolver Resolver, host string, timeout time.Duration) (*smtp.Client, probeReport, error) {
+	port := c.port
+	if port == "" {
+		port = "25"
+	}
+	var conn net.Conn
+	var family string
+	var err error
+	if c.Proxy != "" {
+		// The proxy resolves the host and picks the address
+		conn, err = c.dialProxy(ctx, net.JoinHostPort(host, port), timeout)
+	} else {
+		conn, family, err = c.dialAddrs(ctx, resolver, host, port, timeout)
+	}
+	if err != nil {
+		return nil, probeReport{}, err
+	}
+	if err := conn.SetDeadline(time.Now().Add(c.OperationTimeout)); err != nil {
+		conn.Close()
+		return nil, probeReport{}, err
+	}
+	raw := conn
+	conn = &contextConn{Conn: raw, stop: context.AfterFunc(ctx, func() { raw.SetDeadline(time.Unix(1, 0)) })}
+	greeting := &greetingConn{Conn: conn}
+	client, err := smtp.NewClient(greeting, host)
+	if err != nil {
+		conn.Close()
+		return nil, probeReport{}, err
+	}
+	greeting.done = true
+	session := &smtpSession{host: host}
+	session.record(smtpServer, greeting.buf)
+	session.attach(client)
+	return client, probeReport{host: host, family: family, banner: parseBanner(greeting.buf), session: session}, nil
+}
+
+// Who sent a line of an SMTP session, in TraceSMTP.From.
+const (
+	smtpClient = "client"
+	smtpServer = "server"
+)
+
+// maxSessionLines caps how many lines of one session are kept.
+const maxSessionLines = 100
+
+// smtpSession records the commands and replies of one SMTP session.
+type smtpSession struct {
+	host    string
+	lines   []TraceSMTP
+	partial map[string][]byte // the unfinished line from each side
+}
+
+// attach records client's session from here on. It has to be repeated
+// once STARTTLS replaces the connection underneath.
+func (s *smtpSession) attach(client *smtp.Client) {
+	client.Text = textproto.NewConn(sessionConn{text: client.Text, session: s})
+}
+
+// record adds the complete lines of p, sent by from, keeping what is left
+// over for the next call. Each line is capped at maxBanner bytes.
+func (s *smtpSession) record(from string, p []byte) {
+	if s.partial == nil {
+		s.partial = make(map[string][]byte)
+	}
+	buf := append(s.partial[from], p...)
+	for {
+		i := bytes.IndexByte(buf, '\n')
+		if i < 0 {
+			break
+		}
+		line := strings.TrimSuffix(string(buf[:i]), "\r")
+		buf = buf[i+1:]
+		if len(s.lines) < maxSessionLines {
+			s.lines = append(s.lines, TraceSMTP{Host: s.host, From: from, Line: strings.ToValidUTF8(line[:min(len(line), maxBanner)], "")})
+		}
+	}
+	s.partial[from] = buf[:min(len(buf), maxBanner):min(len(buf), maxBanner)]
+}
+
+// recorded returns the lines recorded so far; none for a nil session.
+func (s *smtpSession) recorded() []TraceSMTP {
+	if s == nil {
+		return nil
+	}
+	return s.lines
+}
+
+// sessionConn passes a session through the smtp.Client's own reader and
+// writer, recording it as it goes.
+type sessionConn struct {
+	text    *textproto.Conn
+	session *smtpSession
+}
+
+func (c sessionConn) Read(p []byte) (int, error) {
+	n, err := c.text.R.Read(p)
+	c.session.record(smtpServer, p[:n])
+	return n, err
+}
+
+func (c sessionConn) Write(p []byte) (int, error) {
+	n, err := c.text.W.Write(p)
+	if err == nil {
+		err = c.text.W.Flush()
+	}
+	c.session.record(smtpClient, p[:n])
+	return n, err
+}
+
+func (c sessionConn) Close() error { return c.text.Close() }
+
+// contextConn is a connection that times out once its context ends; stop
+// unregisters that when the connection is closed.
+type contextConn struct {
+	net.Conn
+	stop func() bool
+}
+
+func (c *contextConn) Close() error {
+	c.stop()
+	return c.Conn.Close()
+}
+
+// greetingConn keeps what is read from the server until done is set,
+// which is only its greeting: nothing more is sent before EHLO.
+type greetingConn struct {
+	net.Conn
+	buf  []byte
+	done bool
+}
+
+// maxBanner caps how much of a greeting is kept.
+const maxBanner = 512
+
+func (c *greetingConn) Read(p []byte) (int, error) {
+	n, err := c.Conn.Read(p)
+	if !c.done && len(c.buf) < maxBanner {
+		c.buf = append(c.buf, p[:min(n, maxBanner-len(c.buf))]...)
+	}
+	return n, err
+}
+
+// parseBanner returns the text of the first line of a 220 greeting,
+// without control characters.
+func parseBanner(greeting []byte) string {
+	line, _, _ := strings.Cut(string(greeting), "\n")
+	line = strings.TrimSuffix(line, "\r")
+	if len(line) >= 4 && strings.HasPrefix(line, "220") && (line[3] == ' ' || line[3] == '-') {
+		line = line[4:]
+	}
+	line = strings.Map(func(r rune) rune {
+		if unicode.IsControl(r) {
+			return -1
+		}
+		return r
+	}, strings.ToValidUTF8(line, ""))
+	return strings.TrimSpace(line)
+}
+
+func (c *SMTPClient) dialProxy(ctx context.Context, addr string, timeout time.Duration) (net.Conn, error) {
+	u, err := url.Parse(c.Proxy)
+	if err != nil {
+		return nil, err
+	}
+	dialer, err := proxy.FromURL(u, nil)
+	if err != nil {
+		return nil, err
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	return dialer.(proxy.ContextDialer).DialContext(ctx, "tcp", addr)
+}
@@ -0,0 +1,314 @@
+package verify
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"io"
+	"net"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	emailverifier "github.com/AfterShip/email-verifier"
+
+	"email-verifier/pkg/verify/verifytest"
+)
+
+// serveSMTP answers SMTP sessions on a local port until the test ends:
+// RCPT TO gets the reply in rcpt for the mailbox, 250 for jane and john,
+// and 550 user unknown for anyone else. It returns the port.
+func serveSMTP(t *testing.T, rcpt map[string]string) string {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { listener.Close() })
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				r := bufio.NewReader(conn)
+				conn.Write([]byte("220 mx.test ESMTP\r\n"))
+				for {
+					line, err := r.ReadString('\n')
+					if err != nil {
+						return
+					}
+					line = strings.TrimSpace(line)
+					switch verb := strings.ToUpper(strings.Fields(line + " ")[0]); verb {
+					case "EHLO", "HELO", "MAIL", "RSET", "NOOP":
+						conn.Write([]byte("250 OK\r\n"))
+					case "RCPT":
+						mailbox := strings.Trim(strings.TrimPrefix(line[len("RCPT"):], " TO:"), "<>")
+						reply, ok := rcpt[mailbox]
+						if !ok {
+							reply = "550 5.1.1 <" + mailbox + ">: Recipient address rejected: User unknown"
+							if strings.HasPrefix(mailbox, "jane@") || strings.HasPrefix(mailbox, "john@") {
+								reply = "250 2.1.5 OK"
+							}
+						}
+						conn.Write([]byte(reply + "\r\n"))
+					case "QUIT":
+						conn.Write([]byte("221 Bye\r\n"))
+						return
+					default:
+						conn.Write([]byte("502 Unknown command\r\n"))
+					}
+				}
+			}()
+		}
+	}()
+	_, port, _ := net.SplitHostPort(listener.Addr().String())
+	return port
+}
+
+// TestSMTPClientReply tests that the reply to the mailbox's RCPT TO comes back with its codes and text
+func TestSMTPClientReply(t *testing.T) {
+	fake := verifytest.NewResolver()
+	fake.MX["acme.io"] = []*net.MX{{Host: "127.0.0.1", Pref: 10}}
+	client := NewSMTPClient(Profile{})
+	client.port = serveSMTP(t, map[string]string{
+		"blocked@acme.io": "550 5.7.1 Service unavailable; client host [192.0.2.1] blocked by policy",
+		"later@acme.io":   "450-4.2.0 <later@acme.io>: Recipient address rejected:\r\n450 4.2.0 Greylisted, try again in 5 minutes",
+	})
+
+	smtp, err := client.Check(context.Background(), fake, "acme.io", "jane", true)
+	if err != nil || !smtp.Deliverable || smtp.CatchAll {
+		t.Errorf("Expected jane deliverable on a server that isn't catch-all, got %+v and %v", smtp, err)
+	}
+
+	testCases := []struct {
+		username  string
+		reply     SMTPDetails
+		errorCode string
+	}{
+		{"nobody", SMTPDetails{Code: 550, EnhancedCode: "5.1.1", Reason: SMTPReasonUserUnknown, Message: "<[redacted]>: Recipient address rejected: User unknown"}, ErrCodeSMTPUnavailable},
+		{"blocked", SMTPDetails{Code: 550, EnhancedCode: "5.7.1", Reason: SMTPReasonPolicyRejection, Message: "Service unavailable; client host [192.0.2.1] blocked by policy"}, ErrCodeSMTPBlocked},
+		{"later", SMTPDetails{Code: 450, EnhancedCode: "4.2.0", Reason: SMTPReasonTryLater, Message: "<[redacted]>: Recipient address rejected: Greylisted, try again in 5 minutes", Temporary: true}, ErrCodeSMTPTryAgain},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.username, func(t *testing.T) {
+			smtp, err := client.Check(context.Background(), fake, "acme.io", tc.username, false)
+			var lookupErr *emailverifier.LookupError
+			if !errors.As(err, &lookupErr) || !smtp.HostExists || smtp.Deliverable {
+				t.Fatalf("Expected a rejection from a live host, got %+v and %v", smtp, err)
+			}
+			if details := smtpDetailsFor(err); details == nil || *details != tc.reply {
+				t.Errorf("Expected %+v, got %+v", tc.reply, details)
+			}
+			if code := ErrorCodeFor(err); code != tc.errorCode {
+				t.Errorf("Expected %s, got %s", tc.errorCode, code)
+			}
+		})
+	}
+}
+
+// TestSMTPDetailsMessage tests that a rejected mailbox reports the server's reply with the address redacted
+func TestSMTPDetailsMessage(t *testing.T) {
+	fake := verifytest.NewResolver()
+	fake.MX["acme.io"] = []*net.MX{{Host: "127.0.0.1", Pref: 10}}
+	port := serveSMTP(t, map[string]string{"blocked@acme.io": "550 5.7.1 Rejected by policy"})
+	s := newTestService(Config{Resolver: fake, BuildProfile: func(p Profile) *SMTPClient {
+		client := NewSMTPClient(p)
+		client.port = port
+		return client
+	}})
+
+	result := s.Verify("nobody@acme.io", Options{Checks: MustParseChecks(CheckSMTP)})
+	if result.Reachable != ReachableNo || result.ReachableReason != ReachableReasonMailboxNotFound || result.SMTPDetails == nil {
+		t.Fatalf("Expected the mailbox rejected, got %+v", result)
+	}
+	if msg := result.SMTPDetails.Message; msg != "<[redacted]>: Recipient address rejected: User unknown" || result.SMTPDetails.Temporary {
+		t.Errorf("Expected the redacted permanent reply, got %q", msg)
+	}
+
+	// A policy rejection is an error, not an answer about the mailbox
+	result = s.Verify("blocked@acme.io", Options{Checks: MustParseChecks(CheckSMTP)})
+	if result.Reachable != ReachableUnknown || result.ErrorCode != ErrCodeSMTPBlocked || result.SMTPDetails == nil || result.SMTPDetails.Message != "Rejected by policy" {
+		t.Errorf("Expected smtp_blocked with the reply, got %+v", result)
+	}
+}
+
+// TestSMTPClientImplicitMX tests that a domain without MX records is dialed at its own address, and a null MX is not dialed at all
+func TestSMTPClientImplicitMX(t *testing.T) {
+	fake := verifytest.NewResolver()
+	fake.MX["nullmx.mock"] = []*net.MX{{Host: ".", Pref: 0}}
+	client := NewSMTPClient(Profile{})
+	client.port = serveSMTP(t, nil)
+
+	if smtp, err := client.Check(context.Background(), fake, "127.0.0.1", "jane", false); err != nil || !smtp.Deliverable {
+		t.Errorf("Expected jane deliverable at the implicit MX, got %+v and %v", smtp, err)
+	}
+	if smtp, err := client.Check(context.Background(), fake, "nullmx.mock", "jane", false); err == nil || (smtp != nil && smtp.HostExists) {
+		t.Errorf("Expected a null MX to fail without a connection, got %+v and %v", smtp, err)
+	}
+}
+
+// serveMX answers SMTP sessions at addr until the test ends with greeting,
+// or never greets if it is empty, and 250 to EHLO and mail to MAIL FROM.
+// It returns the number of connections taken.
+func serveMX(t *testing.T, addr, greeting, mail string) *atomic.Int64 {
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		t.Skipf("Can't listen on %s: %v", addr, err)
+	}
+	t.Cleanup(func() { listener.Close() })
+	var conns atomic.Int64
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			conns.Add(1)
+			go func() {
+				defer conn.Close()
+				if greeting == "" {
+					io.Copy(io.Discard, conn)
+					return
+				}
+				conn.Write([]byte(greeting + "\r\n"))
+				r := bufio.NewReader(conn)
+				for {
+					line, err := r.ReadString('\n')
+					if err != nil {
+						return
+					}
+					reply := "250 OK"
+					if strings.HasPrefix(strings.ToUpper(line), "MAIL") {
+						reply = mail
+					}
+					conn.Write([]byte(reply + "\r\n"))
+				}
+			}()
+		}
+	}()
+	return &conns
+}
+
+// TestSMTPClientMXOrder tests that unreachable and busy mail servers hand over to the next by preference, and that a permanent reply does not
+func TestSMTPClientMXOrder(t *testing.T) {
+	port := serveSMTP(t, nil)
+	client := NewSMTPClient(Profile{})
+	client.port = port
+	fake := verifytest.NewResolver()
+	fake.MX["dead.mock"] = []*net.MX{{Host: "127.0.0.9", Pref: 5}, {Host: "127.0.0.1", Pref: 10}}
+	fake.MX["busy.mock"] = []*net.MX{{Host: "127.0.0.2", Pref: 5}, {Host: "127.0.0.1", Pref: 10}}
+	fake.MX["refusing.mock"] = []*net.MX{{Host: "127.0.0.3", Pref: 5}, {Host: "127.0.0.1", Pref: 10}}
+	busy := serveMX(t, "127.0.0.2:"+port, "220 mx.test ESMTP", "421 4.3.2 Too busy, try later")
+	refusing := serveMX(t, "127.0.0.3:"+port, "220 mx.test ESMTP", "550 5.7.1 Client host blocked")
+
+	for _, domain := range []string{"dead.mock", "busy.mock"} {
+		smtp, peer, err := client.check(context.Background(), fake, domain, "jane", false)
+		if err != nil || !smtp.Deliverable || peer.host != "127.0.0.1" {
+			t.Errorf("Expected jane deliverable at the backup MX of %s, got %+v from %q and %v", domain, smtp, peer.host, err)
+		}
+	}
+	if busy.Load() != 1 {
+		t.Errorf("Expected the busy MX tried first, got %d connections", busy.Load())
+	}
+
+	smtp, peer, err := client.check(context.Background(), fake, "refusing.mock", "jane", false)
+	if code := ErrorCodeFor(err); code != ErrCodeSMTPBlocked || smtp.HostExists || peer.host != "127.0.0.3" || refusing.Load() != 1 {
+		t.Errorf("Expected the primary's permanent rejection to be final, got %s from %q", code, peer.host)
+	}
+
+	fake.MX["many.mock"] = []*net.MX{{Host: "127.0.0.9", Pref: 1}, {Host: "127.0.0.10", Pref: 2}, {Host: "127.0.0.1", Pref: 3}}
+	client.MaxMXHosts = 2
+	if _, peer, err := client.check(context.Background(), fake, "many.mock", "jane", false); err == nil || peer.host != "" {
+		t.Errorf("Expected no host past MaxMXHosts tried, got %q and %v", peer.host, err)
+	}
+}
+
+// TestSMTPClientMXHeadStart tests that the second mail server is raced against a first that is slow to answer
+func TestSMTPClientMXHeadStart(t *testing.T) {
+	port := serveSMTP(t, nil)
+	serveMX(t, "127.0.0.2:"+port, "", "")
+	fake := verifytest.NewResolver()
+	fake.MX["slow.mock"] = []*net.MX{{Host: "127.0.0.2", Pref: 5}, {Host: "127.0.0.1", Pref: 10}}
+	client := NewSMTPClient(Profile{})
+	client.port = port
+	client.OperationTimeout = 5 * time.Second
+	client.MXHeadStart = 50 * time.Millisecond
+
+	start := time.Now()
+	smtp, peer, err := client.check(context.Background(), fake, "slow.mock", "jane", false)
+	if err != nil || !smtp.Deliverable || peer.host != "127.0.0.1" || time.Since(start) > 2*time.Second {
+		t.Errorf("Expected the backup MX to win the race, got %+v from %q and %v after %s", smtp, peer.host, err, time.Since(start))
+	}
+}
+
+// TestSMTPClientCancel tests that a probe to a server that never greets stops once its context ends
+func TestSMTPClientCancel(t *testing.T) {
+	port := serveSMTP(t, nil)
+	serveMX(t, "127.0.0.2:"+port, "", "")
+	fake := verifytest.NewResolver()
+	fake.MX["tarpit.mock"] = []*net.MX{{Host: "127.0.0.2", Pref: 5}}
+	client := NewSMTPClient(Profile{})
+	client.port = port
+	client.OperationTimeout = 5 * time.Second
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	if _, _, err := client.check(ctx, fake, "tarpit.mock", "jane", false); err == nil || time.Since(start) > time.Second {
+		t.Errorf("Expected the probe to stop with its context, got %v after %s", err, time.Since(start))
+	}
+}
+
+// TestResultSMTPHost tests that results name the mail server that answered
+func TestResultSMTPHost(t *testing.T) {
+	fake := verifytest.NewResolver()
+	fake.MX["acme.io"] = []*net.MX{{Host: "127.0.0.9", Pref: 5}, {Host: "127.0.0.1", Pref: 10}}
+	port := serveSMTP(t, nil)
+	s := newTestService(Config{Resolver: fake, BuildProfile: func(p Profile) *SMTPClient {
+		client := NewSMTPClient(p)
+		client.port = port
+		return client
+	}})
+
+	if result := s.Verify("jane@acme.io", Options{Checks: MustParseChecks(CheckSMTP)}); result.SMTPHost != "127.0.0.1" || result.SMTPAddressFamily != AddressFamilyIPv4 || result.Reachable != ReachableYes {
+		t.Errorf("Expected jane reachable at 127.0.0.1 over IPv4, got %q over %q (%s)", result.SMTPHost, result.SMTPAddressFamily, result.Reachable)
+	}
+}
+
+// TestTraceTranscript tests that a traced probe carries the commands and replies of its session
+func TestTraceTranscript(t *testing.T) {
+	fake := verifytest.NewResolver()
+	fake.MX["acme.io"] = []*net.MX{{Host: "127.0.0.1", Pref: 10}}
+	port := serveSMTP(t, nil)
+	s := newTestService(Config{Resolver: fake, BuildProfile: func(p Profile) *SMTPClient {
+		client := NewSMTPClient(p)
+		client.port = port
+		client.CatchAllProbes = 1
+		return client
+	}})
+
+	trace := NewTrace()
+	s.Verify("jane@acme.io", Options{Checks: MustParseChecks(CheckSMTP), Trace: trace})
+	if len(trace.Probes) != 1 {
+		t.Fatalf("Expected one probe, got %+v", trace.Probes)
+	}
+	var lines []string
+	for _, line := range trace.Probes[0].Transcript {
+		if line.Host != "127.0.0.1" {
+			t.Errorf("Expected every line from 127.0.0.1, got %+v", line)
+		}
+		lines = append(lines, line.From+" "+line.Line)
+	}
+	expected := []string{"server 220 mx.test ESMTP", "client EHLO", "server 250 OK", "client MAIL FROM:", "server 250 OK", "client RCPT TO:", "server 550 5.1.1", "client RCPT TO:<jane@acme.io>", "server 250 2.1.5 OK"}
+	if len(lines) != len(expected) {
+		t.Fatalf("Expected %d lines, got %q", len(expected), lines)
+	}
+	for i, prefix := range expected {
+		if !strings.HasPrefix(lines[i], prefix) {
+			t.Errorf("Expected line %d to start with %q, got %q", i, prefix, lines[i])
+		}
+	}
+}
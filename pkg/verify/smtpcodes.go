@@ -0,0 +1,157 @@
+package verify
+
+import (
+	"errors"
+	"regexp"
+	"strconv"
+	"strings"
+
+	emailverifier "github.com/AfterShip/email-verifier"
+)
+
+// Reasons an SMTP reply is mapped to. Clients should branch on these rather
+// than on raw codes, which servers use inconsistently.
+const (
+	SMTPReasonUserUnknown     = "user_unknown"
+	SMTPReasonQuotaExceeded   = "quota_exceeded"
+	SMTPReasonSenderRejected  = "sender_rejected"
+	SMTPReasonPolicyRejection = "policy_rejection"
+	SMTPReasonTryLater        = "try_later"
+	SMTPReasonOther           = "other"
+)
+
+// SMTPDetails is a mail server's reply: the raw codes, the reason they map
+// to and the text. Servers echo the address back in the text, so
+// addresses in it are redacted.
+type SMTPDetails struct {
+	Code         int    `json:"code"`
+	EnhancedCode string `json:"enhanced_code,omitempty"`
+	Reason       string `json:"reason"`
+	Message      string `json:"message,omitempty"`
+	// Temporary is set for 4xx replies, which are worth retrying.
+	Temporary bool `json:"temporary,omitempty"`
+}
+
+// enhancedReasons maps enhanced status codes (RFC 3463) to reasons. Keys
+// leave out the class digit, which servers disagree on: Gmail sends
+// over-quota as both 452 4.2.2 and 552 5.2.2. smtpReasonFor applies the
+// class afterwards.
+var enhancedReasons = map[string]string{
+	"x.1.1":   SMTPReasonUserUnknown,    // bad destination mailbox: Gmail, Outlook, Postfix "User unknown"
+	"x.1.6":   SMTPReasonUserUnknown,    // mailbox has moved
+	"x.1.10":  SMTPReasonUserUnknown,    // Outlook RESOLVER.ADR.RecipientNotFound
+	"x.2.1":   SMTPReasonUserUnknown,    // mailbox disabled: Gmail "account ... is disabled"
+	"x.4.1":   SMTPReasonUserUnknown,    // Outlook directory edge block for unknown recipients
+	"x.1.7":   SMTPReasonSenderRejected, // bad sender mailbox syntax
+	"x.1.8":   SMTPReasonSenderRejected, // bad sender system address: Postfix "Sender address rejected"
+	"x.2.2":   SMTPReasonQuotaExceeded,  // mailbox full
+	"x.2.3":   SMTPReasonQuotaExceeded,  // message too large for the mailbox
+	"x.7.0":   SMTPReasonPolicyRejection,
+	"x.7.1":   SMTPReasonPolicyRejection, // delivery not authorized: Gmail, Outlook, Spamhaus listings
+	"x.7.26":  SMTPReasonPolicyRejection, // Gmail unauthenticated sender
+	"x.7.606": SMTPReasonPolicyRejection, // Outlook banned sending IP
+}
+
+// codeReasons maps basic reply codes to reasons, for servers that send no
+// enhanced code.
+var codeReasons = map[int]string{
+	421: SMTPReasonTryLater,
+	450: SMTPReasonTryLater,
+	451: SMTPReasonTryLater,
+	452: SMTPReasonTryLater,
+	550: SMTPReasonUserUnknown,
+	551: SMTPReasonUserUnknown,
+	552: SMTPReasonQuotaExceeded,
+	553: SMTPReasonSenderRejected,
+	554: SMTPReasonPolicyRejection,
+}
+
+// unknownUserPhrases override the codes for servers that report missing
+// mailboxes under a policy code, like Yandex's "550 5.7.1 No such user!".
+var unknownUserPhrases = []string{"no such user", "user unknown", "user not found", "does not exist"}
+
+// smtpReplyPattern matches the start of a reply, single or multiline
+// ("550-5.1.1 ..."), with an optional enhanced code.
+var smtpReplyPattern = regexp.MustCompile(`^([2-5][0-9][0-9])[ -]?(?:([245])\.([0-9]{1,3}\.[0-9]{1,3})\b)?`)
+
+// smtpLinePrefix matches the codes starting each line of a reply, which
+// continuation lines repeat.
+var smtpLinePrefix = regexp.MustCompile(`^(?:[2-5][0-9][0-9][ -]?)?(?:[245]\.[0-9]{1,3}\.[0-9]{1,3}\b)?\s*`)
+
+// parseSMTPReply extracts the codes from a raw reply and maps them to a
+// reason. It returns nil for text that isn't an SMTP error reply, such as a
+// connection error.
+func parseSMTPReply(reply string) *SMTPDetails {
+	reply = strings.TrimSpace(reply)
+	m := smtpReplyPattern.FindStringSubmatch(reply)
+	if m == nil {
+		return nil
+	}
+	code, _ := strconv.Atoi(m[1])
+	if code < 400 {
+		return nil
+	}
+	details := &SMTPDetails{Code: code, Message: smtpReplyText(reply), Temporary: code < 500}
+	if m[2] != "" {
+		details.EnhancedCode = m[2] + "." + m[3]
+	}
+	details.Reason = smtpReasonFor(details, reply)
+	return details
+}
+
+// smtpReplyText returns the text of a reply without its codes, the lines
+// of a multiline reply joined by spaces, and addresses redacted.
+func smtpReplyText(reply string) string {
+	var text []string
+	for _, line := range strings.Split(reply, "\n") {
+		if line = strings.TrimSpace(smtpLinePrefix.ReplaceAllString(strings.TrimSpace(line), "")); line != "" {
+			text = append(text, line)
+		}
+	}
+	return RedactAddresses(strings.Join(text, " "))
+}
+
+// smtpReasonFor maps a reply to a reason: known phrases first, then the
+// enhanced code, then the basic code. Unmapped temporary failures are
+// try_later.
+func smtpReasonFor(details *SMTPDetails, reply string) string {
+	if details.Code >= 500 && insContains(reply, unknownUserPhrases...) {
+		return SMTPReasonUserUnknown
+	}
+	if details.EnhancedCode != "" {
+		if reason, ok := enhancedReasons["x"+details.EnhancedCode[1:]]; ok {
+			// A temporary policy or mailbox problem is still worth retrying
+			if details.Code < 500 && reason != SMTPReasonQuotaExceeded && reason != SMTPReasonSenderRejected {
+				return SMTPReasonTryLater
+			}
+			return reason
+		}
+	}
+	if reason, ok := codeReasons[details.Code]; ok {
+		return reason
+	}
+	if details.Code < 500 {
+		return SMTPReasonTryLater
+	}
+	return SMTPReasonOther
+}
+
+// smtpDetailsFor returns the server reply behind an SMTP error, if any.
+func smtpDetailsFor(err error) *SMTPDetails {
+	var lookupErr *emailverifier.LookupError
+	if !errors.As(err, &lookupErr) {
+		return nil
+	}
+	return parseSMTPReply(lookupErr.Details)
+}
+
+// insContains reports whether s contains any of substrs, ignoring case.
+func insContains(s string, substrs ...string) bool {
+	s = strings.ToLower(s)
+	for _, sub := range substrs {
+		if strings.Contains(s, sub) {
+			return true
+		}
+	}
+	return false
+}
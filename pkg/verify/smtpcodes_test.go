@@ -0,0 +1,109 @@
+package verify
+
+import (
+	"context"
+	"errors"
+	"net"
+	"testing"
+
+	"email-verifier/pkg/verify/verifytest"
+	emailverifier "github.com/AfterShip/email-verifier"
+)
+
+// TestParseSMTPReply tests the reason mapping against common replies from Gmail, Outlook, Yandex and Postfix
+func TestParseSMTPReply(t *testing.T) {
+	testCases := []struct {
+		name     string
+		reply    string
+		code     int
+		enhanced string
+		reason   string
+	}{
+		// Gmail
+		{"gmail no such user", "550-5.1.1 The email account that you tried to reach does not exist. Please try", 550, "5.1.1", SMTPReasonUserUnknown},
+		{"gmail disabled", "550 5.2.1 The email account that you tried to reach is disabled.", 550, "5.2.1", SMTPReasonUserUnknown},
+		{"gmail over quota", "452 4.2.2 The email account that you tried to reach is over quota.", 452, "4.2.2", SMTPReasonQuotaExceeded},
+		{"gmail mailbox full", "552 5.2.2 The email account that you tried to reach is over quota.", 552, "5.2.2", SMTPReasonQuotaExceeded},
+		{"gmail rate limited", "421 4.7.0 Try again later, closing connection.", 421, "4.7.0", SMTPReasonTryLater},
+		{"gmail receiving too fast", "450 4.2.1 The user you are trying to contact is receiving mail at a rate that", 450, "4.2.1", SMTPReasonTryLater},
+		{"gmail unsolicited", "550 5.7.1 Our system has detected an unusual rate of unsolicited mail", 550, "5.7.1", SMTPReasonPolicyRejection},
+		{"gmail unauthenticated", "550 5.7.26 This mail is unauthenticated", 550, "5.7.26", SMTPReasonPolicyRejection},
+		// Outlook
+		{"outlook recipient not found", "550 5.1.10 RESOLVER.ADR.RecipientNotFound; Recipient not found by SMTP address lookup", 550, "5.1.10", SMTPReasonUserUnknown},
+		{"outlook access denied", "550 5.4.1 Recipient address rejected: Access denied. AS(201806281)", 550, "5.4.1", SMTPReasonUserUnknown},
+		{"outlook banned ip", "550 5.7.606 Access denied, banned sending IP [192.0.2.1]", 550, "5.7.606", SMTPReasonPolicyRejection},
+		{"outlook spamhaus", "550 5.7.1 Service unavailable, Client host [192.0.2.1] blocked using Spamhaus", 550, "5.7.1", SMTPReasonPolicyRejection},
+		{"outlook throttled", "451 4.7.500 Server busy. Please try again later", 451, "4.7.500", SMTPReasonTryLater},
+		// Yandex
+		{"yandex no such user", "550 5.7.1 No such user!", 550, "5.7.1", SMTPReasonUserUnknown},
+		{"yandex mailbox full", "552 5.2.2 Mailbox size limit exceeded", 552, "5.2.2", SMTPReasonQuotaExceeded},
+		{"yandex unavailable", "451 4.7.1 Sorry, the service is currently unavailable. Please come back later.", 451, "4.7.1", SMTPReasonTryLater},
+		// Postfix defaults
+		{"postfix user unknown", "550 5.1.1 <x@example.com>: Recipient address rejected: User unknown in local recipient table", 550, "5.1.1", SMTPReasonUserUnknown},
+		{"postfix sender domain", "450 4.1.8 <probe@example.net>: Sender address rejected: Domain not found", 450, "4.1.8", SMTPReasonSenderRejected},
+		{"postfix relay denied", "554 5.7.1 <x@example.org>: Relay access denied", 554, "5.7.1", SMTPReasonPolicyRejection},
+		{"postfix greylisted", "450 4.2.0 <x@example.com>: Recipient address rejected: Greylisted", 450, "4.2.0", SMTPReasonTryLater},
+		{"postfix rbl", "554 5.7.1 Service unavailable; Client host [192.0.2.1] blocked using zen.spamhaus.org", 554, "5.7.1", SMTPReasonPolicyRejection},
+		// Basic codes only
+		{"bare 550", "550 Requested action not taken: mailbox unavailable", 550, "", SMTPReasonUserUnknown},
+		{"bare 553", "553 sorry, that domain isn't in my list of allowed rcpthosts", 553, "", SMTPReasonSenderRejected},
+		{"bare 451", "451 Temporary local problem", 451, "", SMTPReasonTryLater},
+		{"unmapped permanent", "521 Host does not accept mail", 521, "", SMTPReasonOther},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			details := parseSMTPReply(tc.reply)
+			if details == nil {
+				t.Fatal("Expected details, got nil")
+			}
+			if details.Code != tc.code || details.EnhancedCode != tc.enhanced {
+				t.Errorf("Expected %d %s, got %d %s", tc.code, tc.enhanced, details.Code, details.EnhancedCode)
+			}
+			if details.Reason != tc.reason {
+				t.Errorf("Expected reason %s, got %s", tc.reason, details.Reason)
+			}
+		})
+	}
+}
+
+// TestParseSMTPReplyNonReplies tests that text without an error reply code yields no details
+func TestParseSMTPReplyNonReplies(t *testing.T) {
+	for _, reply := range []string{"", "dial tcp: i/o timeout", "250 2.1.5 OK", "5.1.1 missing code"} {
+		if details := parseSMTPReply(reply); details != nil {
+			t.Errorf("Expected no details for %q, got %+v", reply, details)
+		}
+	}
+}
+
+// TestSMTPDetailsInResult tests that a mailbox rejection is reported as undeliverable with its codes
+func TestSMTPDetailsInResult(t *testing.T) {
+	fake := verifytest.NewResolver()
+	fake.MX["acme.io"] = []*net.MX{{Host: "mx.acme.io.", Pref: 10}}
+	testCases := []struct {
+		name      string
+		reply     string
+		verdict   string
+		reachable string
+		errorCode string
+	}{
+		{"user unknown", "550 5.1.1 User unknown", VerdictUndeliverable, "no", ""},
+		{"quota", "552 5.2.2 Mailbox full", VerdictRisky, "unknown", ErrCodeSMTPTryAgain},
+		{"sender rejected", "553 5.1.8 Sender address rejected", VerdictUnknown, "unknown", ErrCodeSMTPBlocked},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			s := newTestService(Config{Resolver: fake, Prober: func(ctx context.Context, profile, domain, username string, catchAll bool) (*emailverifier.SMTP, error) {
+				return &emailverifier.SMTP{}, emailverifier.ParseSMTPError(errors.New(tc.reply))
+			}})
+			result := s.Verify("user@acme.io", Options{Checks: MustParseChecks(CheckSMTP)})
+			if result.SMTPDetails == nil {
+				t.Fatal("Expected smtp_details")
+			}
+			if result.Verdict != tc.verdict || result.Reachable != tc.reachable || result.ErrorCode != tc.errorCode {
+				t.Errorf("Expected %s/%s/%q, got %s/%s/%q", tc.verdict, tc.reachable, tc.errorCode, result.Verdict, result.Reachable, result.ErrorCode)
+			}
+		})
+	}
+}
@@ -0,0 +1,106 @@
+package verify
+
+import (
+	"context"
+	"errors"
+	"math/rand"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+
+	emailverifier "github.com/AfterShip/email-verifier"
+)
+
+// Retry defaults for transient SMTP failures.
+const (
+	DefaultSMTPRetryBackoff    = 500 * time.Millisecond
+	DefaultSMTPRetryMaxBackoff = 5 * time.Second
+)
+
+// SMTPRetryConfig retries probes that failed for a passing reason: a
+// refused or reset connection, a timeout, or a 421, 450 or 451 reply. A
+// probe gets up to Attempts tries, the first included, so 1 or less turns
+// retries off. The first retry waits Backoff and each later one twice the
+// last, up to MaxBackoff, with up to half again added at random. A retry
+// whose wait would outlast the verification's deadline isn't made.
+// Permanent (5xx) rejections are never retried.
+type SMTPRetryConfig struct {
+	Attempts   int
+	Backoff    time.Duration
+	MaxBackoff time.Duration
+}
+
+// RetryObserver is told the reason for every retry of an SMTP probe, as
+// returned by TransientReason. It is called from the probing goroutine,
+// so it must be safe for concurrent use.
+type RetryObserver func(reason string)
+
+// Reasons a probe is retried, as reported to RetryObserver.
+const (
+	RetryTimeout           = "timeout"
+	RetryConnectionRefused = "connection_refused"
+	RetryConnectionReset   = "connection_reset"
+	RetryReply421          = "reply_421"
+	RetryReply450          = "reply_450"
+	RetryReply451          = "reply_451"
+)
+
+// TransientReason returns why a probe's failure is worth retrying at
+// once, or "" if it isn't: the server answered for good, or the probe was
+// never made.
+func TransientReason(err error) string {
+	if err = smtpError(err); err == nil || errors.Is(err, ErrProbeDeferred) || errors.Is(err, ErrCircuitOpen) || errors.Is(err, ErrNetworkDisabled) {
+		return ""
+	}
+	if details := smtpDetailsFor(err); details != nil {
+		switch details.Code {
+		case 421, 450, 451:
+			return "reply_" + strconv.Itoa(details.Code)
+		}
+		return ""
+	}
+	var netErr net.Error
+	if ErrorCodeFor(err) == ErrCodeSMTPTimeout || (errors.As(err, &netErr) && netErr.Timeout()) {
+		return RetryTimeout
+	}
+	switch text := strings.ToLower(err.Error()); {
+	case strings.Contains(text, "connection refused"):
+		return RetryConnectionRefused
+	case strings.Contains(text, "connection reset"), strings.Contains(text, "broken pipe"):
+		return RetryConnectionReset
+	}
+	return ""
+}
+
+// retryProber wraps next so transient failures are retried as cfg says,
+// within the probe's context, counting every try in attempts.
+func (s *Service) retryProber(next Prober, attempts *int) Prober {
+	cfg := s.smtpRetry
+	return func(ctx context.Context, profile, domain, username string, catchAll bool) (*emailverifier.SMTP, error) {
+		backoff := cfg.Backoff
+		for {
+			*attempts++
+			smtp, err := next(ctx, profile, domain, username, catchAll)
+			reason := TransientReason(err)
+			if reason == "" || *attempts >= cfg.Attempts {
+				return smtp, err
+			}
+			wait := backoff + time.Duration(rand.Int63n(int64(backoff)/2+1))
+			if deadline, ok := ctx.Deadline(); ok && time.Until(deadline) < wait {
+				return smtp, err
+			}
+			timer := time.NewTimer(wait)
+			select {
+			case <-timer.C:
+			case <-ctx.Done():
+				timer.Stop()
+				return smtp, err
+			}
+			if s.retryObserver != nil {
+				s.retryObserver(reason)
+			}
+			backoff = min(2*backoff, cfg.MaxBackoff)
+		}
+	}
+}
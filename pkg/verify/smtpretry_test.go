@@ -0,0 +1,106 @@
+package verify
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	emailverifier "github.com/AfterShip/email-verifier"
+
+	"email-verifier/pkg/verify/verifytest"
+)
+
+// TestTransientReason tests which failures are retried and under what reason
+func TestTransientReason(t *testing.T) {
+	testCases := []struct {
+		name   string
+		err    error
+		reason string
+	}{
+		{"answered", nil, ""},
+		{"timeout", &emailverifier.LookupError{Message: emailverifier.ErrTimeout}, RetryTimeout},
+		{"refused", parseReply(errors.New("dial tcp 192.0.2.1:25: connect: connection refused")), RetryConnectionRefused},
+		{"reset", parseReply(errors.New("read tcp 192.0.2.1:25: read: connection reset by peer")), RetryConnectionReset},
+		{"421", parseReply(errors.New("421 4.7.0 Try again later, closing connection")), RetryReply421},
+		{"450", parseReply(errors.New("450 4.2.0 Greylisted, try again in 5 minutes")), RetryReply450},
+		{"451", parseReply(errors.New("451 4.3.0 Temporary lookup failure")), RetryReply451},
+		{"452", parseReply(errors.New("452 4.2.2 Mailbox full")), ""},
+		{"user unknown", parseReply(errors.New("550 5.1.1 User unknown")), ""},
+		{"policy", parseReply(errors.New("554 5.7.1 Rejected by policy")), ""},
+		{"deferred", &probeDeferral{reason: DeferHostRate, host: "mx.partner.mock", wait: time.Minute}, ""},
+		{"circuit open", &circuitOpen{domain: "partner.mock", wait: time.Minute}, ""},
+		{"network disabled", ErrNetworkDisabled, ""},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			if reason := TransientReason(tc.err); reason != tc.reason {
+				t.Errorf("Expected %q, got %q", tc.reason, reason)
+			}
+		})
+	}
+}
+
+// TestSMTPRetry tests that transient failures are retried up to the attempts, permanent ones never, and none past the deadline
+func TestSMTPRetry(t *testing.T) {
+	fake := verifytest.NewResolver()
+	for _, domain := range []string{"flaky.mock", "partner.mock", "slow.mock"} {
+		fake.MX[domain] = []*net.MX{{Host: "mx." + domain + ".", Pref: 10}}
+	}
+	var mu sync.Mutex
+	tries := make(map[string]int)
+	var reasons []string
+	prober := func(ctx context.Context, profile, domain, username string, catchAll bool) (*emailverifier.SMTP, error) {
+		mu.Lock()
+		tries[domain]++
+		n := tries[domain]
+		mu.Unlock()
+		switch {
+		case domain == "slow.mock":
+			return nil, &emailverifier.LookupError{Message: emailverifier.ErrTimeout}
+		case domain == "flaky.mock" && n < 3:
+			return nil, parseReply(errors.New("421 4.7.0 Try again later"))
+		case username == "jane":
+			return &emailverifier.SMTP{HostExists: true, Deliverable: true}, nil
+		}
+		return &emailverifier.SMTP{HostExists: true}, parseReply(fmt.Errorf("550 5.1.1 <%s@%s>: User unknown", username, domain))
+	}
+	s := newTestService(Config{
+		Resolver:      fake,
+		Prober:        prober,
+		Polite:        PoliteConfig{Off: true},
+		SMTPRetry:     SMTPRetryConfig{Attempts: 3, Backoff: time.Millisecond},
+		RetryObserver: func(reason string) { mu.Lock(); reasons = append(reasons, reason); mu.Unlock() },
+	})
+	checks := MustParseChecks(CheckSMTP)
+
+	result := s.Verify("jane@flaky.mock", Options{Checks: checks})
+	if result.Reachable != ReachableYes || result.Attempts != 3 {
+		t.Errorf("Expected deliverable on the third attempt, got %s after %d", result.Reachable, result.Attempts)
+	}
+	if len(reasons) != 2 || reasons[0] != RetryReply421 {
+		t.Errorf("Expected two retries after 421s, got %v", reasons)
+	}
+
+	result = s.Verify("nobody@partner.mock", Options{Checks: checks})
+	if result.Reachable != ReachableNo || result.Attempts != 1 {
+		t.Errorf("Expected a rejected mailbox to be tried once, got %s after %d", result.Reachable, result.Attempts)
+	}
+
+	result = s.Verify("jane@slow.mock", Options{Checks: checks})
+	if result.ErrorCode != ErrCodeSMTPTimeout || result.Attempts != 3 {
+		t.Errorf("Expected smtp_timeout after 3 attempts, got %s after %d", result.ErrorCode, result.Attempts)
+	}
+
+	// A retry that would outlast the deadline isn't made
+	patient := newTestService(Config{Resolver: fake, Prober: prober, Polite: PoliteConfig{Off: true}, SMTPRetry: SMTPRetryConfig{Attempts: 3, Backoff: time.Second}})
+	ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+	defer cancel()
+	result = patient.Verify("john@slow.mock", Options{Checks: checks, Context: ctx})
+	if result.ErrorCode != ErrCodeSMTPTimeout || result.Attempts != 1 {
+		t.Errorf("Expected smtp_timeout after 1 attempt, got %s after %d", result.ErrorCode, result.Attempts)
+	}
+}
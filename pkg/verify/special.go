@@ -0,0 +1,123 @@
+package verify
+
+import (
+	"net/netip"
+	"strings"
+)
+
+// Domain statuses decided from the domain itself, without DNS.
+const (
+	// DomainIPLiteral is an address literal such as user@[192.0.2.1].
+	DomainIPLiteral = "ip_literal"
+	// DomainNonRoutable is a domain that can't exist on the public
+	// internet: a single label or a reserved top-level domain.
+	DomainNonRoutable = "non_routable"
+)
+
+// Reasons a domain is non_routable, reported in Result.DomainReason.
+const (
+	DomainReasonSingleLabel = "single_label"
+	DomainReasonReservedTLD = "reserved_tld"
+)
+
+// WarningSpecialUseNotProbed is reported when the SMTP check was requested
+// for an RFC 6761 special-use domain such as example.com.
+const WarningSpecialUseNotProbed = "special_use_domain_not_probed"
+
+// reservedTLDs are the RFC 2606 / RFC 6761 top-level domains that are never
+// delegated.
+var reservedTLDs = map[string]bool{
+	"localhost": true,
+	"test":      true,
+	"invalid":   true,
+	"example":   true,
+}
+
+// specialUseDomains are the RFC 6761 second-level names reserved for
+// documentation. They resolve, but nobody's mailbox lives there.
+var specialUseDomains = []string{"example.com", "example.net", "example.org"}
+
+// specialAddress is an address whose domain is classified without DNS.
+type specialAddress struct {
+	Username string
+	Domain   string
+	Status   string
+	Reason   string
+}
+
+// classifySpecialAddress recognizes address literals, single-label domains
+// and reserved TLDs, which the library's syntax check rejects or DNS can't
+// answer for. ok is false for ordinary addresses and for malformed literals,
+// which are left to the syntax check.
+func classifySpecialAddress(email string) (addr specialAddress, ok bool) {
+	at := strings.LastIndex(email, "@")
+	if at <= 0 || at == len(email)-1 {
+		return addr, false
+	}
+	addr.Username, addr.Domain = email[:at], strings.ToLower(email[at+1:])
+	domain := strings.TrimSuffix(addr.Domain, ".")
+
+	if strings.HasPrefix(domain, "[") && strings.HasSuffix(domain, "]") {
+		if !validAddressLiteral(domain[1 : len(domain)-1]) {
+			return addr, false
+		}
+		addr.Status = DomainIPLiteral
+		return addr, true
+	}
+
+	labels := strings.Split(domain, ".")
+	for _, label := range labels {
+		if !validLabel(label) {
+			return addr, false
+		}
+	}
+	switch {
+	case reservedTLDs[labels[len(labels)-1]]:
+		addr.Status, addr.Reason = DomainNonRoutable, DomainReasonReservedTLD
+	case len(labels) == 1:
+		addr.Status, addr.Reason = DomainNonRoutable, DomainReasonSingleLabel
+	default:
+		return addr, false
+	}
+	return addr, true
+}
+
+// validLabel reports whether s is a letter-digit-hyphen hostname label.
+func validLabel(s string) bool {
+	if len(s) == 0 || len(s) > 63 || s[0] == '-' || s[len(s)-1] == '-' {
+		return false
+	}
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if !(c >= 'a' && c <= 'z' || c >= '0' && c <= '9' || c == '-') {
+			return false
+		}
+	}
+	return true
+}
+
+// validAddressLiteral reports whether s is the inside of an RFC 5321
+// address literal: a dotted IPv4 address or "IPv6:" and an IPv6 address.
+func validAddressLiteral(s string) bool {
+	if len(s) > 5 && strings.EqualFold(s[:5], "IPv6:") {
+		ip, err := netip.ParseAddr(s[5:])
+		return err == nil && ip.Is6() && ip.Zone() == ""
+	}
+	ip, err := netip.ParseAddr(s)
+	return err == nil && ip.Is4()
+}
+
+// isSpecialUse reports whether domain is or is under an RFC 6761
+// special-use name. Mail servers for these are never probed.
+func isSpecialUse(domain string) bool {
+	domain = strings.TrimSuffix(strings.ToLower(domain), ".")
+	if _, ok := classifySpecialAddress("x@" + domain); ok {
+		return true
+	}
+	for _, name := range specialUseDomains {
+		if domain == name || strings.HasSuffix(domain, "."+name) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,97 @@
+package verify
+
+import (
+	"context"
+	"net"
+	"slices"
+	"testing"
+
+	emailverifier "github.com/AfterShip/email-verifier"
+
+	"email-verifier/pkg/verify/verifytest"
+)
+
+// TestSpecialDomains tests how address literals, non-routable and special-use domains are classified and whether they are probed
+func TestSpecialDomains(t *testing.T) {
+	fake := verifytest.NewResolver()
+	fake.MX["example.com"] = []*net.MX{{Host: "mx.example.com.", Pref: 10}}
+	fake.MX["mail.example.org"] = []*net.MX{{Host: "mx.example.org.", Pref: 10}}
+	fake.MX["partner.com"] = []*net.MX{{Host: "mx.partner.com.", Pref: 10}}
+
+	probes := 0
+	prober := func(ctx context.Context, profile, domain, username string, catchAll bool) (*emailverifier.SMTP, error) {
+		probes++
+		return &emailverifier.SMTP{HostExists: true, Deliverable: true}, nil
+	}
+	s := newTestService(Config{Resolver: fake, Prober: prober})
+
+	testCases := []struct {
+		email   string
+		valid   bool
+		status  string
+		reason  string
+		verdict string
+		probed  bool
+	}{
+		{"user@[192.168.1.10]", true, DomainIPLiteral, "", VerdictUnknown, false},
+		{"user@[IPv6:2001:db8::1]", true, DomainIPLiteral, "", VerdictUnknown, false},
+		{"user@[ipv6:::ffff:192.0.2.1]", true, DomainIPLiteral, "", VerdictUnknown, false},
+		{"user@[2001:db8::1]", false, "", "", VerdictInvalid, false},
+		{"user@[300.1.1.1]", false, "", "", VerdictInvalid, false},
+		{"user@[IPv6:192.0.2.1]", false, "", "", VerdictInvalid, false},
+		{"user@localhost", true, DomainNonRoutable, DomainReasonReservedTLD, VerdictUndeliverable, false},
+		{"user@intranet", true, DomainNonRoutable, DomainReasonSingleLabel, VerdictUndeliverable, false},
+		{"user@Intranet.", true, DomainNonRoutable, DomainReasonSingleLabel, VerdictUndeliverable, false},
+		{"user@app.localhost", true, DomainNonRoutable, DomainReasonReservedTLD, VerdictUndeliverable, false},
+		{"user@build.test", true, DomainNonRoutable, DomainReasonReservedTLD, VerdictUndeliverable, false},
+		{"user@nowhere.invalid", true, DomainNonRoutable, DomainReasonReservedTLD, VerdictUndeliverable, false},
+		{"user@docs.EXAMPLE", true, DomainNonRoutable, DomainReasonReservedTLD, VerdictUndeliverable, false},
+		{"not..valid@intranet", false, "", "", VerdictInvalid, false},
+		{"user@-intranet", false, "", "", VerdictInvalid, false},
+		{"user@example.com", true, DomainHasMail, "", VerdictUnknown, false},
+		{"user@mail.example.org", true, DomainHasMail, "", VerdictUnknown, false},
+		{"user@partner.com", true, DomainHasMail, "", VerdictDeliverable, true},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.email, func(t *testing.T) {
+			probes = 0
+			result := s.Verify(tc.email, Options{Checks: MustParseChecks(CheckSMTP)})
+			if result.IsValid != tc.valid {
+				t.Fatalf("Expected is_valid %v, got %v (%s)", tc.valid, result.IsValid, result.ErrorCode)
+			}
+			if result.DomainStatus != tc.status || result.DomainReason != tc.reason {
+				t.Errorf("Expected domain status %q/%q, got %q/%q", tc.status, tc.reason, result.DomainStatus, result.DomainReason)
+			}
+			if result.Verdict != tc.verdict {
+				t.Errorf("Expected verdict %s, got %s", tc.verdict, result.Verdict)
+			}
+			if (probes > 0) != tc.probed {
+				t.Errorf("Expected probed=%v, got %d probes", tc.probed, probes)
+			}
+		})
+	}
+
+	result := s.Verify("user@example.com", Options{Checks: MustParseChecks(CheckSMTP)})
+	if !slices.Contains(result.Warnings, WarningSpecialUseNotProbed) {
+		t.Errorf("Expected the %s warning, got %v", WarningSpecialUseNotProbed, result.Warnings)
+	}
+}
+
+// TestProbeIPLiterals tests that address literals are only probed when the service allows it
+func TestProbeIPLiterals(t *testing.T) {
+	var probedDomain string
+	prober := func(ctx context.Context, profile, domain, username string, catchAll bool) (*emailverifier.SMTP, error) {
+		probedDomain = domain
+		return &emailverifier.SMTP{HostExists: true, Deliverable: true}, nil
+	}
+	s := newTestService(Config{Resolver: verifytest.NewResolver(), Prober: prober, ProbeIPLiterals: true})
+
+	result := s.Verify("user@[192.0.2.1]", Options{Checks: MustParseChecks(CheckSMTP)})
+	if probedDomain != "[192.0.2.1]" {
+		t.Fatalf("Expected the literal to be probed, got %q", probedDomain)
+	}
+	if result.DomainStatus != DomainIPLiteral || result.Verdict != VerdictDeliverable {
+		t.Errorf("Expected a deliverable ip_literal result, got %s/%s", result.DomainStatus, result.Verdict)
+	}
+}
@@ -0,0 +1,231 @@
+package verify
+
+import (
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// SuppressionManual is the source of suppressions added by hand.
+const SuppressionManual = "manual"
+
+// SuppressionStore holds suppressions added at runtime, by hand or synced
+// from an ESP's bounce and complaint list, on top of the tenants' config
+// lists. Each entry remembers which sources suppressed it and since when.
+//
+// Precedence, strongest first:
+//  1. A tenant config list suppresses its addresses whatever the store says.
+//  2. A manual unsuppression overrides every source that suppressed the
+//     address before it.
+//  3. A source that suppresses the address after the unsuppression, such as
+//     a new bounce event or a manual suppression, suppresses it again.
+//
+// A dump that keeps listing an address keeps its original time, so
+// re-importing it doesn't undo an unsuppression; only a fresh listing does.
+type SuppressionStore struct {
+	mu      sync.Mutex
+	tenants map[string]map[string]*suppressionEntry // tenant, then address or @domain
+	now     func() time.Time
+}
+
+type suppressionEntry struct {
+	sources      map[string]time.Time // when each source first suppressed it
+	unsuppressed time.Time
+}
+
+// suppressed reports whether any source suppressed the entry after its
+// last unsuppression.
+func (e *suppressionEntry) suppressed() bool {
+	for _, since := range e.sources {
+		if since.After(e.unsuppressed) {
+			return true
+		}
+	}
+	return false
+}
+
+// NewSuppressionStore returns an empty store.
+func NewSuppressionStore() *SuppressionStore {
+	return &SuppressionStore{tenants: make(map[string]map[string]*suppressionEntry), now: time.Now}
+}
+
+// normalizeSuppression lowercases an address or @domain, returning "" for
+// anything that is neither.
+func normalizeSuppression(address string) string {
+	address = strings.ToLower(strings.TrimSpace(address))
+	at := strings.LastIndex(address, "@")
+	if at < 0 || at == len(address)-1 {
+		return ""
+	}
+	return address
+}
+
+func (st *SuppressionStore) entry(tenant, address string, create bool) *suppressionEntry {
+	entries := st.tenants[tenant]
+	if entries == nil {
+		if !create {
+			return nil
+		}
+		entries = make(map[string]*suppressionEntry)
+		st.tenants[tenant] = entries
+	}
+	e := entries[address]
+	if e == nil && create {
+		e = &suppressionEntry{sources: make(map[string]time.Time)}
+		entries[address] = e
+	}
+	return e
+}
+
+// Add records that source suppressed address at at, keeping the later of
+// at and any earlier time from the same source. It reports whether the
+// address is now suppressed.
+func (st *SuppressionStore) Add(tenant, source, address string, at time.Time) bool {
+	address = normalizeSuppression(address)
+	if address == "" {
+		return false
+	}
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	e := st.entry(tenant, address, true)
+	if at.After(e.sources[source]) {
+		e.sources[source] = at
+	}
+	return e.suppressed()
+}
+
+// Replace makes addresses the whole of source's suppressions for tenant, as
+// for a periodic dump: addresses already listed keep their time, new ones
+// get at, and missing ones lose the source. It returns how many were added
+// and removed.
+func (st *SuppressionStore) Replace(tenant, source string, addresses []string, at time.Time) (added, removed int) {
+	listed := make(map[string]bool, len(addresses))
+	for _, address := range addresses {
+		if address = normalizeSuppression(address); address != "" {
+			listed[address] = true
+		}
+	}
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	for address, e := range st.tenants[tenant] {
+		if _, ok := e.sources[source]; ok && !listed[address] {
+			delete(e.sources, source)
+			removed++
+			st.prune(tenant, address, e)
+		}
+	}
+	for address := range listed {
+		e := st.entry(tenant, address, true)
+		if _, ok := e.sources[source]; !ok {
+			e.sources[source] = at
+			added++
+		}
+	}
+	return added, removed
+}
+
+// Unsuppress overrides every suppression of address made before now. The
+// manual source is dropped, since the latest manual action wins.
+func (st *SuppressionStore) Unsuppress(tenant, address string) bool {
+	address = normalizeSuppression(address)
+	if address == "" {
+		return false
+	}
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	e := st.entry(tenant, address, true)
+	delete(e.sources, SuppressionManual)
+	e.unsuppressed = st.now()
+	return true
+}
+
+// RemoveSource drops source from every entry in every tenant and returns
+// how many entries it had suppressed.
+func (st *SuppressionStore) RemoveSource(source string) int {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	removed := 0
+	for tenant, entries := range st.tenants {
+		for address, e := range entries {
+			if _, ok := e.sources[source]; ok {
+				delete(e.sources, source)
+				removed++
+				st.prune(tenant, address, e)
+			}
+		}
+	}
+	return removed
+}
+
+// prune deletes an entry left with nothing to remember. Unsuppressions are
+// kept so a late event dated before them can't suppress the address again.
+func (st *SuppressionStore) prune(tenant, address string, e *suppressionEntry) {
+	if len(e.sources) == 0 && e.unsuppressed.IsZero() {
+		delete(st.tenants[tenant], address)
+	}
+}
+
+// Suppressed reports whether the store suppresses the address or its whole
+// domain for tenant.
+func (st *SuppressionStore) Suppressed(tenant, username, domain string) bool {
+	domain = strings.ToLower(domain)
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	for _, address := range []string{"@" + domain, strings.ToLower(username) + "@" + domain} {
+		if e := st.entry(tenant, address, false); e != nil && e.suppressed() {
+			return true
+		}
+	}
+	return false
+}
+
+// SuppressionSource is one source's claim on an address.
+type SuppressionSource struct {
+	Source string    `json:"source"`
+	Since  time.Time `json:"since"`
+}
+
+// SuppressionEntry describes an address or @domain in the store.
+type SuppressionEntry struct {
+	Address      string              `json:"address"`
+	Suppressed   bool                `json:"suppressed"`
+	Sources      []SuppressionSource `json:"sources"`
+	Unsuppressed *time.Time          `json:"unsuppressed_at,omitempty"`
+}
+
+// List returns tenant's entries ordered by address.
+func (st *SuppressionStore) List(tenant string) []SuppressionEntry {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	list := make([]SuppressionEntry, 0, len(st.tenants[tenant]))
+	for address, e := range st.tenants[tenant] {
+		entry := SuppressionEntry{Address: address, Suppressed: e.suppressed(), Sources: []SuppressionSource{}}
+		for source, since := range e.sources {
+			entry.Sources = append(entry.Sources, SuppressionSource{Source: source, Since: since})
+		}
+		sort.Slice(entry.Sources, func(i, j int) bool { return entry.Sources[i].Source < entry.Sources[j].Source })
+		if !e.unsuppressed.IsZero() {
+			unsuppressed := e.unsuppressed
+			entry.Unsuppressed = &unsuppressed
+		}
+		list = append(list, entry)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Address < list[j].Address })
+	return list
+}
+
+// Suppressions returns the runtime suppression store.
+func (s *Service) Suppressions() *SuppressionStore { return s.suppressions }
+
+// isSuppressed checks the tenant's config list and then the store.
+func (s *Service) isSuppressed(tenant *tenantPolicy, username, domain string) bool {
+	if tenant.isSuppressed(username, domain) {
+		return true
+	}
+	name := DefaultTenant
+	if tenant != nil {
+		name = tenant.name
+	}
+	return s.suppressions.Suppressed(name, username, domain)
+}
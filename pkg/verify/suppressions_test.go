@@ -0,0 +1,125 @@
+package verify
+
+import (
+	"testing"
+	"time"
+)
+
+// TestSuppressionPrecedence tests how manual unsuppressions interact with imported, event and manual suppressions
+func TestSuppressionPrecedence(t *testing.T) {
+	base := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+	testCases := []struct {
+		name     string
+		steps    func(st *SuppressionStore, clock *time.Time)
+		expected bool
+	}{
+		{"imported", func(st *SuppressionStore, clock *time.Time) {
+			st.Replace("a", "esp", []string{"jane@x.mock"}, *clock)
+		}, true},
+		{"unsuppression beats an earlier import", func(st *SuppressionStore, clock *time.Time) {
+			st.Replace("a", "esp", []string{"jane@x.mock"}, *clock)
+			*clock = clock.Add(time.Hour)
+			st.Unsuppress("a", "jane@x.mock")
+		}, false},
+		{"re-importing the same dump keeps the unsuppression", func(st *SuppressionStore, clock *time.Time) {
+			st.Replace("a", "esp", []string{"jane@x.mock"}, *clock)
+			*clock = clock.Add(time.Hour)
+			st.Unsuppress("a", "jane@x.mock")
+			st.Replace("a", "esp", []string{"jane@x.mock"}, clock.Add(time.Hour))
+		}, false},
+		{"a fresh listing after the unsuppression wins", func(st *SuppressionStore, clock *time.Time) {
+			st.Replace("a", "esp", []string{"jane@x.mock"}, *clock)
+			*clock = clock.Add(time.Hour)
+			st.Unsuppress("a", "jane@x.mock")
+			st.Replace("a", "esp", nil, clock.Add(time.Hour))
+			st.Replace("a", "esp", []string{"jane@x.mock"}, clock.Add(2*time.Hour))
+		}, true},
+		{"a newer bounce event wins", func(st *SuppressionStore, clock *time.Time) {
+			st.Unsuppress("a", "jane@x.mock")
+			st.Add("a", "events", "jane@x.mock", clock.Add(time.Minute))
+		}, true},
+		{"a late event dated before the unsuppression loses", func(st *SuppressionStore, clock *time.Time) {
+			st.Unsuppress("a", "jane@x.mock")
+			st.Add("a", "events", "jane@x.mock", clock.Add(-time.Minute))
+		}, false},
+		{"manual suppression after unsuppression wins", func(st *SuppressionStore, clock *time.Time) {
+			st.Unsuppress("a", "jane@x.mock")
+			*clock = clock.Add(time.Minute)
+			st.Add("a", SuppressionManual, "jane@x.mock", *clock)
+		}, true},
+		{"removing the only source", func(st *SuppressionStore, clock *time.Time) {
+			st.Replace("a", "esp", []string{"jane@x.mock"}, *clock)
+			st.RemoveSource("esp")
+		}, false},
+		{"removing one of two sources", func(st *SuppressionStore, clock *time.Time) {
+			st.Replace("a", "esp", []string{"jane@x.mock"}, *clock)
+			st.Add("a", "events", "JANE@x.mock", *clock)
+			st.RemoveSource("esp")
+		}, true},
+		{"domain suppression", func(st *SuppressionStore, clock *time.Time) {
+			st.Replace("a", "esp", []string{"@x.mock"}, *clock)
+		}, true},
+		{"other tenant", func(st *SuppressionStore, clock *time.Time) {
+			st.Replace("b", "esp", []string{"jane@x.mock"}, *clock)
+		}, false},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			clock := base
+			st := NewSuppressionStore()
+			st.now = func() time.Time { return clock }
+			tc.steps(st, &clock)
+			if got := st.Suppressed("a", "jane", "x.mock"); got != tc.expected {
+				t.Errorf("Expected suppressed %v, got %v: %+v", tc.expected, got, st.List("a"))
+			}
+		})
+	}
+}
+
+// TestSuppressionReplace tests that a dump adds new addresses and drops the ones it no longer lists
+func TestSuppressionReplace(t *testing.T) {
+	st := NewSuppressionStore()
+	now := time.Now()
+	if added, removed := st.Replace("a", "esp", []string{"one@x.mock", "two@x.mock", "not-an-address"}, now); added != 2 || removed != 0 {
+		t.Errorf("Expected 2 added, got %d added and %d removed", added, removed)
+	}
+	st.Add("a", SuppressionManual, "two@x.mock", now)
+	if added, removed := st.Replace("a", "esp", []string{"two@x.mock", "three@x.mock"}, now); added != 1 || removed != 1 {
+		t.Errorf("Expected 1 added and 1 removed, got %d and %d", added, removed)
+	}
+
+	list := st.List("a")
+	if len(list) != 2 || list[0].Address != "three@x.mock" || len(list[1].Sources) != 2 {
+		t.Errorf("Expected three@ and two@ with both sources, got %+v", list)
+	}
+}
+
+// TestStoreSuppressionInVerify tests that store suppressions apply to the tenant's verifications and batches
+func TestStoreSuppressionInVerify(t *testing.T) {
+	s, dns := newTenantService()
+	s.Suppressions().Add("b", "esp", "@d1.mock", time.Now())
+	s.Suppressions().Add(DefaultTenant, "esp", "user0@d0.mock", time.Now())
+	checks := MustParseChecks(CheckSMTP)
+
+	if result := s.Verify("user0@d1.mock", Options{Checks: checks, Key: "kb"}); !result.Suppressed || result.Verdict != VerdictUndeliverable {
+		t.Errorf("Expected tenant b's import to suppress, got %+v", result)
+	}
+	if result := s.Verify("user1@d1.mock", Options{Checks: checks, Key: "ka"}); result.Suppressed {
+		t.Errorf("Expected tenant a unaffected, got %+v", result)
+	}
+	if result := s.Verify("user0@d0.mock", Options{Checks: checks}); !result.Suppressed {
+		t.Errorf("Expected the default tenant's import to suppress, got %+v", result)
+	}
+
+	dns.mxLookups.Store(0)
+	if _, summary := s.VerifyBatch(batchEmails(2, 3), Options{Checks: checks, Key: "kb"}); summary.DNSLookups != 1 {
+		t.Errorf("Expected the suppressed domain skipped in a batch, got %+v", summary)
+	}
+
+	// Config lists outrank an unsuppression
+	s.Suppressions().Unsuppress("a", "user0@d1.mock")
+	if result := s.Verify("user0@d1.mock", Options{Checks: checks, Key: "ka"}); !result.Suppressed {
+		t.Errorf("Expected the config list to keep suppressing, got %+v", result)
+	}
+}
@@ -0,0 +1,155 @@
+package verify
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+)
+
+// DefaultTenant is the tenant of every API key no tenant lists. It has no
+// policy lists of its own.
+const DefaultTenant = "default"
+
+// Tenant is a group of API keys whose policy lists and recorded results
+// are kept apart from every other tenant's. Its lists add to the
+// server-wide ones, which every tenant reads and none can change.
+type Tenant struct {
+	Keys []string `json:"keys"`
+	// Checks are the default checks for the tenant's keys, where the
+	// checks config has none for the key itself.
+	Checks []string `json:"checks,omitempty"`
+	// Suppressed are addresses, or whole domains written as @domain, that
+	// are reported undeliverable without being verified.
+	Suppressed []string `json:"suppressed,omitempty"`
+	// Disposable are extra disposable domains.
+	Disposable []string `json:"disposable,omitempty"`
+	// RoleAccounts are extra role account local parts, such as "billing".
+	RoleAccounts []string `json:"role_accounts,omitempty"`
+}
+
+// tenantPolicy is a Tenant's lists as lowercase sets. A nil policy, as for
+// DefaultTenant, matches nothing.
+type tenantPolicy struct {
+	name       string
+	checks     CheckSet
+	suppressed map[string]bool
+	disposable map[string]bool
+	role       map[string]bool
+}
+
+func newTenantPolicy(name string, tenant Tenant) *tenantPolicy {
+	policy := &tenantPolicy{
+		name:       name,
+		suppressed: lowerSet(tenant.Suppressed),
+		disposable: lowerSet(tenant.Disposable),
+		role:       lowerSet(tenant.RoleAccounts),
+	}
+	if len(tenant.Checks) > 0 {
+		// LoadTenants has already rejected unknown checks
+		policy.checks, _ = ParseChecks(tenant.Checks...)
+	}
+	return policy
+}
+
+func lowerSet(values []string) map[string]bool {
+	set := make(map[string]bool, len(values))
+	for _, value := range values {
+		set[strings.ToLower(strings.TrimSpace(value))] = true
+	}
+	return set
+}
+
+// isSuppressed reports whether the address or its whole domain is
+// suppressed.
+func (p *tenantPolicy) isSuppressed(username, domain string) bool {
+	if p == nil {
+		return false
+	}
+	domain = strings.ToLower(domain)
+	return p.suppressed["@"+domain] || p.suppressed[strings.ToLower(username)+"@"+domain]
+}
+
+func (p *tenantPolicy) isDisposable(domain string) bool {
+	return p != nil && p.disposable[strings.ToLower(domain)]
+}
+
+func (p *tenantPolicy) isRole(username string) bool {
+	return p != nil && p.role[strings.ToLower(username)]
+}
+
+// TenantSummary describes a tenant for the admin listing.
+type TenantSummary struct {
+	Name         string   `json:"name"`
+	Keys         int      `json:"keys"`
+	Checks       []string `json:"checks,omitempty"`
+	Suppressed   int      `json:"suppressed"`
+	Disposable   int      `json:"disposable"`
+	RoleAccounts int      `json:"role_accounts"`
+}
+
+// TenantFor returns the tenant an API key belongs to, DefaultTenant if
+// none lists it.
+func (s *Service) TenantFor(key string) string {
+	if policy := s.keyTenants[key]; policy != nil {
+		return policy.name
+	}
+	return DefaultTenant
+}
+
+// Tenants summarizes every configured tenant, ordered by name.
+func (s *Service) Tenants() []TenantSummary {
+	list := make([]TenantSummary, 0, len(s.tenants))
+	for name, policy := range s.tenants {
+		summary := TenantSummary{
+			Name:         name,
+			Suppressed:   len(policy.suppressed),
+			Disposable:   len(policy.disposable),
+			RoleAccounts: len(policy.role),
+		}
+		if policy.checks != nil {
+			summary.Checks = policy.checks.Names()
+		}
+		for _, tenant := range s.keyTenants {
+			if tenant == policy {
+				summary.Keys++
+			}
+		}
+		list = append(list, summary)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Name < list[j].Name })
+	return list
+}
+
+// LoadTenants reads a JSON file mapping tenant names to Tenants. A key may
+// belong to one tenant only, and DefaultTenant can't be configured.
+func LoadTenants(path string) (map[string]Tenant, error) {
+	if path == "" {
+		return map[string]Tenant{}, nil
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var tenants map[string]Tenant
+	if err := json.Unmarshal(data, &tenants); err != nil {
+		return nil, fmt.Errorf("parse tenants config %s: %v", path, err)
+	}
+	owner := make(map[string]string)
+	for name, tenant := range tenants {
+		if name == "" || name == DefaultTenant {
+			return nil, fmt.Errorf("tenants config %s: %q is not a valid tenant name", path, name)
+		}
+		if _, err := ParseChecks(tenant.Checks...); err != nil {
+			return nil, fmt.Errorf("tenants config %s, tenant %q: unknown checks in %v; valid checks are %s", path, name, tenant.Checks, strings.Join(CheckOrder, ", "))
+		}
+		for _, key := range tenant.Keys {
+			if other, ok := owner[key]; ok {
+				return nil, fmt.Errorf("tenants config %s: key listed for both %q and %q", path, other, name)
+			}
+			owner[key] = name
+		}
+	}
+	return tenants, nil
+}
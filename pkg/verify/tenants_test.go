@@ -0,0 +1,149 @@
+package verify
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+// newTenantService returns a batch service where tenant "a" (key ka) has its own lists and tenant "b" (key kb) has none
+func newTenantService() (*Service, *countingResolver) {
+	s, dns, smtp := newBatchService(2)
+	smtp.Mailboxes["oncall@d1.mock"] = true
+	s = newTestService(Config{
+		Resolver: dns,
+		Prober:   smtp.Probe,
+		Tenants: map[string]Tenant{
+			"a": {
+				Keys:         []string{"ka"},
+				Suppressed:   []string{"@d0.mock", "USER0@d1.mock"},
+				Disposable:   []string{"burner.mock"},
+				RoleAccounts: []string{"oncall"},
+			},
+			"b": {Keys: []string{"kb"}, Checks: []string{CheckSMTP}},
+		},
+	})
+	return s, dns
+}
+
+// TestTenantIsolation tests that one tenant's lists never affect another tenant's results
+func TestTenantIsolation(t *testing.T) {
+	s, _ := newTenantService()
+	checks := MustParseChecks(CheckDisposable, CheckRole, CheckSMTP)
+
+	testCases := []struct {
+		email      string
+		key        string
+		verdict    string
+		suppressed bool
+		disposable bool
+		role       bool
+	}{
+		{"user1@d0.mock", "ka", VerdictUndeliverable, true, false, false},
+		{"user1@d0.mock", "kb", VerdictRisky, false, false, false},
+		{"user1@d0.mock", "", VerdictRisky, false, false, false},
+		{"user0@d1.mock", "ka", VerdictUndeliverable, true, false, false},
+		{"user0@d1.mock", "kb", VerdictDeliverable, false, false, false},
+		{"user1@d1.mock", "ka", VerdictUndeliverable, false, false, false},
+		{"jane@burner.mock", "ka", VerdictRisky, false, true, false},
+		{"jane@burner.mock", "kb", VerdictUndeliverable, false, false, false},
+		{"oncall@d1.mock", "ka", VerdictDeliverable, false, false, true},
+		{"oncall@d1.mock", "kb", VerdictDeliverable, false, false, false},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.email+" as "+tc.key, func(t *testing.T) {
+			result := s.Verify(tc.email, Options{Checks: checks, Key: tc.key})
+			if result.Verdict != tc.verdict || result.Suppressed != tc.suppressed || result.Disposable != tc.disposable || result.RoleAccount != tc.role {
+				t.Errorf("Expected verdict %s, suppressed %v, disposable %v and role %v, got %s, %v, %v and %v",
+					tc.verdict, tc.suppressed, tc.disposable, tc.role, result.Verdict, result.Suppressed, result.Disposable, result.RoleAccount)
+			}
+		})
+	}
+}
+
+// TestTenantSuppressionSkipsLookups tests that suppressed addresses and domains cost no DNS or SMTP work
+func TestTenantSuppressionSkipsLookups(t *testing.T) {
+	s, dns := newTenantService()
+	checks := MustParseChecks(CheckSMTP)
+
+	result := s.Verify("user5@d0.mock", Options{Checks: checks, Key: "ka"})
+	if n := dns.mxLookups.Load(); n != 0 || result.CostUnits != 0 {
+		t.Errorf("Expected a suppressed address to need no lookups, got %d lookups and %d units", n, result.CostUnits)
+	}
+
+	results, summary := s.VerifyBatch(batchEmails(2, 3), Options{Checks: checks, Key: "ka"})
+	if summary.DNSLookups != 1 || summary.CatchAllProbes != 1 {
+		t.Errorf("Expected only d1.mock to be looked up and probed, got %+v", summary)
+	}
+	for _, result := range results {
+		if result.Domain == "d0.mock" && !result.Suppressed {
+			t.Errorf("Expected %s suppressed in the batch, got %+v", result.Email, result)
+		}
+	}
+
+	_, summary = s.VerifyBatch(batchEmails(2, 3), Options{Checks: checks, Key: "kb"})
+	if summary.DNSLookups != 2 || summary.CatchAllProbes != 2 {
+		t.Errorf("Expected both domains looked up for tenant b, got %+v", summary)
+	}
+}
+
+// TestTenantFor tests key to tenant mapping, check precedence and the admin summary
+func TestTenantFor(t *testing.T) {
+	s, _ := newTenantService()
+	s.keyChecks = map[string]CheckSet{"kb": MustParseChecks(CheckFree)}
+
+	if got := s.TenantFor("ka"); got != "a" {
+		t.Errorf("Expected tenant a, got %s", got)
+	}
+	if got := s.TenantFor("unknown"); got != DefaultTenant {
+		t.Errorf("Expected the default tenant, got %s", got)
+	}
+	if got := s.ChecksFor("kb").Names(); !reflect.DeepEqual(got, []string{CheckSyntax, CheckFree}) {
+		t.Errorf("Expected the key's own checks first, got %v", got)
+	}
+	delete(s.keyChecks, "kb")
+	if !s.ChecksFor("kb").Has(CheckSMTP) {
+		t.Error("Expected the tenant's checks without key checks")
+	}
+	if !reflect.DeepEqual(s.ChecksFor("ka"), DefaultChecks) {
+		t.Error("Expected DefaultChecks for a tenant without checks")
+	}
+
+	expected := []TenantSummary{
+		{Name: "a", Keys: 1, Suppressed: 2, Disposable: 1, RoleAccounts: 1},
+		{Name: "b", Keys: 1, Checks: []string{CheckSyntax, CheckMX, CheckSMTP}},
+	}
+	if got := s.Tenants(); !reflect.DeepEqual(got, expected) {
+		t.Errorf("Expected %+v, got %+v", expected, got)
+	}
+}
+
+// TestLoadTenants tests tenant config validation
+func TestLoadTenants(t *testing.T) {
+	testCases := []struct {
+		name    string
+		config  string
+		wantErr bool
+	}{
+		{"valid", `{"a":{"keys":["k1"],"checks":["smtp"],"suppressed":["@x.mock"]},"b":{"keys":["k2"]}}`, false},
+		{"key in two tenants", `{"a":{"keys":["k1"]},"b":{"keys":["k1"]}}`, true},
+		{"default tenant", `{"default":{"keys":["k1"]}}`, true},
+		{"unknown check", `{"a":{"keys":["k1"],"checks":["smpt"]}}`, true},
+		{"not json", `tenants`, true},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "tenants.json")
+			if err := os.WriteFile(path, []byte(tc.config), 0o644); err != nil {
+				t.Fatal(err)
+			}
+			_, err := LoadTenants(path)
+			if (err != nil) != tc.wantErr {
+				t.Errorf("Expected error: %v, got %v", tc.wantErr, err)
+			}
+		})
+	}
+}
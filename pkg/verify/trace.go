@@ -0,0 +1,162 @@
+package verify
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"slices"
+	"sync"
+	"time"
+
+	emailverifier "github.com/AfterShip/email-verifier"
+)
+
+// Trace records everything one verification did: each DNS query and its
+// answers, each SMTP probe and its outcome, and the result after every
+// stage. Pass one in Options.Trace to capture a problem verification.
+//
+// Probes made by the service's own SMTP client carry the transcript of
+// their sessions too; those of a Config.Prober are recorded by their
+// parameters and outcome only.
+type Trace struct {
+	mu     sync.Mutex
+	start  time.Time
+	DNS    []TraceDNS   `json:"dns"`
+	Probes []TraceProbe `json:"smtp_probes"`
+	Stages []TraceStage `json:"stages"`
+}
+
+// TraceDNS is one DNS query.
+type TraceDNS struct {
+	Type       string   `json:"type"`
+	Name       string   `json:"name"`
+	Answers    []string `json:"answers"`
+	Error      string   `json:"error,omitempty"`
+	StartedMS  float64  `json:"started_ms"`
+	DurationMS float64  `json:"duration_ms"`
+}
+
+// TraceProbe is one SMTP probe.
+type TraceProbe struct {
+	Profile    string              `json:"profile"`
+	Domain     string              `json:"domain"`
+	Username   string              `json:"username"`
+	CatchAll   bool                `json:"catch_all_probe"`
+	SMTP       *emailverifier.SMTP `json:"smtp,omitempty"`
+	Error      string              `json:"error,omitempty"`
+	StartedMS  float64             `json:"started_ms"`
+	DurationMS float64             `json:"duration_ms"`
+	Transcript []TraceSMTP         `json:"transcript,omitempty"`
+}
+
+// TraceSMTP is one line of a probe's SMTP session: a command the client
+// sent, or a line of the server's greeting or replies. The EHLO the client
+// repeats once STARTTLS has been negotiated isn't recorded.
+type TraceSMTP struct {
+	Host string `json:"host"`
+	From string `json:"from"` // "client" or "server"
+	Line string `json:"line"`
+}
+
+// TraceStage is the result as it stood when a stage finished.
+type TraceStage struct {
+	Stage     string  `json:"stage"`
+	ElapsedMS float64 `json:"elapsed_ms"`
+	Result    Result  `json:"result"`
+}
+
+// NewTrace starts a trace; times are measured from now.
+func NewTrace() *Trace {
+	return &Trace{start: time.Now(), DNS: []TraceDNS{}, Probes: []TraceProbe{}, Stages: []TraceStage{}}
+}
+
+// ms converts d to fractional milliseconds.
+func ms(d time.Duration) float64 { return float64(d.Microseconds()) / 1000 }
+
+func (t *Trace) addDNS(kind, name string, started time.Time, answers []string, err error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	entry := TraceDNS{Type: kind, Name: name, Answers: answers, StartedMS: ms(started.Sub(t.start)), DurationMS: ms(time.Since(started))}
+	if entry.Answers == nil {
+		entry.Answers = []string{}
+	}
+	if err != nil {
+		entry.Error = err.Error()
+	}
+	t.DNS = append(t.DNS, entry)
+}
+
+// progress wraps next so every stage is recorded before being reported.
+func (t *Trace) progress(next func(string, *Result) bool) func(string, *Result) bool {
+	return func(stage string, partial *Result) bool {
+		snapshot := *partial
+		snapshot.Warnings = slices.Clone(partial.Warnings)
+		snapshot.ChecksPerformed = slices.Clone(partial.ChecksPerformed)
+		t.mu.Lock()
+		t.Stages = append(t.Stages, TraceStage{Stage: stage, ElapsedMS: ms(time.Since(t.start)), Result: snapshot})
+		t.mu.Unlock()
+		return next == nil || next(stage, partial)
+	}
+}
+
+// prober wraps next so every probe is recorded, with the transcript next
+// left in report.
+func (t *Trace) prober(next Prober, report *probeReport) Prober {
+	return func(ctx context.Context, profile, domain, username string, catchAll bool) (*emailverifier.SMTP, error) {
+		started := time.Now()
+		smtp, err := next(ctx, profile, domain, username, catchAll)
+		t.mu.Lock()
+		defer t.mu.Unlock()
+		entry := TraceProbe{Profile: profile, Domain: domain, Username: username, CatchAll: catchAll, SMTP: smtp, StartedMS: ms(started.Sub(t.start)), DurationMS: ms(time.Since(started)), Transcript: report.transcript}
+		if err != nil {
+			entry.Error = err.Error()
+		}
+		t.Probes = append(t.Probes, entry)
+		return smtp, err
+	}
+}
+
+// ProbeObserver is told the duration and outcome of an SMTP probe that
+// reached the prober. err is what the prober returned.
+type ProbeObserver func(d time.Duration, err error)
+
+// observeProber wraps next so every probe is reported to observe.
+func observeProber(next Prober, observe ProbeObserver) Prober {
+	return func(ctx context.Context, profile, domain, username string, catchAll bool) (*emailverifier.SMTP, error) {
+		started := time.Now()
+		smtp, err := next(ctx, profile, domain, username, catchAll)
+		observe(time.Since(started), err)
+		return smtp, err
+	}
+}
+
+// tracingResolver records every query it passes to next.
+type tracingResolver struct {
+	next  Resolver
+	trace *Trace
+}
+
+func (r tracingResolver) LookupMX(ctx context.Context, name string) ([]*net.MX, error) {
+	started := time.Now()
+	mx, err := r.next.LookupMX(ctx, name)
+	answers := make([]string, len(mx))
+	for i, record := range mx {
+		answers[i] = fmt.Sprintf("%d %s", record.Pref, record.Host)
+	}
+	r.trace.addDNS("MX", name, started, answers, err)
+	return mx, err
+}
+
+func (r tracingResolver) LookupTXT(ctx context.Context, name string) ([]string, error) {
+	started := time.Now()
+	records, err := r.next.LookupTXT(ctx, name)
+	r.trace.addDNS("TXT", name, started, records, err)
+	return records, err
+}
+
+func (r tracingResolver) LookupHost(ctx context.Context, host string) ([]string, error) {
+	started := time.Now()
+	addrs, err := r.next.LookupHost(ctx, host)
+	r.trace.addDNS("A/AAAA", host, started, addrs, err)
+	return addrs, err
+}
@@ -0,0 +1,60 @@
+package verify
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"net/smtp"
+	"net/textproto"
+)
+
+// TransportInfo is how mail to the answering server would travel, with
+// Config.TLSCheck: whether it offers STARTTLS and, if it does, how the
+// negotiation went.
+type TransportInfo struct {
+	STARTTLS   bool   `json:"starttls_supported"`
+	TLSVersion string `json:"tls_version,omitempty"`
+	// CertValid is whether the server's certificate chains to a trusted
+	// root and names the host; unset if no TLS session came up.
+	CertValid *bool `json:"cert_valid,omitempty"`
+	// Error is why STARTTLS failed, if it did.
+	Error string `json:"tls_error,omitempty"`
+}
+
+// negotiateTLS upgrades client, which has said EHLO to host, to TLS if
+// the server offers STARTTLS, and reports how it went. The certificate is
+// checked after the handshake rather than during it, so an invalid one is
+// reported instead of failing the session. It also returns whether client
+// can still be used: a refused STARTTLS leaves the session in the clear,
+// but a failed handshake takes it down.
+func (c *SMTPClient) negotiateTLS(client *smtp.Client, host string) (*TransportInfo, bool) {
+	info := &TransportInfo{}
+	if info.STARTTLS, _ = client.Extension("STARTTLS"); !info.STARTTLS {
+		return info, true
+	}
+	config := &tls.Config{ServerName: host, InsecureSkipVerify: true, MinVersion: tls.VersionTLS10}
+	if err := client.StartTLS(config); err != nil {
+		info.Error = err.Error()
+		var reply *textproto.Error
+		return info, errors.As(err, &reply)
+	}
+	state, _ := client.TLSConnectionState()
+	info.TLSVersion = tls.VersionName(state.Version)
+	valid := verifyCertificate(state, host, c.tlsRoots)
+	info.CertValid = &valid
+	return info, true
+}
+
+// verifyCertificate reports whether the peer certificates of state chain
+// to roots, the system's if nil, and are valid for host.
+func verifyCertificate(state tls.ConnectionState, host string, roots *x509.CertPool) bool {
+	if len(state.PeerCertificates) == 0 {
+		return false
+	}
+	intermediates := x509.NewCertPool()
+	for _, cert := range state.PeerCertificates[1:] {
+		intermediates.AddCert(cert)
+	}
+	_, err := state.PeerCertificates[0].Verify(x509.VerifyOptions{DNSName: host, Roots: roots, Intermediates: intermediates})
+	return err == nil
+}
@@ -0,0 +1,148 @@
+package verify
+
+import (
+	"bufio"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"net"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"email-verifier/pkg/verify/verifytest"
+)
+
+// serveSTARTTLS answers SMTP sessions on a local port until the test
+// ends, offering STARTTLS with cert unless starttls is "none". "broken"
+// agrees to STARTTLS and then hangs up instead of shaking hands, and
+// "refused" turns it down. Every mailbox is accepted. It returns the port.
+func serveSTARTTLS(t *testing.T, cert tls.Certificate, starttls string) string {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { listener.Close() })
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				conn.Write([]byte("220 mx.test ESMTP\r\n"))
+				r := bufio.NewReader(conn)
+				for {
+					line, err := r.ReadString('\n')
+					if err != nil {
+						return
+					}
+					switch verb := strings.ToUpper(strings.Fields(line + " ")[0]); {
+					case verb == "EHLO" && starttls != "none":
+						conn.Write([]byte("250-mx.test\r\n250 STARTTLS\r\n"))
+					case verb == "STARTTLS" && starttls == "refused":
+						conn.Write([]byte("454 4.7.0 TLS not available\r\n"))
+					case verb == "STARTTLS":
+						conn.Write([]byte("220 Ready to start TLS\r\n"))
+						if starttls == "broken" {
+							return
+						}
+						tlsConn := tls.Server(conn, &tls.Config{Certificates: []tls.Certificate{cert}})
+						if tlsConn.Handshake() != nil {
+							return
+						}
+						conn, r = tlsConn, bufio.NewReader(tlsConn)
+					case verb == "QUIT":
+						conn.Write([]byte("221 Bye\r\n"))
+						return
+					default:
+						conn.Write([]byte("250 OK\r\n"))
+					}
+				}
+			}()
+		}
+	}()
+	_, port, _ := net.SplitHostPort(listener.Addr().String())
+	return port
+}
+
+// TestSMTPClientTLSCheck tests the transport report for each way STARTTLS can go, and that none of them stops the probe
+func TestSMTPClientTLSCheck(t *testing.T) {
+	server := httptest.NewTLSServer(nil)
+	defer server.Close()
+	cert := server.TLS.Certificates[0]
+	roots := x509.NewCertPool()
+	roots.AddCert(server.Certificate())
+	fake := verifytest.NewResolver()
+	fake.MX["acme.io"] = []*net.MX{{Host: "127.0.0.1", Pref: 10}}
+
+	testCases := []struct {
+		name      string
+		starttls  string
+		roots     *x509.CertPool
+		supported bool
+		version   bool
+		valid     *bool
+		failed    bool
+	}{
+		{"trusted", "ok", roots, true, true, &[]bool{true}[0], false},
+		{"untrusted", "ok", x509.NewCertPool(), true, true, &[]bool{false}[0], false},
+		{"not offered", "none", roots, false, false, nil, false},
+		{"refused", "refused", roots, true, false, nil, true},
+		{"broken handshake", "broken", roots, true, false, nil, true},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			client := NewSMTPClient(Profile{})
+			client.port = serveSTARTTLS(t, cert, tc.starttls)
+			client.tlsRoots = tc.roots
+			client.TLSCheck = true
+
+			smtp, report, err := client.check(context.Background(), fake, "acme.io", "jane", false)
+			if err != nil || !smtp.Deliverable {
+				t.Fatalf("Expected jane deliverable whatever TLS did, got %+v and %v", smtp, err)
+			}
+			transport := report.transport
+			if transport == nil || transport.STARTTLS != tc.supported || (transport.TLSVersion != "") != tc.version || (transport.Error != "") != tc.failed {
+				t.Fatalf("Expected starttls %v, got %+v", tc.supported, transport)
+			}
+			if (transport.CertValid == nil) != (tc.valid == nil) || (tc.valid != nil && *transport.CertValid != *tc.valid) {
+				t.Errorf("Expected cert_valid %v, got %v", tc.valid, transport.CertValid)
+			}
+			// The RCPT goes over TLS when it was negotiated, and over a new
+			// session when the handshake broke
+			transcript := report.transcript
+			if n := len(transcript); n < 2 || transcript[n-2] != (TraceSMTP{Host: "127.0.0.1", From: "client", Line: "RCPT TO:<jane@acme.io>"}) || transcript[n-1].Line != "250 OK" {
+				t.Errorf("Expected the transcript to end with the RCPT and its reply, got %+v", transcript)
+			}
+		})
+	}
+}
+
+// TestTransportOff tests that results have no transport section unless the TLS check is on, and that it leaves the verdict alone
+func TestTransportOff(t *testing.T) {
+	server := httptest.NewTLSServer(nil)
+	defer server.Close()
+	fake := verifytest.NewResolver()
+	fake.MX["acme.io"] = []*net.MX{{Host: "127.0.0.1", Pref: 10}}
+	port := serveSTARTTLS(t, server.TLS.Certificates[0], "ok")
+	build := func(p Profile) *SMTPClient {
+		client := NewSMTPClient(p)
+		client.port = port
+		return client
+	}
+
+	plain := newTestService(Config{Resolver: fake, BuildProfile: build}).Verify("jane@acme.io", Options{Checks: MustParseChecks(CheckSMTP)})
+	if plain.Transport != nil {
+		t.Errorf("Expected no transport section, got %+v", plain.Transport)
+	}
+	s := newTestService(Config{Resolver: fake, BuildProfile: func(p Profile) *SMTPClient {
+		client := build(p)
+		client.TLSCheck = true
+		return client
+	}})
+	if result := s.Verify("jane@acme.io", Options{Checks: MustParseChecks(CheckSMTP)}); result.Transport == nil || !result.Transport.STARTTLS || result.Verdict != plain.Verdict {
+		t.Errorf("Expected STARTTLS reported with the verdict unchanged from %s, got %+v (%s)", plain.Verdict, result.Transport, result.Verdict)
+	}
+}
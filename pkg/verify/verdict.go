@@ -0,0 +1,68 @@
+package verify
+
+// Overall verdicts.
+const (
+	VerdictDeliverable   = "deliverable"
+	VerdictRisky         = "risky"
+	VerdictUndeliverable = "undeliverable"
+	VerdictUnknown       = "unknown"
+	VerdictInvalid       = "invalid"
+)
+
+// Verdicts lists the verdicts, from best to worst.
+var Verdicts = []string{VerdictDeliverable, VerdictRisky, VerdictUndeliverable, VerdictUnknown, VerdictInvalid}
+
+// verdictFor summarizes a result into a single verdict, with the policies
+// that decided it when a soft signal did. Domains that exist but have no
+// mail service get the configured verdict, risky by default since some are
+// misconfigured rather than dead.
+func (s *Service) verdictFor(result *Result, policy resolvedPolicy) (string, []string) {
+	if !result.IsValid || result.ErrorCode == ErrCodeDomainBlocked {
+		return VerdictInvalid, nil
+	}
+	if result.Suppressed {
+		return VerdictUndeliverable, nil
+	}
+
+	switch result.DomainStatus {
+	case DomainNXDomain, DomainNullMX, DomainNonRoutable:
+		return VerdictUndeliverable, nil
+	case DomainNoMailService:
+		return s.noMailVerdict, nil
+	case DomainDNSError:
+		return VerdictUnknown, nil
+	}
+
+	// Soft signals outrank the mailbox probe: a catch-all server accepts
+	// every address, so a mailbox it accepts isn't confirmed
+	switch effect, reasons := policy.apply(result); effect {
+	case EffectUndeliverable:
+		return VerdictUndeliverable, reasons
+	case EffectRisky:
+		return VerdictRisky, reasons
+	}
+	return mailboxVerdict(result), nil
+}
+
+// mailboxVerdict is the verdict from the SMTP probe alone.
+func mailboxVerdict(result *Result) string {
+
+	// The server's own reason outranks the flattened reachable value
+	if details := result.SMTPDetails; details != nil {
+		switch details.Reason {
+		case SMTPReasonUserUnknown:
+			return VerdictUndeliverable
+		case SMTPReasonQuotaExceeded:
+			return VerdictRisky
+		}
+		return VerdictUnknown
+	}
+
+	switch result.Reachable {
+	case "yes":
+		return VerdictDeliverable
+	case "no":
+		return VerdictUndeliverable
+	}
+	return VerdictUnknown
+}
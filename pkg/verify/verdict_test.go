@@ -0,0 +1,139 @@
+package verify
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+)
+
+// TestVerdictFor tests the verdict derived from each combination of signals
+func TestVerdictFor(t *testing.T) {
+	testCases := []struct {
+		name     string
+		result   Result
+		expected string
+	}{
+		{"invalid syntax", Result{IsValid: false}, VerdictInvalid},
+		{"nxdomain", Result{IsValid: true, DomainStatus: DomainNXDomain}, VerdictUndeliverable},
+		{"null mx", Result{IsValid: true, DomainStatus: DomainNullMX}, VerdictUndeliverable},
+		{"no mail service", Result{IsValid: true, DomainStatus: DomainNoMailService}, VerdictRisky},
+		{"dns error", Result{IsValid: true, DomainStatus: DomainDNSError}, VerdictUnknown},
+		{"disposable", Result{IsValid: true, Disposable: true}, VerdictRisky},
+		{"reachable", Result{IsValid: true, DomainStatus: DomainHasMail, Reachable: "yes"}, VerdictDeliverable},
+		{"unreachable", Result{IsValid: true, DomainStatus: DomainHasMail, Reachable: "no"}, VerdictUndeliverable},
+		{"user unknown", Result{IsValid: true, DomainStatus: DomainHasMail, SMTPDetails: &SMTPDetails{Reason: SMTPReasonUserUnknown}}, VerdictUndeliverable},
+		{"quota exceeded", Result{IsValid: true, DomainStatus: DomainHasMail, SMTPDetails: &SMTPDetails{Reason: SMTPReasonQuotaExceeded}}, VerdictRisky},
+		{"policy rejection", Result{IsValid: true, DomainStatus: DomainHasMail, SMTPDetails: &SMTPDetails{Reason: SMTPReasonPolicyRejection}}, VerdictUnknown},
+		{"smtp unknown", Result{IsValid: true, DomainStatus: DomainHasMail, Reachable: "unknown"}, VerdictUnknown},
+	}
+
+	s := newTestService(Config{})
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			if got, _ := s.verdictFor(&tc.result, s.policyFor(Options{})); got != tc.expected {
+				t.Errorf("Expected verdict %s, got %s", tc.expected, got)
+			}
+		})
+	}
+}
+
+// TestVerdictPolicyMatrix tests every signal under every effect
+func TestVerdictPolicyMatrix(t *testing.T) {
+	raise := map[string]func(*Result){
+		SignalDisposable:  func(r *Result) { r.Disposable = true },
+		SignalRoleAccount: func(r *Result) { r.RoleAccount = true },
+		SignalFree:        func(r *Result) { r.Free = true },
+		SignalCatchAll:    func(r *Result) { r.CatchAll = true },
+		SignalLookalike:   func(r *Result) { r.Suggestion = "gmail.com" },
+		SignalRandomLocal: func(r *Result) { r.Warnings = []string{WarningRandomLocalPart} },
+		// No check raises it yet, so no effect changes the verdict
+		SignalRecentlyReg: func(r *Result) {},
+	}
+	effects := map[string]string{
+		EffectIgnore:        VerdictDeliverable,
+		EffectRisky:         VerdictRisky,
+		EffectUndeliverable: VerdictUndeliverable,
+	}
+
+	for _, signal := range Signals {
+		for effect, expected := range effects {
+			t.Run(signal+"/"+effect, func(t *testing.T) {
+				s := newTestService(Config{Policies: PolicyConfig{Global: VerdictPolicy{signal: effect}}})
+				result := Result{IsValid: true, DomainStatus: DomainHasMail, Reachable: "yes"}
+				raise[signal](&result)
+
+				verdict, reasons := s.verdictFor(&result, s.policyFor(Options{}))
+				if signal == SignalRecentlyReg {
+					expected = VerdictDeliverable
+				}
+				if verdict != expected {
+					t.Errorf("Expected verdict %s, got %s", expected, verdict)
+				}
+				reason := "global policy: " + signal + "=" + effect
+				if want := expected != VerdictDeliverable; slices.Contains(reasons, reason) != want {
+					t.Errorf("Expected reason %q present=%v, got %v", reason, want, reasons)
+				}
+			})
+		}
+	}
+}
+
+// TestVerdictPolicyLayers tests that key policies override profile policies, which override the global one
+func TestVerdictPolicyLayers(t *testing.T) {
+	s := newTestService(Config{Policies: PolicyConfig{
+		Global:   VerdictPolicy{SignalRoleAccount: EffectRisky, SignalDisposable: EffectUndeliverable},
+		Profiles: map[string]VerdictPolicy{"relaxed": {SignalRoleAccount: EffectIgnore}},
+		Keys:     map[string]VerdictPolicy{"strict-key": {SignalRoleAccount: EffectUndeliverable}},
+	}})
+	testCases := []struct {
+		name    string
+		opts    Options
+		result  Result
+		verdict string
+		reasons []string
+	}{
+		{"global", Options{Key: "other"}, Result{RoleAccount: true}, VerdictRisky, []string{"global policy: role_account=mark_risky"}},
+		{"profile", Options{Key: "other", Profile: "relaxed"}, Result{RoleAccount: true}, VerdictDeliverable, nil},
+		{"key", Options{Key: "strict-key", Profile: "relaxed"}, Result{RoleAccount: true}, VerdictUndeliverable, []string{"key policy: role_account=mark_undeliverable"}},
+		{"default", Options{}, Result{CatchAll: true}, VerdictRisky, []string{"default policy: catch_all=mark_risky"}},
+		{"strongest wins", Options{}, Result{RoleAccount: true, Disposable: true}, VerdictUndeliverable, []string{"global policy: disposable=mark_undeliverable"}},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			tc.result.IsValid, tc.result.DomainStatus, tc.result.Reachable = true, DomainHasMail, "yes"
+			verdict, reasons := s.verdictFor(&tc.result, s.policyFor(tc.opts))
+			if verdict != tc.verdict || !slices.Equal(reasons, tc.reasons) {
+				t.Errorf("Expected %s %v, got %s %v", tc.verdict, tc.reasons, verdict, reasons)
+			}
+		})
+	}
+}
+
+// TestLoadPolicyConfig tests that unknown signals and effects are rejected at load
+func TestLoadPolicyConfig(t *testing.T) {
+	testCases := []struct {
+		name    string
+		config  string
+		wantErr string
+	}{
+		{"valid", `{"global": {"free": "mark_risky"}, "keys": {"k": {"disposable": "mark_undeliverable"}}}`, ""},
+		{"unknown signal", `{"global": {"spammy": "mark_risky"}}`, `global policy: unknown signal "spammy"`},
+		{"unknown effect", `{"profiles": {"p": {"free": "block"}}}`, `profile "p" policy: signal "free": unknown effect "block"`},
+		{"malformed", `{"global": []}`, "parse policy config"},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "policy.json")
+			os.WriteFile(path, []byte(tc.config), 0o600)
+			_, err := LoadPolicyConfig(path)
+			switch {
+			case tc.wantErr == "" && err != nil:
+				t.Errorf("Expected no error, got %v", err)
+			case tc.wantErr != "" && (err == nil || !strings.Contains(err.Error(), tc.wantErr)):
+				t.Errorf("Expected error containing %q, got %v", tc.wantErr, err)
+			}
+		})
+	}
+}
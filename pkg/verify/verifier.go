@@ -0,0 +1,127 @@
+package verify
+
+import (
+	"context"
+	"errors"
+	"log"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	emailverifier "github.com/AfterShip/email-verifier"
+)
+
+// verifierState is one attempt at building the verifier. Exactly one of
+// verifier and err is set.
+type verifierState struct {
+	verifier *emailverifier.Verifier
+	err      error
+	loadedAt time.Time // when verifier was built
+}
+
+// verifierHolder owns a Service's list verifier. It is built on first use,
+// and a failed build is remembered so readiness checks and API calls can
+// report it instead of misbehaving. Swaps are atomic: a request keeps the
+// verifier it started with even if a reload lands mid-flight.
+type verifierHolder struct {
+	state    atomic.Pointer[verifierState]
+	initOnce sync.Once
+	reloadMu sync.Mutex
+	build    func() (*emailverifier.Verifier, error)
+}
+
+func newVerifierHolder(build func() (*emailverifier.Verifier, error)) *verifierHolder {
+	return &verifierHolder{build: build}
+}
+
+// NewListVerifier creates the verifier used for syntax, list and suggestion
+// checks and makes sure its built-in data loaded. SMTP probes use the
+// per-profile verifiers instead (see profiles.go).
+func NewListVerifier() (*emailverifier.Verifier, error) {
+	return newListVerifier(true)
+}
+
+// newListVerifier builds the list verifier, fetching and scheduling
+// disposable list updates only if autoUpdate is set.
+func newListVerifier(autoUpdate bool) (*emailverifier.Verifier, error) {
+	v := emailverifier.NewVerifier().EnableDomainSuggest()
+	if autoUpdate {
+		v.EnableAutoUpdateDisposable()
+	}
+
+	if !v.ParseAddress("self-test@example.com").Valid {
+		v.DisableAutoUpdateDisposable()
+		return nil, errors.New("address parser self-test failed")
+	}
+	if !v.IsDisposable("mailinator.com") || !v.IsFreeDomain("gmail.com") {
+		v.DisableAutoUpdateDisposable()
+		return nil, errors.New("disposable or free provider lists failed to load")
+	}
+	return v, nil
+}
+
+// Get returns the current verifier, building it on first use.
+func (h *verifierHolder) Get() (*emailverifier.Verifier, error) {
+	h.initOnce.Do(func() {
+		if h.state.Load() == nil {
+			h.Reload()
+		}
+	})
+	state := h.state.Load()
+	return state.verifier, state.err
+}
+
+// Reload builds a new verifier and swaps it in. If the build fails, the
+// current verifier (if any) keeps serving and the error is returned.
+func (h *verifierHolder) Reload() error {
+	h.reloadMu.Lock()
+	defer h.reloadMu.Unlock()
+
+	v, err := h.build()
+	old := h.state.Load()
+	if err != nil {
+		if old == nil || old.verifier == nil {
+			h.state.Store(&verifierState{err: err})
+		}
+		return err
+	}
+	h.state.Store(&verifierState{verifier: v, loadedAt: time.Now()})
+	if old != nil && old.verifier != nil {
+		// Requests still holding old only use its in-memory lists, which
+		// keep working; its update schedule is no longer needed.
+		old.verifier.DisableAutoUpdateDisposable()
+	}
+	return nil
+}
+
+// LoadedAt returns when the current verifier was built, or false if none
+// has been.
+func (h *verifierHolder) LoadedAt() (time.Time, bool) {
+	state := h.state.Load()
+	if state == nil || state.verifier == nil {
+		return time.Time{}, false
+	}
+	return state.loadedAt, true
+}
+
+// Retry keeps rebuilding a verifier that failed to initialize, backing off
+// from min to max, until one builds or ctx is cancelled.
+func (h *verifierHolder) Retry(ctx context.Context, min, max time.Duration) {
+	delay := min
+	for {
+		if _, err := h.Get(); err == nil {
+			return
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(delay):
+		}
+		if err := h.Reload(); err != nil {
+			log.Printf("verifier: initialization failed, retrying in %v: %v", delay, err)
+		}
+		if delay *= 2; delay > max {
+			delay = max
+		}
+	}
+}
@@ -0,0 +1,99 @@
+package verify
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	emailverifier "github.com/AfterShip/email-verifier"
+)
+
+// flakyBuilder fails the first failures builds and then succeeds
+func flakyBuilder(failures int32) (func() (*emailverifier.Verifier, error), *atomic.Int32) {
+	var calls atomic.Int32
+	return func() (*emailverifier.Verifier, error) {
+		if calls.Add(1) <= failures {
+			return nil, errors.New("disposable list failed to load")
+		}
+		return emailverifier.NewVerifier(), nil
+	}, &calls
+}
+
+// TestVerifierRetryRecovers tests that background retries eventually initialize the verifier
+func TestVerifierRetryRecovers(t *testing.T) {
+	build, calls := flakyBuilder(3)
+	h := newVerifierHolder(build)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	h.Retry(ctx, time.Millisecond, 4*time.Millisecond)
+
+	if _, err := h.Get(); err != nil {
+		t.Fatalf("Expected verifier after retries, got %v", err)
+	}
+	if n := calls.Load(); n != 4 {
+		t.Errorf("Expected 4 build attempts, got %d", n)
+	}
+}
+
+// TestVerifierReloadKeepsWorkingVerifier tests that a failed reload doesn't replace a good verifier
+func TestVerifierReloadKeepsWorkingVerifier(t *testing.T) {
+	fail := atomic.Bool{}
+	h := newVerifierHolder(func() (*emailverifier.Verifier, error) {
+		if fail.Load() {
+			return nil, errors.New("boom")
+		}
+		return emailverifier.NewVerifier(), nil
+	})
+
+	before, err := h.Get()
+	if err != nil {
+		t.Fatal(err)
+	}
+	fail.Store(true)
+	if err := h.Reload(); err == nil {
+		t.Error("Expected reload error")
+	}
+	after, err := h.Get()
+	if err != nil || after != before {
+		t.Errorf("Expected original verifier to keep serving, got %v (err %v)", after, err)
+	}
+}
+
+// TestVerifierConcurrentSwap tests swapping the verifier while requests use it (run with -race)
+func TestVerifierConcurrentSwap(t *testing.T) {
+	s := New(Config{BuildVerifier: func() (*emailverifier.Verifier, error) {
+		return emailverifier.NewVerifier(), nil
+	}})
+
+	stop := make(chan struct{})
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				select {
+				case <-stop:
+					return
+				default:
+				}
+				if result := s.Verify("not-an-address", Options{Checks: DefaultChecks}); result.Verdict != VerdictInvalid {
+					t.Errorf("Expected invalid verdict, got %q", result.Verdict)
+					return
+				}
+			}
+		}()
+	}
+
+	for i := 0; i < 50; i++ {
+		if err := s.Reload(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	close(stop)
+	wg.Wait()
+}
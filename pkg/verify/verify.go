@@ -0,0 +1,687 @@
+// Package verify checks whether email addresses can receive mail: syntax,
+// free and disposable providers, role accounts, typo suggestions, the
+// domain's mail setup and, optionally, an SMTP probe of the mailbox.
+//
+// It has no HTTP dependencies; the email-verifier server is a thin adapter
+// over Service, and other programs can import it directly.
+package verify
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	emailverifier "github.com/AfterShip/email-verifier"
+)
+
+// Result is the outcome of verifying one address. Its JSON form is the
+// server's response body.
+type Result struct {
+	Email string `json:"email"`
+	// Ref is the address reference the result was requested by, in which
+	// case Email and Username are usually left out.
+	Ref       string `json:"ref,omitempty"`
+	IsValid   bool   `json:"is_valid"`
+	Reachable string `json:"reachable"`
+	// ReachableReason explains Reachable with a stable code, one of
+	// ReachableReasons.
+	ReachableReason string `json:"reachable_reason"`
+	Verdict         string `json:"verdict"`
+	// VerdictReasons names the policies behind a verdict set by a soft
+	// signal, such as "default policy: disposable=mark_risky".
+	VerdictReasons []string `json:"verdict_reasons,omitempty"`
+	// Score rates the address from 0 to 100 for callers to threshold on,
+	// and RiskFlags names what cost it points; see ScoreWeights.
+	Score     int      `json:"score"`
+	RiskFlags []string `json:"risk_flags"`
+
+	Disposable   bool `json:"disposable"`
+	RoleAccount  bool `json:"role_account"`
+	Free         bool `json:"free"`
+	HasMxRecords bool `json:"has_mx_records"`
+	// MX lists the domain's mail exchangers by preference. NullMX is set
+	// for a domain that publishes the RFC 7505 null MX, which accepts no
+	// mail. DNSError says why the domain's lookup came to nothing, as a
+	// DNSErrorKind: nxdomain for a domain that doesn't exist, or servfail,
+	// refused, timeout or error for a lookup that failed, as opposed to a
+	// domain with no MX records.
+	MX     []MXRecord `json:"mx,omitempty"`
+	NullMX bool       `json:"null_mx,omitempty"`
+	// MXFallbackA is set for a domain without MX records that resolves to
+	// an address, which is probed in their place as RFC 5321's implicit
+	// MX. If it answers, DomainStatus is has_mail; HasMxRecords stays
+	// false.
+	MXFallbackA bool   `json:"mx_fallback_a,omitempty"`
+	DNSError    string `json:"dns_error,omitempty"`
+	CatchAll    bool   `json:"catch_all,omitempty"`
+	// CatchAllCached is set when the domain's catch-all status came from
+	// the domain cache rather than a probe.
+	CatchAllCached bool `json:"catch_all_cached,omitempty"`
+	// CatchAllConfidence grades CatchAll by how many of the catch-all
+	// probe's random mailboxes were accepted: CatchAllConfirmed,
+	// CatchAllLikely or CatchAllNo. It is empty when the probe didn't
+	// get that far.
+	CatchAllConfidence string `json:"catch_all_confidence,omitempty"`
+	Suppressed         bool   `json:"suppressed,omitempty"`
+	DomainStatus       string `json:"domain_status,omitempty"`
+	DomainReason       string `json:"domain_reason,omitempty"`
+	LegacyFormat       string `json:"legacy_format,omitempty"`
+	Suggestion         string `json:"suggestion,omitempty"`
+	// SuggestionResult is the verification of Username at Suggestion,
+	// with Options.VerifySuggestion. Its cost is part of CostUnits.
+	SuggestionResult *Result `json:"suggestion_result,omitempty"`
+	// LocalPartRandomness scores how machine-generated the local part
+	// looks, from 0 to 1; see LocalPartRandomness.
+	LocalPartRandomness float64 `json:"local_part_randomness,omitempty"`
+	// Error is ErrorMessage, kept for older clients.
+	Error        string       `json:"error,omitempty"`
+	ErrorCode    string       `json:"error_code,omitempty"`
+	ErrorMessage string       `json:"error_message,omitempty"`
+	SMTPDetails  *SMTPDetails `json:"smtp_details,omitempty"`
+	// Attempts counts the tries of the SMTP probe that answered, retries
+	// of transient failures included; see Config.SMTPRetry.
+	Attempts int `json:"attempts,omitempty"`
+	// SMTPHost is the mail server that gave the probe's answer, which
+	// need not be the most preferred MX if that one couldn't be reached.
+	SMTPHost string `json:"smtp_host,omitempty"`
+	// SMTPAddressFamily is whether SMTPHost was reached over
+	// AddressFamilyIPv4 or AddressFamilyIPv6; see Config.SMTPIPPreference.
+	SMTPAddressFamily string `json:"smtp_address_family,omitempty"`
+	// SMTPBanner is the text of SMTPHost's 220 greeting.
+	SMTPBanner string `json:"smtp_banner,omitempty"`
+	// MailProvider names the provider behind the domain's mail servers,
+	// such as "google-workspace" or MailProviderSelfHosted, from the MX
+	// hosts and SMTPBanner; see Config.MailProviders.
+	MailProvider string `json:"mail_provider,omitempty"`
+	// Transport is whether SMTPHost offers STARTTLS and how negotiating
+	// it went, with Config.TLSCheck. It has no bearing on the verdict.
+	Transport *TransportInfo `json:"transport,omitempty"`
+	// SMTPSkippedReason says why the smtp check was left out although it
+	// was asked for, as SMTPSkippedAllowlisted or SMTPSkippedSMTPUTF8.
+	SMTPSkippedReason string `json:"smtp_skipped_reason,omitempty"`
+	// DisplayName is the name the address was submitted with, as in
+	// "Jane Doe <jane@example.com>"; Email is then the bare address.
+	DisplayName string `json:"display_name,omitempty"`
+	Username    string `json:"username,omitempty"`
+	Domain      string `json:"domain,omitempty"`
+	// ASCIIDomain is Domain in the ASCII (punycode) form it is looked up
+	// by. RequiresSMTPUTF8 is set for a local part with non-ASCII
+	// characters, which only servers with SMTPUTF8 accept.
+	ASCIIDomain      string `json:"ascii_domain,omitempty"`
+	RequiresSMTPUTF8 bool   `json:"requires_smtputf8,omitempty"`
+	// NormalizedEmail is the address the inbox is known by, so
+	// j.ohn+promo@gmail.com is john@gmail.com; see Service.NormalizeEmail.
+	// IsSubaddressed is set when a subaddress tag was dropped from it.
+	NormalizedEmail string `json:"normalized_email,omitempty"`
+	IsSubaddressed  bool   `json:"is_subaddressed,omitempty"`
+	RetryToken      string `json:"retry_token,omitempty"`
+	RetryAfter      int    `json:"retry_after,omitempty"`
+	// Deferred is set when the server or the probing etiquette put the
+	// answer off; verifying again after RetryAfter seconds may get one.
+	Deferred bool          `json:"deferred,omitempty"`
+	Warnings []string      `json:"warnings,omitempty"`
+	Envelope *EnvelopeInfo `json:"envelope,omitempty"`
+	// DNS is only set with CheckAuthRecords.
+	DNS *DNSRecords `json:"dns,omitempty"`
+	// Gravatar is only set with CheckGravatar.
+	Gravatar *Gravatar `json:"gravatar,omitempty"`
+	// Cached is set on a result answered from an earlier verification,
+	// done at VerifiedAt, rather than by verifying again.
+	Cached     bool       `json:"cached,omitempty"`
+	VerifiedAt *time.Time `json:"verified_at,omitempty"`
+
+	ChecksPerformed []string `json:"checks_performed"`
+	ChecksSkipped   []string `json:"checks_skipped"`
+	CostUnits       int      `json:"cost_units"`
+}
+
+// Values of Result.Reachable: whether the mailbox was confirmed to accept
+// mail.
+const (
+	ReachableYes     = "yes"
+	ReachableNo      = "no"
+	ReachableUnknown = "unknown"
+)
+
+// Options are the per-request settings for a verification.
+type Options struct {
+	Checks  CheckSet
+	Key     string // API key, by name when keys are required; it selects the verifier profile
+	Profile string // overrides the key's profile, for shadow runs
+
+	// Progress, if set, is called as each stage of the verification
+	// completes, with the result so far; partial is only valid during the
+	// call. Returning false skips the remaining stages. Stages the
+	// verification doesn't reach are not reported.
+	Progress func(stage string, partial *Result) bool
+	// Trace, if set, records the verification's DNS queries, probes and
+	// stages.
+	Trace *Trace
+	// Context, if set, bounds the verification. Once it is done, the
+	// stages not yet reached are skipped, a probe in flight is cut off,
+	// and the result so far carries ErrCodeDeadlineExceeded.
+	Context context.Context
+	// VerifySuggestion, if set, also verifies the address a typo
+	// suggestion points at, under the same options and deadline, into
+	// Result.SuggestionResult. That verification doesn't verify its own
+	// suggestion.
+	VerifySuggestion bool
+
+	facts *domainFacts // precomputed by VerifyBatch
+}
+
+// Verification stages reported to Options.Progress, in order.
+const (
+	StageSyntax = "syntax"
+	StageLists  = "lists"
+	StageDNS    = "dns"
+	StageSMTP   = "smtp"
+)
+
+// probeInfo is how a probe was answered.
+type probeInfo struct {
+	reused   bool        // the etiquette answered with an earlier probe's result
+	attempts int         // tries made, retries included
+	report   probeReport // what the prober told beyond its result
+}
+
+// probe runs the prober under opts' profile, through the domain's circuit
+// and the probing etiquette, retrying transient failures as
+// Config.SMTPRetry says and recording into opts.Trace if set. A probe
+// cut short by opts.Context ending returns the context's error and counts
+// against neither the circuit nor the etiquette's memory of the address.
+func (s *Service) probe(opts Options, domain, username string, catchAll bool) (*emailverifier.SMTP, probeInfo, error) {
+	ctx := opts.context()
+	profile := opts.profile()
+	var info probeInfo
+	if err := s.circuits.allow(domain); err != nil {
+		return nil, info, err
+	}
+	prober := s.proberFor(&info.report)
+	if opts.Trace != nil {
+		prober = opts.Trace.prober(prober, &info.report)
+	}
+	prober = s.retryProber(prober, &info.attempts)
+	run := func() (*emailverifier.SMTP, error) {
+		smtp, err := prober(ctx, profile, domain, username, catchAll)
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		return smtp, err
+	}
+	if s.polite == nil || s.networkDisabled.Load() {
+		smtp, err := run()
+		if ctx.Err() == nil {
+			s.circuits.record(domain, smtp, err)
+		}
+		return smtp, info, err
+	}
+	smtp, reused, err := s.polite.probe(domain, username, run)
+	info.reused = reused
+	if !reused && ctx.Err() == nil {
+		s.circuits.record(domain, smtp, err)
+	}
+	return smtp, info, err
+}
+
+// resolverFor returns the service's resolver, recording into opts.Trace if
+// set.
+func (s *Service) resolverFor(opts Options) Resolver {
+	if opts.Trace == nil {
+		return s.resolver
+	}
+	return tracingResolver{next: s.resolver, trace: opts.Trace}
+}
+
+// progress reports stage to opts.Progress and says whether to go on.
+func (o Options) progress(stage string, partial *Result) bool {
+	return o.Progress == nil || o.Progress(stage, partial)
+}
+
+// context returns opts.Context, or a context that never ends.
+func (o Options) context() context.Context {
+	if o.Context != nil {
+		return o.Context
+	}
+	return context.Background()
+}
+
+// expired records ErrCodeDeadlineExceeded on result once opts.Context is
+// done, and reports whether it was.
+func (s *Service) expired(result *Result, opts Options) bool {
+	err := opts.context().Err()
+	if err == nil {
+		return false
+	}
+	s.setError(result, ErrCodeDeadlineExceeded, err)
+	return true
+}
+
+// profile is the name SMTP probes acquire their profile lease under.
+func (o Options) profile() string {
+	if o.Profile != "" {
+		return o.Profile
+	}
+	return o.Key
+}
+
+// verifySuggestion fills in result.SuggestionResult if opts ask for it
+// and result has a suggestion. It goes one level deep: the suggested
+// address's own suggestion is not verified.
+func (s *Service) verifySuggestion(result *Result, opts Options) {
+	if !opts.VerifySuggestion || result.Suggestion == "" || result.Username == "" {
+		return
+	}
+	opts.VerifySuggestion = false
+	opts.Progress, opts.Trace, opts.facts = nil, nil, nil
+	result.SuggestionResult = s.Verify(result.Username+"@"+result.Suggestion, opts)
+	result.CostUnits += result.SuggestionResult.CostUnits
+}
+
+// Verify runs the requested checks against email. Checks that could not run,
+// because they weren't requested or an earlier step ended verification, are
+// listed in ChecksSkipped.
+func (s *Service) Verify(email string, opts Options) (result *Result) {
+	checks := s.allowedChecks(opts.Checks)
+	opts.Checks = checks
+	s.inFlight.Add(1)
+	defer s.inFlight.Add(-1)
+	if s.verifyTimeout > 0 {
+		ctx, cancel := context.WithTimeout(opts.context(), s.verifyTimeout)
+		defer cancel()
+		opts.Context = ctx
+	}
+
+	email, warnings := NormalizeInput(email)
+	result = &Result{
+		Email:           email,
+		Reachable:       ReachableUnknown,
+		Warnings:        warnings,
+		ChecksPerformed: []string{},
+	}
+	if s.NetworkDisabled() && checks.NeedsNetwork() {
+		// Network checks short-circuit while the kill-switch is engaged
+		checks = checks.WithoutNetwork()
+		opts.Checks = checks
+		result.Warnings = append(result.Warnings, WarningNetworkDisabled)
+	}
+	if s.SMTPOutboundBlocked() && checks.Has(CheckSMTP) {
+		result.Warnings = append(result.Warnings, WarningSMTPOutboundBlocked)
+	}
+	if opts.Trace != nil {
+		opts.Progress = opts.Trace.progress(opts.Progress)
+	}
+	// Domain facts are shared by every address at the domain, so batches
+	// look them up once and pass them in
+	facts := opts.facts
+	defer func() {
+		result.Verdict, result.VerdictReasons = s.verdictFor(result, s.policyFor(opts))
+		result.ReachableReason = reachableReasonFor(result)
+		result.Score, result.RiskFlags = scoreFor(result, s.scoreWeights)
+		result.ChecksSkipped = skippedChecks(result.ChecksPerformed)
+		result.CostUnits = s.costs.charge(result.ChecksPerformed, facts.reused())
+		s.verifySuggestion(result, opts)
+	}()
+
+	// Basic validation first
+	if email == "" {
+		s.setError(result, ErrCodeEmailRequired, nil)
+		return result
+	}
+
+	verifier, err := s.verifiers.Get()
+	if err != nil {
+		s.setError(result, ErrCodeVerifierUnavailable, err)
+		return result
+	}
+
+	// "Jane Doe <jane@example.com>" is verified by its bare address
+	if address, name, count := splitDisplayName(email); count > 1 {
+		result.ran(CheckSyntax)
+		s.setError(result, ErrCodeMultipleAddresses, nil)
+		result.Error = fmt.Sprintf("Invalid email address format: found %d addresses, expected one", count)
+		result.ErrorMessage = result.Error
+		return result
+	} else if count == 1 {
+		email, result.Email, result.DisplayName = address, address, name
+	}
+
+	// Legacy routing forms are verified by their final mailbox
+	if legacy, ok := parseLegacyAddress(email); ok {
+		result.LegacyFormat = legacy.Form
+		if s.legacyAddresses == LegacyReject || legacy.Mailbox == "" {
+			code := ErrCodeAmbiguousLegacyRoute
+			if s.legacyAddresses == LegacyReject {
+				code = ErrCodeLegacyNotAccepted
+			}
+			result.ran(CheckSyntax)
+			s.setError(result, code, nil)
+			return result
+		}
+		result.Warnings = append(result.Warnings, WarningLegacyRoutingForm)
+		email = legacy.Mailbox
+	}
+
+	// Address literals and non-routable domains are classified without DNS
+	if addr, ok := classifySpecialAddress(email); ok {
+		s.verifySpecial(verifier, result, addr, opts)
+		return result
+	}
+
+	// Parse and validate syntax
+	addr := parseAddress(verifier, email)
+	syntax := addr.Syntax
+	result.Username = syntax.Username
+	result.Domain = addr.WrittenDomain
+	result.IsValid = syntax.Valid
+	result.ran(CheckSyntax)
+
+	if !syntax.Valid {
+		s.setError(result, ErrCodeInvalidSyntax, nil)
+		return result
+	}
+	result.ASCIIDomain = syntax.Domain
+	result.NormalizedEmail, result.IsSubaddressed = s.NormalizeEmail(syntax.Username + "@" + syntax.Domain)
+	result.RequiresSMTPUTF8 = addr.SMTPUTF8
+	result.Warnings = append(result.Warnings, homographWarnings(syntax.Domain)...)
+	warnCase(result, syntax.Username)
+	result.LocalPartRandomness = LocalPartRandomness(syntax.Username)
+	if result.LocalPartRandomness > s.randomnessThreshold {
+		result.Warnings = append(result.Warnings, WarningRandomLocalPart)
+	}
+	if !opts.progress(StageSyntax, result) {
+		return result
+	}
+
+	if s.blockedDomains.match(syntax.Domain) {
+		result.IsValid = false
+		s.setError(result, ErrCodeDomainBlocked, nil)
+		return result
+	}
+
+	// Suppressed addresses are answered from the tenant's lists alone
+	tenant := s.keyTenants[opts.Key]
+	if s.isSuppressed(tenant, syntax.Username, syntax.Domain) {
+		result.Suppressed = true
+		return result
+	}
+
+	// Alone, the DNS lookup waits until the list stage has been reported
+	lookupDNS := facts == nil
+	if lookupDNS {
+		facts = s.lookupDomainFacts(opts.context(), verifier, syntax.Domain, checks.WithoutNetwork(), tenant)
+	}
+
+	if checks.Has(CheckFree) {
+		result.Free = facts.Free
+		result.ran(CheckFree)
+	}
+	if checks.Has(CheckRole) {
+		result.RoleAccount = s.isRole(verifier, syntax.Username, tenant)
+		result.ran(CheckRole)
+	}
+	if checks.Has(CheckDisposable) {
+		result.Disposable = facts.Disposable
+		result.ran(CheckDisposable)
+	}
+
+	// Disposable domains are not worth probing
+	if !result.Disposable && checks.Has(CheckSuggest) {
+		result.Suggestion = facts.Suggestion
+		result.ran(CheckSuggest)
+	}
+	if !opts.progress(StageLists, result) || result.Disposable || !checks.Has(CheckMX) {
+		return result
+	}
+
+	// Classify the domain's mail setup. A lookup cut short by the
+	// deadline is no answer, so the check isn't recorded.
+	if s.expired(result, opts) {
+		return result
+	}
+	if lookupDNS {
+		s.domainStatus(opts.context(), s.resolverFor(opts), syntax.Domain, facts)
+		s.dnsRecords(opts.context(), s.resolverFor(opts), syntax.Domain, checks, facts)
+	}
+	if s.expired(result, opts) {
+		return result
+	}
+	result.DomainStatus = facts.Status
+	result.HasMxRecords = facts.Status == DomainHasMail
+	result.MX = facts.MX
+	result.MailProvider = s.mailProviders.detect(syntax.Domain, mxHostNames(facts.MX), "")
+	if facts.DNS != nil {
+		records := *facts.DNS
+		result.DNS = &records
+	}
+	if result.NullMX = facts.Status == DomainNullMX; result.NullMX {
+		result.Reachable = ReachableNo
+	}
+	if facts.Status == DomainNXDomain {
+		result.DNSError = DNSErrorNXDomain
+	}
+	result.MXFallbackA = facts.Status == DomainNoMailService && !s.mxFallbackDisabled
+	result.ran(CheckMX)
+	if facts.DNS != nil {
+		for _, check := range dnsChecks {
+			if checks.Has(check) {
+				result.ran(check)
+			}
+		}
+	}
+	s.checkGravatar(verifier, result, email, opts)
+	if err := facts.StatusErr; err != nil {
+		result.DNSError = DNSErrorKind(err)
+		s.setError(result, ErrorCodeFor(err), err)
+		s.markRetryable(result, err)
+		return result
+	}
+	if !opts.progress(StageDNS, result) || (facts.Status != DomainHasMail && !result.MXFallbackA) || !checks.Has(CheckSMTP) {
+		return result
+	}
+	if isSpecialUse(syntax.Domain) {
+		result.Warnings = append(result.Warnings, WarningSpecialUseNotProbed)
+		return result
+	}
+	if s.skipSMTPDomains.match(syntax.Domain) {
+		result.SMTPSkippedReason = SMTPSkippedAllowlisted
+		// Only an MX vouches for the domain; an A record fallback
+		// leaves reachable unknown
+		if facts.Status == DomainHasMail {
+			result.Reachable = ReachableYes
+		}
+		return result
+	}
+	if addr.SMTPUTF8 {
+		result.SMTPSkippedReason = SMTPSkippedSMTPUTF8
+		return result
+	}
+	if s.expired(result, opts) {
+		return result
+	}
+
+	// Probe the mail server. When the domain's catch-all status is already
+	// known, only the mailbox itself needs checking, and catch-all domains
+	// can't confirm mailboxes at all.
+	var smtp *emailverifier.SMTP
+	var info probeInfo
+	var confidence string
+	if lookupDNS && !s.catchAllDisabled {
+		s.cachedCatchAll(syntax.Domain, opts.profile(), facts)
+	}
+	switch {
+	case s.catchAllDisabled:
+		smtp, info, err = s.probe(opts, syntax.Domain, syntax.Username, false)
+	case !facts.catchAllProbed:
+		smtp, info, err = s.probe(opts, syntax.Domain, syntax.Username, true)
+		// A mailbox rejected after the connection came up still settled
+		// the catch-all probe
+		if smtp != nil && (smtpError(err) == nil || smtp.HostExists) {
+			confidence = probedConfidence(smtp, info.report)
+			if opts.context().Err() == nil {
+				s.domains.putCatchAll(syntax.Domain, opts.profile(), confidence)
+			}
+		}
+	case facts.CatchAllErr != nil:
+		err = facts.CatchAllErr
+	case facts.CatchAll:
+		smtp = &emailverifier.SMTP{HostExists: true, CatchAll: true}
+		confidence = facts.CatchAllConfidence
+	default:
+		smtp, info, err = s.probe(opts, syntax.Domain, syntax.Username, false)
+		confidence = facts.CatchAllConfidence
+	}
+	if s.expired(result, opts) {
+		return result
+	}
+	if info.reused {
+		result.Warnings = append(result.Warnings, WarningSMTPReused)
+	}
+	result.Attempts = info.attempts
+	s.noteMailServer(result, info.report)
+	if result.MXFallbackA {
+		// Nothing answering at the domain's own address either means it
+		// has no mail service after all, unless the probe wasn't made
+		if smtp != nil && smtp.HostExists {
+			result.DomainStatus = DomainHasMail
+		} else if !errors.Is(err, ErrProbeDeferred) && !errors.Is(err, ErrCircuitOpen) {
+			result.ran(CheckSMTP)
+			opts.progress(StageSMTP, result)
+			return result
+		}
+	}
+	s.applySMTP(result, smtp, err)
+	result.CatchAllCached = facts.catchAllCached
+	result.CatchAllConfidence = confidence
+	opts.progress(StageSMTP, result)
+	return result
+}
+
+// verifySpecial finishes a verification of an address literal or an
+// address at a non-routable domain. The list checks don't apply, and only
+// literals can be probed, when Config.ProbeIPLiterals allows it.
+func (s *Service) verifySpecial(verifier *emailverifier.Verifier, result *Result, addr specialAddress, opts Options) {
+	checks := opts.Checks
+	result.Username = addr.Username
+	result.Domain = addr.Domain
+	// The library only parses hostnames, so check the local part against
+	// a placeholder domain
+	result.IsValid = verifier.ParseAddress(addr.Username + "@example.com").Valid
+	result.ran(CheckSyntax)
+	if !result.IsValid {
+		s.setError(result, ErrCodeInvalidSyntax, nil)
+		return
+	}
+	warnCase(result, addr.Username)
+
+	if checks.Has(CheckRole) {
+		result.RoleAccount = s.isRole(verifier, addr.Username, s.keyTenants[opts.Key])
+		result.ran(CheckRole)
+	}
+	// The status needs no lookup, so it is reported even without the mx
+	// check
+	result.DomainStatus = addr.Status
+	result.DomainReason = addr.Reason
+	if addr.Status != DomainIPLiteral || !s.probeIPLiterals || !checks.Has(CheckSMTP) {
+		return
+	}
+	smtp, info, err := s.probe(opts, addr.Domain, addr.Username, !s.catchAllDisabled)
+	if s.expired(result, opts) {
+		return
+	}
+	if info.reused {
+		result.Warnings = append(result.Warnings, WarningSMTPReused)
+	}
+	result.Attempts = info.attempts
+	s.noteMailServer(result, info.report)
+	s.applySMTP(result, smtp, err)
+	if !s.catchAllDisabled && smtp != nil && smtp.HostExists {
+		result.CatchAllConfidence = probedConfidence(smtp, info.report)
+	}
+}
+
+// noteMailServer records the mail server that answered a probe on result,
+// and what its banner says about the domain's mail provider.
+func (s *Service) noteMailServer(result *Result, peer probeReport) {
+	result.SMTPHost, result.SMTPAddressFamily, result.SMTPBanner = peer.host, peer.family, peer.banner
+	result.Transport = peer.transport
+	hosts := mxHostNames(result.MX)
+	if len(hosts) == 0 && peer.host != "" {
+		hosts = []string{peer.host}
+	}
+	if provider := s.mailProviders.detect(result.ASCIIDomain, hosts, peer.banner); provider != "" {
+		result.MailProvider = provider
+	}
+}
+
+// mxHostNames returns the hosts of records.
+func mxHostNames(records []MXRecord) []string {
+	hosts := make([]string, len(records))
+	for i, record := range records {
+		hosts[i] = record.Host
+	}
+	return hosts
+}
+
+// applySMTP records the outcome of an SMTP probe.
+func (s *Service) applySMTP(result *Result, smtp *emailverifier.SMTP, err error) {
+	result.ran(CheckSMTP)
+	if err = smtpError(err); err != nil {
+		// A rejection that names the mailbox is an answer, not a failure
+		result.SMTPDetails = smtpDetailsFor(err)
+		if result.SMTPDetails != nil && result.SMTPDetails.Reason == SMTPReasonUserUnknown {
+			result.Reachable = ReachableNo
+			return
+		}
+		s.setError(result, ErrorCodeFor(err), err)
+		s.markRetryable(result, err)
+		return
+	}
+	result.Reachable = reachableFor(smtp)
+	result.CatchAll = smtp != nil && smtp.CatchAll
+}
+
+// ran records that a check was performed.
+func (r *Result) ran(check string) {
+	r.ChecksPerformed = append(r.ChecksPerformed, check)
+}
+
+// skippedChecks returns every known check not in performed, in run order.
+func skippedChecks(performed []string) []string {
+	done := make(map[string]bool, len(performed))
+	for _, check := range performed {
+		done[check] = true
+	}
+	skipped := []string{}
+	for _, check := range CheckOrder {
+		if !done[check] {
+			skipped = append(skipped, check)
+		}
+	}
+	return skipped
+}
+
+// smtpError unwraps the typed-nil *LookupError the library can return for
+// SMTP replies it does not treat as failures.
+func smtpError(err error) error {
+	if lookupErr, ok := err.(*emailverifier.LookupError); ok && lookupErr == nil {
+		return nil
+	}
+	return err
+}
+
+// reachableFor maps an SMTP check to the reachable enum the same way the
+// library does: catch-all servers can't confirm a mailbox.
+func reachableFor(smtp *emailverifier.SMTP) string {
+	switch {
+	case smtp == nil:
+		return ReachableUnknown
+	case smtp.Deliverable:
+		return ReachableYes
+	case smtp.CatchAll:
+		return ReachableUnknown
+	default:
+		return ReachableNo
+	}
+}
@@ -0,0 +1,341 @@
+package verify
+
+import (
+	"context"
+	"net"
+	"slices"
+	"sync"
+	"testing"
+	"time"
+
+	"email-verifier/pkg/verify/verifytest"
+)
+
+// sharedListVerifier builds the list verifier once for every test service,
+// since each build also fetches the disposable list
+var sharedListVerifier = sync.OnceValues(NewListVerifier)
+
+// newTestService returns a Service configured by cfg that shares the list
+// verifier with other tests
+func newTestService(cfg Config) *Service {
+	if cfg.BuildVerifier == nil {
+		cfg.BuildVerifier = sharedListVerifier
+	}
+	return New(cfg)
+}
+
+// TestEmailVerification tests the email verification functionality
+func TestEmailVerification(t *testing.T) {
+	s := newTestService(Config{})
+	// Test cases
+	testCases := []struct {
+		email    string
+		expected bool // whether we expect a valid result
+	}{
+		{"test@gmail.com", true},
+		{"invalid-email", false},
+		{"user@nonexistentdomain12345.com", true}, // valid format but may not be reachable
+		{"", false},
+		{"admin@example.com", true},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.email, func(t *testing.T) {
+			result := s.Verify(tc.email, Options{Checks: DefaultChecks})
+
+			if tc.expected && result.Error != "" {
+				// For valid format emails, we shouldn't have syntax errors
+				if tc.email != "" && tc.email != "invalid-email" {
+					// Only fail if it's a syntax error, not a network error
+					if result.Error == "Invalid email address format" {
+						t.Errorf("Expected valid email format for %s, got error: %s", tc.email, result.Error)
+					}
+				}
+			}
+
+			if !tc.expected && result.Error == "" && tc.email == "invalid-email" {
+				t.Errorf("Expected error for invalid email %s, but got none", tc.email)
+			}
+		})
+	}
+}
+
+// BenchmarkEmailVerification benchmarks the email verification function
+func BenchmarkEmailVerification(b *testing.B) {
+	s := newTestService(Config{})
+	emails := []string{
+		"test@gmail.com",
+		"user@example.com",
+		"admin@company.org",
+		"support@website.net",
+	}
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		email := emails[i%len(emails)]
+		s.Verify(email, Options{Checks: DefaultChecks})
+	}
+}
+
+// TestSyntaxValidation tests email syntax validation
+func TestSyntaxValidation(t *testing.T) {
+	testCases := []struct {
+		email string
+		valid bool
+	}{
+		{"user@example.com", true},
+		{"test.email@domain.co.uk", true},
+		{"user+tag@example.com", true},
+		{"invalid.email", false},
+		{"@example.com", false},
+		{"user@", false},
+		{"user@.com", false},
+		{"", false},
+	}
+
+	verifier, err := sharedListVerifier()
+	if err != nil {
+		t.Fatalf("Verifier unavailable: %v", err)
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.email, func(t *testing.T) {
+			syntax := verifier.ParseAddress(tc.email)
+			if syntax.Valid != tc.valid {
+				t.Errorf("Expected valid=%v for email %s, got %v", tc.valid, tc.email, syntax.Valid)
+			}
+		})
+	}
+}
+
+// TestDisposableEmailDetection tests disposable email detection
+func TestDisposableEmailDetection(t *testing.T) {
+	s := newTestService(Config{})
+	// Test with some known disposable domains
+	disposableEmails := []string{
+		"test@10minutemail.com",
+		"user@tempmail.org",
+	}
+
+	for _, email := range disposableEmails {
+		t.Run(email, func(t *testing.T) {
+			result := s.Verify(email, Options{Checks: DefaultChecks})
+			// Note: This might not always be true due to dynamic disposable domain lists
+			if !result.Disposable {
+				t.Logf("Email %s was not detected as disposable (this might be expected)", email)
+			}
+		})
+	}
+}
+
+// TestRoleAccountDetection tests role account detection
+func TestRoleAccountDetection(t *testing.T) {
+	s := newTestService(Config{})
+	roleEmails := []string{
+		"admin@example.com",
+		"support@example.com",
+		"info@example.com",
+		"noreply@example.com",
+	}
+
+	regularEmails := []string{
+		"john.doe@example.com",
+		"user123@example.com",
+	}
+
+	for _, email := range roleEmails {
+		t.Run(email, func(t *testing.T) {
+			result := s.Verify(email, Options{Checks: DefaultChecks})
+			if !result.RoleAccount {
+				t.Logf("Email %s was not detected as role account", email)
+			}
+		})
+	}
+
+	for _, email := range regularEmails {
+		t.Run(email, func(t *testing.T) {
+			result := s.Verify(email, Options{Checks: DefaultChecks})
+			if result.RoleAccount {
+				t.Errorf("Email %s was incorrectly detected as role account", email)
+			}
+		})
+	}
+}
+
+// TestFreeProviderDetection tests free email provider detection
+func TestFreeProviderDetection(t *testing.T) {
+	s := newTestService(Config{})
+	freeEmails := []string{
+		"user@gmail.com",
+		"test@yahoo.com",
+		"example@hotmail.com",
+	}
+
+	businessEmails := []string{
+		"user@company.com",
+		"test@business.org",
+	}
+
+	for _, email := range freeEmails {
+		t.Run(email, func(t *testing.T) {
+			result := s.Verify(email, Options{Checks: DefaultChecks})
+			if !result.Free {
+				t.Logf("Email %s was not detected as free provider", email)
+			}
+		})
+	}
+
+	for _, email := range businessEmails {
+		t.Run(email, func(t *testing.T) {
+			result := s.Verify(email, Options{Checks: DefaultChecks})
+			// Business emails might still be detected as free if the domain is actually free
+			// This is just for logging purposes
+			if result.Free {
+				t.Logf("Email %s was detected as free provider", email)
+			}
+		})
+	}
+}
+
+// TestVerifyProgress tests that stages are reported in order and that declining one skips the rest
+func TestVerifyProgress(t *testing.T) {
+	fake := verifytest.NewResolver()
+	fake.MX["partner.mock"] = []*net.MX{{Host: "mx.partner.mock.", Pref: 10}}
+	s := newTestService(Config{Resolver: fake})
+
+	var stages []string
+	stopAfter := ""
+	opts := Options{Checks: DefaultChecks, Progress: func(stage string, partial *Result) bool {
+		stages = append(stages, stage)
+		return stage != stopAfter
+	}}
+
+	result := s.Verify("jane@partner.mock", opts)
+	if want := []string{StageSyntax, StageLists, StageDNS}; !slices.Equal(stages, want) || !result.HasMxRecords {
+		t.Fatalf("Expected stages %v and MX found, got %v and %+v", want, stages, result)
+	}
+
+	stages, stopAfter = nil, StageLists
+	result = s.Verify("john@partner.mock", opts)
+	if !slices.Equal(stages, []string{StageSyntax, StageLists}) || fake.Lookups() != 1 || !slices.Contains(result.ChecksSkipped, CheckMX) {
+		t.Errorf("Expected to stop before DNS, got stages %v, %d lookups and skipped %v", stages, fake.Lookups(), result.ChecksSkipped)
+	}
+}
+
+// TestVerifyDeadline tests that a verification stops at its context's deadline, keeping the checks that finished
+func TestVerifyDeadline(t *testing.T) {
+	fake := verifytest.NewResolver()
+	fake.MX["partner.mock"] = []*net.MX{{Host: "mx.partner.mock.", Pref: 10}}
+	smtp := verifytest.NewSMTP()
+	smtp.Delay = 2 * time.Second
+	s := newTestService(Config{Resolver: fake, Prober: smtp.Probe})
+	checks := MustParseChecks(CheckSMTP)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	result := s.Verify("jane@partner.mock", Options{Checks: checks, Context: ctx})
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("Expected the probe to be abandoned at the deadline, took %v", elapsed)
+	}
+	if result.ErrorCode != ErrCodeDeadlineExceeded || result.Reachable != "unknown" || !result.HasMxRecords {
+		t.Errorf("Expected %s with the MX lookup kept, got %+v", ErrCodeDeadlineExceeded, result)
+	}
+	if slices.Contains(result.ChecksPerformed, CheckSMTP) || !slices.Contains(result.ChecksPerformed, CheckMX) {
+		t.Errorf("Expected mx performed and smtp skipped, got %v", result.ChecksPerformed)
+	}
+
+	// An expired context still answers the offline checks
+	result = s.Verify("jane@partner.mock", Options{Checks: checks, Context: ctx})
+	if result.ErrorCode != ErrCodeDeadlineExceeded || !result.IsValid || slices.Contains(result.ChecksPerformed, CheckMX) || fake.Lookups() != 1 {
+		t.Errorf("Expected syntax and lists only, got %+v after %d lookups", result, fake.Lookups())
+	}
+
+	results, _ := s.VerifyBatch([]string{"jane@partner.mock", "john@partner.mock"}, Options{Checks: checks, Context: ctx})
+	for _, result := range results {
+		if result.ErrorCode != ErrCodeDeadlineExceeded {
+			t.Errorf("Expected every batch result cut short, got %+v", result)
+		}
+	}
+}
+
+// TestSMTPDisabled tests that a service configured without SMTP never probes, whatever the checks ask for
+func TestSMTPDisabled(t *testing.T) {
+	fake := verifytest.NewResolver()
+	fake.MX["partner.mock"] = []*net.MX{{Host: "mx.partner.mock.", Pref: 10}}
+	smtp := verifytest.NewSMTP()
+	smtp.Mailboxes["jane@partner.mock"] = true
+	s := newTestService(Config{Resolver: fake, Prober: smtp.Probe, SMTPDisabled: true})
+	checks := MustParseChecks(CheckSMTP)
+
+	result := s.Verify("jane@partner.mock", Options{Checks: checks})
+	if !result.HasMxRecords || !slices.Contains(result.ChecksSkipped, CheckSMTP) || result.Reachable != "unknown" {
+		t.Errorf("Expected the MX lookup without a probe, got %+v", result)
+	}
+	results, _ := s.VerifyBatch([]string{"jane@partner.mock", "bob@partner.mock"}, Options{Checks: checks})
+	if plan := s.PlanBatch([]string{"jane@partner.mock"}, Options{Checks: checks}); smtp.Probes() != 0 || results[1].Reachable != "unknown" || plan.EstimatedCatchAllProbes != 0 {
+		t.Errorf("Expected no probes from a batch or its plan, got %d probes", smtp.Probes())
+	}
+}
+
+// TestVerifyTimeout tests that Config.VerifyTimeout bounds a verification whose caller set no deadline, and that cancelling stops it too
+func TestVerifyTimeout(t *testing.T) {
+	fake := verifytest.NewResolver()
+	fake.MX["partner.mock"] = []*net.MX{{Host: "mx.partner.mock.", Pref: 10}}
+	smtp := verifytest.NewSMTP()
+	smtp.Delay = 2 * time.Second
+	s := newTestService(Config{Resolver: fake, Prober: smtp.Probe, VerifyTimeout: 50 * time.Millisecond})
+	checks := MustParseChecks(CheckSMTP)
+
+	start := time.Now()
+	result := s.Verify("jane@partner.mock", Options{Checks: checks})
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("Expected the probe to be abandoned at the timeout, took %v", elapsed)
+	}
+	if result.ErrorCode != ErrCodeDeadlineExceeded || result.Reachable != "unknown" || !result.HasMxRecords || result.Error == "" {
+		t.Errorf("Expected %s with the MX lookup kept, got %+v", ErrCodeDeadlineExceeded, result)
+	}
+
+	// A caller that goes away stops the verification before the timeout
+	s = newTestService(Config{Resolver: fake, Prober: smtp.Probe, VerifyTimeout: time.Minute})
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(50*time.Millisecond, cancel)
+	start = time.Now()
+	if result := s.Verify("jane@partner.mock", Options{Checks: checks, Context: ctx}); result.ErrorCode != ErrCodeDeadlineExceeded || time.Since(start) > time.Second {
+		t.Errorf("Expected the cancelled verification to stop, got %+v after %v", result, time.Since(start))
+	}
+}
+
+// TestVerifySuggestion tests that a typo suggestion is verified one level deep, within the request's deadline, and billed
+func TestVerifySuggestion(t *testing.T) {
+	fake := verifytest.NewResolver()
+	fake.MX["gmail.com"] = []*net.MX{{Host: "gmail-smtp-in.l.google.com.", Pref: 5}}
+	s := newTestService(Config{Resolver: fake})
+	checks := MustParseChecks(CheckMX, CheckSuggest)
+
+	plain := s.Verify("jane@gmaii.com", Options{Checks: checks})
+	if plain.Suggestion != "gmail.com" || plain.SuggestionResult != nil {
+		t.Fatalf("Expected a suggestion without its result, got %+v", plain)
+	}
+	result := s.Verify("jane@gmaii.com", Options{Checks: checks, VerifySuggestion: true})
+	suggested := result.SuggestionResult
+	if suggested == nil || suggested.Email != "jane@gmail.com" || !suggested.HasMxRecords {
+		t.Fatalf("Expected the suggested address verified, got %+v", suggested)
+	}
+	if suggested.SuggestionResult != nil || suggested.Suggestion != "" {
+		t.Errorf("Expected the suggested address verified one level deep, got %+v", suggested)
+	}
+	if result.CostUnits != plain.CostUnits+suggested.CostUnits {
+		t.Errorf("Expected the suggestion's cost included, got %d for %d and %d", result.CostUnits, plain.CostUnits, suggested.CostUnits)
+	}
+	if result := s.Verify("jane@acme.mock", Options{Checks: checks, VerifySuggestion: true}); result.SuggestionResult != nil {
+		t.Errorf("Expected no suggestion result without a suggestion, got %+v", result.SuggestionResult)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	result = s.Verify("jane@gmaii.com", Options{Checks: checks, VerifySuggestion: true, Context: ctx})
+	if result.SuggestionResult == nil || result.SuggestionResult.ErrorCode != ErrCodeDeadlineExceeded {
+		t.Errorf("Expected the suggested address cut short by the same deadline, got %+v", result.SuggestionResult)
+	}
+}
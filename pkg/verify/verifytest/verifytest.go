@@ -0,0 +1,131 @@
+// Package verifytest provides stand-ins for the network dependencies of
+// package verify: a resolver with canned DNS answers and an SMTP prober with
+// canned mailboxes.
+package verifytest
+
+import (
+	"context"
+	"net"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	emailverifier "github.com/AfterShip/email-verifier"
+)
+
+// Resolver serves canned DNS answers. Names missing from every map are
+// reported as NXDOMAIN. Populate the maps before handing it to a Service.
+type Resolver struct {
+	mu    sync.Mutex
+	MX    map[string][]*net.MX
+	TXT   map[string][]string
+	Hosts map[string][]string
+	Err   map[string]error
+
+	lookups atomic.Int64
+}
+
+func NewResolver() *Resolver {
+	return &Resolver{
+		MX:    make(map[string][]*net.MX),
+		TXT:   make(map[string][]string),
+		Hosts: make(map[string][]string),
+		Err:   make(map[string]error),
+	}
+}
+
+func (f *Resolver) LookupMX(ctx context.Context, name string) ([]*net.MX, error) {
+	f.lookups.Add(1)
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if err := f.Err[name]; err != nil {
+		return nil, err
+	}
+	if records, ok := f.MX[name]; ok {
+		return records, nil
+	}
+	return nil, notFound(name)
+}
+
+func (f *Resolver) LookupTXT(ctx context.Context, name string) ([]string, error) {
+	f.lookups.Add(1)
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if err := f.Err[name]; err != nil {
+		return nil, err
+	}
+	if records, ok := f.TXT[name]; ok {
+		return records, nil
+	}
+	return nil, notFound(name)
+}
+
+func (f *Resolver) LookupHost(ctx context.Context, host string) ([]string, error) {
+	f.lookups.Add(1)
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if err := f.Err[host]; err != nil {
+		return nil, err
+	}
+	if addrs, ok := f.Hosts[host]; ok {
+		return addrs, nil
+	}
+	return nil, notFound(host)
+}
+
+// Lookups returns the number of lookups answered so far.
+func (f *Resolver) Lookups() int64 { return f.lookups.Load() }
+
+func notFound(name string) error {
+	return &net.DNSError{Err: "no such host", Name: name, IsNotFound: true}
+}
+
+// SMTP answers probes from canned per-domain behaviour and counts them. Its
+// Probe method has the signature of verify.Prober.
+type SMTP struct {
+	CatchAll  map[string]bool
+	Mailboxes map[string]bool // user@domain that exist
+	// Errors fails every probe of a domain, e.g. with a parsed SMTP reply.
+	Errors map[string]error
+	// Delay is how long each probe takes, as with a tarpitting server. A
+	// probe whose context ends first returns the context's error.
+	Delay  time.Duration
+	probes atomic.Int64
+}
+
+func NewSMTP() *SMTP {
+	return &SMTP{CatchAll: make(map[string]bool), Mailboxes: make(map[string]bool), Errors: make(map[string]error)}
+}
+
+func (f *SMTP) Probe(ctx context.Context, profile, domain, username string, catchAll bool) (*emailverifier.SMTP, error) {
+	f.probes.Add(1)
+	if f.Delay > 0 {
+		timer := time.NewTimer(f.Delay)
+		defer timer.Stop()
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+	if err := f.Errors[domain]; err != nil {
+		return nil, err
+	}
+	if catchAll && f.CatchAll[domain] {
+		return &emailverifier.SMTP{HostExists: true, CatchAll: true}, nil
+	}
+	if username == "" {
+		return &emailverifier.SMTP{HostExists: true}, nil
+	}
+	return &emailverifier.SMTP{HostExists: true, Deliverable: f.Mailboxes[username+"@"+domain]}, nil
+}
+
+// Probes returns the number of probes answered so far.
+func (f *SMTP) Probes() int64 { return f.probes.Load() }
+
+// NewListVerifier builds a list verifier from the lists embedded in the
+// library, without fetching disposable list updates. It has the signature
+// of verify.Config.BuildVerifier.
+func NewListVerifier() (*emailverifier.Verifier, error) {
+	return emailverifier.NewVerifier().EnableDomainSuggest(), nil
+}